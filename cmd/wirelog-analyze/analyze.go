@@ -0,0 +1,210 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jacobsa/fuse"
+)
+
+// Statistics for a single kind of op.
+type opStats struct {
+	durations []time.Duration
+	errors    map[string]int // Keyed by errno name
+}
+
+// An op that was among the slowest seen.
+type slowOp struct {
+	operation string
+	start     time.Time
+	duration  time.Duration
+	fuseID    uint64
+	status    string
+}
+
+// Statistics accumulated from the records of one or more wire logs.
+type analysis struct {
+	ops map[string]*opStats
+
+	// The slowest ops seen, slowest first, at most top of them.
+	top     int
+	slowest []slowOp
+}
+
+func newAnalysis(top int) *analysis {
+	return &analysis{
+		ops: make(map[string]*opStats),
+		top: top,
+	}
+}
+
+// Add a record to the analysis. Records for events rather than ops, such as
+// Mount, are ignored.
+func (a *analysis) add(wlog *fuse.WireLogRecord) {
+	switch wlog.Operation {
+	case "Mount", "Unmount", "InterruptOp", "HandleSummary", "NotImplemented":
+		return
+	}
+
+	s, ok := a.ops[wlog.Operation]
+	if !ok {
+		s = &opStats{errors: make(map[string]int)}
+		a.ops[wlog.Operation] = s
+	}
+
+	s.durations = append(s.durations, wlog.Duration)
+	if wlog.Status != 0 {
+		s.errors[statusName(wlog)]++
+	}
+
+	// Keep the slowest ops, sorted slowest first.
+	if a.top <= 0 {
+		return
+	}
+
+	if len(a.slowest) == a.top && wlog.Duration <= a.slowest[len(a.slowest)-1].duration {
+		return
+	}
+
+	op := slowOp{
+		operation: wlog.Operation,
+		start:     wlog.StartTime,
+		duration:  wlog.Duration,
+		status:    "ok",
+	}
+	if wlog.Context != nil {
+		op.fuseID = wlog.Context.FuseID
+	}
+	if wlog.Status != 0 {
+		op.status = statusName(wlog)
+	}
+
+	i, _ := slices.BinarySearchFunc(a.slowest, op.duration, func(o slowOp, d time.Duration) int {
+		return cmp.Compare(d, o.duration)
+	})
+	a.slowest = slices.Insert(a.slowest, i, op)
+	if len(a.slowest) > a.top {
+		a.slowest = a.slowest[:a.top]
+	}
+}
+
+// Return the symbolic name of a record's status, falling back to the number
+// for logs that predate StatusName.
+func statusName(wlog *fuse.WireLogRecord) string {
+	if wlog.StatusName != "" {
+		return wlog.StatusName
+	}
+
+	return "errno " + strconv.Itoa(wlog.Status)
+}
+
+// Return the p'th percentile of sorted durations, using the nearest-rank
+// method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(p*float64(len(sorted))+0.999999) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+// Print the analysis.
+func (a *analysis) report(w io.Writer) {
+	names := make([]string, 0, len(a.ops))
+	for name := range a.ops {
+		names = append(names, name)
+	}
+
+	// Busiest ops first.
+	slices.SortFunc(names, func(x, y string) int {
+		if c := cmp.Compare(len(a.ops[y].durations), len(a.ops[x].durations)); c != 0 {
+			return c
+		}
+		return cmp.Compare(x, y)
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\tcount\terrors\tp50\tp95\tp99\tmax\t")
+	for _, name := range names {
+		s := a.ops[name]
+		slices.Sort(s.durations)
+
+		var errors int
+		for _, n := range s.errors {
+			errors += n
+		}
+
+		fmt.Fprintf(
+			tw,
+			"%s\t%d\t%d\t%v\t%v\t%v\t%v\t\n",
+			name,
+			len(s.durations),
+			errors,
+			percentile(s.durations, 0.50),
+			percentile(s.durations, 0.95),
+			percentile(s.durations, 0.99),
+			s.durations[len(s.durations)-1])
+	}
+	tw.Flush()
+
+	if len(a.slowest) > 0 {
+		fmt.Fprintf(w, "\nSlowest ops:\n")
+		tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		for _, op := range a.slowest {
+			fmt.Fprintf(
+				tw,
+				"  %v\t%s\tfuse_id=%d\t%s\t%s\n",
+				op.duration,
+				op.operation,
+				op.fuseID,
+				op.status,
+				op.start.Format(time.RFC3339Nano))
+		}
+		tw.Flush()
+	}
+
+	var printedHeader bool
+	for _, name := range names {
+		s := a.ops[name]
+		statuses := make([]string, 0, len(s.errors))
+		for status := range s.errors {
+			statuses = append(statuses, status)
+		}
+
+		// Most common errors first.
+		slices.SortFunc(statuses, func(x, y string) int {
+			if c := cmp.Compare(s.errors[y], s.errors[x]); c != 0 {
+				return c
+			}
+			return cmp.Compare(x, y)
+		})
+
+		for _, status := range statuses {
+			if !printedHeader {
+				fmt.Fprintf(w, "\nErrors:\n")
+				printedHeader = true
+			}
+			fmt.Fprintf(w, "  %s %s: %d\n", name, status, s.errors[status])
+		}
+	}
+}
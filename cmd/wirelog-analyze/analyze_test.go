@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+func TestAnalysis(t *testing.T) {
+	var buf bytes.Buffer
+	write := func(op string, d time.Duration, errno syscall.Errno, fuseID uint64) {
+		wlog := fuse.NewWireLogRecord()
+		wlog.Operation = op
+		wlog.Duration = d
+		wlog.Status = int(errno)
+		if errno != 0 {
+			wlog.StatusName = "ENOENT"
+		}
+		wlog.Context = &fuseops.OpContext{FuseID: fuseID}
+
+		entry, err := fuse.JSONWireLogFormatter{Compact: true}.Format(wlog)
+		if err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		buf.Write(entry)
+	}
+
+	write("Mount", 0, 0, 0)
+	for i := 1; i <= 100; i++ {
+		var errno syscall.Errno
+		if i%10 == 0 {
+			errno = syscall.ENOENT
+		}
+		write("LookUpInodeOp", time.Duration(i)*time.Millisecond, errno, uint64(i))
+	}
+	write("StatFSOp", time.Second, 0, 1000)
+
+	a := newAnalysis(2)
+	if err := a.read(&buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	s := a.ops["LookUpInodeOp"]
+	if len(s.durations) != 100 || s.errors["ENOENT"] != 10 {
+		t.Errorf("unexpected LookUpInodeOp stats: %d ops, errors %v", len(s.durations), s.errors)
+	}
+	if _, ok := a.ops["Mount"]; ok {
+		t.Errorf("expected Mount events to be ignored")
+	}
+
+	if len(a.slowest) != 2 || a.slowest[0].fuseID != 1000 || a.slowest[1].fuseID != 100 {
+		t.Errorf("unexpected slowest ops: %+v", a.slowest)
+	}
+
+	var out strings.Builder
+	a.report(&out)
+
+	for _, want := range []string{
+		"LookUpInodeOp    100      10  50ms  95ms  99ms  100ms",
+		"fuse_id=1000  ok",
+		"LookUpInodeOp ENOENT: 10",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected report to contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestAnalysisIgnoresEvents(t *testing.T) {
+	var buf bytes.Buffer
+	for _, op := range []string{
+		"Mount",
+		"FlushFileOp",
+		"NotImplemented",
+		"InterruptOp",
+		"HandleSummary",
+		"Unmount",
+	} {
+		wlog := fuse.NewWireLogRecord()
+		wlog.Operation = op
+		wlog.Duration = time.Millisecond
+		wlog.Context = &fuseops.OpContext{}
+
+		entry, err := fuse.JSONWireLogFormatter{Compact: true}.Format(wlog)
+		if err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		buf.Write(entry)
+	}
+
+	a := newAnalysis(10)
+	if err := a.read(&buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	if len(a.ops) != 1 || a.ops["FlushFileOp"] == nil {
+		t.Errorf("expected only FlushFileOp to be counted, got %v", a.ops)
+	}
+	if len(a.slowest) != 1 || a.slowest[0].operation != "FlushFileOp" {
+		t.Errorf("unexpected slowest ops: %+v", a.slowest)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// wirelog-analyze summarizes a wire log written by fuse.MountConfig.WireLogger
+// with the default JSON formatter: per-op counts and latency percentiles, the
+// slowest individual ops, and a breakdown of errors.
+//
+// Usage:
+//
+//	wirelog-analyze [-top N] [file ...]
+//
+// If no files are named, the log is read from stdin.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/jacobsa/fuse/wirelogfmt"
+)
+
+var fTop = flag.Int("top", 10, "The number of slowest ops to list.")
+
+func main() {
+	flag.Parse()
+	log.SetFlags(0)
+
+	a := newAnalysis(*fTop)
+
+	if flag.NArg() == 0 {
+		if err := a.read(os.Stdin); err != nil {
+			log.Fatalf("stdin: %v", err)
+		}
+	}
+
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatalf("Open: %v", err)
+		}
+
+		err = a.read(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	a.report(w)
+	if err := w.Flush(); err != nil {
+		log.Fatalf("Flush: %v", err)
+	}
+}
+
+// Add all of the records in r to the analysis.
+func (a *analysis) read(r io.Reader) error {
+	d := wirelogfmt.NewDecoder(bufio.NewReader(r))
+	for {
+		wlog, err := d.Decode()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		a.add(wlog)
+	}
+}
@@ -23,7 +23,9 @@ import (
 	"path"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/internal/buffer"
@@ -62,13 +64,44 @@ type Connection struct {
 	cfg         MountConfig
 	debugLogger *log.Logger
 	errorLogger *log.Logger
-	wireLogger  io.Writer
+
+	// The destination for wire log records, if any. May be swapped while the
+	// connection is being served; see SetWireLogger.
+	wireLogger atomic.Pointer[wireLogWriter]
+
+	// Tracks the paths of inodes for wire log records, if enabled.
+	paths *inodePaths
+
+	// Tracks open handles for wire log records, if enabled.
+	handles *handleSessions
+
+	// Records raw messages, if MountConfig.WireCapture is set.
+	capture *wireCapture
 
 	// The device through which we're talking to the kernel, and the protocol
 	// version that we're using to talk to it.
 	dev      *os.File
 	protocol fusekernel.Protocol
 
+	// The protocol version spoken by the kernel, which may be newer than the
+	// one we're using. Notifications may use features of the newer version.
+	kernelProtocol fusekernel.Protocol
+
+	// The capabilities negotiated by Init.
+	flags InitFlags
+
+	// The time at which Init completed, or zero if it hasn't.
+	mountTime time.Time
+
+	// Set once the connection has been handed over to another process, after
+	// which ReadOp reads no further ops. See MountedFileSystem.Detach.
+	detached atomic.Bool
+
+	// Whether Init negotiated splicing replies to the kernel, and whether the
+	// kernel may move the spliced pages. See splice.go.
+	splice     bool
+	spliceMove bool
+
 	mu sync.Mutex
 
 	// A map from fuse "unique" request ID (*not* the op ID for logging used
@@ -77,9 +110,59 @@ type Connection struct {
 	// GUARDED_BY(mu)
 	cancelFuncs map[uint64]func()
 
+	// The number of ops returned by ReadOp that haven't been replied to, and a
+	// condition signalled when it drops to zero, for Detach.
+	//
+	// GUARDED_BY(mu)
+	inFlight int
+	idle     sync.Cond
+
+	// The request IDs of in-flight ops whose contexts aren't to be cancelled
+	// when the kernel interrupts them. See MountConfig.InterruptPolicy.
+	//
+	// GUARDED_BY(mu)
+	uninterruptible map[uint64]struct{}
+
+	// The time at which the kernel first asked to interrupt each in-flight op
+	// that it has interrupted, keyed by fuse request ID.
+	//
+	// GUARDED_BY(mu)
+	interrupts map[uint64]time.Time
+
+	// Channels on which to deliver the kernel's answers to in-flight retrieve
+	// notifications, keyed by the notification's unique ID, and the ID to use
+	// for the next one.
+	//
+	// GUARDED_BY(mu)
+	retrievals     map[uint64]chan<- []byte
+	nextRetrieveID uint64
+
+	// The largest request payload that the kernel may send, in bytes, which
+	// is negotiated during Init. Incoming message buffers are sized to hold it.
+	//
+	// GUARDED_BY(mu)
+	maxPayload int
+
+	// The names of the types of ops that the server has replied ENOSYS to.
+	// See MountConfig.NotImplementedReplies.
+	//
+	// GUARDED_BY(mu)
+	notImplemented map[string]bool
+
 	// Freelists, serviced by freelists.go.
 	inMessages  freelist.Freelist // GUARDED_BY(mu)
 	outMessages freelist.Freelist // GUARDED_BY(mu)
+
+	// Pipes through which to splice replies that aren't in use.
+	//
+	// GUARDED_BY(mu)
+	splicePipes []*splicePipe
+
+	// Messages read while coalescing forgets that are yet to be returned by
+	// readMessage. See forget_batch.go.
+	//
+	// GUARDED_BY(mu)
+	stashed []*buffer.InMessage
 }
 
 // State that is maintained for each in-flight op. This is stuffed into the
@@ -89,11 +172,32 @@ type opState struct {
 	outMsg *buffer.OutMessage
 	op     interface{}
 	wlog   *WireLogRecord
+
+	// The time at which the op was read, if the connection has a MetricsSink.
+	start time.Time
+
+	// Set if the op may time out. See MountConfig.OpTimeout.
+	timer *opTimer
 }
 
 // Return the current wirelog record from the context if the MountConfig
 // contained a non-nil wireLogger, nil otherwise.
+//
+// Use the record's SetExtra and AddDuration methods to annotate it; they may
+// be called from any goroutine, even after the op has been replied to, though
+// by then they have no effect.
 func GetWirelog(ctx context.Context) *WireLogRecord {
+	wlog := wireLogRecord(ctx)
+	if wlog != nil && wlog.state != nil {
+		// The caller may hang on to the record, so it mustn't be recycled.
+		wlog.state.escaped.Store(true)
+	}
+	return wlog
+}
+
+// Return the current wirelog record from the context, for use within this
+// package.
+func wireLogRecord(ctx context.Context) *WireLogRecord {
 	val := ctx.Value(contextKey)
 	state, ok := val.(opState)
 	if ok {
@@ -103,7 +207,8 @@ func GetWirelog(ctx context.Context) *WireLogRecord {
 }
 
 // Create a connection wrapping the supplied file descriptor connected to the
-// kernel. You must eventually call c.close().
+// kernel. You must eventually call c.close(). If state is non-nil, the
+// connection is restored from it rather than initialized.
 //
 // The loggers may be nil.
 func newConnection(
@@ -111,14 +216,37 @@ func newConnection(
 	debugLogger *log.Logger,
 	errorLogger *log.Logger,
 	wireLogger io.Writer,
-	dev *os.File) (*Connection, error) {
+	dev *os.File,
+	state *ConnectionState) (*Connection, error) {
 	c := &Connection{
-		cfg:         cfg,
-		debugLogger: debugLogger,
-		errorLogger: errorLogger,
-		wireLogger:  wireLogger,
-		dev:         dev,
-		cancelFuncs: make(map[uint64]func()),
+		cfg:             cfg,
+		debugLogger:     debugLogger,
+		errorLogger:     errorLogger,
+		dev:             dev,
+		cancelFuncs:     make(map[uint64]func()),
+		uninterruptible: make(map[uint64]struct{}),
+		interrupts:      make(map[uint64]time.Time),
+		retrievals:      make(map[uint64]chan<- []byte),
+		maxPayload:      max(buffer.MaxReadSize, buffer.MaxWriteSize),
+	}
+	c.idle.L = &c.mu
+	c.SetWireLogger(wireLogger)
+
+	if cfg.WireLogResolvePaths {
+		c.paths = newInodePaths()
+	}
+
+	if cfg.WireLogHandleSessions {
+		c.handles = newHandleSessions()
+	}
+
+	if cfg.WireCapture != nil {
+		c.capture = &wireCapture{w: cfg.WireCapture, snapLen: cfg.WireCaptureSnapLen}
+	}
+
+	if state != nil {
+		c.restore(state)
+		return c, nil
 	}
 
 	// Initialize.
@@ -156,6 +284,7 @@ func (c *Connection) Init() error {
 	}
 
 	// Downgrade our protocol if necessary.
+	c.kernelProtocol = initOp.Kernel
 	c.protocol = fusekernel.Protocol{
 		fusekernel.ProtoVersionMaxMajor,
 		fusekernel.ProtoVersionMaxMinor,
@@ -165,17 +294,36 @@ func (c *Connection) Init() error {
 		c.protocol = initOp.Kernel
 	}
 
+	kernelFlags := makeInitFlags(initOp.Flags, initOp.Flags2)
 	cacheSymlinks := initOp.Flags&fusekernel.InitCacheSymlinks > 0
 	noOpenSupport := initOp.Flags&fusekernel.InitNoOpenSupport > 0
 	noOpendirSupport := initOp.Flags&fusekernel.InitNoOpendirSupport > 0
 	asyncDIO := initOp.Flags&fusekernel.InitAsyncDIO > 0
+	atomicTrunc := initOp.Flags&fusekernel.InitAtomicTrunc > 0
+	dontMask := initOp.Flags&fusekernel.InitDontMask > 0
+	posixACL := initOp.Flags&fusekernel.InitPosixACL > 0
+	killPriv := initOp.Flags&fusekernel.InitHandleKillprivV2 > 0
+	exportSupport := initOp.Flags&fusekernel.InitExportSupport > 0
+	flockLocks := initOp.Flags&fusekernel.InitFlockLocks > 0
+	passthrough := initOp.Flags&fusekernel.InitExt > 0 &&
+		initOp.Flags2&fusekernel.InitPassthrough > 0
+
+	// Kernels before 7.38 pass security contexts in a different format.
+	securityCtx := initOp.Flags&fusekernel.InitExt > 0 &&
+		initOp.Flags2&fusekernel.InitSecurityCtx > 0 &&
+		!initOp.Kernel.LT(fusekernel.Protocol{Major: 7, Minor: 38})
+	spliceWrite := initOp.Flags&fusekernel.InitSpliceWrite > 0
+	spliceMove := initOp.Flags&fusekernel.InitSpliceMove > 0
 
 	// Respond to the init op.
 	initOp.Library = c.protocol
 	initOp.MaxReadahead = maxReadahead
-	initOp.MaxWrite = buffer.MaxWriteSize
+	initOp.MaxWrite = uint32(c.cfg.maxWrite())
+	initOp.MaxBackground = c.cfg.maxBackground()
+	initOp.CongestionThreshold = c.cfg.congestionThreshold()
 
 	initOp.Flags = 0
+	initOp.Flags2 = 0
 
 	// Tell the kernel not to use pitifully small 4 KiB writes.
 	initOp.Flags |= fusekernel.InitBigWrites
@@ -194,10 +342,15 @@ func (c *Connection) Init() error {
 	// MaxPages is the maximum size, in hardware pages, of the FUSE message
 	// payload. It applies to both requests and replies, and does not include
 	// the extra 1 page for the FUSE header and the "args" struct. We set it to
-	// the max of our message in/out payload sizes.
-	maxPayload := max(buffer.MaxReadSize, buffer.MaxWriteSize)
+	// the max of our message in/out payload sizes, and size the buffers for
+	// incoming messages to match, since reads are served from their spare room.
+	maxPayload := max(buffer.MaxReadSize, int(initOp.MaxWrite))
 	initOp.MaxPages = uint16(maxPayload / buffer.GetPageSize())
 
+	c.mu.Lock()
+	c.maxPayload = maxPayload
+	c.mu.Unlock()
+
 	// Enable writeback caching if the user hasn't asked us not to.
 	if !c.cfg.DisableWritebackCaching {
 		initOp.Flags |= fusekernel.InitWritebackCache
@@ -226,10 +379,52 @@ func (c *Connection) Init() error {
 		initOp.Flags |= fusekernel.InitParallelDirOps
 	}
 
-	if c.cfg.EnableAtomicTrunc {
+	if c.cfg.EnableAtomicTrunc && atomicTrunc {
 		initOp.Flags |= fusekernel.InitAtomicTrunc
 	}
 
+	if c.cfg.EnableDontMask && dontMask {
+		initOp.Flags |= fusekernel.InitDontMask
+	}
+
+	if c.cfg.EnablePosixACL && posixACL {
+		initOp.Flags |= fusekernel.InitPosixACL
+	}
+
+	if c.cfg.EnableExportSupport && exportSupport {
+		initOp.Flags |= fusekernel.InitExportSupport
+	}
+
+	if c.cfg.EnableHandleKillPriv && killPriv {
+		initOp.Flags |= fusekernel.InitHandleKillprivV2
+	}
+
+	if c.cfg.EnableFlockLocks && flockLocks {
+		initOp.Flags |= fusekernel.InitFlockLocks
+	}
+
+	if c.cfg.EnablePassthrough && passthrough {
+		initOp.Flags |= fusekernel.InitExt
+		initOp.Flags2 |= fusekernel.InitPassthrough
+	}
+
+	// Tell the kernel that we may splice replies to it, and that it may steal
+	// the spliced pages rather than copying them if it can. We don't ask to
+	// splice requests out of it (InitSpliceRead): WriteFileOp hands its data
+	// to file systems as a byte slice, so it would be copied anyway.
+	if c.cfg.EnableSplice && spliceSupported && spliceWrite {
+		initOp.Flags |= fusekernel.InitSpliceWrite
+
+		if spliceMove {
+			initOp.Flags |= fusekernel.InitSpliceMove
+		}
+	}
+
+	if c.cfg.EnableSecurityContext && securityCtx {
+		initOp.Flags |= fusekernel.InitExt
+		initOp.Flags2 |= fusekernel.InitSecurityCtx
+	}
+
 	if c.cfg.EnableReaddirplus {
 		// Enable Readdirplus support, allowing the kernel to use Readdirplus
 		initOp.Flags |= fusekernel.InitDoReaddirplus
@@ -240,7 +435,47 @@ func (c *Connection) Init() error {
 		}
 	}
 
-	return c.Reply(ctx, nil)
+	// Let the file system have the last word, and update the state that
+	// depends on the flags it settled on.
+	flags, err := c.configureInit(initOp, kernelFlags)
+	if err != nil {
+		c.Reply(ctx, syscall.EPROTO)
+		return err
+	}
+
+	initOp.Flags, initOp.Flags2 = flags.split()
+	c.flags = flags
+	c.splice = spliceSupported && flags&InitSpliceWrite != 0
+	c.spliceMove = c.splice && flags&InitSpliceMove != 0
+
+	// Backing files may not themselves be on FUSE file systems that use
+	// passthrough, which is what a stack depth of one means.
+	if flags&InitPassthrough != 0 {
+		initOp.MaxStackDepth = 1
+	}
+
+	if err := c.Reply(ctx, nil); err != nil {
+		return err
+	}
+
+	c.mountTime = time.Now()
+	if wlog := c.newEventRecord("Mount"); wlog != nil {
+		wlog.Args["KernelProtocol"] = initOp.Kernel.String()
+		wlog.Args["KernelFlags"] = kernelFlags.String()
+		wlog.Args["Protocol"] = c.protocol.String()
+		wlog.Args["Flags"] = initOp.Flags.String()
+		if initOp.Flags2 != 0 {
+			wlog.Args["Flags2"] = initOp.Flags2.String()
+		}
+		wlog.Args["MaxReadahead"] = initOp.MaxReadahead
+		wlog.Args["MaxWrite"] = initOp.MaxWrite
+		wlog.Args["MaxPages"] = initOp.MaxPages
+		wlog.Args["MaxBackground"] = initOp.MaxBackground
+		wlog.Args["CongestionThreshold"] = initOp.CongestionThreshold
+		c.writeEventRecord(wlog)
+	}
+
+	return nil
 }
 
 // Log information for an operation with the given ID. calldepth is the depth
@@ -280,7 +515,8 @@ func (c *Connection) debugLog(
 // LOCKS_EXCLUDED(c.mu)
 func (c *Connection) recordCancelFunc(
 	fuseID uint64,
-	f func()) {
+	f func(),
+	interruptible bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -289,17 +525,21 @@ func (c *Connection) recordCancelFunc(
 	}
 
 	c.cancelFuncs[fuseID] = f
+	if !interruptible {
+		c.uninterruptible[fuseID] = struct{}{}
+	}
 }
 
 // Set up state for an op that is about to be returned to the user, given its
-// underlying fuse opcode and request ID.
+// underlying fuse opcode and request ID, and the op itself.
 //
 // Return a context that should be used for the op.
 //
 // LOCKS_EXCLUDED(c.mu)
 func (c *Connection) beginOp(
 	opCode uint32,
-	fuseID uint64) context.Context {
+	fuseID uint64,
+	op any) context.Context {
 	// Start with the parent context.
 	ctx := c.cfg.OpContext
 
@@ -314,7 +554,7 @@ func (c *Connection) beginOp(
 	if opCode != fusekernel.OpForget {
 		var cancel func()
 		ctx, cancel = context.WithCancel(ctx)
-		c.recordCancelFunc(fuseID, cancel)
+		c.recordCancelFunc(fuseID, cancel, c.cfg.interruptible(op))
 	}
 
 	return ctx
@@ -325,10 +565,13 @@ func (c *Connection) beginOp(
 // a response is sent to the kernel, to avoid a race where the request's ID
 // might be reused by osxfuse.
 //
+// Return the time at which the op was interrupted, or the zero time if it
+// wasn't.
+//
 // LOCKS_EXCLUDED(c.mu)
 func (c *Connection) finishOp(
 	opCode uint32,
-	fuseID uint64) {
+	fuseID uint64) (interrupted time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -346,11 +589,20 @@ func (c *Connection) finishOp(
 
 		cancel()
 		delete(c.cancelFuncs, fuseID)
+		delete(c.uninterruptible, fuseID)
+
+		interrupted = c.interrupts[fuseID]
+		delete(c.interrupts, fuseID)
 	}
+
+	return interrupted
 }
 
+// Cancel the op with the supplied request ID, returning false if it has
+// already been replied to.
+//
 // LOCKS_EXCLUDED(c.mu)
-func (c *Connection) handleInterrupt(fuseID uint64) {
+func (c *Connection) handleInterrupt(fuseID uint64) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -370,15 +622,31 @@ func (c *Connection) handleInterrupt(fuseID uint64) {
 	// Cf. http://comments.gmane.org/gmane.comp.file-systems.fuse.devel/14675
 	cancel, ok := c.cancelFuncs[fuseID]
 	if !ok {
-		return
+		return false
 	}
 
-	cancel()
+	// The kernel may repeat an interrupt; remember the first.
+	if _, ok := c.interrupts[fuseID]; !ok {
+		c.interrupts[fuseID] = time.Now()
+	}
+
+	// Ops that aren't to be cancelled are left to run to completion.
+	if _, ok := c.uninterruptible[fuseID]; !ok {
+		cancel()
+	}
+
+	return true
 }
 
 // Read the next message from the kernel. The message must later be destroyed
 // using destroyInMessage.
 func (c *Connection) readMessage() (*buffer.InMessage, error) {
+	if c.cfg.coalesceForgets() {
+		if m := c.takeStashedMessage(); m != nil {
+			return m, nil
+		}
+	}
+
 	// Allocate a message.
 	m := c.getInMessage()
 
@@ -410,6 +678,10 @@ func (c *Connection) readMessage() (*buffer.InMessage, error) {
 			return nil, err
 		}
 
+		if c.capture != nil {
+			c.capture.record(WireCaptureIn, m.Bytes())
+		}
+
 		return m, nil
 	}
 }
@@ -428,6 +700,15 @@ func (c *Connection) writeOutMessage(outMsg *buffer.OutMessage) error {
 	} else {
 		err = c.writeMessage(outMsg.OutHeaderBytes())
 	}
+
+	if err == nil && c.capture != nil {
+		if outMsg.Sglist != nil {
+			c.capture.record(WireCaptureOut, outMsg.Sglist...)
+		} else {
+			c.capture.record(WireCaptureOut, outMsg.OutHeaderBytes())
+		}
+	}
+
 	return err
 }
 
@@ -460,6 +741,10 @@ func (c *Connection) writeMessage(msg []byte) error {
 func (c *Connection) ReadOp() (_ context.Context, op interface{}, _ error) {
 	// Keep going until we find a request we know how to convert.
 	for {
+		if c.detached.Load() {
+			return nil, nil, io.EOF
+		}
+
 		// Read the next message from the kernel.
 		inMsg, err := c.readMessage()
 		if err != nil {
@@ -479,25 +764,81 @@ func (c *Connection) ReadOp() (_ context.Context, op interface{}, _ error) {
 			c.debugLog(inMsg.Header().Unique, 1, "<- %s", describeRequest(op))
 		}
 
+		// Merge any forgets that follow this one.
+		if c.cfg.coalesceForgets() {
+			switch op.(type) {
+			case *fuseops.ForgetInodeOp, *fuseops.BatchForgetOp:
+				op = c.coalesceForgets(op)
+			}
+		}
+
 		// Special case: handle interrupt requests inline.
 		if interruptOp, ok := op.(*interruptOp); ok {
-			c.handleInterrupt(interruptOp.FuseID)
+			pending := c.handleInterrupt(interruptOp.FuseID)
+			c.logInterrupt(inMsg, interruptOp, pending)
+			continue
+		}
+
+		// Likewise the kernel's answers to retrieve notifications, to which it
+		// expects no reply.
+		if notifyReplyOp, ok := op.(*notifyReplyOp); ok {
+			c.handleNotifyReply(notifyReplyOp)
+			c.putOutMessage(outMsg)
+			c.putInMessage(inMsg)
 			continue
 		}
 
 		// Set up a context that remembers information about this op.
-		ctx := c.beginOp(inMsg.Header().Opcode, inMsg.Header().Unique)
+		ctx := c.beginOp(inMsg.Header().Opcode, inMsg.Header().Unique, op)
 		var wlog *WireLogRecord
-		if c.wireLogger != nil {
-			wlog = NewWireLogRecord()
+		if c.getWireLogger() != nil || c.cfg.WireLogHandler != nil || c.cfg.OpTracer != nil {
+			wlog = getWireLogRecord()
+			if c.cfg.WireLogTraceParent != nil {
+				wlog.TraceParent = c.cfg.WireLogTraceParent(fuseops.OpContext{
+					FuseID: inMsg.Header().Unique,
+					Pid:    inMsg.Header().Pid,
+					Uid:    inMsg.Header().Uid,
+					Gid:    inMsg.Header().Gid,
+				})
+			}
+		}
+		var start time.Time
+		if c.cfg.MetricsSink != nil {
+			start = time.Now()
+			c.cfg.MetricsSink.OpStarted(opTypeName(op))
+		}
+		var timer *opTimer
+		if d := c.cfg.opTimeout(op); d > 0 {
+			timer = c.startOpTimer(inMsg.Header().Opcode, inMsg.Header().Unique, op, d)
+		}
+		ctx = context.WithValue(ctx, contextKey, opState{inMsg, outMsg, op, wlog, start, timer})
+
+		c.mu.Lock()
+		c.inFlight++
+		c.mu.Unlock()
+
+		if c.cfg.OpTracer != nil {
+			ctx = c.cfg.OpTracer.StartOp(ctx, op)
+		}
+
+		// Answer ops that the server has turned out not to implement, if so
+		// configured, rather than returning them to it again.
+		if reply, ok := c.notImplementedReply(op); ok {
+			c.Reply(ctx, reply)
+			continue
 		}
-		ctx = context.WithValue(ctx, contextKey, opState{inMsg, outMsg, op, wlog})
 
 		// Return the op to the user.
 		return ctx, op, nil
 	}
 }
 
+// Concurrency returns the MountConfig.Concurrency setting that the
+// connection was mounted with, for use by its server.
+func (c *Connection) Concurrency() ServerConcurrency {
+	return c.cfg.Concurrency
+}
+
 // Skip errors that happen as a matter of course, since they spook users.
 func (c *Connection) shouldLogError(
 	op interface{},
@@ -521,7 +862,17 @@ func (c *Connection) shouldLogError(
 			return false
 		}
 	case *fuseops.GetXattrOp, *fuseops.ListXattrOp:
-		if err == syscall.ENOSYS || err == syscall.ENODATA || err == syscall.ERANGE {
+		if err == syscall.ENOSYS || err == ENOATTR || err == syscall.ERANGE {
+			return false
+		}
+	case *fuseops.OpenFileOp:
+		// With EnableNoOpenSupport, ENOSYS declines opens rather than failing
+		// them.
+		if err == syscall.ENOSYS && c.flags&InitNoOpenSupport != 0 {
+			return false
+		}
+	case *fuseops.OpenDirOp:
+		if err == syscall.ENOSYS && c.flags&InitNoOpendirSupport != 0 {
 			return false
 		}
 	case *unknownOp:
@@ -565,10 +916,64 @@ func (c *Connection) Reply(ctx context.Context, opErr error) error {
 		// Make sure we destroy the messages when we're done.
 		c.putInMessage(inMsg)
 		c.putOutMessage(outMsg)
+
+		// Report the op as finished even if writing the reply failed, so that
+		// in-flight counts stay balanced.
+		if c.cfg.MetricsSink != nil {
+			c.cfg.MetricsSink.OpFinished(opTypeName(op), opErrno(opErr), time.Since(state.start))
+		}
+
+		if c.cfg.RecycleOps {
+			recycleOp(op)
+		}
+
+		c.mu.Lock()
+		c.inFlight--
+		if c.inFlight == 0 {
+			c.idle.Broadcast()
+		}
+		c.mu.Unlock()
 	}()
 
+	// If the op timed out, the kernel has been replied to, and the state for
+	// the op cleaned up, already. Record the timeout as the op's outcome.
+	if state.timer != nil && state.timer.stop() {
+		opErr = c.cfg.opTimeoutErrno()
+		if state.wlog != nil {
+			c.finishWireLog(ctx, op, opErr, state.wlog)
+			putWireLogRecord(state.wlog)
+		}
+		return nil
+	}
+
 	// Clean up state for this op.
-	c.finishOp(inMsg.Header().Opcode, inMsg.Header().Unique)
+	interrupted := c.finishOp(inMsg.Header().Opcode, inMsg.Header().Unique)
+	if state.wlog != nil {
+		state.wlog.interruptTime = interrupted
+	}
+
+	// Send the reply to a read whose data is to come from a file here, if the
+	// data can be spliced. Otherwise it is read into the op's buffer, with any
+	// error becoming the op's error. Data that is to come from a reader is read
+	// straight into the reply.
+	var sentErr error
+	var sent bool
+	if o, ok := op.(*fuseops.ReadFileOp); ok && opErr == nil {
+		switch {
+		case o.SpliceFile != nil:
+			sent, sentErr = c.replyFromFile(outMsg, fuseID, o)
+			if !sent {
+				opErr = sentErr
+			}
+
+		case o.Reader != nil:
+			opErr = replyFromReader(outMsg, o)
+		}
+	}
+
+	if opErr == ENOSYS {
+		opErr = c.noteNotImplemented(op)
+	}
 
 	logError := c.shouldLogError(op, opErr)
 
@@ -589,7 +994,27 @@ func (c *Connection) Reply(ctx context.Context, opErr error) error {
 	}
 
 	// Send the reply to the kernel, if one is required.
-	noResponse := c.kernelResponse(outMsg, inMsg.Header().Unique, op, opErr)
+	if sent && sentErr != nil {
+		writeErrMsg := fmt.Sprintf("spliceReply: %v %v", sentErr, outMsg.OutHeaderBytes())
+		if c.errorLogger != nil {
+			c.errorLogger.Print(writeErrMsg)
+		}
+		return fmt.Errorf(writeErrMsg)
+	}
+
+	// Update the paths before replying: once the kernel has the reply, it may
+	// forget the entry, and another goroutine may handle the forget before we
+	// get to it. The op's own path is resolved beforehand, for the wire log.
+	if c.paths != nil {
+		if state.wlog != nil {
+			state.wlog.path = c.paths.resolve(op)
+		}
+		if opErr == nil {
+			c.paths.update(op)
+		}
+	}
+
+	noResponse := sent || c.kernelResponse(outMsg, inMsg.Header().Unique, op, opErr)
 
 	if !noResponse {
 		err := c.writeOutMessage(outMsg)
@@ -603,11 +1028,9 @@ func (c *Connection) Reply(ctx context.Context, opErr error) error {
 		outMsg.Sglist = nil
 	}
 
-	if c.wireLogger != nil {
-		entry, err := formatWireLogEntry(op, opErr, state.wlog)
-		if err == nil {
-			c.wireLogger.Write(entry)
-		}
+	if state.wlog != nil {
+		c.finishWireLog(ctx, op, opErr, state.wlog)
+		putWireLogRecord(state.wlog)
 	}
 
 	return nil
@@ -626,6 +1049,23 @@ func (c *Connection) callbackForOp(op interface{}) func() {
 // Close the connection. Must not be called until operations that were read
 // from the connection have been responded to.
 func (c *Connection) close() error {
+	if !c.mountTime.IsZero() {
+		if wlog := c.newEventRecord("Unmount"); wlog != nil {
+			wlog.Args["Uptime"] = time.Since(c.mountTime)
+			if c.detached.Load() {
+				wlog.Args["Detached"] = true
+			}
+			c.writeEventRecord(wlog)
+		}
+	}
+
+	c.mu.Lock()
+	for _, p := range c.splicePipes {
+		p.close()
+	}
+	c.splicePipes = nil
+	c.mu.Unlock()
+
 	// Posix doesn't say that close can be called concurrently with read or
 	// write, but luckily we exclude the possibility of a race by requiring the
 	// user to respond to all ops first.
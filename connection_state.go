@@ -0,0 +1,170 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+// ConnectionState is what another process needs to know to take over serving
+// a connection to the kernel, besides the device itself: what was negotiated
+// when it was mounted. It may be encoded with encoding/json to pass it along.
+// See MountedFileSystem.Detach.
+type ConnectionState struct {
+	// The protocol version spoken by the kernel, and the one in use, which may
+	// be older.
+	KernelMajor uint32
+	KernelMinor uint32
+	Major       uint32
+	Minor       uint32
+
+	// The capabilities negotiated with the kernel.
+	Flags InitFlags
+
+	// The largest request payload that the kernel may send, in bytes.
+	MaxPayload int
+
+	// The time at which the file system was originally mounted.
+	MountTime time.Time
+}
+
+// Detach hands the connection over to another process, for example to
+// upgrade the daemon serving a file system without unmounting it. It returns
+// a duplicate of the connection's device and the state negotiated with the
+// kernel, which the new process passes to Resume. The device can be passed on
+// with exec.Cmd.ExtraFiles or over a unix domain socket, and should then be
+// closed.
+//
+// This process stops reading ops, and Detach waits for it to reply to those
+// already read before returning, so it must not be called by a handler for
+// an op. The current read, however, may be blocked until the kernel sends
+// another op, which this process then serves as usual, so the file system
+// must be prepared for both processes to serve ops for a while. Its server's
+// ServeOps returns, and Join with it, once that read has returned and the op
+// it read, if any, has been replied to. The file system remains mounted once
+// this process exits, as long as the new one holds the device open.
+//
+// Since the file system lives on in the new process, servers don't tear it
+// down once a detached connection stops: see Connection.Detached.
+// Anything the file system keeps in memory, such as inode IDs and handles
+// handed out to the kernel, is its own to hand over.
+func (mfs *MountedFileSystem) Detach() (*os.File, *ConnectionState, error) {
+	return mfs.conn.detach()
+}
+
+// Resume serves a connection detached from another process with
+// MountedFileSystem.Detach, using the supplied device and state, as if it had
+// been mounted on the given directory with Mount. The device is owned by the
+// returned MountedFileSystem.
+//
+// The config should match the one the file system was mounted with. Settings
+// that were negotiated with the kernel at mount time, such as
+// EnableNoOpenSupport, are taken from the state instead, and Configure is not
+// called.
+func Resume(
+	dir string,
+	dev *os.File,
+	state *ConnectionState,
+	server Server,
+	config *MountConfig) (*MountedFileSystem, error) {
+	protocol := fusekernel.Protocol{Major: state.Major, Minor: state.Minor}
+	min := fusekernel.Protocol{
+		Major: fusekernel.ProtoVersionMinMajor,
+		Minor: fusekernel.ProtoVersionMinMinor,
+	}
+	max := fusekernel.Protocol{
+		Major: fusekernel.ProtoVersionMaxMajor,
+		Minor: fusekernel.ProtoVersionMaxMinor,
+	}
+	if protocol.LT(min) || max.LT(protocol) {
+		return nil, fmt.Errorf("unsupported protocol version %v", protocol)
+	}
+
+	ready := make(chan error, 1)
+	ready <- nil
+	return serve(dir, dev, ready, state, server, config)
+}
+
+// Detached reports whether the connection has been handed over to another
+// process with MountedFileSystem.Detach. Once ReadOp returns io.EOF for such
+// a connection, the server should leave the file system as it is rather than
+// destroy it, since the other process serves it.
+func (c *Connection) Detached() bool {
+	return c.detached.Load()
+}
+
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) detach() (*os.File, *ConnectionState, error) {
+	if c.detached.Swap(true) {
+		return nil, nil, errors.New("connection already detached")
+	}
+
+	fd, err := syscall.Dup(int(c.dev.Fd()))
+	if err != nil {
+		c.detached.Store(false)
+		return nil, nil, fmt.Errorf("dup: %w", err)
+	}
+	syscall.CloseOnExec(fd)
+
+	// Wait for the ops already read to be replied to.
+	c.mu.Lock()
+	for c.inFlight > 0 {
+		c.idle.Wait()
+	}
+	maxPayload := c.maxPayload
+	c.mu.Unlock()
+
+	state := &ConnectionState{
+		KernelMajor: c.kernelProtocol.Major,
+		KernelMinor: c.kernelProtocol.Minor,
+		Major:       c.protocol.Major,
+		Minor:       c.protocol.Minor,
+		Flags:       c.flags,
+		MaxPayload:  maxPayload,
+		MountTime:   c.mountTime,
+	}
+
+	return os.NewFile(uintptr(fd), "/dev/fuse"), state, nil
+}
+
+// Take the place of Init for a connection detached from another process.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) restore(state *ConnectionState) {
+	c.kernelProtocol = fusekernel.Protocol{Major: state.KernelMajor, Minor: state.KernelMinor}
+	c.protocol = fusekernel.Protocol{Major: state.Major, Minor: state.Minor}
+	c.flags = state.Flags
+	c.splice = spliceSupported && c.flags&InitSpliceWrite != 0
+	c.spliceMove = c.splice && c.flags&InitSpliceMove != 0
+	c.mountTime = state.MountTime
+
+	c.mu.Lock()
+	c.maxPayload = state.MaxPayload
+	c.mu.Unlock()
+
+	if wlog := c.newEventRecord("Mount"); wlog != nil {
+		wlog.Args["Resumed"] = true
+		wlog.Args["KernelProtocol"] = c.kernelProtocol.String()
+		wlog.Args["Protocol"] = c.protocol.String()
+		wlog.Args["Flags"] = c.flags.String()
+		c.writeEventRecord(wlog)
+	}
+}
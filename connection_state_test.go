@@ -0,0 +1,171 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/samples/memfs"
+)
+
+// A file system whose first StatFS waits for release to be closed, and that
+// counts the calls to Destroy.
+type detachFS struct {
+	fuseutil.NotImplementedFileSystem
+	once      sync.Once
+	entered   chan struct{}
+	release   chan struct{}
+	destroyed atomic.Int32
+}
+
+func (fs *detachFS) StatFS(ctx context.Context, op *fuseops.StatFSOp) error {
+	fs.once.Do(func() { close(fs.entered) })
+	<-fs.release
+	return nil
+}
+
+func (fs *detachFS) Destroy() {
+	fs.destroyed.Add(1)
+}
+
+func TestDetachDrainsOps(t *testing.T) {
+	fs := &detachFS{entered: make(chan struct{}), release: make(chan struct{})}
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	statFS := make(chan error, 1)
+	go func() {
+		statFS <- k.Do(ctx, &fuseops.StatFSOp{})
+	}()
+	<-fs.entered
+
+	// Detach waits for the op in flight to be replied to.
+	old := k.MountedFileSystem()
+	detached := make(chan error, 1)
+	go func() {
+		dev, _, err := old.Detach()
+		if err == nil {
+			dev.Close()
+		}
+		detached <- err
+	}()
+
+	select {
+	case err := <-detached:
+		close(fs.release)
+		t.Fatalf("Detach returned with an op in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(fs.release)
+	if err := <-detached; err != nil {
+		t.Fatalf("Detach: %v", err)
+	}
+	if err := <-statFS; err != nil {
+		t.Fatalf("StatFS: %v", err)
+	}
+
+	// The server stops once its current read returns, without destroying the
+	// file system, which the new process serves.
+	k.Do(ctx, &fuseops.StatFSOp{})
+	if err := old.Join(ctx); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if got := fs.destroyed.Load(); got != 0 {
+		t.Errorf("expected no calls to Destroy, got %d", got)
+	}
+}
+
+func TestDetachResume(t *testing.T) {
+	k, err := fakekernel.Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{EnableNoOpenSupport: true})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	old := k.MountedFileSystem()
+	dev, state, err := old.Detach()
+	if err != nil {
+		t.Fatalf("Detach: %v", err)
+	}
+	if _, _, err := old.Detach(); err == nil {
+		t.Errorf("Detach: expected an error the second time")
+	}
+
+	// The state must survive being passed to another process.
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var decoded fuse.ConnectionState
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if decoded.Flags&fuse.InitNoOpenSupport == 0 {
+		t.Errorf("Flags = %v, expected NoOpenSupport", decoded.Flags)
+	}
+
+	mfs, err := fuse.Resume(old.Dir(), dev, &decoded, memfs.NewMemFS(0, 0), &fuse.MountConfig{})
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+
+	// Until the old server notices that it has been detached, either server
+	// may serve ops. Either way they must succeed.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for {
+		if err := k.Do(ctx, &fuseops.StatFSOp{}); err != nil {
+			t.Fatalf("StatFS: %v", err)
+		}
+
+		joinCtx, joinCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		err := old.Join(joinCtx)
+		joinCancel()
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("Join: %v", err)
+		}
+	}
+
+	// Only the new server is left to serve this.
+	mkDir := &fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "dir", Mode: os.ModeDir | 0755}
+	if err := k.Do(ctx, mkDir); err != nil {
+		t.Fatalf("MkDir: %v", err)
+	}
+
+	k.Close()
+	if err := mfs.Join(ctx); err != nil {
+		t.Errorf("Join: %v", err)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"reflect"
 	"syscall"
@@ -27,6 +28,7 @@ import (
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/internal/buffer"
 	"github.com/jacobsa/fuse/internal/fusekernel"
+	"golang.org/x/sys/unix"
 )
 
 ////////////////////////////////////////////////////////////////////////
@@ -50,25 +52,64 @@ func convertInMessage(
 			return nil, errors.New("Corrupt OpLookup")
 		}
 
-		o = &fuseops.LookUpInodeOp{
+		o = lookUpInodeOps.get(fuseops.LookUpInodeOp{
 			Parent: fuseops.InodeID(inMsg.Header().Nodeid),
 			Name:   string(buf[:n-1]),
 			OpContext: fuseops.OpContext{
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
-		}
+		})
 
 	case fusekernel.OpGetattr:
-		o = &fuseops.GetInodeAttributesOp{
+		type input fusekernel.GetattrIn
+		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
+		if in == nil {
+			return nil, errors.New("Corrupt OpGetattr")
+		}
+
+		to := getInodeAttributesOps.get(fuseops.GetInodeAttributesOp{
+			Inode: fuseops.InodeID(inMsg.Header().Nodeid),
+			OpContext: fuseops.OpContext{
+				FuseID: inMsg.Header().Unique,
+				Pid:    inMsg.Header().Pid,
+				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
+			},
+		})
+		o = to
+
+		if fusekernel.GetattrFlags(in.GetattrFlags)&fusekernel.GetattrFh != 0 {
+			t := fuseops.HandleID(in.Fh)
+			to.Handle = &t
+		}
+
+	case fusekernel.OpStatx:
+		type input fusekernel.StatxIn
+		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
+		if in == nil {
+			return nil, errors.New("Corrupt OpStatx")
+		}
+
+		to := &fuseops.StatxOp{
 			Inode: fuseops.InodeID(inMsg.Header().Nodeid),
+			Mask:  in.SxMask,
+			Flags: in.SxFlags,
 			OpContext: fuseops.OpContext{
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
+		o = to
+
+		if fusekernel.GetattrFlags(in.GetattrFlags)&fusekernel.GetattrFh != 0 {
+			t := fuseops.HandleID(in.Fh)
+			to.Handle = &t
+		}
 
 	case fusekernel.OpSetattr:
 		type input fusekernel.SetattrIn
@@ -83,6 +124,7 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
 		o = to
@@ -120,6 +162,8 @@ func convertInMessage(
 			to.Handle = &t
 		}
 
+		to.KillSuidGid = valid&fusekernel.SetattrKillSuidgid != 0
+
 	case fusekernel.OpForget:
 		type input fusekernel.ForgetIn
 		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
@@ -127,15 +171,16 @@ func convertInMessage(
 			return nil, errors.New("Corrupt OpForget")
 		}
 
-		o = &fuseops.ForgetInodeOp{
+		o = forgetInodeOps.get(fuseops.ForgetInodeOp{
 			Inode: fuseops.InodeID(inMsg.Header().Nodeid),
 			N:     in.Nlookup,
 			OpContext: fuseops.OpContext{
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
-		}
+		})
 
 	case fusekernel.OpBatchForget:
 		type input fusekernel.BatchForgetCountIn
@@ -164,6 +209,7 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
 
@@ -180,7 +226,7 @@ func convertInMessage(
 		}
 		name = name[:i]
 
-		o = &fuseops.MkDirOp{
+		to := &fuseops.MkDirOp{
 			Parent: fuseops.InodeID(inMsg.Header().Nodeid),
 			Name:   string(name),
 
@@ -195,8 +241,16 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
+		if protocol.HasUmask() {
+			to.Umask = os.FileMode(in.Umask) & os.ModePerm
+		}
+		if to.SecurityContexts, err = parseSecurityContexts(inMsg.Extensions()); err != nil {
+			return nil, fmt.Errorf("Corrupt OpMkdir: %w", err)
+		}
+		o = to
 
 	case fusekernel.OpMknod:
 		in := (*fusekernel.MknodIn)(inMsg.Consume(fusekernel.MknodInSize(protocol)))
@@ -211,7 +265,7 @@ func convertInMessage(
 		}
 		name = name[:i]
 
-		o = &fuseops.MkNodeOp{
+		to := &fuseops.MkNodeOp{
 			Parent: fuseops.InodeID(inMsg.Header().Nodeid),
 			Name:   string(name),
 			Mode:   ConvertFileMode(in.Mode),
@@ -220,8 +274,16 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
+		if protocol.HasUmask() {
+			to.Umask = os.FileMode(in.Umask) & os.ModePerm
+		}
+		if to.SecurityContexts, err = parseSecurityContexts(inMsg.Extensions()); err != nil {
+			return nil, fmt.Errorf("Corrupt OpMknod: %w", err)
+		}
+		o = to
 
 	case fusekernel.OpCreate:
 		in := (*fusekernel.CreateIn)(inMsg.Consume(fusekernel.CreateInSize(protocol)))
@@ -236,7 +298,7 @@ func convertInMessage(
 		}
 		name = name[:i]
 
-		o = &fuseops.CreateFileOp{
+		to := &fuseops.CreateFileOp{
 			Parent: fuseops.InodeID(inMsg.Header().Nodeid),
 			Name:   string(name),
 			Mode:   ConvertFileMode(in.Mode),
@@ -244,9 +306,41 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 			OpenFlags: fusekernel.OpenFlags(in.Flags),
 		}
+		if protocol.HasUmask() {
+			to.Umask = os.FileMode(in.Umask) & os.ModePerm
+		}
+		if to.SecurityContexts, err = parseSecurityContexts(inMsg.Extensions()); err != nil {
+			return nil, fmt.Errorf("Corrupt OpCreate: %w", err)
+		}
+		o = to
+
+	case fusekernel.OpTmpfile:
+		// The name that follows is a placeholder, so ignore it.
+		in := (*fusekernel.CreateIn)(inMsg.Consume(fusekernel.CreateInSize(protocol)))
+		if in == nil {
+			return nil, errors.New("Corrupt OpTmpfile")
+		}
+
+		to := &fuseops.CreateTmpFileOp{
+			Parent: fuseops.InodeID(inMsg.Header().Nodeid),
+			Mode:   ConvertFileMode(in.Mode),
+			Umask:  os.FileMode(in.Umask) & os.ModePerm,
+			OpContext: fuseops.OpContext{
+				FuseID: inMsg.Header().Unique,
+				Pid:    inMsg.Header().Pid,
+				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
+			},
+			OpenFlags: fusekernel.OpenFlags(in.Flags),
+		}
+		if to.SecurityContexts, err = parseSecurityContexts(inMsg.Extensions()); err != nil {
+			return nil, fmt.Errorf("Corrupt OpTmpfile: %w", err)
+		}
+		o = to
 
 	case fusekernel.OpSymlink:
 		// The message is "newName\0target\0".
@@ -260,7 +354,7 @@ func convertInMessage(
 		}
 		newName, target := names[0:i], names[i+1:len(names)-1]
 
-		o = &fuseops.CreateSymlinkOp{
+		to := &fuseops.CreateSymlinkOp{
 			Parent: fuseops.InodeID(inMsg.Header().Nodeid),
 			Name:   string(newName),
 			Target: string(target),
@@ -268,8 +362,13 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
+		if to.SecurityContexts, err = parseSecurityContexts(inMsg.Extensions()); err != nil {
+			return nil, fmt.Errorf("Corrupt OpSymlink: %w", err)
+		}
+		o = to
 
 	case fusekernel.OpRename:
 		type input fusekernel.RenameIn
@@ -292,28 +391,57 @@ func convertInMessage(
 			names[4] == 0 && names[5] == 0 && names[6] == 0 && names[7] == 0 {
 			names = names[8:]
 		}
-		// names should be "old\x00new\x00"
-		if len(names) < 4 {
+		oldName, newName, ok := parseRenameNames(names)
+		if !ok {
 			return nil, errors.New("Corrupt OpRename")
 		}
-		if names[len(names)-1] != '\x00' {
-			return nil, errors.New("Corrupt OpRename")
+
+		o = &fuseops.RenameOp{
+			OldParent: fuseops.InodeID(inMsg.Header().Nodeid),
+			OldName:   string(oldName),
+			NewParent: fuseops.InodeID(in.Newdir),
+			NewName:   string(newName),
+			OpContext: fuseops.OpContext{
+				FuseID: inMsg.Header().Unique,
+				Pid:    inMsg.Header().Pid,
+				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
+			},
 		}
-		i := bytes.IndexByte(names, '\x00')
-		if i < 0 {
-			return nil, errors.New("Corrupt OpRename")
+
+	case fusekernel.OpRename2:
+		type input fusekernel.Rename2In
+		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
+		if in == nil {
+			return nil, errors.New("Corrupt OpRename2")
+		}
+
+		// The kernel only sends this for renames with flags. Replying ENOSYS
+		// makes it fail them with EINVAL from then on.
+		if !config.EnableRenameFlags {
+			o = &unknownOp{
+				OpCode: inMsg.Header().Opcode,
+				Inode:  fuseops.InodeID(inMsg.Header().Nodeid),
+			}
+			break
+		}
+
+		oldName, newName, ok := parseRenameNames(inMsg.ConsumeBytes(inMsg.Len()))
+		if !ok {
+			return nil, errors.New("Corrupt OpRename2")
 		}
-		oldName, newName := names[:i], names[i+1:len(names)-1]
 
 		o = &fuseops.RenameOp{
 			OldParent: fuseops.InodeID(inMsg.Header().Nodeid),
 			OldName:   string(oldName),
 			NewParent: fuseops.InodeID(in.Newdir),
 			NewName:   string(newName),
+			Flags:     fuseops.RenameFlags(in.Flags),
 			OpContext: fuseops.OpContext{
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
 
@@ -331,6 +459,7 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
 
@@ -348,6 +477,7 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
 
@@ -358,25 +488,28 @@ func convertInMessage(
 			return nil, errors.New("Corrupt OpOpen")
 		}
 
-		o = &fuseops.OpenFileOp{
-			Inode:     fuseops.InodeID(inMsg.Header().Nodeid),
-			OpenFlags: fusekernel.OpenFlags(in.Flags),
+		o = openFileOps.get(fuseops.OpenFileOp{
+			Inode:       fuseops.InodeID(inMsg.Header().Nodeid),
+			OpenFlags:   fusekernel.OpenFlags(in.Flags),
+			KillSuidGid: in.OpenFlags&fusekernel.OpenInKillSuidgid != 0,
 			OpContext: fuseops.OpContext{
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
-		}
+		})
 
 	case fusekernel.OpOpendir:
-		o = &fuseops.OpenDirOp{
+		o = openDirOps.get(fuseops.OpenDirOp{
 			Inode: fuseops.InodeID(inMsg.Header().Nodeid),
 			OpContext: fuseops.OpContext{
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
-		}
+		})
 
 	case fusekernel.OpRead:
 		in := (*fusekernel.ReadIn)(inMsg.Consume(fusekernel.ReadInSize(protocol)))
@@ -384,7 +517,7 @@ func convertInMessage(
 			return nil, errors.New("Corrupt OpRead")
 		}
 
-		to := &fuseops.ReadFileOp{
+		to := readFileOps.get(fuseops.ReadFileOp{
 			Inode:  fuseops.InodeID(inMsg.Header().Nodeid),
 			Handle: fuseops.HandleID(in.Fh),
 			Offset: int64(in.Offset),
@@ -393,8 +526,9 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
-		}
+		})
 		// Use part of the incoming message storage as the read buffer.
 		to.Dst = inMsg.GetFree(int(in.Size))
 		o = to
@@ -405,7 +539,7 @@ func convertInMessage(
 			return nil, errors.New("Corrupt OpReaddir")
 		}
 
-		to := &fuseops.ReadDirOp{
+		to := readDirOps.get(fuseops.ReadDirOp{
 			Inode:  fuseops.InodeID(inMsg.Header().Nodeid),
 			Handle: fuseops.HandleID(in.Fh),
 			Offset: fuseops.DirOffset(in.Offset),
@@ -413,8 +547,9 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
-		}
+		})
 		o = to
 
 		readSize := int(in.Size)
@@ -443,6 +578,7 @@ func convertInMessage(
 					FuseID: inMsg.Header().Unique,
 					Pid:    inMsg.Header().Pid,
 					Uid:    inMsg.Header().Uid,
+					Gid:    inMsg.Header().Gid,
 				},
 			},
 		}
@@ -467,14 +603,17 @@ func convertInMessage(
 			return nil, errors.New("Corrupt OpRelease")
 		}
 
-		o = &fuseops.ReleaseFileHandleOp{
-			Handle: fuseops.HandleID(in.Fh),
+		o = releaseFileHandleOps.get(fuseops.ReleaseFileHandleOp{
+			Handle:      fuseops.HandleID(in.Fh),
+			FlockUnlock: fusekernel.ReleaseFlags(in.ReleaseFlags)&fusekernel.ReleaseFlockUnlock != 0,
+			LockOwner:   in.LockOwner,
 			OpContext: fuseops.OpContext{
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
-		}
+		})
 
 	case fusekernel.OpReleasedir:
 		type input fusekernel.ReleaseIn
@@ -483,14 +622,15 @@ func convertInMessage(
 			return nil, errors.New("Corrupt OpReleasedir")
 		}
 
-		o = &fuseops.ReleaseDirHandleOp{
+		o = releaseDirHandleOps.get(fuseops.ReleaseDirHandleOp{
 			Handle: fuseops.HandleID(in.Fh),
 			OpContext: fuseops.OpContext{
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
-		}
+		})
 
 	case fusekernel.OpWrite:
 		in := (*fusekernel.WriteIn)(inMsg.Consume(fusekernel.WriteInSize(protocol)))
@@ -503,17 +643,21 @@ func convertInMessage(
 			return nil, errors.New("Corrupt OpWrite")
 		}
 
-		o = &fuseops.WriteFileOp{
-			Inode:  fuseops.InodeID(inMsg.Header().Nodeid),
-			Handle: fuseops.HandleID(in.Fh),
-			Data:   buf,
-			Offset: int64(in.Offset),
+		o = writeFileOps.get(fuseops.WriteFileOp{
+			Inode:       fuseops.InodeID(inMsg.Header().Nodeid),
+			Handle:      fuseops.HandleID(in.Fh),
+			Data:        buf,
+			Offset:      int64(in.Offset),
+			KillSuidGid: fusekernel.WriteFlags(in.WriteFlags)&fusekernel.WriteKillSuidgid != 0,
+			Flags:       fuseops.WriteFlags(in.WriteFlags) & (fuseops.WriteCache | fuseops.WriteKillSuidGid),
+			OpenFlags:   fusekernel.OpenFlags(in.Flags),
 			OpContext: fuseops.OpContext{
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
-		}
+		})
 
 	case fusekernel.OpFsync, fusekernel.OpFsyncdir:
 		type input fusekernel.FsyncIn
@@ -529,6 +673,7 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
 
@@ -544,6 +689,11 @@ func convertInMessage(
 			OpContext: fuseops.OpContext{Pid: inMsg.Header().Pid},
 		}
 
+	case fusekernel.OpDestroy:
+		o = &fuseops.DestroyOp{
+			OpContext: fuseops.OpContext{FuseID: inMsg.Header().Unique},
+		}
+
 	case fusekernel.OpFlush:
 		type input fusekernel.FlushIn
 		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
@@ -551,15 +701,17 @@ func convertInMessage(
 			return nil, errors.New("Corrupt OpFlush")
 		}
 
-		o = &fuseops.FlushFileOp{
-			Inode:  fuseops.InodeID(inMsg.Header().Nodeid),
-			Handle: fuseops.HandleID(in.Fh),
+		o = flushFileOps.get(fuseops.FlushFileOp{
+			Inode:     fuseops.InodeID(inMsg.Header().Nodeid),
+			Handle:    fuseops.HandleID(in.Fh),
+			LockOwner: in.LockOwner,
 			OpContext: fuseops.OpContext{
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
-		}
+		})
 
 	case fusekernel.OpReadlink:
 		o = &fuseops.ReadSymlinkOp{
@@ -568,6 +720,7 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
 
@@ -585,6 +738,24 @@ func convertInMessage(
 			FuseID: in.Unique,
 		}
 
+	case fusekernel.OpNotifyReply:
+		type input fusekernel.NotifyRetrieveIn
+		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
+		if in == nil {
+			return nil, errors.New("Corrupt OpNotifyReply")
+		}
+
+		data := inMsg.ConsumeBytes(uintptr(in.Size))
+		if data == nil && in.Size != 0 {
+			return nil, errors.New("Corrupt OpNotifyReply")
+		}
+
+		o = &notifyReplyOp{
+			NotifyUnique: inMsg.Header().Unique,
+			Offset:       in.Offset,
+			Data:         data,
+		}
+
 	case fusekernel.OpInit:
 		type input fusekernel.InitIn
 		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
@@ -592,12 +763,21 @@ func convertInMessage(
 			return nil, errors.New("Corrupt OpInit")
 		}
 
-		o = &initOp{
+		init := &initOp{
 			Kernel:       fusekernel.Protocol{in.Major, in.Minor},
 			MaxReadahead: in.MaxReadahead,
 			Flags:        fusekernel.InitFlags(in.Flags),
 		}
 
+		// Newer kernels follow the flags with more of them.
+		if init.Flags&fusekernel.InitExt != 0 {
+			if flags2 := (*uint32)(inMsg.Consume(4)); flags2 != nil {
+				init.Flags2 = fusekernel.InitFlags2(*flags2)
+			}
+		}
+
+		o = init
+
 	case fusekernel.OpLink:
 		type input fusekernel.LinkIn
 		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
@@ -623,6 +803,7 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
 
@@ -640,6 +821,7 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
 
@@ -664,6 +846,7 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
 		o = to
@@ -696,6 +879,7 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
 		o = to
@@ -739,6 +923,7 @@ func convertInMessage(
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
 	case fusekernel.OpFallocate:
@@ -753,11 +938,137 @@ func convertInMessage(
 			Handle: fuseops.HandleID(in.Fh),
 			Offset: in.Offset,
 			Length: in.Length,
-			Mode:   in.Mode,
+			Mode:   fuseops.FallocateMode(in.Mode),
+			OpContext: fuseops.OpContext{
+				FuseID: inMsg.Header().Unique,
+				Pid:    inMsg.Header().Pid,
+				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
+			},
+		}
+
+	case fusekernel.OpCopyFileRange:
+		type input fusekernel.CopyFileRangeIn
+		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
+		if in == nil {
+			return nil, errors.New("Corrupt OpCopyFileRange")
+		}
+
+		o = &fuseops.CopyFileRangeOp{
+			SrcInode:  fuseops.InodeID(inMsg.Header().Nodeid),
+			SrcHandle: fuseops.HandleID(in.FhIn),
+			SrcOffset: in.OffIn,
+			DstInode:  fuseops.InodeID(in.NodeidOut),
+			DstHandle: fuseops.HandleID(in.FhOut),
+			DstOffset: in.OffOut,
+			Length:    in.Len,
+			Flags:     in.Flags,
+			OpContext: fuseops.OpContext{
+				FuseID: inMsg.Header().Unique,
+				Pid:    inMsg.Header().Pid,
+				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
+			},
+		}
+
+	case fusekernel.OpSetlk, fusekernel.OpSetlkw:
+		type input fusekernel.LkIn
+		in := (*input)(inMsg.Consume(fusekernel.LkInSize(protocol)))
+		if in == nil {
+			return nil, errors.New("Corrupt OpSetlk")
+		}
+
+		// We don't ask for POSIX locks, so only flock(2) requests are expected.
+		if in.LkFlags&fusekernel.LkFlock == 0 {
+			o = &unknownOp{
+				OpCode: inMsg.Header().Opcode,
+				Inode:  fuseops.InodeID(inMsg.Header().Nodeid),
+			}
+			break
+		}
+
+		var operation int
+		switch in.Lk.Type {
+		case fusekernel.LockRead:
+			operation = unix.LOCK_SH
+		case fusekernel.LockWrite:
+			operation = unix.LOCK_EX
+		case fusekernel.LockUnlock:
+			operation = unix.LOCK_UN
+		default:
+			return nil, fmt.Errorf("Unknown lock type %d in OpSetlk", in.Lk.Type)
+		}
+
+		o = &fuseops.FlockOp{
+			Inode:     fuseops.InodeID(inMsg.Header().Nodeid),
+			Handle:    fuseops.HandleID(in.Fh),
+			Owner:     in.Owner,
+			Operation: operation,
+			Block:     inMsg.Header().Opcode == fusekernel.OpSetlkw,
+			OpContext: fuseops.OpContext{
+				FuseID: inMsg.Header().Unique,
+				Pid:    inMsg.Header().Pid,
+				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
+			},
+		}
+
+	case fusekernel.OpPoll:
+		type input fusekernel.PollIn
+		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
+		if in == nil {
+			return nil, errors.New("Corrupt OpPoll")
+		}
+
+		o = &fuseops.PollOp{
+			Inode:          fuseops.InodeID(inMsg.Header().Nodeid),
+			Handle:         fuseops.HandleID(in.Fh),
+			PollHandle:     in.Kh,
+			ScheduleNotify: in.Flags&fusekernel.PollScheduleNotify != 0,
+			Events:         in.Events,
 			OpContext: fuseops.OpContext{
 				FuseID: inMsg.Header().Unique,
 				Pid:    inMsg.Header().Pid,
 				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
+			},
+		}
+
+	case fusekernel.OpLseek:
+		type input fusekernel.LseekIn
+		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
+		if in == nil {
+			return nil, errors.New("Corrupt OpLseek")
+		}
+
+		o = &fuseops.SeekFileOp{
+			Inode:  fuseops.InodeID(inMsg.Header().Nodeid),
+			Handle: fuseops.HandleID(in.Fh),
+			Offset: int64(in.Offset),
+			Whence: int(in.Whence),
+			OpContext: fuseops.OpContext{
+				FuseID: inMsg.Header().Unique,
+				Pid:    inMsg.Header().Pid,
+				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
+			},
+		}
+
+	case fusekernel.OpAccess:
+		type input fusekernel.AccessIn
+		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
+		if in == nil {
+			return nil, errors.New("Corrupt OpAccess")
+		}
+
+		o = &fuseops.AccessOp{
+			Inode: fuseops.InodeID(inMsg.Header().Nodeid),
+			Mask:  in.Mask,
+			OpContext: fuseops.OpContext{
+				FuseID: inMsg.Header().Unique,
+				Pid:    inMsg.Header().Pid,
+				Uid:    inMsg.Header().Uid,
+				Gid:    inMsg.Header().Gid,
 			},
 		}
 
@@ -771,6 +1082,74 @@ func convertInMessage(
 	return o, nil
 }
 
+// Split the names that follow the input struct of a rename request, which
+// should be "old\x00new\x00".
+func parseRenameNames(names []byte) (oldName, newName []byte, ok bool) {
+	if len(names) < 4 {
+		return nil, nil, false
+	}
+	if names[len(names)-1] != '\x00' {
+		return nil, nil, false
+	}
+	i := bytes.IndexByte(names, '\x00')
+	if i < 0 {
+		return nil, nil, false
+	}
+
+	return names[:i], names[i+1 : len(names)-1], true
+}
+
+// Find the security contexts among the extensions that followed a request.
+func parseSecurityContexts(ext []byte) ([]fuseops.SecurityContext, error) {
+	var ctxs []fuseops.SecurityContext
+	for len(ext) > 0 {
+		if len(ext) < int(unsafe.Sizeof(fusekernel.ExtHeader{})) {
+			return nil, errors.New("truncated extension header")
+		}
+
+		h := (*fusekernel.ExtHeader)(unsafe.Pointer(&ext[0]))
+		if h.Size < uint32(unsafe.Sizeof(*h)) || int(h.Size) > len(ext) {
+			return nil, fmt.Errorf("bad extension size %d", h.Size)
+		}
+
+		payload := ext[unsafe.Sizeof(*h):h.Size]
+		ext = ext[h.Size:]
+		if h.Type != fusekernel.ExtSecctx {
+			continue
+		}
+
+		if len(payload) < int(unsafe.Sizeof(fusekernel.SecctxHeader{})) {
+			return nil, errors.New("truncated security context header")
+		}
+
+		sh := (*fusekernel.SecctxHeader)(unsafe.Pointer(&payload[0]))
+		recs := payload[unsafe.Sizeof(*sh):]
+		for i := uint32(0); i < sh.NrSecctx; i++ {
+			if len(recs) < int(unsafe.Sizeof(fusekernel.Secctx{})) {
+				return nil, errors.New("truncated security context")
+			}
+
+			sc := (*fusekernel.Secctx)(unsafe.Pointer(&recs[0]))
+			rec := recs[unsafe.Sizeof(*sc):]
+			n := bytes.IndexByte(rec, '\x00')
+			if n < 0 || len(rec)-n-1 < int(sc.Size) {
+				return nil, errors.New("truncated security context")
+			}
+
+			ctxs = append(ctxs, fuseops.SecurityContext{
+				Name:  string(rec[:n]),
+				Value: bytes.Clone(rec[n+1 : n+1+int(sc.Size)]),
+			})
+
+			// Records are padded to a multiple of 8 bytes.
+			recLen := int(unsafe.Sizeof(*sc)) + n + 1 + int(sc.Size)
+			recs = recs[min((recLen+7)&^7, len(recs)):]
+		}
+	}
+
+	return ctxs, nil
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Outgoing messages
 ////////////////////////////////////////////////////////////////////////
@@ -804,10 +1183,7 @@ func (c *Connection) kernelResponse(
 		handled := false
 
 		if !handled {
-			m.OutHeader().Error = -int32(syscall.EIO)
-			if errno, ok := opErr.(syscall.Errno); ok {
-				m.OutHeader().Error = -int32(errno)
-			}
+			m.OutHeader().Error = -int32(opErrno(opErr))
 
 			// Special case: for some types, convertInMessage grew the message in order
 			// to obtain a destination buffer. Make sure that we shrink back to just
@@ -846,6 +1222,12 @@ func (c *Connection) kernelResponseForOp(
 			o.AttributesExpiration)
 		convertAttributes(o.Inode, &o.Attributes, &out.Attr)
 
+	case *fuseops.StatxOp:
+		out := (*fusekernel.StatxOut)(m.Grow(int(unsafe.Sizeof(fusekernel.StatxOut{}))))
+		out.AttrValid, out.AttrValidNsec = ConvertExpirationTime(
+			o.AttributesExpiration)
+		convertStatx(o, &out.Stat)
+
 	case *fuseops.SetInodeAttributesOp:
 		size := int(fusekernel.AttrOutSize(c.protocol))
 		out := (*fusekernel.AttrOut)(m.Grow(size))
@@ -871,6 +1253,22 @@ func (c *Connection) kernelResponseForOp(
 
 		oo := (*fusekernel.OpenOut)(m.Grow(int(unsafe.Sizeof(fusekernel.OpenOut{}))))
 		oo.Fh = uint64(o.Handle)
+		oo.OpenFlags = convertOpenResponseFlags(o.ResponseFlags)
+
+		if o.BackingID != 0 {
+			oo.OpenFlags |= uint32(fusekernel.OpenPassthrough)
+			oo.BackingID = int32(o.BackingID)
+		}
+
+	case *fuseops.CreateTmpFileOp:
+		eSize := int(fusekernel.EntryOutSize(c.protocol))
+
+		e := (*fusekernel.EntryOut)(m.Grow(eSize))
+		convertChildInodeEntry(&o.Entry, e)
+
+		oo := (*fusekernel.OpenOut)(m.Grow(int(unsafe.Sizeof(fusekernel.OpenOut{}))))
+		oo.Fh = uint64(o.Handle)
+		oo.OpenFlags = convertOpenResponseFlags(o.ResponseFlags)
 
 	case *fuseops.CreateSymlinkOp:
 		size := int(fusekernel.EntryOutSize(c.protocol))
@@ -894,6 +1292,7 @@ func (c *Connection) kernelResponseForOp(
 	case *fuseops.OpenDirOp:
 		out := (*fusekernel.OpenOut)(m.Grow(int(unsafe.Sizeof(fusekernel.OpenOut{}))))
 		out.Fh = uint64(o.Handle)
+		out.OpenFlags = convertOpenResponseFlags(o.ResponseFlags)
 
 		if o.CacheDir {
 			out.OpenFlags |= uint32(fusekernel.OpenCacheDir)
@@ -921,6 +1320,7 @@ func (c *Connection) kernelResponseForOp(
 	case *fuseops.OpenFileOp:
 		out := (*fusekernel.OpenOut)(m.Grow(int(unsafe.Sizeof(fusekernel.OpenOut{}))))
 		out.Fh = uint64(o.Handle)
+		out.OpenFlags = convertOpenResponseFlags(o.ResponseFlags)
 
 		if o.KeepPageCache {
 			out.OpenFlags |= uint32(fusekernel.OpenKeepCache)
@@ -930,8 +1330,15 @@ func (c *Connection) kernelResponseForOp(
 			out.OpenFlags |= uint32(fusekernel.OpenDirectIO)
 		}
 
+		if o.BackingID != 0 {
+			out.OpenFlags |= uint32(fusekernel.OpenPassthrough)
+			out.BackingID = int32(o.BackingID)
+		}
+
 	case *fuseops.ReadFileOp:
-		if o.Data != nil {
+		if o.Reader != nil {
+			// replyFromReader has already put the data in the message.
+		} else if o.Data != nil {
 			m.Append(o.Data...)
 		} else {
 			m.Append(o.Dst)
@@ -961,7 +1368,10 @@ func (c *Connection) kernelResponseForOp(
 		out.St.Bavail = o.BlocksAvailable
 		out.St.Files = o.Inodes
 		out.St.Ffree = o.InodesFree
-		out.St.Namelen = 255
+		out.St.Namelen = o.NameMaxLength
+		if out.St.Namelen == 0 {
+			out.St.Namelen = 255
+		}
 
 		// The posix spec for sys/statvfs.h (https://tinyurl.com/2juj6ah6) defines the
 		// following fields of statvfs, among others:
@@ -1017,9 +1427,31 @@ func (c *Connection) kernelResponseForOp(
 	case *fuseops.FallocateOp:
 		// Empty response
 
+	case *fuseops.FlockOp:
+		// Empty response
+
+	case *fuseops.PollOp:
+		out := (*fusekernel.PollOut)(m.Grow(int(unsafe.Sizeof(fusekernel.PollOut{}))))
+		out.Revents = o.Revents
+
+	case *fuseops.AccessOp:
+		// Empty response
+
+	case *fuseops.SeekFileOp:
+		out := (*fusekernel.LseekOut)(m.Grow(int(unsafe.Sizeof(fusekernel.LseekOut{}))))
+		out.Offset = uint64(o.ResultOffset)
+
+	case *fuseops.CopyFileRangeOp:
+		// The kernel's reply is a fuse_write_out, whose size is 32 bits.
+		out := (*fusekernel.WriteOut)(m.Grow(int(unsafe.Sizeof(fusekernel.WriteOut{}))))
+		out.Size = uint32(min(o.BytesCopied, math.MaxUint32))
+
 	case *fuseops.SyncFSOp:
 		// Empty response
 
+	case *fuseops.DestroyOp:
+		// Empty response
+
 	case *initOp:
 		out := (*fusekernel.InitOut)(m.Grow(int(unsafe.Sizeof(fusekernel.InitOut{}))))
 
@@ -1027,12 +1459,13 @@ func (c *Connection) kernelResponseForOp(
 		out.Minor = o.Library.Minor
 		out.MaxReadahead = o.MaxReadahead
 		out.Flags = uint32(o.Flags)
-		// Default values
-		out.MaxBackground = 12
-		out.CongestionThreshold = 9
+		out.MaxBackground = o.MaxBackground
+		out.CongestionThreshold = o.CongestionThreshold
 		out.MaxWrite = o.MaxWrite
 		out.TimeGran = 1
 		out.MaxPages = o.MaxPages
+		out.Flags2 = uint32(o.Flags2)
+		out.MaxStackDepth = o.MaxStackDepth
 
 	default:
 		panic(fmt.Sprintf("Unexpected op: %#v", op))
@@ -1076,6 +1509,37 @@ func convertAttributes(
 	}
 }
 
+func convertStatx(in *fuseops.StatxOp, out *fusekernel.Statx) {
+	var attr fusekernel.Attr
+	convertAttributes(in.Inode, &in.Attributes, &attr)
+
+	out.Mask = fusekernel.StatxBasicStats
+	out.Attributes = in.StatxAttributes
+	out.AttributesMask = in.StatxAttributesMask
+	out.Nlink = attr.Nlink
+	out.Uid = attr.Uid
+	out.Gid = attr.Gid
+	out.Mode = uint16(attr.Mode)
+	out.Ino = attr.Ino
+	out.Size = attr.Size
+	out.Blocks = attr.Blocks
+	out.Atime = convertSxTime(in.Attributes.Atime)
+	out.Mtime = convertSxTime(in.Attributes.Mtime)
+	out.Ctime = convertSxTime(in.Attributes.Ctime)
+	if !in.Attributes.Crtime.IsZero() {
+		out.Mask |= fusekernel.StatxBtime
+		out.Btime = convertSxTime(in.Attributes.Crtime)
+	}
+
+	// The kernel encodes device numbers in fuse_attr with new_encode_dev.
+	out.RdevMajor = (attr.Rdev & 0xfff00) >> 8
+	out.RdevMinor = (attr.Rdev & 0xff) | ((attr.Rdev >> 12) & 0xfff00)
+}
+
+func convertSxTime(t time.Time) fusekernel.SxTime {
+	return fusekernel.SxTime{Sec: t.Unix(), Nsec: uint32(t.Nanosecond())}
+}
+
 // Convert an absolute cache expiration time to a relative time from now for
 // consumption by the fuse kernel module.
 func ConvertExpirationTime(t time.Time) (secs uint64, nsecs uint32) {
@@ -1104,6 +1568,17 @@ func convertChildInodeEntry(
 	convertAttributes(in.Child, &in.Attributes, &out.Attr)
 }
 
+// The fuseops.OpenResponseFlags have the kernel's values. Others, such as
+// OpenPassthrough, are set by the conversions themselves.
+func convertOpenResponseFlags(fl fuseops.OpenResponseFlags) uint32 {
+	const known = fusekernel.OpenDirectIO | fusekernel.OpenKeepCache |
+		fusekernel.OpenNonSeekable | fusekernel.OpenCacheDir |
+		fusekernel.OpenStream | fusekernel.OpenNoFlush |
+		fusekernel.OpenParallelDirectWrites
+
+	return uint32(fusekernel.OpenResponseFlags(fl) & known)
+}
+
 // ConvertFileMode returns an os.FileMode with the Go mode and permission bits
 // set according to the Linux mode and permission bits.
 func ConvertFileMode(unixMode uint32) os.FileMode {
@@ -0,0 +1,69 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/samples/memfs"
+)
+
+func TestCopyFileRange(t *testing.T) {
+	k, err := fakekernel.Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	ctx := context.Background()
+	create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "foo", Mode: 0644}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: []byte("taco")}
+	if err := k.Do(ctx, write); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	// Ask for more than there is, so that the copy is short.
+	cfr := &fuseops.CopyFileRangeOp{
+		SrcInode:  create.Entry.Child,
+		SrcHandle: create.Handle,
+		SrcOffset: 1,
+		DstInode:  create.Entry.Child,
+		DstHandle: create.Handle,
+		DstOffset: 4,
+		Length:    100,
+	}
+	if err := k.Do(ctx, cfr); err != nil {
+		t.Fatalf("CopyFileRange: %v", err)
+	}
+	if cfr.BytesCopied != 3 {
+		t.Errorf("expected 3 bytes copied, got %d", cfr.BytesCopied)
+	}
+
+	read := &fuseops.ReadFileOp{Inode: create.Entry.Child, Handle: create.Handle, Size: 16, Dst: make([]byte, 16)}
+	if err := k.Do(ctx, read); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got := string(read.Dst[:read.BytesRead]); got != "tacoaco" {
+		t.Errorf("unexpected contents %q", got)
+	}
+}
@@ -91,6 +91,9 @@ func describeRequest(op interface{}) (s string) {
 		addComponent("old_name %q", typed.OldName)
 		addComponent("new_parent %v", typed.NewParent)
 		addComponent("new_name %q", typed.NewName)
+		if typed.Flags != 0 {
+			addComponent("flags 0x%x", typed.Flags)
+		}
 
 	case *fuseops.ReadFileOp:
 		addComponent("handle %d", typed.Handle)
@@ -116,8 +119,46 @@ func describeRequest(op interface{}) (s string) {
 		addComponent("length %d", typed.Length)
 		addComponent("mode %d", typed.Mode)
 
+	case *fuseops.FlockOp:
+		addComponent("handle %d", typed.Handle)
+		addComponent("owner 0x%x", typed.Owner)
+		addComponent("operation %d", typed.Operation)
+		if typed.Block {
+			addComponent("blocking")
+		}
+
+	case *fuseops.PollOp:
+		addComponent("handle %d", typed.Handle)
+		addComponent("events 0x%x", typed.Events)
+		if typed.ScheduleNotify {
+			addComponent("notify %d", typed.PollHandle)
+		}
+
+	case *fuseops.AccessOp:
+		addComponent("mask 0%o", typed.Mask)
+
+	case *fuseops.SeekFileOp:
+		addComponent("handle %d", typed.Handle)
+		addComponent("offset %d", typed.Offset)
+		addComponent("whence %d", typed.Whence)
+
+	case *fuseops.CopyFileRangeOp:
+		addComponent("handle %d", typed.SrcHandle)
+		addComponent("offset %d", typed.SrcOffset)
+		addComponent("to inode %v", typed.DstInode)
+		addComponent("handle %d", typed.DstHandle)
+		addComponent("offset %d", typed.DstOffset)
+		addComponent("length %d", typed.Length)
+
+	case *fuseops.FlushFileOp:
+		addComponent("handle %d", typed.Handle)
+		addComponent("owner 0x%x", typed.LockOwner)
+
 	case *fuseops.ReleaseFileHandleOp:
 		addComponent("handle %d", typed.Handle)
+		if typed.FlockUnlock {
+			addComponent("owner 0x%x", typed.LockOwner)
+		}
 	}
 
 	// Use just the name if there is no extra info.
@@ -33,4 +33,6 @@
 // have FUSE for OS X installed (see http://osxfuse.github.io/). Do note that
 // there are several OS X-specific oddities; grep through the documentation for
 // more info.
+//
+// File systems can also be mounted on FreeBSD using its fusefs driver.
 package fuse
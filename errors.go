@@ -22,9 +22,23 @@ const (
 	EEXIST    = syscall.EEXIST
 	EINVAL    = syscall.EINVAL
 	EIO       = syscall.EIO
-	ENOATTR   = syscall.ENODATA
 	ENOENT    = syscall.ENOENT
 	ENOSYS    = syscall.ENOSYS
 	ENOTDIR   = syscall.ENOTDIR
 	ENOTEMPTY = syscall.ENOTEMPTY
 )
+
+// Return the errno that an op's error is reported to the kernel as: zero if
+// the op succeeded, the error itself if it's a syscall.Errno, and EIO for
+// any other error, including wrapped errnos.
+func opErrno(opErr error) syscall.Errno {
+	if opErr == nil {
+		return 0
+	}
+
+	if errno, ok := opErr.(syscall.Errno); ok {
+		return errno
+	}
+
+	return EIO
+}
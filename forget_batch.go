@@ -0,0 +1,129 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/buffer"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+	"golang.org/x/sys/unix"
+)
+
+// The most forget requests merged into a single BatchForgetOp, so that
+// other ops aren't held up indefinitely by a stream of them.
+const maxCoalescedForgets = 1024
+
+// Merge the forget requests that immediately follow the supplied forget op
+// into it, returning a BatchForgetOp. The first request that isn't a forget
+// is set aside for the next call to readMessage. See
+// MountConfig.CoalesceForgets.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) coalesceForgets(op any) *fuseops.BatchForgetOp {
+	batch := &fuseops.BatchForgetOp{}
+	index := make(map[fuseops.InodeID]int)
+	add := func(op any) {
+		var entries []fuseops.BatchForgetEntry
+		switch o := op.(type) {
+		case *fuseops.ForgetInodeOp:
+			if batch.OpContext.FuseID == 0 {
+				batch.OpContext = o.OpContext
+			}
+			entries = []fuseops.BatchForgetEntry{{Inode: o.Inode, N: o.N}}
+			if c.cfg.RecycleOps {
+				recycleOp(o)
+			}
+
+		case *fuseops.BatchForgetOp:
+			if batch.OpContext.FuseID == 0 {
+				batch.OpContext = o.OpContext
+			}
+			entries = o.Entries
+		}
+
+		for _, e := range entries {
+			if i, ok := index[e.Inode]; ok {
+				batch.Entries[i].N += e.N
+				continue
+			}
+			index[e.Inode] = len(batch.Entries)
+			batch.Entries = append(batch.Entries, e)
+		}
+	}
+
+	add(op)
+	for i := 1; i < maxCoalescedForgets && c.messageReady(); i++ {
+		inMsg, err := c.readMessage()
+		if err != nil {
+			// Let the next read find out about it.
+			break
+		}
+
+		switch inMsg.Header().Opcode {
+		case fusekernel.OpForget, fusekernel.OpBatchForget:
+		default:
+			c.stashMessage(inMsg)
+			return batch
+		}
+
+		outMsg := c.getOutMessage()
+		op, err := convertInMessage(&c.cfg, inMsg, outMsg, c.protocol)
+		c.putOutMessage(outMsg)
+		c.putInMessage(inMsg)
+		if err != nil {
+			continue
+		}
+
+		if c.debugLogger != nil {
+			c.debugLog(inMsg.Header().Unique, 1, "<- %s (coalesced)", describeRequest(op))
+		}
+		add(op)
+	}
+
+	return batch
+}
+
+// Return true if a message from the kernel can be read without blocking.
+func (c *Connection) messageReady() bool {
+	fds := []unix.PollFd{{Fd: int32(c.dev.Fd()), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, 0)
+	return err == nil && n > 0 && fds[0].Revents&unix.POLLIN != 0
+}
+
+// Set aside a message for the next call to readMessage.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) stashMessage(m *buffer.InMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stashed = append(c.stashed, m)
+}
+
+// Take a message set aside by stashMessage, if any.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) takeStashedMessage() *buffer.InMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.stashed) == 0 {
+		return nil
+	}
+
+	m := c.stashed[0]
+	c.stashed = c.stashed[1:]
+	return m
+}
@@ -0,0 +1,161 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+// A file system that records forgets, and whose StatFS blocks until released.
+type forgetFS struct {
+	fuseutil.NotImplementedFileSystem
+	release chan struct{}
+
+	mu      sync.Mutex
+	single  int
+	batches [][]fuseops.BatchForgetEntry
+}
+
+func (fs *forgetFS) StatFS(ctx context.Context, op *fuseops.StatFSOp) error {
+	<-fs.release
+	return nil
+}
+
+func (fs *forgetFS) ForgetInode(ctx context.Context, op *fuseops.ForgetInodeOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.single++
+	return nil
+}
+
+func (fs *forgetFS) BatchForget(ctx context.Context, op *fuseops.BatchForgetOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.batches = append(fs.batches, op.Entries)
+	return nil
+}
+
+func TestCoalesceForgets(t *testing.T) {
+	fs := &forgetFS{release: make(chan struct{})}
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), &fuse.MountConfig{
+		CoalesceForgets: true,
+		Concurrency:     fuse.ServerConcurrency{Workers: 1},
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	// Tie up the only worker with one StatFS, and the reader with another
+	// waiting for it, so that the forgets queue up behind them.
+	ctx := context.Background()
+	statFSDone := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { statFSDone <- k.Do(ctx, &fuseops.StatFSOp{}) }()
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := k.Do(ctx, &fuseops.ForgetInodeOp{Inode: fuseops.InodeID(100 + i%5), N: 1}); err != nil {
+			t.Fatalf("ForgetInode: %v", err)
+		}
+	}
+	batch := &fuseops.BatchForgetOp{Entries: []fuseops.BatchForgetEntry{{Inode: 100, N: 3}, {Inode: 200, N: 1}}}
+	if err := k.Do(ctx, batch); err != nil {
+		t.Fatalf("BatchForget: %v", err)
+	}
+
+	close(fs.release)
+	for i := 0; i < 2; i++ {
+		if err := <-statFSDone; err != nil {
+			t.Fatalf("StatFS: %v", err)
+		}
+	}
+
+	// The worker handles ops in order, so the forgets have been handled once
+	// this returns.
+	if err := k.Do(ctx, &fuseops.StatFSOp{}); err != nil {
+		t.Fatalf("StatFS: %v", err)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.single != 0 {
+		t.Errorf("ForgetInode called %d times, expected none", fs.single)
+	}
+	if len(fs.batches) != 1 {
+		t.Fatalf("expected a single batch, got %v", fs.batches)
+	}
+
+	want := []fuseops.BatchForgetEntry{
+		{Inode: 100, N: 5},
+		{Inode: 101, N: 2},
+		{Inode: 102, N: 2},
+		{Inode: 103, N: 2},
+		{Inode: 104, N: 2},
+		{Inode: 200, N: 1},
+	}
+	if !reflect.DeepEqual(fs.batches[0], want) {
+		t.Errorf("got entries %v, want %v", fs.batches[0], want)
+	}
+}
+
+func TestCoalesceForgetsMultipleReaders(t *testing.T) {
+	fs := &forgetFS{release: make(chan struct{})}
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), &fuse.MountConfig{
+		CoalesceForgets: true,
+		Concurrency:     fuse.ServerConcurrency{Readers: 2},
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	// Coalescing is off, so each forget is handled on its own.
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		if err := k.Do(ctx, &fuseops.ForgetInodeOp{Inode: fuseops.InodeID(100 + i), N: 1}); err != nil {
+			t.Fatalf("ForgetInode: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fs.mu.Lock()
+		single, batches := fs.single, len(fs.batches)
+		fs.mu.Unlock()
+
+		if batches != 0 {
+			t.Fatalf("got %d batches, expected none", batches)
+		}
+		if single == 10 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ForgetInode called %d times, expected 10", single)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -28,10 +28,11 @@ import (
 func (c *Connection) getInMessage() *buffer.InMessage {
 	c.mu.Lock()
 	x := (*buffer.InMessage)(c.inMessages.Get())
+	maxPayload := c.maxPayload
 	c.mu.Unlock()
 
 	if x == nil {
-		x = buffer.NewInMessage()
+		x = buffer.NewInMessageSize(maxPayload)
 	}
 
 	return x
@@ -40,8 +41,14 @@ func (c *Connection) getInMessage() *buffer.InMessage {
 // LOCKS_EXCLUDED(c.mu)
 func (c *Connection) putInMessage(x *buffer.InMessage) {
 	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Drop messages allocated before the payload size was negotiated.
+	if x.MaxPayload() != c.maxPayload {
+		return
+	}
+
 	c.inMessages.Put(unsafe.Pointer(x))
-	c.mu.Unlock()
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -64,6 +71,10 @@ func (c *Connection) getOutMessage() *buffer.OutMessage {
 
 // LOCKS_EXCLUDED(c.mu)
 func (c *Connection) putOutMessage(x *buffer.OutMessage) {
+	// Return the message's buffers to their pools now, rather than when it is
+	// next used.
+	x.Reset()
+
 	c.mu.Lock()
 	c.outMessages.Put(unsafe.Pointer(x))
 	c.mu.Unlock()
@@ -0,0 +1,721 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseafero
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+	"github.com/spf13/afero"
+)
+
+// NewFs returns an afero.Fs backed by the FileSystem, which it calls much as
+// the kernel would for the same calls on a mounted file system: looking up
+// each component of a path, opening and releasing handles, and forgetting
+// the inodes it looked up once done with them. Calls are made with a zero
+// OpContext, i.e. as root, and paths are relative to the root of the file
+// system whether or not they start with a slash.
+//
+// Errors from the FileSystem are returned wrapped in *os.PathError, so that
+// e.g. os.IsNotExist works on them.
+func NewFs(fs fuseutil.FileSystem) afero.Fs {
+	return &fuseFs{fs: fs}
+}
+
+type fuseFs struct {
+	fs fuseutil.FileSystem
+}
+
+var _ afero.Fs = &fuseFs{}
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+// Split a path into its components, of which there are none for the root.
+func splitPath(name string) []string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return nil
+	}
+
+	return strings.Split(name, "/")
+}
+
+// Look up the inode at the path, returning its ID and attributes, and the
+// IDs that have been looked up on the way, which the caller must forget
+// once done with the inode.
+func (a *fuseFs) walk(
+	ctx context.Context,
+	names []string) (fuseops.InodeID, fuseops.InodeAttributes, []fuseops.InodeID, error) {
+	attrsOp := &fuseops.GetInodeAttributesOp{Inode: fuseops.RootInodeID}
+	if err := a.fs.GetInodeAttributes(ctx, attrsOp); err != nil {
+		return 0, fuseops.InodeAttributes{}, nil, err
+	}
+
+	id, attrs := fuseops.InodeID(fuseops.RootInodeID), attrsOp.Attributes
+	var lookedUp []fuseops.InodeID
+	for _, name := range names {
+		op := &fuseops.LookUpInodeOp{Parent: id, Name: name}
+		if err := a.fs.LookUpInode(ctx, op); err != nil {
+			a.forget(ctx, lookedUp)
+			return 0, fuseops.InodeAttributes{}, nil, err
+		}
+
+		id, attrs = op.Entry.Child, op.Entry.Attributes
+		lookedUp = append(lookedUp, id)
+	}
+
+	return id, attrs, lookedUp, nil
+}
+
+// Look up the parent of the path, returning its ID and the last component of
+// the path, along with the IDs to forget as for walk.
+func (a *fuseFs) walkParent(
+	ctx context.Context,
+	name string) (fuseops.InodeID, string, []fuseops.InodeID, error) {
+	names := splitPath(name)
+	if len(names) == 0 {
+		return 0, "", nil, fuse.EINVAL
+	}
+
+	parent, attrs, lookedUp, err := a.walk(ctx, names[:len(names)-1])
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	if !attrs.Mode.IsDir() {
+		a.forget(ctx, lookedUp)
+		return 0, "", nil, fuse.ENOTDIR
+	}
+
+	return parent, names[len(names)-1], lookedUp, nil
+}
+
+// Forget one lookup of each of the inodes.
+func (a *fuseFs) forget(ctx context.Context, ids []fuseops.InodeID) {
+	for _, id := range ids {
+		a.fs.ForgetInode(ctx, &fuseops.ForgetInodeOp{Inode: id, N: 1})
+	}
+}
+
+// Return the error for a failed call on the named path.
+func pathError(op, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// Apply changes to the attributes of the inode at the path.
+func (a *fuseFs) setAttributes(
+	op string,
+	name string,
+	set func(attrs fuseops.InodeAttributes, op *fuseops.SetInodeAttributesOp)) error {
+	ctx := context.Background()
+	id, attrs, lookedUp, err := a.walk(ctx, splitPath(name))
+	if err != nil {
+		return pathError(op, name, err)
+	}
+	defer a.forget(ctx, lookedUp)
+
+	setOp := &fuseops.SetInodeAttributesOp{Inode: id}
+	set(attrs, setOp)
+	return pathError(op, name, a.fs.SetInodeAttributes(ctx, setOp))
+}
+
+////////////////////////////////////////////////////////////////////////
+// afero.Fs methods
+////////////////////////////////////////////////////////////////////////
+
+func (a *fuseFs) Name() string {
+	return "fuseafero"
+}
+
+func (a *fuseFs) Create(name string) (afero.File, error) {
+	return a.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (a *fuseFs) Open(name string) (afero.File, error) {
+	return a.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (a *fuseFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	ctx := context.Background()
+	f := &fuseFile{fs: a, name: name, flag: flag}
+
+	names := splitPath(name)
+	id, attrs, lookedUp, err := a.walk(ctx, names)
+	switch {
+	case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		a.forget(ctx, lookedUp)
+		return nil, pathError("open", name, fuse.EEXIST)
+
+	case errors.Is(err, fuse.ENOENT) && flag&os.O_CREATE != 0:
+		parent, base, parentLookedUp, err := a.walkParent(ctx, name)
+		if err != nil {
+			return nil, pathError("open", name, err)
+		}
+		defer a.forget(ctx, parentLookedUp)
+
+		op := &fuseops.CreateFileOp{
+			Parent:    parent,
+			Name:      base,
+			Mode:      perm.Perm(),
+			OpenFlags: fusekernel.OpenFlags(flag),
+		}
+		if err := a.fs.CreateFile(ctx, op); err != nil {
+			return nil, pathError("open", name, err)
+		}
+
+		f.inode, f.handle = op.Entry.Child, op.Handle
+		return f, nil
+
+	case err != nil:
+		return nil, pathError("open", name, err)
+	}
+
+	f.inode = id
+	if len(names) != 0 {
+		f.lookedUp = lookedUp[len(lookedUp)-1:]
+		a.forget(ctx, lookedUp[:len(lookedUp)-1])
+	}
+
+	if attrs.Mode.IsDir() {
+		if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			f.forget(ctx)
+			return nil, pathError("open", name, syscall.EISDIR)
+		}
+
+		op := &fuseops.OpenDirOp{Inode: id}
+		if err := a.fs.OpenDir(ctx, op); err != nil {
+			f.forget(ctx)
+			return nil, pathError("open", name, err)
+		}
+
+		f.dir, f.handle = true, op.Handle
+		return f, nil
+	}
+
+	op := &fuseops.OpenFileOp{Inode: id, OpenFlags: fusekernel.OpenFlags(flag)}
+	if err := a.fs.OpenFile(ctx, op); err != nil {
+		f.forget(ctx)
+		return nil, pathError("open", name, err)
+	}
+	f.handle = op.Handle
+
+	if flag&os.O_TRUNC != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (a *fuseFs) Mkdir(name string, perm os.FileMode) error {
+	ctx := context.Background()
+	parent, base, lookedUp, err := a.walkParent(ctx, name)
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+	defer a.forget(ctx, lookedUp)
+
+	op := &fuseops.MkDirOp{Parent: parent, Name: base, Mode: perm.Perm() | os.ModeDir}
+	if err := a.fs.MkDir(ctx, op); err != nil {
+		return pathError("mkdir", name, err)
+	}
+
+	a.forget(ctx, []fuseops.InodeID{op.Entry.Child})
+	return nil
+}
+
+func (a *fuseFs) MkdirAll(name string, perm os.FileMode) error {
+	names := splitPath(name)
+	for i := range names {
+		dir := strings.Join(names[:i+1], "/")
+		fi, err := a.Stat(dir)
+		switch {
+		case err == nil && !fi.IsDir():
+			return pathError("mkdir", dir, fuse.ENOTDIR)
+
+		case os.IsNotExist(err):
+			if err := a.Mkdir(dir, perm); err != nil && !os.IsExist(err) {
+				return err
+			}
+
+		case err != nil:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *fuseFs) Remove(name string) error {
+	ctx := context.Background()
+	parent, base, lookedUp, err := a.walkParent(ctx, name)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	defer a.forget(ctx, lookedUp)
+
+	lookUp := &fuseops.LookUpInodeOp{Parent: parent, Name: base}
+	if err := a.fs.LookUpInode(ctx, lookUp); err != nil {
+		return pathError("remove", name, err)
+	}
+	a.forget(ctx, []fuseops.InodeID{lookUp.Entry.Child})
+
+	if lookUp.Entry.Attributes.Mode.IsDir() {
+		err = a.fs.RmDir(ctx, &fuseops.RmDirOp{Parent: parent, Name: base})
+	} else {
+		err = a.fs.Unlink(ctx, &fuseops.UnlinkOp{Parent: parent, Name: base})
+	}
+
+	return pathError("remove", name, err)
+}
+
+func (a *fuseFs) RemoveAll(name string) error {
+	fi, err := a.Stat(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		d, err := a.Open(name)
+		if err != nil {
+			return err
+		}
+
+		children, err := d.Readdirnames(-1)
+		d.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, child := range children {
+			if err := a.RemoveAll(path.Join(name, child)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return a.Remove(name)
+}
+
+func (a *fuseFs) Rename(oldname, newname string) error {
+	ctx := context.Background()
+	oldParent, oldBase, oldLookedUp, err := a.walkParent(ctx, oldname)
+	if err != nil {
+		return pathError("rename", oldname, err)
+	}
+	defer a.forget(ctx, oldLookedUp)
+
+	newParent, newBase, newLookedUp, err := a.walkParent(ctx, newname)
+	if err != nil {
+		return pathError("rename", newname, err)
+	}
+	defer a.forget(ctx, newLookedUp)
+
+	op := &fuseops.RenameOp{
+		OldParent: oldParent,
+		OldName:   oldBase,
+		NewParent: newParent,
+		NewName:   newBase,
+	}
+
+	return pathError("rename", oldname, a.fs.Rename(ctx, op))
+}
+
+func (a *fuseFs) Stat(name string) (os.FileInfo, error) {
+	ctx := context.Background()
+	_, attrs, lookedUp, err := a.walk(ctx, splitPath(name))
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	a.forget(ctx, lookedUp)
+
+	return &fileInfo{name: path.Base("/" + name), attrs: attrs}, nil
+}
+
+func (a *fuseFs) Chmod(name string, mode os.FileMode) error {
+	return a.setAttributes("chmod", name, func(attrs fuseops.InodeAttributes, op *fuseops.SetInodeAttributesOp) {
+		mode := attrs.Mode.Type() | mode.Perm()
+		op.Mode = &mode
+	})
+}
+
+func (a *fuseFs) Chown(name string, uid, gid int) error {
+	return a.setAttributes("chown", name, func(attrs fuseops.InodeAttributes, op *fuseops.SetInodeAttributesOp) {
+		if uid >= 0 {
+			u := uint32(uid)
+			op.Uid = &u
+		}
+		if gid >= 0 {
+			g := uint32(gid)
+			op.Gid = &g
+		}
+	})
+}
+
+func (a *fuseFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return a.setAttributes("chtimes", name, func(attrs fuseops.InodeAttributes, op *fuseops.SetInodeAttributesOp) {
+		op.Atime, op.Mtime = &atime, &mtime
+	})
+}
+
+////////////////////////////////////////////////////////////////////////
+// Files
+////////////////////////////////////////////////////////////////////////
+
+// A file or directory opened through a fuseFs.
+type fuseFile struct {
+	fs     *fuseFs
+	name   string
+	flag   int
+	inode  fuseops.InodeID
+	handle fuseops.HandleID
+	dir    bool
+
+	// The lookup of the inode to forget on Close, if any. The root inode isn't
+	// looked up.
+	lookedUp []fuseops.InodeID
+
+	mu sync.Mutex
+
+	// The offset of the next Read or Write, and for directories that of the
+	// next read of entries, along with entries that have been read but not
+	// yet returned.
+	//
+	// GUARDED_BY(mu)
+	offset    int64
+	dirOffset fuseops.DirOffset
+	dirents   []fuseutil.Dirent
+	dirEOF    bool
+	closed    bool
+}
+
+var _ afero.File = &fuseFile{}
+
+func (f *fuseFile) forget(ctx context.Context) {
+	f.fs.forget(ctx, f.lookedUp)
+}
+
+func (f *fuseFile) Name() string {
+	return f.name
+}
+
+func (f *fuseFile) Close() error {
+	ctx := context.Background()
+
+	f.mu.Lock()
+	closed := f.closed
+	f.closed = true
+	f.mu.Unlock()
+
+	if closed {
+		return pathError("close", f.name, afero.ErrFileClosed)
+	}
+
+	defer f.forget(ctx)
+	if f.dir {
+		return pathError("close", f.name, f.fs.fs.ReleaseDirHandle(ctx, &fuseops.ReleaseDirHandleOp{Handle: f.handle}))
+	}
+
+	err := f.fs.fs.FlushFile(ctx, &fuseops.FlushFileOp{Inode: f.inode, Handle: f.handle})
+	if err == fuse.ENOSYS {
+		err = nil
+	}
+
+	f.fs.fs.ReleaseFileHandle(ctx, &fuseops.ReleaseFileHandleOp{Handle: f.handle})
+	return pathError("close", f.name, err)
+}
+
+func (f *fuseFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.dir {
+		return 0, pathError("read", f.name, syscall.EISDIR)
+	}
+
+	// Read until p is full or the file ends, as io.ReaderAt requires.
+	var n int
+	for n < len(p) {
+		op := &fuseops.ReadFileOp{
+			Inode:  f.inode,
+			Handle: f.handle,
+			Offset: off + int64(n),
+			Size:   int64(len(p) - n),
+			Dst:    p[n:],
+		}
+		if err := f.fs.fs.ReadFile(context.Background(), op); err != nil {
+			return n, pathError("read", f.name, err)
+		}
+
+		data, err := fuseutil.ReadFileData(op)
+		if err != nil {
+			return n, pathError("read", f.name, err)
+		}
+
+		if len(data) == 0 {
+			return n, io.EOF
+		}
+
+		n += copy(p[n:], data)
+	}
+
+	return n, nil
+}
+
+func (f *fuseFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n != 0 {
+		err = nil
+	}
+
+	return n, err
+}
+
+func (f *fuseFile) WriteAt(p []byte, off int64) (int, error) {
+	if f.dir {
+		return 0, pathError("write", f.name, syscall.EISDIR)
+	}
+
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, pathError("write", f.name, syscall.EBADF)
+	}
+
+	op := &fuseops.WriteFileOp{Inode: f.inode, Handle: f.handle, Offset: off, Data: p}
+	if err := f.fs.fs.WriteFile(context.Background(), op); err != nil {
+		return 0, pathError("write", f.name, err)
+	}
+
+	return len(p), nil
+}
+
+func (f *fuseFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		f.offset = fi.Size()
+	}
+
+	n, err := f.WriteAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *fuseFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *fuseFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+
+	case io.SeekEnd:
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += fi.Size()
+	}
+
+	if offset < 0 {
+		return 0, pathError("seek", f.name, fuse.EINVAL)
+	}
+
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *fuseFile) Stat() (os.FileInfo, error) {
+	op := &fuseops.GetInodeAttributesOp{Inode: f.inode}
+	if !f.dir {
+		op.Handle = &f.handle
+	}
+
+	if err := f.fs.fs.GetInodeAttributes(context.Background(), op); err != nil {
+		return nil, pathError("stat", f.name, err)
+	}
+
+	return &fileInfo{name: path.Base("/" + f.name), attrs: op.Attributes}, nil
+}
+
+func (f *fuseFile) Sync() error {
+	if f.dir {
+		return nil
+	}
+
+	err := f.fs.fs.SyncFile(context.Background(), &fuseops.SyncFileOp{Inode: f.inode, Handle: f.handle})
+	if err == fuse.ENOSYS {
+		err = nil
+	}
+
+	return pathError("sync", f.name, err)
+}
+
+func (f *fuseFile) Truncate(size int64) error {
+	if size < 0 {
+		return pathError("truncate", f.name, fuse.EINVAL)
+	}
+
+	s := uint64(size)
+	op := &fuseops.SetInodeAttributesOp{Inode: f.inode, Handle: &f.handle, Size: &s}
+	return pathError("truncate", f.name, f.fs.fs.SetInodeAttributes(context.Background(), op))
+}
+
+// Return up to n of the directory's entries that haven't been returned yet,
+// or all of them if n <= 0, leaving out "." and "..".
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *fuseFile) readDirents(n int) ([]fuseutil.Dirent, error) {
+	if !f.dir {
+		return nil, pathError("readdir", f.name, fuse.ENOTDIR)
+	}
+
+	for !f.dirEOF && (n <= 0 || len(f.dirents) < n) {
+		op := &fuseops.ReadDirOp{
+			Inode:  f.inode,
+			Handle: f.handle,
+			Offset: f.dirOffset,
+			Dst:    make([]byte, 64<<10),
+		}
+		if err := f.fs.fs.ReadDir(context.Background(), op); err != nil {
+			return nil, pathError("readdir", f.name, err)
+		}
+
+		if op.BytesRead == 0 {
+			f.dirEOF = true
+			break
+		}
+
+		for buf := op.Dst[:op.BytesRead]; len(buf) > 0; {
+			d, size := fuseutil.ReadDirent(buf)
+			if size == 0 {
+				break
+			}
+			buf = buf[size:]
+
+			f.dirOffset = d.Offset
+			if d.Name != "." && d.Name != ".." {
+				f.dirents = append(f.dirents, d)
+			}
+		}
+	}
+
+	if n <= 0 || n > len(f.dirents) {
+		n = len(f.dirents)
+	}
+
+	dirents := f.dirents[:n]
+	f.dirents = f.dirents[n:]
+	return dirents, nil
+}
+
+func (f *fuseFile) Readdirnames(n int) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dirents, err := f.readDirents(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if n > 0 && len(dirents) == 0 {
+		return nil, io.EOF
+	}
+
+	names := make([]string, len(dirents))
+	for i, d := range dirents {
+		names[i] = d.Name
+	}
+
+	return names, nil
+}
+
+func (f *fuseFile) Readdir(n int) ([]os.FileInfo, error) {
+	ctx := context.Background()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dirents, err := f.readDirents(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if n > 0 && len(dirents) == 0 {
+		return nil, io.EOF
+	}
+
+	fis := make([]os.FileInfo, 0, len(dirents))
+	for _, d := range dirents {
+		op := &fuseops.LookUpInodeOp{Parent: f.inode, Name: d.Name}
+		if err := f.fs.fs.LookUpInode(ctx, op); err != nil {
+			// The entry has gone since it was listed.
+			if errors.Is(err, fuse.ENOENT) {
+				continue
+			}
+			return fis, pathError("readdir", f.name, err)
+		}
+		f.fs.forget(ctx, []fuseops.InodeID{op.Entry.Child})
+
+		fis = append(fis, &fileInfo{name: d.Name, attrs: op.Entry.Attributes})
+	}
+
+	return fis, nil
+}
+
+// fileInfo implements os.FileInfo for the attributes of an inode, which Sys
+// returns.
+type fileInfo struct {
+	name  string
+	attrs fuseops.InodeAttributes
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return int64(fi.attrs.Size) }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.attrs.Mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.attrs.Mtime }
+func (fi *fileInfo) IsDir() bool        { return fi.attrs.Mode.IsDir() }
+func (fi *fileInfo) Sys() any           { return fi.attrs }
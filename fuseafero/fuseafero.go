@@ -0,0 +1,262 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fuseafero connects this package to afero
+// (https://github.com/spf13/afero) file systems. NewServer serves an afero.Fs
+// through FUSE, and NewFs goes the other way, exposing a fuseutil.FileSystem
+// as an afero.Fs, e.g. to test it with code written against afero.
+//
+// The package is a module of its own, so that only programs that use it
+// depend on afero.
+package fuseafero
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fusepath"
+	"github.com/spf13/afero"
+)
+
+// NewServer returns a server that serves the afero file system.
+func NewServer(afs afero.Fs) fuse.Server {
+	return fusepath.NewServer(NewFileSystem(afs))
+}
+
+// NewFileSystem returns a fusepath.FileSystem backed by the afero file
+// system, for use as a building block.
+//
+// Symlinks are supported if afs implements afero.Symlinker. Files that can't
+// be opened for writing, such as those of an afero.ReadOnlyFs, are opened for
+// reading only.
+func NewFileSystem(afs afero.Fs) fusepath.FileSystem {
+	return &aferoFS{afs: afs}
+}
+
+type aferoFS struct {
+	afs afero.Fs
+}
+
+var _ fusepath.FileSystem = &aferoFS{}
+
+func (a *aferoFS) Stat(
+	ctx context.Context,
+	path string) (fuseops.InodeAttributes, error) {
+	var fi os.FileInfo
+	var err error
+	if l, ok := a.afs.(afero.Lstater); ok {
+		fi, _, err = l.LstatIfPossible(path)
+	} else {
+		fi, err = a.afs.Stat(path)
+	}
+
+	if err != nil {
+		return fuseops.InodeAttributes{}, err
+	}
+
+	return fusepath.FileInfoAttributes(fi), nil
+}
+
+func (a *aferoFS) ReadDir(
+	ctx context.Context,
+	path string) ([]fusepath.DirEntry, error) {
+	fis, err := afero.ReadDir(a.afs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return fusepath.FileInfoEntries(fis), nil
+}
+
+func (a *aferoFS) Open(
+	ctx context.Context,
+	path string) (fusepath.File, error) {
+	f, err := a.afs.OpenFile(path, os.O_RDWR, 0)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		f, err = a.afs.OpenFile(path, os.O_RDONLY, 0)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &aferoFile{f: f}, nil
+}
+
+func (a *aferoFS) Create(
+	ctx context.Context,
+	path string,
+	mode os.FileMode) (fusepath.File, error) {
+	f, err := a.afs.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aferoFile{f: f}, nil
+}
+
+func (a *aferoFS) SetAttributes(
+	ctx context.Context,
+	path string,
+	changes fusepath.AttributeChanges) error {
+	if changes.Size != nil {
+		f, err := a.afs.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+
+		err = f.Truncate(int64(*changes.Size))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if changes.Mode != nil {
+		if err := a.afs.Chmod(path, *changes.Mode); err != nil {
+			return err
+		}
+	}
+
+	if changes.Uid != nil || changes.Gid != nil {
+		uid, gid := -1, -1
+		if changes.Uid != nil {
+			uid = int(*changes.Uid)
+		}
+		if changes.Gid != nil {
+			gid = int(*changes.Gid)
+		}
+
+		if err := a.afs.Chown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+
+	if changes.Atime != nil || changes.Mtime != nil {
+		fi, err := a.afs.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		// afero has no notion of the access time, so leave it as the
+		// modification time unless told otherwise.
+		atime, mtime := fi.ModTime(), fi.ModTime()
+		if changes.Atime != nil {
+			atime = *changes.Atime
+		}
+		if changes.Mtime != nil {
+			mtime = *changes.Mtime
+		}
+
+		if err := a.afs.Chtimes(path, atime, mtime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *aferoFS) Mkdir(
+	ctx context.Context,
+	path string,
+	mode os.FileMode) error {
+	return a.afs.Mkdir(path, mode)
+}
+
+func (a *aferoFS) Symlink(
+	ctx context.Context,
+	target string,
+	path string) error {
+	l, ok := a.afs.(afero.Linker)
+	if !ok {
+		return fuse.ENOSYS
+	}
+
+	return l.SymlinkIfPossible(target, path)
+}
+
+func (a *aferoFS) Readlink(
+	ctx context.Context,
+	path string) (string, error) {
+	l, ok := a.afs.(afero.LinkReader)
+	if !ok {
+		return "", fuse.ENOSYS
+	}
+
+	return l.ReadlinkIfPossible(path)
+}
+
+func (a *aferoFS) Remove(
+	ctx context.Context,
+	path string) error {
+	return a.afs.Remove(path)
+}
+
+func (a *aferoFS) Rmdir(
+	ctx context.Context,
+	path string) error {
+	// Not all afero file systems refuse to remove directories that aren't
+	// empty.
+	names, err := afero.ReadDir(a.afs, path)
+	if err != nil {
+		return err
+	}
+
+	if len(names) != 0 {
+		return fuse.ENOTEMPTY
+	}
+
+	return a.afs.Remove(path)
+}
+
+func (a *aferoFS) Rename(
+	ctx context.Context,
+	oldPath string,
+	newPath string) error {
+	return a.afs.Rename(oldPath, newPath)
+}
+
+// aferoFile implements fusepath.File on top of an afero.File.
+type aferoFile struct {
+	f afero.File
+}
+
+func (f *aferoFile) ReadAt(
+	ctx context.Context,
+	p []byte,
+	off int64) (int, error) {
+	return f.f.ReadAt(p, off)
+}
+
+func (f *aferoFile) WriteAt(
+	ctx context.Context,
+	p []byte,
+	off int64) (int, error) {
+	return f.f.WriteAt(p, off)
+}
+
+func (f *aferoFile) Sync(ctx context.Context) error {
+	return f.f.Sync()
+}
+
+func (f *aferoFile) Close() error {
+	return f.f.Close()
+}
@@ -0,0 +1,162 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseafero_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseafero"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/spf13/afero"
+)
+
+func TestServer(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the in-process transport requires Linux")
+	}
+
+	mem := afero.NewMemMapFs()
+	if err := afero.WriteFile(mem, "dir/existing", []byte("taco"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseafero.NewServer(mem), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	lookUp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "dir"}
+	if err := k.Do(ctx, lookUp); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+	dir := lookUp.Entry.Child
+
+	lookUp = &fuseops.LookUpInodeOp{Parent: dir, Name: "existing"}
+	if err := k.Do(ctx, lookUp); err != nil || lookUp.Entry.Attributes.Size != 4 {
+		t.Fatalf("LookUpInode: %+v, %v", lookUp.Entry, err)
+	}
+
+	open := &fuseops.OpenFileOp{Inode: lookUp.Entry.Child}
+	if err := k.Do(ctx, open); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	read := &fuseops.ReadFileOp{Inode: lookUp.Entry.Child, Handle: open.Handle, Size: 100}
+	if err := k.Do(ctx, read); err != nil || string(read.Dst[:read.BytesRead]) != "taco" {
+		t.Errorf("ReadFile: %q, %v", read.Dst[:read.BytesRead], err)
+	}
+
+	create := &fuseops.CreateFileOp{Parent: dir, Name: "new", Mode: 0644}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Offset: 2, Data: []byte("burrito")}
+	if err := k.Do(ctx, write); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := k.Do(ctx, &fuseops.ReleaseFileHandleOp{Handle: create.Handle}); err != nil {
+		t.Fatalf("ReleaseFileHandle: %v", err)
+	}
+
+	if got, err := afero.ReadFile(mem, "dir/new"); err != nil || string(got) != "\x00\x00burrito" {
+		t.Errorf("afero.ReadFile: %q, %v", got, err)
+	}
+
+	if err := k.Do(ctx, &fuseops.RmDirOp{Parent: fuseops.RootInodeID, Name: "dir"}); err != syscall.ENOTEMPTY {
+		t.Errorf("RmDir of non-empty directory: %v, want ENOTEMPTY", err)
+	}
+}
+
+func TestFs(t *testing.T) {
+	root := t.TempDir()
+	fs, err := fuseutil.NewLoopbackFileSystem(root)
+	if err != nil {
+		t.Skipf("NewLoopbackFileSystem: %v", err)
+	}
+	defer fs.Destroy()
+
+	afs := fuseafero.NewFs(fs)
+	if err := afs.MkdirAll("a/b", 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := afero.WriteFile(afs, "/a/b/file", []byte("hello"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if got, err := os.ReadFile(filepath.Join(root, "a/b/file")); err != nil || string(got) != "hello" {
+		t.Errorf("os.ReadFile: %q, %v", got, err)
+	}
+
+	// Appending, seeking, and reading back.
+	f, err := afs.OpenFile("a/b/file", os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if _, err := f.WriteString(", world"); err != nil {
+		t.Errorf("WriteString: %v", err)
+	}
+	if _, err := f.Seek(7, io.SeekStart); err != nil {
+		t.Errorf("Seek: %v", err)
+	}
+	if got, err := io.ReadAll(f); err != nil || string(got) != "world" {
+		t.Errorf("ReadAll: %q, %v", got, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	if _, err := afs.Stat("a/missing"); !os.IsNotExist(err) {
+		t.Errorf("Stat of missing file: %v", err)
+	}
+	if _, err := afs.OpenFile("a/b/file", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644); !os.IsExist(err) {
+		t.Errorf("exclusive create of existing file: %v", err)
+	}
+
+	if err := afs.Rename("a/b/file", "a/renamed"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+
+	fis, err := afero.ReadDir(afs, "a")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	if want := []string{"b", "renamed"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadDir %q, want %q", names, want)
+	}
+	if fi := fis[1]; fi.IsDir() || fi.Size() != 12 {
+		t.Errorf("renamed: dir %v, size %d", fi.IsDir(), fi.Size())
+	}
+
+	if err := afs.RemoveAll("a"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a")); !os.IsNotExist(err) {
+		t.Errorf("os.Stat after RemoveAll: %v", err)
+	}
+}
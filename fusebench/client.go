@@ -0,0 +1,289 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fusebench
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+// A client performs the operations that the benchmarks are made of, through
+// one of the transports. Paths are relative to the root of the file system.
+type client interface {
+	create(name string) (file, error)
+	mkdir(name string) error
+	stat(name string) error
+
+	// Return the number of entries in the directory.
+	readDir(name string) (int, error)
+}
+
+type file interface {
+	readAt(p []byte, off int64) (int, error)
+	writeAt(p []byte, off int64) error
+	close() error
+}
+
+// Start serving a new file system for the benchmark, which is torn down when
+// it ends.
+func start(b *testing.B, cfg Config) client {
+	b.Helper()
+
+	mountCfg := &fuse.MountConfig{}
+	if cfg.MountConfig != nil {
+		mountCfg = cfg.MountConfig
+	}
+
+	switch cfg.Transport {
+	case InProcess:
+		k, err := fakekernel.Start(cfg.NewServer(), mountCfg)
+		if err != nil {
+			b.Fatalf("fakekernel.Start: %v", err)
+		}
+		b.Cleanup(func() { k.Close() })
+		return &kernelClient{k: k, ctx: context.Background()}
+
+	case Mount:
+		dir := b.TempDir()
+		mfs, err := fuse.Mount(dir, cfg.NewServer(), mountCfg)
+		if err != nil {
+			b.Fatalf("Mount: %v", err)
+		}
+		b.Cleanup(func() {
+			if err := fuse.UnmountWithOptions(dir, fuse.UnmountOptions{RetryTimeout: 10 * time.Second}); err != nil {
+				b.Errorf("Unmount: %v", err)
+				return
+			}
+			mfs.Join(context.Background())
+		})
+		return &mountClient{dir: dir}
+	}
+
+	b.Fatalf("unknown transport %v", cfg.Transport)
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////
+// Mount
+////////////////////////////////////////////////////////////////////////
+
+type mountClient struct {
+	dir string
+}
+
+func (c *mountClient) create(name string) (file, error) {
+	f, err := os.OpenFile(filepath.Join(c.dir, name), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return osFile{f}, nil
+}
+
+func (c *mountClient) mkdir(name string) error {
+	return os.Mkdir(filepath.Join(c.dir, name), 0755)
+}
+
+func (c *mountClient) stat(name string) error {
+	_, err := os.Stat(filepath.Join(c.dir, name))
+	return err
+}
+
+func (c *mountClient) readDir(name string) (int, error) {
+	entries, err := os.ReadDir(filepath.Join(c.dir, name))
+	return len(entries), err
+}
+
+type osFile struct {
+	f *os.File
+}
+
+func (f osFile) readAt(p []byte, off int64) (int, error) {
+	n, err := f.f.ReadAt(p, off)
+	if err == io.EOF && n == len(p) {
+		err = nil
+	}
+	return n, err
+}
+
+func (f osFile) writeAt(p []byte, off int64) error {
+	_, err := f.f.WriteAt(p, off)
+	return err
+}
+
+func (f osFile) close() error {
+	return f.f.Close()
+}
+
+////////////////////////////////////////////////////////////////////////
+// In-process
+////////////////////////////////////////////////////////////////////////
+
+type kernelClient struct {
+	k   *fakekernel.Kernel
+	ctx context.Context
+}
+
+// Look up the inode for a path, as the kernel would do a component at a
+// time.
+func (c *kernelClient) lookUp(name string) (fuseops.InodeID, error) {
+	var inode fuseops.InodeID = fuseops.RootInodeID
+	if name == "" || name == "." {
+		return inode, nil
+	}
+
+	for _, component := range splitPath(name) {
+		op := &fuseops.LookUpInodeOp{Parent: inode, Name: component}
+		if err := c.k.Do(c.ctx, op); err != nil {
+			return 0, err
+		}
+		inode = op.Entry.Child
+	}
+
+	return inode, nil
+}
+
+func splitPath(name string) []string {
+	dir, base := path.Split(path.Clean(name))
+	if dir == "" {
+		return []string{base}
+	}
+	return append(splitPath(dir), base)
+}
+
+func (c *kernelClient) create(name string) (file, error) {
+	parent, err := c.lookUp(path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+
+	op := &fuseops.CreateFileOp{Parent: parent, Name: path.Base(name), Mode: 0644}
+	if err := c.k.Do(c.ctx, op); err != nil {
+		return nil, err
+	}
+
+	return &kernelFile{c: c, inode: op.Entry.Child, handle: op.Handle}, nil
+}
+
+func (c *kernelClient) mkdir(name string) error {
+	parent, err := c.lookUp(path.Dir(name))
+	if err != nil {
+		return err
+	}
+
+	return c.k.Do(c.ctx, &fuseops.MkDirOp{Parent: parent, Name: path.Base(name), Mode: os.ModeDir | 0755})
+}
+
+func (c *kernelClient) stat(name string) error {
+	inode, err := c.lookUp(name)
+	if err != nil {
+		return err
+	}
+
+	return c.k.Do(c.ctx, &fuseops.GetInodeAttributesOp{Inode: inode})
+}
+
+func (c *kernelClient) readDir(name string) (int, error) {
+	inode, err := c.lookUp(name)
+	if err != nil {
+		return 0, err
+	}
+
+	open := &fuseops.OpenDirOp{Inode: inode}
+	if err := c.k.Do(c.ctx, open); err != nil {
+		return 0, err
+	}
+	defer c.k.Do(c.ctx, &fuseops.ReleaseDirHandleOp{Handle: open.Handle})
+
+	var count int
+	var offset fuseops.DirOffset
+	buf := make([]byte, 64<<10)
+	for {
+		op := &fuseops.ReadDirOp{Inode: inode, Handle: open.Handle, Offset: offset, Dst: buf}
+		if err := c.k.Do(c.ctx, op); err != nil {
+			return count, err
+		}
+		if op.BytesRead == 0 {
+			return count, nil
+		}
+
+		n, last, err := parseDirents(buf[:op.BytesRead])
+		if err != nil {
+			return count, err
+		}
+		count += n
+		offset = last
+	}
+}
+
+// Parse the dirents in the supplied buffer, returning how many there are and
+// the offset of the last.
+func parseDirents(buf []byte) (int, fuseops.DirOffset, error) {
+	var count int
+	var offset fuseops.DirOffset
+	for len(buf) > 0 {
+		if len(buf) < fusekernel.DirentSize {
+			return 0, 0, errors.New("truncated dirent")
+		}
+
+		d := (*fusekernel.Dirent)(unsafe.Pointer(&buf[0]))
+		size := (fusekernel.DirentSize + int(d.Namelen) + 7) &^ 7
+		if size > len(buf) {
+			size = len(buf)
+		}
+
+		count++
+		offset = fuseops.DirOffset(d.Off)
+		buf = buf[size:]
+	}
+
+	return count, offset, nil
+}
+
+type kernelFile struct {
+	c      *kernelClient
+	inode  fuseops.InodeID
+	handle fuseops.HandleID
+}
+
+func (f *kernelFile) readAt(p []byte, off int64) (int, error) {
+	op := &fuseops.ReadFileOp{Inode: f.inode, Handle: f.handle, Offset: off, Size: int64(len(p)), Dst: p}
+	err := f.c.k.Do(f.c.ctx, op)
+	return op.BytesRead, err
+}
+
+func (f *kernelFile) writeAt(p []byte, off int64) error {
+	return f.c.k.Do(f.c.ctx, &fuseops.WriteFileOp{Inode: f.inode, Handle: f.handle, Offset: off, Data: p})
+}
+
+func (f *kernelFile) close() error {
+	// Like the kernel, tolerate file systems that don't implement release.
+	err := f.c.k.Do(f.c.ctx, &fuseops.ReleaseFileHandleOp{Handle: f.handle})
+	if err == fuse.ENOSYS {
+		err = nil
+	}
+	return err
+}
@@ -0,0 +1,276 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fusebench provides benchmarks that can be run against any
+// fuse.Server, so that the performance of file systems and of this package can
+// be compared across changes with standard tools such as benchstat. For
+// example:
+//
+//	func BenchmarkMemFS(b *testing.B) {
+//		fusebench.Run(b, fusebench.Config{
+//			NewServer: func() fuse.Server { return memfs.NewMemFS(0, 0) },
+//		})
+//	}
+//
+// The benchmarks reach the file system either through the in-process
+// transport, which exchanges raw FUSE messages with it without involving the
+// kernel, so that the cost of the file system and this package is measured in
+// isolation, or through a real mount.
+package fusebench
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+)
+
+// Transport is the means by which benchmarks reach the file system.
+type Transport int
+
+const (
+	// Exchange messages with the server in-process, as the kernel would. This
+	// is only supported on Linux.
+	InProcess Transport = iota
+
+	// Mount the file system on a temporary directory and use it through
+	// system calls. This requires the privileges to mount it.
+	Mount
+)
+
+func (t Transport) String() string {
+	switch t {
+	case InProcess:
+		return "InProcess"
+	case Mount:
+		return "Mount"
+	}
+
+	return fmt.Sprintf("Transport(%d)", int(t))
+}
+
+// Config describes what to benchmark, and how.
+type Config struct {
+	// Create the server to benchmark. It is called once for each benchmark,
+	// and must serve a file system in which files and directories can be
+	// created in the root, such as samples/memfs.
+	NewServer func() fuse.Server
+
+	// How to reach the file system.
+	Transport Transport
+
+	// The config to mount the file system with. If nil, the zero value is
+	// used.
+	MountConfig *fuse.MountConfig
+
+	// The size of the file read and written by the I/O benchmarks. If zero,
+	// 64 MiB is used.
+	FileSize int64
+
+	// The size of each read and write. If zero, 128 KiB is used.
+	BlockSize int
+
+	// The number of entries in the directory listed by ReadDir, and the
+	// number of files statted by StatStorm. If zero, 10000 is used.
+	Entries int
+}
+
+func (cfg *Config) fileSize() int64 {
+	if cfg.FileSize <= 0 {
+		return 64 << 20
+	}
+	return cfg.FileSize
+}
+
+func (cfg *Config) blockSize() int {
+	if cfg.BlockSize <= 0 {
+		return 128 << 10
+	}
+	return cfg.BlockSize
+}
+
+func (cfg *Config) entries() int {
+	if cfg.Entries <= 0 {
+		return 10000
+	}
+	return cfg.Entries
+}
+
+// A Benchmark exercises a file system in one way.
+type Benchmark struct {
+	Name string
+	Run  func(b *testing.B, cfg Config)
+}
+
+// Benchmarks lists the benchmarks run by Run.
+var Benchmarks = []Benchmark{
+	{"SeqWrite", SeqWrite},
+	{"RandWrite", RandWrite},
+	{"SeqRead", SeqRead},
+	{"RandRead", RandRead},
+	{"StatStorm", StatStorm},
+	{"ReadDir", ReadDir},
+}
+
+// Run runs each of Benchmarks as a sub-benchmark of b.
+func Run(b *testing.B, cfg Config) {
+	for _, bm := range Benchmarks {
+		b.Run(bm.Name, func(b *testing.B) { bm.Run(b, cfg) })
+	}
+}
+
+// SeqWrite measures writing a file from start to end, a block at a time.
+// Each iteration writes one block.
+func SeqWrite(b *testing.B, cfg Config) {
+	benchWrite(b, cfg, false)
+}
+
+// RandWrite measures writing blocks at random block-aligned offsets within a
+// file.
+func RandWrite(b *testing.B, cfg Config) {
+	benchWrite(b, cfg, true)
+}
+
+// SeqRead measures reading a file from start to end, a block at a time.
+// Each iteration reads one block.
+func SeqRead(b *testing.B, cfg Config) {
+	benchRead(b, cfg, false)
+}
+
+// RandRead measures reading blocks at random block-aligned offsets within a
+// file.
+func RandRead(b *testing.B, cfg Config) {
+	benchRead(b, cfg, true)
+}
+
+// StatStorm measures looking up files by name and getting their attributes,
+// as stat(2) does. Each iteration stats one file.
+func StatStorm(b *testing.B, cfg Config) {
+	c := start(b, cfg)
+	names := make([]string, cfg.entries())
+	for i := range names {
+		names[i] = fmt.Sprintf("file%06d", i)
+		f, err := c.create(names[i])
+		if err != nil {
+			b.Fatalf("create: %v", err)
+		}
+		if err := f.close(); err != nil {
+			b.Fatalf("close: %v", err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.stat(names[i%len(names)]); err != nil {
+			b.Fatalf("stat: %v", err)
+		}
+	}
+}
+
+// ReadDir measures listing a large directory. Each iteration lists it in
+// full.
+func ReadDir(b *testing.B, cfg Config) {
+	c := start(b, cfg)
+	if err := c.mkdir("dir"); err != nil {
+		b.Fatalf("mkdir: %v", err)
+	}
+	for i := 0; i < cfg.entries(); i++ {
+		f, err := c.create(fmt.Sprintf("dir/file%06d", i))
+		if err != nil {
+			b.Fatalf("create: %v", err)
+		}
+		if err := f.close(); err != nil {
+			b.Fatalf("close: %v", err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n, err := c.readDir("dir")
+		if err != nil {
+			b.Fatalf("readDir: %v", err)
+		}
+		if n < cfg.entries() {
+			b.Fatalf("listed %d entries, expected %d", n, cfg.entries())
+		}
+	}
+	b.ReportMetric(float64(cfg.entries()), "entries/op")
+}
+
+// Return the offsets of the blocks of the file to visit, in order.
+func blockOffsets(cfg Config, random bool) []int64 {
+	n := max(cfg.fileSize()/int64(cfg.blockSize()), 1)
+	offsets := make([]int64, n)
+	for i := range offsets {
+		offsets[i] = int64(i) * int64(cfg.blockSize())
+	}
+
+	if random {
+		r := rand.New(rand.NewSource(1))
+		r.Shuffle(len(offsets), func(i, j int) { offsets[i], offsets[j] = offsets[j], offsets[i] })
+	}
+
+	return offsets
+}
+
+func benchWrite(b *testing.B, cfg Config, random bool) {
+	c := start(b, cfg)
+	f, err := c.create("file")
+	if err != nil {
+		b.Fatalf("create: %v", err)
+	}
+	defer f.close()
+
+	buf := make([]byte, cfg.blockSize())
+	offsets := blockOffsets(cfg, random)
+
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := f.writeAt(buf, offsets[i%len(offsets)]); err != nil {
+			b.Fatalf("write: %v", err)
+		}
+	}
+}
+
+func benchRead(b *testing.B, cfg Config, random bool) {
+	c := start(b, cfg)
+	f, err := c.create("file")
+	if err != nil {
+		b.Fatalf("create: %v", err)
+	}
+	defer f.close()
+
+	// Fill the file first.
+	buf := make([]byte, cfg.blockSize())
+	offsets := blockOffsets(cfg, random)
+	for _, off := range offsets {
+		if err := f.writeAt(buf, off); err != nil {
+			b.Fatalf("write: %v", err)
+		}
+	}
+
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n, err := f.readAt(buf, offsets[i%len(offsets)])
+		if err != nil {
+			b.Fatalf("read: %v", err)
+		}
+		if n != len(buf) {
+			b.Fatalf("short read of %d bytes", n)
+		}
+	}
+}
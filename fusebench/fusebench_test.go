@@ -0,0 +1,60 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fusebench_test
+
+import (
+	"flag"
+	"runtime"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fusebench"
+	"github.com/jacobsa/fuse/samples/memfs"
+)
+
+func TestBenchmarksInProcess(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the in-process transport requires Linux")
+	}
+
+	// Run each benchmark just enough to show that it works.
+	benchtime := flag.Lookup("test.benchtime")
+	defer benchtime.Value.Set(benchtime.Value.String())
+	benchtime.Value.Set("10x")
+
+	cfg := fusebench.Config{
+		NewServer: func() fuse.Server { return memfs.NewMemFS(0, 0) },
+		FileSize:  64 << 10,
+		BlockSize: 4 << 10,
+		Entries:   300,
+	}
+
+	for _, bm := range fusebench.Benchmarks {
+		t.Run(bm.Name, func(t *testing.T) {
+			r := testing.Benchmark(func(b *testing.B) { bm.Run(b, cfg) })
+			if r.N == 0 {
+				t.Fatalf("benchmark failed")
+			}
+		})
+	}
+}
+
+func BenchmarkMemFS(b *testing.B) {
+	fusebench.Run(b, fusebench.Config{
+		NewServer: func() fuse.Server { return memfs.NewMemFS(0, 0) },
+		FileSize:  16 << 20,
+		Entries:   1000,
+	})
+}
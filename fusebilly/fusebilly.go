@@ -0,0 +1,296 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fusebilly serves go-billy (https://github.com/go-git/go-billy) file
+// systems through FUSE.
+//
+// The package is a module of its own, so that only programs that use it
+// depend on go-billy.
+package fusebilly
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fusepath"
+)
+
+// NewServer returns a server that serves the billy file system.
+func NewServer(bfs billy.Filesystem) fuse.Server {
+	return fusepath.NewServer(NewFileSystem(bfs))
+}
+
+// NewFileSystem returns a fusepath.FileSystem backed by the billy file
+// system, for use as a building block.
+//
+// Attributes other than the size can be changed only if bfs implements
+// billy.Change. Files that can't be opened for writing are opened for
+// reading only.
+func NewFileSystem(bfs billy.Filesystem) fusepath.FileSystem {
+	return &billyFS{bfs: bfs}
+}
+
+type billyFS struct {
+	bfs billy.Filesystem
+}
+
+var _ fusepath.FileSystem = &billyFS{}
+
+func (b *billyFS) Stat(
+	ctx context.Context,
+	path string) (fuseops.InodeAttributes, error) {
+	fi, err := b.bfs.Lstat(path)
+	if err != nil {
+		return fuseops.InodeAttributes{}, err
+	}
+
+	return fusepath.FileInfoAttributes(fi), nil
+}
+
+func (b *billyFS) ReadDir(
+	ctx context.Context,
+	path string) ([]fusepath.DirEntry, error) {
+	fis, err := b.bfs.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return fusepath.FileInfoEntries(fis), nil
+}
+
+func (b *billyFS) Open(
+	ctx context.Context,
+	path string) (fusepath.File, error) {
+	f, err := b.bfs.OpenFile(path, os.O_RDWR, 0)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		f, err = b.bfs.OpenFile(path, os.O_RDONLY, 0)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &billyFile{f: f}, nil
+}
+
+func (b *billyFS) Create(
+	ctx context.Context,
+	path string,
+	mode os.FileMode) (fusepath.File, error) {
+	f, err := b.bfs.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &billyFile{f: f}, nil
+}
+
+// Return the billy.Change implementation of the file system, or an error if
+// it doesn't have one.
+func (b *billyFS) change() (billy.Change, error) {
+	c, ok := b.bfs.(billy.Change)
+	if !ok {
+		return nil, fuse.ENOSYS
+	}
+
+	return c, nil
+}
+
+func (b *billyFS) SetAttributes(
+	ctx context.Context,
+	path string,
+	changes fusepath.AttributeChanges) error {
+	if changes.Size != nil {
+		f, err := b.bfs.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+
+		err = f.Truncate(int64(*changes.Size))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if changes.Mode != nil {
+		c, err := b.change()
+		if err != nil {
+			return err
+		}
+
+		if err := c.Chmod(path, *changes.Mode); err != nil {
+			return err
+		}
+	}
+
+	if changes.Uid != nil || changes.Gid != nil {
+		c, err := b.change()
+		if err != nil {
+			return err
+		}
+
+		uid, gid := -1, -1
+		if changes.Uid != nil {
+			uid = int(*changes.Uid)
+		}
+		if changes.Gid != nil {
+			gid = int(*changes.Gid)
+		}
+
+		if err := c.Lchown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+
+	if changes.Atime != nil || changes.Mtime != nil {
+		c, err := b.change()
+		if err != nil {
+			return err
+		}
+
+		fi, err := b.bfs.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		// billy has no notion of the access time, so leave it as the
+		// modification time unless told otherwise.
+		atime, mtime := fi.ModTime(), fi.ModTime()
+		if changes.Atime != nil {
+			atime = *changes.Atime
+		}
+		if changes.Mtime != nil {
+			mtime = *changes.Mtime
+		}
+
+		if err := c.Chtimes(path, atime, mtime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *billyFS) Mkdir(
+	ctx context.Context,
+	path string,
+	mode os.FileMode) error {
+	// billy can only create directories along with their parents, and doesn't
+	// complain if they exist.
+	if _, err := b.bfs.Lstat(path); err == nil {
+		return fuse.EEXIST
+	}
+
+	return b.bfs.MkdirAll(path, mode)
+}
+
+func (b *billyFS) Symlink(
+	ctx context.Context,
+	target string,
+	path string) error {
+	return b.bfs.Symlink(target, path)
+}
+
+func (b *billyFS) Readlink(
+	ctx context.Context,
+	path string) (string, error) {
+	return b.bfs.Readlink(path)
+}
+
+func (b *billyFS) Remove(
+	ctx context.Context,
+	path string) error {
+	return b.bfs.Remove(path)
+}
+
+func (b *billyFS) Rmdir(
+	ctx context.Context,
+	path string) error {
+	// Not all billy file systems refuse to remove directories that aren't
+	// empty.
+	fis, err := b.bfs.ReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	if len(fis) != 0 {
+		return fuse.ENOTEMPTY
+	}
+
+	return b.bfs.Remove(path)
+}
+
+func (b *billyFS) Rename(
+	ctx context.Context,
+	oldPath string,
+	newPath string) error {
+	return b.bfs.Rename(oldPath, newPath)
+}
+
+// billyFile implements fusepath.File on top of a billy.File.
+type billyFile struct {
+	f billy.File
+
+	// Held while seeking and writing, for files that don't implement
+	// io.WriterAt.
+	mu sync.Mutex
+}
+
+func (f *billyFile) ReadAt(
+	ctx context.Context,
+	p []byte,
+	off int64) (int, error) {
+	return f.f.ReadAt(p, off)
+}
+
+func (f *billyFile) WriteAt(
+	ctx context.Context,
+	p []byte,
+	off int64) (int, error) {
+	if w, ok := f.f.(io.WriterAt); ok {
+		return w.WriteAt(p, off)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.f.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return f.f.Write(p)
+}
+
+func (f *billyFile) Sync(ctx context.Context) error {
+	if s, ok := f.f.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+
+	return nil
+}
+
+func (f *billyFile) Close() error {
+	return f.f.Close()
+}
@@ -0,0 +1,85 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fusebilly_test
+
+import (
+	"context"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/jacobsa/fuse/fusebilly"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+func TestServer(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the in-process transport requires Linux")
+	}
+
+	mem := memfs.New()
+	ctx := context.Background()
+	k, err := fakekernel.Start(fusebilly.NewServer(mem), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	mkDir := &fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "dir", Mode: 0755}
+	if err := k.Do(ctx, mkDir); err != nil {
+		t.Fatalf("MkDir: %v", err)
+	}
+	again := &fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "dir", Mode: 0755}
+	if err := k.Do(ctx, again); err != syscall.EEXIST {
+		t.Errorf("MkDir of existing directory: %v, want EEXIST", err)
+	}
+
+	create := &fuseops.CreateFileOp{Parent: mkDir.Entry.Child, Name: "file", Mode: 0644}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	for _, w := range []struct {
+		off  int64
+		data string
+	}{{4, "ito"}, {0, "burr"}} {
+		write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Offset: w.off, Data: []byte(w.data)}
+		if err := k.Do(ctx, write); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	if err := k.Do(ctx, &fuseops.ReleaseFileHandleOp{Handle: create.Handle}); err != nil {
+		t.Fatalf("ReleaseFileHandle: %v", err)
+	}
+
+	if got, err := util.ReadFile(mem, "dir/file"); err != nil || string(got) != "burrito" {
+		t.Errorf("util.ReadFile: %q, %v", got, err)
+	}
+
+	symlink := &fuseops.CreateSymlinkOp{Parent: fuseops.RootInodeID, Name: "link", Target: "dir/file"}
+	if err := k.Do(ctx, symlink); err != nil {
+		t.Fatalf("CreateSymlink: %v", err)
+	}
+	readlink := &fuseops.ReadSymlinkOp{Inode: symlink.Entry.Child}
+	if err := k.Do(ctx, readlink); err != nil || readlink.Target != "dir/file" {
+		t.Errorf("ReadSymlink: %q, %v", readlink.Target, err)
+	}
+
+	if err := k.Do(ctx, &fuseops.RmDirOp{Parent: fuseops.RootInodeID, Name: "dir"}); err != syscall.ENOTEMPTY {
+		t.Errorf("RmDir of non-empty directory: %v, want ENOTEMPTY", err)
+	}
+}
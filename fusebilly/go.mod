@@ -0,0 +1,17 @@
+module github.com/jacobsa/fuse/fusebilly
+
+go 1.23.0
+
+require (
+	github.com/go-git/go-billy/v5 v5.5.0
+	github.com/jacobsa/fuse v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/jacobsa/oglematchers v0.0.0-20150720000706-141901ea67cd // indirect
+	github.com/jacobsa/timeutil v0.0.0-20170205232429-577e5acbbcf6 // indirect
+	github.com/rogpeppe/go-internal v1.13.1 // indirect
+	golang.org/x/sys v0.31.0 // indirect
+)
+
+replace github.com/jacobsa/fuse => ../
@@ -15,6 +15,7 @@
 package fuseops
 
 import (
+	"io"
 	"os"
 	"time"
 
@@ -38,6 +39,11 @@ type OpContext struct {
 	// UID of the process that is invoking the operation.
 	// Not filled in case of a writepage operation.
 	Uid uint32
+
+	// GID of the process that is invoking the operation. The kernel doesn't
+	// pass its supplementary groups.
+	// Not filled in case of a writepage operation.
+	Gid uint32
 }
 
 // Return statistics about the file system's capacity and available resources.
@@ -57,6 +63,11 @@ type OpContext struct {
 // This op is particularly important on OS X: if you don't implement it, the
 // file system will not successfully mount. If you don't model a sane amount of
 // free space, the Finder will refuse to copy files into the file system.
+//
+// The fields of statfs(2) that aren't set here are filled in by the kernel,
+// and the protocol has no way to set them: f_type is FUSE_SUPER_MAGIC,
+// f_fsid identifies the mount rather than the file system, and f_flags
+// reflects the mount options, such as fuse.MountConfig.ReadOnly.
 type StatFSOp struct {
 	// The size of the file system's blocks. This may be used, in combination
 	// with the block counts below,  by callers of statfs(2) to infer the file
@@ -108,6 +119,12 @@ type StatFSOp struct {
 	// The total number of inodes in the file system, and how many remain free.
 	Inodes     uint64
 	InodesFree uint64
+
+	// The maximum length in bytes of a file name, surfaced as statfs::f_namelen
+	// on Linux and by pathconf(3) as _PC_NAME_MAX. If zero, 255 is used, which
+	// is the limit of the kernel's own dentry cache on Linux, so larger values
+	// are of no use there.
+	NameMaxLength uint32
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -129,6 +146,11 @@ type LookUpInodeOp struct {
 	//
 	// the file system may receive a request to look up the child named "bar" for
 	// the parent foo/.
+	//
+	// If fuse.MountConfig.EnableExportSupport is set, the name may also be "."
+	// to look up Parent itself, or ".." to look up its parent directory. The
+	// kernel does this to resolve file handles for inodes that it no longer
+	// has cached.
 	Name string
 
 	// The resulting entry. Must be filled out by the file system.
@@ -147,6 +169,12 @@ type GetInodeAttributesOp struct {
 	// The inode of interest.
 	Inode InodeID
 
+	// If set, the attributes are wanted through this handle, previously
+	// returned by CreateFile or OpenFile, as for fstat(2) on a regular file.
+	// File systems where an open handle pins a particular version of a file
+	// should return the attributes of that version.
+	Handle *HandleID
+
 	// Set by the file system: attributes for the inode, and the time at which
 	// they should expire. See notes on ChildInodeEntry.AttributesExpiration for
 	// more.
@@ -155,6 +183,49 @@ type GetInodeAttributesOp struct {
 	OpContext            OpContext
 }
 
+// Get the attributes of an inode for statx(2), which unlike stat(2) can
+// return the time at which the inode was created, and flags such as
+// STATX_ATTR_IMMUTABLE. The kernel sends this rather than a
+// GetInodeAttributesOp when a caller of statx(2) asks for more than stat(2)
+// returns, and its cache doesn't have the answer. This requires Linux 6.6 or
+// later.
+//
+// If the file system returns ENOSYS, the kernel falls back to sending
+// GetInodeAttributesOps for the rest of the mount, and the extra fields are
+// reported as unavailable.
+type StatxOp struct {
+	// The inode of interest.
+	Inode InodeID
+
+	// If set, the attributes are wanted through this handle. See
+	// GetInodeAttributesOp.Handle.
+	Handle *HandleID
+
+	// The fields asked for by the caller, as a mask of unix.STATX_* values,
+	// and its synchronization flags, unix.AT_STATX_SYNC_AS_STAT,
+	// unix.AT_STATX_FORCE_SYNC, or unix.AT_STATX_DONT_SYNC. The file system
+	// may return more fields than asked for.
+	Mask  uint32
+	Flags uint32
+
+	// Set by the file system: attributes for the inode, and the time at which
+	// they should expire, as for GetInodeAttributesOp. The kernel caches them
+	// in the same way. Attributes.Crtime is returned as the birth time,
+	// unless it is zero, in which case the birth time is reported as
+	// unavailable.
+	Attributes           InodeAttributes
+	AttributesExpiration time.Time
+
+	// Set by the file system: unix.STATX_ATTR_* flags describing the inode,
+	// such as unix.STATX_ATTR_IMMUTABLE, and the mask of those flags that the
+	// file system supports, so that callers can tell a flag that is clear from
+	// one that isn't supported. The mount ID is filled in by the kernel.
+	StatxAttributes     uint64
+	StatxAttributesMask uint64
+
+	OpContext OpContext
+}
+
 // Change attributes for an inode.
 //
 // The kernel sends this for obvious cases like chmod(2), and for less obvious
@@ -163,9 +234,16 @@ type SetInodeAttributesOp struct {
 	// The inode of interest.
 	Inode InodeID
 
-	// If set, this is ftruncate(2), otherwise it's truncate(2)
+	// If set, the change is made through this handle, previously returned by
+	// CreateFile or OpenFile, as for ftruncate(2) or for truncation by
+	// open(2) with O_TRUNC. Otherwise it's made by path, as for truncate(2)
+	// or chmod(2).
 	Handle *HandleID
 
+	// Set if the file system must clear the setuid and setgid bits of the
+	// file as for WriteFileOp.KillSuidGid, as part of truncating it.
+	KillSuidGid bool
+
 	// The attributes to modify, or nil for attributes that don't need a change.
 	Uid   *uint32
 	Gid   *uint32
@@ -283,6 +361,15 @@ type MkDirOp struct {
 	Name string
 	Mode os.FileMode
 
+	// The umask of the process that made the request. Unless
+	// fuse.MountConfig.EnableDontMask or EnablePosixACL is set, the kernel has
+	// already applied it to Mode.
+	Umask os.FileMode
+
+	// If fuse.MountConfig.EnableSecurityContext is set, the security labels
+	// to give the new inode atomically with creating it. See SecurityContext.
+	SecurityContexts []SecurityContext
+
 	// Set by the file system: information about the inode that was created.
 	//
 	// The lookup count for the inode is implicitly incremented. See notes on
@@ -311,6 +398,15 @@ type MkNodeOp struct {
 	Name string
 	Mode os.FileMode
 
+	// The umask of the process that made the request. Unless
+	// fuse.MountConfig.EnableDontMask or EnablePosixACL is set, the kernel has
+	// already applied it to Mode.
+	Umask os.FileMode
+
+	// If fuse.MountConfig.EnableSecurityContext is set, the security labels
+	// to give the new inode atomically with creating it. See SecurityContext.
+	SecurityContexts []SecurityContext
+
 	// The device number (only valid if created file is a device)
 	Rdev uint32
 
@@ -340,6 +436,15 @@ type CreateFileOp struct {
 	Name string
 	Mode os.FileMode
 
+	// The umask of the process that made the request. Unless
+	// fuse.MountConfig.EnableDontMask or EnablePosixACL is set, the kernel has
+	// already applied it to Mode.
+	Umask os.FileMode
+
+	// If fuse.MountConfig.EnableSecurityContext is set, the security labels
+	// to give the new inode atomically with creating it. See SecurityContext.
+	SecurityContexts []SecurityContext
+
 	// Set by the file system: information about the inode that was created.
 	//
 	// The lookup count for the inode is implicitly incremented. See notes on
@@ -357,6 +462,56 @@ type CreateFileOp struct {
 	Handle    HandleID
 	OpContext OpContext
 
+	// Set by the file system: a backing file for the new handle, as for
+	// OpenFileOp.BackingID.
+	BackingID BackingID
+
+	// Set by the file system: flags controlling how the kernel treats the new
+	// handle, as for OpenFileOp.ResponseFlags.
+	ResponseFlags OpenResponseFlags
+
+	// The flags from the open(2) call, passed through the kernel's fuse driver
+	// to the FUSE daemon.
+	OpenFlags fusekernel.OpenFlags
+}
+
+// Create an unnamed file inode and open it, in response to open(2) with the
+// O_TMPFILE flag (Linux 6.1 and later).
+//
+// The file has no name and a link count of zero until the user gives it one
+// with linkat(2), which the kernel turns into a CreateLinkOp. If that doesn't
+// happen, the file should be destroyed once its handles have been released
+// and the kernel has forgotten the inode. If the file system returns ENOSYS,
+// the kernel doesn't send this op again and fails such opens with EOPNOTSUPP.
+type CreateTmpFileOp struct {
+	// The ID of the directory inode in whose file system to create the file,
+	// and the mode with which to create it.
+	Parent InodeID
+	Mode   os.FileMode
+
+	// The umask of the process that made the request, as for
+	// CreateFileOp.Umask.
+	Umask os.FileMode
+
+	// If fuse.MountConfig.EnableSecurityContext is set, the security labels
+	// to give the new inode atomically with creating it. See SecurityContext.
+	SecurityContexts []SecurityContext
+
+	// Set by the file system: information about the inode that was created.
+	//
+	// The lookup count for the inode is implicitly incremented. See notes on
+	// ForgetInodeOp for more information.
+	Entry ChildInodeEntry
+
+	// Set by the file system: an opaque ID for the open file, as for
+	// CreateFileOp.Handle.
+	Handle    HandleID
+	OpContext OpContext
+
+	// Set by the file system: flags controlling how the kernel treats the new
+	// handle, as for OpenFileOp.ResponseFlags.
+	ResponseFlags OpenResponseFlags
+
 	// The flags from the open(2) call, passed through the kernel's fuse driver
 	// to the FUSE daemon.
 	OpenFlags fusekernel.OpenFlags
@@ -374,6 +529,10 @@ type CreateSymlinkOp struct {
 	// The target of the symlink.
 	Target string
 
+	// If fuse.MountConfig.EnableSecurityContext is set, the security labels
+	// to give the new inode atomically with creating it. See SecurityContext.
+	SecurityContexts []SecurityContext
+
 	// Set by the file system: information about the symlink inode that was
 	// created.
 	//
@@ -451,6 +610,13 @@ type RenameOp struct {
 	// overwritten within it.
 	NewParent InodeID
 	NewName   string
+
+	// Flags from renameat2(2). See the notes on RenameFlags for what each asks
+	// of the file system. File systems should return EINVAL for flags, or
+	// combinations of them, that they don't support.
+	//
+	// This is always zero unless fuse.MountConfig.EnableRenameFlags is set.
+	Flags     RenameFlags
 	OpContext OpContext
 }
 
@@ -493,6 +659,11 @@ type UnlinkOp struct {
 // with type directory, usually in response to an open(2) call from a
 // user-space process. On OS X it may not be sent for every open(2) (cf.
 // https://github.com/osxfuse/osxfuse/issues/199).
+//
+// If fuse.MountConfig.EnableNoOpendirSupport is set and the file system
+// returns ENOSYS, the kernel stops sending this op and ReleaseDirHandleOp for
+// the rest of the mount, and treats every directory as opened successfully
+// with handle zero.
 type OpenDirOp struct {
 	// The ID of the inode to be opened.
 	Inode InodeID
@@ -515,6 +686,11 @@ type OpenDirOp struct {
 
 	// KeepCache instructs the kernel to not invalidate the data cache on open calls.
 	KeepCache bool
+
+	// Set by the file system: flags controlling how the kernel treats the
+	// handle. CacheDir and KeepCache are equivalent to OpenCacheDir and
+	// OpenKeepCache here.
+	ResponseFlags OpenResponseFlags
 }
 
 // Read entries from a directory previously opened with OpenDir.
@@ -647,6 +823,12 @@ type ReleaseDirHandleOp struct {
 // with type file, usually in response to an open(2) call from a user-space
 // process. On OS X it may not be sent for every open(2)
 // (cf.https://github.com/osxfuse/osxfuse/issues/199).
+//
+// If fuse.MountConfig.EnableNoOpenSupport is set and the file system returns
+// ENOSYS, the kernel stops sending this op, FlushFileOp and
+// ReleaseFileHandleOp for the rest of the mount, and treats every file as
+// opened successfully with handle zero. This suits stateless file systems,
+// saving a round trip for each open(2).
 type OpenFileOp struct {
 	// The ID of the inode to be opened.
 	Inode InodeID
@@ -685,10 +867,38 @@ type OpenFileOp struct {
 	// advance, for example, because contents are generated on the fly.
 	UseDirectIO bool
 
+	// Set by the file system: flags controlling how the kernel treats the
+	// handle, for file systems that need different caching or seeking behavior
+	// for different files. KeepPageCache and UseDirectIO are equivalent to
+	// OpenKeepCache and OpenDirectIO here.
+	ResponseFlags OpenResponseFlags
+
+	// If fuse.MountConfig.EnablePassthrough is set, the file system may set
+	// this to a backing file registered with
+	// fuse.MountedFileSystem.OpenBackingFile. The kernel then reads from and
+	// writes to that file directly for this handle, without sending
+	// ReadFileOps and WriteFileOps.
+	//
+	// All handles open on an inode at the same time must use the same backing
+	// ID, or none; the kernel fails the open otherwise.
+	BackingID BackingID
+
 	// The flags from the open(2) call, passed through the kernel's fuse driver
 	// to the FUSE daemon.
+	//
+	// OpenTruncate is only ever set if fuse.MountConfig.EnableAtomicTrunc is
+	// set. In that case the file system must truncate the file to zero length
+	// as part of opening it, since the kernel sends no SetInodeAttributesOp
+	// for the truncation, and afterward takes the file's size to be zero.
+	// Without it, the kernel clears the flag and truncates with a separate
+	// SetInodeAttributesOp once the open has succeeded.
 	OpenFlags fusekernel.OpenFlags
 
+	// Set if the file system must clear the setuid and setgid bits of the
+	// file as for WriteFileOp.KillSuidGid, as part of truncating it for
+	// OpenTruncate.
+	KillSuidGid bool
+
 	OpContext OpContext
 }
 
@@ -730,6 +940,29 @@ type ReadFileOp struct {
 	//
 	// If direct IO is enabled, semantics should match those of read(2).
 	BytesRead int
+
+	// Set by the file system: a file from which to take the data to send back,
+	// starting at SpliceOffset, in place of Dst or Data. BytesRead gives the
+	// number of bytes to send, and is reduced if the file ends first.
+	//
+	// If fuse.MountConfig.EnableSplice is set and the kernel supports it, the
+	// data is spliced from the file to the kernel through a pipe without being
+	// copied through user space. Otherwise it is read from the file into Dst.
+	// Either way this happens after the op returns, before Callback is invoked.
+	SpliceFile   *os.File
+	SpliceOffset int64
+
+	// Set by the file system: a reader from which to take the data to send
+	// back, in place of Dst or Data. After the op returns, and before Callback
+	// is invoked, up to Size bytes are read from it directly into the buffer
+	// that is sent to the kernel, saving the file system a copy through a
+	// buffer of its own. BytesRead is set to the number of bytes read, which is
+	// less than Size only if the reader reaches EOF first, and Dst to the data.
+	//
+	// An error other than EOF becomes the error for the op, as if it had been
+	// returned by the file system.
+	Reader io.Reader
+
 	OpContext OpContext
 
 	// If set, this function will be invoked after the operation response has been
@@ -798,6 +1031,24 @@ type WriteFileOp struct {
 	Data      []byte
 	OpContext OpContext
 
+	// Set if the file system must clear the setuid bit of the file, and its
+	// setgid bit if it is group-executable, as part of the write, because the
+	// writer isn't privileged. This is only ever set if
+	// fuse.MountConfig.EnableHandleKillPriv is set; see there. It is the same
+	// as WriteKillSuidGid in Flags.
+	KillSuidGid bool
+
+	// Flags describing where the write comes from. See WriteFlags.
+	Flags WriteFlags
+
+	// The flags with which the handle was opened, such as OpenAppend. For a
+	// write to a file opened with O_APPEND, the kernel sets Offset to the
+	// size of the file as it knows it; file systems whose files may grow
+	// behind the kernel's back can use this to append at the true end
+	// instead. Writes with WriteCache set may come from any handle open for
+	// writing on the inode.
+	OpenFlags fusekernel.OpenFlags
+
 	// If set, this function will be invoked after the operation response has been
 	// sent to the kernel and before the buffers containing the response data are
 	// freed.
@@ -880,8 +1131,17 @@ type SyncFileOp struct {
 // return any errors that occur.
 type FlushFileOp struct {
 	// The file and handle being flushed.
-	Inode     InodeID
-	Handle    HandleID
+	Inode  InodeID
+	Handle HandleID
+
+	// An opaque ID for the owner of the file descriptor being closed: in
+	// practice, the file descriptor table of the calling process. POSIX
+	// record locks (fcntl(2) F_SETLK) belong to such owners, and close(2)
+	// releases all those that the owner holds on the file, whichever file
+	// descriptor they were taken through. File systems that implement such
+	// locks themselves should release those held by LockOwner on Inode here.
+	LockOwner uint64
+
 	OpContext OpContext
 }
 
@@ -898,7 +1158,17 @@ type ReleaseFileHandleOp struct {
 	// The handle ID to be released. The kernel guarantees that this ID will not
 	// be used in further calls to the file system (unless it is reissued by the
 	// file system).
-	Handle    HandleID
+	Handle HandleID
+
+	// If fuse.MountConfig.EnableFlockLocks is set and a flock(2) lock was taken
+	// through this handle, FlockUnlock is set and the file system should
+	// release any such lock held by LockOwner, the owner given in FlockOp.
+	// The kernel does not send a separate FlockOp for this. LockOwner is zero
+	// if FlockUnlock is not set; POSIX record locks are instead released when
+	// the file is flushed, as described for FlushFileOp.LockOwner.
+	FlockUnlock bool
+	LockOwner   uint64
+
 	OpContext OpContext
 }
 
@@ -1009,12 +1279,155 @@ type FallocateOp struct {
 	// Length of the byte range
 	Length uint64
 
-	// If Mode is 0x0, allocate disk space within the range specified
-	// If Mode has 0x1, allocate the space but don't increase the file size
-	// If Mode has 0x2, deallocate space within the range specified
-	// If Mode has 0x2, it sbould also have 0x1 (deallocate should not increase
-	// file size)
-	Mode      uint32
+	// What to do with the range; see FallocateMode for the flags the kernel
+	// sends. File systems should return EOPNOTSUPP for modes they don't
+	// support, rather than ENOSYS, which makes the kernel stop sending
+	// FallocateOps at all.
+	Mode      FallocateMode
+	OpContext OpContext
+}
+
+// Copy a range of bytes from one open file to another, or to another offset
+// within the same file, without the data passing through the kernel.
+//
+// This is sent for copy_file_range(2) (https://tinyurl.com/2p8zwyd5), if both
+// files are on this file system. If the file system returns ENOSYS, the
+// kernel stops sending it for the life of the mount and instead falls back to
+// reading and writing the data itself, as it does for any other error that
+// copy_file_range(2) may be emulated for.
+type CopyFileRangeOp struct {
+	// The file to copy from, the handle previously returned by CreateFile or
+	// OpenFile when opening it, and the offset at which to start reading.
+	SrcInode  InodeID
+	SrcHandle HandleID
+	SrcOffset uint64
+
+	// The file to copy to, its handle, and the offset at which to start
+	// writing. As with WriteFileOp, writing beyond the end of the file extends
+	// it.
+	DstInode  InodeID
+	DstHandle HandleID
+	DstOffset uint64
+
+	// The number of bytes to copy.
+	Length uint64
+
+	// Flags passed to copy_file_range(2). There are currently none defined, so
+	// this is always zero.
+	Flags uint64
+
+	// Set by the file system: the number of bytes actually copied, which may be
+	// less than Length if the source ends early.
+	BytesCopied uint64
+
+	OpContext OpContext
+}
+
+// Find the next data or hole in an open file at or after a given offset.
+//
+// This is sent for lseek(2) with SEEK_DATA or SEEK_HOLE; the kernel handles
+// the other values of whence itself. If the file system returns ENOSYS, the
+// kernel stops sending it for the life of the mount and treats every file as
+// containing data throughout, followed by a hole at its end.
+type SeekFileOp struct {
+	// The file and the handle previously returned by CreateFile or OpenFile
+	// when opening it.
+	Inode  InodeID
+	Handle HandleID
+
+	// The offset at which to start looking, and what to look for: unix.SEEK_DATA
+	// or unix.SEEK_HOLE.
+	Offset int64
+	Whence int
+
+	// Set by the file system: the offset of the start of the data or hole
+	// found. The end of the file counts as a hole. If there is no data at or
+	// after Offset, or if Offset is beyond the end of the file, the file
+	// system should return ENXIO instead.
+	ResultOffset int64
+
+	OpContext OpContext
+}
+
+// Check whether the calling process may access an inode, as for access(2)
+// and chdir(2). The file system should return EACCES to deny access.
+//
+// This is sent only if fuse.MountConfig.DisableDefaultPermissions is set;
+// otherwise the kernel checks permissions against the inode's attributes
+// itself. If the file system returns ENOSYS, the kernel stops sending it for
+// the life of the mount and lets every such check succeed.
+type AccessOp struct {
+	// The inode to check.
+	Inode InodeID
+
+	// The access to check for, as a mask of unix.R_OK, unix.W_OK, and
+	// unix.X_OK, or unix.F_OK (zero) to check only that the inode exists.
+	Mask uint32
+
+	OpContext OpContext
+}
+
+// Ask which I/O events are ready on an open file, as for poll(2), select(2),
+// and epoll(7).
+//
+// If ScheduleNotify is set, the kernel wants to be told when the readiness of
+// the file changes, so that it can wake up waiters without polling again: the
+// file system should remember PollHandle and pass it to
+// fuse.Notifier.PollWakeup when that happens. Each wakeup consumes the
+// handle; the kernel polls again with a fresh one if it is still interested.
+//
+// If the file system returns ENOSYS, the kernel stops sending this for the
+// life of the mount and treats every file as always readable and writable.
+type PollOp struct {
+	// The file and the handle previously returned by CreateFile or OpenFile
+	// when opening it.
+	Inode  InodeID
+	Handle HandleID
+
+	// An identifier chosen by the kernel for this poll request, for use with
+	// fuse.Notifier.PollWakeup if ScheduleNotify is set.
+	PollHandle     uint64
+	ScheduleNotify bool
+
+	// The events that the caller is interested in, as a mask of unix.POLLIN,
+	// unix.POLLOUT and friends.
+	Events uint32
+
+	// Set by the file system: the events that are ready, as a mask of the same
+	// constants.
+	Revents uint32
+
+	OpContext OpContext
+}
+
+// Acquire, convert, or release a BSD-style advisory lock on a whole open file,
+// as for flock(2). This is sent only if fuse.MountConfig.EnableFlockLocks is
+// set; otherwise the kernel implements such locks itself, and they are not
+// visible to other clients of the file system.
+//
+// Locks belong to an open file description, identified by Owner, rather than
+// to a process: a lock is shared by duplicated file descriptors and inherited
+// across fork(2). A request by an owner that already holds a lock converts
+// it. Locks still held when the file is closed are released by the
+// ReleaseFileHandleOp; see its FlockUnlock field.
+type FlockOp struct {
+	// The file and the handle previously returned by CreateFile or OpenFile
+	// when opening it.
+	Inode  InodeID
+	Handle HandleID
+
+	// An opaque identifier for the open file description taking the lock.
+	Owner uint64
+
+	// What to do: unix.LOCK_SH, unix.LOCK_EX, or unix.LOCK_UN.
+	Operation int
+
+	// If set, the file system should wait until the lock can be granted,
+	// returning EINTR if the op's context is cancelled first. Otherwise it
+	// should return EAGAIN if the lock conflicts with one held by another
+	// owner.
+	Block bool
+
 	OpContext OpContext
 }
 
@@ -1022,3 +1435,16 @@ type SyncFSOp struct {
 	Inode     InodeID
 	OpContext OpContext
 }
+
+// Tear down the file system, because it is being unmounted. The kernel waits
+// for the reply before it completes the unmount, and sends no further ops
+// afterward, so this is the place to flush state that must be durable once
+// umount(2) returns.
+//
+// Linux sends this only for file systems mounted on a block device (with
+// "fuseblk"); otherwise the connection is simply closed on unmount. Servers
+// built with fuseutil.NewFileSystemServer handle it by calling
+// FileSystem.Destroy.
+type DestroyOp struct {
+	OpContext OpContext
+}
@@ -114,7 +114,9 @@ func (a *InodeAttributes) DebugString() string {
 // GenerationNumber represents a generation of an inode. It is irrelevant for
 // file systems that won't be exported over NFS. For those that will and that
 // reuse inode IDs when they become free, the generation number must change
-// when an ID is reused.
+// when an ID is reused, since the kernel includes it in the file handles that
+// it gives out, and fails those whose generation no longer matches with
+// ESTALE. See fuse.MountConfig.EnableExportSupport.
 //
 // This corresponds to struct inode::i_generation in the VFS layer.
 // (https://tinyurl.com/23sr9svd)
@@ -134,6 +136,11 @@ type GenerationNumber uint64
 // This corresponds to fuse_file_info::fh.
 type HandleID uint64
 
+// BackingID identifies a file registered with the kernel by
+// fuse.MountedFileSystem.OpenBackingFile, to which the kernel can pass the
+// I/O for a file opened with OpenFileOp or CreateFileOp. Zero means none.
+type BackingID int32
+
 // DirOffset is an offset into an open directory handle. This is opaque to
 // FUSE, and can be used for whatever purpose the file system desires. See
 // notes on ReadDirOp.Offset for details.
@@ -227,3 +234,114 @@ type ChildInodeEntry struct {
 	// default. See notes on MountConfig.EnableVnodeCaching for more.
 	EntryExpiration time.Time
 }
+
+// RenameFlags are the flags that may be passed to renameat2(2) on Linux, as
+// found in RenameOp.Flags.
+type RenameFlags uint32
+
+const (
+	// Don't overwrite the new name; fail with EEXIST if it exists.
+	RenameNoReplace RenameFlags = 1 << 0
+
+	// Atomically exchange the old and new names, both of which must exist.
+	RenameExchange RenameFlags = 1 << 1
+
+	// Leave a whiteout object in place of the old name, for overlay and union
+	// file systems.
+	RenameWhiteout RenameFlags = 1 << 2
+)
+
+// SecurityContext is a security label, such as an SELinux context, that the
+// kernel asks the file system to give a new inode as it is created. It is
+// to be stored as the value of the extended attribute with the given name,
+// e.g. "security.selinux".
+type SecurityContext struct {
+	Name  string
+	Value []byte
+}
+
+// OpenResponseFlags control how the kernel treats a file or directory handle
+// returned by OpenFileOp, OpenDirOp, CreateFileOp, or CreateTmpFileOp. Those
+// marked Linux only are ignored elsewhere.
+type OpenResponseFlags uint32
+
+const (
+	// Bypass the page cache for the handle, sending every read and write to
+	// the file system. See OpenFileOp.UseDirectIO.
+	OpenDirectIO OpenResponseFlags = 1 << 0
+
+	// Don't invalidate the page cache for the inode when opening the handle.
+	// See OpenFileOp.KeepPageCache and OpenDirOp.KeepCache.
+	OpenKeepCache OpenResponseFlags = 1 << 1
+
+	// The handle doesn't support seeking, so that pread(2) and pwrite(2) fail
+	// with ESPIPE. Linux only.
+	OpenNonSeekable OpenResponseFlags = 1 << 2
+
+	// For directories, let the kernel cache the entries returned by
+	// ReadDirOp. See OpenDirOp.CacheDir.
+	OpenCacheDir OpenResponseFlags = 1 << 3
+
+	// The handle is stream-like, with no file position at all, as for pipes
+	// and sockets. This implies OpenNonSeekable. Linux only.
+	OpenStream OpenResponseFlags = 1 << 4
+
+	// Don't send a FlushFileOp when the handle is closed, unless writeback
+	// caching is enabled. Linux only.
+	OpenNoFlush OpenResponseFlags = 1 << 5
+
+	// With OpenDirectIO, let the kernel send WriteFileOps on the inode that
+	// don't extend the file concurrently. Linux only.
+	OpenParallelDirectWrites OpenResponseFlags = 1 << 6
+)
+
+// The flags have the same values as the kernel's.
+func (fl OpenResponseFlags) String() string {
+	return fusekernel.OpenResponseFlags(fl).String()
+}
+
+// FallocateMode holds the flags passed to fallocate(2), as found in
+// FallocateOp.Mode. The zero value asks for the range to be allocated,
+// extending the file if it ends beyond the end of the file.
+//
+// Linux sends only FallocateKeepSize, FallocatePunchHole, and
+// FallocateZeroRange, failing fallocate(2) calls with other flags with
+// EOPNOTSUPP without sending them. The remaining flags are defined so that
+// file systems can recognize and reject them should that change.
+type FallocateMode uint32
+
+const (
+	// Don't change the size of the file, even if the range extends past its
+	// end.
+	FallocateKeepSize FallocateMode = 0x01
+
+	// Deallocate the range, so that it reads back as zeroes. Always combined
+	// with FallocateKeepSize.
+	FallocatePunchHole FallocateMode = 0x02
+
+	// Remove the range from the file, shifting the data after it down.
+	FallocateCollapseRange FallocateMode = 0x08
+
+	// Zero the range, allocating it if need be, and extend the file if it ends
+	// beyond its end unless FallocateKeepSize is also set.
+	FallocateZeroRange FallocateMode = 0x10
+
+	// Insert a hole of the range's length at its offset, shifting the data
+	// after it up.
+	FallocateInsertRange FallocateMode = 0x20
+)
+
+// WriteFlags describe a WriteFileOp, as found in its Flags field.
+type WriteFlags uint32
+
+const (
+	// The write is of dirty pages from the page cache, as happens unless
+	// fuse.MountConfig.DisableWritebackCaching is set, rather than directly
+	// from a write(2) call. The OpContext of such writes doesn't identify the
+	// process that wrote the data.
+	WriteCache WriteFlags = 1 << 0
+
+	// The file system must clear setuid and setgid as part of the write. See
+	// WriteFileOp.KillSuidGid.
+	WriteKillSuidGid WriteFlags = 1 << 2
+)
@@ -0,0 +1,185 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fuseotel exports FUSE ops as OpenTelemetry spans.
+//
+// Install the tracer with fuse.MountConfig.OpTracer:
+//
+//	cfg := &fuse.MountConfig{
+//		OpTracer: fuseotel.NewOpTracer(otel.Tracer("my-fs")),
+//	}
+//
+// Each op becomes a span named after the op type (e.g. "fuse.LookUpInodeOp").
+// The span is stored in the context handed to the file system, so spans
+// started by the file system while handling the op (for example for backend
+// RPCs) are its children.
+//
+// The package is a module of its own, so that only programs that use it
+// depend on the OpenTelemetry SDK.
+package fuseotel
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys set on each span.
+const (
+	OperationKey = attribute.Key("fuse.operation")
+	FuseIDKey    = attribute.Key("fuse.fuse_id")
+	PidKey       = attribute.Key("fuse.pid")
+	UidKey       = attribute.Key("fuse.uid")
+	ErrnoKey     = attribute.Key("fuse.errno")
+	ErrnoNameKey = attribute.Key("fuse.errno_name")
+	DurationKey  = attribute.Key("fuse.duration_ns")
+
+	// Set only if the server reports when its handler started; see
+	// fuse.MarkHandlerStart.
+	QueueDelayKey      = attribute.Key("fuse.queue_delay_ns")
+	HandlerDurationKey = attribute.Key("fuse.handler_duration_ns")
+
+	// Set only if the kernel interrupted the op.
+	InterruptedKey   = attribute.Key("fuse.interrupted")
+	CancelLatencyKey = attribute.Key("fuse.cancel_latency_ns")
+
+	// Set only if fuse.MountConfig.WireLogHandleSessions is set and the op is
+	// on an open handle.
+	HandleSessionKey = attribute.Key("fuse.handle_session")
+
+	// Entries of WireLogRecord.Extra are recorded with this prefix.
+	ExtraKeyPrefix = "fuse.extra."
+)
+
+// NewOpTracer returns a fuse.OpTracer that records each op as a span created
+// by the supplied tracer.
+//
+// If the op has a trace context attached (see fuse.MountConfig.WireLogTraceParent),
+// the span is made a child of it. The span's own context is then attached in
+// its place, so that the op's wire log record identifies the span.
+func NewOpTracer(tracer trace.Tracer) fuse.OpTracer {
+	return &opTracer{tracer: tracer}
+}
+
+type opTracer struct {
+	tracer trace.Tracer
+}
+
+func (t *opTracer) StartOp(ctx context.Context, op interface{}) context.Context {
+	var tc propagation.TraceContext
+	if tp := fuse.TraceParent(ctx); tp != "" {
+		ctx = tc.Extract(ctx, propagation.MapCarrier{"traceparent": tp})
+	}
+
+	name := reflect.TypeOf(op).Elem().Name()
+	ctx, span := t.tracer.Start(
+		ctx,
+		"fuse."+name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(OperationKey.String(name)))
+
+	if span.SpanContext().IsValid() {
+		carrier := propagation.MapCarrier{}
+		tc.Inject(ctx, carrier)
+		fuse.SetTraceParent(ctx, carrier.Get("traceparent"))
+	}
+
+	return ctx
+}
+
+func (t *opTracer) FinishOp(ctx context.Context, wlog *fuse.WireLogRecord) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		span.End()
+		return
+	}
+
+	attrs := []attribute.KeyValue{
+		ErrnoKey.Int(wlog.Status),
+		DurationKey.Int64(int64(wlog.Duration)),
+	}
+
+	if wlog.QueueDelay != 0 || wlog.HandlerDuration != 0 {
+		attrs = append(
+			attrs,
+			QueueDelayKey.Int64(int64(wlog.QueueDelay)),
+			HandlerDurationKey.Int64(int64(wlog.HandlerDuration)))
+	}
+
+	if wlog.Interrupted {
+		attrs = append(
+			attrs,
+			InterruptedKey.Bool(true),
+			CancelLatencyKey.Int64(int64(wlog.CancelLatency)))
+	}
+
+	if wlog.HandleSession != 0 {
+		attrs = append(attrs, HandleSessionKey.Int64(int64(wlog.HandleSession)))
+	}
+
+	if wlog.Context != nil {
+		attrs = append(
+			attrs,
+			FuseIDKey.Int64(int64(wlog.Context.FuseID)),
+			PidKey.Int64(int64(wlog.Context.Pid)),
+			UidKey.Int64(int64(wlog.Context.Uid)))
+	}
+
+	for k, v := range wlog.Extra {
+		attrs = append(attrs, extraAttribute(ExtraKeyPrefix+k, v))
+	}
+
+	span.SetAttributes(attrs...)
+
+	if wlog.Status != 0 {
+		span.SetAttributes(ErrnoNameKey.String(wlog.StatusName))
+		span.SetStatus(codes.Error, syscall.Errno(wlog.Status).Error())
+	}
+
+	span.End(trace.WithTimestamp(wlog.StartTime.Add(wlog.Duration)))
+}
+
+// Convert a value from WireLogRecord.Extra to an attribute, preserving its
+// type where OpenTelemetry has a matching one.
+func extraAttribute(key string, v any) attribute.KeyValue {
+	k := attribute.Key(key)
+	switch typed := v.(type) {
+	case string:
+		return k.String(typed)
+	case bool:
+		return k.Bool(typed)
+	case int:
+		return k.Int(typed)
+	case int64:
+		return k.Int64(typed)
+	case float64:
+		return k.Float64(typed)
+	case time.Duration:
+		return k.Int64(int64(typed))
+	case []string:
+		return k.StringSlice(typed)
+	case fmt.Stringer:
+		return k.String(typed.String())
+	default:
+		return k.String(fmt.Sprintf("%v", typed))
+	}
+}
@@ -0,0 +1,132 @@
+package fuseotel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/samples/memfs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestOpTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := NewOpTracer(provider.Tracer("test"))
+
+	op := &fuseops.LookUpInodeOp{Name: "foo"}
+	ctx := tracer.StartOp(context.Background(), op)
+
+	wlog := fuse.NewWireLogRecord()
+	wlog.Operation = "LookUpInodeOp"
+	wlog.Status = int(syscall.ENOENT)
+	wlog.Context = &fuseops.OpContext{FuseID: 17, Pid: 42, Uid: 1000}
+	wlog.Extra["backend"] = "gcs"
+	wlog.Extra["retries"] = 2
+	tracer.FinishOp(ctx, wlog)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+
+	span := spans[0]
+	if got, want := span.Name(), "fuse.LookUpInodeOp"; got != want {
+		t.Errorf("expected name %q, got %q", want, got)
+	}
+
+	if got := span.Status().Code; got != codes.Error {
+		t.Errorf("expected error status, got %v", got)
+	}
+
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+
+	expectations := map[attribute.Key]attribute.Value{
+		OperationKey:               attribute.StringValue("LookUpInodeOp"),
+		FuseIDKey:                  attribute.Int64Value(17),
+		PidKey:                     attribute.Int64Value(42),
+		ErrnoKey:                   attribute.IntValue(int(syscall.ENOENT)),
+		ExtraKeyPrefix + "backend": attribute.StringValue("gcs"),
+		ExtraKeyPrefix + "retries": attribute.IntValue(2),
+	}
+
+	for k, want := range expectations {
+		if got, ok := attrs[k]; !ok || got != want {
+			t.Errorf("attribute %s: expected %v, got %v", k, want.Emit(), got.Emit())
+		}
+	}
+}
+
+func TestOpTracerTraceParent(t *testing.T) {
+	const (
+		traceID    = "4bf92f3577b34da6a3ce929d0e0e4736"
+		appSpanID  = "00f067aa0ba902b7"
+		appContext = "00-" + traceID + "-" + appSpanID + "-01"
+	)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	var buf bytes.Buffer
+	cfg := &fuse.MountConfig{
+		WireLogger: &buf,
+		OpTracer:   NewOpTracer(provider.Tracer("test")),
+		WireLogTraceParent: func(ctx fuseops.OpContext) string {
+			return appContext
+		},
+	}
+
+	k, err := fakekernel.Start(memfs.NewMemFS(0, 0), cfg)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if err := k.Do(context.Background(), &fuseops.StatFSOp{}); err != nil {
+		t.Fatalf("StatFS: %v", err)
+	}
+
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	var span sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		if s.Name() == "fuse.StatFSOp" {
+			span = s
+		}
+	}
+	if span == nil {
+		t.Fatalf("no span for StatFSOp")
+	}
+
+	if got := span.Parent().TraceID().String(); got != traceID {
+		t.Errorf("expected parent trace %s, got %s", traceID, got)
+	}
+	if got := span.Parent().SpanID().String(); got != appSpanID {
+		t.Errorf("expected parent span %s, got %s", appSpanID, got)
+	}
+
+	var wlog fuse.WireLogRecord
+	dec := json.NewDecoder(&buf)
+	for dec.More() && wlog.Operation != "StatFSOp" {
+		if err := dec.Decode(&wlog); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+	}
+
+	want := "00-" + traceID + "-" + span.SpanContext().SpanID().String() + "-01"
+	if wlog.TraceParent != want {
+		t.Errorf("expected record traceparent %s, got %q", want, wlog.TraceParent)
+	}
+}
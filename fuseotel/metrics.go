@@ -0,0 +1,105 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseotel
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Names of the instruments created by NewMetricsSink.
+const (
+	OpsMetric      = "fuse.ops"
+	DurationMetric = "fuse.op.duration"
+	InFlightMetric = "fuse.ops.in_flight"
+)
+
+// NewMetricsSink returns a fuse.MetricsSink that records ops using
+// instruments created from the supplied meter:
+//
+//   - OpsMetric, a counter of finished ops by operation and errno.
+//   - DurationMetric, a histogram of op latency in seconds by operation.
+//   - InFlightMetric, a gauge of ops that have been read but not replied to,
+//     by operation.
+//
+// To expose these to Prometheus, back the meter with the OpenTelemetry
+// Prometheus exporter.
+func NewMetricsSink(meter metric.Meter) (fuse.MetricsSink, error) {
+	ops, err := meter.Int64Counter(
+		OpsMetric,
+		metric.WithDescription("Number of FUSE ops handled."),
+		metric.WithUnit("{op}"))
+	if err != nil {
+		return nil, fmt.Errorf("Int64Counter: %w", err)
+	}
+
+	duration, err := meter.Float64Histogram(
+		DurationMetric,
+		metric.WithDescription("Latency of FUSE ops."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, fmt.Errorf("Float64Histogram: %w", err)
+	}
+
+	inFlight, err := meter.Int64UpDownCounter(
+		InFlightMetric,
+		metric.WithDescription("Number of FUSE ops currently being handled."),
+		metric.WithUnit("{op}"))
+	if err != nil {
+		return nil, fmt.Errorf("Int64UpDownCounter: %w", err)
+	}
+
+	return &metricsSink{
+		ops:      ops,
+		duration: duration,
+		inFlight: inFlight,
+	}, nil
+}
+
+type metricsSink struct {
+	ops      metric.Int64Counter
+	duration metric.Float64Histogram
+	inFlight metric.Int64UpDownCounter
+}
+
+func (s *metricsSink) OpStarted(op string) {
+	s.inFlight.Add(
+		context.Background(),
+		1,
+		metric.WithAttributes(OperationKey.String(op)))
+}
+
+func (s *metricsSink) OpFinished(
+	op string,
+	errno syscall.Errno,
+	latency time.Duration) {
+	ctx := context.Background()
+	opAttr := metric.WithAttributes(OperationKey.String(op))
+
+	s.inFlight.Add(ctx, -1, opAttr)
+	s.duration.Record(ctx, latency.Seconds(), opAttr)
+	s.ops.Add(
+		ctx,
+		1,
+		metric.WithAttributeSet(attribute.NewSet(
+			OperationKey.String(op),
+			ErrnoKey.Int(int(errno)))))
+}
@@ -0,0 +1,73 @@
+package fuseotel
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetricsSink(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	sink, err := NewMetricsSink(provider.Meter("test"))
+	if err != nil {
+		t.Fatalf("NewMetricsSink: %v", err)
+	}
+
+	sink.OpStarted("LookUpInodeOp")
+	sink.OpStarted("LookUpInodeOp")
+	sink.OpStarted("ReadFileOp")
+	sink.OpFinished("LookUpInodeOp", 0, time.Millisecond)
+	sink.OpFinished("LookUpInodeOp", syscall.ENOENT, time.Millisecond)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+
+	// Finished ops, by errno.
+	ops := metrics[OpsMetric].(metricdata.Sum[int64])
+	if got := len(ops.DataPoints); got != 2 {
+		t.Errorf("expected 2 %s data points, got %d", OpsMetric, got)
+	}
+
+	for _, dp := range ops.DataPoints {
+		if dp.Value != 1 {
+			t.Errorf("expected 1 op for %v, got %d", dp.Attributes.ToSlice(), dp.Value)
+		}
+	}
+
+	// In-flight ops, by operation.
+	inFlight := make(map[string]int64)
+	for _, dp := range metrics[InFlightMetric].(metricdata.Sum[int64]).DataPoints {
+		v, _ := dp.Attributes.Value(OperationKey)
+		inFlight[v.AsString()] = dp.Value
+	}
+
+	if inFlight["LookUpInodeOp"] != 0 || inFlight["ReadFileOp"] != 1 {
+		t.Errorf("unexpected in-flight counts: %v", inFlight)
+	}
+
+	// Latency, by operation.
+	hist := metrics[DurationMetric].(metricdata.Histogram[float64])
+	if len(hist.DataPoints) != 1 {
+		t.Fatalf("expected 1 %s data point, got %d", DurationMetric, len(hist.DataPoints))
+	}
+
+	dp := hist.DataPoints[0]
+	if v, _ := dp.Attributes.Value(OperationKey); v != attribute.StringValue("LookUpInodeOp") || dp.Count != 2 {
+		t.Errorf("unexpected histogram data point: %v count=%d", dp.Attributes.ToSlice(), dp.Count)
+	}
+}
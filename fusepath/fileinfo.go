@@ -0,0 +1,56 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fusepath
+
+import (
+	"io/fs"
+	"syscall"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// FileInfoAttributes returns the attributes of a file as described by an
+// fs.FileInfo, for file systems built on APIs that return them. The owner and
+// link count are taken from a *syscall.Stat_t returned by fi.Sys if there is
+// one. Otherwise the file is owned by root and has one link.
+func FileInfoAttributes(fi fs.FileInfo) fuseops.InodeAttributes {
+	attrs := fuseops.InodeAttributes{
+		Size:  uint64(fi.Size()),
+		Nlink: 1,
+		Mode:  fi.Mode(),
+		Atime: fi.ModTime(),
+		Mtime: fi.ModTime(),
+		Ctime: fi.ModTime(),
+	}
+
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		attrs.Nlink = uint32(st.Nlink)
+		attrs.Uid = st.Uid
+		attrs.Gid = st.Gid
+	}
+
+	return attrs
+}
+
+// FileInfoEntries returns the directory entries described by a listing of
+// fs.FileInfo values, in the same order.
+func FileInfoEntries(fis []fs.FileInfo) []DirEntry {
+	entries := make([]DirEntry, len(fis))
+	for i, fi := range fis {
+		entries[i] = DirEntry{Name: fi.Name(), Type: fi.Mode().Type()}
+	}
+
+	return entries
+}
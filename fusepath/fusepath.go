@@ -0,0 +1,116 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fusepath allows file systems to be written in terms of paths
+// rather than inodes. Implement FileSystem and serve it with NewServer, which
+// takes care of allocating inode IDs, counting lookups and forgetting inodes,
+// and keeping track of open handles.
+//
+// Paths follow the conventions of package io/fs: they are slash-separated and
+// unrooted, e.g. "dir/file", and the root directory is ".".
+//
+// Errors returned by the file system may be syscall.Errno values, which are
+// passed to the kernel as they are, or errors wrapping them, such as
+// *os.PathError. Errors matching fs.ErrNotExist, fs.ErrExist and
+// fs.ErrPermission become ENOENT, EEXIST and EACCES. Others become EIO.
+package fusepath
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// A FileSystem whose files are identified by their paths. Embed
+// NotImplementedFileSystem to leave out the methods that a file system
+// doesn't support.
+//
+// Methods may be called concurrently, including for the same path.
+type FileSystem interface {
+	// Return the attributes of the file at the path, or an error matching
+	// fs.ErrNotExist if there is none.
+	Stat(ctx context.Context, path string) (fuseops.InodeAttributes, error)
+
+	// Return the entries of the directory at the path, in the order in which
+	// they are to be listed.
+	ReadDir(ctx context.Context, path string) ([]DirEntry, error)
+
+	// Open the existing file at the path for reading and writing.
+	Open(ctx context.Context, path string) (File, error)
+
+	// Create a new file at the path, and open it.
+	Create(ctx context.Context, path string, mode os.FileMode) (File, error)
+
+	// Apply changes to the attributes of the file at the path.
+	SetAttributes(ctx context.Context, path string, changes AttributeChanges) error
+
+	// Create a directory at the path.
+	Mkdir(ctx context.Context, path string, mode os.FileMode) error
+
+	// Create a symlink at the path, with the given target.
+	Symlink(ctx context.Context, target, path string) error
+
+	// Return the target of the symlink at the path.
+	Readlink(ctx context.Context, path string) (string, error)
+
+	// Remove the file or symlink at the path.
+	Remove(ctx context.Context, path string) error
+
+	// Remove the empty directory at the path.
+	Rmdir(ctx context.Context, path string) error
+
+	// Move the file or directory at oldPath to newPath, replacing any existing
+	// file there.
+	Rename(ctx context.Context, oldPath, newPath string) error
+}
+
+// An entry in a directory.
+type DirEntry struct {
+	// The name of the entry within the directory.
+	Name string
+
+	// The type bits of the entry's mode, e.g. os.ModeDir, or zero for a
+	// regular file.
+	Type os.FileMode
+}
+
+// AttributeChanges describes the changes to make in a call to
+// FileSystem.SetAttributes. Nil fields are to be left unchanged.
+type AttributeChanges struct {
+	Size  *uint64
+	Mode  *os.FileMode
+	Uid   *uint32
+	Gid   *uint32
+	Atime *time.Time
+	Mtime *time.Time
+}
+
+// An open file.
+type File interface {
+	// Read up to len(p) bytes at the offset, returning the number read. Reads
+	// are short only at the end of the file, which may also be signalled by
+	// io.EOF.
+	ReadAt(ctx context.Context, p []byte, off int64) (int, error)
+
+	// Write p at the offset.
+	WriteAt(ctx context.Context, p []byte, off int64) (int, error)
+
+	// Make sure that data written so far is durable.
+	Sync(ctx context.Context) error
+
+	// Close the file, once the kernel no longer refers to it.
+	Close() error
+}
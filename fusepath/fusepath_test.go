@@ -0,0 +1,255 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fusepath_test
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fusepath"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+// A file system of directories and regular files held in memory, keyed by
+// path.
+type mapFS struct {
+	fusepath.NotImplementedFileSystem
+
+	mu    sync.Mutex
+	files map[string]*mapFile
+}
+
+type mapFile struct {
+	fs   *mapFS
+	mode os.FileMode
+	data []byte
+}
+
+func newMapFS() *mapFS {
+	fs := &mapFS{files: make(map[string]*mapFile)}
+	fs.files["."] = &mapFile{fs: fs, mode: os.ModeDir | 0755}
+	return fs
+}
+
+func (m *mapFS) Stat(ctx context.Context, p string) (fuseops.InodeAttributes, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[p]
+	if !ok {
+		return fuseops.InodeAttributes{}, fs.ErrNotExist
+	}
+
+	return fuseops.InodeAttributes{Size: uint64(len(f.data)), Nlink: 1, Mode: f.mode}, nil
+}
+
+func (m *mapFS) ReadDir(ctx context.Context, p string) ([]fusepath.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []fusepath.DirEntry
+	for name, f := range m.files {
+		if name != "." && path.Dir(name) == p {
+			entries = append(entries, fusepath.DirEntry{Name: path.Base(name), Type: f.mode.Type()})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+func (m *mapFS) Open(ctx context.Context, p string) (fusepath.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[p]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+
+	return f, nil
+}
+
+func (m *mapFS) Create(ctx context.Context, p string, mode os.FileMode) (fusepath.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[p]; ok {
+		return nil, fs.ErrExist
+	}
+
+	f := &mapFile{fs: m, mode: mode}
+	m.files[p] = f
+	return f, nil
+}
+
+func (m *mapFS) Mkdir(ctx context.Context, p string, mode os.FileMode) error {
+	_, err := m.Create(ctx, p, os.ModeDir|mode)
+	return err
+}
+
+func (m *mapFS) Rename(ctx context.Context, oldPath, newPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, f := range m.files {
+		if name == oldPath || strings.HasPrefix(name, oldPath+"/") {
+			delete(m.files, name)
+			m.files[newPath+name[len(oldPath):]] = f
+		}
+	}
+
+	return nil
+}
+
+func (f *mapFile) ReadAt(ctx context.Context, p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+
+	return copy(p, f.data[off:]), nil
+}
+
+func (f *mapFile) WriteAt(ctx context.Context, p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if end := off + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+
+	return copy(f.data[off:], p), nil
+}
+
+func (f *mapFile) Sync(ctx context.Context) error {
+	return nil
+}
+
+func (f *mapFile) Close() error {
+	return nil
+}
+
+// Return the names in a ReadDirOp's output.
+func direntNames(buf []byte) []string {
+	var names []string
+	for len(buf) >= fusekernel.DirentSize {
+		d := (*fusekernel.Dirent)(unsafe.Pointer(&buf[0]))
+		names = append(names, string(buf[fusekernel.DirentSize:fusekernel.DirentSize+int(d.Namelen)]))
+		buf = buf[(fusekernel.DirentSize+int(d.Namelen)+7)&^7:]
+	}
+
+	return names
+}
+
+func TestServer(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the in-process transport requires Linux")
+	}
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(fusepath.NewServer(newMapFS()), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	mkDir := &fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "dir", Mode: 0755}
+	if err := k.Do(ctx, mkDir); err != nil {
+		t.Fatalf("MkDir: %v", err)
+	}
+	dir := mkDir.Entry.Child
+
+	create := &fuseops.CreateFileOp{Parent: dir, Name: "file", Mode: 0644}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: []byte("taco")}
+	if err := k.Do(ctx, write); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := k.Do(ctx, &fuseops.ReleaseFileHandleOp{Handle: create.Handle}); err != nil {
+		t.Fatalf("ReleaseFileHandle: %v", err)
+	}
+
+	// Renaming the directory keeps the inode of the file valid.
+	rename := &fuseops.RenameOp{OldParent: fuseops.RootInodeID, OldName: "dir", NewParent: fuseops.RootInodeID, NewName: "renamed"}
+	if err := k.Do(ctx, rename); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+
+	open := &fuseops.OpenFileOp{Inode: create.Entry.Child}
+	if err := k.Do(ctx, open); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	read := &fuseops.ReadFileOp{Inode: create.Entry.Child, Handle: open.Handle, Size: 100}
+	if err := k.Do(ctx, read); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got := string(read.Dst[:read.BytesRead]); got != "taco" {
+		t.Errorf("read %q", got)
+	}
+
+	// Looking the file up by its new path finds the same inode.
+	lookUp := &fuseops.LookUpInodeOp{Parent: dir, Name: "file"}
+	if err := k.Do(ctx, lookUp); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+	if lookUp.Entry.Child != create.Entry.Child || lookUp.Entry.Attributes.Size != 4 {
+		t.Errorf("unexpected entry %+v", lookUp.Entry)
+	}
+
+	missing := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "dir"}
+	if err := k.Do(ctx, missing); err != syscall.ENOENT {
+		t.Errorf("LookUpInode of old path: %v", err)
+	}
+
+	openDir := &fuseops.OpenDirOp{Inode: fuseops.RootInodeID}
+	if err := k.Do(ctx, openDir); err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	readDir := &fuseops.ReadDirOp{Inode: fuseops.RootInodeID, Handle: openDir.Handle, Dst: make([]byte, 4096)}
+	if err := k.Do(ctx, readDir); err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if got := direntNames(readDir.Dst[:readDir.BytesRead]); len(got) != 1 || got[0] != "renamed" {
+		t.Errorf("listed %q", got)
+	}
+
+	// Once forgotten, the inode is no longer valid.
+	forget := &fuseops.ForgetInodeOp{Inode: create.Entry.Child, N: 2}
+	if err := k.Do(ctx, forget); err != nil {
+		t.Fatalf("ForgetInode: %v", err)
+	}
+	getAttr := &fuseops.GetInodeAttributesOp{Inode: create.Entry.Child}
+	if err := k.Do(ctx, getAttr); err == nil {
+		t.Errorf("GetInodeAttributes of forgotten inode succeeded")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fusepath
+
+import (
+	"context"
+	"os"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// A FileSystem that responds to all calls with fuse.ENOSYS. Embed this in your
+// struct to inherit default implementations for the methods you don't care
+// about, ensuring your struct will continue to implement FileSystem even as
+// new methods are added.
+type NotImplementedFileSystem struct {
+}
+
+var _ FileSystem = &NotImplementedFileSystem{}
+
+func (fs *NotImplementedFileSystem) Stat(
+	ctx context.Context,
+	path string) (fuseops.InodeAttributes, error) {
+	return fuseops.InodeAttributes{}, fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) ReadDir(
+	ctx context.Context,
+	path string) ([]DirEntry, error) {
+	return nil, fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) Open(
+	ctx context.Context,
+	path string) (File, error) {
+	return nil, fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) Create(
+	ctx context.Context,
+	path string,
+	mode os.FileMode) (File, error) {
+	return nil, fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) SetAttributes(
+	ctx context.Context,
+	path string,
+	changes AttributeChanges) error {
+	return fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) Mkdir(
+	ctx context.Context,
+	path string,
+	mode os.FileMode) error {
+	return fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) Symlink(
+	ctx context.Context,
+	target string,
+	path string) error {
+	return fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) Readlink(
+	ctx context.Context,
+	path string) (string, error) {
+	return "", fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) Remove(
+	ctx context.Context,
+	path string) error {
+	return fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) Rmdir(
+	ctx context.Context,
+	path string) error {
+	return fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) Rename(
+	ctx context.Context,
+	oldPath string,
+	newPath string) error {
+	return fuse.ENOSYS
+}
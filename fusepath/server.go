@@ -0,0 +1,636 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fusepath
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// NewServer returns a server that serves the file system.
+func NewServer(fs FileSystem) fuse.Server {
+	pfs := &pathFS{
+		fs: fs,
+		inodes: map[fuseops.InodeID]*inode{
+			fuseops.RootInodeID: {path: ".", lookups: 1},
+		},
+		byPath:     map[string]fuseops.InodeID{".": fuseops.RootInodeID},
+		nextInode:  fuseops.RootInodeID + 1,
+		files:      make(map[fuseops.HandleID]File),
+		dirs:       make(map[fuseops.HandleID][]DirEntry),
+		nextHandle: 1,
+	}
+
+	return fuseutil.NewFileSystemServer(pfs)
+}
+
+// An inode that the kernel knows about.
+type inode struct {
+	// The path of the inode, or empty if it has been removed.
+	path string
+
+	// The number of lookups the kernel has yet to forget.
+	lookups uint64
+}
+
+// pathFS implements fuseutil.FileSystem on top of a FileSystem.
+type pathFS struct {
+	fuseutil.NotImplementedFileSystem
+	fs FileSystem
+
+	mu sync.Mutex
+
+	// The inodes the kernel knows about, and their IDs by path.
+	//
+	// INVARIANT: For each p, id in byPath, inodes[id].path == p
+	// INVARIANT: For each id, i in inodes, i.path is empty or byPath[i.path] == id
+	//
+	// GUARDED_BY(mu)
+	inodes    map[fuseops.InodeID]*inode
+	byPath    map[string]fuseops.InodeID
+	nextInode fuseops.InodeID
+
+	// Open files, and the entries of open directories as of when they were
+	// opened.
+	//
+	// GUARDED_BY(mu)
+	files      map[fuseops.HandleID]File
+	dirs       map[fuseops.HandleID][]DirEntry
+	nextHandle fuseops.HandleID
+}
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+// Convert an error returned by the file system to one for the kernel.
+func toErrno(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var errno syscall.Errno
+	switch {
+	case errors.As(err, &errno):
+		return errno
+	case errors.Is(err, fs.ErrNotExist):
+		return fuse.ENOENT
+	case errors.Is(err, fs.ErrExist):
+		return fuse.EEXIST
+	case errors.Is(err, fs.ErrPermission):
+		return syscall.EACCES
+	}
+
+	return fuse.EIO
+}
+
+// Return the path of the inode.
+//
+// LOCKS_EXCLUDED(pfs.mu)
+func (pfs *pathFS) path(id fuseops.InodeID) (string, error) {
+	pfs.mu.Lock()
+	defer pfs.mu.Unlock()
+
+	in, ok := pfs.inodes[id]
+	if !ok || in.path == "" {
+		return "", fuse.ENOENT
+	}
+
+	return in.path, nil
+}
+
+// Return the path of the named child of the inode.
+//
+// LOCKS_EXCLUDED(pfs.mu)
+func (pfs *pathFS) childPath(parent fuseops.InodeID, name string) (string, error) {
+	p, err := pfs.path(parent)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(p, name), nil
+}
+
+// Fill in the entry for the file at the path, which has been looked up or
+// created, incrementing its lookup count.
+//
+// LOCKS_EXCLUDED(pfs.mu)
+func (pfs *pathFS) lookUp(ctx context.Context, p string, e *fuseops.ChildInodeEntry) error {
+	attrs, err := pfs.fs.Stat(ctx, p)
+	if err != nil {
+		return toErrno(err)
+	}
+
+	pfs.mu.Lock()
+	defer pfs.mu.Unlock()
+
+	id, ok := pfs.byPath[p]
+	if !ok {
+		id = pfs.nextInode
+		pfs.nextInode++
+		pfs.inodes[id] = &inode{path: p}
+		pfs.byPath[p] = id
+	}
+	pfs.inodes[id].lookups++
+
+	e.Child = id
+	e.Attributes = attrs
+	return nil
+}
+
+// Forget the path of the inode at the path, if any, which no longer exists.
+//
+// LOCKS_REQUIRED(pfs.mu)
+func (pfs *pathFS) unlink(p string) {
+	if id, ok := pfs.byPath[p]; ok {
+		pfs.inodes[id].path = ""
+		delete(pfs.byPath, p)
+	}
+}
+
+// Decrement the lookup count of the inode, forgetting it when it reaches
+// zero.
+//
+// LOCKS_REQUIRED(pfs.mu)
+func (pfs *pathFS) forget(id fuseops.InodeID, n uint64) {
+	in, ok := pfs.inodes[id]
+	if !ok || id == fuseops.RootInodeID {
+		return
+	}
+
+	in.lookups -= min(n, in.lookups)
+	if in.lookups == 0 {
+		if in.path != "" {
+			delete(pfs.byPath, in.path)
+		}
+		delete(pfs.inodes, id)
+	}
+}
+
+// Return the file for the handle.
+//
+// LOCKS_EXCLUDED(pfs.mu)
+func (pfs *pathFS) file(h fuseops.HandleID) (File, error) {
+	pfs.mu.Lock()
+	defer pfs.mu.Unlock()
+
+	f, ok := pfs.files[h]
+	if !ok {
+		return nil, fuse.EINVAL
+	}
+
+	return f, nil
+}
+
+// Return a handle for the open file.
+//
+// LOCKS_EXCLUDED(pfs.mu)
+func (pfs *pathFS) addFile(f File) fuseops.HandleID {
+	pfs.mu.Lock()
+	defer pfs.mu.Unlock()
+
+	h := pfs.nextHandle
+	pfs.nextHandle++
+	pfs.files[h] = f
+	return h
+}
+
+// Return the inode ID to list for the directory entry at the path. The
+// kernel doesn't look entries up when listing them, so if it doesn't already
+// know the file, it gets an ID derived from the path, outside of the range of
+// those allocated by lookUp.
+//
+// LOCKS_EXCLUDED(pfs.mu)
+func (pfs *pathFS) direntInode(p string) fuseops.InodeID {
+	pfs.mu.Lock()
+	id, ok := pfs.byPath[p]
+	pfs.mu.Unlock()
+	if ok {
+		return id
+	}
+
+	h := fnv.New64a()
+	io.WriteString(h, p)
+	return fuseops.InodeID(h.Sum64() | 1<<63)
+}
+
+// Return the dirent type for the mode.
+func direntType(mode fs.FileMode) fuseutil.DirentType {
+	switch mode.Type() {
+	case 0:
+		return fuseutil.DT_File
+	case fs.ModeDir:
+		return fuseutil.DT_Directory
+	case fs.ModeSymlink:
+		return fuseutil.DT_Link
+	case fs.ModeNamedPipe:
+		return fuseutil.DT_FIFO
+	case fs.ModeSocket:
+		return fuseutil.DT_Socket
+	case fs.ModeDevice:
+		return fuseutil.DT_Block
+	case fs.ModeDevice | fs.ModeCharDevice:
+		return fuseutil.DT_Char
+	}
+
+	return fuseutil.DT_Unknown
+}
+
+////////////////////////////////////////////////////////////////////////
+// Inodes
+////////////////////////////////////////////////////////////////////////
+
+func (pfs *pathFS) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	p, err := pfs.childPath(op.Parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	return pfs.lookUp(ctx, p, &op.Entry)
+}
+
+func (pfs *pathFS) GetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.GetInodeAttributesOp) error {
+	p, err := pfs.path(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	op.Attributes, err = pfs.fs.Stat(ctx, p)
+	return toErrno(err)
+}
+
+func (pfs *pathFS) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	p, err := pfs.path(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	changes := AttributeChanges{
+		Size:  op.Size,
+		Mode:  op.Mode,
+		Uid:   op.Uid,
+		Gid:   op.Gid,
+		Atime: op.Atime,
+		Mtime: op.Mtime,
+	}
+	if err := pfs.fs.SetAttributes(ctx, p, changes); err != nil {
+		return toErrno(err)
+	}
+
+	op.Attributes, err = pfs.fs.Stat(ctx, p)
+	return toErrno(err)
+}
+
+func (pfs *pathFS) ForgetInode(
+	ctx context.Context,
+	op *fuseops.ForgetInodeOp) error {
+	pfs.mu.Lock()
+	defer pfs.mu.Unlock()
+
+	pfs.forget(op.Inode, op.N)
+	return nil
+}
+
+func (pfs *pathFS) BatchForget(
+	ctx context.Context,
+	op *fuseops.BatchForgetOp) error {
+	pfs.mu.Lock()
+	defer pfs.mu.Unlock()
+
+	for _, e := range op.Entries {
+		pfs.forget(e.Inode, e.N)
+	}
+	return nil
+}
+
+func (pfs *pathFS) MkDir(
+	ctx context.Context,
+	op *fuseops.MkDirOp) error {
+	p, err := pfs.childPath(op.Parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := pfs.fs.Mkdir(ctx, p, op.Mode); err != nil {
+		return toErrno(err)
+	}
+
+	return pfs.lookUp(ctx, p, &op.Entry)
+}
+
+func (pfs *pathFS) CreateFile(
+	ctx context.Context,
+	op *fuseops.CreateFileOp) error {
+	p, err := pfs.childPath(op.Parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	f, err := pfs.fs.Create(ctx, p, op.Mode)
+	if err != nil {
+		return toErrno(err)
+	}
+
+	if err := pfs.lookUp(ctx, p, &op.Entry); err != nil {
+		f.Close()
+		return err
+	}
+
+	op.Handle = pfs.addFile(f)
+	return nil
+}
+
+func (pfs *pathFS) CreateSymlink(
+	ctx context.Context,
+	op *fuseops.CreateSymlinkOp) error {
+	p, err := pfs.childPath(op.Parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := pfs.fs.Symlink(ctx, op.Target, p); err != nil {
+		return toErrno(err)
+	}
+
+	return pfs.lookUp(ctx, p, &op.Entry)
+}
+
+func (pfs *pathFS) ReadSymlink(
+	ctx context.Context,
+	op *fuseops.ReadSymlinkOp) error {
+	p, err := pfs.path(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	op.Target, err = pfs.fs.Readlink(ctx, p)
+	return toErrno(err)
+}
+
+func (pfs *pathFS) Rename(
+	ctx context.Context,
+	op *fuseops.RenameOp) error {
+	// RENAME_NOREPLACE and RENAME_EXCHANGE can't be expressed in terms of
+	// FileSystem.Rename.
+	if op.Flags != 0 {
+		return fuse.EINVAL
+	}
+
+	oldPath, err := pfs.childPath(op.OldParent, op.OldName)
+	if err != nil {
+		return err
+	}
+
+	newPath, err := pfs.childPath(op.NewParent, op.NewName)
+	if err != nil {
+		return err
+	}
+
+	if err := pfs.fs.Rename(ctx, oldPath, newPath); err != nil {
+		return toErrno(err)
+	}
+
+	if oldPath == newPath {
+		return nil
+	}
+
+	pfs.mu.Lock()
+	defer pfs.mu.Unlock()
+
+	// Whatever was at the new path has been replaced. Move the renamed inode
+	// and, if it's a directory, all the inodes under it.
+	pfs.unlink(newPath)
+	prefix := oldPath + "/"
+	for id, in := range pfs.inodes {
+		if in.path != oldPath && !strings.HasPrefix(in.path, prefix) {
+			continue
+		}
+
+		delete(pfs.byPath, in.path)
+		in.path = newPath + in.path[len(oldPath):]
+		pfs.byPath[in.path] = id
+	}
+
+	return nil
+}
+
+func (pfs *pathFS) RmDir(
+	ctx context.Context,
+	op *fuseops.RmDirOp) error {
+	p, err := pfs.childPath(op.Parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := pfs.fs.Rmdir(ctx, p); err != nil {
+		return toErrno(err)
+	}
+
+	pfs.mu.Lock()
+	pfs.unlink(p)
+	pfs.mu.Unlock()
+	return nil
+}
+
+func (pfs *pathFS) Unlink(
+	ctx context.Context,
+	op *fuseops.UnlinkOp) error {
+	p, err := pfs.childPath(op.Parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := pfs.fs.Remove(ctx, p); err != nil {
+		return toErrno(err)
+	}
+
+	pfs.mu.Lock()
+	pfs.unlink(p)
+	pfs.mu.Unlock()
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////
+// Directory handles
+////////////////////////////////////////////////////////////////////////
+
+func (pfs *pathFS) OpenDir(
+	ctx context.Context,
+	op *fuseops.OpenDirOp) error {
+	p, err := pfs.path(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	entries, err := pfs.fs.ReadDir(ctx, p)
+	if err != nil {
+		return toErrno(err)
+	}
+
+	pfs.mu.Lock()
+	defer pfs.mu.Unlock()
+
+	op.Handle = pfs.nextHandle
+	pfs.nextHandle++
+	pfs.dirs[op.Handle] = entries
+	return nil
+}
+
+func (pfs *pathFS) ReadDir(
+	ctx context.Context,
+	op *fuseops.ReadDirOp) error {
+	p, err := pfs.path(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	pfs.mu.Lock()
+	entries, ok := pfs.dirs[op.Handle]
+	pfs.mu.Unlock()
+	if !ok {
+		return fuse.EINVAL
+	}
+
+	// Offsets are indices into the listing.
+	for i := int(op.Offset); i < len(entries); i++ {
+		e := entries[i]
+		d := fuseutil.Dirent{
+			Offset: fuseops.DirOffset(i + 1),
+			Inode:  pfs.direntInode(path.Join(p, e.Name)),
+			Name:   e.Name,
+			Type:   direntType(e.Type),
+		}
+
+		n := fuseutil.WriteDirent(op.Dst[op.BytesRead:], d)
+		if n == 0 {
+			break
+		}
+		op.BytesRead += n
+	}
+
+	return nil
+}
+
+func (pfs *pathFS) ReleaseDirHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseDirHandleOp) error {
+	pfs.mu.Lock()
+	defer pfs.mu.Unlock()
+
+	delete(pfs.dirs, op.Handle)
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////
+// File handles
+////////////////////////////////////////////////////////////////////////
+
+func (pfs *pathFS) OpenFile(
+	ctx context.Context,
+	op *fuseops.OpenFileOp) error {
+	p, err := pfs.path(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	f, err := pfs.fs.Open(ctx, p)
+	if err != nil {
+		return toErrno(err)
+	}
+
+	op.Handle = pfs.addFile(f)
+	return nil
+}
+
+func (pfs *pathFS) ReadFile(
+	ctx context.Context,
+	op *fuseops.ReadFileOp) error {
+	f, err := pfs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	if int64(len(op.Dst)) < op.Size {
+		op.Dst = make([]byte, op.Size)
+	}
+
+	op.BytesRead, err = f.ReadAt(ctx, op.Dst[:op.Size], op.Offset)
+	if err == io.EOF {
+		err = nil
+	}
+
+	return toErrno(err)
+}
+
+func (pfs *pathFS) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	f, err := pfs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteAt(ctx, op.Data, op.Offset)
+	return toErrno(err)
+}
+
+func (pfs *pathFS) SyncFile(
+	ctx context.Context,
+	op *fuseops.SyncFileOp) error {
+	f, err := pfs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	return toErrno(f.Sync(ctx))
+}
+
+func (pfs *pathFS) FlushFile(
+	ctx context.Context,
+	op *fuseops.FlushFileOp) error {
+	return nil
+}
+
+func (pfs *pathFS) ReleaseFileHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseFileHandleOp) error {
+	pfs.mu.Lock()
+	f, ok := pfs.files[op.Handle]
+	delete(pfs.files, op.Handle)
+	pfs.mu.Unlock()
+
+	if !ok {
+		return fuse.EINVAL
+	}
+
+	return toErrno(f.Close())
+}
@@ -0,0 +1,395 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fusereplay replays a recorded wire log against a fuse.Server
+// in-process, without a kernel mount. This makes it possible to reproduce
+// production traffic against a new version of a file system.
+//
+// Record the log with fuse.MountConfig.WireLogger and the default
+// JSONWireLogFormatter (pretty-printed or compact), then:
+//
+//	records, err := fusereplay.ReadRecords(f)
+//	...
+//	results, err := fusereplay.Replay(ctx, server, records, nil)
+//	for _, r := range results {
+//		if r.Mismatch() {
+//			...
+//		}
+//	}
+//
+// Inode and handle IDs minted by the recorded file system are mapped to the
+// ones minted by the replayed file system as entries are looked up and files
+// are opened, so the two needn't allocate IDs identically.
+//
+// Replay is currently only supported on Linux.
+package fusereplay
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/wirelogfmt"
+)
+
+// ReadRecords reads all of the wire log records in r, which must contain JSON
+// objects as written by fuse.JSONWireLogFormatter. It is equivalent to
+// wirelogfmt.ReadAll.
+func ReadRecords(r io.Reader) ([]*fuse.WireLogRecord, error) {
+	return wirelogfmt.ReadAll(r)
+}
+
+// Options control how records are replayed. The zero value replays as fast as
+// possible against a server with a default fuse.MountConfig.
+type Options struct {
+	// The rate at which to replay, relative to the recorded timing. If 1, ops
+	// are issued at the same offsets from the first op as they were recorded
+	// at; if 2, twice as fast; and so on. If zero, ops are issued as fast as
+	// possible.
+	//
+	// Ops are always issued one at a time, so a replay may fall behind the
+	// recorded timing if the server is slower than the original.
+	Speed float64
+
+	// The config with which to serve the server. May be nil.
+	MountConfig *fuse.MountConfig
+}
+
+// ErrUnsupported is the Err of a Result for a record whose operation can't
+// be replayed, such as the INIT handshake or a Mount event.
+var ErrUnsupported = errors.New("operation not supported for replay")
+
+// The Result of replaying a single record.
+type Result struct {
+	// The record that was replayed.
+	Record *fuse.WireLogRecord
+
+	// The errno the server replied with when the op was replayed, or zero if
+	// it succeeded.
+	Status syscall.Errno
+
+	// How long the server took to reply.
+	Duration time.Duration
+
+	// Non-nil if the op couldn't be replayed at all, in which case Status and
+	// Duration are meaningless.
+	Err error
+}
+
+// Mismatch reports whether the replayed op's result differs from the
+// recorded one.
+func (r *Result) Mismatch() bool {
+	return r.Err == nil && int(r.Status) != r.Record.Status
+}
+
+// Replay serves the supplied server in-process and issues the ops described
+// by the records to it, in order of their start time. It returns one result
+// per record, in that order.
+//
+// The returned error is non-nil only if the server couldn't be started, or if
+// ctx was cancelled, in which case the results so far are returned with it.
+func Replay(
+	ctx context.Context,
+	server fuse.Server,
+	records []*fuse.WireLogRecord,
+	opts *Options) ([]Result, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	k, err := fakekernel.Start(server, opts.MountConfig)
+	if err != nil {
+		return nil, fmt.Errorf("fakekernel.Start: %w", err)
+	}
+	defer k.Close()
+
+	sorted := make([]*fuse.WireLogRecord, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTime.Before(sorted[j].StartTime)
+	})
+
+	r := &replayer{
+		kernel:  k,
+		inodes:  map[fuseops.InodeID]fuseops.InodeID{fuseops.RootInodeID: fuseops.RootInodeID},
+		handles: make(map[fuseops.HandleID]fuseops.HandleID),
+	}
+
+	results := make([]Result, 0, len(sorted))
+	start := time.Now()
+	for _, wlog := range sorted {
+		if opts.Speed > 0 {
+			offset := wlog.StartTime.Sub(sorted[0].StartTime)
+			wait := time.Until(start.Add(time.Duration(float64(offset) / opts.Speed)))
+			if wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return results, ctx.Err()
+				}
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		results = append(results, r.replay(ctx, wlog))
+	}
+
+	return results, nil
+}
+
+type replayer struct {
+	kernel *fakekernel.Kernel
+
+	// Recorded IDs mapped to the IDs minted by the server for the same entry
+	// or handle during replay.
+	inodes  map[fuseops.InodeID]fuseops.InodeID
+	handles map[fuseops.HandleID]fuseops.HandleID
+}
+
+func (r *replayer) replay(ctx context.Context, wlog *fuse.WireLogRecord) Result {
+	res := Result{Record: wlog}
+
+	op, err := newOp(wlog)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	// Note the IDs the recorded server returned, then swap the recorded IDs in
+	// the op's inputs for their replayed equivalents.
+	recordedChild, recordedHandle := outputIDs(op)
+	r.remap(reflect.ValueOf(op).Elem())
+
+	start := time.Now()
+	err = r.kernel.Do(ctx, op)
+	res.Duration = time.Since(start)
+
+	var errno syscall.Errno
+	switch {
+	case err == nil:
+	case errors.As(err, &errno):
+		res.Status = errno
+		return res
+	default:
+		res.Err = err
+		return res
+	}
+
+	child, handle := outputIDs(op)
+	if recordedChild != 0 {
+		r.inodes[recordedChild] = child
+	}
+
+	if recordedHandle != 0 {
+		r.handles[recordedHandle] = handle
+	}
+
+	return res
+}
+
+// Replace recorded inode and handle IDs in the fields of an op struct with
+// the IDs that the replayed server used for the same inodes and handles. IDs
+// that haven't been seen are left alone.
+func (r *replayer) remap(v reflect.Value) {
+	inodeType := reflect.TypeOf(fuseops.InodeID(0))
+	handleType := reflect.TypeOf(fuseops.HandleID(0))
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		switch {
+		case f.Type() == inodeType:
+			if id, ok := r.inodes[fuseops.InodeID(f.Uint())]; ok {
+				f.SetUint(uint64(id))
+			}
+
+		case f.Type() == handleType:
+			if id, ok := r.handles[fuseops.HandleID(f.Uint())]; ok {
+				f.SetUint(uint64(id))
+			}
+
+		case f.Kind() == reflect.Ptr && f.Type().Elem() == handleType && !f.IsNil():
+			if id, ok := r.handles[*f.Interface().(*fuseops.HandleID)]; ok {
+				f.Set(reflect.ValueOf(&id))
+			}
+
+		case v.Type().Field(i).Anonymous && f.Kind() == reflect.Struct:
+			r.remap(f)
+
+		case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Struct:
+			for j := 0; j < f.Len(); j++ {
+				r.remap(f.Index(j))
+			}
+		}
+	}
+}
+
+// Return the inode and handle IDs minted by the server in reply to an op, if
+// any.
+func outputIDs(op interface{}) (child fuseops.InodeID, handle fuseops.HandleID) {
+	switch o := op.(type) {
+	case *fuseops.LookUpInodeOp:
+		return o.Entry.Child, 0
+	case *fuseops.MkDirOp:
+		return o.Entry.Child, 0
+	case *fuseops.MkNodeOp:
+		return o.Entry.Child, 0
+	case *fuseops.CreateSymlinkOp:
+		return o.Entry.Child, 0
+	case *fuseops.CreateLinkOp:
+		return o.Entry.Child, 0
+	case *fuseops.CreateFileOp:
+		return o.Entry.Child, o.Handle
+	case *fuseops.CreateTmpFileOp:
+		return o.Entry.Child, o.Handle
+	case *fuseops.OpenFileOp:
+		return 0, o.Handle
+	case *fuseops.OpenDirOp:
+		return 0, o.Handle
+	}
+
+	return 0, 0
+}
+
+// Constructors for the ops that can be replayed, keyed by the operation name
+// in the wire log.
+var opTypes = map[string]func() interface{}{
+	"LookUpInodeOp":        func() interface{} { return new(fuseops.LookUpInodeOp) },
+	"GetInodeAttributesOp": func() interface{} { return new(fuseops.GetInodeAttributesOp) },
+	"StatxOp":              func() interface{} { return new(fuseops.StatxOp) },
+	"SetInodeAttributesOp": func() interface{} { return new(fuseops.SetInodeAttributesOp) },
+	"ForgetInodeOp":        func() interface{} { return new(fuseops.ForgetInodeOp) },
+	"BatchForgetOp":        func() interface{} { return new(fuseops.BatchForgetOp) },
+	"MkDirOp":              func() interface{} { return new(fuseops.MkDirOp) },
+	"MkNodeOp":             func() interface{} { return new(fuseops.MkNodeOp) },
+	"CreateFileOp":         func() interface{} { return new(fuseops.CreateFileOp) },
+	"CreateTmpFileOp":      func() interface{} { return new(fuseops.CreateTmpFileOp) },
+	"CreateSymlinkOp":      func() interface{} { return new(fuseops.CreateSymlinkOp) },
+	"CreateLinkOp":         func() interface{} { return new(fuseops.CreateLinkOp) },
+	"RenameOp":             func() interface{} { return new(fuseops.RenameOp) },
+	"UnlinkOp":             func() interface{} { return new(fuseops.UnlinkOp) },
+	"RmDirOp":              func() interface{} { return new(fuseops.RmDirOp) },
+	"OpenFileOp":           func() interface{} { return new(fuseops.OpenFileOp) },
+	"OpenDirOp":            func() interface{} { return new(fuseops.OpenDirOp) },
+	"ReadFileOp":           func() interface{} { return new(fuseops.ReadFileOp) },
+	"ReadDirOp":            func() interface{} { return new(fuseops.ReadDirOp) },
+	"ReadDirPlusOp":        func() interface{} { return new(fuseops.ReadDirPlusOp) },
+	"ReleaseFileHandleOp":  func() interface{} { return new(fuseops.ReleaseFileHandleOp) },
+	"ReleaseDirHandleOp":   func() interface{} { return new(fuseops.ReleaseDirHandleOp) },
+	"WriteFileOp":          func() interface{} { return new(fuseops.WriteFileOp) },
+	"SyncFileOp":           func() interface{} { return new(fuseops.SyncFileOp) },
+	"SyncFSOp":             func() interface{} { return new(fuseops.SyncFSOp) },
+	"FlushFileOp":          func() interface{} { return new(fuseops.FlushFileOp) },
+	"ReadSymlinkOp":        func() interface{} { return new(fuseops.ReadSymlinkOp) },
+	"StatFSOp":             func() interface{} { return new(fuseops.StatFSOp) },
+	"RemoveXattrOp":        func() interface{} { return new(fuseops.RemoveXattrOp) },
+	"GetXattrOp":           func() interface{} { return new(fuseops.GetXattrOp) },
+	"ListXattrOp":          func() interface{} { return new(fuseops.ListXattrOp) },
+	"SetXattrOp":           func() interface{} { return new(fuseops.SetXattrOp) },
+	"FallocateOp":          func() interface{} { return new(fuseops.FallocateOp) },
+	"CopyFileRangeOp":      func() interface{} { return new(fuseops.CopyFileRangeOp) },
+	"SeekFileOp":           func() interface{} { return new(fuseops.SeekFileOp) },
+	"PollOp":               func() interface{} { return new(fuseops.PollOp) },
+	"AccessOp":             func() interface{} { return new(fuseops.AccessOp) },
+	"FlockOp":              func() interface{} { return new(fuseops.FlockOp) },
+}
+
+// Reconstruct the op described by a record. Fields of the op that the wire
+// log doesn't capture, such as buffers, are synthesized.
+func newOp(wlog *fuse.WireLogRecord) (interface{}, error) {
+	newFunc, ok := opTypes[wlog.Operation]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupported, wlog.Operation)
+	}
+
+	// The args were produced by encoding the op's fields, so decoding them
+	// into a fresh op recovers the fields.
+	op := newFunc()
+	buf, err := json.Marshal(wlog.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, op); err != nil {
+		return nil, fmt.Errorf("decoding args: %w", err)
+	}
+
+	if wlog.Context != nil {
+		if f := reflect.ValueOf(op).Elem().FieldByName("OpContext"); f.IsValid() {
+			f.Set(reflect.ValueOf(*wlog.Context))
+		}
+	}
+
+	switch o := op.(type) {
+	case *fuseops.ReadDirOp:
+		o.Dst = make([]byte, os.Getpagesize())
+
+	case *fuseops.ReadDirPlusOp:
+		if o.Dst == nil {
+			o.Dst = make([]byte, os.Getpagesize())
+		}
+
+	case *fuseops.GetXattrOp:
+		o.Dst = make([]byte, o.BytesRead)
+
+	case *fuseops.ListXattrOp:
+		o.Dst = make([]byte, o.BytesRead)
+
+	case *fuseops.WriteFileOp:
+		// Only the size of the data is recorded, along with a prefix if payload
+		// capture was enabled.
+		size, err := intArg(wlog.Args, "Size")
+		if err != nil {
+			return nil, err
+		}
+
+		o.Data = make([]byte, size)
+		if payload, ok := wlog.Args["Payload"].(string); ok {
+			prefix, err := hex.DecodeString(payload)
+			if err != nil {
+				return nil, fmt.Errorf("decoding payload: %w", err)
+			}
+			copy(o.Data, prefix)
+		}
+	}
+
+	return op, nil
+}
+
+func intArg(args map[string]any, key string) (int, error) {
+	switch v := args[key].(type) {
+	case json.Number:
+		n, err := v.Int64()
+		return int(n), err
+	case float64:
+		return int(v), nil
+	case int:
+		return v, nil
+	}
+
+	return 0, fmt.Errorf("missing or malformed %s", key)
+}
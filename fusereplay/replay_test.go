@@ -0,0 +1,159 @@
+package fusereplay
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/samples/memfs"
+)
+
+// Run some ops against a fresh memfs, returning the wire log.
+func record(t *testing.T, compact bool) []*fuse.WireLogRecord {
+	var buf bytes.Buffer
+	cfg := &fuse.MountConfig{
+		WireLogger:          &buf,
+		WireLogCompactJSON:  compact,
+		WireLogPayloadBytes: 16,
+	}
+
+	k, err := fakekernel.Start(memfs.NewMemFS(0, 0), cfg)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	mkdir := &fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "dir", Mode: 0755}
+	create := &fuseops.CreateFileOp{Name: "foo", Mode: 0644}
+	ops := []func() interface{}{
+		func() interface{} { return mkdir },
+		func() interface{} {
+			create.Parent = mkdir.Entry.Child
+			return create
+		},
+		func() interface{} {
+			return &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: []byte("taco")}
+		},
+		func() interface{} {
+			return &fuseops.ReadFileOp{Inode: create.Entry.Child, Handle: create.Handle, Size: 4}
+		},
+		func() interface{} { return &fuseops.LookUpInodeOp{Parent: mkdir.Entry.Child, Name: "bar"} },
+	}
+
+	for _, f := range ops {
+		op := f()
+		if err := k.Do(ctx, op); err != nil && err != syscall.ENOENT {
+			t.Fatalf("%T: %v", op, err)
+		}
+	}
+
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	records, err := ReadRecords(&buf)
+	if err != nil {
+		t.Fatalf("ReadRecords: %v", err)
+	}
+
+	return records
+}
+
+func TestReplayMatches(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		records := record(t, compact)
+
+		results, err := Replay(context.Background(), memfs.NewMemFS(0, 0), records, &Options{Speed: 10})
+		if err != nil {
+			t.Fatalf("Replay: %v", err)
+		}
+
+		if len(results) != len(records) {
+			t.Fatalf("expected %d results, got %d", len(records), len(results))
+		}
+
+		var replayed int
+		for _, r := range results {
+			if r.Err != nil {
+				// The INIT handshake and mount lifecycle events are logged but
+				// can't be replayed.
+				switch r.Record.Operation {
+				case "initOp", "Mount", "Unmount":
+				default:
+					t.Errorf("%s: %v", r.Record.Operation, r.Err)
+				}
+				continue
+			}
+
+			replayed++
+			if r.Mismatch() {
+				t.Errorf("%s: recorded status %d, replayed %d", r.Record.Operation, r.Record.Status, r.Status)
+			}
+		}
+
+		if replayed != 5 {
+			t.Errorf("expected 5 replayed ops, got %d", replayed)
+		}
+	}
+}
+
+func TestReplayRemapsIDs(t *testing.T) {
+	// A log from a file system that minted different inode and handle IDs than
+	// memfs will.
+	const log = `
+{"Operation":"MkDirOp","StartTime":"2025-01-02T03:04:05Z","Args":{"Parent":1,"Name":"dir","Mode":2147484141,"Entry":{"Child":100}}}
+{"Operation":"CreateFileOp","StartTime":"2025-01-02T03:04:06Z","Args":{"Parent":100,"Name":"foo","Mode":420,"Entry":{"Child":101},"Handle":7}}
+{"Operation":"WriteFileOp","StartTime":"2025-01-02T03:04:07Z","Args":{"Inode":101,"Handle":7,"Offset":0,"Size":4,"Payload":"7461636f"}}
+{"Operation":"GetInodeAttributesOp","StartTime":"2025-01-02T03:04:08Z","Args":{"Inode":101}}
+`
+
+	records, err := ReadRecords(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("ReadRecords: %v", err)
+	}
+
+	results, err := Replay(context.Background(), memfs.NewMemFS(0, 0), records, nil)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+
+	for _, r := range results {
+		if r.Err != nil || r.Mismatch() {
+			t.Errorf("%s: err %v, status %v", r.Record.Operation, r.Err, r.Status)
+		}
+	}
+}
+
+func TestReplayDetectsMismatch(t *testing.T) {
+	records := record(t, false)
+
+	// Look up the file that exists rather than the one that didn't.
+	var lookUp *fuse.WireLogRecord
+	for _, r := range records {
+		if r.Operation == "LookUpInodeOp" {
+			lookUp = r
+			r.Args["Name"] = "foo"
+		}
+	}
+
+	results, err := Replay(context.Background(), memfs.NewMemFS(0, 0), records, nil)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+
+	for _, r := range results {
+		if r.Record == lookUp {
+			if !r.Mismatch() || r.Status != 0 {
+				t.Errorf("expected a successful mismatched lookup, got status %v", r.Status)
+			}
+			return
+		}
+	}
+
+	t.Errorf("no LookUpInodeOp result")
+}
@@ -0,0 +1,495 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fusetesting
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// ConformanceConfig configures RunConformanceTests.
+type ConformanceConfig struct {
+	// The names of tests to skip, for features that the file system doesn't
+	// support, e.g. "HardLinks". See ConformanceTests for the names.
+	Skip []string
+}
+
+// ConformanceTests lists the names of the tests run by RunConformanceTests,
+// in the order they're run:
+//
+//   - CreateExclusive: O_CREAT|O_EXCL fails for existing files.
+//   - ReadDir: listings reflect files created and removed.
+//   - Truncate: truncating shrinks files and extends them with zeroes.
+//   - RenameOverExisting: renaming replaces existing files and empty
+//     directories, but not directories that aren't empty.
+//   - UnlinkWhileOpen: files can be read and written after being unlinked
+//     while open.
+//   - HardLinks: hard links refer to the same file, whose link count they
+//     maintain.
+//   - Permissions: the permission bits are enforced. Skipped when running as
+//     root, which they don't apply to.
+//   - Mtime: modification times can be set, and are updated by writes and
+//     truncation.
+var ConformanceTests = []string{
+	"CreateExclusive",
+	"ReadDir",
+	"Truncate",
+	"RenameOverExisting",
+	"UnlinkWhileOpen",
+	"HardLinks",
+	"Permissions",
+	"Mtime",
+}
+
+var conformanceTests = map[string]func(t *testing.T, dir string){
+	"CreateExclusive":    testCreateExclusive,
+	"ReadDir":            testReadDir,
+	"Truncate":           testTruncate,
+	"RenameOverExisting": testRenameOverExisting,
+	"UnlinkWhileOpen":    testUnlinkWhileOpen,
+	"HardLinks":          testHardLinks,
+	"Permissions":        testPermissions,
+	"Mtime":              testMtime,
+}
+
+// RunConformanceTests checks that the file system mounted at dir follows
+// POSIX semantics that applications commonly rely on, using the usual system
+// calls. Each of ConformanceTests is run as a subtest of t, in its own
+// directory within dir, which it removes when done. The config may be nil.
+func RunConformanceTests(t *testing.T, dir string, cfg *ConformanceConfig) {
+	if cfg == nil {
+		cfg = &ConformanceConfig{}
+	}
+
+	skip := make(map[string]bool)
+	for _, name := range cfg.Skip {
+		skip[name] = true
+	}
+
+	for _, name := range ConformanceTests {
+		t.Run(name, func(t *testing.T) {
+			if skip[name] {
+				t.Skip("skipped by ConformanceConfig")
+			}
+
+			sub := filepath.Join(dir, name)
+			if err := os.Mkdir(sub, 0700); err != nil {
+				t.Fatalf("Mkdir: %v", err)
+			}
+			t.Cleanup(func() {
+				// Tests may leave directories that can't be written to.
+				filepath.WalkDir(sub, func(p string, d os.DirEntry, err error) error {
+					if err == nil && d.IsDir() {
+						os.Chmod(p, 0700)
+					}
+					return nil
+				})
+
+				if err := os.RemoveAll(sub); err != nil {
+					t.Errorf("RemoveAll: %v", err)
+				}
+			})
+
+			conformanceTests[name](t, sub)
+		})
+	}
+}
+
+// RunFileSystemConformanceTests mounts the file system at a temporary
+// directory with the supplied config, which may be nil, runs
+// RunConformanceTests there, and unmounts it. The test is skipped if the
+// file system can't be mounted, as when FUSE isn't available.
+func RunFileSystemConformanceTests(
+	t *testing.T,
+	fs fuseutil.FileSystem,
+	mountCfg *fuse.MountConfig,
+	cfg *ConformanceConfig) {
+	RunServerConformanceTests(t, fuseutil.NewFileSystemServer(fs), mountCfg, cfg)
+}
+
+// RunServerConformanceTests is like RunFileSystemConformanceTests, for file
+// systems that are only available as a fuse.Server.
+func RunServerConformanceTests(
+	t *testing.T,
+	server fuse.Server,
+	mountCfg *fuse.MountConfig,
+	cfg *ConformanceConfig) {
+	if mountCfg == nil {
+		mountCfg = &fuse.MountConfig{}
+	}
+
+	dir := t.TempDir()
+	mfs, err := fuse.Mount(dir, server, mountCfg)
+	if err != nil {
+		t.Skipf("Mount: %v", err)
+	}
+
+	defer func() {
+		delay := 10 * time.Millisecond
+		for {
+			err := fuse.Unmount(dir)
+			if err == nil {
+				break
+			}
+
+			if !strings.Contains(err.Error(), "resource busy") || delay > time.Second {
+				t.Fatalf("Unmount: %v", err)
+			}
+
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		if err := mfs.Join(context.Background()); err != nil {
+			t.Errorf("Join: %v", err)
+		}
+	}()
+
+	RunConformanceTests(t, dir, cfg)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+// Read the file, failing the test if that fails.
+func readFile(t *testing.T, p string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	return string(b)
+}
+
+// Write the file, failing the test if that fails.
+func writeFile(t *testing.T, p string, contents string) {
+	t.Helper()
+
+	if err := os.WriteFile(p, []byte(contents), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func testCreateExclusive(t *testing.T, dir string) {
+	p := filepath.Join(dir, "file")
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("creating a new file: %v", err)
+	}
+	f.Close()
+
+	if _, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600); !errors.Is(err, syscall.EEXIST) {
+		t.Errorf("creating an existing file: %v, want EEXIST", err)
+	}
+}
+
+func testReadDir(t *testing.T, dir string) {
+	names := func() []string {
+		t.Helper()
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("ReadDir: %v", err)
+		}
+
+		var names []string
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() {
+				name += "/"
+			}
+			names = append(names, name)
+		}
+
+		return names
+	}
+
+	writeFile(t, filepath.Join(dir, "a"), "")
+	writeFile(t, filepath.Join(dir, "b"), "")
+	if err := os.Mkdir(filepath.Join(dir, "c"), 0700); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+
+	if got, want := names(), []string{"a", "b", "c/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %q, want %q", got, want)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "b")); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	if got, want := names(), []string{"a", "c/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %q after removal, want %q", got, want)
+	}
+}
+
+func testTruncate(t *testing.T, dir string) {
+	p := filepath.Join(dir, "file")
+	writeFile(t, p, "hello world")
+
+	if err := os.Truncate(p, 5); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	if got := readFile(t, p); got != "hello" {
+		t.Errorf("after shrinking: %q", got)
+	}
+
+	if err := os.Truncate(p, 8); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	if got := readFile(t, p); got != "hello\x00\x00\x00" {
+		t.Errorf("after extending: %q", got)
+	}
+}
+
+func testRenameOverExisting(t *testing.T, dir string) {
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	writeFile(t, a, "taco")
+	writeFile(t, b, "burrito")
+
+	if err := os.Rename(a, b); err != nil {
+		t.Fatalf("renaming over a file: %v", err)
+	}
+	if got := readFile(t, b); got != "taco" {
+		t.Errorf("renamed file contains %q", got)
+	}
+	if _, err := os.Lstat(a); !errors.Is(err, syscall.ENOENT) {
+		t.Errorf("old name: %v, want ENOENT", err)
+	}
+
+	// Directories replace empty directories only. os.Rename refuses to replace
+	// directories itself, so call rename(2) directly.
+	mkdir := func(name string, withFile bool) string {
+		t.Helper()
+
+		p := filepath.Join(dir, name)
+		if err := os.Mkdir(p, 0700); err != nil {
+			t.Fatalf("Mkdir: %v", err)
+		}
+		if withFile {
+			writeFile(t, filepath.Join(p, "file"), "")
+		}
+
+		return p
+	}
+
+	src, empty, full := mkdir("src", true), mkdir("empty", false), mkdir("full", true)
+	if err := syscall.Rename(src, empty); err != nil {
+		t.Fatalf("renaming over an empty directory: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(empty, "file")); err != nil {
+		t.Errorf("renamed directory: %v", err)
+	}
+
+	err := syscall.Rename(empty, full)
+	if !errors.Is(err, syscall.ENOTEMPTY) && !errors.Is(err, syscall.EEXIST) {
+		t.Errorf("renaming over a directory that isn't empty: %v, want ENOTEMPTY or EEXIST", err)
+	}
+}
+
+func testUnlinkWhileOpen(t *testing.T, dir string) {
+	p := filepath.Join(dir, "file")
+	writeFile(t, p, "taco")
+
+	f, err := os.OpenFile(p, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer f.Close()
+
+	if err := os.Remove(p); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := os.Lstat(p); !errors.Is(err, syscall.ENOENT) {
+		t.Errorf("Lstat after removal: %v, want ENOENT", err)
+	}
+
+	if _, err := f.WriteAt([]byte("burrito"), 4); err != nil {
+		t.Errorf("writing after removal: %v", err)
+	}
+
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	if got := string(buf[:n]); got != "tacoburrito" {
+		t.Errorf("read %q after removal, want %q", got, "tacoburrito")
+	}
+
+	if fi, err := f.Stat(); err != nil || fi.Size() != 11 {
+		t.Errorf("Stat after removal: %v, %v", fi, err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func testHardLinks(t *testing.T, dir string) {
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	writeFile(t, a, "taco")
+
+	if err := os.Link(a, b); err != nil {
+		t.Fatalf("Link: %v", err)
+	}
+
+	nlink := func(p string) uint64 {
+		t.Helper()
+
+		fi, err := os.Lstat(p)
+		if err != nil {
+			t.Fatalf("Lstat: %v", err)
+		}
+
+		n, ok := extractNlink(fi.Sys())
+		if !ok {
+			t.Fatalf("no link count for %s", p)
+		}
+
+		return n
+	}
+
+	if n := nlink(a); n != 2 {
+		t.Errorf("link count %d, want 2", n)
+	}
+
+	// Writes through one name are seen through the other.
+	f, err := os.OpenFile(b, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if _, err := f.WriteString("burrito"); err != nil {
+		t.Errorf("WriteString: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	if got := readFile(t, a); got != "tacoburrito" {
+		t.Errorf("read %q through the other link", got)
+	}
+
+	if err := os.Remove(a); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if n := nlink(b); n != 1 {
+		t.Errorf("link count %d after removing a link, want 1", n)
+	}
+	if got := readFile(t, b); got != "tacoburrito" {
+		t.Errorf("read %q after removing a link", got)
+	}
+}
+
+func testPermissions(t *testing.T, dir string) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions aren't enforced for root")
+	}
+
+	p := filepath.Join(dir, "file")
+	writeFile(t, p, "taco")
+
+	if err := os.Chmod(p, 0200); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+	if _, err := os.Open(p); !errors.Is(err, syscall.EACCES) {
+		t.Errorf("opening a write-only file for reading: %v, want EACCES", err)
+	}
+
+	if err := os.Chmod(p, 0400); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+	if _, err := os.OpenFile(p, os.O_WRONLY, 0); !errors.Is(err, syscall.EACCES) {
+		t.Errorf("opening a read-only file for writing: %v, want EACCES", err)
+	}
+	if got := readFile(t, p); got != "taco" {
+		t.Errorf("read %q from a read-only file", got)
+	}
+
+	if err := os.Chmod(dir, 0500); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+	defer os.Chmod(dir, 0700)
+
+	if err := os.WriteFile(filepath.Join(dir, "new"), nil, 0600); !errors.Is(err, syscall.EACCES) {
+		t.Errorf("creating a file in a read-only directory: %v, want EACCES", err)
+	}
+}
+
+func testMtime(t *testing.T, dir string) {
+	p := filepath.Join(dir, "file")
+	writeFile(t, p, "taco")
+
+	mtime := func() time.Time {
+		t.Helper()
+
+		fi, err := os.Lstat(p)
+		if err != nil {
+			t.Fatalf("Lstat: %v", err)
+		}
+
+		return fi.ModTime()
+	}
+
+	past := time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC)
+	setPast := func() {
+		t.Helper()
+
+		if err := os.Chtimes(p, past, past); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+
+	setPast()
+	if got := mtime(); !got.Equal(past) {
+		t.Errorf("mtime %v after Chtimes, want %v", got, past)
+	}
+
+	// Writing updates it.
+	f, err := os.OpenFile(p, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if _, err := f.Write(bytes.Repeat([]byte("x"), 8)); err != nil {
+		t.Errorf("Write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	if got := mtime(); !got.After(past) {
+		t.Errorf("mtime %v after writing, want later than %v", got, past)
+	}
+
+	// So does truncating.
+	setPast()
+	if err := os.Truncate(p, 2); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	if got := mtime(); !got.After(past) {
+		t.Errorf("mtime %v after truncating, want later than %v", got, past)
+	}
+}
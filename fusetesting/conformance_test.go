@@ -0,0 +1,34 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package fusetesting_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jacobsa/fuse/fusetesting"
+	"github.com/jacobsa/fuse/samples/memfs"
+)
+
+func TestConformanceTempDir(t *testing.T) {
+	fusetesting.RunConformanceTests(t, t.TempDir(), nil)
+}
+
+func TestConformanceMemFS(t *testing.T) {
+	server := memfs.NewMemFS(uint32(os.Getuid()), uint32(os.Getgid()))
+	fusetesting.RunServerConformanceTests(t, server, nil, nil)
+}
@@ -0,0 +1,70 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fusetesting
+
+import (
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+// A FakeKernel drives a fuse.Server in-process, playing the part of the
+// kernel in the FUSE protocol, so that file systems can be tested without
+// /dev/fuse, root, or a mount point. Ops are supplied to its Do method as
+// fuseops structs, and sent to the server as the messages that the kernel
+// would send for them, through the same fuse.Connection that serves a real
+// mount. The server's reply is decoded back into the op's output fields, and
+// its error returned as a syscall.Errno.
+//
+// For example:
+//
+//	k, err := fusetesting.StartFileSystem(fs, nil)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer k.Close()
+//
+//	op := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "foo"}
+//	if err := k.Do(ctx, op); err != nil {
+//		t.Fatal(err)
+//	}
+//
+// The kernel's caches are not simulated: each call to Do reaches the server.
+// FakeKernel is currently supported only on Linux; elsewhere StartFakeKernel
+// returns an error.
+type FakeKernel = fakekernel.Kernel
+
+// A FakeKernelNotification is a message sent by the server to a FakeKernel
+// through fuse.Notifier, as delivered by FakeKernel.Notifications.
+type FakeKernelNotification = fakekernel.Notification
+
+// ErrFakeKernelClosed is returned by FakeKernel.Do after Close has been
+// called, or after the server has hung up.
+var ErrFakeKernelClosed = fakekernel.ErrClosed
+
+// StartFakeKernel serves a FakeKernel with the supplied server, performing
+// the INIT handshake before returning. The config is treated as fuse.Mount
+// would treat it; it may be nil.
+//
+// Close must eventually be called on the FakeKernel to shut down the server.
+func StartFakeKernel(server fuse.Server, cfg *fuse.MountConfig) (*FakeKernel, error) {
+	return fakekernel.Start(server, cfg)
+}
+
+// StartFileSystem is like StartFakeKernel, serving the file system with
+// fuseutil.NewFileSystemServer.
+func StartFileSystem(fs fuseutil.FileSystem, cfg *fuse.MountConfig) (*FakeKernel, error) {
+	return fakekernel.Start(fuseutil.NewFileSystemServer(fs), cfg)
+}
@@ -0,0 +1,63 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package fusetesting_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fusetesting"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// A file system with nothing but an empty root directory.
+type emptyFS struct {
+	fuseutil.NotImplementedFileSystem
+}
+
+func (fs *emptyFS) GetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.GetInodeAttributesOp) error {
+	op.Attributes = fuseops.InodeAttributes{Nlink: 1, Mode: os.ModeDir | 0755}
+	return nil
+}
+
+func ExampleStartFileSystem() {
+	k, err := fusetesting.StartFileSystem(&emptyFS{}, nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer k.Close()
+
+	ctx := context.Background()
+	op := &fuseops.GetInodeAttributesOp{Inode: fuseops.RootInodeID}
+	if err := k.Do(ctx, op); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(op.Attributes.Mode)
+
+	err = k.Do(ctx, &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "foo"})
+	fmt.Println(err)
+
+	// Output:
+	// drwxr-xr-x
+	// function not implemented
+}
@@ -0,0 +1,404 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"context"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// The bits of the mask of access(2), as in AccessOp.Mask.
+const (
+	accessRead    = 4
+	accessWrite   = 2
+	accessExecute = 1
+)
+
+// CheckAccess checks whether the caller of an op may access an inode with
+// the given attributes in the ways given by mask, a combination of the
+// bits of AccessOp.Mask, following the POSIX rules for the owner, group, and
+// others permission bits. It returns nil if so, and EACCES otherwise.
+//
+// UID 0 may do anything, except execute files for which no execute bit is
+// set. Only the primary group of the caller is considered, since the kernel
+// doesn't pass the others.
+func CheckAccess(
+	attrs fuseops.InodeAttributes,
+	caller fuseops.OpContext,
+	mask uint32) error {
+	mask &= accessRead | accessWrite | accessExecute
+	perm := uint32(attrs.Mode.Perm())
+
+	if caller.Uid == 0 {
+		if mask&accessExecute != 0 && !attrs.Mode.IsDir() && perm&0111 == 0 {
+			return syscall.EACCES
+		}
+		return nil
+	}
+
+	var granted uint32
+	switch {
+	case caller.Uid == attrs.Uid:
+		granted = perm >> 6
+	case caller.Gid == attrs.Gid:
+		granted = perm >> 3
+	default:
+		granted = perm
+	}
+
+	if mask&^granted != 0 {
+		return syscall.EACCES
+	}
+
+	return nil
+}
+
+// NewAccessControlFileSystem returns a FileSystem that checks whether the
+// callers of ops may do what they ask before passing them on to the wrapped
+// file system, as the kernel does when mounted with default permissions. It
+// is for file systems mounted with fuse.MountConfig.DisableDefaultPermissions
+// that still want permissions enforced, e.g. because the kernel would
+// otherwise check them against attributes that are stale or approximate.
+//
+// Permissions are checked with CheckAccess against the attributes returned by
+// the wrapped file system's GetInodeAttributes, as follows:
+//
+//   - Looking up a name needs execute permission on the directory, and
+//     creating or removing one needs write and execute permission on it. In
+//     a directory with the sticky bit set, only the owners of the directory
+//     and of the file, and UID 0, may remove or rename the file.
+//   - Opening a file or directory needs permission for the access mode that
+//     it's opened with, and truncating a file needs write permission on it.
+//     Reads and writes of open files aren't checked, as with the kernel.
+//   - Changing the mode of an inode is for its owner, changing the owner is
+//     for UID 0, and changing the group is for the owner, to their own group.
+//     Changing times needs ownership or write permission, since the kernel
+//     doesn't say whether they are being set to the current time.
+//   - Extended attributes in the "user." namespace need read or write
+//     permission, and those in the "trusted." namespace need UID 0.
+//
+// Ops that fail the checks fail with EACCES or EPERM, as for the system
+// calls that send them.
+func NewAccessControlFileSystem(fs FileSystem) FileSystem {
+	return &accessControlFS{FileSystem: fs}
+}
+
+type accessControlFS struct {
+	FileSystem
+}
+
+func (fs *accessControlFS) attributes(
+	ctx context.Context,
+	inode fuseops.InodeID,
+	caller fuseops.OpContext) (fuseops.InodeAttributes, error) {
+	op := &fuseops.GetInodeAttributesOp{Inode: inode, OpContext: caller}
+	err := fs.FileSystem.GetInodeAttributes(ctx, op)
+	return op.Attributes, err
+}
+
+func (fs *accessControlFS) check(
+	ctx context.Context,
+	inode fuseops.InodeID,
+	caller fuseops.OpContext,
+	mask uint32) error {
+	attrs, err := fs.attributes(ctx, inode, caller)
+	if err != nil {
+		return err
+	}
+
+	return CheckAccess(attrs, caller, mask)
+}
+
+// Check that the caller may remove the named child of the directory, and
+// return its attributes if it exists.
+func (fs *accessControlFS) checkRemove(
+	ctx context.Context,
+	parent fuseops.InodeID,
+	name string,
+	caller fuseops.OpContext) (*fuseops.InodeAttributes, error) {
+	parentAttrs, err := fs.attributes(ctx, parent, caller)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckAccess(parentAttrs, caller, accessWrite|accessExecute); err != nil {
+		return nil, err
+	}
+
+	lookUp := &fuseops.LookUpInodeOp{Parent: parent, Name: name, OpContext: caller}
+	if err := fs.FileSystem.LookUpInode(ctx, lookUp); err != nil {
+		return nil, err
+	}
+	fs.FileSystem.ForgetInode(ctx, &fuseops.ForgetInodeOp{Inode: lookUp.Entry.Child, N: 1, OpContext: caller})
+
+	child := lookUp.Entry.Attributes
+	if parentAttrs.Mode&os.ModeSticky != 0 &&
+		caller.Uid != 0 &&
+		caller.Uid != parentAttrs.Uid &&
+		caller.Uid != child.Uid {
+		return nil, syscall.EPERM
+	}
+
+	return &child, nil
+}
+
+// Check the access needed for an xattr of the given name.
+func (fs *accessControlFS) checkXattr(
+	ctx context.Context,
+	inode fuseops.InodeID,
+	name string,
+	caller fuseops.OpContext,
+	mask uint32) error {
+	switch {
+	case strings.HasPrefix(name, "user."):
+		return fs.check(ctx, inode, caller, mask)
+
+	case strings.HasPrefix(name, "trusted."):
+		if caller.Uid != 0 {
+			return syscall.EPERM
+		}
+	}
+
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////
+// FileSystem methods
+////////////////////////////////////////////////////////////////////////
+
+func (fs *accessControlFS) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	if err := fs.check(ctx, op.Parent, op.OpContext, accessExecute); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.LookUpInode(ctx, op)
+}
+
+func (fs *accessControlFS) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	attrs, err := fs.attributes(ctx, op.Inode, op.OpContext)
+	if err != nil {
+		return err
+	}
+
+	caller := op.OpContext
+	isOwner := caller.Uid == 0 || caller.Uid == attrs.Uid
+
+	if op.Mode != nil && !isOwner {
+		return syscall.EPERM
+	}
+	if op.Uid != nil && *op.Uid != attrs.Uid && caller.Uid != 0 {
+		return syscall.EPERM
+	}
+	if op.Gid != nil && *op.Gid != attrs.Gid && caller.Uid != 0 &&
+		(caller.Uid != attrs.Uid || *op.Gid != caller.Gid) {
+		return syscall.EPERM
+	}
+	if (op.Atime != nil || op.Mtime != nil) && !isOwner {
+		if err := CheckAccess(attrs, caller, accessWrite); err != nil {
+			return syscall.EPERM
+		}
+	}
+
+	// Truncating an open file was checked when it was opened.
+	if op.Size != nil && op.Handle == nil {
+		if err := CheckAccess(attrs, caller, accessWrite); err != nil {
+			return err
+		}
+	}
+
+	return fs.FileSystem.SetInodeAttributes(ctx, op)
+}
+
+func (fs *accessControlFS) MkDir(
+	ctx context.Context,
+	op *fuseops.MkDirOp) error {
+	if err := fs.check(ctx, op.Parent, op.OpContext, accessWrite|accessExecute); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.MkDir(ctx, op)
+}
+
+func (fs *accessControlFS) MkNode(
+	ctx context.Context,
+	op *fuseops.MkNodeOp) error {
+	if err := fs.check(ctx, op.Parent, op.OpContext, accessWrite|accessExecute); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.MkNode(ctx, op)
+}
+
+func (fs *accessControlFS) CreateFile(
+	ctx context.Context,
+	op *fuseops.CreateFileOp) error {
+	if err := fs.check(ctx, op.Parent, op.OpContext, accessWrite|accessExecute); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.CreateFile(ctx, op)
+}
+
+func (fs *accessControlFS) CreateTmpFile(
+	ctx context.Context,
+	op *fuseops.CreateTmpFileOp) error {
+	if err := fs.check(ctx, op.Parent, op.OpContext, accessWrite|accessExecute); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.CreateTmpFile(ctx, op)
+}
+
+func (fs *accessControlFS) CreateLink(
+	ctx context.Context,
+	op *fuseops.CreateLinkOp) error {
+	if err := fs.check(ctx, op.Parent, op.OpContext, accessWrite|accessExecute); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.CreateLink(ctx, op)
+}
+
+func (fs *accessControlFS) CreateSymlink(
+	ctx context.Context,
+	op *fuseops.CreateSymlinkOp) error {
+	if err := fs.check(ctx, op.Parent, op.OpContext, accessWrite|accessExecute); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.CreateSymlink(ctx, op)
+}
+
+func (fs *accessControlFS) Rename(
+	ctx context.Context,
+	op *fuseops.RenameOp) error {
+	src, err := fs.checkRemove(ctx, op.OldParent, op.OldName, op.OpContext)
+	if err != nil {
+		return err
+	}
+
+	// The destination may not exist, in which case only the directory
+	// matters.
+	_, err = fs.checkRemove(ctx, op.NewParent, op.NewName, op.OpContext)
+	if err != nil && err != syscall.ENOENT {
+		return err
+	}
+
+	// A directory that moves to another one has its ".." entry updated.
+	if src.Mode.IsDir() && op.OldParent != op.NewParent {
+		if err := CheckAccess(*src, op.OpContext, accessWrite); err != nil {
+			return err
+		}
+	}
+
+	return fs.FileSystem.Rename(ctx, op)
+}
+
+func (fs *accessControlFS) RmDir(
+	ctx context.Context,
+	op *fuseops.RmDirOp) error {
+	if _, err := fs.checkRemove(ctx, op.Parent, op.Name, op.OpContext); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.RmDir(ctx, op)
+}
+
+func (fs *accessControlFS) Unlink(
+	ctx context.Context,
+	op *fuseops.UnlinkOp) error {
+	if _, err := fs.checkRemove(ctx, op.Parent, op.Name, op.OpContext); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.Unlink(ctx, op)
+}
+
+func (fs *accessControlFS) OpenDir(
+	ctx context.Context,
+	op *fuseops.OpenDirOp) error {
+	if err := fs.check(ctx, op.Inode, op.OpContext, accessRead); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.OpenDir(ctx, op)
+}
+
+func (fs *accessControlFS) OpenFile(
+	ctx context.Context,
+	op *fuseops.OpenFileOp) error {
+	var mask uint32
+	switch {
+	case op.OpenFlags.IsReadOnly():
+		mask = accessRead
+	case op.OpenFlags.IsWriteOnly():
+		mask = accessWrite
+	case op.OpenFlags.IsReadWrite():
+		mask = accessRead | accessWrite
+	}
+	if op.OpenFlags.IsTruncate() {
+		mask |= accessWrite
+	}
+
+	if err := fs.check(ctx, op.Inode, op.OpContext, mask); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.OpenFile(ctx, op)
+}
+
+func (fs *accessControlFS) GetXattr(
+	ctx context.Context,
+	op *fuseops.GetXattrOp) error {
+	if err := fs.checkXattr(ctx, op.Inode, op.Name, op.OpContext, accessRead); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.GetXattr(ctx, op)
+}
+
+func (fs *accessControlFS) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) error {
+	if err := fs.checkXattr(ctx, op.Inode, op.Name, op.OpContext, accessWrite); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.SetXattr(ctx, op)
+}
+
+func (fs *accessControlFS) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) error {
+	if err := fs.checkXattr(ctx, op.Inode, op.Name, op.OpContext, accessWrite); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.RemoveXattr(ctx, op)
+}
+
+func (fs *accessControlFS) Access(
+	ctx context.Context,
+	op *fuseops.AccessOp) error {
+	return fs.check(ctx, op.Inode, op.OpContext, op.Mask)
+}
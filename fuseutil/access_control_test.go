@@ -0,0 +1,121 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+// A file system with a sticky, world-writable root directory holding a file
+// and a private directory, both owned by UID 1000.
+type permFS struct {
+	fuseutil.NotImplementedFileSystem
+}
+
+var permFSAttrs = map[fuseops.InodeID]fuseops.InodeAttributes{
+	fuseops.RootInodeID: {Mode: os.ModeDir | os.ModeSticky | 0777},
+	2:                   {Mode: 0640, Uid: 1000, Gid: 100},
+	3:                   {Mode: os.ModeDir | 0700, Uid: 1000, Gid: 100},
+}
+
+func (fs *permFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) error {
+	if op.Parent != fuseops.RootInodeID {
+		return fuse.ENOENT
+	}
+	switch op.Name {
+	case "file":
+		op.Entry.Child = 2
+	case "dir":
+		op.Entry.Child = 3
+	default:
+		return fuse.ENOENT
+	}
+	op.Entry.Attributes = permFSAttrs[op.Entry.Child]
+	return nil
+}
+
+func (fs *permFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAttributesOp) error {
+	op.Attributes = permFSAttrs[op.Inode]
+	return nil
+}
+
+func (fs *permFS) ForgetInode(ctx context.Context, op *fuseops.ForgetInodeOp) error {
+	return nil
+}
+
+func (fs *permFS) OpenFile(ctx context.Context, op *fuseops.OpenFileOp) error {
+	return nil
+}
+
+func (fs *permFS) Unlink(ctx context.Context, op *fuseops.UnlinkOp) error {
+	return nil
+}
+
+func TestAccessControlFileSystem(t *testing.T) {
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fuseutil.NewAccessControlFileSystem(&permFS{})), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	owner := fuseops.OpContext{Uid: 1000, Gid: 100}
+	group := fuseops.OpContext{Uid: 2000, Gid: 100}
+	other := fuseops.OpContext{Uid: 3000, Gid: 300}
+	root := fuseops.OpContext{}
+	mode := os.FileMode(0600)
+
+	testCases := []struct {
+		op   any
+		want error
+	}{
+		// Opening follows the permission bits.
+		{&fuseops.OpenFileOp{Inode: 2, OpenFlags: fusekernel.OpenReadWrite, OpContext: owner}, nil},
+		{&fuseops.OpenFileOp{Inode: 2, OpenFlags: fusekernel.OpenReadOnly, OpContext: group}, nil},
+		{&fuseops.OpenFileOp{Inode: 2, OpenFlags: fusekernel.OpenReadWrite, OpContext: group}, syscall.EACCES},
+		{&fuseops.OpenFileOp{Inode: 2, OpenFlags: fusekernel.OpenReadOnly | fusekernel.OpenTruncate, OpContext: group}, syscall.EACCES},
+		{&fuseops.OpenFileOp{Inode: 2, OpenFlags: fusekernel.OpenReadOnly, OpContext: other}, syscall.EACCES},
+		{&fuseops.OpenFileOp{Inode: 2, OpenFlags: fusekernel.OpenReadWrite, OpContext: root}, nil},
+
+		// Looking names up needs search permission.
+		{&fuseops.LookUpInodeOp{Parent: 3, Name: "x", OpContext: group}, syscall.EACCES},
+		{&fuseops.LookUpInodeOp{Parent: 3, Name: "x", OpContext: owner}, syscall.ENOENT},
+
+		// Only the owner may change the mode.
+		{&fuseops.SetInodeAttributesOp{Inode: 2, Mode: &mode, OpContext: group}, syscall.EPERM},
+		{&fuseops.AccessOp{Inode: 2, Mask: 2, OpContext: group}, syscall.EACCES},
+		{&fuseops.AccessOp{Inode: 2, Mask: 4, OpContext: group}, nil},
+		{&fuseops.AccessOp{Inode: 2, Mask: 1, OpContext: root}, syscall.EACCES},
+
+		// Only the owner of the file may remove it from a sticky directory.
+		{&fuseops.UnlinkOp{Parent: fuseops.RootInodeID, Name: "file", OpContext: other}, syscall.EPERM},
+		{&fuseops.UnlinkOp{Parent: fuseops.RootInodeID, Name: "file", OpContext: owner}, nil},
+	}
+
+	for i, tc := range testCases {
+		if err := k.Do(ctx, tc.op); err != tc.want {
+			t.Errorf("case %d: %T: got %v, want %v", i, tc.op, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The names of the extended attributes in which the kernel expects to find
+// POSIX ACLs when fuse.MountConfig.EnablePosixACL is set. The access ACL of
+// an inode governs access to it, and the default ACL of a directory is the one
+// that new inodes within it inherit.
+const (
+	XattrPosixACLAccess  = "system.posix_acl_access"
+	XattrPosixACLDefault = "system.posix_acl_default"
+)
+
+// ACLTag says whom an ACLEntry applies to.
+type ACLTag uint16
+
+const (
+	ACL_UserObj  ACLTag = 0x01 // The owner of the inode
+	ACL_User     ACLTag = 0x02 // The user whose ID is ACLEntry.ID
+	ACL_GroupObj ACLTag = 0x04 // The owning group of the inode
+	ACL_Group    ACLTag = 0x08 // The group whose ID is ACLEntry.ID
+	ACL_Mask     ACLTag = 0x10 // The most that ACL_User and ACL_Group entries grant
+	ACL_Other    ACLTag = 0x20 // Everyone else
+)
+
+// Permission bits for ACLEntry.Perm.
+const (
+	ACL_Read    = 0x4
+	ACL_Write   = 0x2
+	ACL_Execute = 0x1
+)
+
+// An ACLEntry grants permissions to a user or group.
+type ACLEntry struct {
+	Tag ACLTag
+
+	// Some combination of ACL_Read, ACL_Write, and ACL_Execute.
+	Perm uint16
+
+	// The user or group ID for ACL_User and ACL_Group entries. Ignored for
+	// other tags.
+	ID uint32
+}
+
+// An ACL is a POSIX access control list, as stored in the extended attributes
+// named by XattrPosixACLAccess and XattrPosixACLDefault. The kernel expects
+// the entries to be sorted by tag, and for ACL_User and ACL_Group entries by
+// ID, and to include exactly one each of ACL_UserObj, ACL_GroupObj, and
+// ACL_Other, plus ACL_Mask if there are any ACL_User or ACL_Group entries.
+type ACL []ACLEntry
+
+// The version of the xattr format of ACLs, and the value stored in the ID of
+// entries that don't have one.
+const (
+	aclVersion     = 2
+	aclUndefinedID = ^uint32(0)
+)
+
+// The sizes of the header of the xattr format, and of each entry in it.
+const (
+	aclHeaderSize = 4
+	aclEntrySize  = 8
+)
+
+// EncodeACL returns the value of the extended attribute that stores the
+// supplied ACL, for returning from GetXattrOp.
+func EncodeACL(acl ACL) []byte {
+	b := make([]byte, aclHeaderSize, aclHeaderSize+aclEntrySize*len(acl))
+	binary.LittleEndian.PutUint32(b, aclVersion)
+
+	for _, e := range acl {
+		id := e.ID
+		if e.Tag != ACL_User && e.Tag != ACL_Group {
+			id = aclUndefinedID
+		}
+
+		b = binary.LittleEndian.AppendUint16(b, uint16(e.Tag))
+		b = binary.LittleEndian.AppendUint16(b, e.Perm)
+		b = binary.LittleEndian.AppendUint32(b, id)
+	}
+
+	return b
+}
+
+// DecodeACL parses the value of an extended attribute that stores an ACL, as
+// found in SetXattrOp.Value. It checks the format, but not that the entries
+// make sense together.
+func DecodeACL(b []byte) (ACL, error) {
+	if len(b) < aclHeaderSize || (len(b)-aclHeaderSize)%aclEntrySize != 0 {
+		return nil, fmt.Errorf("bad ACL length %d", len(b))
+	}
+
+	if v := binary.LittleEndian.Uint32(b); v != aclVersion {
+		return nil, fmt.Errorf("unsupported ACL version %d", v)
+	}
+
+	acl := make(ACL, 0, (len(b)-aclHeaderSize)/aclEntrySize)
+	for b = b[aclHeaderSize:]; len(b) > 0; b = b[aclEntrySize:] {
+		e := ACLEntry{
+			Tag:  ACLTag(binary.LittleEndian.Uint16(b[0:])),
+			Perm: binary.LittleEndian.Uint16(b[2:]),
+		}
+
+		switch e.Tag {
+		case ACL_User, ACL_Group:
+			e.ID = binary.LittleEndian.Uint32(b[4:])
+		case ACL_UserObj, ACL_GroupObj, ACL_Mask, ACL_Other:
+		default:
+			return nil, fmt.Errorf("unknown ACL tag %#x", e.Tag)
+		}
+
+		acl = append(acl, e)
+	}
+
+	return acl, nil
+}
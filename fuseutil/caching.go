@@ -0,0 +1,450 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/timeutil"
+)
+
+// CachingConfig configures NewCachingFileSystem.
+type CachingConfig struct {
+	// How long the results of GetInodeAttributes and LookUpInode are cached.
+	// Zero disables the respective cache.
+	AttributeTTL time.Duration
+	EntryTTL     time.Duration
+
+	// The clock used to expire cached results. If nil, the real clock is used.
+	Clock timeutil.Clock
+}
+
+// A CachingFileSystem is a FileSystem that caches the results of another's
+// GetInodeAttributes and LookUpInode methods, as returned by
+// NewCachingFileSystem.
+//
+// The cache is kept up to date with changes made through it, but not with
+// changes made to the wrapped file system by other means, about which it must
+// be told with its Invalidate methods. These only affect the cache of the
+// daemon. Use fuse.Notifier to also invalidate the kernel's cache.
+type CachingFileSystem interface {
+	FileSystem
+
+	// Drop the cached attributes of an inode.
+	InvalidateInode(inode fuseops.InodeID)
+
+	// Drop the cached result of looking up the named child of a directory.
+	InvalidateEntry(parent fuseops.InodeID, name string)
+
+	// Drop everything that is cached.
+	InvalidateAll()
+}
+
+// NewCachingFileSystem returns a FileSystem that forwards all ops to the
+// supplied one, but serves GetInodeAttributes and LookUpInode from a cache
+// for the given time after the wrapped file system last answered them. This
+// complements the caching that the kernel does according to the expiration
+// times of attributes and entries, which is dropped when the kernel evicts
+// inodes, and which the kernel may be told to skip entirely.
+//
+// Lookups that are served from the cache aren't seen by the wrapped file
+// system, so the cache takes them out of the counts that ForgetInode and
+// BatchForget pass on to it, and drops what it knows about an inode once the
+// kernel has forgotten it.
+func NewCachingFileSystem(wrapped FileSystem, cfg CachingConfig) CachingFileSystem {
+	if cfg.Clock == nil {
+		cfg.Clock = timeutil.RealClock()
+	}
+
+	return &cachingFS{
+		FileSystem: wrapped,
+		cfg:        cfg,
+		attrs:      make(map[fuseops.InodeID]cachedAttributes),
+		entries:    make(map[cachedEntryKey]cachedEntry),
+		lookups:    make(map[fuseops.InodeID]*cachedLookups),
+	}
+}
+
+type cachedAttributes struct {
+	attributes fuseops.InodeAttributes
+	expiration time.Time // As returned by the wrapped file system
+	expires    time.Time // Of the cache entry
+}
+
+type cachedEntryKey struct {
+	parent fuseops.InodeID
+	name   string
+}
+
+type cachedEntry struct {
+	entry   fuseops.ChildInodeEntry
+	expires time.Time
+}
+
+// The kernel's lookups of an inode, and how many of them were served from the
+// cache.
+//
+// INVARIANT: cached <= kernel
+type cachedLookups struct {
+	kernel uint64
+	cached uint64
+}
+
+type cachingFS struct {
+	FileSystem
+	cfg CachingConfig
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	attrs   map[fuseops.InodeID]cachedAttributes
+	entries map[cachedEntryKey]cachedEntry
+
+	// The lookup counts of the inodes in entries, and of those that the kernel
+	// otherwise learned of through LookUpInode.
+	//
+	// GUARDED_BY(mu)
+	lookups map[fuseops.InodeID]*cachedLookups
+}
+
+func (fs *cachingFS) InvalidateInode(inode fuseops.InodeID) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	delete(fs.attrs, inode)
+}
+
+func (fs *cachingFS) InvalidateEntry(parent fuseops.InodeID, name string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	delete(fs.entries, cachedEntryKey{parent, name})
+}
+
+func (fs *cachingFS) InvalidateAll() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	clear(fs.attrs)
+	clear(fs.entries)
+}
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *cachingFS) invalidate(inodes ...fuseops.InodeID) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for _, inode := range inodes {
+		delete(fs.attrs, inode)
+	}
+}
+
+// LOCKS_REQUIRED(fs.mu)
+func (fs *cachingFS) cacheAttributes(
+	inode fuseops.InodeID,
+	attributes fuseops.InodeAttributes,
+	expiration time.Time) {
+	if fs.cfg.AttributeTTL <= 0 {
+		return
+	}
+
+	fs.attrs[inode] = cachedAttributes{
+		attributes: attributes,
+		expiration: expiration,
+		expires:    fs.cfg.Clock.Now().Add(fs.cfg.AttributeTTL),
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// FileSystem methods
+////////////////////////////////////////////////////////////////////////
+
+func (fs *cachingFS) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	key := cachedEntryKey{op.Parent, op.Name}
+
+	fs.mu.Lock()
+	if e, ok := fs.entries[key]; ok {
+		if fs.cfg.Clock.Now().Before(e.expires) {
+			op.Entry = e.entry
+			if a, ok := fs.attrs[e.entry.Child]; ok {
+				op.Entry.Attributes = a.attributes
+			}
+
+			l := fs.lookups[e.entry.Child]
+			l.kernel++
+			l.cached++
+			fs.mu.Unlock()
+			return nil
+		}
+		delete(fs.entries, key)
+	}
+	fs.mu.Unlock()
+
+	if err := fs.FileSystem.LookUpInode(ctx, op); err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	l, ok := fs.lookups[op.Entry.Child]
+	if !ok {
+		l = &cachedLookups{}
+		fs.lookups[op.Entry.Child] = l
+	}
+	l.kernel++
+
+	if fs.cfg.EntryTTL > 0 {
+		fs.entries[key] = cachedEntry{
+			entry:   op.Entry,
+			expires: fs.cfg.Clock.Now().Add(fs.cfg.EntryTTL),
+		}
+	}
+	fs.cacheAttributes(op.Entry.Child, op.Entry.Attributes, op.Entry.AttributesExpiration)
+	return nil
+}
+
+func (fs *cachingFS) GetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.GetInodeAttributesOp) error {
+	fs.mu.Lock()
+	if a, ok := fs.attrs[op.Inode]; ok {
+		if fs.cfg.Clock.Now().Before(a.expires) {
+			op.Attributes = a.attributes
+			op.AttributesExpiration = a.expiration
+			fs.mu.Unlock()
+			return nil
+		}
+		delete(fs.attrs, op.Inode)
+	}
+	fs.mu.Unlock()
+
+	if err := fs.FileSystem.GetInodeAttributes(ctx, op); err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.cacheAttributes(op.Inode, op.Attributes, op.AttributesExpiration)
+	return nil
+}
+
+func (fs *cachingFS) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	fs.invalidate(op.Inode)
+	if err := fs.FileSystem.SetInodeAttributes(ctx, op); err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.cacheAttributes(op.Inode, op.Attributes, op.AttributesExpiration)
+	return nil
+}
+
+// Take the kernel's forgetting of an inode out of the lookups that were served
+// from the cache, returning the number of lookups to forward to the wrapped
+// file system.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *cachingFS) forget(inode fuseops.InodeID, n uint64) uint64 {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	l, ok := fs.lookups[inode]
+	if !ok {
+		return n
+	}
+
+	cached := min(n, l.cached)
+	l.cached -= cached
+	l.kernel -= min(n, l.kernel)
+
+	if l.kernel == 0 {
+		delete(fs.lookups, inode)
+		delete(fs.attrs, inode)
+		for key, e := range fs.entries {
+			if e.entry.Child == inode {
+				delete(fs.entries, key)
+			}
+		}
+	}
+
+	return n - cached
+}
+
+func (fs *cachingFS) ForgetInode(
+	ctx context.Context,
+	op *fuseops.ForgetInodeOp) error {
+	n := fs.forget(op.Inode, op.N)
+	if n == 0 {
+		return nil
+	}
+
+	orig := op.N
+	op.N = n
+	defer func() { op.N = orig }()
+	return fs.FileSystem.ForgetInode(ctx, op)
+}
+
+func (fs *cachingFS) BatchForget(
+	ctx context.Context,
+	op *fuseops.BatchForgetOp) error {
+	entries := make([]fuseops.BatchForgetEntry, 0, len(op.Entries))
+	for _, e := range op.Entries {
+		if n := fs.forget(e.Inode, e.N); n > 0 {
+			entries = append(entries, fuseops.BatchForgetEntry{Inode: e.Inode, N: n})
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	orig := op.Entries
+	op.Entries = entries
+	defer func() { op.Entries = orig }()
+	return fs.FileSystem.BatchForget(ctx, op)
+}
+
+func (fs *cachingFS) MkDir(
+	ctx context.Context,
+	op *fuseops.MkDirOp) error {
+	defer fs.invalidate(op.Parent)
+	return fs.FileSystem.MkDir(ctx, op)
+}
+
+func (fs *cachingFS) MkNode(
+	ctx context.Context,
+	op *fuseops.MkNodeOp) error {
+	defer fs.invalidate(op.Parent)
+	return fs.FileSystem.MkNode(ctx, op)
+}
+
+func (fs *cachingFS) CreateFile(
+	ctx context.Context,
+	op *fuseops.CreateFileOp) error {
+	defer fs.invalidate(op.Parent)
+	return fs.FileSystem.CreateFile(ctx, op)
+}
+
+func (fs *cachingFS) CreateSymlink(
+	ctx context.Context,
+	op *fuseops.CreateSymlinkOp) error {
+	defer fs.invalidate(op.Parent)
+	return fs.FileSystem.CreateSymlink(ctx, op)
+}
+
+func (fs *cachingFS) CreateLink(
+	ctx context.Context,
+	op *fuseops.CreateLinkOp) error {
+	defer fs.invalidate(op.Parent, op.Target)
+	return fs.FileSystem.CreateLink(ctx, op)
+}
+
+// Drop the cached entry for the named child of a directory, along with the
+// attributes of the directory and the child.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *cachingFS) invalidateChild(parent fuseops.InodeID, name string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	key := cachedEntryKey{parent, name}
+	if e, ok := fs.entries[key]; ok {
+		delete(fs.attrs, e.entry.Child)
+		delete(fs.entries, key)
+	}
+	delete(fs.attrs, parent)
+}
+
+func (fs *cachingFS) Rename(
+	ctx context.Context,
+	op *fuseops.RenameOp) error {
+	// Lookups made while the op is in progress may cache the entries again, so
+	// drop them afterwards too.
+	fs.invalidateChild(op.OldParent, op.OldName)
+	fs.invalidateChild(op.NewParent, op.NewName)
+	defer fs.invalidateChild(op.OldParent, op.OldName)
+	defer fs.invalidateChild(op.NewParent, op.NewName)
+	return fs.FileSystem.Rename(ctx, op)
+}
+
+func (fs *cachingFS) RmDir(
+	ctx context.Context,
+	op *fuseops.RmDirOp) error {
+	fs.invalidateChild(op.Parent, op.Name)
+	defer fs.invalidateChild(op.Parent, op.Name)
+	return fs.FileSystem.RmDir(ctx, op)
+}
+
+func (fs *cachingFS) Unlink(
+	ctx context.Context,
+	op *fuseops.UnlinkOp) error {
+	fs.invalidateChild(op.Parent, op.Name)
+	defer fs.invalidateChild(op.Parent, op.Name)
+	return fs.FileSystem.Unlink(ctx, op)
+}
+
+func (fs *cachingFS) OpenFile(
+	ctx context.Context,
+	op *fuseops.OpenFileOp) error {
+	if op.OpenFlags.IsTruncate() {
+		defer fs.invalidate(op.Inode)
+	}
+	return fs.FileSystem.OpenFile(ctx, op)
+}
+
+func (fs *cachingFS) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	defer fs.invalidate(op.Inode)
+	return fs.FileSystem.WriteFile(ctx, op)
+}
+
+func (fs *cachingFS) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) error {
+	defer fs.invalidate(op.Inode)
+	return fs.FileSystem.Fallocate(ctx, op)
+}
+
+func (fs *cachingFS) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	defer fs.invalidate(op.DstInode)
+	return fs.FileSystem.CopyFileRange(ctx, op)
+}
+
+func (fs *cachingFS) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) error {
+	defer fs.invalidate(op.Inode)
+	return fs.FileSystem.SetXattr(ctx, op)
+}
+
+func (fs *cachingFS) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) error {
+	defer fs.invalidate(op.Inode)
+	return fs.FileSystem.RemoveXattr(ctx, op)
+}
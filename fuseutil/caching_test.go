@@ -0,0 +1,189 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+	"github.com/jacobsa/timeutil"
+)
+
+func TestCachingFileSystem(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/file", []byte("taco"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	wrapped, err := fuseutil.NewLoopbackFileSystem(dir)
+	if err != nil {
+		t.Fatalf("NewLoopbackFileSystem: %v", err)
+	}
+
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	fs := fuseutil.NewCachingFileSystem(wrapped, fuseutil.CachingConfig{
+		AttributeTTL: time.Minute,
+		EntryTTL:     time.Minute,
+		Clock:        &clock,
+	})
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	lookUp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "file"}
+	if err := k.Do(ctx, lookUp); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+	inode := lookUp.Entry.Child
+
+	size := func() uint64 {
+		op := &fuseops.GetInodeAttributesOp{Inode: inode}
+		if err := k.Do(ctx, op); err != nil {
+			t.Fatalf("GetInodeAttributes: %v", err)
+		}
+		return op.Attributes.Size
+	}
+
+	// Changes behind the back of the cache aren't seen until the attributes
+	// expire or are invalidated.
+	if err := os.WriteFile(dir+"/file", []byte("tacos"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if got := size(); got != 4 {
+		t.Errorf("cached size %d, want 4", got)
+	}
+	clock.AdvanceTime(2 * time.Minute)
+	if got := size(); got != 5 {
+		t.Errorf("size after expiry %d, want 5", got)
+	}
+
+	if err := os.WriteFile(dir+"/file", []byte("burrito"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if got := size(); got != 5 {
+		t.Errorf("cached size %d, want 5", got)
+	}
+	fs.InvalidateInode(inode)
+	if got := size(); got != 7 {
+		t.Errorf("size after invalidation %d, want 7", got)
+	}
+
+	// Writes through the cache invalidate it.
+	open := &fuseops.OpenFileOp{Inode: inode, OpenFlags: fusekernel.OpenReadWrite}
+	if err := k.Do(ctx, open); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	write := &fuseops.WriteFileOp{Inode: inode, Handle: open.Handle, Offset: 7, Data: []byte("s")}
+	if err := k.Do(ctx, write); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if got := size(); got != 8 {
+		t.Errorf("size after write %d, want 8", got)
+	}
+
+	// Entries are cached too, and lookups served from the cache are taken out
+	// of the count forgotten by the wrapped file system, which still knows the
+	// inode afterward.
+	if err := k.Do(ctx, &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "file"}); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+	if err := os.Rename(dir+"/file", dir+"/moved"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	cached := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "file"}
+	if err := k.Do(ctx, cached); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+	if cached.Entry.Child != inode {
+		t.Errorf("cached lookup returned inode %d, want %d", cached.Entry.Child, inode)
+	}
+	if err := k.Do(ctx, &fuseops.ForgetInodeOp{Inode: inode, N: 2}); err != nil {
+		t.Fatalf("ForgetInode: %v", err)
+	}
+	fs.InvalidateInode(inode)
+	if got := size(); got != 8 {
+		t.Errorf("size after forget %d, want 8", got)
+	}
+
+	fs.InvalidateEntry(fuseops.RootInodeID, "file")
+	if err := k.Do(ctx, &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "file"}); err != syscall.ENOENT {
+		t.Errorf("LookUpInode after invalidation: %v", err)
+	}
+}
+
+// A file system that runs a function in the middle of unlinking.
+type duringUnlinkFS struct {
+	fuseutil.FileSystem
+	during func()
+}
+
+func (fs *duringUnlinkFS) Unlink(ctx context.Context, op *fuseops.UnlinkOp) error {
+	fs.during()
+	return fs.FileSystem.Unlink(ctx, op)
+}
+
+func TestCachingFileSystemLookUpDuringUnlink(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/file", []byte("taco"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	loopback, err := fuseutil.NewLoopbackFileSystem(dir)
+	if err != nil {
+		t.Fatalf("NewLoopbackFileSystem: %v", err)
+	}
+
+	ctx := context.Background()
+	wrapped := &duringUnlinkFS{FileSystem: loopback}
+	fs := fuseutil.NewCachingFileSystem(wrapped, fuseutil.CachingConfig{
+		AttributeTTL: time.Minute,
+		EntryTTL:     time.Minute,
+	})
+
+	// A lookup made while the unlink is in progress caches the entry again.
+	wrapped.during = func() {
+		op := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "file"}
+		if err := fs.LookUpInode(ctx, op); err != nil {
+			t.Errorf("LookUpInode during Unlink: %v", err)
+		}
+	}
+
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	if err := k.Do(ctx, &fuseops.UnlinkOp{Parent: fuseops.RootInodeID, Name: "file"}); err != nil {
+		t.Fatalf("Unlink: %v", err)
+	}
+
+	// But the entry isn't served once the unlink is done.
+	if err := k.Do(ctx, &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "file"}); err != syscall.ENOENT {
+		t.Errorf("LookUpInode after Unlink: expected ENOENT, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// A DirStream serves fuseops.ReadDirOp and fuseops.ReadDirPlusOp for a
+// directory from listings of it supplied by the file system, taking care of
+// the offsets of the entries. See the notes on fuseops.ReadDirOp.Offset for
+// what they must satisfy.
+//
+// Each name is given an offset when it first shows up in a listing, which it
+// keeps for as long as it's listed, and names that show up later are given
+// higher ones. Each read returns the entries of the current listing that have
+// higher offsets than the one read from, in order of offset. So a reader that
+// sees a directory change while it's listing it sees each entry that hasn't
+// changed once, and new entries at the end, whatever the order of the
+// listings, and seekdir(3) to a value from telldir(3) works.
+//
+// Use one DirStream per directory, shared by its handles, or one per handle.
+// The zero value is ready to use, and a DirStream is safe for concurrent use.
+type DirStream struct {
+	mu sync.Mutex
+
+	// The offsets of the names in the last listing.
+	//
+	// INVARIANT: For each offset in offsets, 0 < offset <= last
+	//
+	// GUARDED_BY(mu)
+	offsets map[string]fuseops.DirOffset
+	last    fuseops.DirOffset
+}
+
+// Return the offsets of the names, along with the indices of those past the
+// given offset in order of offset.
+//
+// LOCKS_EXCLUDED(s.mu)
+func (s *DirStream) pending(
+	names []string,
+	after fuseops.DirOffset) ([]fuseops.DirOffset, []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offsets := make(map[string]fuseops.DirOffset, len(names))
+	byIndex := make([]fuseops.DirOffset, len(names))
+	var pending []int
+	for i, name := range names {
+		off, ok := s.offsets[name]
+		if !ok {
+			s.last++
+			off = s.last
+		}
+		offsets[name] = off
+		byIndex[i] = off
+
+		if off > after {
+			pending = append(pending, i)
+		}
+	}
+	s.offsets = offsets
+
+	sort.Slice(pending, func(a, b int) bool {
+		return byIndex[pending[a]] < byIndex[pending[b]]
+	})
+
+	return byIndex, pending
+}
+
+// ReadDir fills in op.Dst and op.BytesRead with the entries of the listing
+// that follow op.Offset. The Offset fields of the entries are ignored.
+func (s *DirStream) ReadDir(op *fuseops.ReadDirOp, entries []Dirent) {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+	}
+
+	offsets, pending := s.pending(names, op.Offset)
+	for _, i := range pending {
+		e := entries[i]
+		e.Offset = offsets[i]
+
+		n := WriteDirent(op.Dst[op.BytesRead:], e)
+		if n == 0 {
+			break
+		}
+		op.BytesRead += n
+	}
+}
+
+// ReadDirPlus fills in op.Dst and op.BytesRead with the entries of the
+// listing that follow op.Offset, returning those that fit. The kernel counts
+// a lookup of each of them other than "." and "..", which the file system
+// must too. The Dirent.Offset fields of the entries are ignored.
+func (s *DirStream) ReadDirPlus(op *fuseops.ReadDirPlusOp, entries []DirentPlus) []DirentPlus {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Dirent.Name
+	}
+
+	var written []DirentPlus
+	offsets, pending := s.pending(names, op.Offset)
+	for _, i := range pending {
+		e := entries[i]
+		e.Dirent.Offset = offsets[i]
+
+		n := WriteDirentPlus(op.Dst[op.BytesRead:], e)
+		if n == 0 {
+			break
+		}
+		op.BytesRead += n
+		written = append(written, e)
+	}
+
+	return written
+}
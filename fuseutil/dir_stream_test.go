@@ -0,0 +1,105 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+// A file system whose root directory lists the names in a slice, which the
+// test may change at any time.
+type dirStreamFS struct {
+	fuseutil.NotImplementedFileSystem
+	stream fuseutil.DirStream
+
+	mu    sync.Mutex
+	names []string
+}
+
+func (fs *dirStreamFS) OpenDir(ctx context.Context, op *fuseops.OpenDirOp) error {
+	return nil
+}
+
+func (fs *dirStreamFS) ReadDir(ctx context.Context, op *fuseops.ReadDirOp) error {
+	fs.mu.Lock()
+	var entries []fuseutil.Dirent
+	for i, name := range fs.names {
+		entries = append(entries, fuseutil.Dirent{Inode: fuseops.InodeID(i + 2), Name: name})
+	}
+	fs.mu.Unlock()
+
+	fs.stream.ReadDir(op, entries)
+	return nil
+}
+
+func TestDirStream(t *testing.T) {
+	fs := &dirStreamFS{names: []string{"c", "a", "b"}}
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	// Read with room for two entries at a time.
+	read := func(offset fuseops.DirOffset) (names []string, next fuseops.DirOffset) {
+		op := &fuseops.ReadDirOp{Inode: fuseops.RootInodeID, Offset: offset, Dst: make([]byte, 2*(fusekernel.DirentSize+8))}
+		if err := k.Do(ctx, op); err != nil {
+			t.Fatalf("ReadDir: %v", err)
+		}
+		next = offset
+		for buf := op.Dst[:op.BytesRead]; len(buf) > 0; {
+			d, n := fuseutil.ReadDirent(buf)
+			names = append(names, d.Name)
+			next = d.Offset
+			buf = buf[n:]
+		}
+		return names, next
+	}
+
+	names, next := read(0)
+	if want := []string{"c", "a"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("first read %q, want %q", names, want)
+	}
+
+	// Entries that change mid-stream don't upset those that don't, whatever
+	// the order of the listing.
+	fs.mu.Lock()
+	fs.names = []string{"d", "b", "c"}
+	fs.mu.Unlock()
+
+	names, next = read(next)
+	if want := []string{"b", "d"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("second read %q, want %q", names, want)
+	}
+	if names, _ = read(next); len(names) != 0 {
+		t.Errorf("read past the end %q", names)
+	}
+
+	// Starting over lists everything.
+	names, _ = read(0)
+	if want := []string{"c", "b"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("read after rewind %q, want %q", names, want)
+	}
+}
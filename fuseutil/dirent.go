@@ -120,6 +120,36 @@ func WriteDirent(buf []byte, d Dirent) (n int) {
 	return n
 }
 
+// ReadDirent parses the first directory entry in a buffer in the format
+// written by WriteDirent, returning it and the number of bytes it occupies.
+// Return zero if the buffer doesn't hold a whole entry.
+func ReadDirent(buf []byte) (d Dirent, n int) {
+	const direntAlignment = 8
+	const direntSize = 8 + 8 + 4 + 4
+
+	if len(buf) < direntSize {
+		return d, 0
+	}
+
+	var de fuse_dirent
+	copy((*[direntSize]byte)(unsafe.Pointer(&de))[:], buf)
+
+	nameEnd := direntSize + int(de.namelen)
+	if nameEnd > len(buf) {
+		return d, 0
+	}
+
+	d = Dirent{
+		Offset: fuseops.DirOffset(de.off),
+		Inode:  fuseops.InodeID(de.ino),
+		Name:   string(buf[direntSize:nameEnd]),
+		Type:   DirentType(de.type_),
+	}
+
+	n = min((nameEnd+direntAlignment-1)&^(direntAlignment-1), len(buf))
+	return d, n
+}
+
 // Write the supplied directory entry with attributes into the given buffer in the format
 // expected in fuseops.ReadDirPlusOp.Dst returning the number of bytes written.
 // Return zero if the entry would not fit.
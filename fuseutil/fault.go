@@ -0,0 +1,219 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"context"
+	"math/rand/v2"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// A Fault is a failure for a FaultInjector to inject into ops.
+type Fault struct {
+	// The names of the types of the ops to affect, e.g. "WriteFileOp". If
+	// empty, ops of all types may be affected.
+	Ops []string
+
+	// If set, only ops for which it returns true are affected, e.g. those on a
+	// certain inode.
+	Match func(op interface{}) bool
+
+	// The chance that a matching op is affected, between zero and one. If zero,
+	// every matching op is.
+	Probability float64
+
+	// If non-zero, the fault is removed once it has affected this many ops.
+	Count int
+
+	// How long to delay affected ops before handling them. The delay ends
+	// early if the op is interrupted, which then fails with the error from its
+	// context.
+	Latency time.Duration
+
+	// If set, affected ops fail with this error, e.g. syscall.EIO or
+	// syscall.ENOSPC, without reaching the file system.
+	Err error
+
+	// If set, affected ReadFileOps and WriteFileOps are handled for only the
+	// first half of their data, making for short reads and writes. Note that
+	// the kernel treats short writes other than with direct I/O as errors.
+	Short bool
+}
+
+// A FaultInjector injects faults into the ops handled by a file system, to
+// test how applications cope with unreliable storage. Install it with
+// NewInterceptedFileSystem and Interceptor, and add and remove faults at any
+// time. ForgetInodeOp and BatchForgetOp are never affected, since the kernel
+// doesn't accept errors for them.
+//
+// The zero value is ready to use, with no faults, and a FaultInjector is safe
+// for concurrent use.
+type FaultInjector struct {
+	mu sync.Mutex
+
+	// The faults in effect, in the order they were added, and the number of
+	// ops that have been affected.
+	//
+	// GUARDED_BY(mu)
+	faults   []*injectedFault
+	affected int
+}
+
+type injectedFault struct {
+	Fault
+	ops map[string]bool
+}
+
+// Inject adds a fault, returning a function that removes it again. When an
+// op matches more than one fault, the first that affects it is applied.
+//
+// LOCKS_EXCLUDED(fi.mu)
+func (fi *FaultInjector) Inject(f Fault) (remove func()) {
+	inf := &injectedFault{Fault: f}
+	if len(f.Ops) != 0 {
+		inf.ops = make(map[string]bool)
+		for _, name := range f.Ops {
+			inf.ops[name] = true
+		}
+	}
+
+	fi.mu.Lock()
+	fi.faults = append(fi.faults, inf)
+	fi.mu.Unlock()
+
+	return func() {
+		fi.mu.Lock()
+		defer fi.mu.Unlock()
+
+		fi.remove(inf)
+	}
+}
+
+// LOCKS_REQUIRED(fi.mu)
+func (fi *FaultInjector) remove(inf *injectedFault) {
+	for i, f := range fi.faults {
+		if f == inf {
+			fi.faults = append(fi.faults[:i:i], fi.faults[i+1:]...)
+			return
+		}
+	}
+}
+
+// Clear removes all faults.
+//
+// LOCKS_EXCLUDED(fi.mu)
+func (fi *FaultInjector) Clear() {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	fi.faults = nil
+}
+
+// Affected returns the number of ops that have been affected by faults.
+//
+// LOCKS_EXCLUDED(fi.mu)
+func (fi *FaultInjector) Affected() int {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	return fi.affected
+}
+
+// Return the fault to apply to the op, if any.
+//
+// LOCKS_EXCLUDED(fi.mu)
+func (fi *FaultInjector) choose(op interface{}) (Fault, bool) {
+	name := reflect.TypeOf(op).Elem().Name()
+
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	for _, inf := range fi.faults {
+		if inf.ops != nil && !inf.ops[name] {
+			continue
+		}
+
+		if inf.Match != nil && !inf.Match(op) {
+			continue
+		}
+
+		if inf.Probability != 0 && rand.Float64() >= inf.Probability {
+			continue
+		}
+
+		fi.affected++
+		if inf.Count != 0 {
+			inf.Count--
+			if inf.Count == 0 {
+				fi.remove(inf)
+			}
+		}
+
+		return inf.Fault, true
+	}
+
+	return Fault{}, false
+}
+
+// Interceptor returns an Interceptor that applies the injector's faults.
+func (fi *FaultInjector) Interceptor() Interceptor {
+	return fi.intercept
+}
+
+func (fi *FaultInjector) intercept(ctx context.Context, op interface{}, next Handler) error {
+	switch op.(type) {
+	case *fuseops.ForgetInodeOp, *fuseops.BatchForgetOp:
+		return next(ctx, op)
+	}
+
+	f, ok := fi.choose(op)
+	if !ok {
+		return next(ctx, op)
+	}
+
+	if f.Latency > 0 {
+		timer := time.NewTimer(f.Latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	if f.Err != nil {
+		return f.Err
+	}
+
+	if f.Short {
+		switch o := op.(type) {
+		case *fuseops.ReadFileOp:
+			o.Size /= 2
+			if int64(len(o.Dst)) > o.Size {
+				o.Dst = o.Dst[:o.Size]
+			}
+
+		case *fuseops.WriteFileOp:
+			// The number of bytes written is the length of Data on return.
+			o.Data = o.Data[:len(o.Data)/2]
+		}
+	}
+
+	return next(ctx, op)
+}
@@ -0,0 +1,88 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+func TestFaultInjector(t *testing.T) {
+	backing := &countingReadFS{}
+	backing.set("0123456789")
+
+	var faults fuseutil.FaultInjector
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fuseutil.NewInterceptedFileSystem(backing, faults.Interceptor())), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	read := func() (string, error) {
+		op := &fuseops.ReadFileOp{Inode: 2, Size: 8}
+		err := k.Do(ctx, op)
+		return string(op.Dst[:op.BytesRead]), err
+	}
+
+	// Fail the next two reads, but nothing else.
+	faults.Inject(fuseutil.Fault{Ops: []string{"ReadFileOp"}, Count: 2, Err: syscall.ENOSPC})
+	for i := 0; i < 2; i++ {
+		if _, err := read(); err != syscall.ENOSPC {
+			t.Errorf("read %d: %v, want ENOSPC", i, err)
+		}
+	}
+	if err := k.Do(ctx, &fuseops.GetInodeAttributesOp{Inode: 2}); err != nil {
+		t.Errorf("GetInodeAttributes: %v", err)
+	}
+	if got, err := read(); err != nil || got != "01234567" {
+		t.Errorf("read after the fault expired: %q, %v", got, err)
+	}
+	if backing.read() != 8 {
+		t.Errorf("failed reads reached the file system")
+	}
+
+	// Short reads, until removed.
+	remove := faults.Inject(fuseutil.Fault{
+		Match: func(op interface{}) bool { _, ok := op.(*fuseops.ReadFileOp); return ok },
+		Short: true,
+	})
+	if got, err := read(); err != nil || got != "0123" {
+		t.Errorf("short read: %q, %v", got, err)
+	}
+	remove()
+	if got, err := read(); err != nil || got != "01234567" {
+		t.Errorf("read after removal: %q, %v", got, err)
+	}
+
+	// Latency is cut short by interruption.
+	faults.Inject(fuseutil.Fault{Latency: time.Hour, Probability: 1})
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := k.Do(timeoutCtx, &fuseops.GetInodeAttributesOp{Inode: 2}); err == nil {
+		t.Errorf("GetInodeAttributes succeeded despite the latency")
+	}
+	faults.Clear()
+
+	if got := faults.Affected(); got != 4 {
+		t.Errorf("Affected() = %d, want 4", got)
+	}
+}
@@ -37,12 +37,14 @@ type FileSystem interface {
 	StatFS(context.Context, *fuseops.StatFSOp) error
 	LookUpInode(context.Context, *fuseops.LookUpInodeOp) error
 	GetInodeAttributes(context.Context, *fuseops.GetInodeAttributesOp) error
+	Statx(context.Context, *fuseops.StatxOp) error
 	SetInodeAttributes(context.Context, *fuseops.SetInodeAttributesOp) error
 	ForgetInode(context.Context, *fuseops.ForgetInodeOp) error
 	BatchForget(context.Context, *fuseops.BatchForgetOp) error
 	MkDir(context.Context, *fuseops.MkDirOp) error
 	MkNode(context.Context, *fuseops.MkNodeOp) error
 	CreateFile(context.Context, *fuseops.CreateFileOp) error
+	CreateTmpFile(context.Context, *fuseops.CreateTmpFileOp) error
 	CreateLink(context.Context, *fuseops.CreateLinkOp) error
 	CreateSymlink(context.Context, *fuseops.CreateSymlinkOp) error
 	Rename(context.Context, *fuseops.RenameOp) error
@@ -64,11 +66,22 @@ type FileSystem interface {
 	ListXattr(context.Context, *fuseops.ListXattrOp) error
 	SetXattr(context.Context, *fuseops.SetXattrOp) error
 	Fallocate(context.Context, *fuseops.FallocateOp) error
+	CopyFileRange(context.Context, *fuseops.CopyFileRangeOp) error
+	SeekFile(context.Context, *fuseops.SeekFileOp) error
+	Poll(context.Context, *fuseops.PollOp) error
+	Access(context.Context, *fuseops.AccessOp) error
+	Flock(context.Context, *fuseops.FlockOp) error
 	SyncFS(context.Context, *fuseops.SyncFSOp) error
 
 	// Regard all inodes (including the root inode) as having their lookup counts
 	// decremented to zero, and clean up any resources associated with the file
 	// system. No further calls to the file system will be made.
+	//
+	// This is called once ops in flight have completed, when the kernel sends
+	// fuseops.DestroyOp, before the unmount completes, or otherwise when the
+	// connection is closed, unless it was handed over to another process with
+	// fuse.MountedFileSystem.Detach. It is called only once. Ops that other readers
+	// read at the same time as the destroy op fail with EIO instead.
 	Destroy()
 }
 
@@ -79,7 +92,8 @@ type FileSystem interface {
 // Each call to a FileSystem method (except ForgetInode) is made on
 // its own goroutine, and is free to block. ForgetInode may be called
 // synchronously, and should not depend on calls to other methods
-// being received concurrently.
+// being received concurrently. MountConfig.Concurrency can instead bound the
+// number of goroutines, and have several of them read ops.
 //
 // (It is safe to naively process ops concurrently because the kernel
 // guarantees to serialize operations that the user expects to happen in order,
@@ -94,16 +108,43 @@ func NewFileSystemServer(fs FileSystem) fuse.Server {
 type fileSystemServer struct {
 	fs          FileSystem
 	opsInFlight sync.WaitGroup
+	destroyOnce sync.Once
+
+	// Set when a destroy op is read. Ops read by other readers afterwards are
+	// failed rather than added to opsInFlight, which is being waited on.
+	mu        sync.Mutex
+	destroyed bool // GUARDED_BY(mu)
 }
 
 func (s *fileSystemServer) ServeOps(c *fuse.Connection) {
 	// When we are done, we clean up by waiting for all in-flight ops then
-	// destroying the file system.
+	// destroying the file system, unless the kernel already asked us to, or
+	// another process has taken over serving it.
 	defer func() {
 		s.opsInFlight.Wait()
-		s.fs.Destroy()
+		if !c.Detached() {
+			s.destroyOnce.Do(s.fs.Destroy)
+		}
 	}()
 
+	conc := c.Concurrency()
+	w := newWorkers(s, c, conc)
+	defer w.stop()
+
+	var readers sync.WaitGroup
+	for i := 0; i < max(conc.Readers, 1); i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			s.readOps(c, w)
+		}()
+	}
+	readers.Wait()
+}
+
+// Read ops from the connection and hand them to the workers, until the
+// connection is closed.
+func (s *fileSystemServer) readOps(c *fuse.Connection, w *workers) {
 	for {
 		ctx, op, err := c.ReadOp()
 		if err == io.EOF {
@@ -114,7 +155,34 @@ func (s *fileSystemServer) ServeOps(c *fuse.Connection) {
 			panic(err)
 		}
 
-		s.opsInFlight.Add(1)
+		// The kernel sends nothing after a destroy op, and waits for the reply
+		// to finish unmounting, so the file system can be torn down here.
+		if _, ok := op.(*fuseops.DestroyOp); ok {
+			s.mu.Lock()
+			s.destroyed = true
+			s.mu.Unlock()
+
+			s.opsInFlight.Wait()
+			s.destroyOnce.Do(s.fs.Destroy)
+			c.Reply(ctx, nil)
+			continue
+		}
+
+		// Other readers may have read ops before the destroy op that they
+		// haven't yet handed off. Don't hand them to a file system that is
+		// being torn down.
+		s.mu.Lock()
+		destroyed := s.destroyed
+		if !destroyed {
+			s.opsInFlight.Add(1)
+		}
+		s.mu.Unlock()
+
+		if destroyed {
+			c.Reply(ctx, fuse.EIO)
+			continue
+		}
+
 		if _, ok := op.(*fuseops.ForgetInodeOp); ok {
 			// Special case: call in this goroutine for
 			// forget inode ops, which may come in a
@@ -122,7 +190,7 @@ func (s *fileSystemServer) ServeOps(c *fuse.Connection) {
 			// cheap for the file system to handle
 			s.handleOp(c, ctx, op)
 		} else {
-			go s.handleOp(c, ctx, op)
+			w.handle(ctx, op)
 		}
 	}
 }
@@ -132,34 +200,45 @@ func (s *fileSystemServer) handleOp(
 	ctx context.Context,
 	op interface{}) {
 	defer s.opsInFlight.Done()
+	fuse.MarkHandlerStart(ctx)
+
+	c.Reply(ctx, dispatch(ctx, s.fs, op))
+}
 
-	// Dispatch to the appropriate method.
+// Call the FileSystem method for the op, returning ENOSYS for unsupported ops.
+func dispatch(
+	ctx context.Context,
+	fs FileSystem,
+	op interface{}) error {
 	var err error
 	switch typed := op.(type) {
 	default:
 		err = fuse.ENOSYS
 
 	case *fuseops.StatFSOp:
-		err = s.fs.StatFS(ctx, typed)
+		err = fs.StatFS(ctx, typed)
 
 	case *fuseops.LookUpInodeOp:
-		err = s.fs.LookUpInode(ctx, typed)
+		err = fs.LookUpInode(ctx, typed)
 
 	case *fuseops.GetInodeAttributesOp:
-		err = s.fs.GetInodeAttributes(ctx, typed)
+		err = fs.GetInodeAttributes(ctx, typed)
+
+	case *fuseops.StatxOp:
+		err = fs.Statx(ctx, typed)
 
 	case *fuseops.SetInodeAttributesOp:
-		err = s.fs.SetInodeAttributes(ctx, typed)
+		err = fs.SetInodeAttributes(ctx, typed)
 
 	case *fuseops.ForgetInodeOp:
-		err = s.fs.ForgetInode(ctx, typed)
+		err = fs.ForgetInode(ctx, typed)
 
 	case *fuseops.BatchForgetOp:
-		err = s.fs.BatchForget(ctx, typed)
+		err = fs.BatchForget(ctx, typed)
 		if err == fuse.ENOSYS {
 			// Handle as a series of single-inode forget operations
 			for _, entry := range typed.Entries {
-				err = s.fs.ForgetInode(ctx, &fuseops.ForgetInodeOp{
+				err = fs.ForgetInode(ctx, &fuseops.ForgetInodeOp{
 					Inode:     entry.Inode,
 					N:         entry.N,
 					OpContext: typed.OpContext,
@@ -171,80 +250,135 @@ func (s *fileSystemServer) handleOp(
 		}
 
 	case *fuseops.MkDirOp:
-		err = s.fs.MkDir(ctx, typed)
+		err = fs.MkDir(ctx, typed)
 
 	case *fuseops.MkNodeOp:
-		err = s.fs.MkNode(ctx, typed)
+		err = fs.MkNode(ctx, typed)
 
 	case *fuseops.CreateFileOp:
-		err = s.fs.CreateFile(ctx, typed)
+		err = fs.CreateFile(ctx, typed)
+
+	case *fuseops.CreateTmpFileOp:
+		err = fs.CreateTmpFile(ctx, typed)
 
 	case *fuseops.CreateLinkOp:
-		err = s.fs.CreateLink(ctx, typed)
+		err = fs.CreateLink(ctx, typed)
 
 	case *fuseops.CreateSymlinkOp:
-		err = s.fs.CreateSymlink(ctx, typed)
+		err = fs.CreateSymlink(ctx, typed)
 
 	case *fuseops.RenameOp:
-		err = s.fs.Rename(ctx, typed)
+		err = fs.Rename(ctx, typed)
 
 	case *fuseops.RmDirOp:
-		err = s.fs.RmDir(ctx, typed)
+		err = fs.RmDir(ctx, typed)
 
 	case *fuseops.UnlinkOp:
-		err = s.fs.Unlink(ctx, typed)
+		err = fs.Unlink(ctx, typed)
 
 	case *fuseops.OpenDirOp:
-		err = s.fs.OpenDir(ctx, typed)
+		err = fs.OpenDir(ctx, typed)
 
 	case *fuseops.ReadDirOp:
-		err = s.fs.ReadDir(ctx, typed)
+		err = fs.ReadDir(ctx, typed)
 
 	case *fuseops.ReadDirPlusOp:
-		err = s.fs.ReadDirPlus(ctx, typed)
+		err = fs.ReadDirPlus(ctx, typed)
 
 	case *fuseops.ReleaseDirHandleOp:
-		err = s.fs.ReleaseDirHandle(ctx, typed)
+		err = fs.ReleaseDirHandle(ctx, typed)
 
 	case *fuseops.OpenFileOp:
-		err = s.fs.OpenFile(ctx, typed)
+		err = fs.OpenFile(ctx, typed)
 
 	case *fuseops.ReadFileOp:
-		err = s.fs.ReadFile(ctx, typed)
+		err = fs.ReadFile(ctx, typed)
 
 	case *fuseops.WriteFileOp:
-		err = s.fs.WriteFile(ctx, typed)
+		err = fs.WriteFile(ctx, typed)
 
 	case *fuseops.SyncFileOp:
-		err = s.fs.SyncFile(ctx, typed)
+		err = fs.SyncFile(ctx, typed)
 
 	case *fuseops.FlushFileOp:
-		err = s.fs.FlushFile(ctx, typed)
+		err = fs.FlushFile(ctx, typed)
 
 	case *fuseops.ReleaseFileHandleOp:
-		err = s.fs.ReleaseFileHandle(ctx, typed)
+		err = fs.ReleaseFileHandle(ctx, typed)
 
 	case *fuseops.ReadSymlinkOp:
-		err = s.fs.ReadSymlink(ctx, typed)
+		err = fs.ReadSymlink(ctx, typed)
 
 	case *fuseops.RemoveXattrOp:
-		err = s.fs.RemoveXattr(ctx, typed)
+		err = fs.RemoveXattr(ctx, typed)
 
 	case *fuseops.GetXattrOp:
-		err = s.fs.GetXattr(ctx, typed)
+		err = fs.GetXattr(ctx, typed)
 
 	case *fuseops.ListXattrOp:
-		err = s.fs.ListXattr(ctx, typed)
+		err = fs.ListXattr(ctx, typed)
 
 	case *fuseops.SetXattrOp:
-		err = s.fs.SetXattr(ctx, typed)
+		err = fs.SetXattr(ctx, typed)
 
 	case *fuseops.FallocateOp:
-		err = s.fs.Fallocate(ctx, typed)
+		err = fs.Fallocate(ctx, typed)
+
+	case *fuseops.CopyFileRangeOp:
+		err = fs.CopyFileRange(ctx, typed)
+
+	case *fuseops.SeekFileOp:
+		err = fs.SeekFile(ctx, typed)
+
+	case *fuseops.PollOp:
+		err = fs.Poll(ctx, typed)
+
+	case *fuseops.AccessOp:
+		err = fs.Access(ctx, typed)
+
+	case *fuseops.FlockOp:
+		err = fs.Flock(ctx, typed)
 
 	case *fuseops.SyncFSOp:
-		err = s.fs.SyncFS(ctx, typed)
+		err = fs.SyncFS(ctx, typed)
+	}
+
+	return err
+}
+
+// ReadFileData returns the data that a FileSystem has returned for a
+// ReadFileOp, in whichever of the ways the op allows it returned it, for
+// callers of FileSystem methods other than the server. It invokes the op's
+// Callback, if any, once done with it.
+func ReadFileData(op *fuseops.ReadFileOp) ([]byte, error) {
+	if op.Callback != nil {
+		defer op.Callback()
+	}
+
+	switch {
+	case op.SpliceFile != nil:
+		buf := make([]byte, op.BytesRead)
+		n, err := op.SpliceFile.ReadAt(buf, op.SpliceOffset)
+		if err == io.EOF {
+			err = nil
+		}
+		return buf[:n], err
+
+	case op.Reader != nil:
+		buf := make([]byte, op.Size)
+		n, err := io.ReadFull(op.Reader, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		return buf[:n], err
+
+	case op.Data != nil:
+		var buf []byte
+		for _, d := range op.Data {
+			buf = append(buf, d...)
+		}
+		return buf[:min(len(buf), op.BytesRead)], nil
 	}
 
-	c.Reply(ctx, err)
+	return op.Dst[:op.BytesRead], nil
 }
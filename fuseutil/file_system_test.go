@@ -0,0 +1,98 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+// A file system that records whether it was called after being destroyed.
+type lateOpFS struct {
+	fuseutil.NotImplementedFileSystem
+	destroyed chan struct{}
+	late      atomic.Bool
+}
+
+func (fs *lateOpFS) StatFS(ctx context.Context, op *fuseops.StatFSOp) error {
+	select {
+	case <-fs.destroyed:
+		fs.late.Store(true)
+	default:
+	}
+	return nil
+}
+
+func (fs *lateOpFS) Destroy() {
+	close(fs.destroyed)
+}
+
+// An OpTracer that holds StatFSOps in the reader that read them until the
+// file system has been destroyed.
+type holdStatFSTracer struct {
+	read      chan struct{}
+	destroyed chan struct{}
+}
+
+func (tr *holdStatFSTracer) StartOp(ctx context.Context, op interface{}) context.Context {
+	if _, ok := op.(*fuseops.StatFSOp); ok {
+		close(tr.read)
+		<-tr.destroyed
+	}
+	return ctx
+}
+
+func (tr *holdStatFSTracer) FinishOp(ctx context.Context, wlog *fuse.WireLogRecord) {}
+
+func TestDestroyWithMultipleReaders(t *testing.T) {
+	fs := &lateOpFS{destroyed: make(chan struct{})}
+	tr := &holdStatFSTracer{read: make(chan struct{}), destroyed: fs.destroyed}
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), &fuse.MountConfig{
+		Concurrency: fuse.ServerConcurrency{Readers: 2},
+		OpTracer:    tr,
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	// One reader reads an op, and another the destroy op before the first
+	// hands its op off.
+	ctx := context.Background()
+	statFS := make(chan error, 1)
+	go func() {
+		statFS <- k.Do(ctx, &fuseops.StatFSOp{})
+	}()
+	<-tr.read
+
+	if err := k.Do(ctx, &fuseops.DestroyOp{}); err != nil {
+		t.Fatalf("Destroy: %v", err)
+	}
+
+	// The op fails rather than reaching the destroyed file system.
+	if err := <-statFS; err != syscall.EIO {
+		t.Errorf("expected EIO for StatFS, got %v", err)
+	}
+	if fs.late.Load() {
+		t.Errorf("expected no ops after Destroy")
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"context"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// A Handler handles an op, one of the pointer types in the fuseops package,
+// returning the error with which to respond to it, as the methods of
+// FileSystem do.
+type Handler func(ctx context.Context, op interface{}) error
+
+// An Interceptor handles ops on the way to a FileSystem, usually by doing
+// something before or after calling next to pass them on, such as logging,
+// recording metrics, checking permissions, or limiting rates. It may also
+// respond to them itself without calling next, and may pass on a different
+// context.
+//
+// Interceptors are called concurrently, in whichever goroutine the op is
+// handled.
+type Interceptor func(ctx context.Context, op interface{}, next Handler) error
+
+// ChainInterceptors returns an Interceptor that passes ops through the given
+// ones in order, the first being the outermost.
+func ChainInterceptors(interceptors ...Interceptor) Interceptor {
+	return func(ctx context.Context, op interface{}, next Handler) error {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, inner := interceptors[i], next
+			next = func(ctx context.Context, op interface{}) error {
+				return interceptor(ctx, op, inner)
+			}
+		}
+
+		return next(ctx, op)
+	}
+}
+
+// NewInterceptedFileSystem returns a FileSystem that passes each op through
+// the given interceptors in order, the first being the outermost, before
+// calling the corresponding method of the wrapped FileSystem. Ops that the
+// wrapped FileSystem doesn't support are passed through them too, and get
+// ENOSYS from the innermost handler.
+//
+// Pass the result to NewFileSystemServer to intercept all the ops that a
+// server handles. Destroy isn't an op, and is passed on directly.
+func NewInterceptedFileSystem(fs FileSystem, interceptors ...Interceptor) FileSystem {
+	return &interceptedFS{
+		wrapped:   fs,
+		intercept: ChainInterceptors(interceptors...),
+	}
+}
+
+type interceptedFS struct {
+	wrapped   FileSystem
+	intercept Interceptor
+}
+
+func (fs *interceptedFS) handle(ctx context.Context, op interface{}) error {
+	return fs.intercept(ctx, op, func(ctx context.Context, op interface{}) error {
+		return dispatch(ctx, fs.wrapped, op)
+	})
+}
+
+func (fs *interceptedFS) Destroy() {
+	fs.wrapped.Destroy()
+}
+
+func (fs *interceptedFS) StatFS(
+	ctx context.Context,
+	op *fuseops.StatFSOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) GetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.GetInodeAttributesOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) Statx(
+	ctx context.Context,
+	op *fuseops.StatxOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) ForgetInode(
+	ctx context.Context,
+	op *fuseops.ForgetInodeOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) BatchForget(
+	ctx context.Context,
+	op *fuseops.BatchForgetOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) MkDir(
+	ctx context.Context,
+	op *fuseops.MkDirOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) MkNode(
+	ctx context.Context,
+	op *fuseops.MkNodeOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) CreateFile(
+	ctx context.Context,
+	op *fuseops.CreateFileOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) CreateTmpFile(
+	ctx context.Context,
+	op *fuseops.CreateTmpFileOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) CreateLink(
+	ctx context.Context,
+	op *fuseops.CreateLinkOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) CreateSymlink(
+	ctx context.Context,
+	op *fuseops.CreateSymlinkOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) Rename(
+	ctx context.Context,
+	op *fuseops.RenameOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) RmDir(
+	ctx context.Context,
+	op *fuseops.RmDirOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) Unlink(
+	ctx context.Context,
+	op *fuseops.UnlinkOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) OpenDir(
+	ctx context.Context,
+	op *fuseops.OpenDirOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) ReadDir(
+	ctx context.Context,
+	op *fuseops.ReadDirOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) ReadDirPlus(
+	ctx context.Context,
+	op *fuseops.ReadDirPlusOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) ReleaseDirHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseDirHandleOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) OpenFile(
+	ctx context.Context,
+	op *fuseops.OpenFileOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) ReadFile(
+	ctx context.Context,
+	op *fuseops.ReadFileOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) SyncFile(
+	ctx context.Context,
+	op *fuseops.SyncFileOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) FlushFile(
+	ctx context.Context,
+	op *fuseops.FlushFileOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) ReleaseFileHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseFileHandleOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) ReadSymlink(
+	ctx context.Context,
+	op *fuseops.ReadSymlinkOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) GetXattr(
+	ctx context.Context,
+	op *fuseops.GetXattrOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) ListXattr(
+	ctx context.Context,
+	op *fuseops.ListXattrOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) SeekFile(
+	ctx context.Context,
+	op *fuseops.SeekFileOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) Poll(
+	ctx context.Context,
+	op *fuseops.PollOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) Access(
+	ctx context.Context,
+	op *fuseops.AccessOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) Flock(
+	ctx context.Context,
+	op *fuseops.FlockOp) error {
+	return fs.handle(ctx, op)
+}
+
+func (fs *interceptedFS) SyncFS(
+	ctx context.Context,
+	op *fuseops.SyncFSOp) error {
+	return fs.handle(ctx, op)
+}
@@ -0,0 +1,98 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+func TestInterceptedFileSystem(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/file", []byte("taco"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	wrapped, err := fuseutil.NewLoopbackFileSystem(dir)
+	if err != nil {
+		t.Fatalf("NewLoopbackFileSystem: %v", err)
+	}
+
+	// Record the ops on their way in and out, and refuse to remove files.
+	var mu sync.Mutex
+	var calls []string
+	record := func(name string) fuseutil.Interceptor {
+		return func(ctx context.Context, op interface{}, next fuseutil.Handler) error {
+			opName := reflect.TypeOf(op).Elem().Name()
+			mu.Lock()
+			calls = append(calls, name+" "+opName)
+			mu.Unlock()
+
+			err := next(ctx, op)
+
+			mu.Lock()
+			calls = append(calls, name+" done")
+			mu.Unlock()
+			return err
+		}
+	}
+	deny := func(ctx context.Context, op interface{}, next fuseutil.Handler) error {
+		if _, ok := op.(*fuseops.UnlinkOp); ok {
+			return syscall.EPERM
+		}
+		return next(ctx, op)
+	}
+
+	fs := fuseutil.NewInterceptedFileSystem(wrapped, record("outer"), record("inner"), deny)
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	lookUp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "file"}
+	if err := k.Do(ctx, lookUp); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+	if lookUp.Entry.Attributes.Size != 4 {
+		t.Errorf("unexpected entry %+v", lookUp.Entry)
+	}
+	if err := k.Do(ctx, &fuseops.UnlinkOp{Parent: fuseops.RootInodeID, Name: "file"}); err != syscall.EPERM {
+		t.Errorf("Unlink: got %v, want EPERM", err)
+	}
+	if _, err := os.Stat(dir + "/file"); err != nil {
+		t.Errorf("Stat: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		"outer LookUpInodeOp", "inner LookUpInodeOp", "inner done", "outer done",
+		"outer UnlinkOp", "inner UnlinkOp", "inner done", "outer done",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls %q, want %q", calls, want)
+	}
+}
@@ -0,0 +1,391 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+	"syscall"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// NewServerFromFS returns a server that serves the contents of fsys, such as
+// an embed.FS or an fstest.MapFS, read-only. It should be mounted with
+// MountConfig.ReadOnly set.
+//
+// Each path is given an inode ID when it's first looked up or listed, which
+// it keeps for the life of the server, since fsys is expected not to change.
+// Files and directories have the modes, sizes and modification times reported
+// by fsys, and are owned by root.
+func NewServerFromFS(fsys fs.FS) fuse.Server {
+	ifs := &ioFS{
+		fsys:       fsys,
+		paths:      map[fuseops.InodeID]string{fuseops.RootInodeID: "."},
+		inodes:     map[string]fuseops.InodeID{".": fuseops.RootInodeID},
+		nextInode:  fuseops.RootInodeID + 1,
+		files:      make(map[fuseops.HandleID]*ioFile),
+		dirs:       make(map[fuseops.HandleID][]fs.DirEntry),
+		nextHandle: 1,
+	}
+
+	return NewFileSystemServer(ifs)
+}
+
+// ioFS implements FileSystem on top of an fs.FS.
+type ioFS struct {
+	NotImplementedFileSystem
+	fsys fs.FS
+
+	mu sync.Mutex
+
+	// The inode IDs given to paths so far.
+	//
+	// GUARDED_BY(mu)
+	paths     map[fuseops.InodeID]string
+	inodes    map[string]fuseops.InodeID
+	nextInode fuseops.InodeID
+
+	// Open files, and the entries of open directories as of when they were
+	// opened.
+	//
+	// GUARDED_BY(mu)
+	files      map[fuseops.HandleID]*ioFile
+	dirs       map[fuseops.HandleID][]fs.DirEntry
+	nextHandle fuseops.HandleID
+}
+
+// An open file. Reads are served with ReadAt if the file implements
+// io.ReaderAt, and otherwise by seeking if it implements io.Seeker, or by
+// reading sequentially, reopening the file to go back.
+type ioFile struct {
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	f   fs.File
+	pos int64
+}
+
+// Convert an error returned by fsys to one for the kernel.
+func fsErrno(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var errno syscall.Errno
+	switch {
+	case errors.As(err, &errno):
+		return errno
+	case errors.Is(err, fs.ErrNotExist):
+		return fuse.ENOENT
+	case errors.Is(err, fs.ErrPermission):
+		return syscall.EACCES
+	case errors.Is(err, fs.ErrInvalid):
+		return fuse.EINVAL
+	}
+
+	return fuse.EIO
+}
+
+func attributesFromFileInfo(fi fs.FileInfo) fuseops.InodeAttributes {
+	return fuseops.InodeAttributes{
+		Size:  uint64(fi.Size()),
+		Nlink: 1,
+		Mode:  fi.Mode(),
+		Atime: fi.ModTime(),
+		Mtime: fi.ModTime(),
+		Ctime: fi.ModTime(),
+	}
+}
+
+// Return the path with the given inode ID.
+//
+// LOCKS_EXCLUDED(ifs.mu)
+func (ifs *ioFS) path(id fuseops.InodeID) (string, error) {
+	ifs.mu.Lock()
+	defer ifs.mu.Unlock()
+
+	p, ok := ifs.paths[id]
+	if !ok {
+		return "", fuse.ENOENT
+	}
+
+	return p, nil
+}
+
+// Return the inode ID for the path, giving it one if it has none.
+//
+// LOCKS_EXCLUDED(ifs.mu)
+func (ifs *ioFS) inode(p string) fuseops.InodeID {
+	ifs.mu.Lock()
+	defer ifs.mu.Unlock()
+
+	id, ok := ifs.inodes[p]
+	if !ok {
+		id = ifs.nextInode
+		ifs.nextInode++
+		ifs.inodes[p] = id
+		ifs.paths[id] = p
+	}
+
+	return id
+}
+
+func (ifs *ioFS) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	parent, err := ifs.path(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	p := path.Join(parent, op.Name)
+	fi, err := fs.Stat(ifs.fsys, p)
+	if err != nil {
+		return fsErrno(err)
+	}
+
+	op.Entry.Child = ifs.inode(p)
+	op.Entry.Attributes = attributesFromFileInfo(fi)
+	return nil
+}
+
+func (ifs *ioFS) GetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.GetInodeAttributesOp) error {
+	p, err := ifs.path(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	fi, err := fs.Stat(ifs.fsys, p)
+	if err != nil {
+		return fsErrno(err)
+	}
+
+	op.Attributes = attributesFromFileInfo(fi)
+	return nil
+}
+
+func (ifs *ioFS) ForgetInode(
+	ctx context.Context,
+	op *fuseops.ForgetInodeOp) error {
+	// Inode IDs are kept for the life of the server.
+	return nil
+}
+
+func (ifs *ioFS) BatchForget(
+	ctx context.Context,
+	op *fuseops.BatchForgetOp) error {
+	return nil
+}
+
+func (ifs *ioFS) OpenDir(
+	ctx context.Context,
+	op *fuseops.OpenDirOp) error {
+	p, err := ifs.path(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	entries, err := fs.ReadDir(ifs.fsys, p)
+	if err != nil {
+		return fsErrno(err)
+	}
+
+	ifs.mu.Lock()
+	defer ifs.mu.Unlock()
+
+	op.Handle = ifs.nextHandle
+	ifs.nextHandle++
+	ifs.dirs[op.Handle] = entries
+	return nil
+}
+
+func (ifs *ioFS) ReadDir(
+	ctx context.Context,
+	op *fuseops.ReadDirOp) error {
+	p, err := ifs.path(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	ifs.mu.Lock()
+	entries, ok := ifs.dirs[op.Handle]
+	ifs.mu.Unlock()
+	if !ok {
+		return fuse.EINVAL
+	}
+
+	// Offsets are indices into the listing.
+	for i := int(op.Offset); i < len(entries); i++ {
+		e := entries[i]
+		d := Dirent{
+			Offset: fuseops.DirOffset(i + 1),
+			Inode:  ifs.inode(path.Join(p, e.Name())),
+			Name:   e.Name(),
+			Type:   DT_File,
+		}
+		switch e.Type() {
+		case fs.ModeDir:
+			d.Type = DT_Directory
+		case fs.ModeSymlink:
+			d.Type = DT_Link
+		case 0:
+		default:
+			d.Type = DT_Unknown
+		}
+
+		n := WriteDirent(op.Dst[op.BytesRead:], d)
+		if n == 0 {
+			break
+		}
+		op.BytesRead += n
+	}
+
+	return nil
+}
+
+func (ifs *ioFS) ReleaseDirHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseDirHandleOp) error {
+	ifs.mu.Lock()
+	defer ifs.mu.Unlock()
+
+	delete(ifs.dirs, op.Handle)
+	return nil
+}
+
+func (ifs *ioFS) OpenFile(
+	ctx context.Context,
+	op *fuseops.OpenFileOp) error {
+	p, err := ifs.path(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	f, err := ifs.fsys.Open(p)
+	if err != nil {
+		return fsErrno(err)
+	}
+
+	ifs.mu.Lock()
+	defer ifs.mu.Unlock()
+
+	op.Handle = ifs.nextHandle
+	ifs.nextHandle++
+	ifs.files[op.Handle] = &ioFile{f: f}
+
+	// The contents of fsys don't change.
+	op.KeepPageCache = true
+	return nil
+}
+
+func (ifs *ioFS) ReadFile(
+	ctx context.Context,
+	op *fuseops.ReadFileOp) error {
+	p, err := ifs.path(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	ifs.mu.Lock()
+	f, ok := ifs.files[op.Handle]
+	ifs.mu.Unlock()
+	if !ok {
+		return fuse.EINVAL
+	}
+
+	if int64(len(op.Dst)) < op.Size {
+		op.Dst = make([]byte, op.Size)
+	}
+
+	op.BytesRead, err = f.readAt(ifs.fsys, p, op.Dst[:op.Size], op.Offset)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+
+	return fsErrno(err)
+}
+
+func (ifs *ioFS) FlushFile(
+	ctx context.Context,
+	op *fuseops.FlushFileOp) error {
+	return nil
+}
+
+func (ifs *ioFS) ReleaseFileHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseFileHandleOp) error {
+	ifs.mu.Lock()
+	f, ok := ifs.files[op.Handle]
+	delete(ifs.files, op.Handle)
+	ifs.mu.Unlock()
+
+	if !ok {
+		return fuse.EINVAL
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return fsErrno(f.f.Close())
+}
+
+// Read into p at the offset, from the file which was opened at the path in
+// fsys.
+//
+// LOCKS_EXCLUDED(f.mu)
+func (f *ioFile) readAt(fsys fs.FS, p string, dst []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r, ok := f.f.(io.ReaderAt); ok {
+		return r.ReadAt(dst, off)
+	}
+
+	if off != f.pos {
+		if s, ok := f.f.(io.Seeker); ok {
+			if _, err := s.Seek(off, io.SeekStart); err != nil {
+				return 0, err
+			}
+		} else {
+			if off < f.pos {
+				newF, err := fsys.Open(p)
+				if err != nil {
+					return 0, err
+				}
+				f.f.Close()
+				f.f = newF
+				f.pos = 0
+			}
+
+			n, err := io.CopyN(io.Discard, f.f, off-f.pos)
+			f.pos += n
+			if err != nil {
+				return 0, err
+			}
+		}
+		f.pos = off
+	}
+
+	n, err := io.ReadFull(f.f, dst)
+	f.pos += int64(n)
+	return n, err
+}
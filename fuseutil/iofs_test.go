@@ -0,0 +1,95 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"reflect"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"unsafe"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+func TestServerFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/taco.txt": {Data: []byte("taco burrito"), Mode: 0444},
+		"enchilada":    {Data: []byte("queso"), Mode: 0444},
+	}
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewServerFromFS(fsys), &fuse.MountConfig{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	openDir := &fuseops.OpenDirOp{Inode: fuseops.RootInodeID}
+	if err := k.Do(ctx, openDir); err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	readDir := &fuseops.ReadDirOp{Inode: fuseops.RootInodeID, Handle: openDir.Handle, Dst: make([]byte, 4096)}
+	if err := k.Do(ctx, readDir); err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for buf := readDir.Dst[:readDir.BytesRead]; len(buf) > 0; {
+		d := (*fusekernel.Dirent)(unsafe.Pointer(&buf[0]))
+		names = append(names, string(buf[fusekernel.DirentSize:fusekernel.DirentSize+int(d.Namelen)]))
+		buf = buf[(fusekernel.DirentSize+int(d.Namelen)+7)&^7:]
+	}
+	if !reflect.DeepEqual(names, []string{"dir", "enchilada"}) {
+		t.Errorf("listed %q", names)
+	}
+
+	dir := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "dir"}
+	if err := k.Do(ctx, dir); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+	if !dir.Entry.Attributes.Mode.IsDir() {
+		t.Errorf("dir has mode %v", dir.Entry.Attributes.Mode)
+	}
+
+	file := &fuseops.LookUpInodeOp{Parent: dir.Entry.Child, Name: "taco.txt"}
+	if err := k.Do(ctx, file); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+	if got := file.Entry.Attributes; got.Size != 12 || got.Mode != 0444 {
+		t.Errorf("unexpected attributes %+v", got)
+	}
+
+	open := &fuseops.OpenFileOp{Inode: file.Entry.Child}
+	if err := k.Do(ctx, open); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	read := &fuseops.ReadFileOp{Inode: file.Entry.Child, Handle: open.Handle, Offset: 5, Size: 100}
+	if err := k.Do(ctx, read); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got := string(read.Dst[:read.BytesRead]); got != "burrito" {
+		t.Errorf("read %q", got)
+	}
+
+	missing := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "nachos"}
+	if err := k.Do(ctx, missing); err != syscall.ENOENT {
+		t.Errorf("LookUpInode of missing file: %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// OpLimit limits the rate and concurrency of ops of one type.
+type OpLimit struct {
+	// The sustained number of ops per second to let through, with bursts of up
+	// to Burst ops, which defaults to the rate rounded up. Zero means no limit.
+	QPS   float64
+	Burst int
+
+	// The number of ops to let through at a time. Zero means no limit.
+	MaxConcurrent int
+}
+
+// LimitConfig configures NewLimitInterceptor.
+type LimitConfig struct {
+	// Limits for op types, keyed by the name of their type, e.g. "ReadFileOp",
+	// as for fuse.ServerConcurrency.OpWorkers. Ops of other types are limited
+	// by Default, which applies separately to each type.
+	Ops     map[string]OpLimit
+	Default OpLimit
+
+	// What to do with ops over the limits. By default they wait until they're
+	// within them, or are interrupted. If Reject is set, they instead fail
+	// straight away. Otherwise, if MaxQueued is positive, that's the most that
+	// may wait for each op type, and others fail straight away.
+	Reject    bool
+	MaxQueued int
+
+	// The error with which ops fail when they're over the limits. Defaults to
+	// syscall.EAGAIN.
+	RejectError error
+}
+
+// NewLimitInterceptor returns an Interceptor that limits the rate and
+// concurrency of ops by type, to protect a backend shared by the file system
+// from workloads that would overwhelm it. See NewInterceptedFileSystem.
+//
+// Ops that wait fail with the error from their context if they are
+// interrupted while waiting. ForgetInodeOp
+// and BatchForgetOp are never limited, since the kernel doesn't accept errors
+// for them.
+func NewLimitInterceptor(cfg LimitConfig) Interceptor {
+	if cfg.RejectError == nil {
+		cfg.RejectError = syscall.EAGAIN
+	}
+
+	l := &limiter{
+		cfg:    cfg,
+		byType: make(map[reflect.Type]*opLimiter),
+	}
+	return l.intercept
+}
+
+type limiter struct {
+	cfg LimitConfig
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	byType map[reflect.Type]*opLimiter
+}
+
+// LOCKS_EXCLUDED(l.mu)
+func (l *limiter) forOp(op interface{}) *opLimiter {
+	t := reflect.TypeOf(op)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ol, ok := l.byType[t]
+	if !ok {
+		limit, ok := l.cfg.Ops[t.Elem().Name()]
+		if !ok {
+			limit = l.cfg.Default
+		}
+		ol = newOpLimiter(limit)
+		l.byType[t] = ol
+	}
+
+	return ol
+}
+
+func (l *limiter) intercept(ctx context.Context, op interface{}, next Handler) error {
+	switch op.(type) {
+	case *fuseops.ForgetInodeOp, *fuseops.BatchForgetOp:
+		return next(ctx, op)
+	}
+
+	ol := l.forOp(op)
+	if ol == nil {
+		return next(ctx, op)
+	}
+
+	maxQueued := l.cfg.MaxQueued
+	if l.cfg.Reject {
+		maxQueued = 0
+	} else if maxQueued <= 0 {
+		maxQueued = math.MaxInt
+	}
+
+	if err := ol.acquire(ctx, maxQueued, l.cfg.RejectError); err != nil {
+		return err
+	}
+	defer ol.release()
+
+	return next(ctx, op)
+}
+
+// The limits for one op type.
+type opLimiter struct {
+	limit OpLimit
+
+	// Holds a token for each op in progress, or nil if there's no limit.
+	sem chan struct{}
+
+	mu sync.Mutex
+
+	// The token bucket as of the given time, which may be negative if ops
+	// have reserved tokens that aren't there yet.
+	//
+	// GUARDED_BY(mu)
+	tokens float64
+	last   time.Time
+
+	// The number of ops waiting.
+	//
+	// GUARDED_BY(mu)
+	queued int
+}
+
+// Return nil if the limit is no limit at all.
+func newOpLimiter(limit OpLimit) *opLimiter {
+	if limit.QPS <= 0 && limit.MaxConcurrent <= 0 {
+		return nil
+	}
+
+	if limit.Burst <= 0 {
+		limit.Burst = max(1, int(math.Ceil(limit.QPS)))
+	}
+
+	ol := &opLimiter{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+	}
+	if limit.MaxConcurrent > 0 {
+		ol.sem = make(chan struct{}, limit.MaxConcurrent)
+	}
+
+	return ol
+}
+
+// Wait for the op to be within the limits, unless more than maxQueued ops
+// are waiting already, in which case return rejectErr.
+//
+// LOCKS_EXCLUDED(ol.mu)
+func (ol *opLimiter) acquire(ctx context.Context, maxQueued int, rejectErr error) error {
+	// Take a token from the bucket, or reserve one that's yet to come.
+	var delay time.Duration
+	if ol.limit.QPS > 0 {
+		ol.mu.Lock()
+		now := time.Now()
+		ol.tokens = min(
+			float64(ol.limit.Burst),
+			ol.tokens+now.Sub(ol.last).Seconds()*ol.limit.QPS)
+		ol.last = now
+
+		if ol.tokens < 1 {
+			if ol.queued >= maxQueued {
+				ol.mu.Unlock()
+				return rejectErr
+			}
+			delay = time.Duration((1 - ol.tokens) / ol.limit.QPS * float64(time.Second))
+			ol.queued++
+		}
+		ol.tokens--
+		ol.mu.Unlock()
+	}
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+			ol.setQueued(-1)
+
+		case <-ctx.Done():
+			timer.Stop()
+			ol.setQueued(-1)
+
+			// Give the reservation back.
+			ol.mu.Lock()
+			ol.tokens++
+			ol.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+
+	if ol.sem == nil {
+		return nil
+	}
+
+	select {
+	case ol.sem <- struct{}{}:
+		return nil
+	default:
+	}
+
+	ol.mu.Lock()
+	if ol.queued >= maxQueued {
+		ol.mu.Unlock()
+		return rejectErr
+	}
+	ol.queued++
+	ol.mu.Unlock()
+	defer ol.setQueued(-1)
+
+	select {
+	case ol.sem <- struct{}{}:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LOCKS_EXCLUDED(ol.mu)
+func (ol *opLimiter) setQueued(delta int) {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+
+	ol.queued += delta
+}
+
+func (ol *opLimiter) release() {
+	if ol.sem != nil {
+		<-ol.sem
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+// A file system that records how many of its handlers run at once.
+type concurrencyFS struct {
+	fuseutil.NotImplementedFileSystem
+
+	mu      sync.Mutex
+	running map[string]int
+	peak    map[string]int
+}
+
+func (fs *concurrencyFS) enter(name string) {
+	fs.mu.Lock()
+	fs.running[name]++
+	fs.peak[name] = max(fs.peak[name], fs.running[name])
+	fs.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	fs.mu.Lock()
+	fs.running[name]--
+	fs.mu.Unlock()
+}
+
+func (fs *concurrencyFS) StatFS(ctx context.Context, op *fuseops.StatFSOp) error {
+	fs.enter("StatFS")
+	return nil
+}
+
+func (fs *concurrencyFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAttributesOp) error {
+	fs.enter("GetInodeAttributes")
+	return nil
+}
+
+func TestLimitInterceptor(t *testing.T) {
+	run := func(cfg fuseutil.LimitConfig) (fs *concurrencyFS, statFSErrs []error, elapsed time.Duration) {
+		fs = &concurrencyFS{running: make(map[string]int), peak: make(map[string]int)}
+		limited := fuseutil.NewInterceptedFileSystem(fs, fuseutil.NewLimitInterceptor(cfg))
+		k, err := fakekernel.Start(fuseutil.NewFileSystemServer(limited), nil)
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		defer k.Close()
+
+		start := time.Now()
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for j := 0; j < 8; j++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				err := k.Do(context.Background(), &fuseops.StatFSOp{})
+				mu.Lock()
+				statFSErrs = append(statFSErrs, err)
+				mu.Unlock()
+			}()
+			go func() {
+				defer wg.Done()
+				op := &fuseops.GetInodeAttributesOp{Inode: fuseops.RootInodeID}
+				if err := k.Do(context.Background(), op); err != nil {
+					t.Errorf("GetInodeAttributes: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		return fs, statFSErrs, time.Since(start)
+	}
+
+	// Ops over the limits wait.
+	fs, errs, elapsed := run(fuseutil.LimitConfig{
+		Ops:     map[string]fuseutil.OpLimit{"StatFSOp": {MaxConcurrent: 2}},
+		Default: fuseutil.OpLimit{QPS: 100, Burst: 1},
+	})
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("StatFS: %v", err)
+		}
+	}
+	if got := fs.peak["StatFS"]; got > 2 {
+		t.Errorf("StatFS peak %d, want at most 2", got)
+	}
+	if elapsed < 70*time.Millisecond {
+		t.Errorf("8 ops at 100 QPS took %v", elapsed)
+	}
+
+	// Or are rejected.
+	fs, errs, _ = run(fuseutil.LimitConfig{
+		Ops:    map[string]fuseutil.OpLimit{"StatFSOp": {MaxConcurrent: 1}},
+		Reject: true,
+	})
+	var ok, rejected int
+	for _, err := range errs {
+		switch err {
+		case nil:
+			ok++
+		case syscall.EAGAIN:
+			rejected++
+		default:
+			t.Errorf("StatFS: %v", err)
+		}
+	}
+	if ok == 0 || rejected == 0 {
+		t.Errorf("%d StatFS ops succeeded and %d were rejected", ok, rejected)
+	}
+	if got := fs.peak["GetInodeAttributes"]; got < 2 {
+		t.Errorf("GetInodeAttributes peak %d, expected no limit", got)
+	}
+}
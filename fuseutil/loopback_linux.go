@@ -0,0 +1,977 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"golang.org/x/sys/unix"
+)
+
+// NewLoopbackServer returns a server for a file system that mirrors the
+// directory at root, passing each op through to the corresponding system
+// call on the underlying file. It supports hard links, symlinks, device
+// nodes, extended attributes, flock(2) locks, fallocate(2),
+// copy_file_range(2) and lseek(2) with SEEK_DATA and SEEK_HOLE, and serves
+// reads through ReadFileOp.SpliceFile, so that they are spliced if
+// fuse.MountConfig.EnableSplice is set.
+//
+// Each inode the kernel knows about holds an O_PATH descriptor for the
+// underlying file, so it stays valid when the file is renamed, and hard links
+// to the same file share an inode. Inodes are released when the kernel
+// forgets them.
+//
+// If the server runs as root, files it creates are given to the user and
+// group of the process that made the request, as they would be by a local
+// file system. Permission checks are left to the kernel, so mount the file
+// system with the "default_permissions" option when others can use it.
+//
+// Embed the FileSystem in another to change its behavior, wrapping it with
+// NewFileSystemServer.
+func NewLoopbackServer(root string) (fuse.Server, error) {
+	fs, err := NewLoopbackFileSystem(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFileSystemServer(fs), nil
+}
+
+// NewLoopbackFileSystem returns the FileSystem served by NewLoopbackServer,
+// for use as a building block. The returned value implements
+// LoopbackFileSystem.
+func NewLoopbackFileSystem(root string) (FileSystem, error) {
+	fd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		unix.Close(fd)
+		return nil, &os.PathError{Op: "stat", Path: root, Err: err}
+	}
+
+	rootInode := &loopbackInode{
+		id:      fuseops.RootInodeID,
+		key:     loopbackKey{st.Dev, st.Ino},
+		fd:      fd,
+		lookups: 1,
+	}
+
+	fs := &loopbackFS{
+		root:       rootInode,
+		inodes:     map[fuseops.InodeID]*loopbackInode{fuseops.RootInodeID: rootInode},
+		byKey:      map[loopbackKey]*loopbackInode{rootInode.key: rootInode},
+		nextInode:  fuseops.RootInodeID + 1,
+		files:      make(map[fuseops.HandleID]*os.File),
+		dirs:       make(map[fuseops.HandleID]*loopbackDir),
+		nextHandle: 1,
+		chown:      os.Geteuid() == 0,
+	}
+
+	return fs, nil
+}
+
+// LoopbackFileSystem is implemented by the FileSystem returned by
+// NewLoopbackFileSystem, giving access to the underlying files for the
+// inodes and handles that the kernel refers to.
+type LoopbackFileSystem interface {
+	FileSystem
+
+	// Return the path of the underlying file for the inode, under
+	// /proc/self/fd, which remains valid until the inode is forgotten.
+	InodePath(id fuseops.InodeID) (string, error)
+
+	// Return the underlying open file for the handle.
+	HandleFile(h fuseops.HandleID) (*os.File, error)
+}
+
+// Underlying files are identified by device and inode number.
+type loopbackKey struct {
+	dev uint64
+	ino uint64
+}
+
+type loopbackInode struct {
+	id  fuseops.InodeID
+	key loopbackKey
+
+	// An O_PATH descriptor for the underlying file.
+	fd int
+
+	// GUARDED_BY(loopbackFS.mu)
+	lookups uint64
+}
+
+// The entries of an open directory, as of when it was last read from the
+// start, as read(2) does after rewinddir(3).
+type loopbackDir struct {
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	entries []loopbackDirent
+}
+
+type loopbackDirent struct {
+	ino  uint64
+	typ  DirentType
+	name string
+}
+
+type loopbackFS struct {
+	NotImplementedFileSystem
+
+	root *loopbackInode
+
+	// Whether to give new files to the user that created them.
+	chown bool
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	inodes    map[fuseops.InodeID]*loopbackInode
+	byKey     map[loopbackKey]*loopbackInode
+	nextInode fuseops.InodeID
+
+	// GUARDED_BY(mu)
+	files      map[fuseops.HandleID]*os.File
+	dirs       map[fuseops.HandleID]*loopbackDir
+	nextHandle fuseops.HandleID
+}
+
+var _ LoopbackFileSystem = &loopbackFS{}
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+// Convert an error from a system call to one for the kernel.
+func loopbackErrno(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno
+	}
+
+	return fuse.EIO
+}
+
+// Return the path through which a descriptor can be reopened or used with
+// system calls that don't accept O_PATH descriptors.
+func procPath(fd int) string {
+	return fmt.Sprintf("/proc/self/fd/%d", fd)
+}
+
+func timespecToTime(ts unix.Timespec) time.Time {
+	return time.Unix(ts.Unix())
+}
+
+func loopbackAttributes(st *unix.Stat_t) fuseops.InodeAttributes {
+	return fuseops.InodeAttributes{
+		Size:  uint64(st.Size),
+		Nlink: uint32(st.Nlink),
+		Mode:  fuse.ConvertFileMode(st.Mode),
+		Rdev:  uint32(st.Rdev),
+		Atime: timespecToTime(st.Atim),
+		Mtime: timespecToTime(st.Mtim),
+		Ctime: timespecToTime(st.Ctim),
+		Uid:   st.Uid,
+		Gid:   st.Gid,
+	}
+}
+
+func (fs *loopbackFS) inode(id fuseops.InodeID) (*loopbackInode, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	in, ok := fs.inodes[id]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+
+	return in, nil
+}
+
+func (fs *loopbackFS) file(h fuseops.HandleID) (*os.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	f, ok := fs.files[h]
+	if !ok {
+		return nil, fuse.EINVAL
+	}
+
+	return f, nil
+}
+
+func (fs *loopbackFS) addFile(f *os.File) fuseops.HandleID {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	h := fs.nextHandle
+	fs.nextHandle++
+	fs.files[h] = f
+	return h
+}
+
+func (fs *loopbackFS) stat(in *loopbackInode) (fuseops.InodeAttributes, error) {
+	var st unix.Stat_t
+	if err := unix.Fstatat(in.fd, "", &st, unix.AT_EMPTY_PATH|unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return fuseops.InodeAttributes{}, loopbackErrno(err)
+	}
+
+	return loopbackAttributes(&st), nil
+}
+
+// Look up the named child of the parent, filling in the entry and
+// incrementing the lookup count of its inode.
+func (fs *loopbackFS) lookUp(
+	parent *loopbackInode,
+	name string,
+	e *fuseops.ChildInodeEntry) error {
+	fd, err := unix.Openat(parent.fd, name, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return loopbackErrno(err)
+	}
+
+	var st unix.Stat_t
+	if err := unix.Fstatat(fd, "", &st, unix.AT_EMPTY_PATH|unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		unix.Close(fd)
+		return loopbackErrno(err)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	key := loopbackKey{st.Dev, st.Ino}
+	in, ok := fs.byKey[key]
+	if ok {
+		unix.Close(fd)
+	} else {
+		in = &loopbackInode{id: fs.nextInode, key: key, fd: fd}
+		fs.nextInode++
+		fs.inodes[in.id] = in
+		fs.byKey[key] = in
+	}
+	in.lookups++
+
+	e.Child = in.id
+	e.Attributes = loopbackAttributes(&st)
+	return nil
+}
+
+// Give a new file in the parent to the user that created it, if the server
+// runs as root.
+func (fs *loopbackFS) setOwner(parent *loopbackInode, name string, opCtx fuseops.OpContext) error {
+	if !fs.chown {
+		return nil
+	}
+
+	err := unix.Fchownat(parent.fd, name, int(opCtx.Uid), int(opCtx.Gid), unix.AT_SYMLINK_NOFOLLOW)
+	return loopbackErrno(err)
+}
+
+// Finish creating the named child of the parent: give it to its creator and
+// look it up.
+func (fs *loopbackFS) created(
+	parent *loopbackInode,
+	name string,
+	opCtx fuseops.OpContext,
+	e *fuseops.ChildInodeEntry) error {
+	if err := fs.setOwner(parent, name, opCtx); err != nil {
+		return err
+	}
+
+	return fs.lookUp(parent, name, e)
+}
+
+// Decrement the lookup count of the inode, releasing it when it reaches zero.
+//
+// LOCKS_REQUIRED(fs.mu)
+func (fs *loopbackFS) forget(id fuseops.InodeID, n uint64) {
+	in, ok := fs.inodes[id]
+	if !ok || in == fs.root {
+		return
+	}
+
+	in.lookups -= min(n, in.lookups)
+	if in.lookups == 0 {
+		unix.Close(in.fd)
+		delete(fs.inodes, id)
+		delete(fs.byKey, in.key)
+	}
+}
+
+// Read all the entries of the directory.
+func readLoopbackDir(f *os.File) ([]loopbackDirent, error) {
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+
+	var entries []loopbackDirent
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := unix.Getdents(int(f.Fd()), buf)
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return entries, nil
+		}
+
+		// Parse struct linux_dirent64.
+		for b := buf[:n]; len(b) > 0; {
+			ino := *(*uint64)(unsafe.Pointer(&b[0]))
+			reclen := *(*uint16)(unsafe.Pointer(&b[16]))
+			typ := b[18]
+			name := b[19:reclen]
+			for i, c := range name {
+				if c == 0 {
+					name = name[:i]
+					break
+				}
+			}
+
+			entries = append(entries, loopbackDirent{ino: ino, typ: DirentType(typ), name: string(name)})
+			b = b[reclen:]
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// LoopbackFileSystem
+////////////////////////////////////////////////////////////////////////
+
+func (fs *loopbackFS) InodePath(id fuseops.InodeID) (string, error) {
+	in, err := fs.inode(id)
+	if err != nil {
+		return "", err
+	}
+
+	return procPath(in.fd), nil
+}
+
+func (fs *loopbackFS) HandleFile(h fuseops.HandleID) (*os.File, error) {
+	return fs.file(h)
+}
+
+////////////////////////////////////////////////////////////////////////
+// FileSystem methods
+////////////////////////////////////////////////////////////////////////
+
+func (fs *loopbackFS) StatFS(
+	ctx context.Context,
+	op *fuseops.StatFSOp) error {
+	var st unix.Statfs_t
+	if err := unix.Fstatfs(fs.root.fd, &st); err != nil {
+		return loopbackErrno(err)
+	}
+
+	op.BlockSize = uint32(st.Bsize)
+	op.Blocks = st.Blocks
+	op.BlocksFree = st.Bfree
+	op.BlocksAvailable = st.Bavail
+	op.IoSize = uint32(st.Bsize)
+	op.Inodes = st.Files
+	op.InodesFree = st.Ffree
+	op.NameMaxLength = uint32(st.Namelen)
+	return nil
+}
+
+func (fs *loopbackFS) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	return fs.lookUp(parent, op.Name, &op.Entry)
+}
+
+func (fs *loopbackFS) GetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.GetInodeAttributesOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	op.Attributes, err = fs.stat(in)
+	return err
+}
+
+func (fs *loopbackFS) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	// O_PATH descriptors can't be used to change most attributes, but the
+	// file can be reached through /proc.
+	p := procPath(in.fd)
+
+	if op.Mode != nil {
+		if err := unix.Chmod(p, fuse.ConvertGoMode(*op.Mode)&07777); err != nil {
+			return loopbackErrno(err)
+		}
+	}
+
+	if op.Uid != nil || op.Gid != nil {
+		uid, gid := -1, -1
+		if op.Uid != nil {
+			uid = int(*op.Uid)
+		}
+		if op.Gid != nil {
+			gid = int(*op.Gid)
+		}
+		if err := unix.Fchownat(in.fd, "", uid, gid, unix.AT_EMPTY_PATH|unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return loopbackErrno(err)
+		}
+	}
+
+	if op.Size != nil {
+		if op.Handle != nil {
+			f, err := fs.file(*op.Handle)
+			if err != nil {
+				return err
+			}
+			err = unix.Ftruncate(int(f.Fd()), int64(*op.Size))
+		} else {
+			err = unix.Truncate(p, int64(*op.Size))
+		}
+		if err != nil {
+			return loopbackErrno(err)
+		}
+	}
+
+	if op.Atime != nil || op.Mtime != nil {
+		ts := []unix.Timespec{
+			{Nsec: unix.UTIME_OMIT},
+			{Nsec: unix.UTIME_OMIT},
+		}
+		if op.Atime != nil {
+			ts[0] = unix.NsecToTimespec(op.Atime.UnixNano())
+		}
+		if op.Mtime != nil {
+			ts[1] = unix.NsecToTimespec(op.Mtime.UnixNano())
+		}
+		if err := unix.UtimesNanoAt(unix.AT_FDCWD, p, ts, 0); err != nil {
+			return loopbackErrno(err)
+		}
+	}
+
+	op.Attributes, err = fs.stat(in)
+	return err
+}
+
+func (fs *loopbackFS) ForgetInode(
+	ctx context.Context,
+	op *fuseops.ForgetInodeOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.forget(op.Inode, op.N)
+	return nil
+}
+
+func (fs *loopbackFS) BatchForget(
+	ctx context.Context,
+	op *fuseops.BatchForgetOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for _, e := range op.Entries {
+		fs.forget(e.Inode, e.N)
+	}
+	return nil
+}
+
+func (fs *loopbackFS) MkDir(
+	ctx context.Context,
+	op *fuseops.MkDirOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	if err := unix.Mkdirat(parent.fd, op.Name, fuse.ConvertGoMode(op.Mode)&07777); err != nil {
+		return loopbackErrno(err)
+	}
+
+	return fs.created(parent, op.Name, op.OpContext, &op.Entry)
+}
+
+func (fs *loopbackFS) MkNode(
+	ctx context.Context,
+	op *fuseops.MkNodeOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	if err := unix.Mknodat(parent.fd, op.Name, fuse.ConvertGoMode(op.Mode), int(op.Rdev)); err != nil {
+		return loopbackErrno(err)
+	}
+
+	return fs.created(parent, op.Name, op.OpContext, &op.Entry)
+}
+
+func (fs *loopbackFS) CreateFile(
+	ctx context.Context,
+	op *fuseops.CreateFileOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	// The kernel gives the offsets of appending writes itself.
+	flags := int(op.OpenFlags)&^(unix.O_NOCTTY|unix.O_APPEND) | unix.O_CREAT | unix.O_CLOEXEC
+	fd, err := unix.Openat(parent.fd, op.Name, flags, fuse.ConvertGoMode(op.Mode)&07777)
+	if err != nil {
+		return loopbackErrno(err)
+	}
+
+	f := os.NewFile(uintptr(fd), op.Name)
+	if err := fs.created(parent, op.Name, op.OpContext, &op.Entry); err != nil {
+		f.Close()
+		return err
+	}
+
+	op.Handle = fs.addFile(f)
+	return nil
+}
+
+func (fs *loopbackFS) CreateSymlink(
+	ctx context.Context,
+	op *fuseops.CreateSymlinkOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	if err := unix.Symlinkat(op.Target, parent.fd, op.Name); err != nil {
+		return loopbackErrno(err)
+	}
+
+	return fs.created(parent, op.Name, op.OpContext, &op.Entry)
+}
+
+func (fs *loopbackFS) CreateLink(
+	ctx context.Context,
+	op *fuseops.CreateLinkOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	target, err := fs.inode(op.Target)
+	if err != nil {
+		return err
+	}
+
+	// Linking an O_PATH descriptor with AT_EMPTY_PATH needs
+	// CAP_DAC_READ_SEARCH, but following its /proc link doesn't.
+	err = unix.Linkat(unix.AT_FDCWD, procPath(target.fd), parent.fd, op.Name, unix.AT_SYMLINK_FOLLOW)
+	if err != nil {
+		return loopbackErrno(err)
+	}
+
+	return fs.lookUp(parent, op.Name, &op.Entry)
+}
+
+func (fs *loopbackFS) Rename(
+	ctx context.Context,
+	op *fuseops.RenameOp) error {
+	oldParent, err := fs.inode(op.OldParent)
+	if err != nil {
+		return err
+	}
+
+	newParent, err := fs.inode(op.NewParent)
+	if err != nil {
+		return err
+	}
+
+	err = unix.Renameat2(oldParent.fd, op.OldName, newParent.fd, op.NewName, uint(op.Flags))
+	return loopbackErrno(err)
+}
+
+func (fs *loopbackFS) RmDir(
+	ctx context.Context,
+	op *fuseops.RmDirOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	return loopbackErrno(unix.Unlinkat(parent.fd, op.Name, unix.AT_REMOVEDIR))
+}
+
+func (fs *loopbackFS) Unlink(
+	ctx context.Context,
+	op *fuseops.UnlinkOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	return loopbackErrno(unix.Unlinkat(parent.fd, op.Name, 0))
+}
+
+func (fs *loopbackFS) OpenDir(
+	ctx context.Context,
+	op *fuseops.OpenDirOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	// Check that the directory can be read, but list it on the first read.
+	fd, err := unix.Openat(in.fd, ".", unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return loopbackErrno(err)
+	}
+	unix.Close(fd)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	op.Handle = fs.nextHandle
+	fs.nextHandle++
+	fs.dirs[op.Handle] = &loopbackDir{}
+	return nil
+}
+
+func (fs *loopbackFS) ReadDir(
+	ctx context.Context,
+	op *fuseops.ReadDirOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	d, ok := fs.dirs[op.Handle]
+	fs.mu.Unlock()
+	if !ok {
+		return fuse.EINVAL
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if op.Offset == 0 || d.entries == nil {
+		fd, err := unix.Openat(in.fd, ".", unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return loopbackErrno(err)
+		}
+		f := os.NewFile(uintptr(fd), ".")
+		d.entries, err = readLoopbackDir(f)
+		f.Close()
+		if err != nil {
+			return loopbackErrno(err)
+		}
+	}
+
+	// Offsets are indices into the listing.
+	for i := int(op.Offset); i < len(d.entries); i++ {
+		e := d.entries[i]
+		n := WriteDirent(op.Dst[op.BytesRead:], Dirent{
+			Offset: fuseops.DirOffset(i + 1),
+			Inode:  fuseops.InodeID(e.ino),
+			Name:   e.name,
+			Type:   e.typ,
+		})
+		if n == 0 {
+			break
+		}
+		op.BytesRead += n
+	}
+
+	return nil
+}
+
+func (fs *loopbackFS) ReleaseDirHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseDirHandleOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	delete(fs.dirs, op.Handle)
+	return nil
+}
+
+func (fs *loopbackFS) OpenFile(
+	ctx context.Context,
+	op *fuseops.OpenFileOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	// The kernel gives the offsets of appending writes itself.
+	flags := int(op.OpenFlags)&^(unix.O_CREAT|unix.O_EXCL|unix.O_NOCTTY|unix.O_APPEND) | unix.O_CLOEXEC
+	fd, err := unix.Open(procPath(in.fd), flags, 0)
+	if err != nil {
+		return loopbackErrno(err)
+	}
+
+	op.Handle = fs.addFile(os.NewFile(uintptr(fd), procPath(in.fd)))
+	return nil
+}
+
+func (fs *loopbackFS) ReadFile(
+	ctx context.Context,
+	op *fuseops.ReadFileOp) error {
+	f, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	op.SpliceFile = f
+	op.SpliceOffset = op.Offset
+	op.BytesRead = int(op.Size)
+	return nil
+}
+
+func (fs *loopbackFS) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	f, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteAt(op.Data, op.Offset)
+	return loopbackErrno(err)
+}
+
+func (fs *loopbackFS) SyncFile(
+	ctx context.Context,
+	op *fuseops.SyncFileOp) error {
+	f, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	return loopbackErrno(f.Sync())
+}
+
+func (fs *loopbackFS) FlushFile(
+	ctx context.Context,
+	op *fuseops.FlushFileOp) error {
+	f, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	// Closing a duplicate of the descriptor has the effects of close(2) on
+	// the underlying file, such as writing back data on network file systems
+	// and releasing POSIX locks, without closing it for further ops.
+	fd, err := unix.Dup(int(f.Fd()))
+	if err != nil {
+		return loopbackErrno(err)
+	}
+
+	return loopbackErrno(unix.Close(fd))
+}
+
+func (fs *loopbackFS) ReleaseFileHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseFileHandleOp) error {
+	fs.mu.Lock()
+	f, ok := fs.files[op.Handle]
+	delete(fs.files, op.Handle)
+	fs.mu.Unlock()
+
+	if !ok {
+		return fuse.EINVAL
+	}
+
+	return loopbackErrno(f.Close())
+}
+
+func (fs *loopbackFS) ReadSymlink(
+	ctx context.Context,
+	op *fuseops.ReadSymlinkOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, unix.PathMax)
+	n, err := unix.Readlinkat(in.fd, "", buf)
+	if err != nil {
+		return loopbackErrno(err)
+	}
+
+	op.Target = string(buf[:n])
+	return nil
+}
+
+func (fs *loopbackFS) GetXattr(
+	ctx context.Context,
+	op *fuseops.GetXattrOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	op.BytesRead, err = unix.Getxattr(procPath(in.fd), op.Name, op.Dst)
+	return loopbackErrno(err)
+}
+
+func (fs *loopbackFS) ListXattr(
+	ctx context.Context,
+	op *fuseops.ListXattrOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	op.BytesRead, err = unix.Listxattr(procPath(in.fd), op.Dst)
+	return loopbackErrno(err)
+}
+
+func (fs *loopbackFS) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	err = unix.Setxattr(procPath(in.fd), op.Name, op.Value, int(op.Flags))
+	return loopbackErrno(err)
+}
+
+func (fs *loopbackFS) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	return loopbackErrno(unix.Removexattr(procPath(in.fd), op.Name))
+}
+
+func (fs *loopbackFS) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) error {
+	f, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	err = unix.Fallocate(int(f.Fd()), uint32(op.Mode), int64(op.Offset), int64(op.Length))
+	return loopbackErrno(err)
+}
+
+func (fs *loopbackFS) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	src, err := fs.file(op.SrcHandle)
+	if err != nil {
+		return err
+	}
+
+	dst, err := fs.file(op.DstHandle)
+	if err != nil {
+		return err
+	}
+
+	srcOff, dstOff := int64(op.SrcOffset), int64(op.DstOffset)
+	n, err := unix.CopyFileRange(int(src.Fd()), &srcOff, int(dst.Fd()), &dstOff, int(op.Length), int(op.Flags))
+	if err != nil {
+		return loopbackErrno(err)
+	}
+
+	op.BytesCopied = uint64(n)
+	return nil
+}
+
+func (fs *loopbackFS) SeekFile(
+	ctx context.Context,
+	op *fuseops.SeekFileOp) error {
+	f, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	op.ResultOffset, err = unix.Seek(int(f.Fd()), op.Offset, op.Whence)
+	return loopbackErrno(err)
+}
+
+func (fs *loopbackFS) Access(
+	ctx context.Context,
+	op *fuseops.AccessOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	return loopbackErrno(unix.Faccessat(unix.AT_FDCWD, procPath(in.fd), op.Mask, 0))
+}
+
+func (fs *loopbackFS) Flock(
+	ctx context.Context,
+	op *fuseops.FlockOp) error {
+	f, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	how := op.Operation
+	if !op.Block {
+		how |= unix.LOCK_NB
+	}
+
+	return loopbackErrno(unix.Flock(int(f.Fd()), how))
+}
+
+func (fs *loopbackFS) SyncFS(
+	ctx context.Context,
+	op *fuseops.SyncFSOp) error {
+	return loopbackErrno(unix.Syncfs(fs.root.fd))
+}
+
+func (fs *loopbackFS) Destroy() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for _, f := range fs.files {
+		f.Close()
+	}
+	for _, in := range fs.inodes {
+		unix.Close(in.fd)
+	}
+}
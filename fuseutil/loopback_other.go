@@ -0,0 +1,32 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package fuseutil
+
+import (
+	"github.com/jacobsa/fuse"
+)
+
+// NewLoopbackServer is not supported on this platform.
+func NewLoopbackServer(root string) (fuse.Server, error) {
+	return nil, fuse.ENOSYS
+}
+
+// NewLoopbackFileSystem is not supported on this platform.
+func NewLoopbackFileSystem(root string) (FileSystem, error) {
+	return nil, fuse.ENOSYS
+}
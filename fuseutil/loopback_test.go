@@ -0,0 +1,154 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+func TestLoopback(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/existing", []byte("taco"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	server, err := fuseutil.NewLoopbackServer(dir)
+	if err != nil {
+		t.Fatalf("NewLoopbackServer: %v", err)
+	}
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(server, nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	// Read a file that was already there.
+	existing := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "existing"}
+	if err := k.Do(ctx, existing); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+	if got := existing.Entry.Attributes; got.Size != 4 || got.Mode != 0644 {
+		t.Errorf("unexpected attributes %+v", got)
+	}
+
+	open := &fuseops.OpenFileOp{Inode: existing.Entry.Child, OpenFlags: fusekernel.OpenReadOnly}
+	if err := k.Do(ctx, open); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	read := &fuseops.ReadFileOp{Inode: existing.Entry.Child, Handle: open.Handle, Size: 100}
+	if err := k.Do(ctx, read); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got := string(read.Dst[:read.BytesRead]); got != "taco" {
+		t.Errorf("read %q", got)
+	}
+
+	// Create a file in a new directory, and write to it.
+	mkDir := &fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "dir", Mode: os.ModeDir | 0755}
+	if err := k.Do(ctx, mkDir); err != nil {
+		t.Fatalf("MkDir: %v", err)
+	}
+	create := &fuseops.CreateFileOp{Parent: mkDir.Entry.Child, Name: "file", Mode: 0600, OpenFlags: fusekernel.OpenReadWrite}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: []byte("burrito")}
+	if err := k.Do(ctx, write); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := k.Do(ctx, &fuseops.ReleaseFileHandleOp{Handle: create.Handle}); err != nil {
+		t.Fatalf("ReleaseFileHandle: %v", err)
+	}
+	if b, err := os.ReadFile(dir + "/dir/file"); err != nil || string(b) != "burrito" {
+		t.Errorf("ReadFile: %q, %v", b, err)
+	}
+
+	// A hard link shares the inode, which survives renaming the directory.
+	link := &fuseops.CreateLinkOp{Parent: fuseops.RootInodeID, Name: "link", Target: create.Entry.Child}
+	if err := k.Do(ctx, link); err != nil {
+		t.Fatalf("CreateLink: %v", err)
+	}
+	if link.Entry.Child != create.Entry.Child || link.Entry.Attributes.Nlink != 2 {
+		t.Errorf("unexpected link entry %+v", link.Entry)
+	}
+	rename := &fuseops.RenameOp{OldParent: fuseops.RootInodeID, OldName: "dir", NewParent: fuseops.RootInodeID, NewName: "renamed"}
+	if err := k.Do(ctx, rename); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	getAttr := &fuseops.GetInodeAttributesOp{Inode: create.Entry.Child}
+	if err := k.Do(ctx, getAttr); err != nil {
+		t.Fatalf("GetInodeAttributes: %v", err)
+	}
+	if getAttr.Attributes.Size != 7 {
+		t.Errorf("unexpected attributes %+v", getAttr.Attributes)
+	}
+
+	symlink := &fuseops.CreateSymlinkOp{Parent: fuseops.RootInodeID, Name: "symlink", Target: "renamed/file"}
+	if err := k.Do(ctx, symlink); err != nil {
+		t.Fatalf("CreateSymlink: %v", err)
+	}
+	readlink := &fuseops.ReadSymlinkOp{Inode: symlink.Entry.Child}
+	if err := k.Do(ctx, readlink); err != nil {
+		t.Fatalf("ReadSymlink: %v", err)
+	}
+	if readlink.Target != "renamed/file" {
+		t.Errorf("symlink target %q", readlink.Target)
+	}
+
+	openDir := &fuseops.OpenDirOp{Inode: fuseops.RootInodeID}
+	if err := k.Do(ctx, openDir); err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	readDir := &fuseops.ReadDirOp{Inode: fuseops.RootInodeID, Handle: openDir.Handle, Dst: make([]byte, 4096)}
+	if err := k.Do(ctx, readDir); err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for buf := readDir.Dst[:readDir.BytesRead]; len(buf) > 0; {
+		d := (*fusekernel.Dirent)(unsafe.Pointer(&buf[0]))
+		names = append(names, string(buf[fusekernel.DirentSize:fusekernel.DirentSize+int(d.Namelen)]))
+		buf = buf[(fusekernel.DirentSize+int(d.Namelen)+7)&^7:]
+	}
+	sort.Strings(names)
+	if want := []string{".", "..", "existing", "link", "renamed", "symlink"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("listed %q, want %q", names, want)
+	}
+
+	unlink := &fuseops.UnlinkOp{Parent: fuseops.RootInodeID, Name: "link"}
+	if err := k.Do(ctx, unlink); err != nil {
+		t.Fatalf("Unlink: %v", err)
+	}
+	if _, err := os.Lstat(dir + "/link"); !os.IsNotExist(err) {
+		t.Errorf("Lstat after unlink: %v", err)
+	}
+
+	missing := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "link"}
+	if err := k.Do(ctx, missing); err != syscall.ENOENT {
+		t.Errorf("LookUpInode of removed link: %v", err)
+	}
+}
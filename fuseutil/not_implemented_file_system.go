@@ -48,6 +48,12 @@ func (fs *NotImplementedFileSystem) GetInodeAttributes(
 	return fuse.ENOSYS
 }
 
+func (fs *NotImplementedFileSystem) Statx(
+	ctx context.Context,
+	op *fuseops.StatxOp) error {
+	return fuse.ENOSYS
+}
+
 func (fs *NotImplementedFileSystem) SetInodeAttributes(
 	ctx context.Context,
 	op *fuseops.SetInodeAttributesOp) error {
@@ -84,6 +90,12 @@ func (fs *NotImplementedFileSystem) CreateFile(
 	return fuse.ENOSYS
 }
 
+func (fs *NotImplementedFileSystem) CreateTmpFile(
+	ctx context.Context,
+	op *fuseops.CreateTmpFileOp) error {
+	return fuse.ENOSYS
+}
+
 func (fs *NotImplementedFileSystem) CreateSymlink(
 	ctx context.Context,
 	op *fuseops.CreateSymlinkOp) error {
@@ -210,6 +222,36 @@ func (fs *NotImplementedFileSystem) Fallocate(
 	return fuse.ENOSYS
 }
 
+func (fs *NotImplementedFileSystem) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	return fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) SeekFile(
+	ctx context.Context,
+	op *fuseops.SeekFileOp) error {
+	return fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) Poll(
+	ctx context.Context,
+	op *fuseops.PollOp) error {
+	return fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) Access(
+	ctx context.Context,
+	op *fuseops.AccessOp) error {
+	return fuse.ENOSYS
+}
+
+func (fs *NotImplementedFileSystem) Flock(
+	ctx context.Context,
+	op *fuseops.FlockOp) error {
+	return fuse.ENOSYS
+}
+
 func (fs *NotImplementedFileSystem) SyncFS(
 	ctx context.Context,
 	op *fuseops.SyncFSOp) error {
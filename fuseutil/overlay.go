@@ -0,0 +1,1531 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+// Names that mark files as removed in the layers of an overlay. A whiteout
+// named ".wh.<name>" hides <name> in the layers below its own, and a
+// directory containing an opaque marker hides the directories of the same
+// name below it. These are the conventions of OCI image layers.
+const (
+	WhiteoutPrefix = ".wh."
+	OpaqueMarker   = ".wh..wh..opq"
+)
+
+// NewOverlayFileSystem returns a FileSystem that merges the trees of a
+// writable upper file system and read-only lower ones, as overlayfs does.
+// A file is taken from the top-most layer that has it, and directories
+// present in several layers have their entries merged.
+//
+// Files in the lower layers are copied up to the upper one before they or
+// their attributes are modified, along with the directories above them, and
+// files that are removed from a lower layer are hidden with whiteouts in the
+// upper one. See WhiteoutPrefix and OpaqueMarker, which are never listed.
+//
+// Directories that exist in a lower layer can't be renamed, which fails with
+// EXDEV, as it does for overlayfs without redirects; mv(1) falls back to
+// copying them. The layers must not be modified other than through the
+// overlay while it's in use. Other layers than the upper one are never
+// modified.
+func NewOverlayFileSystem(upper FileSystem, lowers ...FileSystem) FileSystem {
+	layers := append([]FileSystem{upper}, lowers...)
+	root := &overlayInode{
+		id:       fuseops.RootInodeID,
+		dir:      true,
+		children: make(map[string]*overlayInode),
+		lookups:  1,
+	}
+	for i := range layers {
+		root.refs = append(root.refs, overlayRef{layer: i, inode: fuseops.RootInodeID})
+	}
+
+	return &overlayFS{
+		layers:     layers,
+		root:       root,
+		inodes:     map[fuseops.InodeID]*overlayInode{fuseops.RootInodeID: root},
+		nextInode:  fuseops.RootInodeID + 1,
+		files:      make(map[fuseops.HandleID]overlayHandle),
+		dirs:       make(map[fuseops.HandleID][]Dirent),
+		nextHandle: 1,
+	}
+}
+
+// An inode in one of the layers, and the number of lookups of it by the
+// overlay, which it forgets when it no longer needs it.
+type overlayRef struct {
+	layer   int
+	inode   fuseops.InodeID
+	lookups uint64
+}
+
+// An inode of the overlay. Inodes form a tree, with each holding on to its
+// parent as long as it's in the tree itself, so that it can be copied up.
+type overlayInode struct {
+	id  fuseops.InodeID
+	dir bool
+
+	// GUARDED_BY(overlayFS.mu)
+	parent   *overlayInode
+	name     string
+	children map[string]*overlayInode
+	removed  bool
+	lookups  uint64
+
+	// The layers in which the file exists, top-most first. Only directories
+	// can exist in more than one layer.
+	//
+	// GUARDED_BY(overlayFS.mu)
+	refs []overlayRef
+}
+
+// A file handle of the overlay, and the layer and handle that it stands for.
+type overlayHandle struct {
+	layer  int
+	inode  fuseops.InodeID
+	handle fuseops.HandleID
+}
+
+type overlayFS struct {
+	NotImplementedFileSystem
+
+	// The upper layer, followed by the lower ones.
+	layers []FileSystem
+	root   *overlayInode
+
+	// Held exclusively while changing the trees of the layers, and shared
+	// while looking files up in them, so that lookups see consistent layers.
+	treeMu sync.RWMutex
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	inodes    map[fuseops.InodeID]*overlayInode
+	nextInode fuseops.InodeID
+
+	// Open files, and the merged entries of open directories as of when they
+	// were opened.
+	//
+	// GUARDED_BY(mu)
+	files      map[fuseops.HandleID]overlayHandle
+	dirs       map[fuseops.HandleID][]Dirent
+	nextHandle fuseops.HandleID
+}
+
+////////////////////////////////////////////////////////////////////////
+// Layers
+////////////////////////////////////////////////////////////////////////
+
+func isWhiteout(name string) bool {
+	return strings.HasPrefix(name, WhiteoutPrefix)
+}
+
+// Look up the named child of a directory in a layer.
+func (fs *overlayFS) lookUpIn(
+	ctx context.Context,
+	dir overlayRef,
+	name string) (fuseops.ChildInodeEntry, error) {
+	op := &fuseops.LookUpInodeOp{Parent: dir.inode, Name: name}
+	err := fs.layers[dir.layer].LookUpInode(ctx, op)
+	return op.Entry, err
+}
+
+// Forget lookups of inodes in the layers.
+func (fs *overlayFS) forgetRefs(ctx context.Context, refs []overlayRef) {
+	for _, r := range refs {
+		if r.lookups > 0 {
+			fs.layers[r.layer].ForgetInode(ctx, &fuseops.ForgetInodeOp{Inode: r.inode, N: r.lookups})
+		}
+	}
+}
+
+// Return true if the named child of a directory exists in a layer.
+func (fs *overlayFS) existsIn(ctx context.Context, dir overlayRef, name string) (bool, error) {
+	e, err := fs.lookUpIn(ctx, dir, name)
+	if errors.Is(err, fuse.ENOENT) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	fs.forgetRefs(ctx, []overlayRef{{layer: dir.layer, inode: e.Child, lookups: 1}})
+	return true, nil
+}
+
+// Find the named child of a directory in the layers, given where the
+// directory exists, returning where the child exists and its attributes in
+// the top-most of those.
+func (fs *overlayFS) resolve(
+	ctx context.Context,
+	dirRefs []overlayRef,
+	name string) ([]overlayRef, fuseops.InodeAttributes, error) {
+	var refs []overlayRef
+	var attrs fuseops.InodeAttributes
+
+	fail := func(err error) ([]overlayRef, fuseops.InodeAttributes, error) {
+		fs.forgetRefs(ctx, refs)
+		return nil, fuseops.InodeAttributes{}, err
+	}
+
+	for i, dir := range dirRefs {
+		e, err := fs.lookUpIn(ctx, dir, name)
+		switch {
+		case err == nil:
+			ref := overlayRef{layer: dir.layer, inode: e.Child, lookups: 1}
+
+			// Only directories are merged; anything else hides what's below.
+			isDir := e.Attributes.Mode.IsDir()
+			if len(refs) > 0 && !isDir {
+				fs.forgetRefs(ctx, []overlayRef{ref})
+				return refs, attrs, nil
+			}
+			if len(refs) == 0 {
+				attrs = e.Attributes
+			}
+			refs = append(refs, ref)
+			if !isDir {
+				return refs, attrs, nil
+			}
+
+			opaque, err := fs.existsIn(ctx, ref, OpaqueMarker)
+			if err != nil {
+				return fail(err)
+			}
+			if opaque {
+				return refs, attrs, nil
+			}
+
+		case !errors.Is(err, fuse.ENOENT):
+			return fail(err)
+		}
+
+		// A whiteout hides the child in the layers below.
+		if i < len(dirRefs)-1 {
+			whiteout, err := fs.existsIn(ctx, dir, WhiteoutPrefix+name)
+			if err != nil {
+				return fail(err)
+			}
+			if whiteout {
+				break
+			}
+		}
+	}
+
+	if len(refs) == 0 {
+		return nil, attrs, fuse.ENOENT
+	}
+
+	return refs, attrs, nil
+}
+
+// Return all the entries of a directory in a layer.
+func (fs *overlayFS) readDirIn(ctx context.Context, dir overlayRef) ([]Dirent, error) {
+	layer := fs.layers[dir.layer]
+	open := &fuseops.OpenDirOp{Inode: dir.inode}
+	if err := layer.OpenDir(ctx, open); err != nil {
+		return nil, err
+	}
+	defer layer.ReleaseDirHandle(ctx, &fuseops.ReleaseDirHandleOp{Handle: open.Handle})
+
+	var entries []Dirent
+	var offset fuseops.DirOffset
+	buf := make([]byte, 64<<10)
+	for {
+		op := &fuseops.ReadDirOp{Inode: dir.inode, Handle: open.Handle, Offset: offset, Dst: buf}
+		if err := layer.ReadDir(ctx, op); err != nil {
+			return nil, err
+		}
+		if op.BytesRead == 0 {
+			return entries, nil
+		}
+
+		for b := buf[:op.BytesRead]; len(b) > 0; {
+			d, n := ReadDirent(b)
+			if n == 0 {
+				break
+			}
+			entries = append(entries, d)
+			offset = d.Offset
+			b = b[n:]
+		}
+	}
+}
+
+// Return the merged entries of a directory, given where it exists.
+func (fs *overlayFS) mergeDir(ctx context.Context, refs []overlayRef) ([]Dirent, error) {
+	var merged []Dirent
+	hidden := make(map[string]bool)
+	for _, ref := range refs {
+		entries, err := fs.readDirIn(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		var opaque bool
+		var whiteouts []string
+		for _, d := range entries {
+			switch {
+			case d.Name == "." || d.Name == "..":
+			case d.Name == OpaqueMarker:
+				opaque = true
+			case isWhiteout(d.Name):
+				whiteouts = append(whiteouts, strings.TrimPrefix(d.Name, WhiteoutPrefix))
+			case !hidden[d.Name]:
+				hidden[d.Name] = true
+				merged = append(merged, d)
+			}
+		}
+
+		if opaque {
+			break
+		}
+		for _, name := range whiteouts {
+			hidden[name] = true
+		}
+	}
+
+	return merged, nil
+}
+
+// Return the entries of the directory in the upper layer that only serve to
+// hide the contents of the lower layers.
+func (fs *overlayFS) upperMarkers(ctx context.Context, dir overlayRef) ([]string, error) {
+	entries, err := fs.readDirIn(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, d := range entries {
+		if isWhiteout(d.Name) {
+			names = append(names, d.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// Create an empty file in a directory of the upper layer.
+func (fs *overlayFS) createMarker(ctx context.Context, dir fuseops.InodeID, name string) error {
+	upper := fs.layers[0]
+	op := &fuseops.CreateFileOp{Parent: dir, Name: name, Mode: 0000}
+	if err := upper.CreateFile(ctx, op); err != nil {
+		return err
+	}
+
+	upper.ReleaseFileHandle(ctx, &fuseops.ReleaseFileHandleOp{Handle: op.Handle})
+	fs.forgetRefs(ctx, []overlayRef{{layer: 0, inode: op.Entry.Child, lookups: 1}})
+	return nil
+}
+
+// Copy the contents of a file in a lower layer to a file open in the upper
+// layer.
+func (fs *overlayFS) copyData(
+	ctx context.Context,
+	src overlayRef,
+	dst fuseops.InodeID,
+	dstHandle fuseops.HandleID) error {
+	lower := fs.layers[src.layer]
+	open := &fuseops.OpenFileOp{Inode: src.inode, OpenFlags: fusekernel.OpenReadOnly}
+	if err := lower.OpenFile(ctx, open); err != nil {
+		return err
+	}
+	defer lower.ReleaseFileHandle(ctx, &fuseops.ReleaseFileHandleOp{Handle: open.Handle})
+
+	const blockSize = 128 << 10
+	buf := make([]byte, blockSize)
+	for off := int64(0); ; {
+		read := &fuseops.ReadFileOp{Inode: src.inode, Handle: open.Handle, Offset: off, Size: blockSize, Dst: buf}
+		if err := lower.ReadFile(ctx, read); err != nil {
+			return err
+		}
+
+		data, err := ReadFileData(read)
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+
+		write := &fuseops.WriteFileOp{Inode: dst, Handle: dstHandle, Offset: off, Data: data}
+		if err := fs.layers[0].WriteFile(ctx, write); err != nil {
+			return err
+		}
+		off += int64(len(data))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Inodes
+////////////////////////////////////////////////////////////////////////
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *overlayFS) inode(id fuseops.InodeID) (*overlayInode, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	in, ok := fs.inodes[id]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+
+	return in, nil
+}
+
+// Return a copy of the refs of the inode.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *overlayFS) refs(in *overlayInode) []overlayRef {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return append([]overlayRef(nil), in.refs...)
+}
+
+// Return the top-most layer in which the inode exists.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *overlayFS) top(in *overlayInode) overlayRef {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return in.refs[0]
+}
+
+// Release the inode if nothing refers to it anymore, and then its parent,
+// returning the refs to forget.
+//
+// LOCKS_REQUIRED(fs.mu)
+func (fs *overlayFS) release(in *overlayInode) []overlayRef {
+	var forget []overlayRef
+	for in != nil && in != fs.root && in.lookups == 0 && len(in.children) == 0 {
+		delete(fs.inodes, in.id)
+		forget = append(forget, in.refs...)
+
+		parent := in.parent
+		if !in.removed {
+			delete(parent.children, in.name)
+		}
+		in = parent
+	}
+
+	return forget
+}
+
+// Detach the inode from the tree, once its name has been removed.
+//
+// LOCKS_REQUIRED(fs.mu)
+func (fs *overlayFS) detach(in *overlayInode) []overlayRef {
+	parent := in.parent
+	delete(parent.children, in.name)
+	in.removed = true
+
+	return append(fs.release(in), fs.release(parent)...)
+}
+
+// Return the named child of the directory, adding it to the tree without
+// counting a lookup if it isn't there already.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *overlayFS) child(
+	ctx context.Context,
+	parent *overlayInode,
+	name string) (*overlayInode, fuseops.InodeAttributes, error) {
+	if isWhiteout(name) {
+		return nil, fuseops.InodeAttributes{}, fuse.ENOENT
+	}
+
+	fs.mu.Lock()
+	in, ok := parent.children[name]
+	fs.mu.Unlock()
+
+	if ok {
+		top := fs.top(in)
+		op := &fuseops.GetInodeAttributesOp{Inode: top.inode}
+		err := fs.layers[top.layer].GetInodeAttributes(ctx, op)
+		return in, op.Attributes, err
+	}
+
+	refs, attrs, err := fs.resolve(ctx, fs.refs(parent), name)
+	if err != nil {
+		return nil, attrs, err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// Someone else may have added it meanwhile.
+	if in, ok := parent.children[name]; ok {
+		go fs.forgetRefs(context.Background(), refs)
+		return in, attrs, nil
+	}
+
+	in = fs.newInode(parent, name, attrs.Mode.IsDir(), refs)
+	return in, attrs, nil
+}
+
+// LOCKS_REQUIRED(fs.mu)
+func (fs *overlayFS) newInode(
+	parent *overlayInode,
+	name string,
+	dir bool,
+	refs []overlayRef) *overlayInode {
+	in := &overlayInode{
+		id:     fs.nextInode,
+		dir:    dir,
+		parent: parent,
+		name:   name,
+		refs:   refs,
+	}
+	if dir {
+		in.children = make(map[string]*overlayInode)
+	}
+
+	fs.nextInode++
+	fs.inodes[in.id] = in
+	parent.children[name] = in
+	return in
+}
+
+// Copy the inode up to the upper layer, if it isn't there already, along with
+// its ancestors, returning where it is in the upper layer.
+//
+// EXCLUSIVE_LOCKS_REQUIRED(fs.treeMu)
+func (fs *overlayFS) copyUp(ctx context.Context, in *overlayInode) (fuseops.InodeID, error) {
+	fs.mu.Lock()
+	top, parent, name, removed := in.refs[0], in.parent, in.name, in.removed
+	fs.mu.Unlock()
+
+	if top.layer == 0 {
+		return top.inode, nil
+	}
+	if removed {
+		return 0, fuse.ENOENT
+	}
+
+	upperParent, err := fs.copyUp(ctx, parent)
+	if err != nil {
+		return 0, err
+	}
+
+	lower := fs.layers[top.layer]
+	attrsOp := &fuseops.GetInodeAttributesOp{Inode: top.inode}
+	if err := lower.GetInodeAttributes(ctx, attrsOp); err != nil {
+		return 0, err
+	}
+	attrs := attrsOp.Attributes
+
+	upper := fs.layers[0]
+	var entry fuseops.ChildInodeEntry
+	switch {
+	case attrs.Mode.IsDir():
+		op := &fuseops.MkDirOp{Parent: upperParent, Name: name, Mode: attrs.Mode}
+		err = upper.MkDir(ctx, op)
+		entry = op.Entry
+
+	case attrs.Mode&os.ModeSymlink != 0:
+		readlink := &fuseops.ReadSymlinkOp{Inode: top.inode}
+		if err := lower.ReadSymlink(ctx, readlink); err != nil {
+			return 0, err
+		}
+		op := &fuseops.CreateSymlinkOp{Parent: upperParent, Name: name, Target: readlink.Target}
+		err = upper.CreateSymlink(ctx, op)
+		entry = op.Entry
+
+	case attrs.Mode.IsRegular():
+		op := &fuseops.CreateFileOp{Parent: upperParent, Name: name, Mode: attrs.Mode, OpenFlags: fusekernel.OpenWriteOnly}
+		if err := upper.CreateFile(ctx, op); err != nil {
+			return 0, err
+		}
+		err = fs.copyData(ctx, top, op.Entry.Child, op.Handle)
+		upper.ReleaseFileHandle(ctx, &fuseops.ReleaseFileHandleOp{Handle: op.Handle})
+		entry = op.Entry
+
+	default:
+		op := &fuseops.MkNodeOp{Parent: upperParent, Name: name, Mode: attrs.Mode, Rdev: attrs.Rdev}
+		err = upper.MkNode(ctx, op)
+		entry = op.Entry
+	}
+
+	if err != nil {
+		if entry.Child != 0 {
+			fs.forgetRefs(ctx, []overlayRef{{layer: 0, inode: entry.Child, lookups: 1}})
+		}
+		return 0, err
+	}
+
+	// Keep the times, where the upper layer lets us.
+	upper.SetInodeAttributes(ctx, &fuseops.SetInodeAttributesOp{
+		Inode: entry.Child,
+		Atime: &attrs.Atime,
+		Mtime: &attrs.Mtime,
+	})
+
+	// Directories keep merging with the lower layers. Anything else now lives
+	// in the upper layer alone.
+	fs.mu.Lock()
+	upperRef := overlayRef{layer: 0, inode: entry.Child, lookups: 1}
+	var forget []overlayRef
+	if in.dir {
+		in.refs = append([]overlayRef{upperRef}, in.refs...)
+	} else {
+		forget = in.refs
+		in.refs = []overlayRef{upperRef}
+	}
+	fs.mu.Unlock()
+
+	fs.forgetRefs(ctx, forget)
+	return entry.Child, nil
+}
+
+// Prepare to create the named child in a directory of the upper layer,
+// removing any whiteout for it, and returning whether there was one.
+//
+// EXCLUSIVE_LOCKS_REQUIRED(fs.treeMu)
+func (fs *overlayFS) prepareCreate(
+	ctx context.Context,
+	parent *overlayInode,
+	name string) (fuseops.InodeID, bool, error) {
+	if isWhiteout(name) {
+		return 0, false, fuse.EINVAL
+	}
+
+	if _, _, err := fs.child(ctx, parent, name); err == nil {
+		return 0, false, fuse.EEXIST
+	} else if !errors.Is(err, fuse.ENOENT) {
+		return 0, false, err
+	}
+
+	upperParent, err := fs.copyUp(ctx, parent)
+	if err != nil {
+		return 0, false, err
+	}
+
+	dir := overlayRef{layer: 0, inode: upperParent}
+	whiteout, err := fs.existsIn(ctx, dir, WhiteoutPrefix+name)
+	if err != nil || !whiteout {
+		return upperParent, false, err
+	}
+
+	err = fs.layers[0].Unlink(ctx, &fuseops.UnlinkOp{Parent: upperParent, Name: WhiteoutPrefix + name})
+	return upperParent, true, err
+}
+
+// Add a child created in the upper layer to the tree, counting a lookup, and
+// replacing the entry's inode with its own.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *overlayFS) created(parent *overlayInode, name string, e *fuseops.ChildInodeEntry) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	ref := overlayRef{layer: 0, inode: e.Child, lookups: 1}
+	in := fs.newInode(parent, name, e.Attributes.Mode.IsDir(), []overlayRef{ref})
+	in.lookups++
+	e.Child = in.id
+}
+
+// Remove the named child of the directory, leaving a whiteout in its place
+// if it exists in a lower layer.
+//
+// EXCLUSIVE_LOCKS_REQUIRED(fs.treeMu)
+func (fs *overlayFS) remove(ctx context.Context, parent *overlayInode, name string, dir bool) error {
+	in, attrs, err := fs.child(ctx, parent, name)
+	if err != nil {
+		return err
+	}
+
+	if dir != attrs.Mode.IsDir() {
+		if dir {
+			return fuse.ENOTDIR
+		}
+		return syscall.EISDIR
+	}
+
+	refs := fs.refs(in)
+	if dir {
+		entries, err := fs.mergeDir(ctx, refs)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return fuse.ENOTEMPTY
+		}
+	}
+
+	upperParent, err := fs.copyUp(ctx, parent)
+	if err != nil {
+		return err
+	}
+
+	upper := fs.layers[0]
+	if refs[0].layer == 0 {
+		if dir {
+			// Remove what hides the lower layers, so that the directory is
+			// empty.
+			markers, err := fs.upperMarkers(ctx, refs[0])
+			if err != nil {
+				return err
+			}
+			for _, m := range markers {
+				if err := upper.Unlink(ctx, &fuseops.UnlinkOp{Parent: refs[0].inode, Name: m}); err != nil {
+					return err
+				}
+			}
+			err = upper.RmDir(ctx, &fuseops.RmDirOp{Parent: upperParent, Name: name})
+		} else {
+			err = upper.Unlink(ctx, &fuseops.UnlinkOp{Parent: upperParent, Name: name})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if refs[len(refs)-1].layer > 0 {
+		if err := fs.createMarker(ctx, upperParent, WhiteoutPrefix+name); err != nil {
+			return err
+		}
+	}
+
+	fs.mu.Lock()
+	forget := fs.detach(in)
+	fs.mu.Unlock()
+
+	fs.forgetRefs(ctx, forget)
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////
+// Handles
+////////////////////////////////////////////////////////////////////////
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *overlayFS) addFile(h overlayHandle) fuseops.HandleID {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	id := fs.nextHandle
+	fs.nextHandle++
+	fs.files[id] = h
+	return id
+}
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *overlayFS) file(id fuseops.HandleID) (overlayHandle, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	h, ok := fs.files[id]
+	if !ok {
+		return h, fuse.EINVAL
+	}
+
+	return h, nil
+}
+
+// Direntries of the overlay that aren't known to it get inode IDs derived
+// from their parent and name, outside of the range that it allocates.
+func overlayDirentInode(parent fuseops.InodeID, name string) fuseops.InodeID {
+	h := fnv.New64a()
+	var b [8]byte
+	for i := range b {
+		b[i] = byte(parent >> (8 * i))
+	}
+	h.Write(b[:])
+	io.WriteString(h, name)
+	return fuseops.InodeID(h.Sum64() | 1<<63)
+}
+
+////////////////////////////////////////////////////////////////////////
+// FileSystem methods
+////////////////////////////////////////////////////////////////////////
+
+func (fs *overlayFS) StatFS(
+	ctx context.Context,
+	op *fuseops.StatFSOp) error {
+	return fs.layers[0].StatFS(ctx, op)
+}
+
+func (fs *overlayFS) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	fs.treeMu.RLock()
+	defer fs.treeMu.RUnlock()
+
+	in, attrs, err := fs.child(ctx, parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	in.lookups++
+	fs.mu.Unlock()
+
+	op.Entry.Child = in.id
+	op.Entry.Attributes = attrs
+	return nil
+}
+
+func (fs *overlayFS) GetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.GetInodeAttributesOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	top := fs.top(in)
+	op.Inode, op.Handle = top.inode, nil
+	defer func() { op.Inode = in.id }()
+	return fs.layers[top.layer].GetInodeAttributes(ctx, op)
+}
+
+func (fs *overlayFS) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	fs.treeMu.Lock()
+	upperInode, err := fs.copyUp(ctx, in)
+	fs.treeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	handle := op.Handle
+	if handle != nil {
+		op.Handle = nil
+		if h, err := fs.file(*handle); err == nil && h.layer == 0 {
+			op.Handle = &h.handle
+		}
+	}
+
+	op.Inode = upperInode
+	defer func() { op.Inode, op.Handle = in.id, handle }()
+	return fs.layers[0].SetInodeAttributes(ctx, op)
+}
+
+func (fs *overlayFS) ForgetInode(
+	ctx context.Context,
+	op *fuseops.ForgetInodeOp) error {
+	fs.mu.Lock()
+	var forget []overlayRef
+	if in, ok := fs.inodes[op.Inode]; ok && in != fs.root {
+		in.lookups -= min(op.N, in.lookups)
+		forget = fs.release(in)
+	}
+	fs.mu.Unlock()
+
+	fs.forgetRefs(ctx, forget)
+	return nil
+}
+
+func (fs *overlayFS) BatchForget(
+	ctx context.Context,
+	op *fuseops.BatchForgetOp) error {
+	for _, e := range op.Entries {
+		fs.ForgetInode(ctx, &fuseops.ForgetInodeOp{Inode: e.Inode, N: e.N})
+	}
+	return nil
+}
+
+func (fs *overlayFS) MkDir(
+	ctx context.Context,
+	op *fuseops.MkDirOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	fs.treeMu.Lock()
+	defer fs.treeMu.Unlock()
+
+	upperParent, whiteout, err := fs.prepareCreate(ctx, parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	op.Parent = upperParent
+	err = fs.layers[0].MkDir(ctx, op)
+	op.Parent = parent.id
+	if err != nil {
+		return err
+	}
+
+	// A directory replacing one that was removed mustn't show its contents.
+	if whiteout {
+		if err := fs.createMarker(ctx, op.Entry.Child, OpaqueMarker); err != nil {
+			return err
+		}
+	}
+
+	fs.created(parent, op.Name, &op.Entry)
+	return nil
+}
+
+func (fs *overlayFS) MkNode(
+	ctx context.Context,
+	op *fuseops.MkNodeOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	fs.treeMu.Lock()
+	defer fs.treeMu.Unlock()
+
+	upperParent, _, err := fs.prepareCreate(ctx, parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	op.Parent = upperParent
+	err = fs.layers[0].MkNode(ctx, op)
+	op.Parent = parent.id
+	if err != nil {
+		return err
+	}
+
+	fs.created(parent, op.Name, &op.Entry)
+	return nil
+}
+
+func (fs *overlayFS) CreateFile(
+	ctx context.Context,
+	op *fuseops.CreateFileOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	fs.treeMu.Lock()
+	defer fs.treeMu.Unlock()
+
+	upperParent, _, err := fs.prepareCreate(ctx, parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	op.Parent = upperParent
+	err = fs.layers[0].CreateFile(ctx, op)
+	op.Parent = parent.id
+	if err != nil {
+		return err
+	}
+
+	h := overlayHandle{layer: 0, inode: op.Entry.Child, handle: op.Handle}
+	fs.created(parent, op.Name, &op.Entry)
+	op.Handle = fs.addFile(h)
+	return nil
+}
+
+func (fs *overlayFS) CreateSymlink(
+	ctx context.Context,
+	op *fuseops.CreateSymlinkOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	fs.treeMu.Lock()
+	defer fs.treeMu.Unlock()
+
+	upperParent, _, err := fs.prepareCreate(ctx, parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	op.Parent = upperParent
+	err = fs.layers[0].CreateSymlink(ctx, op)
+	op.Parent = parent.id
+	if err != nil {
+		return err
+	}
+
+	fs.created(parent, op.Name, &op.Entry)
+	return nil
+}
+
+func (fs *overlayFS) CreateLink(
+	ctx context.Context,
+	op *fuseops.CreateLinkOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	target, err := fs.inode(op.Target)
+	if err != nil {
+		return err
+	}
+
+	fs.treeMu.Lock()
+	defer fs.treeMu.Unlock()
+
+	upperTarget, err := fs.copyUp(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	upperParent, _, err := fs.prepareCreate(ctx, parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	// The link is an inode of its own in the overlay, which stands for the
+	// same inode in the upper layer as the target.
+	op.Parent, op.Target = upperParent, upperTarget
+	err = fs.layers[0].CreateLink(ctx, op)
+	op.Parent, op.Target = parent.id, target.id
+	if err != nil {
+		return err
+	}
+
+	fs.created(parent, op.Name, &op.Entry)
+	return nil
+}
+
+func (fs *overlayFS) Rename(
+	ctx context.Context,
+	op *fuseops.RenameOp) error {
+	if op.Flags != 0 {
+		return fuse.EINVAL
+	}
+
+	oldParent, err := fs.inode(op.OldParent)
+	if err != nil {
+		return err
+	}
+
+	newParent, err := fs.inode(op.NewParent)
+	if err != nil {
+		return err
+	}
+
+	fs.treeMu.Lock()
+	defer fs.treeMu.Unlock()
+
+	src, srcAttrs, err := fs.child(ctx, oldParent, op.OldName)
+	if err != nil {
+		return err
+	}
+
+	srcRefs := fs.refs(src)
+	srcInLower := srcRefs[len(srcRefs)-1].layer > 0
+	if src.dir && srcInLower {
+		return syscall.EXDEV
+	}
+
+	// Whatever is at the new name is replaced, which for a directory requires
+	// it to be empty.
+	dst, dstAttrs, err := fs.child(ctx, newParent, op.NewName)
+	var dstRefs []overlayRef
+	switch {
+	case err == nil:
+		if dst == src {
+			return nil
+		}
+		dstRefs = fs.refs(dst)
+		if dstAttrs.Mode.IsDir() {
+			if !srcAttrs.Mode.IsDir() {
+				return syscall.EISDIR
+			}
+			entries, err := fs.mergeDir(ctx, dstRefs)
+			if err != nil {
+				return err
+			}
+			if len(entries) > 0 {
+				return fuse.ENOTEMPTY
+			}
+		} else if srcAttrs.Mode.IsDir() {
+			return fuse.ENOTDIR
+		}
+
+	case !errors.Is(err, fuse.ENOENT):
+		return err
+	}
+
+	if _, err := fs.copyUp(ctx, src); err != nil {
+		return err
+	}
+	oldUpperParent, err := fs.copyUp(ctx, oldParent)
+	if err != nil {
+		return err
+	}
+	newUpperParent, err := fs.copyUp(ctx, newParent)
+	if err != nil {
+		return err
+	}
+
+	upper := fs.layers[0]
+	if dst != nil && dstRefs[0].layer == 0 && dst.dir {
+		markers, err := fs.upperMarkers(ctx, dstRefs[0])
+		if err != nil {
+			return err
+		}
+		for _, m := range markers {
+			if err := upper.Unlink(ctx, &fuseops.UnlinkOp{Parent: dstRefs[0].inode, Name: m}); err != nil {
+				return err
+			}
+		}
+	}
+
+	newDir := overlayRef{layer: 0, inode: newUpperParent}
+	if whiteout, err := fs.existsIn(ctx, newDir, WhiteoutPrefix+op.NewName); err != nil {
+		return err
+	} else if whiteout {
+		if err := upper.Unlink(ctx, &fuseops.UnlinkOp{Parent: newUpperParent, Name: WhiteoutPrefix + op.NewName}); err != nil {
+			return err
+		}
+	}
+
+	err = upper.Rename(ctx, &fuseops.RenameOp{
+		OldParent: oldUpperParent,
+		OldName:   op.OldName,
+		NewParent: newUpperParent,
+		NewName:   op.NewName,
+		OpContext: op.OpContext,
+	})
+	if err != nil {
+		return err
+	}
+
+	// A directory replacing one in a lower layer mustn't show its contents.
+	if dst != nil && dst.dir && dstRefs[len(dstRefs)-1].layer > 0 {
+		if err := fs.createMarker(ctx, fs.top(src).inode, OpaqueMarker); err != nil {
+			return err
+		}
+	}
+
+	if srcInLower {
+		if err := fs.createMarker(ctx, oldUpperParent, WhiteoutPrefix+op.OldName); err != nil {
+			return err
+		}
+	}
+
+	fs.mu.Lock()
+	var forget []overlayRef
+	if dst != nil {
+		forget = fs.detach(dst)
+	}
+	delete(oldParent.children, op.OldName)
+	src.parent, src.name = newParent, op.NewName
+	newParent.children[op.NewName] = src
+	forget = append(forget, fs.release(oldParent)...)
+	fs.mu.Unlock()
+
+	fs.forgetRefs(ctx, forget)
+	return nil
+}
+
+func (fs *overlayFS) RmDir(
+	ctx context.Context,
+	op *fuseops.RmDirOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	fs.treeMu.Lock()
+	defer fs.treeMu.Unlock()
+
+	return fs.remove(ctx, parent, op.Name, true)
+}
+
+func (fs *overlayFS) Unlink(
+	ctx context.Context,
+	op *fuseops.UnlinkOp) error {
+	parent, err := fs.inode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	fs.treeMu.Lock()
+	defer fs.treeMu.Unlock()
+
+	return fs.remove(ctx, parent, op.Name, false)
+}
+
+func (fs *overlayFS) OpenDir(
+	ctx context.Context,
+	op *fuseops.OpenDirOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	fs.treeMu.RLock()
+	entries, err := fs.mergeDir(ctx, fs.refs(in))
+	fs.treeMu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for i := range entries {
+		e := &entries[i]
+		e.Offset = fuseops.DirOffset(i + 1)
+		if child, ok := in.children[e.Name]; ok {
+			e.Inode = child.id
+		} else {
+			e.Inode = overlayDirentInode(in.id, e.Name)
+		}
+	}
+
+	op.Handle = fs.nextHandle
+	fs.nextHandle++
+	fs.dirs[op.Handle] = entries
+	return nil
+}
+
+func (fs *overlayFS) ReadDir(
+	ctx context.Context,
+	op *fuseops.ReadDirOp) error {
+	fs.mu.Lock()
+	entries, ok := fs.dirs[op.Handle]
+	fs.mu.Unlock()
+	if !ok {
+		return fuse.EINVAL
+	}
+
+	for i := int(op.Offset); i < len(entries); i++ {
+		n := WriteDirent(op.Dst[op.BytesRead:], entries[i])
+		if n == 0 {
+			break
+		}
+		op.BytesRead += n
+	}
+
+	return nil
+}
+
+func (fs *overlayFS) ReleaseDirHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseDirHandleOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	delete(fs.dirs, op.Handle)
+	return nil
+}
+
+func (fs *overlayFS) OpenFile(
+	ctx context.Context,
+	op *fuseops.OpenFileOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	// Files are copied up before they're opened for writing.
+	if !op.OpenFlags.IsReadOnly() || op.OpenFlags&fusekernel.OpenTruncate != 0 {
+		fs.treeMu.Lock()
+		_, err := fs.copyUp(ctx, in)
+		fs.treeMu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	top := fs.top(in)
+	op.Inode = top.inode
+	err = fs.layers[top.layer].OpenFile(ctx, op)
+	op.Inode = in.id
+	if err != nil {
+		return err
+	}
+
+	op.Handle = fs.addFile(overlayHandle{layer: top.layer, inode: top.inode, handle: op.Handle})
+	return nil
+}
+
+func (fs *overlayFS) ReadFile(
+	ctx context.Context,
+	op *fuseops.ReadFileOp) error {
+	h, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	inode, handle := op.Inode, op.Handle
+	op.Inode, op.Handle = h.inode, h.handle
+	defer func() { op.Inode, op.Handle = inode, handle }()
+	return fs.layers[h.layer].ReadFile(ctx, op)
+}
+
+func (fs *overlayFS) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	h, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	inode, handle := op.Inode, op.Handle
+	op.Inode, op.Handle = h.inode, h.handle
+	defer func() { op.Inode, op.Handle = inode, handle }()
+	return fs.layers[h.layer].WriteFile(ctx, op)
+}
+
+func (fs *overlayFS) SyncFile(
+	ctx context.Context,
+	op *fuseops.SyncFileOp) error {
+	h, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	inode, handle := op.Inode, op.Handle
+	op.Inode, op.Handle = h.inode, h.handle
+	defer func() { op.Inode, op.Handle = inode, handle }()
+	return fs.layers[h.layer].SyncFile(ctx, op)
+}
+
+func (fs *overlayFS) FlushFile(
+	ctx context.Context,
+	op *fuseops.FlushFileOp) error {
+	h, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	inode, handle := op.Inode, op.Handle
+	op.Inode, op.Handle = h.inode, h.handle
+	defer func() { op.Inode, op.Handle = inode, handle }()
+	return fs.layers[h.layer].FlushFile(ctx, op)
+}
+
+func (fs *overlayFS) ReleaseFileHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseFileHandleOp) error {
+	fs.mu.Lock()
+	h, ok := fs.files[op.Handle]
+	delete(fs.files, op.Handle)
+	fs.mu.Unlock()
+
+	if !ok {
+		return fuse.EINVAL
+	}
+
+	handle := op.Handle
+	op.Handle = h.handle
+	defer func() { op.Handle = handle }()
+	return fs.layers[h.layer].ReleaseFileHandle(ctx, op)
+}
+
+func (fs *overlayFS) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) error {
+	h, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	inode, handle := op.Inode, op.Handle
+	op.Inode, op.Handle = h.inode, h.handle
+	defer func() { op.Inode, op.Handle = inode, handle }()
+	return fs.layers[h.layer].Fallocate(ctx, op)
+}
+
+func (fs *overlayFS) SeekFile(
+	ctx context.Context,
+	op *fuseops.SeekFileOp) error {
+	h, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	inode, handle := op.Inode, op.Handle
+	op.Inode, op.Handle = h.inode, h.handle
+	defer func() { op.Inode, op.Handle = inode, handle }()
+	return fs.layers[h.layer].SeekFile(ctx, op)
+}
+
+func (fs *overlayFS) Flock(
+	ctx context.Context,
+	op *fuseops.FlockOp) error {
+	h, err := fs.file(op.Handle)
+	if err != nil {
+		return err
+	}
+
+	inode, handle := op.Inode, op.Handle
+	op.Inode, op.Handle = h.inode, h.handle
+	defer func() { op.Inode, op.Handle = inode, handle }()
+	return fs.layers[h.layer].Flock(ctx, op)
+}
+
+func (fs *overlayFS) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	src, err := fs.file(op.SrcHandle)
+	if err != nil {
+		return err
+	}
+
+	dst, err := fs.file(op.DstHandle)
+	if err != nil {
+		return err
+	}
+
+	// The kernel falls back to copying through the page cache.
+	if src.layer != dst.layer {
+		return fuse.ENOSYS
+	}
+
+	saved := *op
+	op.SrcInode, op.SrcHandle = src.inode, src.handle
+	op.DstInode, op.DstHandle = dst.inode, dst.handle
+	err = fs.layers[src.layer].CopyFileRange(ctx, op)
+	op.SrcInode, op.SrcHandle = saved.SrcInode, saved.SrcHandle
+	op.DstInode, op.DstHandle = saved.DstInode, saved.DstHandle
+	return err
+}
+
+func (fs *overlayFS) ReadSymlink(
+	ctx context.Context,
+	op *fuseops.ReadSymlinkOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	top := fs.top(in)
+	op.Inode = top.inode
+	defer func() { op.Inode = in.id }()
+	return fs.layers[top.layer].ReadSymlink(ctx, op)
+}
+
+func (fs *overlayFS) GetXattr(
+	ctx context.Context,
+	op *fuseops.GetXattrOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	top := fs.top(in)
+	op.Inode = top.inode
+	defer func() { op.Inode = in.id }()
+	return fs.layers[top.layer].GetXattr(ctx, op)
+}
+
+func (fs *overlayFS) ListXattr(
+	ctx context.Context,
+	op *fuseops.ListXattrOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	top := fs.top(in)
+	op.Inode = top.inode
+	defer func() { op.Inode = in.id }()
+	return fs.layers[top.layer].ListXattr(ctx, op)
+}
+
+func (fs *overlayFS) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	fs.treeMu.Lock()
+	upperInode, err := fs.copyUp(ctx, in)
+	fs.treeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	op.Inode = upperInode
+	defer func() { op.Inode = in.id }()
+	return fs.layers[0].SetXattr(ctx, op)
+}
+
+func (fs *overlayFS) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	fs.treeMu.Lock()
+	upperInode, err := fs.copyUp(ctx, in)
+	fs.treeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	op.Inode = upperInode
+	defer func() { op.Inode = in.id }()
+	return fs.layers[0].RemoveXattr(ctx, op)
+}
+
+func (fs *overlayFS) Access(
+	ctx context.Context,
+	op *fuseops.AccessOp) error {
+	in, err := fs.inode(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	top := fs.top(in)
+	op.Inode = top.inode
+	defer func() { op.Inode = in.id }()
+	return fs.layers[top.layer].Access(ctx, op)
+}
+
+func (fs *overlayFS) SyncFS(
+	ctx context.Context,
+	op *fuseops.SyncFSOp) error {
+	inode := op.Inode
+	op.Inode = fuseops.RootInodeID
+	defer func() { op.Inode = inode }()
+	return fs.layers[0].SyncFS(ctx, op)
+}
+
+func (fs *overlayFS) Destroy() {
+	for _, l := range fs.layers {
+		l.Destroy()
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+func TestOverlayFileSystem(t *testing.T) {
+	upperDir, lowerDir := t.TempDir(), t.TempDir()
+	os.Mkdir(lowerDir+"/sub", 0755)
+	for name, contents := range map[string]string{"file": "taco", "gone": "", "sub/lower": ""} {
+		if err := os.WriteFile(lowerDir+"/"+name, []byte(contents), 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	os.Mkdir(upperDir+"/sub", 0755)
+	if err := os.WriteFile(upperDir+"/sub/upper", nil, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	upper, err := fuseutil.NewLoopbackFileSystem(upperDir)
+	if err != nil {
+		t.Fatalf("NewLoopbackFileSystem: %v", err)
+	}
+	lower, err := fuseutil.NewLoopbackFileSystem(lowerDir)
+	if err != nil {
+		t.Fatalf("NewLoopbackFileSystem: %v", err)
+	}
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fuseutil.NewOverlayFileSystem(upper, lower)), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	list := func(dir fuseops.InodeID) []string {
+		openDir := &fuseops.OpenDirOp{Inode: dir}
+		if err := k.Do(ctx, openDir); err != nil {
+			t.Fatalf("OpenDir: %v", err)
+		}
+		defer k.Do(ctx, &fuseops.ReleaseDirHandleOp{Handle: openDir.Handle})
+
+		readDir := &fuseops.ReadDirOp{Inode: dir, Handle: openDir.Handle, Dst: make([]byte, 4096)}
+		if err := k.Do(ctx, readDir); err != nil {
+			t.Fatalf("ReadDir: %v", err)
+		}
+		var names []string
+		for buf := readDir.Dst[:readDir.BytesRead]; len(buf) > 0; {
+			d, n := fuseutil.ReadDirent(buf)
+			names = append(names, d.Name)
+			buf = buf[n:]
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	// Directories in both layers are merged.
+	sub := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "sub"}
+	if err := k.Do(ctx, sub); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+	if got, want := list(sub.Entry.Child), []string{"lower", "upper"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %q, want %q", got, want)
+	}
+
+	// Files in the lower layer are read from there, and copied up when
+	// they're written.
+	lookUp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "file"}
+	if err := k.Do(ctx, lookUp); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+	open := &fuseops.OpenFileOp{Inode: lookUp.Entry.Child, OpenFlags: fusekernel.OpenReadOnly}
+	if err := k.Do(ctx, open); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	read := &fuseops.ReadFileOp{Inode: lookUp.Entry.Child, Handle: open.Handle, Size: 100}
+	if err := k.Do(ctx, read); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got := string(read.Dst[:read.BytesRead]); got != "taco" {
+		t.Errorf("read %q", got)
+	}
+
+	openRW := &fuseops.OpenFileOp{Inode: lookUp.Entry.Child, OpenFlags: fusekernel.OpenReadWrite}
+	if err := k.Do(ctx, openRW); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	write := &fuseops.WriteFileOp{Inode: lookUp.Entry.Child, Handle: openRW.Handle, Offset: 4, Data: []byte("s")}
+	if err := k.Do(ctx, write); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if b, err := os.ReadFile(upperDir + "/file"); err != nil || string(b) != "tacos" {
+		t.Errorf("upper ReadFile: %q, %v", b, err)
+	}
+	if b, err := os.ReadFile(lowerDir + "/file"); err != nil || string(b) != "taco" {
+		t.Errorf("lower ReadFile: %q, %v", b, err)
+	}
+	getAttr := &fuseops.GetInodeAttributesOp{Inode: lookUp.Entry.Child}
+	if err := k.Do(ctx, getAttr); err != nil {
+		t.Fatalf("GetInodeAttributes: %v", err)
+	}
+	if getAttr.Attributes.Size != 5 {
+		t.Errorf("unexpected attributes %+v", getAttr.Attributes)
+	}
+
+	// Removing a file from the lower layer leaves a whiteout in the upper one,
+	// which is itself hidden.
+	if err := k.Do(ctx, &fuseops.UnlinkOp{Parent: fuseops.RootInodeID, Name: "gone"}); err != nil {
+		t.Fatalf("Unlink: %v", err)
+	}
+	if _, err := os.Lstat(upperDir + "/" + fuseutil.WhiteoutPrefix + "gone"); err != nil {
+		t.Errorf("Lstat of whiteout: %v", err)
+	}
+	if _, err := os.Lstat(lowerDir + "/gone"); err != nil {
+		t.Errorf("Lstat in lower layer: %v", err)
+	}
+	missing := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "gone"}
+	if err := k.Do(ctx, missing); err != syscall.ENOENT {
+		t.Errorf("LookUpInode of removed file: %v", err)
+	}
+	if got, want := list(fuseops.RootInodeID), []string{"file", "sub"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %q, want %q", got, want)
+	}
+
+	// Creating it again removes the whiteout.
+	create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "gone", Mode: 0644}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	if _, err := os.Lstat(upperDir + "/" + fuseutil.WhiteoutPrefix + "gone"); !os.IsNotExist(err) {
+		t.Errorf("Lstat of whiteout after create: %v", err)
+	}
+	if got, want := list(fuseops.RootInodeID), []string{"file", "gone", "sub"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %q, want %q", got, want)
+	}
+}
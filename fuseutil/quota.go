@@ -0,0 +1,725 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// QuotaScope says what quotas apply to.
+type QuotaScope int
+
+const (
+	// Quotas apply to the files owned by each UID, keyed by the UID in
+	// decimal.
+	QuotaPerUID QuotaScope = iota
+
+	// Quotas apply to the subtrees of the directories in the root directory,
+	// keyed by their names. Files in the root directory itself have the empty
+	// key.
+	QuotaPerSubtree
+)
+
+// QuotaUsage is what the files that a quota applies to use: the total of
+// their sizes in bytes, and their number.
+type QuotaUsage struct {
+	Bytes  int64
+	Inodes int64
+}
+
+// QuotaLimits are the most that the files that a quota applies to may use.
+// Zero means no limit.
+type QuotaLimits struct {
+	Bytes  int64
+	Inodes int64
+}
+
+// A QuotaStore persists the usage that quotas track, so that it survives
+// remounting.
+type QuotaStore interface {
+	// Return the usage recorded for the key, or zero if none has been.
+	LoadQuotaUsage(key string) (QuotaUsage, error)
+
+	// Record the usage for the key. This is called as ops change it, while
+	// ops that may change it are blocked, so slow stores should save
+	// asynchronously.
+	SaveQuotaUsage(key string, usage QuotaUsage)
+}
+
+// QuotaConfig configures NewQuotaFileSystem.
+type QuotaConfig struct {
+	Scope QuotaScope
+
+	// The limits for a key. If nil, usage is tracked but not limited.
+	Limits func(key string) QuotaLimits
+
+	// Where to keep usage. If nil, it's kept in memory, starting at zero.
+	Store QuotaStore
+}
+
+// A QuotaFileSystem is a FileSystem that enforces quotas, as returned by
+// NewQuotaFileSystem.
+type QuotaFileSystem interface {
+	FileSystem
+
+	// Return the usage for a key.
+	Usage(key string) (QuotaUsage, error)
+}
+
+// NewQuotaFileSystem returns a FileSystem that tracks the bytes and inodes
+// used by the files in the wrapped one, per UID or per subtree as configured,
+// and fails writes and creates that would take usage over its limits with
+// EDQUOT.
+//
+// Only changes made through the returned file system are tracked, on top of
+// the usage from the store. Hard links count once, and only files whose last
+// link is removed give back their bytes and inode. In QuotaPerSubtree scope,
+// renames that would move files between subtrees, or rename the directories
+// in the root directory, fail with EXDEV, as they do across XFS project
+// quotas, so that tools like mv(1) fall back to copying.
+func NewQuotaFileSystem(fs FileSystem, cfg QuotaConfig) QuotaFileSystem {
+	return &quotaFS{
+		FileSystem: fs,
+		cfg:        cfg,
+		usage:      make(map[string]*QuotaUsage),
+		inodes: map[fuseops.InodeID]*quotaInode{
+			fuseops.RootInodeID: {lookups: 1},
+		},
+	}
+}
+
+// What a quotaFS knows about an inode, from the attributes and entries
+// returned by the wrapped file system.
+type quotaInode struct {
+	uid     uint32
+	subtree string
+	size    int64
+	lookups uint64
+}
+
+type quotaFS struct {
+	FileSystem
+	cfg QuotaConfig
+
+	mu sync.Mutex
+
+	// The usage of the keys used so far, as loaded from the store.
+	//
+	// GUARDED_BY(mu)
+	usage map[string]*QuotaUsage
+
+	// The inodes that the kernel knows of.
+	//
+	// GUARDED_BY(mu)
+	inodes map[fuseops.InodeID]*quotaInode
+}
+
+func (fs *quotaFS) Usage(key string) (QuotaUsage, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	u, err := fs.loadUsage(key)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+
+	return *u, nil
+}
+
+// LOCKS_REQUIRED(fs.mu)
+func (fs *quotaFS) loadUsage(key string) (*QuotaUsage, error) {
+	if u, ok := fs.usage[key]; ok {
+		return u, nil
+	}
+
+	var u QuotaUsage
+	if fs.cfg.Store != nil {
+		var err error
+		if u, err = fs.cfg.Store.LoadQuotaUsage(key); err != nil {
+			return nil, err
+		}
+	}
+
+	fs.usage[key] = &u
+	return &u, nil
+}
+
+// Add to the usage for the key, failing with EDQUOT if that would take it
+// over the limits. Giving usage back never fails.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *quotaFS) charge(key string, bytes, inodes int64) error {
+	if bytes == 0 && inodes == 0 {
+		return nil
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	u, err := fs.loadUsage(key)
+	if err != nil {
+		return err
+	}
+
+	if fs.cfg.Limits != nil {
+		limits := fs.cfg.Limits(key)
+		if bytes > 0 && limits.Bytes > 0 && u.Bytes+bytes > limits.Bytes {
+			return syscall.EDQUOT
+		}
+		if inodes > 0 && limits.Inodes > 0 && u.Inodes+inodes > limits.Inodes {
+			return syscall.EDQUOT
+		}
+	}
+
+	u.Bytes += bytes
+	u.Inodes += inodes
+	if fs.cfg.Store != nil {
+		fs.cfg.Store.SaveQuotaUsage(key, *u)
+	}
+
+	return nil
+}
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *quotaFS) refund(key string, bytes, inodes int64) {
+	fs.charge(key, -bytes, -inodes)
+}
+
+// LOCKS_REQUIRED(fs.mu)
+func (fs *quotaFS) keyOf(in *quotaInode) string {
+	if fs.cfg.Scope == QuotaPerSubtree {
+		return in.subtree
+	}
+
+	return strconv.FormatUint(uint64(in.uid), 10)
+}
+
+// Return what is known of an inode, asking the wrapped file system if need be.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *quotaFS) inode(
+	ctx context.Context,
+	id fuseops.InodeID) (quotaInode, string, error) {
+	fs.mu.Lock()
+	in, ok := fs.inodes[id]
+	if ok {
+		defer fs.mu.Unlock()
+		return *in, fs.keyOf(in), nil
+	}
+	fs.mu.Unlock()
+
+	// The kernel knows of inodes that it learned of before the file system
+	// was wrapped, e.g. when the file system is replaced while mounted.
+	op := &fuseops.GetInodeAttributesOp{Inode: id}
+	if err := fs.FileSystem.GetInodeAttributes(ctx, op); err != nil {
+		return quotaInode{}, "", err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	in = &quotaInode{uid: op.Attributes.Uid, size: int64(op.Attributes.Size)}
+	return *in, fs.keyOf(in), nil
+}
+
+// Take note of an inode in an entry returned to the kernel.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *quotaFS) learnEntry(parent fuseops.InodeID, name string, e fuseops.ChildInodeEntry) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	in, ok := fs.inodes[e.Child]
+	if !ok {
+		in = &quotaInode{}
+		if parent == fuseops.RootInodeID {
+			if e.Attributes.Mode.IsDir() {
+				in.subtree = name
+			}
+		} else if p, ok := fs.inodes[parent]; ok {
+			in.subtree = p.subtree
+		}
+		fs.inodes[e.Child] = in
+	}
+
+	in.uid = e.Attributes.Uid
+	in.size = int64(e.Attributes.Size)
+	in.lookups++
+}
+
+// Take note of the attributes of an inode.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *quotaFS) learnAttributes(id fuseops.InodeID, attrs fuseops.InodeAttributes) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if in, ok := fs.inodes[id]; ok {
+		in.uid = attrs.Uid
+		in.size = int64(attrs.Size)
+	}
+}
+
+// Charge for the growth of a file to the given size, returning the amount
+// charged.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *quotaFS) chargeGrowth(
+	ctx context.Context,
+	id fuseops.InodeID,
+	end int64) (string, int64, error) {
+	in, key, err := fs.inode(ctx, id)
+	if err != nil {
+		return "", 0, err
+	}
+
+	growth := max(0, end-in.size)
+	return key, growth, fs.charge(key, growth, 0)
+}
+
+// Settle the charge for the growth of a file once it's done, giving back
+// what turned out not to be needed.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *quotaFS) settleGrowth(id fuseops.InodeID, key string, charged, end int64, opErr error) {
+	fs.mu.Lock()
+	var used int64
+	if in, ok := fs.inodes[id]; ok && opErr == nil {
+		used = max(0, end-in.size)
+		in.size = max(in.size, end)
+	} else if opErr == nil {
+		used = charged
+	}
+	fs.mu.Unlock()
+
+	fs.refund(key, charged-used, 0)
+}
+
+// Charge for a new inode to be created in the directory.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *quotaFS) chargeCreate(
+	ctx context.Context,
+	parent fuseops.InodeID,
+	name string,
+	dir bool,
+	caller fuseops.OpContext) (string, error) {
+	var key string
+	switch {
+	case fs.cfg.Scope == QuotaPerUID:
+		key = strconv.FormatUint(uint64(caller.Uid), 10)
+
+	case parent == fuseops.RootInodeID && dir:
+		key = name
+
+	default:
+		_, k, err := fs.inode(ctx, parent)
+		if err != nil {
+			return "", err
+		}
+		key = k
+	}
+
+	return key, fs.charge(key, 0, 1)
+}
+
+// Settle the charge for a new inode, moving it to the owner that the wrapped
+// file system gave the inode if need be.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *quotaFS) settleCreate(
+	parent fuseops.InodeID,
+	name string,
+	key string,
+	e *fuseops.ChildInodeEntry,
+	opErr error) {
+	if opErr != nil {
+		fs.refund(key, 0, 1)
+		return
+	}
+
+	fs.learnEntry(parent, name, *e)
+	if fs.cfg.Scope == QuotaPerUID {
+		if owner := strconv.FormatUint(uint64(e.Attributes.Uid), 10); owner != key {
+			fs.refund(key, 0, 1)
+			fs.charge(owner, 0, 1)
+		}
+	}
+}
+
+// What removing a file would give back, and to which quota.
+type quotaRemoval struct {
+	key    string
+	dir    bool
+	bytes  int64
+	inodes int64
+}
+
+// Look up the named child of the directory, returning what removing it would
+// give back, if it exists.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *quotaFS) removal(
+	ctx context.Context,
+	parent fuseops.InodeID,
+	name string) (quotaRemoval, error) {
+	op := &fuseops.LookUpInodeOp{Parent: parent, Name: name}
+	if err := fs.FileSystem.LookUpInode(ctx, op); err != nil {
+		return quotaRemoval{}, err
+	}
+	fs.FileSystem.ForgetInode(ctx, &fuseops.ForgetInodeOp{Inode: op.Entry.Child, N: 1})
+
+	attrs := op.Entry.Attributes
+	r := quotaRemoval{dir: attrs.Mode.IsDir()}
+	switch {
+	case r.dir:
+		r.inodes = 1
+	case attrs.Nlink <= 1:
+		r.bytes, r.inodes = int64(attrs.Size), 1
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	in, ok := fs.inodes[op.Entry.Child]
+	if !ok {
+		in = &quotaInode{uid: attrs.Uid}
+		if parent == fuseops.RootInodeID {
+			if r.dir {
+				in.subtree = name
+			}
+		} else if p, ok := fs.inodes[parent]; ok {
+			in.subtree = p.subtree
+		}
+	}
+	r.key = fs.keyOf(in)
+
+	return r, nil
+}
+
+////////////////////////////////////////////////////////////////////////
+// FileSystem methods
+////////////////////////////////////////////////////////////////////////
+
+func (fs *quotaFS) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	if err := fs.FileSystem.LookUpInode(ctx, op); err != nil {
+		return err
+	}
+
+	fs.learnEntry(op.Parent, op.Name, op.Entry)
+	return nil
+}
+
+func (fs *quotaFS) GetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.GetInodeAttributesOp) error {
+	if err := fs.FileSystem.GetInodeAttributes(ctx, op); err != nil {
+		return err
+	}
+
+	fs.learnAttributes(op.Inode, op.Attributes)
+	return nil
+}
+
+func (fs *quotaFS) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	in, key, err := fs.inode(ctx, op.Inode)
+	if err != nil {
+		return err
+	}
+
+	// A change of owner moves the file to another quota.
+	newKey := key
+	if fs.cfg.Scope == QuotaPerUID && op.Uid != nil {
+		newKey = strconv.FormatUint(uint64(*op.Uid), 10)
+	}
+
+	size := in.size
+	if op.Size != nil {
+		size = int64(*op.Size)
+	}
+
+	var bytes, inodes int64 = size - in.size, 0
+	if newKey != key {
+		bytes, inodes = size, 1
+	}
+	if err := fs.charge(newKey, max(bytes, 0), inodes); err != nil {
+		return err
+	}
+
+	err = fs.FileSystem.SetInodeAttributes(ctx, op)
+	if err != nil {
+		fs.refund(newKey, max(bytes, 0), inodes)
+		return err
+	}
+
+	if newKey != key {
+		fs.refund(key, in.size, 1)
+	} else if bytes < 0 {
+		fs.refund(key, -bytes, 0)
+	}
+
+	fs.learnAttributes(op.Inode, op.Attributes)
+	return nil
+}
+
+func (fs *quotaFS) ForgetInode(
+	ctx context.Context,
+	op *fuseops.ForgetInodeOp) error {
+	fs.forget(op.Inode, op.N)
+	return fs.FileSystem.ForgetInode(ctx, op)
+}
+
+func (fs *quotaFS) BatchForget(
+	ctx context.Context,
+	op *fuseops.BatchForgetOp) error {
+	for _, e := range op.Entries {
+		fs.forget(e.Inode, e.N)
+	}
+	return fs.FileSystem.BatchForget(ctx, op)
+}
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *quotaFS) forget(id fuseops.InodeID, n uint64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	in, ok := fs.inodes[id]
+	if !ok || id == fuseops.RootInodeID {
+		return
+	}
+
+	in.lookups -= min(n, in.lookups)
+	if in.lookups == 0 {
+		delete(fs.inodes, id)
+	}
+}
+
+func (fs *quotaFS) MkDir(
+	ctx context.Context,
+	op *fuseops.MkDirOp) error {
+	key, err := fs.chargeCreate(ctx, op.Parent, op.Name, true, op.OpContext)
+	if err != nil {
+		return err
+	}
+
+	err = fs.FileSystem.MkDir(ctx, op)
+	fs.settleCreate(op.Parent, op.Name, key, &op.Entry, err)
+	return err
+}
+
+func (fs *quotaFS) MkNode(
+	ctx context.Context,
+	op *fuseops.MkNodeOp) error {
+	key, err := fs.chargeCreate(ctx, op.Parent, op.Name, op.Mode.IsDir(), op.OpContext)
+	if err != nil {
+		return err
+	}
+
+	err = fs.FileSystem.MkNode(ctx, op)
+	fs.settleCreate(op.Parent, op.Name, key, &op.Entry, err)
+	return err
+}
+
+func (fs *quotaFS) CreateFile(
+	ctx context.Context,
+	op *fuseops.CreateFileOp) error {
+	key, err := fs.chargeCreate(ctx, op.Parent, op.Name, false, op.OpContext)
+	if err != nil {
+		return err
+	}
+
+	err = fs.FileSystem.CreateFile(ctx, op)
+	fs.settleCreate(op.Parent, op.Name, key, &op.Entry, err)
+	return err
+}
+
+func (fs *quotaFS) CreateTmpFile(
+	ctx context.Context,
+	op *fuseops.CreateTmpFileOp) error {
+	key, err := fs.chargeCreate(ctx, op.Parent, "", false, op.OpContext)
+	if err != nil {
+		return err
+	}
+
+	err = fs.FileSystem.CreateTmpFile(ctx, op)
+	fs.settleCreate(op.Parent, "", key, &op.Entry, err)
+	return err
+}
+
+func (fs *quotaFS) CreateSymlink(
+	ctx context.Context,
+	op *fuseops.CreateSymlinkOp) error {
+	key, err := fs.chargeCreate(ctx, op.Parent, op.Name, false, op.OpContext)
+	if err != nil {
+		return err
+	}
+
+	err = fs.FileSystem.CreateSymlink(ctx, op)
+	fs.settleCreate(op.Parent, op.Name, key, &op.Entry, err)
+	return err
+}
+
+func (fs *quotaFS) CreateLink(
+	ctx context.Context,
+	op *fuseops.CreateLinkOp) error {
+	// A link to a file in another subtree would let it be changed through
+	// either.
+	if fs.cfg.Scope == QuotaPerSubtree {
+		_, parentKey, err := fs.inode(ctx, op.Parent)
+		if err != nil {
+			return err
+		}
+		_, targetKey, err := fs.inode(ctx, op.Target)
+		if err != nil {
+			return err
+		}
+		if parentKey != targetKey {
+			return syscall.EXDEV
+		}
+	}
+
+	if err := fs.FileSystem.CreateLink(ctx, op); err != nil {
+		return err
+	}
+
+	fs.learnEntry(op.Parent, op.Name, op.Entry)
+	return nil
+}
+
+func (fs *quotaFS) Rename(
+	ctx context.Context,
+	op *fuseops.RenameOp) error {
+	if fs.cfg.Scope == QuotaPerSubtree {
+		src, err := fs.removal(ctx, op.OldParent, op.OldName)
+		if err != nil {
+			return err
+		}
+
+		// Renaming a directory in the root directory renames its subtree.
+		if src.dir && (op.OldParent == fuseops.RootInodeID || op.NewParent == fuseops.RootInodeID) {
+			return syscall.EXDEV
+		}
+
+		var dstKey string
+		if op.NewParent != fuseops.RootInodeID {
+			if _, dstKey, err = fs.inode(ctx, op.NewParent); err != nil {
+				return err
+			}
+		}
+		if src.key != dstKey {
+			return syscall.EXDEV
+		}
+	}
+
+	// Whatever the new name referred to is removed.
+	dst, err := fs.removal(ctx, op.NewParent, op.NewName)
+	if err != nil && err != syscall.ENOENT {
+		return err
+	}
+
+	if err := fs.FileSystem.Rename(ctx, op); err != nil {
+		return err
+	}
+
+	fs.refund(dst.key, dst.bytes, dst.inodes)
+	return nil
+}
+
+func (fs *quotaFS) RmDir(
+	ctx context.Context,
+	op *fuseops.RmDirOp) error {
+	r, err := fs.removal(ctx, op.Parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := fs.FileSystem.RmDir(ctx, op); err != nil {
+		return err
+	}
+
+	fs.refund(r.key, r.bytes, r.inodes)
+	return nil
+}
+
+func (fs *quotaFS) Unlink(
+	ctx context.Context,
+	op *fuseops.UnlinkOp) error {
+	r, err := fs.removal(ctx, op.Parent, op.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := fs.FileSystem.Unlink(ctx, op); err != nil {
+		return err
+	}
+
+	fs.refund(r.key, r.bytes, r.inodes)
+	return nil
+}
+
+func (fs *quotaFS) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	end := op.Offset + int64(len(op.Data))
+	key, charged, err := fs.chargeGrowth(ctx, op.Inode, end)
+	if err != nil {
+		return err
+	}
+
+	err = fs.FileSystem.WriteFile(ctx, op)
+	fs.settleGrowth(op.Inode, key, charged, end, err)
+	return err
+}
+
+func (fs *quotaFS) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) error {
+	if op.Mode&(fuseops.FallocateKeepSize|fuseops.FallocatePunchHole|fuseops.FallocateCollapseRange) != 0 {
+		return fs.FileSystem.Fallocate(ctx, op)
+	}
+
+	end := int64(op.Offset + op.Length)
+	key, charged, err := fs.chargeGrowth(ctx, op.Inode, end)
+	if err != nil {
+		return err
+	}
+
+	err = fs.FileSystem.Fallocate(ctx, op)
+	fs.settleGrowth(op.Inode, key, charged, end, err)
+	return err
+}
+
+func (fs *quotaFS) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	end := int64(op.DstOffset + op.Length)
+	key, charged, err := fs.chargeGrowth(ctx, op.DstInode, end)
+	if err != nil {
+		return err
+	}
+
+	err = fs.FileSystem.CopyFileRange(ctx, op)
+	fs.settleGrowth(op.DstInode, key, charged, int64(op.DstOffset+op.BytesCopied), err)
+	return err
+}
@@ -0,0 +1,127 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+// A fuseutil.QuotaStore that keeps usage in a map.
+type mapQuotaStore struct {
+	mu    sync.Mutex
+	usage map[string]fuseutil.QuotaUsage
+}
+
+func (s *mapQuotaStore) LoadQuotaUsage(key string) (fuseutil.QuotaUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage[key], nil
+}
+
+func (s *mapQuotaStore) SaveQuotaUsage(key string, usage fuseutil.QuotaUsage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage[key] = usage
+}
+
+func TestQuotaFileSystem(t *testing.T) {
+	dir := t.TempDir()
+	wrapped, err := fuseutil.NewLoopbackFileSystem(dir)
+	if err != nil {
+		t.Fatalf("NewLoopbackFileSystem: %v", err)
+	}
+
+	store := &mapQuotaStore{usage: map[string]fuseutil.QuotaUsage{"bob": {Bytes: 100, Inodes: 1}}}
+	fs := fuseutil.NewQuotaFileSystem(wrapped, fuseutil.QuotaConfig{
+		Scope: fuseutil.QuotaPerSubtree,
+		Limits: func(key string) fuseutil.QuotaLimits {
+			return fuseutil.QuotaLimits{Bytes: 10, Inodes: 3}
+		},
+		Store: store,
+	})
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	mkdir := &fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "alice", Mode: os.ModeDir | 0755}
+	if err := k.Do(ctx, mkdir); err != nil {
+		t.Fatalf("MkDir: %v", err)
+	}
+	alice := mkdir.Entry.Child
+
+	create := &fuseops.CreateFileOp{Parent: alice, Name: "f", Mode: 0644, OpenFlags: fusekernel.OpenReadWrite}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	// Writes may grow the subtree up to its limit.
+	write := func(offset int64, data string) error {
+		return k.Do(ctx, &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Offset: offset, Data: []byte(data)})
+	}
+	if err := write(0, "tacotaco"); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := write(8, "taco"); err != syscall.EDQUOT {
+		t.Errorf("WriteFile over quota: got %v, want EDQUOT", err)
+	}
+	if err := write(4, "TACO"); err != nil {
+		t.Errorf("WriteFile within the file: %v", err)
+	}
+
+	// So may creates.
+	if err := k.Do(ctx, &fuseops.CreateFileOp{Parent: alice, Name: "g", Mode: 0644}); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	if err := k.Do(ctx, &fuseops.CreateFileOp{Parent: alice, Name: "h", Mode: 0644}); err != syscall.EDQUOT {
+		t.Errorf("CreateFile over quota: got %v, want EDQUOT", err)
+	}
+	if u, err := fs.Usage("alice"); err != nil || u != (fuseutil.QuotaUsage{Bytes: 8, Inodes: 3}) {
+		t.Errorf("Usage: %+v, %v", u, err)
+	}
+
+	// Removing files gives their usage back, which is saved.
+	if err := k.Do(ctx, &fuseops.UnlinkOp{Parent: alice, Name: "f"}); err != nil {
+		t.Fatalf("Unlink: %v", err)
+	}
+	store.mu.Lock()
+	if u := store.usage["alice"]; u != (fuseutil.QuotaUsage{Bytes: 0, Inodes: 2}) {
+		t.Errorf("stored usage %+v", u)
+	}
+	store.mu.Unlock()
+
+	// Files can't move between subtrees.
+	rename := &fuseops.RenameOp{OldParent: alice, OldName: "g", NewParent: fuseops.RootInodeID, NewName: "g"}
+	if err := k.Do(ctx, rename); err != syscall.EXDEV {
+		t.Errorf("Rename out of subtree: got %v, want EXDEV", err)
+	}
+
+	// Usage starts from the store.
+	if u, err := fs.Usage("bob"); err != nil || u != (fuseutil.QuotaUsage{Bytes: 100, Inodes: 1}) {
+		t.Errorf("Usage: %+v, %v", u, err)
+	}
+}
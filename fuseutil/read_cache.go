@@ -0,0 +1,427 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// ReadCacheConfig configures NewReadCacheFileSystem.
+type ReadCacheConfig struct {
+	// The local directory in which to keep cached data. The cache uses a new
+	// directory within it, which it removes on Destroy.
+	Dir string
+
+	// The size of the blocks in which data is read from the wrapped file
+	// system and cached. If zero, 1 MiB is used.
+	BlockSize int64
+
+	// If set, whole files are read and cached at once, in place of blocks. This
+	// suits small files, or wrapped file systems that can only read whole
+	// files.
+	WholeFile bool
+
+	// The most bytes of data to cache. The least recently used blocks are
+	// dropped to stay within it. If zero, 1 GiB is used.
+	MaxBytes int64
+
+	// If set, a CRC-32C checksum is kept for each block, and the data read
+	// from disk is checked against it, so that a cached block that has become
+	// corrupt is read again from the wrapped file system. This costs reading
+	// the whole block for each read from it.
+	Checksum bool
+}
+
+// NewReadCacheFileSystem returns a FileSystem that forwards all ops to the
+// supplied one, but caches the data returned by its ReadFile in local files,
+// and serves reads from them.
+//
+// Cached data for an inode is dropped when it's changed through the cache,
+// by WriteFile, SetInodeAttributes, Fallocate, or CopyFileRange, and when
+// it's opened and the wrapped file system reports a size or modification
+// time different from when it was last opened. So changes made to the
+// wrapped file system by other means are seen by those that open a file
+// after them, like close-to-open consistency in NFS.
+func NewReadCacheFileSystem(wrapped FileSystem, cfg ReadCacheConfig) (FileSystem, error) {
+	if cfg.BlockSize == 0 {
+		cfg.BlockSize = 1 << 20
+	}
+
+	if cfg.WholeFile {
+		cfg.BlockSize = math.MaxInt64
+	}
+
+	if cfg.MaxBytes == 0 {
+		cfg.MaxBytes = 1 << 30
+	}
+
+	dir, err := os.MkdirTemp(cfg.Dir, "read-cache-")
+	if err != nil {
+		return nil, fmt.Errorf("MkdirTemp: %w", err)
+	}
+
+	return &readCacheFS{
+		FileSystem:  wrapped,
+		cfg:         cfg,
+		dir:         dir,
+		blocks:      make(map[readCacheKey]*list.Element),
+		versions:    make(map[fuseops.InodeID]readCacheVersion),
+		generations: make(map[fuseops.InodeID]uint64),
+	}, nil
+}
+
+// The size of the reads made of the wrapped file system to fill a block.
+const readCacheChunkSize = 1 << 20
+
+var readCacheTable = crc32.MakeTable(crc32.Castagnoli)
+
+type readCacheFS struct {
+	FileSystem
+	cfg ReadCacheConfig
+	dir string
+
+	mu sync.Mutex
+
+	// The cached blocks, in a list from most to least recently used, and their
+	// total length.
+	//
+	// INVARIANT: For each k, e in blocks, e.Value.(*cachedBlock).key == k
+	// INVARIANT: lru contains exactly the values of blocks
+	// INVARIANT: bytes is the sum of the lengths of the blocks
+	//
+	// GUARDED_BY(mu)
+	blocks map[readCacheKey]*list.Element
+	lru    list.List
+	bytes  int64
+
+	// The size and modification time of each inode with cached blocks as of
+	// when it was last opened.
+	//
+	// GUARDED_BY(mu)
+	versions map[fuseops.InodeID]readCacheVersion
+
+	// Incremented each time an inode's blocks are dropped, so that blocks read
+	// before then aren't cached.
+	//
+	// GUARDED_BY(mu)
+	generations map[fuseops.InodeID]uint64
+}
+
+type readCacheKey struct {
+	inode fuseops.InodeID
+	index int64
+}
+
+type readCacheVersion struct {
+	size  uint64
+	mtime time.Time
+}
+
+type cachedBlock struct {
+	key    readCacheKey
+	path   string
+	length int64
+	crc    uint32
+}
+
+// Drop the cached blocks of the inode.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *readCacheFS) invalidate(inode fuseops.InodeID) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.generations[inode]++
+	delete(fs.versions, inode)
+	for e := fs.lru.Front(); e != nil; {
+		next := e.Next()
+		if b := e.Value.(*cachedBlock); b.key.inode == inode {
+			fs.remove(e)
+		}
+		e = next
+	}
+}
+
+// Drop a cached block.
+//
+// LOCKS_REQUIRED(fs.mu)
+func (fs *readCacheFS) remove(e *list.Element) {
+	b := fs.lru.Remove(e).(*cachedBlock)
+	delete(fs.blocks, b.key)
+	fs.bytes -= b.length
+	os.Remove(b.path)
+}
+
+// Return an open file holding the data of the block, reading it from the
+// wrapped file system if it isn't cached, and its length. The block is short
+// only if the file ends in it.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *readCacheFS) openBlock(
+	ctx context.Context,
+	op *fuseops.ReadFileOp,
+	key readCacheKey) (*os.File, int64, error) {
+	fs.mu.Lock()
+	e, ok := fs.blocks[key]
+	var b cachedBlock
+	if ok {
+		fs.lru.MoveToFront(e)
+		b = *e.Value.(*cachedBlock)
+	}
+	generation := fs.generations[key.inode]
+	fs.mu.Unlock()
+
+	if ok {
+		f, err := fs.openCached(b)
+		if err == nil {
+			return f, b.length, nil
+		}
+
+		// The block has been dropped since, or is corrupt. Read it again.
+		fs.mu.Lock()
+		if e, ok := fs.blocks[key]; ok && e.Value.(*cachedBlock).path == b.path {
+			fs.remove(e)
+		}
+		fs.mu.Unlock()
+	}
+
+	return fs.fetch(ctx, op, key, generation)
+}
+
+// Open the file holding a cached block, checking its contents if so
+// configured.
+func (fs *readCacheFS) openCached(b cachedBlock) (*os.File, error) {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.cfg.Checksum {
+		h := crc32.New(readCacheTable)
+		n, err := io.Copy(h, f)
+		if err == nil && (n != b.length || h.Sum32() != b.crc) {
+			err = fmt.Errorf("cached block %s is corrupt", b.path)
+		}
+
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// Read a block from the wrapped file system into a new file, and cache it
+// unless the inode's blocks have been dropped since the given generation.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *readCacheFS) fetch(
+	ctx context.Context,
+	op *fuseops.ReadFileOp,
+	key readCacheKey,
+	generation uint64) (*os.File, int64, error) {
+	f, err := os.CreateTemp(fs.dir, "block-")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	length, crc, err := fs.readBlock(ctx, op, key, f)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, ok := fs.blocks[key]; ok || fs.generations[key.inode] != generation {
+		// Someone beat us to it, or the data is out of date. Use it for this
+		// read only.
+		os.Remove(f.Name())
+		return f, length, nil
+	}
+
+	b := &cachedBlock{key: key, path: f.Name(), length: length, crc: crc}
+	fs.blocks[key] = fs.lru.PushFront(b)
+	fs.bytes += length
+
+	for fs.bytes > fs.cfg.MaxBytes {
+		fs.remove(fs.lru.Back())
+	}
+
+	return f, length, nil
+}
+
+// Read a block from the wrapped file system into the file, returning its
+// length and checksum.
+func (fs *readCacheFS) readBlock(
+	ctx context.Context,
+	op *fuseops.ReadFileOp,
+	key readCacheKey,
+	f *os.File) (int64, uint32, error) {
+	h := crc32.New(readCacheTable)
+	w := io.MultiWriter(f, h)
+
+	var length int64
+	buf := make([]byte, min(fs.cfg.BlockSize, readCacheChunkSize))
+	for length < fs.cfg.BlockSize {
+		size := min(fs.cfg.BlockSize-length, int64(len(buf)))
+		read := &fuseops.ReadFileOp{
+			Inode:     key.inode,
+			Handle:    op.Handle,
+			Offset:    key.index*fs.cfg.BlockSize + length,
+			Size:      size,
+			Dst:       buf[:size],
+			OpContext: op.OpContext,
+		}
+
+		if err := fs.FileSystem.ReadFile(ctx, read); err != nil {
+			return 0, 0, err
+		}
+
+		data, err := ReadFileData(read)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return 0, 0, err
+		}
+
+		length += int64(len(data))
+		if int64(len(data)) < size {
+			break
+		}
+	}
+
+	return length, h.Sum32(), nil
+}
+
+////////////////////////////////////////////////////////////////////////
+// FileSystem methods
+////////////////////////////////////////////////////////////////////////
+
+func (fs *readCacheFS) ReadFile(
+	ctx context.Context,
+	op *fuseops.ReadFileOp) error {
+	dst := op.Dst
+	if int64(len(dst)) > op.Size {
+		dst = dst[:op.Size]
+	}
+
+	var n int
+	for n < len(dst) {
+		off := op.Offset + int64(n)
+		key := readCacheKey{inode: op.Inode, index: off / fs.cfg.BlockSize}
+		f, length, err := fs.openBlock(ctx, op, key)
+		if err != nil {
+			return err
+		}
+
+		start := off - key.index*fs.cfg.BlockSize
+		var m int
+		if start < length {
+			m, err = f.ReadAt(dst[n:n+int(min(int64(len(dst)-n), length-start))], start)
+		}
+		f.Close()
+
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		n += m
+		if m == 0 || length < fs.cfg.BlockSize {
+			break
+		}
+	}
+
+	op.BytesRead = n
+	return nil
+}
+
+func (fs *readCacheFS) OpenFile(
+	ctx context.Context,
+	op *fuseops.OpenFileOp) error {
+	if err := fs.FileSystem.OpenFile(ctx, op); err != nil {
+		return err
+	}
+
+	attrs := &fuseops.GetInodeAttributesOp{Inode: op.Inode, OpContext: op.OpContext}
+	if err := fs.FileSystem.GetInodeAttributes(ctx, attrs); err != nil {
+		fs.invalidate(op.Inode)
+		return nil
+	}
+
+	v := readCacheVersion{size: attrs.Attributes.Size, mtime: attrs.Attributes.Mtime}
+
+	fs.mu.Lock()
+	old, ok := fs.versions[op.Inode]
+	fs.mu.Unlock()
+
+	if !ok || old.size != v.size || !old.mtime.Equal(v.mtime) {
+		fs.invalidate(op.Inode)
+
+		fs.mu.Lock()
+		fs.versions[op.Inode] = v
+		fs.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (fs *readCacheFS) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	defer fs.invalidate(op.Inode)
+	return fs.FileSystem.WriteFile(ctx, op)
+}
+
+func (fs *readCacheFS) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	defer fs.invalidate(op.Inode)
+	return fs.FileSystem.SetInodeAttributes(ctx, op)
+}
+
+func (fs *readCacheFS) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) error {
+	defer fs.invalidate(op.Inode)
+	return fs.FileSystem.Fallocate(ctx, op)
+}
+
+func (fs *readCacheFS) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	defer fs.invalidate(op.DstInode)
+	return fs.FileSystem.CopyFileRange(ctx, op)
+}
+
+func (fs *readCacheFS) Destroy() {
+	fs.FileSystem.Destroy()
+	os.RemoveAll(fs.dir)
+}
@@ -0,0 +1,152 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+// A file system with one file, inode 2, that counts the bytes read from it.
+type countingReadFS struct {
+	fuseutil.NotImplementedFileSystem
+
+	mu        sync.Mutex
+	contents  []byte
+	mtime     time.Time
+	bytesRead int
+}
+
+func (fs *countingReadFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAttributesOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	op.Attributes = fuseops.InodeAttributes{Size: uint64(len(fs.contents)), Nlink: 1, Mode: 0644, Mtime: fs.mtime}
+	return nil
+}
+
+func (fs *countingReadFS) OpenFile(ctx context.Context, op *fuseops.OpenFileOp) error {
+	return nil
+}
+
+func (fs *countingReadFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if op.Offset < int64(len(fs.contents)) {
+		op.BytesRead = copy(op.Dst, fs.contents[op.Offset:])
+	}
+	fs.bytesRead += op.BytesRead
+	return nil
+}
+
+func (fs *countingReadFS) set(contents string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.contents = []byte(contents)
+	fs.mtime = fs.mtime.Add(time.Second)
+}
+
+func (fs *countingReadFS) read() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.bytesRead
+}
+
+func TestReadCacheFileSystem(t *testing.T) {
+	backing := &countingReadFS{}
+	backing.set("0123456789abcdef")
+
+	dir := t.TempDir()
+	fs, err := fuseutil.NewReadCacheFileSystem(backing, fuseutil.ReadCacheConfig{Dir: dir, BlockSize: 4, MaxBytes: 12, Checksum: true})
+	if err != nil {
+		t.Fatalf("NewReadCacheFileSystem: %v", err)
+	}
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	read := func(offset, size int64) string {
+		t.Helper()
+		op := &fuseops.ReadFileOp{Inode: 2, Offset: offset, Size: size}
+		if err := k.Do(ctx, op); err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		return string(op.Dst[:op.BytesRead])
+	}
+
+	if err := k.Do(ctx, &fuseops.OpenFileOp{Inode: 2}); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+
+	// A read spanning blocks reads them whole, and a second read of them is
+	// served from the cache.
+	if got := read(2, 8); got != "23456789" {
+		t.Errorf("first read %q", got)
+	}
+	if got := backing.read(); got != 12 {
+		t.Errorf("read %d bytes from the backing file system, want 12", got)
+	}
+	if got := read(0, 12); got != "0123456789ab" {
+		t.Errorf("second read %q", got)
+	}
+	if got := backing.read(); got != 12 {
+		t.Errorf("read %d bytes from the backing file system after a hit, want 12", got)
+	}
+
+	// Reading the last block evicts the least recently used one.
+	if got := read(12, 16); got != "cdef" {
+		t.Errorf("read at the end %q", got)
+	}
+	if got := read(4, 4); got != "4567" || backing.read() != 16 {
+		t.Errorf("recently used block %q, backing reads %d; want 4567, 16", got, backing.read())
+	}
+	if got := read(0, 4); got != "0123" || backing.read() != 20 {
+		t.Errorf("evicted block %q, backing reads %d; want 0123, 20", got, backing.read())
+	}
+
+	// Corrupt blocks are read again.
+	paths, _ := filepath.Glob(filepath.Join(dir, "*", "*"))
+	for _, p := range paths {
+		if err := os.WriteFile(p, []byte("XXXX"), 0600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	if got := read(0, 4); got != "0123" || backing.read() != 24 {
+		t.Errorf("corrupt block %q, backing reads %d; want 0123, 24", got, backing.read())
+	}
+
+	// Changes to the backing file system are seen on the next open.
+	backing.set("ABCDEFGHIJKLMNOP")
+	if got := read(0, 4); got != "0123" {
+		t.Errorf("read before reopening %q", got)
+	}
+	if err := k.Do(ctx, &fuseops.OpenFileOp{Inode: 2}); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if got := read(0, 4); got != "ABCD" {
+		t.Errorf("read after reopening %q", got)
+	}
+}
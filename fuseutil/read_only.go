@@ -0,0 +1,146 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"context"
+	"syscall"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// NewReadOnlyFileSystem returns a FileSystem that passes ops that read the
+// wrapped file system through to it, and fails those that would modify it
+// with EROFS, including opening files for writing and checking for write
+// access. Mounting with fuse.MountConfig.ReadOnly has the kernel reject
+// most of these before they are sent; this wrapper guarantees it.
+func NewReadOnlyFileSystem(fs FileSystem) FileSystem {
+	return &readOnlyFileSystem{FileSystem: fs}
+}
+
+type readOnlyFileSystem struct {
+	FileSystem
+}
+
+func (fs *readOnlyFileSystem) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) MkDir(
+	ctx context.Context,
+	op *fuseops.MkDirOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) MkNode(
+	ctx context.Context,
+	op *fuseops.MkNodeOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) CreateFile(
+	ctx context.Context,
+	op *fuseops.CreateFileOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) CreateTmpFile(
+	ctx context.Context,
+	op *fuseops.CreateTmpFileOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) CreateLink(
+	ctx context.Context,
+	op *fuseops.CreateLinkOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) CreateSymlink(
+	ctx context.Context,
+	op *fuseops.CreateSymlinkOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) Rename(
+	ctx context.Context,
+	op *fuseops.RenameOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) RmDir(
+	ctx context.Context,
+	op *fuseops.RmDirOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) Unlink(
+	ctx context.Context,
+	op *fuseops.UnlinkOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) OpenFile(
+	ctx context.Context,
+	op *fuseops.OpenFileOp) error {
+	if !op.OpenFlags.IsReadOnly() || op.OpenFlags.IsTruncate() {
+		return syscall.EROFS
+	}
+
+	return fs.FileSystem.OpenFile(ctx, op)
+}
+
+func (fs *readOnlyFileSystem) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	return syscall.EROFS
+}
+
+func (fs *readOnlyFileSystem) Access(
+	ctx context.Context,
+	op *fuseops.AccessOp) error {
+	const wOK = 2
+	if op.Mask&wOK != 0 {
+		return syscall.EROFS
+	}
+
+	return fs.FileSystem.Access(ctx, op)
+}
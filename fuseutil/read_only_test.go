@@ -0,0 +1,85 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+func TestReadOnlyFileSystem(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/file", []byte("taco"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	fs, err := fuseutil.NewLoopbackFileSystem(dir)
+	if err != nil {
+		t.Fatalf("NewLoopbackFileSystem: %v", err)
+	}
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fuseutil.NewReadOnlyFileSystem(fs)), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	lookUp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "file"}
+	if err := k.Do(ctx, lookUp); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+
+	// Reads pass through.
+	open := &fuseops.OpenFileOp{Inode: lookUp.Entry.Child, OpenFlags: fusekernel.OpenReadOnly}
+	if err := k.Do(ctx, open); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	read := &fuseops.ReadFileOp{Inode: lookUp.Entry.Child, Handle: open.Handle, Size: 100}
+	if err := k.Do(ctx, read); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got := string(read.Dst[:read.BytesRead]); got != "taco" {
+		t.Errorf("read %q", got)
+	}
+
+	// Writes don't.
+	ops := []any{
+		&fuseops.OpenFileOp{Inode: lookUp.Entry.Child, OpenFlags: fusekernel.OpenReadWrite},
+		&fuseops.OpenFileOp{Inode: lookUp.Entry.Child, OpenFlags: fusekernel.OpenReadOnly | fusekernel.OpenTruncate},
+		&fuseops.WriteFileOp{Inode: lookUp.Entry.Child, Handle: open.Handle, Data: []byte("x")},
+		&fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "new", Mode: 0644},
+		&fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "dir", Mode: os.ModeDir | 0755},
+		&fuseops.UnlinkOp{Parent: fuseops.RootInodeID, Name: "file"},
+		&fuseops.RenameOp{OldParent: fuseops.RootInodeID, OldName: "file", NewParent: fuseops.RootInodeID, NewName: "moved"},
+		&fuseops.SetXattrOp{Inode: lookUp.Entry.Child, Name: "user.taco", Value: []byte("x")},
+	}
+	for _, op := range ops {
+		if err := k.Do(ctx, op); err != syscall.EROFS {
+			t.Errorf("%T: got %v, want EROFS", op, err)
+		}
+	}
+
+	if b, err := os.ReadFile(dir + "/file"); err != nil || string(b) != "taco" {
+		t.Errorf("ReadFile: %q, %v", b, err)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// RetryConfig configures NewRetryInterceptor.
+type RetryConfig struct {
+	// The most times to try an op, including the first. Defaults to 3.
+	MaxAttempts int
+
+	// The time to wait before the first retry, which doubles for each further
+	// one up to MaxBackoff. Default to 10ms and 1s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Errors that are worth retrying, as matched by errors.Is. Defaults to
+	// syscall.EAGAIN, syscall.EBUSY, and syscall.ETIMEDOUT.
+	TransientErrors []error
+
+	// Whether an op may be retried. Defaults to IsIdempotent.
+	Idempotent func(op interface{}) bool
+}
+
+// NewRetryInterceptor returns an Interceptor that tries ops again after a
+// while if they fail with transient errors, as the backends of network file
+// systems tend to return, if they're idempotent. See NewInterceptedFileSystem.
+//
+// The outputs of an op are reset before it's tried again. Waiting between
+// tries stops when the op's context is done, such as when the op is
+// interrupted, in which case the op fails with the error from the last try.
+func NewRetryInterceptor(cfg RetryConfig) Interceptor {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 10 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Second
+	}
+	if cfg.TransientErrors == nil {
+		cfg.TransientErrors = []error{syscall.EAGAIN, syscall.EBUSY, syscall.ETIMEDOUT}
+	}
+	if cfg.Idempotent == nil {
+		cfg.Idempotent = IsIdempotent
+	}
+
+	return func(ctx context.Context, op interface{}, next Handler) error {
+		if cfg.MaxAttempts == 1 || !cfg.Idempotent(op) {
+			return next(ctx, op)
+		}
+
+		// Save the op's inputs, to start each try from.
+		v := reflect.ValueOf(op).Elem()
+		saved := reflect.New(v.Type()).Elem()
+		saved.Set(v)
+
+		backoff := cfg.InitialBackoff
+		for attempt := 1; ; attempt++ {
+			err := next(ctx, op)
+			if err == nil || attempt == cfg.MaxAttempts || !isTransient(err, cfg.TransientErrors) {
+				return err
+			}
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			}
+
+			backoff = min(2*backoff, cfg.MaxBackoff)
+			v.Set(saved)
+		}
+	}
+}
+
+func isTransient(err error, transient []error) bool {
+	for _, t := range transient {
+		if errors.Is(err, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsIdempotent returns true if handling the op more than once has the same
+// effect as handling it once, so that it can be safely retried even if it
+// may have taken effect before failing. This is true of ops that don't change
+// anything, and of those that set something to a value given in the op, like
+// writes to a given offset of a file. It isn't true of ops that create,
+// remove, rename, or open files, or that fail if something already exists.
+func IsIdempotent(op interface{}) bool {
+	switch o := op.(type) {
+	case *fuseops.StatFSOp,
+		*fuseops.LookUpInodeOp,
+		*fuseops.GetInodeAttributesOp,
+		*fuseops.StatxOp,
+		*fuseops.SetInodeAttributesOp,
+		*fuseops.ReadDirOp,
+		*fuseops.ReadDirPlusOp,
+		*fuseops.ReadFileOp,
+		*fuseops.WriteFileOp,
+		*fuseops.SyncFileOp,
+		*fuseops.FlushFileOp,
+		*fuseops.ReadSymlinkOp,
+		*fuseops.GetXattrOp,
+		*fuseops.ListXattrOp,
+		*fuseops.SeekFileOp,
+		*fuseops.AccessOp,
+		*fuseops.SyncFSOp:
+		return true
+
+	// Unless it must create the attribute or replace an existing one.
+	case *fuseops.SetXattrOp:
+		return o.Flags == 0
+
+	// Unless it shifts the data of the file.
+	case *fuseops.FallocateOp:
+		return o.Mode&(fuseops.FallocateCollapseRange|fuseops.FallocateInsertRange) == 0
+	}
+
+	return false
+}
@@ -0,0 +1,104 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+// A file system whose ops fail with EAGAIN a given number of times before
+// succeeding, leaving junk in their outputs when they do.
+type flakyFS struct {
+	fuseutil.NotImplementedFileSystem
+	failures atomic.Int32
+	calls    atomic.Int32
+}
+
+func (fs *flakyFS) fail() bool {
+	fs.calls.Add(1)
+	return fs.failures.Add(-1) >= 0
+}
+
+func (fs *flakyFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAttributesOp) error {
+	if fs.fail() {
+		op.Attributes.Nlink = 99
+		return syscall.EAGAIN
+	}
+	op.Attributes.Size = 4
+	return nil
+}
+
+func (fs *flakyFS) MkDir(ctx context.Context, op *fuseops.MkDirOp) error {
+	if fs.fail() {
+		return syscall.EAGAIN
+	}
+	return nil
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	fs := &flakyFS{}
+	retrying := fuseutil.NewInterceptedFileSystem(fs, fuseutil.NewRetryInterceptor(fuseutil.RetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}))
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(retrying), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	// Idempotent ops are retried, from scratch.
+	fs.failures.Store(2)
+	getAttr := &fuseops.GetInodeAttributesOp{Inode: fuseops.RootInodeID}
+	if err := k.Do(ctx, getAttr); err != nil {
+		t.Fatalf("GetInodeAttributes: %v", err)
+	}
+	if getAttr.Attributes.Size != 4 || getAttr.Attributes.Nlink != 0 {
+		t.Errorf("unexpected attributes %+v", getAttr.Attributes)
+	}
+	if n := fs.calls.Swap(0); n != 3 {
+		t.Errorf("%d calls, want 3", n)
+	}
+
+	// Up to a point.
+	fs.failures.Store(3)
+	if err := k.Do(ctx, &fuseops.GetInodeAttributesOp{Inode: fuseops.RootInodeID}); err != syscall.EAGAIN {
+		t.Errorf("GetInodeAttributes: got %v, want EAGAIN", err)
+	}
+	if n := fs.calls.Swap(0); n != 3 {
+		t.Errorf("%d calls, want 3", n)
+	}
+
+	// Others aren't.
+	fs.failures.Store(1)
+	mkdir := &fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "dir", Mode: os.ModeDir | 0755}
+	if err := k.Do(ctx, mkdir); err != syscall.EAGAIN {
+		t.Errorf("MkDir: got %v, want EAGAIN", err)
+	}
+	if n := fs.calls.Swap(0); n != 1 {
+		t.Errorf("%d calls, want 1", n)
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// An InodeTable assigns inode IDs to the files of a file system as the kernel
+// learns of them, and tracks the kernel's lookup counts of them, so that they
+// can be dropped when the kernel forgets them, as described in the docs for
+// fuseops.ForgetInodeOp. Files are identified by keys of type K, such as paths
+// or the IDs of the files in a backing store, and the table also holds a
+// value of type V for each.
+//
+// IDs are never reused, so that ops on an inode that has been forgotten,
+// which a correct kernel doesn't send, are detected rather than applied to
+// another file. The root inode is never forgotten.
+//
+// An InodeTable is safe for concurrent use.
+type InodeTable[K comparable, V any] struct {
+	mu sync.Mutex
+
+	// INVARIANT: For each id, e in inodes, byKey[e.key] == id
+	// INVARIANT: For each id in inodes, id < nextID
+	// INVARIANT: inodes[fuseops.RootInodeID] != nil
+	//
+	// GUARDED_BY(mu)
+	inodes map[fuseops.InodeID]*inodeTableEntry[K, V]
+	byKey  map[K]fuseops.InodeID
+	nextID fuseops.InodeID
+}
+
+type inodeTableEntry[K comparable, V any] struct {
+	key         K
+	value       V
+	lookupCount uint64
+}
+
+// NewInodeTable returns an InodeTable holding only the root inode.
+func NewInodeTable[K comparable, V any](rootKey K, root V) *InodeTable[K, V] {
+	return &InodeTable[K, V]{
+		inodes: map[fuseops.InodeID]*inodeTableEntry[K, V]{
+			fuseops.RootInodeID: {key: rootKey, value: root, lookupCount: 1},
+		},
+		byKey:  map[K]fuseops.InodeID{rootKey: fuseops.RootInodeID},
+		nextID: fuseops.RootInodeID + 1,
+	}
+}
+
+// LookUp returns the inode for the given key, adding it to the table with the
+// value returned by newValue if it isn't there yet, and increments its lookup
+// count. Call it for each inode returned to the kernel in a ChildInodeEntry.
+//
+// If newValue returns an error, no inode is added, and the error is returned.
+// It's called with the table locked, so must not use the table itself.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *InodeTable[K, V]) LookUp(
+	key K,
+	newValue func() (V, error)) (fuseops.InodeID, V, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if id, ok := t.byKey[key]; ok {
+		e := t.inodes[id]
+		e.lookupCount++
+		return id, e.value, nil
+	}
+
+	v, err := newValue()
+	if err != nil {
+		return 0, v, err
+	}
+
+	id := t.nextID
+	t.nextID++
+	t.inodes[id] = &inodeTableEntry[K, V]{key: key, value: v, lookupCount: 1}
+	t.byKey[key] = id
+	return id, v, nil
+}
+
+// Get returns the key and value of an inode. It returns syscall.ESTALE if the
+// inode has been forgotten, and fuse.ENOENT if it never existed.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *InodeTable[K, V]) Get(id fuseops.InodeID) (K, V, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.inodes[id]
+	if !ok {
+		var k K
+		var v V
+		return k, v, t.missing(id)
+	}
+
+	return e.key, e.value, nil
+}
+
+// LOCKS_REQUIRED(t.mu)
+func (t *InodeTable[K, V]) missing(id fuseops.InodeID) error {
+	if id < t.nextID {
+		return syscall.ESTALE
+	}
+
+	return fuse.ENOENT
+}
+
+// Find returns the inode for the given key, if the kernel knows of it.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *InodeTable[K, V]) Find(key K) (fuseops.InodeID, V, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id, ok := t.byKey[key]
+	if !ok {
+		var v V
+		return 0, v, false
+	}
+
+	return id, t.inodes[id].value, true
+}
+
+// SetKey changes the key of an inode, such as when a file is renamed. If
+// another inode has the new key, that inode loses it, and can no longer be
+// found by key, as with a file that has been replaced. It's still in the
+// table until the kernel forgets it.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *InodeTable[K, V]) SetKey(id fuseops.InodeID, key K) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.inodes[id]
+	if !ok {
+		return t.missing(id)
+	}
+
+	if t.byKey[e.key] == id {
+		delete(t.byKey, e.key)
+	}
+	e.key = key
+	t.byKey[key] = id
+	return nil
+}
+
+// Unlink makes an inode impossible to find by key, such as when its file has
+// been removed, while keeping it in the table until the kernel forgets it.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *InodeTable[K, V]) Unlink(id fuseops.InodeID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e, ok := t.inodes[id]; ok && t.byKey[e.key] == id {
+		delete(t.byKey, e.key)
+	}
+}
+
+// Forget decrements the lookup count of an inode by n, as requested by
+// fuseops.ForgetInodeOp and fuseops.BatchForgetOp, removing it from the table
+// if it drops to zero. In that case it returns the inode's value and true, so
+// that the caller can release any resources associated with it.
+//
+// It panics if the lookup count would drop below zero, which means that the
+// file system returned an inode to the kernel without calling LookUp.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *InodeTable[K, V]) Forget(id fuseops.InodeID, n uint64) (V, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var zero V
+	e, ok := t.inodes[id]
+	if !ok || id == fuseops.RootInodeID {
+		return zero, false
+	}
+
+	if e.lookupCount < n {
+		panic(fmt.Sprintf(
+			"Inode %d: lookup count %d forgotten %d times",
+			id,
+			e.lookupCount,
+			n))
+	}
+
+	e.lookupCount -= n
+	if e.lookupCount > 0 {
+		return zero, false
+	}
+
+	delete(t.inodes, id)
+	if t.byKey[e.key] == id {
+		delete(t.byKey, e.key)
+	}
+
+	return e.value, true
+}
+
+// Len returns the number of inodes in the table, including the root.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *InodeTable[K, V]) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.inodes)
+}
+
+// A HandleTable assigns handle IDs to the files and directories that a file
+// system opens, as returned in OpenFileOp.Handle and the like, and holds a
+// value of type T for each.
+//
+// IDs are never reused, so that ops on a handle that has been released are
+// detected rather than applied to another open file.
+//
+// The zero value is an empty table, ready to use. A HandleTable is safe for
+// concurrent use.
+type HandleTable[T any] struct {
+	mu sync.Mutex
+
+	// INVARIANT: For each id in handles, 0 < id <= lastID
+	//
+	// GUARDED_BY(mu)
+	handles map[fuseops.HandleID]T
+	lastID  fuseops.HandleID
+}
+
+// Add adds a value to the table, returning its new handle ID.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *HandleTable[T]) Add(v T) fuseops.HandleID {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.handles == nil {
+		t.handles = make(map[fuseops.HandleID]T)
+	}
+
+	t.lastID++
+	t.handles[t.lastID] = v
+	return t.lastID
+}
+
+// Get returns the value of a handle. It returns syscall.ESTALE if the handle
+// has been released, and syscall.EBADF if it never existed.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *HandleTable[T]) Get(id fuseops.HandleID) (T, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	v, ok := t.handles[id]
+	if !ok {
+		return v, t.missing(id)
+	}
+
+	return v, nil
+}
+
+// LOCKS_REQUIRED(t.mu)
+func (t *HandleTable[T]) missing(id fuseops.HandleID) error {
+	if id > 0 && id <= t.lastID {
+		return syscall.ESTALE
+	}
+
+	return syscall.EBADF
+}
+
+// Release removes a handle from the table, returning its value so that the
+// caller can close it. It returns the same errors as Get.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *HandleTable[T]) Release(id fuseops.HandleID) (T, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	v, ok := t.handles[id]
+	if !ok {
+		return v, t.missing(id)
+	}
+
+	delete(t.handles, id)
+	return v, nil
+}
+
+// Len returns the number of open handles.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *HandleTable[T]) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.handles)
+}
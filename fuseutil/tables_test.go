@@ -0,0 +1,150 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+// A file system with a file for every name, which keeps track of them with
+// fuseutil's tables.
+type tablesFS struct {
+	fuseutil.NotImplementedFileSystem
+	inodes  *fuseutil.InodeTable[string, uint64]
+	handles fuseutil.HandleTable[string]
+	sizes   atomic.Uint64
+}
+
+func (fs *tablesFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) error {
+	id, size, err := fs.inodes.LookUp(op.Name, func() (uint64, error) {
+		return fs.sizes.Add(1), nil
+	})
+	op.Entry.Child = id
+	op.Entry.Attributes.Size = size
+	return err
+}
+
+func (fs *tablesFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAttributesOp) error {
+	_, size, err := fs.inodes.Get(op.Inode)
+	op.Attributes.Size = size
+	return err
+}
+
+func (fs *tablesFS) ForgetInode(ctx context.Context, op *fuseops.ForgetInodeOp) error {
+	fs.inodes.Forget(op.Inode, op.N)
+	return nil
+}
+
+func (fs *tablesFS) OpenFile(ctx context.Context, op *fuseops.OpenFileOp) error {
+	name, _, err := fs.inodes.Get(op.Inode)
+	op.Handle = fs.handles.Add(name)
+	return err
+}
+
+func (fs *tablesFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
+	name, err := fs.handles.Get(op.Handle)
+	op.BytesRead = copy(op.Dst, name)
+	return err
+}
+
+func (fs *tablesFS) ReleaseFileHandle(ctx context.Context, op *fuseops.ReleaseFileHandleOp) error {
+	_, err := fs.handles.Release(op.Handle)
+	return err
+}
+
+func TestInodeAndHandleTables(t *testing.T) {
+	fs := &tablesFS{inodes: fuseutil.NewInodeTable[string, uint64]("", 0)}
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	// Looking a name up again returns the same inode, and counts the lookup.
+	var inode fuseops.InodeID
+	for i := 0; i < 2; i++ {
+		op := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "taco"}
+		if err := k.Do(ctx, op); err != nil {
+			t.Fatalf("LookUpInode: %v", err)
+		}
+		if i > 0 && op.Entry.Child != inode {
+			t.Errorf("lookup %d returned inode %d, want %d", i, op.Entry.Child, inode)
+		}
+		if op.Entry.Attributes.Size != 1 {
+			t.Errorf("unexpected entry %+v", op.Entry)
+		}
+		inode = op.Entry.Child
+	}
+
+	open := &fuseops.OpenFileOp{Inode: inode}
+	if err := k.Do(ctx, open); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	read := &fuseops.ReadFileOp{Inode: inode, Handle: open.Handle, Size: 100}
+	if err := k.Do(ctx, read); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got := string(read.Dst[:read.BytesRead]); got != "taco" {
+		t.Errorf("read %q", got)
+	}
+
+	// Released handles are detected.
+	if err := k.Do(ctx, &fuseops.ReleaseFileHandleOp{Handle: open.Handle}); err != nil {
+		t.Fatalf("ReleaseFileHandle: %v", err)
+	}
+	read = &fuseops.ReadFileOp{Inode: inode, Handle: open.Handle, Size: 100}
+	if err := k.Do(ctx, read); err != syscall.ESTALE {
+		t.Errorf("ReadFile of released handle: got %v, want ESTALE", err)
+	}
+	read = &fuseops.ReadFileOp{Inode: inode, Handle: open.Handle + 1, Size: 100}
+	if err := k.Do(ctx, read); err != syscall.EBADF {
+		t.Errorf("ReadFile of unknown handle: got %v, want EBADF", err)
+	}
+
+	// The inode survives until the kernel has forgotten every lookup.
+	if err := k.Do(ctx, &fuseops.ForgetInodeOp{Inode: inode, N: 1}); err != nil {
+		t.Fatalf("ForgetInode: %v", err)
+	}
+	if err := k.Do(ctx, &fuseops.GetInodeAttributesOp{Inode: inode}); err != nil {
+		t.Errorf("GetInodeAttributes: %v", err)
+	}
+	if err := k.Do(ctx, &fuseops.ForgetInodeOp{Inode: inode, N: 1}); err != nil {
+		t.Fatalf("ForgetInode: %v", err)
+	}
+	if err := k.Do(ctx, &fuseops.GetInodeAttributesOp{Inode: inode}); err != syscall.ESTALE {
+		t.Errorf("GetInodeAttributes of forgotten inode: got %v, want ESTALE", err)
+	}
+	if n := fs.inodes.Len(); n != 1 {
+		t.Errorf("%d inodes left, want 1", n)
+	}
+
+	// Looking the name up again assigns a new inode.
+	lookUp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "taco"}
+	if err := k.Do(ctx, lookUp); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+	if lookUp.Entry.Child == inode || lookUp.Entry.Attributes.Size != 2 {
+		t.Errorf("unexpected entry %+v", lookUp.Entry)
+	}
+}
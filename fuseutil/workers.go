@@ -0,0 +1,273 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"container/heap"
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/jacobsa/fuse"
+)
+
+// An op waiting for a worker.
+type queuedOp struct {
+	ctx context.Context
+	op  interface{}
+
+	// For ops in a priorityQueue, their priority and the order in which they
+	// were queued.
+	priority int
+	seq      uint64
+}
+
+// workers hands ops to the goroutines that handle them, as configured by
+// fuse.ServerConcurrency.
+type workers struct {
+	s *fileSystemServer
+	c *fuse.Connection
+
+	// The queue of the general pool, or nil if each op gets a goroutine of
+	// its own, and those of the pools for particular op types. If the general
+	// pool takes ops in order of priority, they are queued in prioritized
+	// instead of queue.
+	queue       chan queuedOp
+	prioritized *priorityQueue
+	priorities  map[string]int
+	byOp        map[string]chan queuedOp
+	running     sync.WaitGroup
+
+	// The number of workers started, across all pools, by which they are
+	// numbered from one for fuse.MarkWorker.
+	started int
+}
+
+func newWorkers(
+	s *fileSystemServer,
+	c *fuse.Connection,
+	conc fuse.ServerConcurrency) *workers {
+	w := &workers{
+		s:    s,
+		c:    c,
+		byOp: make(map[string]chan queuedOp),
+	}
+
+	switch {
+	case conc.Workers > 0 && len(conc.OpPriorities) > 0:
+		limit := conc.MaxQueuedOps
+		if limit <= 0 {
+			limit = 16 * conc.Workers
+		}
+		w.prioritized = w.startPrioritized(conc.Workers, limit)
+		w.priorities = conc.OpPriorities
+
+	case conc.Workers > 0:
+		w.queue = w.start(conc.Workers)
+	}
+
+	for name, n := range conc.OpWorkers {
+		if n > 0 {
+			w.byOp[name] = w.start(n)
+		}
+	}
+
+	return w
+}
+
+// Start n workers serving a new queue. The queue is unbuffered, so that ops
+// are only read from the kernel as fast as they can be handled.
+func (w *workers) start(n int) chan queuedOp {
+	q := make(chan queuedOp)
+	w.running.Add(n)
+	for i := 0; i < n; i++ {
+		w.started++
+		worker := w.started
+		go func() {
+			defer w.running.Done()
+			for qo := range q {
+				fuse.MarkWorker(qo.ctx, worker)
+				w.s.handleOp(w.c, qo.ctx, qo.op)
+			}
+		}()
+	}
+
+	return q
+}
+
+// Start n workers serving a new priority queue, which holds at most limit ops
+// of each priority.
+func (w *workers) startPrioritized(n int, limit int) *priorityQueue {
+	q := newPriorityQueue(limit)
+	w.running.Add(n)
+	for i := 0; i < n; i++ {
+		w.started++
+		worker := w.started
+		go func() {
+			defer w.running.Done()
+			for {
+				qo, ok := q.pop()
+				if !ok {
+					return
+				}
+				fuse.MarkWorker(qo.ctx, worker)
+				w.s.handleOp(w.c, qo.ctx, qo.op)
+			}
+		}()
+	}
+
+	return q
+}
+
+// Handle the op, blocking until a worker is free to take it if they are
+// bounded, or if they take ops by priority, until there is room to queue it.
+func (w *workers) handle(ctx context.Context, op interface{}) {
+	name := reflect.TypeOf(op).Elem().Name()
+	if q, ok := w.byOp[name]; ok {
+		q <- queuedOp{ctx: ctx, op: op}
+		return
+	}
+
+	if w.prioritized != nil {
+		w.prioritized.push(queuedOp{ctx: ctx, op: op, priority: w.priorities[name]})
+		return
+	}
+
+	if w.queue != nil {
+		w.queue <- queuedOp{ctx: ctx, op: op}
+		return
+	}
+
+	go w.s.handleOp(w.c, ctx, op)
+}
+
+// Stop the workers once no more ops will be handed to them, waiting for them
+// to finish those they have.
+func (w *workers) stop() {
+	if w.queue != nil {
+		close(w.queue)
+	}
+	if w.prioritized != nil {
+		w.prioritized.close()
+	}
+	for _, q := range w.byOp {
+		close(q)
+	}
+
+	w.running.Wait()
+}
+
+// priorityQueue is a queue of ops, from which the op with the highest
+// priority that was queued first is taken. It holds at most limit ops of each
+// priority.
+type priorityQueue struct {
+	limit int
+
+	mu       sync.Mutex
+	nonEmpty sync.Cond
+	notFull  sync.Cond
+
+	// GUARDED_BY(mu)
+	ops     queuedOpHeap
+	counts  map[int]int // The number of ops in ops, by priority
+	nextSeq uint64
+	closed  bool
+}
+
+func newPriorityQueue(limit int) *priorityQueue {
+	q := &priorityQueue{
+		limit:  limit,
+		counts: make(map[int]int),
+	}
+	q.nonEmpty.L = &q.mu
+	q.notFull.L = &q.mu
+	return q
+}
+
+// Queue the op, waiting while as many ops of its priority as the queue holds
+// are already queued.
+//
+// LOCKS_EXCLUDED(q.mu)
+func (q *priorityQueue) push(qo queuedOp) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.counts[qo.priority] >= q.limit {
+		q.notFull.Wait()
+	}
+
+	q.counts[qo.priority]++
+	qo.seq = q.nextSeq
+	q.nextSeq++
+	heap.Push(&q.ops, qo)
+	q.nonEmpty.Signal()
+}
+
+// Take the next op, waiting for one if there are none. Return false once the
+// queue has been closed and drained.
+//
+// LOCKS_EXCLUDED(q.mu)
+func (q *priorityQueue) pop() (queuedOp, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.ops) == 0 {
+		if q.closed {
+			return queuedOp{}, false
+		}
+		q.nonEmpty.Wait()
+	}
+
+	qo := heap.Pop(&q.ops).(queuedOp)
+	q.counts[qo.priority]--
+	q.notFull.Broadcast()
+	return qo, true
+}
+
+// Close the queue once no more ops will be pushed to it.
+//
+// LOCKS_EXCLUDED(q.mu)
+func (q *priorityQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.nonEmpty.Broadcast()
+}
+
+// queuedOpHeap implements heap.Interface.
+type queuedOpHeap []queuedOp
+
+func (h queuedOpHeap) Len() int      { return len(h) }
+func (h queuedOpHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h queuedOpHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h *queuedOpHeap) Push(x any) {
+	*h = append(*h, x.(queuedOp))
+}
+
+func (h *queuedOpHeap) Pop() any {
+	old := *h
+	qo := old[len(old)-1]
+	old[len(old)-1] = queuedOp{}
+	*h = old[:len(old)-1]
+	return qo
+}
@@ -0,0 +1,302 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+// A buffer that may be written to concurrently, as a wire logger is.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func TestWorkersMarkWorker(t *testing.T) {
+	var buf syncBuffer
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(&fuseutil.NotImplementedFileSystem{}), &fuse.MountConfig{
+		WireLogger: &buf,
+		Concurrency: fuse.ServerConcurrency{
+			Workers:   2,
+			OpWorkers: map[string]int{"GetInodeAttributesOp": 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			k.Do(context.Background(), &fuseops.StatFSOp{})
+		}()
+		go func() {
+			defer wg.Done()
+			k.Do(context.Background(), &fuseops.GetInodeAttributesOp{Inode: fuseops.RootInodeID})
+		}()
+	}
+	wg.Wait()
+	k.Close()
+
+	// Workers are numbered from one across all pools.
+	workers := make(map[string]map[int]bool)
+	dec := json.NewDecoder(&buf.buf)
+	for dec.More() {
+		var wlog fuse.WireLogRecord
+		if err := dec.Decode(&wlog); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+
+		switch wlog.Operation {
+		case "StatFSOp", "GetInodeAttributesOp":
+			if workers[wlog.Operation] == nil {
+				workers[wlog.Operation] = make(map[int]bool)
+			}
+			workers[wlog.Operation][wlog.Worker] = true
+		}
+	}
+
+	for w := range workers["StatFSOp"] {
+		if w != 1 && w != 2 {
+			t.Errorf("StatFSOp handled by worker %d, want 1 or 2", w)
+		}
+	}
+	for w := range workers["GetInodeAttributesOp"] {
+		if w != 3 {
+			t.Errorf("GetInodeAttributesOp handled by worker %d, want 3", w)
+		}
+	}
+	if len(workers["StatFSOp"]) == 0 || len(workers["GetInodeAttributesOp"]) == 0 {
+		t.Errorf("missing records: %v", workers)
+	}
+}
+
+// A file system whose StatFS waits for release to be closed.
+type blockingStatFS struct {
+	fuseutil.NotImplementedFileSystem
+	release chan struct{}
+}
+
+func (fs *blockingStatFS) StatFS(ctx context.Context, op *fuseops.StatFSOp) error {
+	<-fs.release
+	return nil
+}
+
+// An OpTracer that counts the ops read from the kernel.
+type countingTracer struct {
+	read atomic.Int32
+}
+
+func (tr *countingTracer) StartOp(ctx context.Context, op interface{}) context.Context {
+	tr.read.Add(1)
+	return ctx
+}
+
+func (tr *countingTracer) FinishOp(ctx context.Context, wlog *fuse.WireLogRecord) {}
+
+func TestWorkersMaxQueuedOps(t *testing.T) {
+	fs := &blockingStatFS{release: make(chan struct{})}
+	tr := &countingTracer{}
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), &fuse.MountConfig{
+		OpTracer: tr,
+		Concurrency: fuse.ServerConcurrency{
+			Workers:      1,
+			OpPriorities: map[string]int{"GetInodeAttributesOp": 1},
+			MaxQueuedOps: 2,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	// Initialization is an op of its own.
+	base := tr.read.Load()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := k.Do(context.Background(), &fuseops.StatFSOp{}); err != nil {
+				t.Errorf("StatFS: %v", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// One op is with the worker and two are queued. The reader waits to queue
+	// a fourth, leaving the rest with the kernel.
+	if got := tr.read.Load() - base; got != 4 {
+		t.Errorf("expected 4 ops read, got %d", got)
+	}
+
+	close(fs.release)
+	wg.Wait()
+}
+
+func TestServerConcurrency(t *testing.T) {
+	testCases := []struct {
+		conc              fuse.ServerConcurrency
+		maxStatFS, maxGet int
+	}{
+		// Unbounded by default, which is checked separately.
+		{fuse.ServerConcurrency{}, 0, 0},
+		{fuse.ServerConcurrency{Readers: 2, Workers: 1}, 1, 1},
+		{fuse.ServerConcurrency{Workers: 3, OpWorkers: map[string]int{"StatFSOp": 2}}, 2, 3},
+	}
+
+	for i, tc := range testCases {
+		fs := &concurrencyFS{running: make(map[string]int), peak: make(map[string]int)}
+		k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), &fuse.MountConfig{Concurrency: tc.conc})
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		for j := 0; j < 8; j++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if err := k.Do(context.Background(), &fuseops.StatFSOp{}); err != nil {
+					t.Errorf("StatFS: %v", err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				op := &fuseops.GetInodeAttributesOp{Inode: fuseops.RootInodeID}
+				if err := k.Do(context.Background(), op); err != nil {
+					t.Errorf("GetInodeAttributes: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		k.Close()
+
+		// Unbounded handlers should overlap, and bounded ones mustn't exceed
+		// their bound.
+		if tc.conc.Workers == 0 {
+			if fs.peak["StatFS"] < 2 {
+				t.Errorf("case %d: StatFS peak %d, expected concurrency", i, fs.peak["StatFS"])
+			}
+			continue
+		}
+		if got := fs.peak["StatFS"]; got > tc.maxStatFS {
+			t.Errorf("case %d: StatFS peak %d, want at most %d", i, got, tc.maxStatFS)
+		}
+		if got := fs.peak["GetInodeAttributes"]; got > tc.maxGet {
+			t.Errorf("case %d: GetInodeAttributes peak %d, want at most %d", i, got, tc.maxGet)
+		}
+	}
+}
+
+// A file system that records the order in which it handles ops, the first of
+// which waits for release to be closed.
+type priorityFS struct {
+	fuseutil.NotImplementedFileSystem
+	entered chan struct{}
+	release chan struct{}
+
+	mu    sync.Mutex
+	order []string
+}
+
+func (fs *priorityFS) record(name string) {
+	fs.mu.Lock()
+	fs.order = append(fs.order, name)
+	first := len(fs.order) == 1
+	fs.mu.Unlock()
+
+	if first {
+		close(fs.entered)
+		<-fs.release
+	}
+}
+
+func (fs *priorityFS) StatFS(ctx context.Context, op *fuseops.StatFSOp) error {
+	fs.record("StatFS")
+	return nil
+}
+
+func (fs *priorityFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAttributesOp) error {
+	fs.record("GetInodeAttributes")
+	return nil
+}
+
+func TestOpPriorities(t *testing.T) {
+	fs := &priorityFS{entered: make(chan struct{}), release: make(chan struct{})}
+	cfg := &fuse.MountConfig{
+		Concurrency: fuse.ServerConcurrency{
+			Workers:      1,
+			OpPriorities: map[string]int{"GetInodeAttributesOp": 1},
+		},
+	}
+
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), cfg)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	var wg sync.WaitGroup
+	do := func(op any) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := k.Do(context.Background(), op); err != nil {
+				t.Errorf("%T: %v", op, err)
+			}
+		}()
+	}
+
+	// Tie up the only worker, then queue up more ops behind it, the
+	// latency-sensitive one last.
+	do(&fuseops.StatFSOp{})
+	<-fs.entered
+	for i := 0; i < 4; i++ {
+		do(&fuseops.StatFSOp{})
+	}
+	time.Sleep(50 * time.Millisecond)
+	do(&fuseops.GetInodeAttributesOp{Inode: fuseops.RootInodeID})
+	time.Sleep(50 * time.Millisecond)
+
+	close(fs.release)
+	wg.Wait()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if len(fs.order) != 6 || fs.order[1] != "GetInodeAttributes" {
+		t.Errorf("unexpected order %v", fs.order)
+	}
+}
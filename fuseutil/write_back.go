@@ -0,0 +1,411 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// WriteBackConfig configures NewWriteBackFileSystem.
+type WriteBackConfig struct {
+	// Where the data of writes is kept until it's been written to the wrapped
+	// file system. If nil, NewMemoryJournal is used.
+	Journal WriteJournal
+
+	// The most bytes of writes to hold at once. WriteFile blocks while this
+	// many are waiting to be written. If zero, 64 MiB is used.
+	MaxPendingBytes int64
+}
+
+// NewWriteBackFileSystem returns a FileSystem that answers WriteFile as soon
+// as the data has been added to a journal, and writes it to the supplied file
+// system in the background, in the order it was written. This helps
+// throughput where the wrapped file system is slow to write.
+//
+// SyncFile and FlushFile wait for the writes to their inode to have been
+// made, and return the first error that any of them met since the last such
+// call, so that fsync(2) and close(2) still report whether the data made it.
+// SyncFS waits for all writes. Ops that read an inode's data, or change it
+// other than by WriteFile, wait for the inode's writes first, as does
+// ReleaseFileHandle, so that the wrapped file system never sees a write to a
+// handle it's released. GetInodeAttributes and LookUpInode don't wait, but
+// report sizes that include the writes still to be made.
+//
+// Destroy waits for all writes before destroying the wrapped file system.
+func NewWriteBackFileSystem(wrapped FileSystem, cfg WriteBackConfig) FileSystem {
+	if cfg.Journal == nil {
+		cfg.Journal = NewMemoryJournal()
+	}
+
+	if cfg.MaxPendingBytes == 0 {
+		cfg.MaxPendingBytes = 64 << 20
+	}
+
+	fs := &writeBackFS{
+		FileSystem: wrapped,
+		cfg:        cfg,
+		inodes:     make(map[fuseops.InodeID]*pendingInode),
+		done:       make(chan struct{}),
+	}
+	fs.cond.L = &fs.mu
+
+	go fs.writeJournaled()
+	return fs
+}
+
+type writeBackFS struct {
+	FileSystem
+	cfg WriteBackConfig
+
+	mu sync.Mutex
+
+	// Signalled whenever the queue or the inodes change.
+	cond sync.Cond
+
+	// The writes still to be made, in the order they're to be made.
+	//
+	// GUARDED_BY(mu)
+	queue []journaledWrite
+
+	// The inodes with writes in the queue, or errors from writing that are
+	// yet to be returned, and the total size of the queued writes.
+	//
+	// INVARIANT: For each p in inodes, p.writes > 0 || p.err != nil
+	// INVARIANT: pendingBytes is the sum of w.length over queue
+	//
+	// GUARDED_BY(mu)
+	inodes       map[fuseops.InodeID]*pendingInode
+	pendingBytes int64
+
+	// Set by Destroy, once there are to be no more writes.
+	//
+	// GUARDED_BY(mu)
+	destroyed bool
+
+	// Closed when writeJournaled returns.
+	done chan struct{}
+}
+
+// A write that's been accepted, and whose data is in the journal.
+type journaledWrite struct {
+	id        uint64
+	inode     fuseops.InodeID
+	handle    fuseops.HandleID
+	offset    int64
+	length    int
+	opContext fuseops.OpContext
+}
+
+type pendingInode struct {
+	// The number of queued writes to the inode, and the end of the furthest of
+	// them.
+	writes int
+	end    uint64
+
+	// The first error met writing to the inode since it was last returned.
+	err error
+}
+
+// Make the queued writes, until Destroy is called and the queue is empty.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *writeBackFS) writeJournaled() {
+	defer close(fs.done)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for {
+		for len(fs.queue) == 0 && !fs.destroyed {
+			fs.cond.Wait()
+		}
+
+		if len(fs.queue) == 0 {
+			return
+		}
+
+		w := fs.queue[0]
+		fs.mu.Unlock()
+		err := fs.write(w)
+		fs.mu.Lock()
+
+		fs.queue = fs.queue[1:]
+		fs.pendingBytes -= int64(w.length)
+
+		p := fs.inodes[w.inode]
+		p.writes--
+		if p.err == nil {
+			p.err = err
+		}
+
+		if p.writes == 0 {
+			p.end = 0
+			if p.err == nil {
+				delete(fs.inodes, w.inode)
+			}
+		}
+
+		fs.cond.Broadcast()
+	}
+}
+
+// Make a queued write.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *writeBackFS) write(w journaledWrite) error {
+	data, err := fs.cfg.Journal.Load(w.id)
+	if err != nil {
+		return err
+	}
+
+	err = fs.FileSystem.WriteFile(context.Background(), &fuseops.WriteFileOp{
+		Inode:     w.inode,
+		Handle:    w.handle,
+		Offset:    w.offset,
+		Data:      data,
+		OpContext: w.opContext,
+	})
+
+	if discardErr := fs.cfg.Journal.Discard(w.id); err == nil {
+		err = discardErr
+	}
+
+	return err
+}
+
+// Wait until there are no queued writes to the inode, and return the first
+// error met writing to it since it was last returned. If take is set, the
+// error is returned for the last time.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *writeBackFS) barrier(inode fuseops.InodeID, take bool) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for {
+		p, ok := fs.inodes[inode]
+		if !ok {
+			return nil
+		}
+
+		if p.writes == 0 {
+			err := p.err
+			if take {
+				delete(fs.inodes, inode)
+			}
+			return err
+		}
+
+		fs.cond.Wait()
+	}
+}
+
+// Extend the size in the attributes to include the queued writes to the
+// inode.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *writeBackFS) patchSize(
+	inode fuseops.InodeID,
+	attrs *fuseops.InodeAttributes) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if p, ok := fs.inodes[inode]; ok && p.end > attrs.Size {
+		attrs.Size = p.end
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// FileSystem methods
+////////////////////////////////////////////////////////////////////////
+
+func (fs *writeBackFS) WriteFile(
+	ctx context.Context,
+	op *fuseops.WriteFileOp) error {
+	// Wait for room, and take it.
+	fs.mu.Lock()
+	for fs.pendingBytes > 0 && fs.pendingBytes+int64(len(op.Data)) > fs.cfg.MaxPendingBytes {
+		fs.cond.Wait()
+	}
+	fs.pendingBytes += int64(len(op.Data))
+	fs.mu.Unlock()
+
+	id, err := fs.cfg.Journal.Append(op.Data)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err != nil {
+		fs.pendingBytes -= int64(len(op.Data))
+		fs.cond.Broadcast()
+		return err
+	}
+
+	fs.queue = append(fs.queue, journaledWrite{
+		id:        id,
+		inode:     op.Inode,
+		handle:    op.Handle,
+		offset:    op.Offset,
+		length:    len(op.Data),
+		opContext: op.OpContext,
+	})
+
+	p := fs.inodes[op.Inode]
+	if p == nil {
+		p = &pendingInode{}
+		fs.inodes[op.Inode] = p
+	}
+
+	p.writes++
+	p.end = max(p.end, uint64(op.Offset)+uint64(len(op.Data)))
+
+	fs.cond.Broadcast()
+	return nil
+}
+
+func (fs *writeBackFS) SyncFile(
+	ctx context.Context,
+	op *fuseops.SyncFileOp) error {
+	if err := fs.barrier(op.Inode, true); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.SyncFile(ctx, op)
+}
+
+func (fs *writeBackFS) FlushFile(
+	ctx context.Context,
+	op *fuseops.FlushFileOp) error {
+	if err := fs.barrier(op.Inode, true); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.FlushFile(ctx, op)
+}
+
+func (fs *writeBackFS) SyncFS(
+	ctx context.Context,
+	op *fuseops.SyncFSOp) error {
+	fs.mu.Lock()
+	for len(fs.queue) != 0 {
+		fs.cond.Wait()
+	}
+	fs.mu.Unlock()
+
+	return fs.FileSystem.SyncFS(ctx, op)
+}
+
+func (fs *writeBackFS) ReleaseFileHandle(
+	ctx context.Context,
+	op *fuseops.ReleaseFileHandleOp) error {
+	// Errors from writing through the handle are returned by FlushFile, which
+	// the kernel sends first. The kernel ignores those of releases.
+	fs.mu.Lock()
+	for fs.hasQueuedForHandle(op.Handle) {
+		fs.cond.Wait()
+	}
+	fs.mu.Unlock()
+
+	return fs.FileSystem.ReleaseFileHandle(ctx, op)
+}
+
+// LOCKS_REQUIRED(fs.mu)
+func (fs *writeBackFS) hasQueuedForHandle(h fuseops.HandleID) bool {
+	for _, w := range fs.queue {
+		if w.handle == h {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (fs *writeBackFS) ReadFile(
+	ctx context.Context,
+	op *fuseops.ReadFileOp) error {
+	fs.barrier(op.Inode, false)
+	return fs.FileSystem.ReadFile(ctx, op)
+}
+
+func (fs *writeBackFS) SetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.SetInodeAttributesOp) error {
+	fs.barrier(op.Inode, false)
+	return fs.FileSystem.SetInodeAttributes(ctx, op)
+}
+
+func (fs *writeBackFS) Statx(
+	ctx context.Context,
+	op *fuseops.StatxOp) error {
+	fs.barrier(op.Inode, false)
+	return fs.FileSystem.Statx(ctx, op)
+}
+
+func (fs *writeBackFS) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) error {
+	fs.barrier(op.Inode, false)
+	return fs.FileSystem.Fallocate(ctx, op)
+}
+
+func (fs *writeBackFS) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	fs.barrier(op.SrcInode, false)
+	fs.barrier(op.DstInode, false)
+	return fs.FileSystem.CopyFileRange(ctx, op)
+}
+
+func (fs *writeBackFS) SeekFile(
+	ctx context.Context,
+	op *fuseops.SeekFileOp) error {
+	fs.barrier(op.Inode, false)
+	return fs.FileSystem.SeekFile(ctx, op)
+}
+
+func (fs *writeBackFS) GetInodeAttributes(
+	ctx context.Context,
+	op *fuseops.GetInodeAttributesOp) error {
+	if err := fs.FileSystem.GetInodeAttributes(ctx, op); err != nil {
+		return err
+	}
+
+	fs.patchSize(op.Inode, &op.Attributes)
+	return nil
+}
+
+func (fs *writeBackFS) LookUpInode(
+	ctx context.Context,
+	op *fuseops.LookUpInodeOp) error {
+	if err := fs.FileSystem.LookUpInode(ctx, op); err != nil {
+		return err
+	}
+
+	fs.patchSize(op.Entry.Child, &op.Entry.Attributes)
+	return nil
+}
+
+func (fs *writeBackFS) Destroy() {
+	fs.mu.Lock()
+	fs.destroyed = true
+	fs.cond.Broadcast()
+	fs.mu.Unlock()
+
+	<-fs.done
+	fs.FileSystem.Destroy()
+}
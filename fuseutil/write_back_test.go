@@ -0,0 +1,149 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+// A file system with one file, inode 2, whose writes wait for the test to
+// let them through, and fail if the test says so.
+type slowWriteFS struct {
+	fuseutil.NotImplementedFileSystem
+	gate chan struct{}
+
+	mu       sync.Mutex
+	contents []byte
+	fail     bool
+}
+
+func (fs *slowWriteFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAttributesOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	op.Attributes = fuseops.InodeAttributes{Size: uint64(len(fs.contents)), Nlink: 1, Mode: 0644}
+	return nil
+}
+
+func (fs *slowWriteFS) WriteFile(ctx context.Context, op *fuseops.WriteFileOp) error {
+	<-fs.gate
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.fail {
+		return syscall.EIO
+	}
+
+	if end := int(op.Offset) + len(op.Data); end > len(fs.contents) {
+		fs.contents = append(fs.contents, make([]byte, end-len(fs.contents))...)
+	}
+	copy(fs.contents[op.Offset:], op.Data)
+	return nil
+}
+
+func (fs *slowWriteFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if op.Offset < int64(len(fs.contents)) {
+		op.BytesRead = copy(op.Dst, fs.contents[op.Offset:])
+	}
+	return nil
+}
+
+func (fs *slowWriteFS) FlushFile(ctx context.Context, op *fuseops.FlushFileOp) error {
+	return nil
+}
+
+func TestWriteBackFileSystem(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "journal")
+	if err != nil {
+		t.Fatalf("CreateTemp: %v", err)
+	}
+	defer f.Close()
+
+	journal, err := fuseutil.NewFileJournal(f)
+	if err != nil {
+		t.Fatalf("NewFileJournal: %v", err)
+	}
+
+	fs := &slowWriteFS{gate: make(chan struct{})}
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fuseutil.NewWriteBackFileSystem(fs, fuseutil.WriteBackConfig{Journal: journal})), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	// Writes are answered while the wrapped file system is still stuck, and
+	// the size includes them.
+	for i, s := range []string{"hello", " world"} {
+		op := &fuseops.WriteFileOp{Inode: 2, Handle: 1, Offset: int64(5 * i), Data: []byte(s)}
+		if err := k.Do(ctx, op); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	attrs := &fuseops.GetInodeAttributesOp{Inode: 2}
+	if err := k.Do(ctx, attrs); err != nil || attrs.Attributes.Size != 11 {
+		t.Errorf("GetInodeAttributes: size %d, %v; want 11", attrs.Attributes.Size, err)
+	}
+
+	// A flush waits for them.
+	flushed := make(chan error, 1)
+	go func() { flushed <- k.Do(ctx, &fuseops.FlushFileOp{Inode: 2, Handle: 1}) }()
+	select {
+	case err := <-flushed:
+		t.Fatalf("FlushFile returned before the writes were made: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(fs.gate)
+	if err := <-flushed; err != nil {
+		t.Errorf("FlushFile: %v", err)
+	}
+
+	read := &fuseops.ReadFileOp{Inode: 2, Handle: 1, Size: 64}
+	if err := k.Do(ctx, read); err != nil || string(read.Dst[:read.BytesRead]) != "hello world" {
+		t.Errorf("ReadFile: %q, %v", read.Dst[:read.BytesRead], err)
+	}
+
+	// An error in writing is returned by the next flush, and only by it.
+	fs.mu.Lock()
+	fs.fail = true
+	fs.mu.Unlock()
+
+	if err := k.Do(ctx, &fuseops.WriteFileOp{Inode: 2, Handle: 1, Data: []byte("x")}); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := k.Do(ctx, &fuseops.FlushFileOp{Inode: 2, Handle: 1}); err != syscall.EIO {
+		t.Errorf("FlushFile after failed write: %v, want EIO", err)
+	}
+	if err := k.Do(ctx, &fuseops.FlushFileOp{Inode: 2, Handle: 1}); err != nil {
+		t.Errorf("second FlushFile: %v", err)
+	}
+
+	// The journal is emptied once everything's been written.
+	if fi, err := f.Stat(); err != nil || fi.Size() != 0 {
+		t.Errorf("journal size %v, %v; want 0", fi.Size(), err)
+	}
+}
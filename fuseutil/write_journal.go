@@ -0,0 +1,179 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// A WriteJournal holds the data of writes that NewWriteBackFileSystem has
+// accepted but not yet written to the file system it wraps. It must be safe
+// for concurrent use.
+type WriteJournal interface {
+	// Append stores a copy of the data of a write, returning an ID by which to
+	// load it.
+	Append(data []byte) (uint64, error)
+
+	// Load returns the data stored under the ID.
+	Load(id uint64) ([]byte, error)
+
+	// Discard drops the data stored under the ID, once it's been written.
+	Discard(id uint64) error
+}
+
+// NewMemoryJournal returns a WriteJournal that keeps data in memory.
+func NewMemoryJournal() WriteJournal {
+	return &memoryJournal{
+		data: make(map[uint64][]byte),
+	}
+}
+
+type memoryJournal struct {
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	next uint64
+	data map[uint64][]byte
+}
+
+// LOCKS_EXCLUDED(j.mu)
+func (j *memoryJournal) Append(data []byte) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	id := j.next
+	j.next++
+	j.data[id] = append([]byte(nil), data...)
+
+	return id, nil
+}
+
+// LOCKS_EXCLUDED(j.mu)
+func (j *memoryJournal) Load(id uint64) ([]byte, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, ok := j.data[id]
+	if !ok {
+		return nil, fmt.Errorf("no journaled write %d", id)
+	}
+
+	return data, nil
+}
+
+// LOCKS_EXCLUDED(j.mu)
+func (j *memoryJournal) Discard(id uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.data, id)
+	return nil
+}
+
+// NewFileJournal returns a WriteJournal that keeps data in the supplied file,
+// which it truncates whenever all of the data in it has been discarded. The
+// file should be on a local disk, and is for the journal's use alone. The
+// caller remains responsible for closing it.
+//
+// The journal bounds the memory taken by writes in flight, but isn't a
+// means of recovering them after a crash: what's in it isn't synced, and
+// can't be replayed.
+func NewFileJournal(f *os.File) (WriteJournal, error) {
+	if err := f.Truncate(0); err != nil {
+		return nil, fmt.Errorf("Truncate: %w", err)
+	}
+
+	return &fileJournal{
+		f:       f,
+		extents: make(map[uint64]journalExtent),
+	}, nil
+}
+
+type fileJournal struct {
+	f *os.File
+
+	mu sync.Mutex
+
+	// The extents of the file holding the data not yet discarded, and the end
+	// of the last of them.
+	//
+	// INVARIANT: For each extent e in extents, e.offset+e.length <= end
+	//
+	// GUARDED_BY(mu)
+	next    uint64
+	extents map[uint64]journalExtent
+	end     int64
+}
+
+type journalExtent struct {
+	offset int64
+	length int
+}
+
+// LOCKS_EXCLUDED(j.mu)
+func (j *fileJournal) Append(data []byte) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.f.WriteAt(data, j.end); err != nil {
+		return 0, fmt.Errorf("WriteAt: %w", err)
+	}
+
+	id := j.next
+	j.next++
+	j.extents[id] = journalExtent{offset: j.end, length: len(data)}
+	j.end += int64(len(data))
+
+	return id, nil
+}
+
+// LOCKS_EXCLUDED(j.mu)
+func (j *fileJournal) Load(id uint64) ([]byte, error) {
+	j.mu.Lock()
+	e, ok := j.extents[id]
+	j.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no journaled write %d", id)
+	}
+
+	// The extent can't be overwritten until it's been discarded.
+	data := make([]byte, e.length)
+	if _, err := j.f.ReadAt(data, e.offset); err != nil {
+		return nil, fmt.Errorf("ReadAt: %w", err)
+	}
+
+	return data, nil
+}
+
+// LOCKS_EXCLUDED(j.mu)
+func (j *fileJournal) Discard(id uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.extents, id)
+	if len(j.extents) != 0 {
+		return nil
+	}
+
+	j.end = 0
+	if err := j.f.Truncate(0); err != nil {
+		return fmt.Errorf("Truncate: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,377 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// The namespaces into which Linux divides the names of extended attributes,
+// as prefixes of the names. See xattr(7).
+const (
+	XattrNamespaceUser     = "user."
+	XattrNamespaceTrusted  = "trusted."
+	XattrNamespaceSecurity = "security."
+	XattrNamespaceSystem   = "system."
+)
+
+// Values for fuseops.SetXattrOp.Flags. See setxattr(2).
+const (
+	XattrCreate  = 0x1 // Fail with EEXIST if the attribute exists
+	XattrReplace = 0x2 // Fail with fuse.ENOATTR if it doesn't
+)
+
+// XattrNamespace returns the namespace of the named extended attribute, or
+// the empty string if it's in none of those listed above.
+func XattrNamespace(name string) string {
+	for _, ns := range []string{
+		XattrNamespaceUser,
+		XattrNamespaceTrusted,
+		XattrNamespaceSecurity,
+		XattrNamespaceSystem,
+	} {
+		if strings.HasPrefix(name, ns) {
+			return ns
+		}
+	}
+
+	return ""
+}
+
+// FillGetXattr answers a fuseops.GetXattrOp with the given value. If Dst is
+// empty, the caller is asking for the size of the value, and only BytesRead
+// is set. If it's non-empty but too small, ERANGE is returned, along with the
+// size.
+func FillGetXattr(op *fuseops.GetXattrOp, value []byte) error {
+	op.BytesRead = len(value)
+	if len(op.Dst) == 0 {
+		return nil
+	}
+
+	if len(op.Dst) < len(value) {
+		return syscall.ERANGE
+	}
+
+	copy(op.Dst, value)
+	return nil
+}
+
+// FillListXattr answers a fuseops.ListXattrOp with the given names, in the
+// same way as FillGetXattr.
+func FillListXattr(op *fuseops.ListXattrOp, names []string) error {
+	return fillListXattr(op, EncodeXattrNames(names))
+}
+
+func fillListXattr(op *fuseops.ListXattrOp, list []byte) error {
+	op.BytesRead = len(list)
+	if len(op.Dst) == 0 {
+		return nil
+	}
+
+	if len(op.Dst) < len(list) {
+		return syscall.ERANGE
+	}
+
+	copy(op.Dst, list)
+	return nil
+}
+
+// EncodeXattrNames returns names in the form of the list returned by
+// listxattr(2) and ListXattrOp: each followed by a NUL.
+func EncodeXattrNames(names []string) []byte {
+	var n int
+	for _, name := range names {
+		n += len(name) + 1
+	}
+
+	b := make([]byte, 0, n)
+	for _, name := range names {
+		b = append(b, name...)
+		b = append(b, 0)
+	}
+
+	return b
+}
+
+// DecodeXattrNames parses a list in the form returned by EncodeXattrNames. A
+// final name without a NUL is returned as is.
+func DecodeXattrNames(b []byte) []string {
+	var names []string
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, 0)
+		if i < 0 {
+			i = len(b)
+		}
+
+		if i > 0 {
+			names = append(names, string(b[:i]))
+		}
+
+		b = b[min(i+1, len(b)):]
+	}
+
+	return names
+}
+
+// An XattrHandler stores the extended attributes of inodes, or some of them.
+// Errors are returned to the kernel, e.g. fuse.ENOATTR for a missing
+// attribute.
+type XattrHandler interface {
+	// Return the value of the named attribute.
+	GetXattr(ctx context.Context, inode fuseops.InodeID, name string) ([]byte, error)
+
+	// Return the names of the inode's attributes.
+	ListXattr(ctx context.Context, inode fuseops.InodeID) ([]string, error)
+
+	// Set the value of the named attribute, subject to flags as in
+	// fuseops.SetXattrOp.Flags.
+	SetXattr(ctx context.Context, inode fuseops.InodeID, name string, value []byte, flags uint32) error
+
+	// Remove the named attribute.
+	RemoveXattr(ctx context.Context, inode fuseops.InodeID, name string) error
+}
+
+// An XattrMux serves the xattr ops of a FileSystem, routing each to an
+// XattrHandler by the namespace of the attribute, and taking care of the
+// protocol for asking for the size of values and lists. A file system
+// forwards its GetXattr, ListXattr, SetXattr, and RemoveXattr methods to
+// those of the XattrMux.
+//
+// ListXattr lists the names from all of the handlers, each of which should
+// list only names it is routed. A handler may appear more than once.
+type XattrMux struct {
+	// Handlers by namespace, e.g. XattrNamespaceUser.
+	Namespaces map[string]XattrHandler
+
+	// The handler for attributes in namespaces not in Namespaces, including
+	// those with no namespace, as on macOS. If nil, ops on them fail with
+	// ENOTSUP, as they do on Linux for namespaces that a file system doesn't
+	// support.
+	Default XattrHandler
+}
+
+// Return the handler for the named attribute.
+func (m *XattrMux) handler(name string) (XattrHandler, error) {
+	if h, ok := m.Namespaces[XattrNamespace(name)]; ok {
+		return h, nil
+	}
+
+	if m.Default != nil {
+		return m.Default, nil
+	}
+
+	return nil, syscall.ENOTSUP
+}
+
+func (m *XattrMux) GetXattr(
+	ctx context.Context,
+	op *fuseops.GetXattrOp) error {
+	h, err := m.handler(op.Name)
+	if err != nil {
+		return err
+	}
+
+	value, err := h.GetXattr(ctx, op.Inode, op.Name)
+	if err != nil {
+		return err
+	}
+
+	return FillGetXattr(op, value)
+}
+
+func (m *XattrMux) ListXattr(
+	ctx context.Context,
+	op *fuseops.ListXattrOp) error {
+	handlers := make([]XattrHandler, 0, len(m.Namespaces)+1)
+	for _, ns := range sortedKeys(m.Namespaces) {
+		handlers = append(handlers, m.Namespaces[ns])
+	}
+
+	if m.Default != nil {
+		handlers = append(handlers, m.Default)
+	}
+
+	var list []byte
+	seen := make(map[XattrHandler]bool)
+	for _, h := range handlers {
+		if reflect.TypeOf(h).Comparable() {
+			if seen[h] {
+				continue
+			}
+			seen[h] = true
+		}
+
+		names, err := h.ListXattr(ctx, op.Inode)
+		if err != nil {
+			return err
+		}
+
+		list = append(list, EncodeXattrNames(names)...)
+	}
+
+	return fillListXattr(op, list)
+}
+
+func (m *XattrMux) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) error {
+	h, err := m.handler(op.Name)
+	if err != nil {
+		return err
+	}
+
+	return h.SetXattr(ctx, op.Inode, op.Name, op.Value, op.Flags)
+}
+
+func (m *XattrMux) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) error {
+	h, err := m.handler(op.Name)
+	if err != nil {
+		return err
+	}
+
+	return h.RemoveXattr(ctx, op.Inode, op.Name)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// An XattrStore is an XattrHandler that keeps attributes in memory. The zero
+// value is ready to use, and an XattrStore is safe for concurrent use.
+//
+// An XattrStore stores whatever attributes it's given; use it with an
+// XattrMux to limit them to certain namespaces.
+type XattrStore struct {
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	attrs map[fuseops.InodeID]map[string][]byte
+}
+
+var _ XattrHandler = &XattrStore{}
+
+// GetXattr returns a copy of the value of the named attribute, or
+// fuse.ENOATTR if there's none.
+//
+// LOCKS_EXCLUDED(s.mu)
+func (s *XattrStore) GetXattr(
+	ctx context.Context,
+	inode fuseops.InodeID,
+	name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.attrs[inode][name]
+	if !ok {
+		return nil, fuse.ENOATTR
+	}
+
+	return bytes.Clone(value), nil
+}
+
+// ListXattr returns the names of the inode's attributes, in order.
+//
+// LOCKS_EXCLUDED(s.mu)
+func (s *XattrStore) ListXattr(
+	ctx context.Context,
+	inode fuseops.InodeID) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortedKeys(s.attrs[inode]), nil
+}
+
+// SetXattr stores a copy of the value.
+//
+// LOCKS_EXCLUDED(s.mu)
+func (s *XattrStore) SetXattr(
+	ctx context.Context,
+	inode fuseops.InodeID,
+	name string,
+	value []byte,
+	flags uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.attrs[inode][name]
+	switch {
+	case flags&XattrCreate != 0 && ok:
+		return fuse.EEXIST
+
+	case flags&XattrReplace != 0 && !ok:
+		return fuse.ENOATTR
+	}
+
+	if s.attrs == nil {
+		s.attrs = make(map[fuseops.InodeID]map[string][]byte)
+	}
+
+	if s.attrs[inode] == nil {
+		s.attrs[inode] = make(map[string][]byte)
+	}
+
+	s.attrs[inode][name] = bytes.Clone(value)
+	return nil
+}
+
+// RemoveXattr removes the named attribute, or returns fuse.ENOATTR if there's
+// none.
+//
+// LOCKS_EXCLUDED(s.mu)
+func (s *XattrStore) RemoveXattr(
+	ctx context.Context,
+	inode fuseops.InodeID,
+	name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.attrs[inode][name]; !ok {
+		return fuse.ENOATTR
+	}
+
+	delete(s.attrs[inode], name)
+	if len(s.attrs[inode]) == 0 {
+		delete(s.attrs, inode)
+	}
+
+	return nil
+}
+
+// Forget removes all of the inode's attributes, for when it's been deleted.
+//
+// LOCKS_EXCLUDED(s.mu)
+func (s *XattrStore) Forget(inode fuseops.InodeID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attrs, inode)
+}
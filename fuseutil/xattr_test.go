@@ -0,0 +1,124 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuseutil_test
+
+import (
+	"context"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+// A file system that keeps user and trusted xattrs in an XattrStore.
+type xattrFS struct {
+	fuseutil.NotImplementedFileSystem
+	store fuseutil.XattrStore
+	mux   fuseutil.XattrMux
+}
+
+func newXattrFS() *xattrFS {
+	fs := &xattrFS{}
+	fs.mux.Namespaces = map[string]fuseutil.XattrHandler{
+		fuseutil.XattrNamespaceUser:    &fs.store,
+		fuseutil.XattrNamespaceTrusted: &fs.store,
+	}
+	return fs
+}
+
+func (fs *xattrFS) GetXattr(ctx context.Context, op *fuseops.GetXattrOp) error {
+	return fs.mux.GetXattr(ctx, op)
+}
+
+func (fs *xattrFS) ListXattr(ctx context.Context, op *fuseops.ListXattrOp) error {
+	return fs.mux.ListXattr(ctx, op)
+}
+
+func (fs *xattrFS) SetXattr(ctx context.Context, op *fuseops.SetXattrOp) error {
+	return fs.mux.SetXattr(ctx, op)
+}
+
+func (fs *xattrFS) RemoveXattr(ctx context.Context, op *fuseops.RemoveXattrOp) error {
+	return fs.mux.RemoveXattr(ctx, op)
+}
+
+func TestXattrMux(t *testing.T) {
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(newXattrFS()), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	set := func(name, value string, flags uint32) error {
+		return k.Do(ctx, &fuseops.SetXattrOp{Inode: fuseops.RootInodeID, Name: name, Value: []byte(value), Flags: flags})
+	}
+
+	if err := set("user.a", "hello", fuseutil.XattrCreate); err != nil {
+		t.Fatalf("SetXattr: %v", err)
+	}
+	if err := set("trusted.b", "x", 0); err != nil {
+		t.Fatalf("SetXattr: %v", err)
+	}
+	if err := set("user.a", "again", fuseutil.XattrCreate); err != syscall.EEXIST {
+		t.Errorf("SetXattr with XattrCreate: %v, want EEXIST", err)
+	}
+	if err := set("user.c", "x", fuseutil.XattrReplace); err != fuse.ENOATTR {
+		t.Errorf("SetXattr with XattrReplace: %v, want ENOATTR", err)
+	}
+	if err := set("security.d", "x", 0); err != syscall.ENOTSUP {
+		t.Errorf("SetXattr in unrouted namespace: %v, want ENOTSUP", err)
+	}
+
+	// Ask for the size, then too little, then enough.
+	get := &fuseops.GetXattrOp{Inode: fuseops.RootInodeID, Name: "user.a"}
+	if err := k.Do(ctx, get); err != nil || get.BytesRead != 5 {
+		t.Errorf("GetXattr size: %d, %v; want 5", get.BytesRead, err)
+	}
+	get = &fuseops.GetXattrOp{Inode: fuseops.RootInodeID, Name: "user.a", Dst: make([]byte, 2)}
+	if err := k.Do(ctx, get); err != syscall.ERANGE {
+		t.Errorf("GetXattr into a short buffer: %v, want ERANGE", err)
+	}
+	get = &fuseops.GetXattrOp{Inode: fuseops.RootInodeID, Name: "user.a", Dst: make([]byte, 16)}
+	if err := k.Do(ctx, get); err != nil || string(get.Dst[:get.BytesRead]) != "hello" {
+		t.Errorf("GetXattr: %q, %v; want hello", get.Dst[:get.BytesRead], err)
+	}
+
+	// The store is routed two namespaces, but its names are listed once.
+	list := &fuseops.ListXattrOp{Inode: fuseops.RootInodeID}
+	if err := k.Do(ctx, list); err != nil {
+		t.Fatalf("ListXattr size: %v", err)
+	}
+	list.Dst = make([]byte, list.BytesRead)
+	if err := k.Do(ctx, list); err != nil {
+		t.Fatalf("ListXattr: %v", err)
+	}
+	got := fuseutil.DecodeXattrNames(list.Dst[:list.BytesRead])
+	if want := []string{"trusted.b", "user.a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListXattr %q, want %q", got, want)
+	}
+
+	if err := k.Do(ctx, &fuseops.RemoveXattrOp{Inode: fuseops.RootInodeID, Name: "user.a"}); err != nil {
+		t.Errorf("RemoveXattr: %v", err)
+	}
+	get = &fuseops.GetXattrOp{Inode: fuseops.RootInodeID, Name: "user.a"}
+	if err := k.Do(ctx, get); err != fuse.ENOATTR {
+		t.Errorf("GetXattr after removal: %v, want ENOATTR", err)
+	}
+}
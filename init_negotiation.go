@@ -0,0 +1,130 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"fmt"
+
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+// InitFlags is a set of capabilities exchanged with the kernel when mounting.
+// The lower 32 bits are the kernel's FUSE_* init flags, and the upper 32 bits
+// its extended flags, as in the kernel's own 64-bit representation.
+type InitFlags uint64
+
+// Capabilities that may be offered by the kernel and requested by the file
+// system. Most correspond to a MountConfig field, which describes them. Some
+// are only supported on Linux.
+const (
+	InitAsyncRead        = InitFlags(fusekernel.InitAsyncRead)
+	InitPosixLocks       = InitFlags(fusekernel.InitPosixLocks)
+	InitAtomicTrunc      = InitFlags(fusekernel.InitAtomicTrunc)
+	InitExportSupport    = InitFlags(fusekernel.InitExportSupport)
+	InitBigWrites        = InitFlags(fusekernel.InitBigWrites)
+	InitDontMask         = InitFlags(fusekernel.InitDontMask)
+	InitSpliceWrite      = InitFlags(fusekernel.InitSpliceWrite)
+	InitSpliceMove       = InitFlags(fusekernel.InitSpliceMove)
+	InitFlockLocks       = InitFlags(fusekernel.InitFlockLocks)
+	InitAutoInvalData    = InitFlags(fusekernel.InitAutoInvalData)
+	InitDoReaddirplus    = InitFlags(fusekernel.InitDoReaddirplus)
+	InitReaddirplusAuto  = InitFlags(fusekernel.InitReaddirplusAuto)
+	InitAsyncDIO         = InitFlags(fusekernel.InitAsyncDIO)
+	InitWritebackCache   = InitFlags(fusekernel.InitWritebackCache)
+	InitNoOpenSupport    = InitFlags(fusekernel.InitNoOpenSupport)
+	InitParallelDirOps   = InitFlags(fusekernel.InitParallelDirOps)
+	InitPosixACL         = InitFlags(fusekernel.InitPosixACL)
+	InitMaxPages         = InitFlags(fusekernel.InitMaxPages)
+	InitCacheSymlinks    = InitFlags(fusekernel.InitCacheSymlinks)
+	InitNoOpendirSupport = InitFlags(fusekernel.InitNoOpendirSupport)
+	InitHandleKillprivV2 = InitFlags(fusekernel.InitHandleKillprivV2)
+
+	InitSecurityCtx = InitFlags(fusekernel.InitSecurityCtx) << 32
+	InitPassthrough = InitFlags(fusekernel.InitPassthrough) << 32
+)
+
+func makeInitFlags(flags fusekernel.InitFlags, flags2 fusekernel.InitFlags2) InitFlags {
+	// Without InitExt, the upper half of the flags isn't exchanged.
+	if flags&fusekernel.InitExt == 0 {
+		flags2 = 0
+	}
+	return InitFlags(flags&^fusekernel.InitExt) | InitFlags(flags2)<<32
+}
+
+// Split the flags into the two halves of the init message, setting InitExt if
+// the upper half is needed.
+func (fl InitFlags) split() (fusekernel.InitFlags, fusekernel.InitFlags2) {
+	flags, flags2 := fusekernel.InitFlags(fl), fusekernel.InitFlags2(fl>>32)
+	if flags2 != 0 {
+		flags |= fusekernel.InitExt
+	}
+	return flags, flags2
+}
+
+func (fl InitFlags) String() string {
+	flags, flags2 := fl.split()
+	flags &^= fusekernel.InitExt
+	switch {
+	case flags2 == 0:
+		return flags.String()
+	case flags == 0:
+		return flags2.String()
+	}
+	return flags.String() + "+" + flags2.String()
+}
+
+// InitNegotiation describes the capabilities negotiated with the kernel when
+// mounting. It is passed to MountConfig.Configure, which may change the
+// capabilities requested.
+type InitNegotiation struct {
+	// The version of the FUSE protocol spoken by the kernel, e.g. 7 and 38.
+	KernelMajor uint32
+	KernelMinor uint32
+
+	// The capabilities offered by the kernel.
+	KernelFlags InitFlags
+
+	// The capabilities to request, as chosen from the other MountConfig
+	// fields. Configure may clear flags to do without those capabilities, and
+	// set flags in KernelFlags to request others; flags that the kernel didn't
+	// offer are ignored. The file system must be prepared for the ops that
+	// each capability implies.
+	Flags InitFlags
+}
+
+// Let the file system adjust the flags about to be sent in reply to the init
+// op. Returns the flags to send.
+func (c *Connection) configureInit(
+	initOp *initOp,
+	kernelFlags InitFlags) (InitFlags, error) {
+	flags := makeInitFlags(initOp.Flags, initOp.Flags2)
+	if c.cfg.Configure == nil {
+		return flags, nil
+	}
+
+	n := &InitNegotiation{
+		KernelMajor: initOp.Kernel.Major,
+		KernelMinor: initOp.Kernel.Minor,
+		KernelFlags: kernelFlags,
+		Flags:       flags,
+	}
+	if err := c.cfg.Configure(n); err != nil {
+		return 0, fmt.Errorf("Configure: %w", err)
+	}
+
+	// Flags that we request regardless of what the kernel offers, such as
+	// InitBigWrites, may also be kept.
+	return n.Flags & (kernelFlags | flags), nil
+}
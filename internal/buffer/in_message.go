@@ -47,9 +47,10 @@ func GetPageSize() int {
 // struct. Provides storage for messages and convenient access to their
 // contents.
 type InMessage struct {
-	remaining []byte
-	storage   []byte
-	size      int
+	remaining  []byte
+	extensions []byte
+	storage    []byte
+	size       int
 }
 
 // NewInMessage creates a new InMessage with its storage initialized.
@@ -59,6 +60,20 @@ func NewInMessage() *InMessage {
 	}
 }
 
+// NewInMessageSize creates a new InMessage with room for a request carrying
+// up to maxPayload bytes of data, such as a write request of that size.
+func NewInMessageSize(maxPayload int) *InMessage {
+	return &InMessage{
+		storage: make([]byte, pageSize+maxPayload),
+	}
+}
+
+// MaxPayload returns the amount of data that the message has room for, as
+// passed to NewInMessageSize.
+func (m *InMessage) MaxPayload() int {
+	return len(m.storage) - pageSize
+}
+
 var readLock sync.Mutex
 
 func (m *InMessage) ReadSingle(r io.Reader) (int, error) {
@@ -112,14 +127,38 @@ func (m *InMessage) Init(r io.Reader) error {
 			n)
 	}
 
+	// Set aside any extensions, which follow the request's arguments.
+	extLen := int(m.Header().TotalExtlen) * 8
+	if extLen > len(m.remaining) {
+		return fmt.Errorf(
+			"Header says %d bytes of extensions, but only %d follow it",
+			extLen,
+			len(m.remaining))
+	}
+
+	split := len(m.remaining) - extLen
+	m.remaining, m.extensions = m.remaining[:split], m.remaining[split:]
+
 	return nil
 }
 
+// Return the extensions that followed the arguments of the request read in
+// the most recent call to Init, which Consume and ConsumeBytes don't return.
+func (m *InMessage) Extensions() []byte {
+	return m.extensions
+}
+
 // Return a reference to the header read in the most recent call to Init.
 func (m *InMessage) Header() *fusekernel.InHeader {
 	return (*fusekernel.InHeader)(unsafe.Pointer(&m.storage[0]))
 }
 
+// Return the bytes of the message read in the most recent call to Init,
+// including its header.
+func (m *InMessage) Bytes() []byte {
+	return m.storage[:m.size]
+}
+
 // Return the number of bytes left to consume.
 func (m *InMessage) Len() uintptr {
 	return uintptr(len(m.remaining))
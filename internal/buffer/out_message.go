@@ -34,13 +34,23 @@ const OutMessageHeaderSize = int(unsafe.Sizeof(fusekernel.OutHeader{}))
 type OutMessage struct {
 	header fusekernel.OutHeader
 	Sglist [][]byte
+
+	// Pooled buffers handed out by Grow, to be returned by Reset.
+	pooled []*[]byte
 }
 
 // Reset resets m so that it's ready to be used again. Afterward, the contents
-// are solely a zeroed fusekernel.OutHeader struct.
+// are solely a zeroed fusekernel.OutHeader struct. The memory returned by
+// previous calls to Grow must no longer be used.
 func (m *OutMessage) Reset() {
 	m.header = fusekernel.OutHeader{}
 	m.Sglist = nil
+
+	for i, p := range m.pooled {
+		putBuffer(p)
+		m.pooled[i] = nil
+	}
+	m.pooled = m.pooled[:0]
 }
 
 // OutHeader returns a pointer to the header at the start of the message.
@@ -49,9 +59,13 @@ func (m *OutMessage) OutHeader() *fusekernel.OutHeader {
 }
 
 // Grow adds a new buffer of <n> bytes to the message, returning a pointer to
-// the start of the new segment, which is guaranteed to be zeroed.
+// the start of the new segment, which is guaranteed to be zeroed. The buffer
+// remains valid until the next call to Reset.
 func (m *OutMessage) Grow(n int) unsafe.Pointer {
-	b := make([]byte, n)
+	b, pooled := getBuffer(n)
+	if pooled != nil {
+		m.pooled = append(m.pooled, pooled)
+	}
 	m.Append(b)
 	p := unsafe.Pointer(&b[0])
 	return p
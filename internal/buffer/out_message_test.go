@@ -321,3 +321,50 @@ func BenchmarkOutMessageGrowShrink(b *testing.B) {
 		b.SetBytes(int64(MaxReadSize))
 	})
 }
+
+func TestOutMessageGrowReusesBuffers(t *testing.T) {
+	var om OutMessage
+	om.Reset()
+
+	// Dirty a buffer and give it back to the pool.
+	const payloadSize = 1000
+	p := om.Grow(payloadSize)
+	if err := fillWithGarbage(p, payloadSize); err != nil {
+		t.Fatalf("fillWithGarbage: %v", err)
+	}
+	om.Reset()
+
+	// Whether or not the buffer is reused, it must come back zeroed.
+	for i := 0; i < 10; i++ {
+		p := om.Grow(payloadSize)
+		if off := findNonZero(p, payloadSize); off != payloadSize {
+			t.Fatalf("non-zero byte at payload offset %d", off)
+		}
+		om.Reset()
+	}
+
+	// Buffers too large to pool still work.
+	if p := om.Grow(maxPooledSize + 1); findNonZero(p, maxPooledSize+1) != maxPooledSize+1 {
+		t.Fatal("non-zero byte in large buffer")
+	}
+}
+
+func TestSizeClass(t *testing.T) {
+	testCases := []struct {
+		n    int
+		want int
+	}{
+		{1, 0},
+		{minPooledSize, 0},
+		{minPooledSize + 1, 1},
+		{2 * minPooledSize, 1},
+		{maxPooledSize, len(pools) - 1},
+		{maxPooledSize + 1, -1},
+	}
+
+	for _, tc := range testCases {
+		if got := sizeClass(tc.n); got != tc.want {
+			t.Errorf("sizeClass(%d) = %d, want %d", tc.n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffer
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// The buffers handed out by OutMessage.Grow come from pools of power-of-two
+// sizes, from minPooledSize to maxPooledSize bytes, and are returned to them
+// when the message is reset, so that replies such as directory listings don't
+// cost an allocation per op. Larger buffers are allocated afresh.
+const (
+	minPooledShift = 8
+	maxPooledShift = 21
+
+	minPooledSize = 1 << minPooledShift
+	maxPooledSize = 1 << maxPooledShift
+)
+
+// The pools, indexed by size class. Each holds *[]byte with a length equal to
+// the size of the class.
+var pools [maxPooledShift - minPooledShift + 1]sync.Pool
+
+// Return the size class for a buffer of n bytes, or -1 if it is too large to
+// be pooled.
+func sizeClass(n int) int {
+	if n > maxPooledSize {
+		return -1
+	}
+
+	if n <= minPooledSize {
+		return 0
+	}
+
+	return bits.Len(uint(n-1)) - minPooledShift
+}
+
+// Get a zeroed buffer of n bytes. If the result is non-nil, it is a pooled
+// buffer of which the first n bytes are to be used, and which must be handed
+// to putBuffer when no longer needed.
+func getBuffer(n int) ([]byte, *[]byte) {
+	class := sizeClass(n)
+	if class < 0 {
+		return make([]byte, n), nil
+	}
+
+	p, _ := pools[class].Get().(*[]byte)
+	if p == nil {
+		b := make([]byte, 1<<(class+minPooledShift))
+		return b[:n], &b
+	}
+
+	b := (*p)[:n]
+	clear(b)
+	return b, p
+}
+
+// Return a buffer obtained from getBuffer to its pool.
+func putBuffer(p *[]byte) {
+	pools[sizeClass(len(*p))].Put(p)
+}
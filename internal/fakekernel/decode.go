@@ -0,0 +1,279 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakekernel
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+// Interpret the first bytes of a reply payload as a kernel struct.
+func consume[T any](payload []byte) (*T, []byte, error) {
+	var zero T
+	n := int(unsafe.Sizeof(zero))
+	if len(payload) < n {
+		return nil, nil, fmt.Errorf("short %T: %d bytes", zero, len(payload))
+	}
+
+	// Copy, since the payload need not be suitably aligned.
+	out := new(T)
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(out)), n), payload)
+	return out, payload[n:], nil
+}
+
+// Fill in the output fields of an op from the payload of a successful reply,
+// inverting kernelResponseForOp in the fuse package.
+func decodeReply(op interface{}, payload []byte) error {
+	switch o := op.(type) {
+	case *fuseops.LookUpInodeOp:
+		return decodeEntry(&o.Entry, payload)
+
+	case *fuseops.MkDirOp:
+		return decodeEntry(&o.Entry, payload)
+
+	case *fuseops.MkNodeOp:
+		return decodeEntry(&o.Entry, payload)
+
+	case *fuseops.CreateSymlinkOp:
+		return decodeEntry(&o.Entry, payload)
+
+	case *fuseops.CreateLinkOp:
+		return decodeEntry(&o.Entry, payload)
+
+	case *fuseops.CreateFileOp:
+		e, rest, err := consume[fusekernel.EntryOut](payload)
+		if err != nil {
+			return err
+		}
+		convertEntryOut(e, &o.Entry)
+
+		oo, _, err := consume[fusekernel.OpenOut](rest)
+		if err != nil {
+			return err
+		}
+		o.Handle = fuseops.HandleID(oo.Fh)
+		o.ResponseFlags = responseFlags(oo.OpenFlags)
+		if fusekernel.OpenResponseFlags(oo.OpenFlags)&fusekernel.OpenPassthrough != 0 {
+			o.BackingID = fuseops.BackingID(oo.BackingID)
+		}
+
+	case *fuseops.CreateTmpFileOp:
+		e, rest, err := consume[fusekernel.EntryOut](payload)
+		if err != nil {
+			return err
+		}
+		convertEntryOut(e, &o.Entry)
+
+		oo, _, err := consume[fusekernel.OpenOut](rest)
+		if err != nil {
+			return err
+		}
+		o.Handle = fuseops.HandleID(oo.Fh)
+		o.ResponseFlags = responseFlags(oo.OpenFlags)
+
+	case *fuseops.GetInodeAttributesOp:
+		out, _, err := consume[fusekernel.AttrOut](payload)
+		if err != nil {
+			return err
+		}
+		o.Attributes = convertAttr(&out.Attr)
+		o.AttributesExpiration = expiration(out.AttrValid, out.AttrValidNsec)
+
+	case *fuseops.StatxOp:
+		out, _, err := consume[fusekernel.StatxOut](payload)
+		if err != nil {
+			return err
+		}
+		o.Attributes = convertStatx(&out.Stat)
+		o.AttributesExpiration = expiration(out.AttrValid, out.AttrValidNsec)
+		o.StatxAttributes = out.Stat.Attributes
+		o.StatxAttributesMask = out.Stat.AttributesMask
+
+	case *fuseops.SetInodeAttributesOp:
+		out, _, err := consume[fusekernel.AttrOut](payload)
+		if err != nil {
+			return err
+		}
+		o.Attributes = convertAttr(&out.Attr)
+		o.AttributesExpiration = expiration(out.AttrValid, out.AttrValidNsec)
+
+	case *fuseops.OpenFileOp:
+		out, _, err := consume[fusekernel.OpenOut](payload)
+		if err != nil {
+			return err
+		}
+		flags := fusekernel.OpenResponseFlags(out.OpenFlags)
+		o.Handle = fuseops.HandleID(out.Fh)
+		o.KeepPageCache = flags&fusekernel.OpenKeepCache != 0
+		o.UseDirectIO = flags&fusekernel.OpenDirectIO != 0
+		o.ResponseFlags = responseFlags(out.OpenFlags)
+		if flags&fusekernel.OpenPassthrough != 0 {
+			o.BackingID = fuseops.BackingID(out.BackingID)
+		}
+
+	case *fuseops.OpenDirOp:
+		out, _, err := consume[fusekernel.OpenOut](payload)
+		if err != nil {
+			return err
+		}
+		flags := fusekernel.OpenResponseFlags(out.OpenFlags)
+		o.Handle = fuseops.HandleID(out.Fh)
+		o.CacheDir = flags&fusekernel.OpenCacheDir != 0
+		o.KeepCache = flags&fusekernel.OpenKeepCache != 0
+		o.ResponseFlags = responseFlags(out.OpenFlags)
+
+	case *fuseops.ReadFileOp:
+		if o.Dst == nil {
+			o.Dst = make([]byte, len(payload))
+		}
+		o.BytesRead = copy(o.Dst, payload)
+
+	case *fuseops.ReadDirOp:
+		o.BytesRead = copy(o.Dst, payload)
+
+	case *fuseops.ReadDirPlusOp:
+		o.BytesRead = copy(o.Dst, payload)
+
+	case *fuseops.ReadSymlinkOp:
+		o.Target = string(payload)
+
+	case *fuseops.StatFSOp:
+		out, _, err := consume[fusekernel.StatfsOut](payload)
+		if err != nil {
+			return err
+		}
+		o.Blocks = out.St.Blocks
+		o.BlocksFree = out.St.Bfree
+		o.BlocksAvailable = out.St.Bavail
+		o.Inodes = out.St.Files
+		o.InodesFree = out.St.Ffree
+		o.IoSize = out.St.Bsize
+		o.BlockSize = out.St.Frsize
+		o.NameMaxLength = out.St.Namelen
+
+	case *fuseops.PollOp:
+		out, _, err := consume[fusekernel.PollOut](payload)
+		if err != nil {
+			return err
+		}
+		o.Revents = out.Revents
+
+	case *fuseops.SeekFileOp:
+		out, _, err := consume[fusekernel.LseekOut](payload)
+		if err != nil {
+			return err
+		}
+		o.ResultOffset = int64(out.Offset)
+
+	case *fuseops.CopyFileRangeOp:
+		out, _, err := consume[fusekernel.WriteOut](payload)
+		if err != nil {
+			return err
+		}
+		o.BytesCopied = uint64(out.Size)
+
+	case *fuseops.GetXattrOp:
+		return decodeXattr(o.Dst, &o.BytesRead, payload)
+
+	case *fuseops.ListXattrOp:
+		return decodeXattr(o.Dst, &o.BytesRead, payload)
+	}
+
+	return nil
+}
+
+func decodeEntry(entry *fuseops.ChildInodeEntry, payload []byte) error {
+	out, _, err := consume[fusekernel.EntryOut](payload)
+	if err != nil {
+		return err
+	}
+
+	convertEntryOut(out, entry)
+	return nil
+}
+
+// A zero-length destination is a request for the size of the value.
+func decodeXattr(dst []byte, bytesRead *int, payload []byte) error {
+	if len(dst) == 0 {
+		out, _, err := consume[fusekernel.GetxattrOut](payload)
+		if err != nil {
+			return err
+		}
+		*bytesRead = int(out.Size)
+		return nil
+	}
+
+	*bytesRead = copy(dst, payload)
+	return nil
+}
+
+func convertEntryOut(in *fusekernel.EntryOut, out *fuseops.ChildInodeEntry) {
+	out.Child = fuseops.InodeID(in.Nodeid)
+	out.Generation = fuseops.GenerationNumber(in.Generation)
+	out.Attributes = convertAttr(&in.Attr)
+	out.AttributesExpiration = expiration(in.AttrValid, in.AttrValidNsec)
+	out.EntryExpiration = expiration(in.EntryValid, in.EntryValidNsec)
+}
+
+func convertAttr(in *fusekernel.Attr) fuseops.InodeAttributes {
+	return fuseops.InodeAttributes{
+		Size:  in.Size,
+		Nlink: in.Nlink,
+		Mode:  fuse.ConvertFileMode(in.Mode),
+		Rdev:  in.Rdev,
+		Atime: time.Unix(int64(in.Atime), int64(in.AtimeNsec)),
+		Mtime: time.Unix(int64(in.Mtime), int64(in.MtimeNsec)),
+		Ctime: time.Unix(int64(in.Ctime), int64(in.CtimeNsec)),
+		Uid:   in.Uid,
+		Gid:   in.Gid,
+	}
+}
+
+func convertStatx(in *fusekernel.Statx) fuseops.InodeAttributes {
+	attrs := fuseops.InodeAttributes{
+		Size:  in.Size,
+		Nlink: in.Nlink,
+		Mode:  fuse.ConvertFileMode(uint32(in.Mode)),
+		Rdev:  (in.RdevMajor&0xfff)<<8 | (in.RdevMinor & 0xff) | (in.RdevMinor&^0xff)<<12,
+		Atime: time.Unix(in.Atime.Sec, int64(in.Atime.Nsec)),
+		Mtime: time.Unix(in.Mtime.Sec, int64(in.Mtime.Nsec)),
+		Ctime: time.Unix(in.Ctime.Sec, int64(in.Ctime.Nsec)),
+		Uid:   in.Uid,
+		Gid:   in.Gid,
+	}
+	if in.Mask&fusekernel.StatxBtime != 0 {
+		attrs.Crtime = time.Unix(in.Btime.Sec, int64(in.Btime.Nsec))
+	}
+	return attrs
+}
+
+// Convert a relative cache validity period to an absolute expiration time.
+func expiration(secs uint64, nsecs uint32) time.Time {
+	if secs == 0 && nsecs == 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(time.Duration(secs)*time.Second + time.Duration(nsecs))
+}
+
+// Extract the flags of an OpenOut that the server sets from ResponseFlags.
+func responseFlags(openFlags uint32) fuseops.OpenResponseFlags {
+	return fuseops.OpenResponseFlags(fusekernel.OpenResponseFlags(openFlags) &^ fusekernel.OpenPassthrough)
+}
@@ -0,0 +1,413 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakekernel
+
+import (
+	"fmt"
+	"math"
+	"unsafe"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+	"golang.org/x/sys/unix"
+)
+
+// A request ready to be sent to the server, minus its unique ID.
+type request struct {
+	opcode  uint32
+	nodeid  uint64
+	opCtx   fuseops.OpContext
+	body    []byte
+	ext     []byte
+	noReply bool
+}
+
+// Append a NUL-terminated string to a message body.
+func appendName(b []byte, s string) []byte {
+	return append(append(b, s...), 0)
+}
+
+// Pad b with zeroes to a multiple of 8 bytes, as extensions must be.
+func pad8(b []byte) []byte {
+	return append(b, make([]byte, -len(b)&7)...)
+}
+
+// Encode the extension carrying the supplied security contexts, if any.
+func encodeSecurityContexts(ctxs []fuseops.SecurityContext) []byte {
+	if len(ctxs) == 0 {
+		return nil
+	}
+
+	var recs []byte
+	for _, c := range ctxs {
+		recs = append(recs, structBytes(&fusekernel.Secctx{Size: uint32(len(c.Value))})...)
+		recs = pad8(append(appendName(recs, c.Name), c.Value...))
+	}
+
+	sh := fusekernel.SecctxHeader{
+		Size:     uint32(int(unsafe.Sizeof(fusekernel.SecctxHeader{})) + len(recs)),
+		NrSecctx: uint32(len(ctxs)),
+	}
+	payload := append(structBytes(&sh), recs...)
+
+	h := fusekernel.ExtHeader{
+		Size: uint32(int(unsafe.Sizeof(fusekernel.ExtHeader{})) + len(payload)),
+		Type: fusekernel.ExtSecctx,
+	}
+	return append(structBytes(&h), payload...)
+}
+
+// Encode an op the way the kernel would, inverting convertInMessage in the
+// fuse package.
+func encodeOp(op interface{}) (*request, error) {
+	var r request
+	switch o := op.(type) {
+	case *fuseops.LookUpInodeOp:
+		r = request{opcode: fusekernel.OpLookup, nodeid: uint64(o.Parent), opCtx: o.OpContext}
+		r.body = appendName(nil, o.Name)
+
+	case *fuseops.GetInodeAttributesOp:
+		r = request{opcode: fusekernel.OpGetattr, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+
+		var in fusekernel.GetattrIn
+		if o.Handle != nil {
+			in.GetattrFlags = uint32(fusekernel.GetattrFh)
+			in.Fh = uint64(*o.Handle)
+		}
+		r.body = structBytes(&in)
+
+	case *fuseops.StatxOp:
+		r = request{opcode: fusekernel.OpStatx, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+
+		in := fusekernel.StatxIn{SxFlags: o.Flags, SxMask: o.Mask}
+		if o.Handle != nil {
+			in.GetattrFlags = uint32(fusekernel.GetattrFh)
+			in.Fh = uint64(*o.Handle)
+		}
+		r.body = structBytes(&in)
+
+	case *fuseops.SetInodeAttributesOp:
+		r = request{opcode: fusekernel.OpSetattr, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+
+		var in fusekernel.SetattrIn
+		var valid fusekernel.SetattrValid
+		if o.Uid != nil {
+			valid |= fusekernel.SetattrUid
+			in.Uid = *o.Uid
+		}
+		if o.Gid != nil {
+			valid |= fusekernel.SetattrGid
+			in.Gid = *o.Gid
+		}
+		if o.Size != nil {
+			valid |= fusekernel.SetattrSize
+			in.Size = *o.Size
+		}
+		if o.Mode != nil {
+			valid |= fusekernel.SetattrMode
+			in.Mode = fuse.ConvertGoMode(*o.Mode)
+		}
+		if o.Atime != nil {
+			valid |= fusekernel.SetattrAtime
+			in.Atime = uint64(o.Atime.Unix())
+			in.AtimeNsec = uint32(o.Atime.Nanosecond())
+		}
+		if o.Mtime != nil {
+			valid |= fusekernel.SetattrMtime
+			in.Mtime = uint64(o.Mtime.Unix())
+			in.MtimeNsec = uint32(o.Mtime.Nanosecond())
+		}
+		if o.Handle != nil {
+			valid |= fusekernel.SetattrHandle
+			in.Fh = uint64(*o.Handle)
+		}
+		if o.KillSuidGid {
+			valid |= fusekernel.SetattrKillSuidgid
+		}
+
+		in.Valid = uint32(valid)
+		r.body = structBytes(&in)
+
+	case *fuseops.ForgetInodeOp:
+		r = request{opcode: fusekernel.OpForget, nodeid: uint64(o.Inode), opCtx: o.OpContext, noReply: true}
+		r.body = structBytes(&fusekernel.ForgetIn{Nlookup: o.N})
+
+	case *fuseops.BatchForgetOp:
+		r = request{opcode: fusekernel.OpBatchForget, opCtx: o.OpContext, noReply: true}
+		r.body = structBytes(&fusekernel.BatchForgetCountIn{Count: uint32(len(o.Entries))})
+		for _, e := range o.Entries {
+			r.body = append(r.body, structBytes(&fusekernel.BatchForgetEntryIn{
+				Inode:   int64(e.Inode),
+				Nlookup: e.N,
+			})...)
+		}
+
+	case *fuseops.MkDirOp:
+		r = request{opcode: fusekernel.OpMkdir, nodeid: uint64(o.Parent), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.MkdirIn{Mode: fuse.ConvertGoMode(o.Mode), Umask: uint32(o.Umask)})
+		r.body = appendName(r.body, o.Name)
+		r.ext = encodeSecurityContexts(o.SecurityContexts)
+
+	case *fuseops.MkNodeOp:
+		r = request{opcode: fusekernel.OpMknod, nodeid: uint64(o.Parent), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.MknodIn{Mode: fuse.ConvertGoMode(o.Mode), Rdev: o.Rdev, Umask: uint32(o.Umask)})
+		r.body = appendName(r.body, o.Name)
+		r.ext = encodeSecurityContexts(o.SecurityContexts)
+
+	case *fuseops.CreateFileOp:
+		r = request{opcode: fusekernel.OpCreate, nodeid: uint64(o.Parent), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.CreateIn{
+			Flags: uint32(o.OpenFlags),
+			Mode:  fuse.ConvertGoMode(o.Mode),
+			Umask: uint32(o.Umask),
+		})
+		r.body = appendName(r.body, o.Name)
+		r.ext = encodeSecurityContexts(o.SecurityContexts)
+
+	case *fuseops.CreateTmpFileOp:
+		r = request{opcode: fusekernel.OpTmpfile, nodeid: uint64(o.Parent), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.CreateIn{
+			Flags: uint32(o.OpenFlags),
+			Mode:  fuse.ConvertGoMode(o.Mode),
+			Umask: uint32(o.Umask),
+		})
+		r.body = appendName(r.body, "/")
+		r.ext = encodeSecurityContexts(o.SecurityContexts)
+
+	case *fuseops.CreateSymlinkOp:
+		r = request{opcode: fusekernel.OpSymlink, nodeid: uint64(o.Parent), opCtx: o.OpContext}
+		r.body = appendName(appendName(nil, o.Name), o.Target)
+		r.ext = encodeSecurityContexts(o.SecurityContexts)
+
+	case *fuseops.CreateLinkOp:
+		r = request{opcode: fusekernel.OpLink, nodeid: uint64(o.Parent), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.LinkIn{Oldnodeid: uint64(o.Target)})
+		r.body = appendName(r.body, o.Name)
+
+	case *fuseops.RenameOp:
+		// As with the real kernel, only renames with flags use RENAME2.
+		r = request{opcode: fusekernel.OpRename, nodeid: uint64(o.OldParent), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.RenameIn{Newdir: uint64(o.NewParent)})
+		if o.Flags != 0 {
+			r.opcode = fusekernel.OpRename2
+			r.body = structBytes(&fusekernel.Rename2In{Newdir: uint64(o.NewParent), Flags: uint32(o.Flags)})
+		}
+		r.body = appendName(appendName(r.body, o.OldName), o.NewName)
+
+	case *fuseops.UnlinkOp:
+		r = request{opcode: fusekernel.OpUnlink, nodeid: uint64(o.Parent), opCtx: o.OpContext}
+		r.body = appendName(nil, o.Name)
+
+	case *fuseops.RmDirOp:
+		r = request{opcode: fusekernel.OpRmdir, nodeid: uint64(o.Parent), opCtx: o.OpContext}
+		r.body = appendName(nil, o.Name)
+
+	case *fuseops.OpenFileOp:
+		r = request{opcode: fusekernel.OpOpen, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		in := fusekernel.OpenIn{Flags: uint32(o.OpenFlags)}
+		if o.KillSuidGid {
+			in.OpenFlags = fusekernel.OpenInKillSuidgid
+		}
+		r.body = structBytes(&in)
+
+	case *fuseops.OpenDirOp:
+		r = request{opcode: fusekernel.OpOpendir, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.OpenIn{})
+
+	case *fuseops.ReadFileOp:
+		size := o.Size
+		if size == 0 {
+			size = int64(len(o.Dst))
+		}
+		if size > MaxMessageSize {
+			return nil, fmt.Errorf("read of %d bytes exceeds the maximum of %d", size, MaxMessageSize)
+		}
+
+		r = request{opcode: fusekernel.OpRead, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.ReadIn{
+			Fh:     uint64(o.Handle),
+			Offset: uint64(o.Offset),
+			Size:   uint32(size),
+		})
+
+	case *fuseops.ReadDirOp:
+		r = request{opcode: fusekernel.OpReaddir, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.ReadIn{
+			Fh:     uint64(o.Handle),
+			Offset: uint64(o.Offset),
+			Size:   uint32(len(o.Dst)),
+		})
+
+	case *fuseops.ReadDirPlusOp:
+		r = request{opcode: fusekernel.OpReaddirplus, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.ReadIn{
+			Fh:     uint64(o.Handle),
+			Offset: uint64(o.Offset),
+			Size:   uint32(len(o.Dst)),
+		})
+
+	case *fuseops.ReleaseFileHandleOp:
+		in := fusekernel.ReleaseIn{Fh: uint64(o.Handle), LockOwner: o.LockOwner}
+		if o.FlockUnlock {
+			in.ReleaseFlags |= uint32(fusekernel.ReleaseFlockUnlock)
+		}
+
+		r = request{opcode: fusekernel.OpRelease, opCtx: o.OpContext}
+		r.body = structBytes(&in)
+
+	case *fuseops.ReleaseDirHandleOp:
+		r = request{opcode: fusekernel.OpReleasedir, opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.ReleaseIn{Fh: uint64(o.Handle)})
+
+	case *fuseops.WriteFileOp:
+		if len(o.Data) > MaxMessageSize {
+			return nil, fmt.Errorf("write of %d bytes exceeds the maximum of %d", len(o.Data), MaxMessageSize)
+		}
+
+		in := fusekernel.WriteIn{
+			Fh:         uint64(o.Handle),
+			Offset:     uint64(o.Offset),
+			Size:       uint32(len(o.Data)),
+			WriteFlags: uint32(o.Flags),
+			Flags:      uint32(o.OpenFlags),
+		}
+		if o.KillSuidGid {
+			in.WriteFlags |= uint32(fusekernel.WriteKillSuidgid)
+		}
+
+		r = request{opcode: fusekernel.OpWrite, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = append(structBytes(&in), o.Data...)
+
+	case *fuseops.SyncFileOp:
+		r = request{opcode: fusekernel.OpFsync, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.FsyncIn{Fh: uint64(o.Handle)})
+
+	case *fuseops.SyncFSOp:
+		r = request{opcode: fusekernel.OpSyncFS, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.SyncFSIn{})
+
+	case *fuseops.FlushFileOp:
+		r = request{opcode: fusekernel.OpFlush, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.FlushIn{Fh: uint64(o.Handle), LockOwner: o.LockOwner})
+
+	case *fuseops.ReadSymlinkOp:
+		r = request{opcode: fusekernel.OpReadlink, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+
+	case *fuseops.StatFSOp:
+		r = request{opcode: fusekernel.OpStatfs, nodeid: uint64(fuseops.RootInodeID)}
+
+	case *fuseops.RemoveXattrOp:
+		r = request{opcode: fusekernel.OpRemovexattr, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = appendName(nil, o.Name)
+
+	case *fuseops.GetXattrOp:
+		var in fusekernel.GetxattrIn
+		in.Size = uint32(len(o.Dst))
+
+		r = request{opcode: fusekernel.OpGetxattr, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = appendName(structBytes(&in), o.Name)
+
+	case *fuseops.ListXattrOp:
+		r = request{opcode: fusekernel.OpListxattr, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.ListxattrIn{Size: uint32(len(o.Dst))})
+
+	case *fuseops.SetXattrOp:
+		var in fusekernel.SetxattrIn
+		in.Size = uint32(len(o.Value))
+		in.Flags = o.Flags
+
+		r = request{opcode: fusekernel.OpSetxattr, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = append(appendName(structBytes(&in), o.Name), o.Value...)
+
+	case *fuseops.FallocateOp:
+		r = request{opcode: fusekernel.OpFallocate, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.FallocateIn{
+			Fh:     uint64(o.Handle),
+			Offset: o.Offset,
+			Length: o.Length,
+			Mode:   uint32(o.Mode),
+		})
+
+	case *fuseops.FlockOp:
+		in := fusekernel.LkIn{
+			Fh:      uint64(o.Handle),
+			Owner:   o.Owner,
+			LkFlags: fusekernel.LkFlock,
+		}
+		in.Lk.End = math.MaxInt64
+		switch o.Operation {
+		case unix.LOCK_SH:
+			in.Lk.Type = fusekernel.LockRead
+		case unix.LOCK_EX:
+			in.Lk.Type = fusekernel.LockWrite
+		default:
+			in.Lk.Type = fusekernel.LockUnlock
+		}
+
+		r = request{opcode: fusekernel.OpSetlk, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		if o.Block {
+			r.opcode = fusekernel.OpSetlkw
+		}
+		r.body = structBytes(&in)
+
+	case *fuseops.PollOp:
+		in := fusekernel.PollIn{
+			Fh:     uint64(o.Handle),
+			Kh:     o.PollHandle,
+			Events: o.Events,
+		}
+		if o.ScheduleNotify {
+			in.Flags |= fusekernel.PollScheduleNotify
+		}
+
+		r = request{opcode: fusekernel.OpPoll, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = structBytes(&in)
+
+	case *fuseops.DestroyOp:
+		r = request{opcode: fusekernel.OpDestroy, opCtx: o.OpContext}
+
+	case *fuseops.AccessOp:
+		r = request{opcode: fusekernel.OpAccess, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.AccessIn{Mask: o.Mask})
+
+	case *fuseops.SeekFileOp:
+		r = request{opcode: fusekernel.OpLseek, nodeid: uint64(o.Inode), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.LseekIn{
+			Fh:     uint64(o.Handle),
+			Offset: uint64(o.Offset),
+			Whence: uint32(o.Whence),
+		})
+
+	case *fuseops.CopyFileRangeOp:
+		r = request{opcode: fusekernel.OpCopyFileRange, nodeid: uint64(o.SrcInode), opCtx: o.OpContext}
+		r.body = structBytes(&fusekernel.CopyFileRangeIn{
+			FhIn:      uint64(o.SrcHandle),
+			OffIn:     o.SrcOffset,
+			NodeidOut: uint64(o.DstInode),
+			FhOut:     uint64(o.DstHandle),
+			OffOut:    o.DstOffset,
+			Len:       o.Length,
+			Flags:     o.Flags,
+		})
+
+	default:
+		return nil, fmt.Errorf("unsupported op type %T", op)
+	}
+
+	// structBytes aliases its argument; copy so that the body owns its memory.
+	r.body = append([]byte(nil), r.body...)
+	return &r, nil
+}
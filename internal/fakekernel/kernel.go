@@ -0,0 +1,396 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakekernel plays the part of the kernel in the FUSE protocol, so
+// that a fuse.Server can be driven in-process without mounting anything.
+//
+// Ops are supplied as fuseops structs, encoded into the messages that the
+// kernel would send, and handed to the server over a socket pair that stands
+// in for /dev/fuse. The server's replies are decoded back into the output
+// fields of the same structs.
+package fakekernel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+// The largest message that may be exchanged with the server, in either
+// direction. Reads, writes, and directory reads larger than this fail.
+const MaxMessageSize = 1 << 20
+
+// The protocol version announced to the server. This is newer than the
+// server speaks, so that it offers features such as security contexts that
+// are only understood in their current format.
+var protocol = fusekernel.Protocol{
+	Major: fusekernel.ProtoVersionMaxMajor,
+	Minor: 38,
+}
+
+// The second set of INIT flags offered to the server.
+const initFlags2 = fusekernel.InitSecurityCtx
+
+// ErrClosed is returned by Do after Close has been called, or after the
+// server has hung up.
+var ErrClosed = errors.New("fake kernel connection is closed")
+
+// A Kernel is a connection to a fuse.Server that is being driven in-process.
+// Its methods may be called concurrently.
+type Kernel struct {
+	dev *os.File
+	mfs *fuse.MountedFileSystem
+
+	// Whether the goroutine reading replies has been started, and a channel
+	// that is closed when it has exited.
+	readerStarted bool
+	readerDone    chan struct{}
+
+	// Notifications from the server, delivered by the goroutine reading
+	// replies and closed when it exits.
+	notifications chan Notification
+
+	mu sync.Mutex
+
+	// The unique ID to use for the next request.
+	//
+	// GUARDED_BY(mu)
+	nextUnique uint64
+
+	// Channels on which to deliver the replies to in-flight requests, keyed by
+	// unique ID.
+	//
+	// GUARDED_BY(mu)
+	pending map[uint64]chan []byte
+
+	// Set once the connection has been closed, for any reason.
+	//
+	// GUARDED_BY(mu)
+	closed bool
+}
+
+// The number of notifications that are buffered before further ones are
+// discarded.
+const notificationBuffer = 64
+
+// A Notification is an unsolicited message from the server to the kernel, such
+// as those sent by fuse.Notifier.
+type Notification struct {
+	// One of the fusekernel.NotifyCode constants, e.g. NotifyCodePoll.
+	Code int32
+
+	// The body of the message, following the header.
+	Payload []byte
+}
+
+// Start serves a connection with the supplied server, performing the INIT
+// handshake before returning. The config is treated as Mount would treat it;
+// it may be nil.
+//
+// Close must eventually be called to shut down the server.
+func Start(server fuse.Server, cfg *fuse.MountConfig) (*Kernel, error) {
+	if cfg == nil {
+		cfg = &fuse.MountConfig{}
+	}
+
+	dev, serverFd, err := socketPair()
+	if err != nil {
+		return nil, err
+	}
+
+	k := &Kernel{
+		dev:           dev,
+		readerDone:    make(chan struct{}),
+		notifications: make(chan Notification, notificationBuffer),
+		nextUnique:    2,
+		pending:       make(map[uint64]chan []byte),
+	}
+
+	// The server reads INIT while being mounted, so queue it up first.
+	in := fusekernel.InitIn{
+		Major:        protocol.Major,
+		Minor:        protocol.Minor,
+		MaxReadahead: MaxMessageSize,
+		Flags: uint32(fusekernel.InitAsyncRead | fusekernel.InitAtomicTrunc |
+			fusekernel.InitExportSupport | fusekernel.InitBigWrites |
+			fusekernel.InitDontMask | fusekernel.InitPosixACL |
+			fusekernel.InitNoOpenSupport | fusekernel.InitNoOpendirSupport |
+			fusekernel.InitHandleKillprivV2 |
+			fusekernel.InitSpliceWrite | fusekernel.InitSpliceMove |
+			fusekernel.InitExt),
+	}
+	flags2 := uint32(initFlags2)
+	body := append(structBytes(&in), structBytes(&flags2)...)
+
+	// Unique ID zero is reserved for notifications.
+	const initUnique = 1
+	if err := k.write(fusekernel.OpInit, initUnique, 0, fuseops.OpContext{}, body, nil); err != nil {
+		dev.Close()
+		syscall.Close(serverFd)
+		return nil, fmt.Errorf("writing INIT: %w", err)
+	}
+
+	k.mfs, err = fuse.MountFromFD(serverFd, server, cfg)
+	if err != nil {
+		dev.Close()
+		syscall.Close(serverFd)
+		return nil, fmt.Errorf("MountFromFD: %w", err)
+	}
+
+	// Consume the reply to INIT.
+	buf := make([]byte, MaxMessageSize)
+	n, err := dev.Read(buf)
+	if err != nil {
+		k.Close()
+		return nil, fmt.Errorf("reading INIT reply: %w", err)
+	}
+
+	if _, errno, err := parseReply(buf[:n]); err != nil || errno != 0 {
+		k.Close()
+		return nil, fmt.Errorf("INIT failed: %v %v", err, errno)
+	}
+
+	k.readerStarted = true
+	go k.readReplies()
+	return k, nil
+}
+
+// MountedFileSystem returns the file system being served, for access to its
+// methods that talk to the kernel, such as InvalidateInode.
+func (k *Kernel) MountedFileSystem() *fuse.MountedFileSystem {
+	return k.mfs
+}
+
+// Do sends the supplied op to the server, waits for the reply, and fills in
+// the op's output fields from it. It returns the errno that the server
+// replied with, as a syscall.Errno, or nil.
+//
+// The op must be a pointer to one of the structs in package fuseops. Its
+// OpContext is used to fill in the request header. Ops that receive no reply,
+// such as ForgetInodeOp, return as soon as the request has been sent.
+//
+// LOCKS_EXCLUDED(k.mu)
+func (k *Kernel) Do(ctx context.Context, op interface{}) error {
+	req, err := encodeOp(op)
+	if err != nil {
+		return err
+	}
+
+	// Register for the reply before sending, so it can't be missed.
+	k.mu.Lock()
+	if k.closed {
+		k.mu.Unlock()
+		return ErrClosed
+	}
+
+	unique := k.nextUnique
+	k.nextUnique++
+
+	var replies chan []byte
+	if !req.noReply {
+		replies = make(chan []byte, 1)
+		k.pending[unique] = replies
+	}
+	k.mu.Unlock()
+
+	err = k.write(req.opcode, unique, req.nodeid, req.opCtx, req.body, req.ext)
+	if err != nil {
+		k.forget(unique)
+		return fmt.Errorf("write: %w", err)
+	}
+
+	if req.noReply {
+		return nil
+	}
+
+	var reply []byte
+	select {
+	case reply = <-replies:
+		if reply == nil {
+			return ErrClosed
+		}
+
+	case <-ctx.Done():
+		// Tell the server we're no longer interested, as the kernel would.
+		k.forget(unique)
+		in := fusekernel.InterruptIn{Unique: unique}
+		k.write(fusekernel.OpInterrupt, 0, 0, fuseops.OpContext{}, structBytes(&in), nil)
+		return ctx.Err()
+	}
+
+	payload, errno, err := parseReply(reply)
+	if err != nil {
+		return err
+	}
+
+	if errno != 0 {
+		return errno
+	}
+
+	return decodeReply(op, payload)
+}
+
+// Close hangs up on the server and waits for it to finish serving ops.
+func (k *Kernel) Close() error {
+	// Wake up both the server's reads and our own.
+	syscall.Shutdown(int(k.dev.Fd()), syscall.SHUT_RDWR)
+
+	if k.readerStarted {
+		<-k.readerDone
+	} else {
+		k.markClosed()
+	}
+
+	err := k.dev.Close()
+	if k.mfs != nil {
+		if joinErr := k.mfs.Join(context.Background()); err == nil {
+			err = joinErr
+		}
+	}
+
+	return err
+}
+
+// Write a single request to the server, followed by the supplied extensions,
+// whose length must be a multiple of 8 bytes.
+func (k *Kernel) write(
+	opcode uint32,
+	unique uint64,
+	nodeid uint64,
+	opCtx fuseops.OpContext,
+	body []byte,
+	ext []byte) error {
+	h := fusekernel.InHeader{
+		Len:         uint32(fusekernel.InHeaderSize + len(body) + len(ext)),
+		Opcode:      opcode,
+		Unique:      unique,
+		Nodeid:      nodeid,
+		Uid:         opCtx.Uid,
+		Gid:         opCtx.Gid,
+		Pid:         opCtx.Pid,
+		TotalExtlen: uint16(len(ext) / 8),
+	}
+
+	msg := append(append(structBytes(&h), body...), ext...)
+	_, err := k.dev.Write(msg)
+	return err
+}
+
+// NotifyReply answers a retrieve notification from the server, whose unique
+// ID is notifyUnique, with the supplied data from the page cache.
+func (k *Kernel) NotifyReply(notifyUnique uint64, offset uint64, data []byte) error {
+	in := fusekernel.NotifyRetrieveIn{Offset: offset, Size: uint32(len(data))}
+	return k.write(fusekernel.OpNotifyReply, notifyUnique, 0, fuseops.OpContext{}, append(structBytes(&in), data...), nil)
+}
+
+// Notifications returns a channel on which notifications sent by the server
+// are delivered, in order. The channel is closed once the connection is. If
+// more than a few notifications go unreceived, later ones are discarded.
+func (k *Kernel) Notifications() <-chan Notification {
+	return k.notifications
+}
+
+// Deliver replies to the goroutines waiting for them, and notifications to
+// the notifications channel, until the connection is closed.
+func (k *Kernel) readReplies() {
+	defer close(k.readerDone)
+	defer close(k.notifications)
+	defer k.markClosed()
+
+	buf := make([]byte, MaxMessageSize+fusekernel.InHeaderSize)
+	for {
+		n, err := k.dev.Read(buf)
+		if err != nil || n == 0 {
+			return
+		}
+
+		if n < int(unsafe.Sizeof(fusekernel.OutHeader{})) {
+			continue
+		}
+
+		h := (*fusekernel.OutHeader)(unsafe.Pointer(&buf[0]))
+		if h.Unique == 0 {
+			// For notifications, the error field holds the notification code.
+			notification := Notification{
+				Code:    h.Error,
+				Payload: append([]byte(nil), buf[unsafe.Sizeof(*h):n]...),
+			}
+
+			select {
+			case k.notifications <- notification:
+			default:
+			}
+			continue
+		}
+
+		k.mu.Lock()
+		replies, ok := k.pending[h.Unique]
+		delete(k.pending, h.Unique)
+		k.mu.Unlock()
+
+		if ok {
+			replies <- append([]byte(nil), buf[:n]...)
+		}
+	}
+}
+
+// Mark the connection closed and fail all in-flight requests.
+//
+// LOCKS_EXCLUDED(k.mu)
+func (k *Kernel) markClosed() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.closed = true
+	for unique, replies := range k.pending {
+		close(replies)
+		delete(k.pending, unique)
+	}
+}
+
+// LOCKS_EXCLUDED(k.mu)
+func (k *Kernel) forget(unique uint64) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.pending, unique)
+}
+
+// Split a reply into its payload and errno.
+func parseReply(msg []byte) (payload []byte, errno syscall.Errno, err error) {
+	const headerSize = int(unsafe.Sizeof(fusekernel.OutHeader{}))
+	if len(msg) < headerSize {
+		return nil, 0, fmt.Errorf("short reply: %d bytes", len(msg))
+	}
+
+	h := (*fusekernel.OutHeader)(unsafe.Pointer(&msg[0]))
+	if int(h.Len) != len(msg) {
+		return nil, 0, fmt.Errorf("reply header says %d bytes, got %d", h.Len, len(msg))
+	}
+
+	return msg[headerSize:], syscall.Errno(-h.Error), nil
+}
+
+// Return the in-memory representation of a kernel struct.
+func structBytes[T any](p *T) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(p)), unsafe.Sizeof(*p))
+}
@@ -0,0 +1,50 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakekernel
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Create the socket pair standing in for /dev/fuse, returning our end and the
+// file descriptor for the server's end, which is served with
+// fuse.MountFromFD.
+//
+// SOCK_SEQPACKET preserves message boundaries, which the server relies on
+// since it reads one request per read(2).
+func socketPair() (*os.File, int, error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, -1, fmt.Errorf("Socketpair: %w", err)
+	}
+
+	// Each message must fit in the socket buffer. Raising the limit beyond
+	// net.core.wmem_max requires privileges, so try that first and fall back.
+	const bufSize = 4 * MaxMessageSize
+	for _, fd := range fds {
+		for _, opt := range [][2]int{
+			{syscall.SO_SNDBUFFORCE, syscall.SO_SNDBUF},
+			{syscall.SO_RCVBUFFORCE, syscall.SO_RCVBUF},
+		} {
+			if syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, opt[0], bufSize) != nil {
+				syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, opt[1], bufSize)
+			}
+		}
+	}
+
+	return os.NewFile(uintptr(fds[0]), "fakekernel"), fds[1], nil
+}
@@ -0,0 +1,1831 @@
+package fakekernel
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"testing/iotest"
+	"time"
+	"unsafe"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+	"github.com/jacobsa/fuse/samples/memfs"
+	"golang.org/x/sys/unix"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	k, err := Start(memfs.NewMemFS(0, 0), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	// A missing name.
+	lookUp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "foo"}
+	if err := k.Do(ctx, lookUp); err != syscall.ENOENT {
+		t.Fatalf("LookUpInode: expected ENOENT, got %v", err)
+	}
+
+	// Create, write, and read back a file larger than the default socket
+	// buffer.
+	create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "foo", Mode: 0644}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	if create.Entry.Child == 0 || create.Entry.Attributes.Mode != 0644 {
+		t.Errorf("unexpected entry: %+v", create.Entry)
+	}
+
+	data := bytes.Repeat([]byte("taco"), 1<<18)
+	write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: data}
+	if err := k.Do(ctx, write); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	read := &fuseops.ReadFileOp{Inode: create.Entry.Child, Handle: create.Handle, Size: int64(len(data))}
+	if err := k.Do(ctx, read); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	if !bytes.Equal(read.Dst[:read.BytesRead], data) {
+		t.Errorf("read back %d bytes that don't match what was written", read.BytesRead)
+	}
+
+	getAttr := &fuseops.GetInodeAttributesOp{Inode: create.Entry.Child}
+	if err := k.Do(ctx, getAttr); err != nil {
+		t.Fatalf("GetInodeAttributes: %v", err)
+	}
+
+	if got, want := getAttr.Attributes.Size, uint64(len(data)); got != want {
+		t.Errorf("expected size %d, got %d", want, got)
+	}
+
+	mkdir := &fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "dir", Mode: 0755}
+	if err := k.Do(ctx, mkdir); err != nil {
+		t.Fatalf("MkDir: %v", err)
+	}
+
+	if mode := mkdir.Entry.Attributes.Mode; mode != os.ModeDir|0755 {
+		t.Errorf("unexpected mode %v", mode)
+	}
+}
+
+func TestCloseFailsPendingOps(t *testing.T) {
+	k, err := Start(memfs.NewMemFS(0, 0), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if err := k.Do(context.Background(), &fuseops.StatFSOp{}); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestWireLogLifecycleRecords(t *testing.T) {
+	var buf bytes.Buffer
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{WireLogger: &buf})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if err := k.Do(context.Background(), &fuseops.StatFSOp{}); err != nil {
+		t.Fatalf("StatFS: %v", err)
+	}
+
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	var ops []string
+	var mount *fuse.WireLogRecord
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var wlog fuse.WireLogRecord
+		if err := dec.Decode(&wlog); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+
+		ops = append(ops, wlog.Operation)
+		if wlog.Operation == "Mount" {
+			mount = &wlog
+		}
+	}
+
+	want := []string{"initOp", "Mount", "StatFSOp", "Unmount"}
+	if len(ops) != len(want) {
+		t.Fatalf("expected records %v, got %v", want, ops)
+	}
+	for i := range want {
+		if ops[i] != want[i] {
+			t.Fatalf("expected records %v, got %v", want, ops)
+		}
+	}
+
+	if got := mount.Args["KernelProtocol"]; got != "7.38" {
+		t.Errorf("unexpected kernel protocol %v", got)
+	}
+	if _, ok := mount.Args["Flags"].(string); !ok {
+		t.Errorf("expected negotiated flags, got %v", mount.Args)
+	}
+}
+
+func TestWireLogHandleSessions(t *testing.T) {
+	var buf bytes.Buffer
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{
+		WireLogger:            &buf,
+		WireLogHandleSessions: true,
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "foo", Mode: 0644}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	ops := []interface{}{
+		&fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: []byte("taco")},
+		&fuseops.ReadFileOp{Inode: create.Entry.Child, Handle: create.Handle, Size: 3, Dst: make([]byte, 3)},
+		&fuseops.GetInodeAttributesOp{Inode: create.Entry.Child},
+	}
+	for _, op := range ops {
+		if err := k.Do(ctx, op); err != nil {
+			t.Fatalf("%T: %v", op, err)
+		}
+	}
+
+	// memfs doesn't implement ReleaseFileHandle, but the session ends anyway.
+	k.Do(ctx, &fuseops.ReleaseFileHandleOp{Handle: create.Handle})
+
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	sessions := make(map[string]uint64)
+	var summary *fuse.WireLogRecord
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var wlog fuse.WireLogRecord
+		if err := dec.Decode(&wlog); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+
+		sessions[wlog.Operation] = wlog.HandleSession
+		if wlog.Operation == "HandleSummary" {
+			summary = &wlog
+		}
+	}
+
+	for _, name := range []string{"CreateFileOp", "WriteFileOp", "ReadFileOp", "ReleaseFileHandleOp", "HandleSummary"} {
+		if sessions[name] != 1 {
+			t.Errorf("expected %s in session 1, got %d", name, sessions[name])
+		}
+	}
+	if sessions["GetInodeAttributesOp"] != 0 {
+		t.Errorf("expected no session for GetInodeAttributesOp, got %d", sessions["GetInodeAttributesOp"])
+	}
+
+	if summary == nil {
+		t.Fatalf("expected a HandleSummary record")
+	}
+	for key, want := range map[string]float64{"Ops": 4, "BytesWritten": 4, "BytesRead": 3} {
+		if got := summary.Args[key]; got != want {
+			t.Errorf("expected %s %v, got %v", key, want, got)
+		}
+	}
+}
+
+func TestSeekFile(t *testing.T) {
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	ctx := context.Background()
+	create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "foo", Mode: 0644}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: []byte("taco")}
+	if err := k.Do(ctx, write); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	testCases := []struct {
+		offset int64
+		whence int
+		want   int64
+		err    error
+	}{
+		{1, unix.SEEK_DATA, 1, nil},
+		{1, unix.SEEK_HOLE, 4, nil},
+		{4, unix.SEEK_DATA, 0, syscall.ENXIO},
+	}
+
+	for _, tc := range testCases {
+		op := &fuseops.SeekFileOp{
+			Inode:  create.Entry.Child,
+			Handle: create.Handle,
+			Offset: tc.offset,
+			Whence: tc.whence,
+		}
+
+		err := k.Do(ctx, op)
+		if err != tc.err {
+			t.Errorf("offset %d whence %d: expected error %v, got %v", tc.offset, tc.whence, tc.err, err)
+			continue
+		}
+		if err == nil && op.ResultOffset != tc.want {
+			t.Errorf("offset %d whence %d: expected %d, got %d", tc.offset, tc.whence, tc.want, op.ResultOffset)
+		}
+	}
+}
+
+// A file system whose files are always readable, and which remembers the last
+// poll handle that it was asked to notify.
+type pollFS struct {
+	fuseutil.NotImplementedFileSystem
+	pollHandles chan uint64
+}
+
+func (fs *pollFS) Poll(ctx context.Context, op *fuseops.PollOp) error {
+	op.Revents = op.Events & unix.POLLIN
+	if op.ScheduleNotify {
+		fs.pollHandles <- op.PollHandle
+	}
+	return nil
+}
+
+func TestPoll(t *testing.T) {
+	fs := &pollFS{pollHandles: make(chan uint64, 1)}
+	notifier := fuse.NewNotifier()
+	server := fuse.NewServerWithNotifier(notifier, fuseutil.NewFileSystemServer(fs))
+
+	k, err := Start(server, &fuse.MountConfig{})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	op := &fuseops.PollOp{
+		Inode:          fuseops.RootInodeID,
+		PollHandle:     17,
+		ScheduleNotify: true,
+		Events:         unix.POLLIN | unix.POLLOUT,
+	}
+	if err := k.Do(context.Background(), op); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if op.Revents != unix.POLLIN {
+		t.Errorf("expected revents POLLIN, got 0x%x", op.Revents)
+	}
+
+	if err := notifier.PollWakeup(<-fs.pollHandles); err != nil {
+		t.Fatalf("PollWakeup: %v", err)
+	}
+
+	n := <-k.Notifications()
+	if n.Code != fusekernel.NotifyCodePoll {
+		t.Fatalf("expected a poll notification, got code %d", n.Code)
+	}
+	if kh := binary.NativeEndian.Uint64(n.Payload); kh != 17 {
+		t.Errorf("expected poll handle 17, got %d", kh)
+	}
+}
+
+// A file system that records the lock requests that it receives, and the ops
+// that release locks.
+type flockFS struct {
+	fuseutil.NotImplementedFileSystem
+	flocks   chan *fuseops.FlockOp
+	flushes  chan *fuseops.FlushFileOp
+	releases chan *fuseops.ReleaseFileHandleOp
+}
+
+func (fs *flockFS) Flock(ctx context.Context, op *fuseops.FlockOp) error {
+	fs.flocks <- op
+	return nil
+}
+
+func (fs *flockFS) FlushFile(ctx context.Context, op *fuseops.FlushFileOp) error {
+	fs.flushes <- op
+	return nil
+}
+
+func (fs *flockFS) ReleaseFileHandle(ctx context.Context, op *fuseops.ReleaseFileHandleOp) error {
+	fs.releases <- op
+	return nil
+}
+
+func TestFlock(t *testing.T) {
+	fs := &flockFS{
+		flocks:   make(chan *fuseops.FlockOp, 1),
+		releases: make(chan *fuseops.ReleaseFileHandleOp, 1),
+	}
+
+	k, err := Start(fuseutil.NewFileSystemServer(fs), &fuse.MountConfig{EnableFlockLocks: true})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	ctx := context.Background()
+	err = k.Do(ctx, &fuseops.FlockOp{
+		Inode:     fuseops.RootInodeID,
+		Handle:    3,
+		Owner:     0xdeadbeef,
+		Operation: unix.LOCK_EX,
+		Block:     true,
+	})
+	if err != nil {
+		t.Fatalf("Flock: %v", err)
+	}
+
+	got := <-fs.flocks
+	if got.Handle != 3 || got.Owner != 0xdeadbeef || got.Operation != unix.LOCK_EX || !got.Block {
+		t.Errorf("unexpected FlockOp: %+v", got)
+	}
+
+	err = k.Do(ctx, &fuseops.ReleaseFileHandleOp{
+		Handle:      3,
+		FlockUnlock: true,
+		LockOwner:   0xdeadbeef,
+	})
+	if err != nil {
+		t.Fatalf("ReleaseFileHandle: %v", err)
+	}
+
+	release := <-fs.releases
+	if !release.FlockUnlock || release.LockOwner != 0xdeadbeef {
+		t.Errorf("unexpected ReleaseFileHandleOp: %+v", release)
+	}
+}
+
+func TestFlushLockOwner(t *testing.T) {
+	fs := &flockFS{flushes: make(chan *fuseops.FlushFileOp, 1)}
+	k, err := Start(fuseutil.NewFileSystemServer(fs), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	err = k.Do(context.Background(), &fuseops.FlushFileOp{Inode: 17, Handle: 3, LockOwner: 0xfeedface})
+	if err != nil {
+		t.Fatalf("FlushFile: %v", err)
+	}
+
+	flush := <-fs.flushes
+	if flush.Inode != 17 || flush.Handle != 3 || flush.LockOwner != 0xfeedface {
+		t.Errorf("unexpected FlushFileOp: %+v", flush)
+	}
+}
+
+func TestInvalidateInode(t *testing.T) {
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	if err := k.MountedFileSystem().InvalidateInode(17, -1, 0); err != nil {
+		t.Fatalf("InvalidateInode: %v", err)
+	}
+
+	n := <-k.Notifications()
+	if n.Code != fusekernel.NotifyCodeInvalInode {
+		t.Fatalf("expected an inode invalidation, got code %d", n.Code)
+	}
+
+	out := (*fusekernel.NotifyInvalInodeOut)(unsafe.Pointer(&n.Payload[0]))
+	if out.Ino != 17 || out.Off != -1 || out.Len != 0 {
+		t.Errorf("unexpected invalidation: %+v", *out)
+	}
+}
+
+func TestInvalidateEntryAndNotifyDelete(t *testing.T) {
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	mfs := k.MountedFileSystem()
+	if err := mfs.InvalidateEntry(fuseops.RootInodeID, "foo"); err != nil {
+		t.Fatalf("InvalidateEntry: %v", err)
+	}
+	if err := mfs.NotifyDelete(fuseops.RootInodeID, 17, "bar"); err != nil {
+		t.Fatalf("NotifyDelete: %v", err)
+	}
+
+	n := <-k.Notifications()
+	if n.Code != fusekernel.NotifyCodeInvalEntry {
+		t.Fatalf("expected an entry invalidation, got code %d", n.Code)
+	}
+	inval := (*fusekernel.NotifyInvalEntryOut)(unsafe.Pointer(&n.Payload[0]))
+	name := string(n.Payload[unsafe.Sizeof(*inval):])
+	if inval.Parent != fuseops.RootInodeID || name != "foo\x00" {
+		t.Errorf("unexpected invalidation: %+v %q", *inval, name)
+	}
+
+	n = <-k.Notifications()
+	if n.Code != fusekernel.NotifyCodeDelete {
+		t.Fatalf("expected a delete notification, got code %d", n.Code)
+	}
+	del := (*fusekernel.NotifyDeleteOut)(unsafe.Pointer(&n.Payload[0]))
+	name = string(n.Payload[unsafe.Sizeof(*del):])
+	if del.Parent != fuseops.RootInodeID || del.Child != 17 || name != "bar\x00" {
+		t.Errorf("unexpected deletion: %+v %q", *del, name)
+	}
+}
+
+func TestExpireEntry(t *testing.T) {
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	mfs := k.MountedFileSystem()
+	for _, tc := range []struct {
+		invalidate func(fuseops.InodeID, string) error
+		flags      uint32
+	}{
+		{mfs.InvalidateEntry, 0},
+		{mfs.ExpireEntry, fusekernel.NotifyExpireOnly},
+	} {
+		if err := tc.invalidate(fuseops.RootInodeID, "foo"); err != nil {
+			t.Fatalf("invalidate: %v", err)
+		}
+
+		n := <-k.Notifications()
+		if n.Code != fusekernel.NotifyCodeInvalEntry {
+			t.Fatalf("expected an entry invalidation, got code %d", n.Code)
+		}
+		inval := (*fusekernel.NotifyInvalEntryOut)(unsafe.Pointer(&n.Payload[0]))
+		if inval.Parent != fuseops.RootInodeID || inval.Flags != tc.flags {
+			t.Errorf("unexpected invalidation: %+v", *inval)
+		}
+	}
+}
+
+func TestNotifyStoreAndRetrieve(t *testing.T) {
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	mfs := k.MountedFileSystem()
+	if err := mfs.NotifyStore(17, 4096, []byte("taco")); err != nil {
+		t.Fatalf("NotifyStore: %v", err)
+	}
+
+	n := <-k.Notifications()
+	if n.Code != fusekernel.NotifyCodeStore {
+		t.Fatalf("expected a store notification, got code %d", n.Code)
+	}
+	store := (*fusekernel.NotifyStoreOut)(unsafe.Pointer(&n.Payload[0]))
+	data := string(n.Payload[unsafe.Sizeof(*store):])
+	if store.Nodeid != 17 || store.Offset != 4096 || store.Size != 4 || data != "taco" {
+		t.Errorf("unexpected store: %+v %q", *store, data)
+	}
+
+	// Answer the retrieve notification as the kernel would.
+	go func() {
+		n := <-k.Notifications()
+		if n.Code != fusekernel.NotifyCodeRetrieve {
+			t.Errorf("expected a retrieve notification, got code %d", n.Code)
+			return
+		}
+
+		out := (*fusekernel.NotifyRetrieveOut)(unsafe.Pointer(&n.Payload[0]))
+		k.NotifyReply(out.NotifyUnique, out.Offset, []byte("burrito")[:out.Size])
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	got, err := mfs.NotifyRetrieve(ctx, 17, 0, 3)
+	if err != nil {
+		t.Fatalf("NotifyRetrieve: %v", err)
+	}
+	if string(got) != "bur" {
+		t.Errorf("unexpected data retrieved: %q", got)
+	}
+}
+
+// A file system that hands every open file to the same backing file.
+type passthroughFS struct {
+	fuseutil.NotImplementedFileSystem
+}
+
+func (fs *passthroughFS) OpenFile(ctx context.Context, op *fuseops.OpenFileOp) error {
+	op.Handle = 3
+	op.BackingID = 7
+	return nil
+}
+
+func TestOpenFilePassthrough(t *testing.T) {
+	k, err := Start(fuseutil.NewFileSystemServer(&passthroughFS{}), &fuse.MountConfig{EnablePassthrough: true})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	op := &fuseops.OpenFileOp{Inode: 17}
+	if err := k.Do(context.Background(), op); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+
+	if op.Handle != 3 || op.BackingID != 7 {
+		t.Errorf("expected handle 3 with backing ID 7, got %d and %d", op.Handle, op.BackingID)
+	}
+}
+
+func TestMaxWrite(t *testing.T) {
+	var buf bytes.Buffer
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{MaxWrite: 1<<16 + 100, WireLogger: &buf})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "foo", Mode: 0644}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	// The offered size is rounded down to a whole number of pages.
+	pageSize := os.Getpagesize()
+	maxWrite := (1<<16 + 100) / pageSize * pageSize
+	write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: bytes.Repeat([]byte("x"), maxWrite)}
+	if err := k.Do(ctx, write); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var wlog fuse.WireLogRecord
+		if err := dec.Decode(&wlog); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if wlog.Operation != "Mount" {
+			continue
+		}
+
+		// Reads may still be as large as the default maximum.
+		if got := wlog.Args["MaxWrite"]; got != float64(maxWrite) {
+			t.Errorf("expected MaxWrite %d, got %v", maxWrite, got)
+		}
+		if got := wlog.Args["MaxPages"]; got != float64((1<<20)/pageSize) {
+			t.Errorf("expected MaxPages %d, got %v", (1<<20)/pageSize, got)
+		}
+		return
+	}
+
+	t.Fatal("no Mount record")
+}
+
+// A file system whose files all have the contents of a single file on disk.
+type spliceFS struct {
+	fuseutil.NotImplementedFileSystem
+	f *os.File
+}
+
+func (fs *spliceFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
+	op.SpliceFile = fs.f
+	op.SpliceOffset = op.Offset
+	op.BytesRead = int(op.Size)
+	return nil
+}
+
+func TestReadFileSplice(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "splice")
+	if err != nil {
+		t.Fatalf("CreateTemp: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString("taco burrito"); err != nil {
+		t.Fatalf("WriteString: %v", err)
+	}
+
+	for _, enable := range []bool{false, true} {
+		var capture bytes.Buffer
+		k, err := Start(fuseutil.NewFileSystemServer(&spliceFS{f: f}), &fuse.MountConfig{EnableSplice: enable, WireCapture: &capture})
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+
+		// Ask for more than there is, so that the read is short.
+		op := &fuseops.ReadFileOp{Inode: 17, Offset: 5, Size: 100, Dst: make([]byte, 100)}
+		if err := k.Do(context.Background(), op); err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+
+		if got := string(op.Dst[:op.BytesRead]); got != "burrito" {
+			t.Errorf("EnableSplice %v: unexpected contents %q", enable, got)
+		}
+
+		if err := k.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+
+		// Spliced data never passes through the server, so isn't captured.
+		cr, err := fuse.NewWireCaptureReader(&capture)
+		if err != nil {
+			t.Fatalf("NewWireCaptureReader: %v", err)
+		}
+
+		var reply *fuse.WireCapturePacket
+		for {
+			p, err := cr.Next()
+			if err != nil {
+				break
+			}
+			if p.Direction == fuse.WireCaptureOut && p.Unique() == 2 {
+				reply = p
+			}
+		}
+
+		if reply == nil {
+			t.Fatalf("EnableSplice %v: reply not captured", enable)
+		}
+		if spliced := len(reply.Data) < reply.Len; spliced != enable {
+			t.Errorf("EnableSplice %v: captured %d of %d bytes", enable, len(reply.Data), reply.Len)
+		}
+	}
+}
+
+// A file system whose files all have the same contents, streamed from a
+// reader, or that fail part way with an error.
+type readerFS struct {
+	fuseutil.NotImplementedFileSystem
+	contents string
+	err      error
+}
+
+func (fs *readerFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
+	var r io.Reader = strings.NewReader(fs.contents[min(op.Offset, int64(len(fs.contents))):])
+	if fs.err != nil {
+		r = io.MultiReader(r, iotest.ErrReader(fs.err))
+	}
+	op.Reader = r
+	return nil
+}
+
+func TestReadFileReader(t *testing.T) {
+	k, err := Start(fuseutil.NewFileSystemServer(&readerFS{contents: "taco burrito"}), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	// Ask for less than there is, then more, so that the read is short.
+	op := &fuseops.ReadFileOp{Inode: 17, Offset: 0, Size: 4, Dst: make([]byte, 100)}
+	if err := k.Do(context.Background(), op); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got := string(op.Dst[:op.BytesRead]); got != "taco" {
+		t.Errorf("unexpected contents %q", got)
+	}
+
+	op = &fuseops.ReadFileOp{Inode: 17, Offset: 5, Size: 100, Dst: make([]byte, 100)}
+	if err := k.Do(context.Background(), op); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got := string(op.Dst[:op.BytesRead]); got != "burrito" {
+		t.Errorf("unexpected contents %q", got)
+	}
+
+	// An error from the reader fails the op.
+	k2, err := Start(fuseutil.NewFileSystemServer(&readerFS{contents: "taco", err: syscall.ENXIO}), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k2.Close()
+
+	op = &fuseops.ReadFileOp{Inode: 17, Size: 100}
+	if err := k2.Do(context.Background(), op); err != syscall.ENXIO {
+		t.Errorf("expected ENXIO, got %v", err)
+	}
+}
+
+func TestOpenFileAtomicTrunc(t *testing.T) {
+	var buf bytes.Buffer
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{EnableAtomicTrunc: true, WireLogger: &buf})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "foo", Mode: 0644}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: []byte("taco")}
+	if err := k.Do(ctx, write); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	open := &fuseops.OpenFileOp{Inode: create.Entry.Child, OpenFlags: fusekernel.OpenWriteOnly | fusekernel.OpenTruncate}
+	if err := k.Do(ctx, open); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+
+	getattr := &fuseops.GetInodeAttributesOp{Inode: create.Entry.Child}
+	if err := k.Do(ctx, getattr); err != nil {
+		t.Fatalf("GetInodeAttributes: %v", err)
+	}
+	if getattr.Attributes.Size != 0 {
+		t.Errorf("expected the file to be truncated, got size %d", getattr.Attributes.Size)
+	}
+
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var wlog fuse.WireLogRecord
+		if err := dec.Decode(&wlog); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if wlog.Operation != "Mount" {
+			continue
+		}
+
+		if flags, _ := wlog.Args["Flags"].(string); !strings.Contains(flags, "InitAtomicTrunc") {
+			t.Errorf("expected InitAtomicTrunc to be negotiated, got %v", wlog.Args["Flags"])
+		}
+		return
+	}
+
+	t.Fatal("no Mount record")
+}
+
+func TestCreateTmpFile(t *testing.T) {
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	ctx := context.Background()
+	create := &fuseops.CreateTmpFileOp{Parent: fuseops.RootInodeID, Mode: 0600, OpenFlags: fusekernel.OpenReadWrite}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateTmpFile: %v", err)
+	}
+	if create.Entry.Attributes.Nlink != 0 {
+		t.Errorf("expected no links, got %d", create.Entry.Attributes.Nlink)
+	}
+
+	write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: []byte("taco")}
+	if err := k.Do(ctx, write); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	// Give the file a name, as linkat(2) would.
+	link := &fuseops.CreateLinkOp{Parent: fuseops.RootInodeID, Name: "foo", Target: create.Entry.Child}
+	if err := k.Do(ctx, link); err != nil {
+		t.Fatalf("CreateLink: %v", err)
+	}
+
+	lookup := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "foo"}
+	if err := k.Do(ctx, lookup); err != nil {
+		t.Fatalf("LookUpInode: %v", err)
+	}
+	if lookup.Entry.Child != create.Entry.Child || lookup.Entry.Attributes.Size != 4 || lookup.Entry.Attributes.Nlink != 1 {
+		t.Errorf("unexpected entry %+v", lookup.Entry)
+	}
+}
+
+func TestRenameFlags(t *testing.T) {
+	for _, enable := range []bool{false, true} {
+		k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{EnableRenameFlags: enable})
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+
+		ctx := context.Background()
+		var ids []fuseops.InodeID
+		for _, name := range []string{"foo", "bar"} {
+			create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: name, Mode: 0644}
+			if err := k.Do(ctx, create); err != nil {
+				t.Fatalf("CreateFile: %v", err)
+			}
+			ids = append(ids, create.Entry.Child)
+		}
+
+		noReplace := &fuseops.RenameOp{
+			OldParent: fuseops.RootInodeID,
+			OldName:   "foo",
+			NewParent: fuseops.RootInodeID,
+			NewName:   "bar",
+			Flags:     fuseops.RenameNoReplace,
+		}
+		err = k.Do(ctx, noReplace)
+		if !enable {
+			if err != syscall.ENOSYS {
+				t.Errorf("expected ENOSYS without EnableRenameFlags, got %v", err)
+			}
+			k.Close()
+			continue
+		}
+		if err != syscall.EEXIST {
+			t.Errorf("expected EEXIST, got %v", err)
+		}
+
+		exchange := &fuseops.RenameOp{
+			OldParent: fuseops.RootInodeID,
+			OldName:   "foo",
+			NewParent: fuseops.RootInodeID,
+			NewName:   "bar",
+			Flags:     fuseops.RenameExchange,
+		}
+		if err := k.Do(ctx, exchange); err != nil {
+			t.Fatalf("Rename: %v", err)
+		}
+
+		lookup := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "foo"}
+		if err := k.Do(ctx, lookup); err != nil {
+			t.Fatalf("LookUpInode: %v", err)
+		}
+		if lookup.Entry.Child != ids[1] {
+			t.Errorf("expected foo to be inode %d after the exchange, got %d", ids[1], lookup.Entry.Child)
+		}
+
+		k.Close()
+	}
+}
+
+func TestUmask(t *testing.T) {
+	var buf bytes.Buffer
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{EnableDontMask: true, WireLogger: &buf})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	mkdir := &fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "dir", Mode: 0777, Umask: 027}
+	if err := k.Do(ctx, mkdir); err != nil {
+		t.Fatalf("MkDir: %v", err)
+	}
+	if got := mkdir.Entry.Attributes.Mode.Perm(); got != 0750 {
+		t.Errorf("expected the directory to have mode 0750, got %v", got)
+	}
+
+	create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "foo", Mode: 0666, Umask: 022}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	if got := create.Entry.Attributes.Mode.Perm(); got != 0644 {
+		t.Errorf("expected the file to have mode 0644, got %v", got)
+	}
+
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// The umask is logged along with the other fields of the ops.
+	var umasks int
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var wlog fuse.WireLogRecord
+		if err := dec.Decode(&wlog); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+
+		switch wlog.Operation {
+		case "Mount":
+			if flags, _ := wlog.Args["Flags"].(string); !strings.Contains(flags, "InitDontMask") {
+				t.Errorf("expected InitDontMask to be negotiated, got %v", wlog.Args["Flags"])
+			}
+		case "MkDirOp", "CreateFileOp":
+			if _, ok := wlog.Args["Umask"]; ok {
+				umasks++
+			}
+		}
+	}
+
+	if umasks != 2 {
+		t.Errorf("expected the umask in 2 records, got %d", umasks)
+	}
+}
+
+func TestSecurityContext(t *testing.T) {
+	var buf bytes.Buffer
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{EnableSecurityContext: true, WireLogger: &buf})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	label := fuseops.SecurityContext{Name: "security.selinux", Value: []byte("system_u:object_r:fusefs_t:s0\x00")}
+	mkdir := &fuseops.MkDirOp{
+		Parent:           fuseops.RootInodeID,
+		Name:             "dir",
+		Mode:             0755,
+		SecurityContexts: []fuseops.SecurityContext{label, {Name: "security.smack", Value: []byte("_")}},
+	}
+	if err := k.Do(ctx, mkdir); err != nil {
+		t.Fatalf("MkDir: %v", err)
+	}
+
+	create := &fuseops.CreateFileOp{
+		Parent:           mkdir.Entry.Child,
+		Name:             "foo",
+		Mode:             0644,
+		SecurityContexts: []fuseops.SecurityContext{label},
+	}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	// memfs stores the contexts as extended attributes.
+	check := func(inode fuseops.InodeID, name string, want []byte) {
+		get := &fuseops.GetXattrOp{Inode: inode, Name: name, Dst: make([]byte, 64)}
+		if err := k.Do(ctx, get); err != nil {
+			t.Errorf("GetXattr(%d, %q): %v", inode, name, err)
+			return
+		}
+		if got := get.Dst[:get.BytesRead]; !bytes.Equal(got, want) {
+			t.Errorf("GetXattr(%d, %q): expected %q, got %q", inode, name, want, got)
+		}
+	}
+	check(mkdir.Entry.Child, label.Name, label.Value)
+	check(mkdir.Entry.Child, "security.smack", []byte("_"))
+	check(create.Entry.Child, label.Name, label.Value)
+
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var wlog fuse.WireLogRecord
+		if err := dec.Decode(&wlog); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if wlog.Operation != "Mount" {
+			continue
+		}
+		if flags2, _ := wlog.Args["Flags2"].(string); !strings.Contains(flags2, "InitSecurityCtx") {
+			t.Errorf("expected InitSecurityCtx to be negotiated, got %v", wlog.Args["Flags2"])
+		}
+	}
+}
+
+func TestPosixACL(t *testing.T) {
+	var buf bytes.Buffer
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{EnablePosixACL: true, WireLogger: &buf})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	mkdir := &fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "shared", Mode: 0770}
+	if err := k.Do(ctx, mkdir); err != nil {
+		t.Fatalf("MkDir: %v", err)
+	}
+
+	// Grant a second group access to the directory, and make that the default
+	// for its children.
+	acl := fuseutil.ACL{
+		{Tag: fuseutil.ACL_UserObj, Perm: fuseutil.ACL_Read | fuseutil.ACL_Write | fuseutil.ACL_Execute},
+		{Tag: fuseutil.ACL_GroupObj, Perm: fuseutil.ACL_Read | fuseutil.ACL_Write | fuseutil.ACL_Execute},
+		{Tag: fuseutil.ACL_Group, Perm: fuseutil.ACL_Read | fuseutil.ACL_Execute, ID: 1234},
+		{Tag: fuseutil.ACL_Mask, Perm: fuseutil.ACL_Read | fuseutil.ACL_Write | fuseutil.ACL_Execute},
+		{Tag: fuseutil.ACL_Other},
+	}
+	for _, name := range []string{fuseutil.XattrPosixACLAccess, fuseutil.XattrPosixACLDefault} {
+		set := &fuseops.SetXattrOp{Inode: mkdir.Entry.Child, Name: name, Value: fuseutil.EncodeACL(acl)}
+		if err := k.Do(ctx, set); err != nil {
+			t.Fatalf("SetXattr(%q): %v", name, err)
+		}
+	}
+
+	get := &fuseops.GetXattrOp{Inode: mkdir.Entry.Child, Name: fuseutil.XattrPosixACLDefault, Dst: make([]byte, 64)}
+	if err := k.Do(ctx, get); err != nil {
+		t.Fatalf("GetXattr: %v", err)
+	}
+	got, err := fuseutil.DecodeACL(get.Dst[:get.BytesRead])
+	if err != nil {
+		t.Fatalf("DecodeACL: %v", err)
+	}
+	if !reflect.DeepEqual(got, acl) {
+		t.Errorf("expected ACL %v, got %v", acl, got)
+	}
+
+	// Malformed values are rejected.
+	if _, err := fuseutil.DecodeACL(get.Dst[:get.BytesRead-1]); err == nil {
+		t.Errorf("expected an error decoding a truncated ACL")
+	}
+
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var wlog fuse.WireLogRecord
+		if err := dec.Decode(&wlog); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if wlog.Operation != "Mount" {
+			continue
+		}
+		if flags, _ := wlog.Args["Flags"].(string); !strings.Contains(flags, "InitPosixACL") {
+			t.Errorf("expected InitPosixACL to be negotiated, got %v", wlog.Args["Flags"])
+		}
+	}
+}
+
+// A file system whose files and directories are all opened with the same
+// response flags.
+type responseFlagsFS struct {
+	fuseutil.NotImplementedFileSystem
+	flags fuseops.OpenResponseFlags
+}
+
+func (fs *responseFlagsFS) OpenFile(ctx context.Context, op *fuseops.OpenFileOp) error {
+	op.ResponseFlags = fs.flags
+	op.KeepPageCache = true
+	return nil
+}
+
+func (fs *responseFlagsFS) OpenDir(ctx context.Context, op *fuseops.OpenDirOp) error {
+	op.ResponseFlags = fs.flags
+	return nil
+}
+
+func TestOpenResponseFlags(t *testing.T) {
+	fs := &responseFlagsFS{flags: fuseops.OpenStream | fuseops.OpenNonSeekable | fuseops.OpenNoFlush}
+	k, err := Start(fuseutil.NewFileSystemServer(fs), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	ctx := context.Background()
+	open := &fuseops.OpenFileOp{Inode: 17}
+	if err := k.Do(ctx, open); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+
+	// The boolean fields are folded into the flags.
+	if want := fs.flags | fuseops.OpenKeepCache; open.ResponseFlags != want {
+		t.Errorf("expected flags %v, got %v", want, open.ResponseFlags)
+	}
+	if !open.KeepPageCache || open.UseDirectIO {
+		t.Errorf("unexpected KeepPageCache %v and UseDirectIO %v", open.KeepPageCache, open.UseDirectIO)
+	}
+
+	openDir := &fuseops.OpenDirOp{Inode: 17}
+	if err := k.Do(ctx, openDir); err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	if openDir.ResponseFlags != fs.flags {
+		t.Errorf("expected flags %v, got %v", fs.flags, openDir.ResponseFlags)
+	}
+}
+
+func TestFallocateModes(t *testing.T) {
+	k, err := Start(memfs.NewMemFS(0, 0), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	ctx := context.Background()
+	create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "foo", Mode: 0644}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: []byte("tacoburrito")}
+	if err := k.Do(ctx, write); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	fallocate := func(mode fuseops.FallocateMode, offset, length uint64) error {
+		return k.Do(ctx, &fuseops.FallocateOp{
+			Inode:  create.Entry.Child,
+			Handle: create.Handle,
+			Offset: offset,
+			Length: length,
+			Mode:   mode,
+		})
+	}
+	if err := fallocate(fuseops.FallocatePunchHole|fuseops.FallocateKeepSize, 4, 4); err != nil {
+		t.Fatalf("Fallocate(PunchHole): %v", err)
+	}
+	if err := fallocate(fuseops.FallocateZeroRange, 10, 4); err != nil {
+		t.Fatalf("Fallocate(ZeroRange): %v", err)
+	}
+	if err := fallocate(fuseops.FallocateCollapseRange, 0, 4); err != syscall.EOPNOTSUPP {
+		t.Errorf("Fallocate(CollapseRange): expected EOPNOTSUPP, got %v", err)
+	}
+
+	read := &fuseops.ReadFileOp{Inode: create.Entry.Child, Handle: create.Handle, Size: 32, Dst: make([]byte, 32)}
+	if err := k.Do(ctx, read); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got, want := string(read.Dst[:read.BytesRead]), "taco\x00\x00\x00\x00it\x00\x00\x00\x00"; got != want {
+		t.Errorf("expected contents %q, got %q", want, got)
+	}
+}
+
+// A file system in which only the members of one group may write to inodes.
+type accessFS struct {
+	fuseutil.NotImplementedFileSystem
+	gid uint32
+}
+
+func (fs *accessFS) Access(ctx context.Context, op *fuseops.AccessOp) error {
+	if op.Mask&unix.W_OK != 0 && op.OpContext.Gid != fs.gid {
+		return syscall.EACCES
+	}
+	return nil
+}
+
+func TestAccess(t *testing.T) {
+	k, err := Start(fuseutil.NewFileSystemServer(&accessFS{gid: 100}), &fuse.MountConfig{DisableDefaultPermissions: true})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		mask uint32
+		gid  uint32
+		want error
+	}{
+		{unix.R_OK | unix.X_OK, 0, nil},
+		{unix.W_OK, 0, syscall.EACCES},
+		{unix.R_OK | unix.W_OK, 100, nil},
+	} {
+		op := &fuseops.AccessOp{Inode: fuseops.RootInodeID, Mask: tc.mask, OpContext: fuseops.OpContext{Uid: 1000, Gid: tc.gid}}
+		if err := k.Do(ctx, op); err != tc.want {
+			t.Errorf("Access(0%o) with GID %d: expected %v, got %v", tc.mask, tc.gid, tc.want, err)
+		}
+	}
+}
+
+// A file system that counts the calls to Destroy.
+type destroyFS struct {
+	fuseutil.NotImplementedFileSystem
+	destroyed atomic.Int32
+}
+
+func (fs *destroyFS) Destroy() {
+	fs.destroyed.Add(1)
+}
+
+func TestDestroy(t *testing.T) {
+	fs := &destroyFS{}
+	k, err := Start(fuseutil.NewFileSystemServer(fs), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// The file system is destroyed before the reply is sent.
+	if err := k.Do(context.Background(), &fuseops.DestroyOp{}); err != nil {
+		t.Fatalf("Destroy: %v", err)
+	}
+	if got := fs.destroyed.Load(); got != 1 {
+		t.Errorf("expected one call to Destroy, got %d", got)
+	}
+
+	// And isn't destroyed again when the connection is closed.
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got := fs.destroyed.Load(); got != 1 {
+		t.Errorf("expected one call to Destroy, got %d", got)
+	}
+}
+
+// A file system whose handles pin versions of a file that differ in size.
+type versionedFS struct {
+	fuseutil.NotImplementedFileSystem
+}
+
+func (fs *versionedFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAttributesOp) error {
+	op.Attributes = fuseops.InodeAttributes{Size: 100, Nlink: 1, Mode: 0644}
+	if op.Handle != nil {
+		op.Attributes.Size = uint64(*op.Handle)
+	}
+	return nil
+}
+
+func TestGetInodeAttributesHandle(t *testing.T) {
+	k, err := Start(fuseutil.NewFileSystemServer(&versionedFS{}), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	ctx := context.Background()
+	byPath := &fuseops.GetInodeAttributesOp{Inode: 17}
+	if err := k.Do(ctx, byPath); err != nil {
+		t.Fatalf("GetInodeAttributes: %v", err)
+	}
+	if byPath.Attributes.Size != 100 {
+		t.Errorf("expected size 100 without a handle, got %d", byPath.Attributes.Size)
+	}
+
+	handle := fuseops.HandleID(42)
+	byHandle := &fuseops.GetInodeAttributesOp{Inode: 17, Handle: &handle}
+	if err := k.Do(ctx, byHandle); err != nil {
+		t.Fatalf("GetInodeAttributes: %v", err)
+	}
+	if byHandle.Attributes.Size != 42 {
+		t.Errorf("expected size 42 through handle 42, got %d", byHandle.Attributes.Size)
+	}
+}
+
+// A file system that records which ops asked it to clear setuid and setgid.
+type killPrivFS struct {
+	fuseutil.NotImplementedFileSystem
+
+	mu     sync.Mutex
+	killed []string
+}
+
+func (fs *killPrivFS) record(name string, kill bool) {
+	if kill {
+		fs.mu.Lock()
+		fs.killed = append(fs.killed, name)
+		fs.mu.Unlock()
+	}
+}
+
+func (fs *killPrivFS) OpenFile(ctx context.Context, op *fuseops.OpenFileOp) error {
+	fs.record("OpenFile", op.KillSuidGid)
+	return nil
+}
+
+func (fs *killPrivFS) WriteFile(ctx context.Context, op *fuseops.WriteFileOp) error {
+	fs.record("WriteFile", op.KillSuidGid)
+	return nil
+}
+
+func (fs *killPrivFS) SetInodeAttributes(ctx context.Context, op *fuseops.SetInodeAttributesOp) error {
+	fs.record("SetInodeAttributes", op.KillSuidGid)
+	return nil
+}
+
+func TestHandleKillPriv(t *testing.T) {
+	var buf bytes.Buffer
+	fs := &killPrivFS{}
+	k, err := Start(fuseutil.NewFileSystemServer(fs), &fuse.MountConfig{EnableHandleKillPriv: true, WireLogger: &buf})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	size := uint64(0)
+	for _, op := range []any{
+		&fuseops.OpenFileOp{Inode: 17, OpenFlags: fusekernel.OpenFlags(syscall.O_WRONLY | syscall.O_TRUNC), KillSuidGid: true},
+		&fuseops.WriteFileOp{Inode: 17, Data: []byte("taco"), KillSuidGid: true},
+		&fuseops.WriteFileOp{Inode: 17, Data: []byte("taco")},
+		&fuseops.SetInodeAttributesOp{Inode: 17, Size: &size, KillSuidGid: true},
+	} {
+		if err := k.Do(ctx, op); err != nil {
+			t.Fatalf("%T: %v", op, err)
+		}
+	}
+
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := []string{"OpenFile", "WriteFile", "SetInodeAttributes"}
+	if !reflect.DeepEqual(fs.killed, want) {
+		t.Errorf("expected %v to be asked to clear setuid/setgid, got %v", want, fs.killed)
+	}
+
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var wlog fuse.WireLogRecord
+		if err := dec.Decode(&wlog); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if wlog.Operation != "Mount" {
+			continue
+		}
+		if flags, _ := wlog.Args["Flags"].(string); !strings.Contains(flags, "InitHandleKillprivV2") {
+			t.Errorf("expected InitHandleKillprivV2 to be negotiated, got %v", wlog.Args["Flags"])
+		}
+	}
+}
+
+// A file system that records the writes that it receives.
+type writeRecorderFS struct {
+	fuseutil.NotImplementedFileSystem
+	writes chan *fuseops.WriteFileOp
+}
+
+func (fs *writeRecorderFS) WriteFile(ctx context.Context, op *fuseops.WriteFileOp) error {
+	fs.writes <- op
+	return nil
+}
+
+func TestWriteFileFlags(t *testing.T) {
+	fs := &writeRecorderFS{writes: make(chan *fuseops.WriteFileOp, 1)}
+	k, err := Start(fuseutil.NewFileSystemServer(fs), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		flags     fuseops.WriteFlags
+		openFlags fusekernel.OpenFlags
+	}{
+		{0, fusekernel.OpenWriteOnly},
+		{0, fusekernel.OpenWriteOnly | fusekernel.OpenAppend},
+		{fuseops.WriteCache, fusekernel.OpenReadWrite},
+		{fuseops.WriteKillSuidGid, fusekernel.OpenWriteOnly},
+	} {
+		op := &fuseops.WriteFileOp{Inode: 17, Handle: 3, Data: []byte("taco"), Flags: tc.flags, OpenFlags: tc.openFlags}
+		if err := k.Do(ctx, op); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+
+		got := <-fs.writes
+		if got.Flags != tc.flags || got.OpenFlags != tc.openFlags {
+			t.Errorf("expected flags %v and open flags %v, got %v and %v", tc.flags, tc.openFlags, got.Flags, got.OpenFlags)
+		}
+		if got.KillSuidGid != (tc.flags&fuseops.WriteKillSuidGid != 0) {
+			t.Errorf("unexpected KillSuidGid %v for flags %v", got.KillSuidGid, tc.flags)
+		}
+		if got.OpenFlags.IsAppend() != (tc.openFlags&fusekernel.OpenAppend != 0) {
+			t.Errorf("unexpected IsAppend for open flags %v", got.OpenFlags)
+		}
+	}
+}
+
+// A file system whose inodes form a chain, each the parent of the next, and
+// whose inode IDs have all been reused once.
+type exportFS struct {
+	fuseutil.NotImplementedFileSystem
+}
+
+func (fs *exportFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) error {
+	switch op.Name {
+	case ".":
+		op.Entry.Child = op.Parent
+	case "..":
+		op.Entry.Child = op.Parent - 1
+	default:
+		op.Entry.Child = op.Parent + 1
+	}
+	op.Entry.Generation = 2
+	return nil
+}
+
+func TestExportSupport(t *testing.T) {
+	var buf bytes.Buffer
+	k, err := Start(fuseutil.NewFileSystemServer(&exportFS{}), &fuse.MountConfig{EnableExportSupport: true, WireLogger: &buf})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name string
+		want fuseops.InodeID
+	}{
+		{"taco", 18},
+		{".", 17},
+		{"..", 16},
+	} {
+		op := &fuseops.LookUpInodeOp{Parent: 17, Name: tc.name}
+		if err := k.Do(ctx, op); err != nil {
+			t.Fatalf("LookUpInode(%q): %v", tc.name, err)
+		}
+		if op.Entry.Child != tc.want || op.Entry.Generation != 2 {
+			t.Errorf("LookUpInode(%q): expected inode %d generation 2, got inode %d generation %d", tc.name, tc.want, op.Entry.Child, op.Entry.Generation)
+		}
+	}
+
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var wlog fuse.WireLogRecord
+		if err := dec.Decode(&wlog); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if wlog.Operation != "Mount" {
+			continue
+		}
+		if flags, _ := wlog.Args["Flags"].(string); !strings.Contains(flags, "InitExportSupport") {
+			t.Errorf("expected InitExportSupport to be negotiated, got %v", wlog.Args["Flags"])
+		}
+	}
+}
+
+func TestNoOpenSupport(t *testing.T) {
+	var wireLog, errorLog bytes.Buffer
+	k, err := Start(fuseutil.NewFileSystemServer(&fuseutil.NotImplementedFileSystem{}), &fuse.MountConfig{
+		EnableNoOpenSupport:    true,
+		EnableNoOpendirSupport: true,
+		ErrorLogger:            log.New(&errorLog, "", 0),
+		WireLogger:             &wireLog,
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, op := range []any{
+		&fuseops.OpenFileOp{Inode: 17, OpenFlags: fusekernel.OpenReadOnly},
+		&fuseops.OpenDirOp{Inode: 17},
+	} {
+		if err := k.Do(ctx, op); err != syscall.ENOSYS {
+			t.Errorf("%T: expected ENOSYS, got %v", op, err)
+		}
+	}
+
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if errorLog.Len() != 0 {
+		t.Errorf("expected declined opens not to be logged as errors, got %q", errorLog.String())
+	}
+
+	dec := json.NewDecoder(&wireLog)
+	for dec.More() {
+		var wlog fuse.WireLogRecord
+		if err := dec.Decode(&wlog); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if wlog.Operation != "Mount" {
+			continue
+		}
+		flags, _ := wlog.Args["Flags"].(string)
+		for _, f := range []string{"InitNoOpenSupport", "InitNoOpendirSupport"} {
+			if !strings.Contains(flags, f) {
+				t.Errorf("expected %s to be negotiated, got %v", f, flags)
+			}
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	var buf bytes.Buffer
+	var negotiation fuse.InitNegotiation
+	cfg := &fuse.MountConfig{
+		WireLogger: &buf,
+		Configure: func(n *fuse.InitNegotiation) error {
+			negotiation = *n
+			n.Flags &^= fuse.InitWritebackCache
+			n.Flags |= fuse.InitPosixACL | fuse.InitSecurityCtx | fuse.InitFlockLocks
+			return nil
+		},
+	}
+	k, err := Start(fuseutil.NewFileSystemServer(&fuseutil.NotImplementedFileSystem{}), cfg)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if negotiation.KernelMajor != 7 || negotiation.KernelMinor != 38 {
+		t.Errorf("unexpected kernel protocol %d.%d", negotiation.KernelMajor, negotiation.KernelMinor)
+	}
+	if want := fuse.InitPosixACL | fuse.InitSecurityCtx; negotiation.KernelFlags&want != want {
+		t.Errorf("expected kernel flags to include %v, got %v", want, negotiation.KernelFlags)
+	}
+	if negotiation.Flags&fuse.InitWritebackCache == 0 {
+		t.Errorf("expected flags to include InitWritebackCache, got %v", negotiation.Flags)
+	}
+
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var wlog fuse.WireLogRecord
+		if err := dec.Decode(&wlog); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if wlog.Operation != "Mount" {
+			continue
+		}
+
+		// InitFlockLocks wasn't offered, so can't be requested.
+		flags, _ := wlog.Args["Flags"].(string)
+		if !strings.Contains(flags, "InitPosixACL") || strings.Contains(flags, "InitWritebackCache") || strings.Contains(flags, "InitFlockLocks") {
+			t.Errorf("unexpected flags %v", flags)
+		}
+		if flags2, _ := wlog.Args["Flags2"].(string); flags2 != "InitSecurityCtx" {
+			t.Errorf("unexpected flags2 %v", wlog.Args["Flags2"])
+		}
+	}
+
+	cfg = &fuse.MountConfig{
+		Configure: func(n *fuse.InitNegotiation) error {
+			return errors.New("taco")
+		},
+	}
+	if _, err := Start(fuseutil.NewFileSystemServer(&fuseutil.NotImplementedFileSystem{}), cfg); err == nil || !strings.Contains(err.Error(), "taco") {
+		t.Errorf("expected Start to fail with the error from Configure, got %v", err)
+	}
+}
+
+// The values of unix.STATX_ATTR_IMMUTABLE and friends, which are only
+// defined on Linux.
+const (
+	statxAttrImmutable = 0x10
+	statxAttrAppend    = 0x20
+	statxBtime         = 0x800
+	atStatxForceSync   = 0x2000
+)
+
+// A file system with a single character device, created at a known time.
+type statxFS struct {
+	fuseutil.NotImplementedFileSystem
+	statxs chan *fuseops.StatxOp
+}
+
+func (fs *statxFS) Statx(ctx context.Context, op *fuseops.StatxOp) error {
+	fs.statxs <- op
+	op.Attributes = fuseops.InodeAttributes{
+		Nlink:  1,
+		Mode:   os.ModeDevice | os.ModeCharDevice | 0600,
+		Rdev:   0x12345678,
+		Mtime:  time.Unix(1700000000, 0),
+		Crtime: time.Unix(1600000000, 500),
+	}
+	op.StatxAttributes = statxAttrImmutable
+	op.StatxAttributesMask = statxAttrImmutable | statxAttrAppend
+	return nil
+}
+
+func TestStatx(t *testing.T) {
+	fs := &statxFS{statxs: make(chan *fuseops.StatxOp, 1)}
+	k, err := Start(fuseutil.NewFileSystemServer(fs), nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	handle := fuseops.HandleID(3)
+	op := &fuseops.StatxOp{
+		Inode:  17,
+		Handle: &handle,
+		Mask:   statxBtime,
+		Flags:  atStatxForceSync,
+	}
+	if err := k.Do(context.Background(), op); err != nil {
+		t.Fatalf("Statx: %v", err)
+	}
+
+	received := <-fs.statxs
+	if received.Inode != 17 || received.Handle == nil || *received.Handle != 3 || received.Mask != statxBtime || received.Flags != atStatxForceSync {
+		t.Errorf("unexpected StatxOp: %+v", received)
+	}
+
+	if !op.Attributes.Crtime.Equal(time.Unix(1600000000, 500)) {
+		t.Errorf("expected birth time to round-trip, got %v", op.Attributes.Crtime)
+	}
+	if !op.Attributes.Mtime.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("expected modification time to round-trip, got %v", op.Attributes.Mtime)
+	}
+	if op.Attributes.Rdev != 0x12345678 || op.Attributes.Mode != os.ModeDevice|os.ModeCharDevice|0600 {
+		t.Errorf("unexpected attributes: %+v", op.Attributes)
+	}
+	if op.StatxAttributes != statxAttrImmutable || op.StatxAttributesMask != statxAttrImmutable|statxAttrAppend {
+		t.Errorf("unexpected statx attributes %#x, mask %#x", op.StatxAttributes, op.StatxAttributesMask)
+	}
+}
+
+// A file system whose reads and writes hang until released, handing their
+// contexts to the test.
+type interruptPolicyFS struct {
+	fuseutil.NotImplementedFileSystem
+	contexts chan context.Context
+	release  chan struct{}
+}
+
+func (fs *interruptPolicyFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
+	fs.contexts <- ctx
+	<-fs.release
+	return nil
+}
+
+func (fs *interruptPolicyFS) WriteFile(ctx context.Context, op *fuseops.WriteFileOp) error {
+	fs.contexts <- ctx
+	<-fs.release
+	return nil
+}
+
+func TestInterruptPolicy(t *testing.T) {
+	fs := &interruptPolicyFS{
+		contexts: make(chan context.Context),
+		release:  make(chan struct{}),
+	}
+	k, err := Start(fuseutil.NewFileSystemServer(fs), &fuse.MountConfig{
+		InterruptPolicy:  fuse.InterruptCancelListed,
+		InterruptibleOps: map[string]bool{"ReadFileOp": true},
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// Start each op, then interrupt it.
+	var opContexts []context.Context
+	for _, op := range []any{
+		&fuseops.ReadFileOp{Inode: 17, Handle: 3, Size: 4096},
+		&fuseops.WriteFileOp{Inode: 17, Handle: 3, Data: []byte("taco")},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error)
+		go func() { errs <- k.Do(ctx, op) }()
+
+		opContexts = append(opContexts, <-fs.contexts)
+		cancel()
+		if err := <-errs; err != context.Canceled {
+			t.Fatalf("%T: expected to be cancelled, got %v", op, err)
+		}
+	}
+
+	// Ops are read in order, so once this has been replied to, the interrupts
+	// have been handled.
+	if err := k.Do(context.Background(), &fuseops.StatFSOp{}); err != syscall.ENOSYS {
+		t.Fatalf("StatFS: %v", err)
+	}
+
+	if opContexts[0].Err() == nil {
+		t.Errorf("expected the read's context to be cancelled")
+	}
+	if opContexts[1].Err() != nil {
+		t.Errorf("expected the write's context not to be cancelled")
+	}
+
+	close(fs.release)
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// A file system that reports fixed statistics.
+type statFSFS struct {
+	fuseutil.NotImplementedFileSystem
+	stats fuseops.StatFSOp
+}
+
+func (fs *statFSFS) StatFS(ctx context.Context, op *fuseops.StatFSOp) error {
+	*op = fs.stats
+	return nil
+}
+
+func TestStatFS(t *testing.T) {
+	for _, tc := range []struct {
+		nameMax uint32
+		want    uint32
+	}{
+		{0, 255},
+		{1024, 1024},
+	} {
+		fs := &statFSFS{stats: fuseops.StatFSOp{
+			BlockSize:     512,
+			Blocks:        100,
+			IoSize:        65536,
+			NameMaxLength: tc.nameMax,
+		}}
+		k, err := Start(fuseutil.NewFileSystemServer(fs), nil)
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+
+		op := &fuseops.StatFSOp{}
+		if err := k.Do(context.Background(), op); err != nil {
+			t.Fatalf("StatFS: %v", err)
+		}
+		k.Close()
+
+		if op.NameMaxLength != tc.want || op.BlockSize != 512 || op.Blocks != 100 || op.IoSize != 65536 {
+			t.Errorf("NameMaxLength %d: unexpected result %+v", tc.nameMax, *op)
+		}
+	}
+}
+
+func TestMaxBackground(t *testing.T) {
+	testCases := []struct {
+		cfg                      fuse.MountConfig
+		maxBackground, congested float64
+	}{
+		{fuse.MountConfig{}, 12, 9},
+		{fuse.MountConfig{MaxBackground: 64}, 64, 48},
+		{fuse.MountConfig{MaxBackground: 64, CongestionThreshold: 16}, 64, 16},
+		{fuse.MountConfig{CongestionThreshold: 100}, 12, 12},
+	}
+
+	for i, tc := range testCases {
+		var buf bytes.Buffer
+		tc.cfg.WireLogger = &buf
+		k, err := Start(memfs.NewMemFS(0, 0), &tc.cfg)
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		k.Close()
+
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var wlog fuse.WireLogRecord
+			if err := dec.Decode(&wlog); err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if wlog.Operation != "Mount" {
+				continue
+			}
+
+			// Numbers decode as float64.
+			if got := wlog.Args["MaxBackground"]; got != tc.maxBackground {
+				t.Errorf("case %d: MaxBackground = %v, want %v", i, got, tc.maxBackground)
+			}
+			if got := wlog.Args["CongestionThreshold"]; got != tc.congested {
+				t.Errorf("case %d: CongestionThreshold = %v, want %v", i, got, tc.congested)
+			}
+		}
+	}
+}
+
+func TestRecycleOps(t *testing.T) {
+	ctx := context.Background()
+	k, err := Start(memfs.NewMemFS(0, 0), &fuse.MountConfig{RecycleOps: true})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	create := &fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "foo", Mode: 0644}
+	if err := k.Do(ctx, create); err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+
+	// Recycled ops must not carry anything over from their previous use.
+	for i := 0; i < 100; i++ {
+		data := []byte(strings.Repeat("x", i+1))
+		write := &fuseops.WriteFileOp{Inode: create.Entry.Child, Handle: create.Handle, Data: data}
+		if err := k.Do(ctx, write); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+
+		read := &fuseops.ReadFileOp{Inode: create.Entry.Child, Handle: create.Handle, Size: 1000}
+		if err := k.Do(ctx, read); err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		if got := string(read.Dst[:read.BytesRead]); got != string(data) {
+			t.Fatalf("read %q, want %q", got, data)
+		}
+
+		lookUp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "foo"}
+		if i%2 == 1 {
+			lookUp.Name = "bar"
+		}
+		err := k.Do(ctx, lookUp)
+		switch {
+		case i%2 == 0 && (err != nil || lookUp.Entry.Child != create.Entry.Child):
+			t.Fatalf("LookUpInode(foo): %v %v", err, lookUp.Entry.Child)
+		case i%2 == 1 && err != syscall.ENOENT:
+			t.Fatalf("LookUpInode(bar): expected ENOENT, got %v", err)
+		}
+	}
+}
@@ -73,6 +73,13 @@ type fileLock struct {
 	Pid   uint32
 }
 
+// Values of fileLock.Type, as for fcntl(2).
+const (
+	LockRead   = 0 // F_RDLCK
+	LockWrite  = 1 // F_WRLCK
+	LockUnlock = 2 // F_UNLCK
+)
+
 // GetattrFlags are bit flags that can be seen in GetattrRequest.
 type GetattrFlags uint32
 
@@ -103,9 +110,10 @@ const (
 	SetattrHandle SetattrValid = 1 << 6
 
 	// Linux only(?)
-	SetattrAtimeNow  SetattrValid = 1 << 7
-	SetattrMtimeNow  SetattrValid = 1 << 8
-	SetattrLockOwner SetattrValid = 1 << 9 // http://www.mail-archive.com/git-commits-head@vger.kernel.org/msg27852.html
+	SetattrAtimeNow    SetattrValid = 1 << 7
+	SetattrMtimeNow    SetattrValid = 1 << 8
+	SetattrLockOwner   SetattrValid = 1 << 9  // http://www.mail-archive.com/git-commits-head@vger.kernel.org/msg27852.html
+	SetattrKillSuidgid SetattrValid = 1 << 11 // the file system must clear setuid/setgid (InitHandleKillprivV2)
 
 	// OS X only
 	SetattrCrtime   SetattrValid = 1 << 28
@@ -144,6 +152,7 @@ var setattrValidNames = []flagName{
 	{uint32(SetattrAtimeNow), "SetattrAtimeNow"},
 	{uint32(SetattrMtimeNow), "SetattrMtimeNow"},
 	{uint32(SetattrLockOwner), "SetattrLockOwner"},
+	{uint32(SetattrKillSuidgid), "SetattrKillSuidgid"},
 	{uint32(SetattrCrtime), "SetattrCrtime"},
 	{uint32(SetattrChgtime), "SetattrChgtime"},
 	{uint32(SetattrBkuptime), "SetattrBkuptime"},
@@ -204,6 +213,11 @@ func (fl OpenFlags) IsAppend() bool {
 	return fl&OpenAppend != 0
 }
 
+// Return true if OpenTruncate is set.
+func (fl OpenFlags) IsTruncate() bool {
+	return fl&OpenTruncate != 0
+}
+
 func accModeName(flags OpenFlags) string {
 	switch flags {
 	case OpenReadOnly:
@@ -229,10 +243,14 @@ var openFlagNames = []flagName{
 type OpenResponseFlags uint32
 
 const (
-	OpenDirectIO    OpenResponseFlags = 1 << 0 // bypass page cache for this open file
-	OpenKeepCache   OpenResponseFlags = 1 << 1 // don't invalidate the data cache on open
-	OpenNonSeekable OpenResponseFlags = 1 << 2 // mark the file as non-seekable (not supported on OS X)
-	OpenCacheDir    OpenResponseFlags = 1 << 3 // allow caching this directory
+	OpenDirectIO             OpenResponseFlags = 1 << 0 // bypass page cache for this open file
+	OpenKeepCache            OpenResponseFlags = 1 << 1 // don't invalidate the data cache on open
+	OpenNonSeekable          OpenResponseFlags = 1 << 2 // mark the file as non-seekable (not supported on OS X)
+	OpenCacheDir             OpenResponseFlags = 1 << 3 // allow caching this directory
+	OpenStream               OpenResponseFlags = 1 << 4 // the file is stream-like (no file position at all)
+	OpenNoFlush              OpenResponseFlags = 1 << 5 // don't flush data cache on close (unless writeback caching is on)
+	OpenParallelDirectWrites OpenResponseFlags = 1 << 6 // allow concurrent direct writes on the same inode
+	OpenPassthrough          OpenResponseFlags = 1 << 7 // serve I/O from OpenOut.BackingID (Linux 6.9+)
 
 	OpenPurgeAttr OpenResponseFlags = 1 << 30 // OS X
 	OpenPurgeUBC  OpenResponseFlags = 1 << 31 // OS X
@@ -247,6 +265,10 @@ var openResponseFlagNames = []flagName{
 	{uint32(OpenKeepCache), "OpenKeepCache"},
 	{uint32(OpenNonSeekable), "OpenNonSeekable"},
 	{uint32(OpenCacheDir), "OpenCacheDir"},
+	{uint32(OpenStream), "OpenStream"},
+	{uint32(OpenNoFlush), "OpenNoFlush"},
+	{uint32(OpenParallelDirectWrites), "OpenParallelDirectWrites"},
+	{uint32(OpenPassthrough), "OpenPassthrough"},
 	{uint32(OpenPurgeAttr), "OpenPurgeAttr"},
 	{uint32(OpenPurgeUBC), "OpenPurgeUBC"},
 }
@@ -274,15 +296,38 @@ const (
 	InitWritebackCache   InitFlags = 1 << 16
 	InitNoOpenSupport    InitFlags = 1 << 17
 	InitParallelDirOps   InitFlags = 1 << 18
+	InitPosixACL         InitFlags = 1 << 20
 	InitMaxPages         InitFlags = 1 << 22
 	InitCacheSymlinks    InitFlags = 1 << 23
 	InitNoOpendirSupport InitFlags = 1 << 24
+	InitHandleKillprivV2 InitFlags = 1 << 28
 
 	InitCaseSensitive InitFlags = 1 << 29 // OS X only
 	InitVolRename     InitFlags = 1 << 30 // OS X only
 	InitXtimes        InitFlags = 1 << 31 // OS X only
+
+	// On Linux, indicates that InitIn and InitOut carry InitFlags2.
+	InitExt InitFlags = 1 << 30
 )
 
+// The InitFlags2 are the upper 32 bits of the init flags, exchanged if both
+// sides set InitExt.
+type InitFlags2 uint32
+
+const (
+	InitSecurityCtx InitFlags2 = 1 << 0
+	InitPassthrough InitFlags2 = 1 << 5
+)
+
+func (fl InitFlags2) String() string {
+	return flagString(uint32(fl), initFlags2Names)
+}
+
+var initFlags2Names = []flagName{
+	{uint32(InitSecurityCtx), "InitSecurityCtx"},
+	{uint32(InitPassthrough), "InitPassthrough"},
+}
+
 type flagName struct {
 	bit  uint32
 	name string
@@ -308,8 +353,10 @@ var initFlagNames = []flagName{
 	{uint32(InitAsyncDIO), "InitAsyncDIO"},
 	{uint32(InitWritebackCache), "InitWritebackCache"},
 	{uint32(InitNoOpenSupport), "InitNoOpenSupport"},
+	{uint32(InitPosixACL), "InitPosixACL"},
 	{uint32(InitCacheSymlinks), "InitCacheSymlinks"},
 	{uint32(InitNoOpendirSupport), "InitNoOpendirSupport"},
+	{uint32(InitHandleKillprivV2), "InitHandleKillprivV2"},
 
 	{uint32(InitCaseSensitive), "InitCaseSensitive"},
 	{uint32(InitVolRename), "InitVolRename"},
@@ -343,7 +390,8 @@ func flagString(f uint32, names []flagName) string {
 type ReleaseFlags uint32
 
 const (
-	ReleaseFlush ReleaseFlags = 1 << 0
+	ReleaseFlush       ReleaseFlags = 1 << 0
+	ReleaseFlockUnlock ReleaseFlags = 1 << 1
 )
 
 func (fl ReleaseFlags) String() string {
@@ -352,6 +400,7 @@ func (fl ReleaseFlags) String() string {
 
 var releaseFlagNames = []flagName{
 	{uint32(ReleaseFlush), "ReleaseFlush"},
+	{uint32(ReleaseFlockUnlock), "ReleaseFlockUnlock"},
 }
 
 // Opcodes
@@ -394,6 +443,7 @@ const (
 	OpDestroy     = 38
 	OpIoctl       = 39 // Linux?
 	OpPoll        = 40 // Linux?
+	OpNotifyReply = 41
 	OpBatchForget = 42
 	OpFallocate   = 43
 	OpReaddirplus = 44
@@ -404,6 +454,8 @@ const (
 	OpSetupMapping  = 48
 	OpRemoveMapping = 49
 	OpSyncFS        = 50
+	OpTmpfile       = 51
+	OpStatx         = 52
 
 	// OS X
 	OpSetvolname = 61
@@ -450,6 +502,58 @@ type GetattrIn struct {
 	Fh           uint64
 }
 
+type StatxIn struct {
+	GetattrFlags uint32
+	reserved     uint32
+	Fh           uint64
+	SxFlags      uint32
+	SxMask       uint32
+}
+
+// The masks of statx(2), which are the same on all platforms that have it.
+const (
+	StatxBasicStats = 0x7ff
+	StatxBtime      = 0x800
+)
+
+type SxTime struct {
+	Sec      int64
+	Nsec     uint32
+	reserved int32
+}
+
+type Statx struct {
+	Mask           uint32
+	Blksize        uint32
+	Attributes     uint64
+	Nlink          uint32
+	Uid            uint32
+	Gid            uint32
+	Mode           uint16
+	spare0         uint16
+	Ino            uint64
+	Size           uint64
+	Blocks         uint64
+	AttributesMask uint64
+	Atime          SxTime
+	Btime          SxTime
+	Ctime          SxTime
+	Mtime          SxTime
+	RdevMajor      uint32
+	RdevMinor      uint32
+	DevMajor       uint32
+	DevMinor       uint32
+	spare2         [14]uint64
+}
+
+type StatxOut struct {
+	AttrValid     uint64
+	AttrValidNsec uint32
+	Flags         uint32
+	spare         [2]uint64
+	Stat          Statx
+}
+
 type AttrOut struct {
 	AttrValid     uint64 // Cache timeout for the attributes
 	AttrValidNsec uint32
@@ -511,6 +615,13 @@ type RenameIn struct {
 	// "oldname\x00newname\x00" follows
 }
 
+type Rename2In struct {
+	Newdir  uint64
+	Flags   uint32
+	Padding uint32
+	// "oldname\x00newname\x00" follows
+}
+
 // OS X
 type ExchangeIn struct {
 	Olddir  uint64
@@ -542,21 +653,28 @@ type setattrInCommon struct {
 }
 
 type OpenIn struct {
-	Flags  uint32
-	Unused uint32
+	Flags     uint32
+	OpenFlags uint32 // OpenInKillSuidgid, since protocol 7.33
 }
 
+// Flags that can be seen in OpenIn.OpenFlags and CreateIn.OpenFlags.
+const (
+	// The file system must clear setuid/setgid as it truncates the file
+	// (InitHandleKillprivV2).
+	OpenInKillSuidgid uint32 = 1 << 0
+)
+
 type OpenOut struct {
 	Fh        uint64
 	OpenFlags uint32
-	Padding   uint32
+	BackingID int32 // If OpenFlags has OpenPassthrough
 }
 
 type CreateIn struct {
-	Flags   uint32
-	Mode    uint32
-	Umask   uint32
-	padding uint32
+	Flags     uint32
+	Mode      uint32
+	Umask     uint32
+	OpenFlags uint32 // OpenInKillSuidgid, since protocol 7.33
 }
 
 func CreateInSize(p Protocol) uintptr {
@@ -572,7 +690,7 @@ type ReleaseIn struct {
 	Fh           uint64
 	Flags        uint32
 	ReleaseFlags uint32
-	LockOwner    uint32
+	LockOwner    uint64
 }
 
 type FlushIn struct {
@@ -648,11 +766,14 @@ const (
 	WriteCache WriteFlags = 1 << 0
 	// LockOwner field is valid.
 	WriteLockOwner WriteFlags = 1 << 1
+	// The file system must clear setuid/setgid (InitHandleKillprivV2).
+	WriteKillSuidgid WriteFlags = 1 << 2
 )
 
 var writeFlagNames = []flagName{
 	{uint32(WriteCache), "WriteCache"},
 	{uint32(WriteLockOwner), "WriteLockOwner"},
+	{uint32(WriteKillSuidgid), "WriteKillSuidgid"},
 }
 
 func (fl WriteFlags) String() string {
@@ -707,6 +828,42 @@ type FallocateIn struct {
 	Padding uint32
 }
 
+type CopyFileRangeIn struct {
+	FhIn      uint64
+	OffIn     uint64
+	NodeidOut uint64
+	FhOut     uint64
+	OffOut    uint64
+	Len       uint64
+	Flags     uint64
+}
+
+type LseekIn struct {
+	Fh      uint64
+	Offset  uint64
+	Whence  uint32
+	Padding uint32
+}
+
+type LseekOut struct {
+	Offset uint64
+}
+
+type PollIn struct {
+	Fh     uint64
+	Kh     uint64
+	Flags  uint32
+	Events uint32
+}
+
+// Flags for PollIn.
+const PollScheduleNotify = 1 << 0
+
+type PollOut struct {
+	Revents uint32
+	Padding uint32
+}
+
 type LkIn struct {
 	Fh      uint64
 	Owner   uint64
@@ -715,6 +872,9 @@ type LkIn struct {
 	padding uint32
 }
 
+// Flags for LkIn.
+const LkFlock = 1 << 0
+
 func LkInSize(p Protocol) uintptr {
 	switch {
 	case p.LT(Protocol{7, 9}):
@@ -753,9 +913,26 @@ type InitOut struct {
 	TimeGran            uint32
 	MaxPages            uint16
 	MapAlignment        uint16
-	Unused              [8]uint32
+	Flags2              uint32
+	MaxStackDepth       uint32
+	Unused              [6]uint32
+}
+
+// The argument to the DevIocBackingOpen ioctl on the fuse device, which
+// registers a backing file for passthrough and returns its ID.
+type BackingMap struct {
+	Fd      int32
+	Flags   uint32
+	Padding uint64
 }
 
+// Ioctls on the fuse device: _IOW(229, 1, struct fuse_backing_map) and
+// _IOW(229, 2, uint32_t).
+const (
+	DevIocBackingOpen  = 0x4010e501
+	DevIocBackingClose = 0x4004e502
+)
+
 type InterruptIn struct {
 	Unique uint64
 }
@@ -771,13 +948,39 @@ type BmapOut struct {
 }
 
 type InHeader struct {
-	Len     uint32
-	Opcode  uint32
-	Unique  uint64
-	Nodeid  uint64
-	Uid     uint32
-	Gid     uint32
-	Pid     uint32
+	Len         uint32
+	Opcode      uint32
+	Unique      uint64
+	Nodeid      uint64
+	Uid         uint32
+	Gid         uint32
+	Pid         uint32
+	TotalExtlen uint16 // Length of the extensions, in units of 8 bytes
+	Padding     uint16
+}
+
+// Since protocol 7.38, requests may be followed by extensions, each starting
+// with an ExtHeader whose Size includes the header and is a multiple of 8.
+type ExtHeader struct {
+	Size uint32
+	Type uint32
+}
+
+// Extension types.
+const (
+	// The extension holds a SecctxHeader followed by NrSecctx records, each a
+	// Secctx, the NUL-terminated name of the context, and the context itself,
+	// padded to a multiple of 8 bytes.
+	ExtSecctx = 31
+)
+
+type SecctxHeader struct {
+	Size     uint32
+	NrSecctx uint32
+}
+
+type Secctx struct {
+	Size    uint32
 	Padding uint32
 }
 
@@ -803,6 +1006,9 @@ const (
 	NotifyCodePoll       int32 = 1
 	NotifyCodeInvalInode int32 = 2
 	NotifyCodeInvalEntry int32 = 3
+	NotifyCodeStore      int32 = 4
+	NotifyCodeRetrieve   int32 = 5
+	NotifyCodeDelete     int32 = 6
 )
 
 type NotifyInvalInodeOut struct {
@@ -811,12 +1017,52 @@ type NotifyInvalInodeOut struct {
 	Len int64
 }
 
-type NotifyInvalEntryOut struct {
+type NotifyStoreOut struct {
+	Nodeid  uint64
+	Offset  uint64
+	Size    uint32
+	padding uint32
+}
+
+type NotifyRetrieveOut struct {
+	NotifyUnique uint64
+	Nodeid       uint64
+	Offset       uint64
+	Size         uint32
+	padding      uint32
+}
+
+// The body of the OpNotifyReply with which the kernel answers a retrieve
+// notification, followed by the data.
+type NotifyRetrieveIn struct {
+	dummy1 uint64
+	Offset uint64
+	Size   uint32
+	dummy2 uint32
+	dummy3 uint64
+	dummy4 uint64
+}
+
+type NotifyDeleteOut struct {
 	Parent  uint64
+	Child   uint64
 	Namelen uint32
 	padding uint32
 }
 
+type NotifyPollWakeupOut struct {
+	Kh uint64
+}
+
+type NotifyInvalEntryOut struct {
+	Parent  uint64
+	Namelen uint32
+	Flags   uint32
+}
+
+// Flags for NotifyInvalEntryOut.
+const NotifyExpireOnly uint32 = 1 << 0
+
 type SyncFSIn struct {
 	Padding uint64
 }
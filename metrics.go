@@ -0,0 +1,48 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"reflect"
+	"syscall"
+	"time"
+)
+
+// A MetricsSink receives a cheap summary of every op handled by a connection,
+// from which metrics such as per-op counters, errno distributions, latency
+// histograms, and in-flight gauges can be derived. Unlike the wire log, no
+// per-op allocation or reflection over the op's fields is involved.
+//
+// Ops are identified by the name of their type, e.g. "LookUpInodeOp". See the
+// fuseotel package for an implementation based on OpenTelemetry metrics,
+// which may in turn be exported to Prometheus.
+//
+// Methods may be called concurrently.
+type MetricsSink interface {
+	// OpStarted is called when an op has been read from the kernel, before it
+	// is returned by Connection.ReadOp.
+	OpStarted(op string)
+
+	// OpFinished is called when the op has been replied to. errno is the
+	// error sent to the kernel, which is zero if the op succeeded and EIO if
+	// it failed with an error that is not a syscall.Errno. latency is the time
+	// since the matching OpStarted call.
+	OpFinished(op string, errno syscall.Errno, latency time.Duration)
+}
+
+// Return the name under which an op is reported to the wire log and metrics.
+func opTypeName(op any) string {
+	return reflect.TypeOf(op).Elem().Name()
+}
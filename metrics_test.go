@@ -0,0 +1,77 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+// A MetricsSink that records the errno of each finished op.
+type errnoSink struct {
+	mu     sync.Mutex
+	errnos map[string]syscall.Errno
+}
+
+func (s *errnoSink) OpStarted(op string) {}
+
+func (s *errnoSink) OpFinished(op string, errno syscall.Errno, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errnos[op] = errno
+}
+
+// A file system whose StatFS fails with an error that isn't an errno.
+type statFSErrorFS struct {
+	fuseutil.NotImplementedFileSystem
+}
+
+func (fs *statFSErrorFS) StatFS(
+	ctx context.Context,
+	op *fuseops.StatFSOp) error {
+	return errors.New("taco")
+}
+
+func TestMetricsSinkNonErrno(t *testing.T) {
+	sink := &errnoSink{errnos: make(map[string]syscall.Errno)}
+
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(&statFSErrorFS{}), &fuse.MountConfig{
+		MetricsSink: sink,
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if err := k.Do(context.Background(), &fuseops.StatFSOp{}); err != syscall.EIO {
+		t.Errorf("StatFS: %v, want EIO", err)
+	}
+	k.Close()
+
+	// The sink sees the errno that the kernel saw.
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if got := sink.errnos["StatFSOp"]; got != syscall.EIO {
+		t.Errorf("sink saw errno %v, want EIO", got)
+	}
+}
@@ -47,12 +47,6 @@ func Mount(
 		return nil, err
 	}
 
-	// Initialize the struct.
-	mfs := &MountedFileSystem{
-		dir:                 dir,
-		joinStatusAvailable: make(chan struct{}),
-	}
-
 	// Begin the mounting process, which will continue in the background.
 	if config.DebugLogger != nil {
 		config.DebugLogger.Println("Beginning the mounting kickoff process")
@@ -66,6 +60,49 @@ func Mount(
 		config.DebugLogger.Println("Completed the mounting kickoff process")
 	}
 
+	return serve(dir, dev, ready, nil, server, config)
+}
+
+// MountFromFD serves a file system over an already open FUSE device, using
+// the supplied Server, without mounting anything itself. This lets a
+// privileged process, such as a container runtime, open /dev/fuse and mount
+// it, then pass the descriptor to an unprivileged one that serves it. It is
+// equivalent to calling Mount with the directory "/dev/fd/N" on Linux, which
+// is also what Dir returns. The file system must be unmounted by whoever
+// mounted it; Unmount fails with ErrExternallyManagedMountPoint.
+//
+// The descriptor is owned by the returned MountedFileSystem, and closed when
+// serving ends.
+func MountFromFD(
+	fd int,
+	server Server,
+	config *MountConfig) (*MountedFileSystem, error) {
+	if fd < 0 {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
+	}
+
+	ready := make(chan error, 1)
+	ready <- nil
+	dev := os.NewFile(uintptr(fd), "/dev/fuse")
+	return serve(fmt.Sprintf("/dev/fd/%d", fd), dev, ready, nil, server, config)
+}
+
+// Serve the FUSE device dev, connected to the mount point dir, waiting for
+// an error to be written to ready once the mount has completed. If state is
+// non-nil, the connection has already been initialized by another process.
+func serve(
+	dir string,
+	dev *os.File,
+	ready <-chan error,
+	state *ConnectionState,
+	server Server,
+	config *MountConfig) (*MountedFileSystem, error) {
+	// Initialize the struct.
+	mfs := &MountedFileSystem{
+		dir:                 dir,
+		joinStatusAvailable: make(chan struct{}),
+	}
+
 	// Choose a parent context for ops.
 	cfgCopy := *config
 	if cfgCopy.OpContext == nil {
@@ -81,13 +118,15 @@ func Mount(
 		config.DebugLogger,
 		config.ErrorLogger,
 		config.WireLogger,
-		dev)
+		dev,
+		state)
 	if err != nil {
 		return nil, fmt.Errorf("newConnection: %v", err)
 	}
 	if config.DebugLogger != nil {
 		config.DebugLogger.Println("Successfully created the connection")
 	}
+	mfs.conn = connection
 
 	// Serve the connection in the background. When done, set the join status.
 	go func() {
@@ -129,13 +168,26 @@ func checkMountPoint(dir string) error {
 }
 
 func fusermount(binary string, argv []string, additionalEnv []string, wait bool, debugLogger *log.Logger) (*os.File, error) {
+	dev, socket, err := fusermountWithSocket(binary, argv, additionalEnv, wait, debugLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	socket.Close()
+	return dev, nil
+}
+
+// Like fusermount, but also return our end of the socket the helper passed
+// the device over, rather than closing it. A helper run with auto_unmount
+// keeps running, and unmounts the file system once the socket is closed.
+func fusermountWithSocket(binary string, argv []string, additionalEnv []string, wait bool, debugLogger *log.Logger) (dev, socket *os.File, err error) {
 	if debugLogger != nil {
 		debugLogger.Println("Creating a socket pair")
 	}
 	// Create a socket pair.
 	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
 	if err != nil {
-		return nil, fmt.Errorf("Socketpair: %v", err)
+		return nil, nil, fmt.Errorf("Socketpair: %v", err)
 	}
 
 	if debugLogger != nil {
@@ -146,7 +198,11 @@ func fusermount(binary string, argv []string, additionalEnv []string, wait bool,
 	defer writeFile.Close()
 
 	readFile := os.NewFile(uintptr(fds[1]), "fusermount-parent-reads")
-	defer readFile.Close()
+	defer func() {
+		if err != nil {
+			readFile.Close()
+		}
+	}()
 
 	if debugLogger != nil {
 		debugLogger.Println("Starting fusermount/os mount")
@@ -165,7 +221,13 @@ func fusermount(binary string, argv []string, additionalEnv []string, wait bool,
 		err = cmd.Start()
 	}
 	if err != nil {
-		return nil, fmt.Errorf("running %v: %v", binary, err)
+		return nil, nil, fmt.Errorf("running %v: %v", binary, err)
+	}
+
+	// Reap a helper we didn't wait for when it exits, so that it doesn't linger
+	// as a zombie for the life of the process.
+	if !wait {
+		go cmd.Wait()
 	}
 
 	if debugLogger != nil {
@@ -174,7 +236,7 @@ func fusermount(binary string, argv []string, additionalEnv []string, wait bool,
 	// Wrap the socket file in a connection.
 	c, err := net.FileConn(readFile)
 	if err != nil {
-		return nil, fmt.Errorf("FileConn: %v", err)
+		return nil, nil, fmt.Errorf("FileConn: %v", err)
 	}
 	defer c.Close()
 
@@ -184,7 +246,7 @@ func fusermount(binary string, argv []string, additionalEnv []string, wait bool,
 	// We expect to have a Unix domain socket.
 	uc, ok := c.(*net.UnixConn)
 	if !ok {
-		return nil, fmt.Errorf("Expected UnixConn, got %T", c)
+		return nil, nil, fmt.Errorf("Expected UnixConn, got %T", c)
 	}
 
 	if debugLogger != nil {
@@ -195,18 +257,18 @@ func fusermount(binary string, argv []string, additionalEnv []string, wait bool,
 	oob := make([]byte, 32) // expect 24 bytes
 	_, oobn, _, _, err := uc.ReadMsgUnix(buf, oob)
 	if err != nil {
-		return nil, fmt.Errorf("ReadMsgUnix: %v", err)
+		return nil, nil, fmt.Errorf("ReadMsgUnix: %v", err)
 	}
 
 	// Parse the message.
 	scms, err := syscall.ParseSocketControlMessage(oob[:oobn])
 	if err != nil {
-		return nil, fmt.Errorf("ParseSocketControlMessage: %v", err)
+		return nil, nil, fmt.Errorf("ParseSocketControlMessage: %v", err)
 	}
 
 	// We expect one message.
 	if len(scms) != 1 {
-		return nil, fmt.Errorf("expected 1 SocketControlMessage; got scms = %#v", scms)
+		return nil, nil, fmt.Errorf("expected 1 SocketControlMessage; got scms = %#v", scms)
 	}
 
 	scm := scms[0]
@@ -218,16 +280,16 @@ func fusermount(binary string, argv []string, additionalEnv []string, wait bool,
 	// Pull out the FD returned by fusermount
 	gotFds, err := syscall.ParseUnixRights(&scm)
 	if err != nil {
-		return nil, fmt.Errorf("syscall.ParseUnixRights: %v", err)
+		return nil, nil, fmt.Errorf("syscall.ParseUnixRights: %v", err)
 	}
 
 	if len(gotFds) != 1 {
-		return nil, fmt.Errorf("wanted 1 fd; got %#v", gotFds)
+		return nil, nil, fmt.Errorf("wanted 1 fd; got %#v", gotFds)
 	}
 
 	if debugLogger != nil {
 		debugLogger.Println("Converting FD into os.File")
 	}
 	// Turn the FD into an os.File.
-	return os.NewFile(uintptr(gotFds[0]), "/dev/fuse"), nil
+	return os.NewFile(uintptr(gotFds[0]), "/dev/fuse"), readFile, nil
 }
@@ -19,8 +19,15 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"math"
 	"runtime"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/buffer"
 )
 
 // Optional configuration accepted by Mount.
@@ -29,6 +36,83 @@ type MountConfig struct {
 	// should inherit. If nil, context.Background() will be used.
 	OpContext context.Context
 
+	// If positive, the longest that an op may go without being replied to.
+	// Once it is exceeded, the op's context is cancelled and the kernel is
+	// replied to with OpTimeoutErrno, so that the process waiting on the op
+	// isn't stuck forever if the file system hangs, for example on an RPC to
+	// its backend. The server must still reply to the op once it is done
+	// with it, but the reply is discarded.
+	//
+	// ForgetInodeOp and BatchForgetOp, to which the kernel expects no reply,
+	// never time out.
+	//
+	// An op that times out but then succeeds has no effect as far as the
+	// kernel is concerned. For ops that hand the kernel a reference, that
+	// reference leaks: the lookup count of the inode returned by LookUpInode,
+	// MkDir, MkNode, CreateFile, CreateSymlink, CreateLink, or the entries
+	// of ReadDirPlus is never forgotten, and the handle returned by OpenFile,
+	// OpenDir, or CreateFile is never released. Servers that must keep exact
+	// counts should give those ops a negative timeout in OpTimeouts, or undo
+	// their effect once ctx is done.
+	OpTimeout time.Duration
+
+	// Overrides of OpTimeout for particular ops, keyed by the name of their
+	// type, e.g. "ReadFileOp". A negative value means that the op never times
+	// out.
+	OpTimeouts map[string]time.Duration
+
+	// The error with which ops that time out are replied to. If zero,
+	// ETIMEDOUT is used.
+	OpTimeoutErrno syscall.Errno
+
+	// Which ops have their context cancelled when the kernel interrupts them,
+	// typically because the calling process received a signal. By default,
+	// all do. Handlers of ops whose contexts aren't cancelled run to
+	// completion, and the calling process waits for them unless it is killed.
+	InterruptPolicy InterruptPolicy
+
+	// With InterruptCancelListed, the ops to cancel when interrupted, keyed by
+	// the name of their type, e.g. "ReadFileOp".
+	InterruptibleOps map[string]bool
+
+	// Flag to reuse the structs for the most common ops, such as
+	// LookUpInodeOp, GetInodeAttributesOp, ReadFileOp, and WriteFileOp, once
+	// they have been replied to, rather than allocating new ones, to reduce
+	// garbage collection. The server must then not use an op, or anything it
+	// refers to, after replying to it. The Callback of a ReadFileOp or
+	// WriteFileOp runs before the op is reused.
+	RecycleOps bool
+
+	// Flag to merge forget requests that the kernel has queued back to back,
+	// as it does in large numbers when unmounting or dropping its caches, into
+	// a single BatchForgetOp, so that they are handled in one call rather than
+	// one each. Lookup counts for the same inode are summed. ForgetInodeOp is
+	// then never sent to the server.
+	//
+	// Ignored if Concurrency.Readers is greater than one: a reader can only
+	// tell that another forget is queued before reading it, and another reader
+	// might take it in between, leaving the first blocked with the forgets it
+	// has merged until the kernel sends something else.
+	CoalesceForgets bool
+
+	// Replies to ops that the file system doesn't implement, keyed by the name
+	// of their type, e.g. "ReleaseFileHandleOp". Once the server has replied
+	// ENOSYS to an op of such a type, that op and later ones of the type are
+	// replied to with the given error instead, which may be nil, and later
+	// ones are answered without being passed to the server at all. This is
+	// for ops that the kernel keeps sending however they're answered; it
+	// stops sending others, such as FlushFileOp and GetXattrOp, itself. See
+	// DefaultNotImplementedReplies, and Connection.NotImplementedOps for the
+	// ops that have been replied ENOSYS to.
+	NotImplementedReplies map[string]error
+
+	// How the server is to spread the work of reading and handling ops across
+	// goroutines. By default, a single goroutine reads ops and each is handled
+	// on a goroutine of its own. This is honored by the server returned by
+	// fuseutil.NewFileSystemServer; other servers can find it with
+	// Connection.Concurrency.
+	Concurrency ServerConcurrency
+
 	// If non-empty, the name of the file system as displayed by e.g. `mount`.
 	// This is important because the `umount` command requires root privileges if
 	// it doesn't agree with /etc/fstab.
@@ -50,8 +134,100 @@ type MountConfig struct {
 
 	// A logger to use for logging fuse wire requests. If nil, no wire logging is
 	// performed.
+	//
+	// Records are written synchronously when each op is replied to. Wrap the
+	// writer with NewAsyncWireLogWriter to keep slow writers off of the op path.
+	//
+	// The logger can be changed after mounting with
+	// MountedFileSystem.SetWireLogger.
 	WireLogger io.Writer
 
+	// If set, only ops that returned an error are written to WireLogger.
+	//
+	// This may be combined with WireLogSlowThreshold, in which case a record is
+	// written if the op either failed or was slow.
+	WireLogErrorsOnly bool
+
+	// If non-zero, only ops that took at least this long to be replied to are
+	// written to WireLogger. See also WireLogErrorsOnly.
+	WireLogSlowThreshold time.Duration
+
+	// The formatter used to turn each WireLogRecord into the bytes written to
+	// WireLogger. If nil, JSONWireLogFormatter is used.
+	WireLogFormatter WireLogFormatter
+
+	// If set and WireLogFormatter is nil, each record is written to WireLogger
+	// as a single line of JSON rather than pretty-printed, producing NDJSON
+	// output. Equivalent to setting WireLogFormatter to
+	// JSONWireLogFormatter{Compact: true}.
+	WireLogCompactJSON bool
+
+	// If positive, wire log records for ReadFileOp and WriteFileOp include a
+	// "Payload" arg holding the first WireLogPayloadBytes bytes of the data read
+	// or written, hex-encoded. This is useful for debugging data corruption,
+	// but makes records larger and may expose file contents.
+	WireLogPayloadBytes int
+
+	// If set, wire log records for ReadDir and ReadDirPlus ops include the
+	// names of the entries returned, in addition to their count.
+	WireLogDirentNames bool
+
+	// If set, wire log records include a "Path" arg holding the path of the
+	// file the op refers to, relative to the mount point, when it is known.
+	// Paths are learned from the directory entries returned by LookUpInode,
+	// ReadDirPlus and friends, so ops on inodes the kernel learned of before wire logging
+	// began may lack one. Costs some memory per inode known to the kernel.
+	WireLogResolvePaths bool
+
+	// If set, wire log records for ops on a file or directory handle carry a
+	// HandleSession identifying the handle from the op that opened it to the
+	// op that released it, and a "HandleSummary" record is written when each
+	// handle is released. See WireLogRecord.
+	WireLogHandleSessions bool
+
+	// If non-nil, called on the Args of each wire log record before it is
+	// written to WireLogger or WireLogHandler or passed to OpTracer. See
+	// RedactWireLogArgs and HashWireLogArgs for ready-made redactors.
+	WireLogRedactor WireLogRedactor
+
+	// If non-nil, wire log records are also sent to this handler, as an
+	// alternative or in addition to WireLogger. Each record is logged at
+	// slog.LevelInfo, or slog.LevelWarn if the op failed, with the operation
+	// name as the message and the record's Context, Args, and Extra as
+	// attribute groups. WireLogErrorsOnly and WireLogSlowThreshold apply here
+	// too.
+	//
+	// The handler is called synchronously when each op is replied to, and must
+	// not retain the record's attribute values after Handle returns.
+	WireLogHandler slog.Handler
+
+	// If non-nil, called when each op is read to find the W3C trace context, as
+	// a traceparent header value, that it belongs to, for example by looking up
+	// the calling process. The result is recorded in the op's wire log record
+	// and may be changed by the server with SetTraceParent; an OpTracer may use
+	// it as the parent of the op's span.
+	WireLogTraceParent func(ctx fuseops.OpContext) string
+
+	// If non-nil, notified when each op begins and ends. See OpTracer.
+	OpTracer OpTracer
+
+	// If non-nil, informed of the start and end of each op, for the purposes
+	// of exporting metrics. See MetricsSink.
+	MetricsSink MetricsSink
+
+	// If non-nil, the raw bytes of every message read from and written to the
+	// kernel are recorded here, for debugging compatibility problems below the
+	// level of ops. Decode the capture with WireCaptureReader, or the
+	// samples/decode_wirecapture tool.
+	//
+	// Messages are recorded synchronously as they are read and written.
+	WireCapture io.Writer
+
+	// If positive, at most this many bytes of each message are recorded in
+	// WireCapture, which is enough for the headers but keeps file data out of
+	// the capture.
+	WireCaptureSnapLen int
+
 	// Linux only. OS X always behaves as if writeback caching is disabled.
 	//
 	// By default on Linux we allow the kernel to perform writeback caching
@@ -148,15 +324,37 @@ type MountConfig struct {
 	// Linux only.
 	//
 	// Tell the kernel to treat returning -ENOSYS on OpenFile as not needing
-	// OpenFile calls at all (Linux >= 3.16):
+	// OpenFile calls at all (Linux >= 3.16), rather than as an error. Without
+	// this, stateless file systems must implement OpenFile even if it does
+	// nothing. See fuseops.OpenFileOp.
 	EnableNoOpenSupport bool
 
 	// Linux only.
 	//
 	// Tell the kernel to treat returning -ENOSYS on OpenDir as not needing
-	// OpenDir calls at all (Linux >= 5.1):
+	// OpenDir calls at all (Linux >= 5.1), rather than as an error. See
+	// fuseops.OpenDirOp.
 	EnableNoOpendirSupport bool
 
+	// Linux only.
+	//
+	// Normally mounting is first attempted directly with mount(2), which
+	// succeeds for root and processes with CAP_SYS_ADMIN, falling back to the
+	// setuid fusermount3 (or fusermount) helper found in $PATH when that is
+	// not permitted. This flag skips the direct attempt and always mounts via
+	// the helper, which records the mounting user so that they can unmount
+	// the file system without privileges. Unmount always uses the helper.
+	UseFusermount bool
+
+	// Linux only.
+	//
+	// Flag to have the fusermount helper unmount the file system if this
+	// process exits without doing so, for example because it crashed, rather
+	// than leaving behind a mount on which every operation fails with ENOTCONN.
+	// This implies UseFusermount, as mount(2) has no such option. The helper
+	// stays running alongside this process until the file system is unmounted.
+	AutoUnmount bool
+
 	// Disable FUSE default permissions.
 	// This is useful for situations where the backing data store (e.g., S3) doesn't
 	// actually utilise any form of qualifiable UNIX permissions.
@@ -169,10 +367,30 @@ type MountConfig struct {
 	// is used.
 	VolumeName string
 
+	// OS X with macFUSE only.
+	//
+	// Flag to let the kernel create "Apple Double" files, such as ._foo and
+	// .DS_Store, in which it stores metadata that the file system can't, like
+	// resource forks and Finder info. By default they are refused with the
+	// noappledouble mount option, since they add noise to debug output and can
+	// be costly for network-based file systems.
+	EnableAppleDouble bool
+
+	// OS X with macFUSE only.
+	//
+	// Flag to hide extended attributes in the com.apple namespace, such as
+	// com.apple.quarantine and com.apple.FinderInfo, from the file system,
+	// using the noapplexattr mount option. Getting them fails with ENOATTR
+	// and setting them is silently ignored, so the file system isn't asked to
+	// store metadata that only matters to the Finder.
+	DisableAppleXattr bool
+
 	// OS X only.
 	//
-	// The FUSE implementation to use. One of FUSEImplFuseT (default) or
-	// FUSEImplMacFUSE.
+	// The FUSE implementation to use. One of FUSEImplFuseT (default),
+	// FUSEImplMacFUSE, or FUSEImplAuto to use whichever is installed. FUSE-T
+	// is found at FUSET_SRV_PATH, or at the path in the FUSE_NFSSRV_PATH
+	// environment variable if set.
 	FuseImpl FUSEImpl
 
 	// Additional key=value options to pass unadulterated to the underlying mount
@@ -203,9 +421,91 @@ type MountConfig struct {
 	// When enabled, application calls to open with the O_TRUNC flag will cause a FUSE OpenFile
 	// op with the O_TRUNC flag set. In comparison, the default behavior is an OpenFile op
 	// without O_TRUNC, followed by a SetInodeAttributes op with the target size set to 0.
+	// File systems that set this must truncate the file when opening it; see
+	// fuseops.OpenFileOp.OpenFlags. Has no effect on kernels that don't support it.
 	// Ref: https://github.com/torvalds/linux/commit/6ff958edbf39c014eb06b65ad25b736be08c4e63
 	EnableAtomicTrunc bool
 
+	// Flag to have flock(2) locks implemented by the file system, which
+	// receives FlockOps for them, rather than by the kernel, which otherwise
+	// keeps them local to the machine. Has no effect on kernels that don't
+	// support it.
+	EnableFlockLocks bool
+
+	// Flag to allow OpenFileOp and CreateFileOp handlers to hand the I/O for a
+	// file to a backing file in another file system, with which the kernel then
+	// communicates directly. See MountedFileSystem.OpenBackingFile. This
+	// requires Linux 6.9 or later, and CAP_SYS_ADMIN to register backing
+	// files; it has no effect on kernels that don't support it.
+	EnablePassthrough bool
+
+	// Flag to ask the kernel not to apply the umask of the calling process to
+	// the Mode of MkDirOp, MkNodeOp, CreateFileOp, and CreateTmpFileOp, leaving
+	// it to the file system, which finds it in their Umask fields. This is
+	// needed to support default POSIX ACLs, which take the place of the umask
+	// in directories that have them. Has no effect on kernels that don't
+	// support it.
+	EnableDontMask bool
+
+	// Flag to have the kernel enforce the POSIX ACLs that the file system
+	// stores in the "system.posix_acl_access" and "system.posix_acl_default"
+	// extended attributes; see fuseutil.ACL for their format. The kernel then
+	// checks permissions itself, even if DisableDefaultPermissions is set,
+	// updates the mode of an inode with a SetInodeAttributesOp when its access
+	// ACL is set, and caches ACLs, so that GetXattrOps for them are
+	// infrequent.
+	//
+	// The kernel doesn't apply the umask of the calling process to new inodes
+	// when this is set, so file systems must apply either it or the default ACL
+	// of the parent directory themselves; see the Umask field of MkDirOp and
+	// friends. This is only supported on Linux; it has no effect on kernels
+	// that don't support it.
+	EnablePosixACL bool
+
+	// Flag to have the kernel pass the security labels, such as SELinux
+	// contexts, that new inodes should have in the SecurityContexts fields of
+	// MkDirOp, MkNodeOp, CreateFileOp, CreateTmpFileOp, and CreateSymlinkOp.
+	// This requires Linux 6.3 or later; it has no effect on kernels that don't
+	// support it.
+	EnableSecurityContext bool
+
+	// Flag to let the file system be exported over NFS, or have its files
+	// opened with open_by_handle_at(2), even once the kernel has evicted their
+	// inodes from its cache. The kernel encodes inode IDs and generation
+	// numbers in the file handles that it gives out, and resolves them later
+	// by sending LookUpInodeOps for "." and ".."; see LookUpInodeOp.Name. File
+	// systems must be able to answer those for any inode ID that may be in a
+	// file handle, and must change the generation number of an ID when they
+	// reuse it; see fuseops.GenerationNumber. This is only supported on Linux.
+	EnableExportSupport bool
+
+	// Flag to make the file system responsible for clearing the setuid and
+	// setgid bits of files written or truncated by unprivileged users, as
+	// indicated by the KillSuidGid fields of WriteFileOp,
+	// SetInodeAttributesOp, and OpenFileOp. Without it, the kernel clears the
+	// bits itself with a SetInodeAttributesOp before such changes, which
+	// costs a round trip and isn't atomic with them. This requires Linux 5.12
+	// or later; it has no effect on kernels that don't support it.
+	EnableHandleKillPriv bool
+
+	// Flag to pass renames with flags, made with renameat2(2), to the file
+	// system as RenameOps with Flags set. Otherwise the kernel fails them with
+	// EINVAL, since file systems that don't know about the flags would ignore
+	// them. This is only supported on Linux.
+	EnableRenameFlags bool
+
+	// Flag to send the data for ReadFileOps that set SpliceFile to the kernel
+	// by splicing it from the file through a pipe, avoiding copies through user
+	// space. This is only supported on Linux; elsewhere, or if the kernel
+	// doesn't support it, the data is copied as usual. Replies whose data
+	// doesn't fit in a pipe, which is limited to /proc/sys/fs/pipe-max-size
+	// for unprivileged processes, are also copied. Spliced data is not
+	// included in wire captures.
+	//
+	// Only replies are spliced. Requests, including the data of WriteFileOps,
+	// are still read from the kernel into user space buffers.
+	EnableSplice bool
+
 	// Flag to tell the kernel we support ReadDirPlus, which optimizes performance
 	// by returning not just the directory entries (like ReadDir), but also their inode
 	// attributes, thereby saving one extra Lookup request per directory entry.
@@ -223,6 +523,14 @@ type MountConfig struct {
 	// use ReaddirPlus for directory listing.
 	EnableAutoReaddirplus bool
 
+	// If non-nil, called while mounting with the capabilities offered by the
+	// kernel and those chosen from the other fields of this struct, before the
+	// choice is sent to the kernel. It may change the capabilities requested,
+	// for example to use ones that the kernel supports only on versions known
+	// to work, or ones with no MountConfig field. Returning an error fails the
+	// mount.
+	Configure func(*InitNegotiation) error
+
 	// UseVectoredRead is a legacy flag kept for backward compatibility. It is now a no-op.
 	//
 	// The term vectored read was a misnomer for this flag. Its actual meaning was that
@@ -243,15 +551,218 @@ type MountConfig struct {
 	// to always provide ReadFileOp.Dst. If the file system populates ReadFileOp.Data,
 	// that data will be used for a vectored read, irrespective of this flag's value.
 	UseVectoredRead bool
+
+	// The largest amount of data, in bytes, that the kernel may send in a
+	// single WriteFileOp. It is rounded down to a whole number of pages. If
+	// zero, 1 MiB is used.
+	//
+	// On Linux the kernel clamps this to its own limit, which is 1 MiB unless
+	// raised through /proc/sys/fs/fuse/max_pages_limit, and kernels older than
+	// 4.20 never send more than 128 KiB. Each buffer used to read requests
+	// from the kernel is sized to hold a write of this size, so large values
+	// increase memory use accordingly.
+	MaxWrite int
+
+	// The number of background requests, such as readahead, asynchronous
+	// direct I/O, and writeback, that the kernel keeps outstanding before it
+	// makes further ones wait. If zero, 12 is used. Raising it can help
+	// workloads dominated by readahead or writeback on a file system that
+	// serves ops concurrently.
+	//
+	// On Linux the kernel caps the value for unprivileged mounts at
+	// /proc/sys/fs/fuse/max_user_bgreq.
+	MaxBackground int
+
+	// The number of outstanding background requests at which the kernel
+	// considers the file system congested, and stops issuing optional ones,
+	// such as readahead. If zero, three quarters of MaxBackground is used, or 9
+	// if that is also zero. It is capped at MaxBackground.
+	//
+	// On Linux the kernel caps the value for unprivileged mounts at
+	// /proc/sys/fs/fuse/max_user_congthresh.
+	CongestionThreshold int
 }
 
+// InterruptPolicy says which ops have their context cancelled when the kernel
+// interrupts them. See MountConfig.InterruptPolicy.
+type InterruptPolicy uint8
+
+const (
+	// Cancel the context of every op that is interrupted.
+	InterruptCancelAll InterruptPolicy = iota
+
+	// Never cancel the context of an op because it is interrupted.
+	InterruptCancelNone
+
+	// Cancel the contexts of the ops listed in MountConfig.InterruptibleOps.
+	InterruptCancelListed
+)
+
+// FUSEImpl identifies an implementation of FUSE for OS X. See
+// MountConfig.FuseImpl.
 type FUSEImpl uint8
 
 const (
+	// FUSE-T (https://www.fuse-t.org), which needs no kernel extension: the
+	// file system is served to the kernel over NFS by a helper process.
 	FUSEImplFuseT = iota
+
+	// macFUSE (https://macfuse.github.io), which needs its kernel extension
+	// to be installed and allowed to load.
 	FUSEImplMacFUSE
+
+	// FUSE-T if it is installed, and macFUSE otherwise.
+	FUSEImplAuto
 )
 
+// Return the maximum write size to offer the kernel, as configured by
+// MaxWrite.
+func (c *MountConfig) maxWrite() int {
+	if c.MaxWrite <= 0 {
+		return buffer.MaxWriteSize
+	}
+
+	// The kernel counts the size of a request in pages, using 16 bits.
+	pageSize := buffer.GetPageSize()
+	pages := min(c.MaxWrite/pageSize, math.MaxUint16)
+	return max(pages, 1) * pageSize
+}
+
+// Return the maximum number of background requests to offer the kernel, as
+// configured by MaxBackground.
+func (c *MountConfig) maxBackground() uint16 {
+	if c.MaxBackground <= 0 {
+		return 12
+	}
+
+	return uint16(min(c.MaxBackground, math.MaxUint16))
+}
+
+// Return the congestion threshold to offer the kernel, as configured by
+// CongestionThreshold.
+func (c *MountConfig) congestionThreshold() uint16 {
+	maxBackground := c.maxBackground()
+	switch {
+	case c.CongestionThreshold > 0:
+		return uint16(min(c.CongestionThreshold, int(maxBackground)))
+	case c.MaxBackground > 0:
+		return max(maxBackground*3/4, 1)
+	default:
+		return 9
+	}
+}
+
+// Return the timeout for an op, or zero if it has none.
+func (c *MountConfig) opTimeout(op any) time.Duration {
+	switch op.(type) {
+	case *fuseops.ForgetInodeOp, *fuseops.BatchForgetOp:
+		return 0
+	}
+
+	d, ok := c.OpTimeouts[opTypeName(op)]
+	if !ok {
+		d = c.OpTimeout
+	}
+
+	return max(d, 0)
+}
+
+func (c *MountConfig) coalesceForgets() bool {
+	return c.CoalesceForgets && c.Concurrency.Readers <= 1
+}
+
+func (c *MountConfig) opTimeoutErrno() syscall.Errno {
+	if c.OpTimeoutErrno == 0 {
+		return syscall.ETIMEDOUT
+	}
+
+	return c.OpTimeoutErrno
+}
+
+// ServerConcurrency bounds the number of goroutines a server uses. See
+// MountConfig.Concurrency.
+//
+// When handlers are bounded, ops wait to be read from the kernel while all
+// the workers that would handle them are busy, which holds back the kernel
+// and the processes waiting on it. This includes interrupts, so ops that wait
+// on a context that only an interrupt would cancel can tie up the readers;
+// OpTimeout guards against that.
+type ServerConcurrency struct {
+	// The number of goroutines reading ops from the kernel. If zero, one is
+	// used.
+	Readers int
+
+	// If positive, the number of worker goroutines handling ops. Otherwise
+	// each op is handled on a goroutine of its own.
+	Workers int
+
+	// Pools of worker goroutines that handle particular ops, keyed by the name
+	// of their type, e.g. "ReadFileOp". Ops of these types are handled only
+	// by their pool, and don't count against Workers.
+	OpWorkers map[string]int
+
+	// If non-empty, the ops for Workers are queued, up to MaxQueuedOps of
+	// each priority, rather than left with the kernel while the workers are
+	// busy, and handed to them in order of priority, highest first, so that
+	// e.g. lookups don't wait behind a backlog of writes. Keys are the names
+	// of op types, e.g. "LookUpInodeOp"; ops of other types have priority
+	// zero. Ops of the same priority are handled in the order they arrived.
+	// See MetadataOpPriorities.
+	//
+	// Ignored unless Workers is positive.
+	OpPriorities map[string]int
+
+	// The number of ops of each priority that may be queued for Workers when
+	// OpPriorities is set. Once that many are queued, a reader that reads
+	// another op of the same priority waits for a worker to take one, leaving
+	// further ops with the kernel, so that e.g. a sustained stream of writes
+	// can't queue up without bound. If zero, 16 ops per worker may be queued.
+	MaxQueuedOps int
+}
+
+// MetadataOpPriorities returns OpPriorities that put ops that look up and
+// list file system metadata, which processes such as ls(1) wait on, ahead of
+// all others, in particular those that read and write file contents.
+func MetadataOpPriorities() map[string]int {
+	return map[string]int{
+		"LookUpInodeOp":        1,
+		"GetInodeAttributesOp": 1,
+		"StatxOp":              1,
+		"OpenDirOp":            1,
+		"ReadDirOp":            1,
+		"ReadDirPlusOp":        1,
+		"ReleaseDirHandleOp":   1,
+		"ReadSymlinkOp":        1,
+		"GetXattrOp":           1,
+		"ListXattrOp":          1,
+		"StatFSOp":             1,
+	}
+}
+
+// DefaultNotImplementedReplies returns NotImplementedReplies that answer
+// ReleaseFileHandleOp and ReleaseDirHandleOp with success once the file
+// system has turned out not to implement them. The kernel sends these for
+// every close, and ignores their errors.
+func DefaultNotImplementedReplies() map[string]error {
+	return map[string]error{
+		"ReleaseFileHandleOp": nil,
+		"ReleaseDirHandleOp":  nil,
+	}
+}
+
+// Return true if the op's context is to be cancelled when the kernel
+// interrupts it.
+func (c *MountConfig) interruptible(op any) bool {
+	switch c.InterruptPolicy {
+	case InterruptCancelNone:
+		return false
+	case InterruptCancelListed:
+		return c.InterruptibleOps[opTypeName(op)]
+	}
+
+	return true
+}
+
 // Create a map containing all of the key=value mount options to be given to
 // the mount helper.
 func (c *MountConfig) toMap() (opts map[string]string) {
@@ -288,6 +799,10 @@ func (c *MountConfig) toMap() (opts map[string]string) {
 		opts["subtype"] = subtype
 	}
 
+	if runtime.GOOS == "linux" && c.AutoUnmount {
+		opts["auto_unmount"] = ""
+	}
+
 	// Read only?
 	if c.ReadOnly {
 		opts["ro"] = ""
@@ -307,11 +822,17 @@ func (c *MountConfig) toMap() (opts map[string]string) {
 
 	// OS X: disable the use of "Apple Double" (._foo and .DS_Store) files, which
 	// just add noise to debug output and can have significant cost on
-	// network-based file systems.
+	// network-based file systems, unless the user wants them.
 	//
 	// Cf. https://github.com/osxfuse/osxfuse/wiki/Mount-options
 	if isDarwin {
-		opts["noappledouble"] = ""
+		if !c.EnableAppleDouble {
+			opts["noappledouble"] = ""
+		}
+
+		if c.DisableAppleXattr {
+			opts["noapplexattr"] = ""
+		}
 	}
 
 	// Last but not least: other user-supplied options.
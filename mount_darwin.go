@@ -11,7 +11,6 @@ import (
 	"strings"
 	"syscall"
 
-	"github.com/jacobsa/fuse/internal/buffer"
 	"github.com/jacobsa/fuse/internal/fusekernel"
 )
 
@@ -139,7 +138,7 @@ func convertMountArgs(daemonVar string, libVar string,
 		//
 		// OSXFUSE seems to ignore InitResponse.MaxWrite, and uses
 		// this instead.
-		"-o", "iosize=" + strconv.FormatUint(buffer.MaxWriteSize, 10),
+		"-o", "iosize=" + strconv.Itoa(cfg.maxWrite()),
 	}
 
 	return argv, env, nil
@@ -392,7 +391,7 @@ func mountFuset(
 	fusekernel.IsPlatformFuseT = true
 	env := []string{}
 	argv := []string{
-		fmt.Sprintf("--rwsize=%d", buffer.MaxWriteSize),
+		fmt.Sprintf("--rwsize=%d", cfg.maxWrite()),
 	}
 
 	if cfg.VolumeName != "" {
@@ -418,6 +417,12 @@ func mount(
 	switch cfg.FuseImpl {
 	case FUSEImplMacFUSE:
 		dev, err = mountOsxFuse(dir, cfg, ready)
+	case FUSEImplAuto:
+		if _, fusetErr := fusetBinary(); fusetErr != nil {
+			dev, err = mountOsxFuse(dir, cfg, ready)
+		} else {
+			dev, err = mountFuset(dir, cfg, ready)
+		}
 	case FUSEImplFuseT:
 		fallthrough
 	default:
@@ -0,0 +1,76 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// The mount helper for FreeBSD's fusefs, which mounts a /dev/fuse descriptor
+// that it inherits from us.
+const mountFusefsPath = "/sbin/mount_fusefs"
+
+// Begin the process of mounting at the given directory, returning a connection
+// to the kernel. Mounting continues in the background, and is complete when an
+// error is written to the supplied channel. The file system may need to
+// service the connection in order for mounting to complete.
+func mount(dir string, cfg *MountConfig, ready chan<- error) (*os.File, error) {
+	// fusefs sends the init op without waiting for the reply, and answers
+	// statfs(2) with made-up values until it gets one, so mount_fusefs returns
+	// before we serve anything, and mounting is never delayed.
+	ready <- nil
+
+	// The mount helper doesn't understand any escaping.
+	for k, v := range cfg.toMap() {
+		if strings.Contains(k, ",") || strings.Contains(v, ",") {
+			return nil, fmt.Errorf(
+				"mount options cannot contain commas on FreeBSD: %q=%q",
+				k,
+				v)
+		}
+	}
+
+	// We use syscall.Open + os.NewFile instead of os.OpenFile so that the file
+	// is opened in blocking mode. When opened in non-blocking mode, the Go
+	// runtime tries to use poll(2), which does not work with /dev/fuse.
+	fd, err := syscall.Open("/dev/fuse", syscall.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open /dev/fuse: %w (is the fusefs module loaded?)", err)
+	}
+	dev := os.NewFile(uintptr(fd), "/dev/fuse")
+
+	if cfg.DebugLogger != nil {
+		cfg.DebugLogger.Println("Calling mount_fusefs")
+	}
+
+	// The device is the helper's first extra file, so descriptor 3.
+	cmd := exec.Command(
+		mountFusefsPath,
+		"-o", cfg.toOptionsString(),
+		"3",
+		dir,
+	)
+	cmd.ExtraFiles = []*os.File{dev}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		dev.Close()
+		return nil, fmt.Errorf("mount_fusefs: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return dev, nil
+}
@@ -7,18 +7,21 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 
 	"golang.org/x/sys/unix"
 )
 
+// Find the setuid helper used to mount and unmount without privileges,
+// preferring the libfuse 3 version.
 func findFusermount() (string, error) {
 	path, err := exec.LookPath("fusermount3")
 	if err != nil {
 		path, err = exec.LookPath("fusermount")
 	}
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("neither fusermount3 nor fusermount found in $PATH: %w", err)
 	}
 	return path, nil
 }
@@ -134,9 +137,14 @@ func mount(dir string, cfg *MountConfig, ready chan<- error) (*os.File, error) {
 		return dev, nil
 	}
 
-	// Try mounting without fusermount(1) first: we might be running as root or
+	// Try mounting without fusermount(1) first, unless asked not to or auto
+	// unmounting, which only the helper can do: we might be running as root or
 	// have the CAP_SYS_ADMIN capability.
-	dev, err := directmount(dir, cfg)
+	var dev *os.File
+	err := errFallback
+	if !cfg.UseFusermount && !cfg.AutoUnmount {
+		dev, err = directmount(dir, cfg)
+	}
 	if err == errFallback {
 		if cfg.DebugLogger != nil {
 			cfg.DebugLogger.Println("Directmount failed. Trying fallback.")
@@ -150,7 +158,17 @@ func mount(dir string, cfg *MountConfig, ready chan<- error) (*os.File, error) {
 			"--",
 			dir,
 		}
-		dev, err := fusermount(fusermountPath, argv, []string{}, true, cfg.DebugLogger)
+		if cfg.AutoUnmount {
+			// The helper keeps running until the socket is closed, so don't wait
+			// for it.
+			var socket *os.File
+			dev, socket, err = fusermountWithSocket(fusermountPath, argv, []string{}, false, cfg.DebugLogger)
+			if err == nil {
+				autoUnmountSockets.add(dir, socket)
+			}
+		} else {
+			dev, err = fusermount(fusermountPath, argv, []string{}, true, cfg.DebugLogger)
+		}
 		if err == nil {
 			return dev, nil
 		}
@@ -177,3 +195,35 @@ func parseFuseFd(dir string) (int, error) {
 
 	return int(fd), nil
 }
+
+// The sockets shared with fusermount helpers that were run with auto_unmount,
+// by mount point. Each helper unmounts its file system once its socket is
+// closed, which happens when this process exits, or when the file system is
+// unmounted explicitly.
+var autoUnmountSockets = socketsByDir{m: make(map[string]*os.File)}
+
+type socketsByDir struct {
+	mu sync.Mutex
+	m  map[string]*os.File // GUARDED_BY(mu)
+}
+
+func (s *socketsByDir) add(dir string, f *os.File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.m[dir]; ok {
+		old.Close()
+	}
+	s.m[dir] = f
+}
+
+// Close the socket for the given mount point, if any.
+func (s *socketsByDir) close(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.m[dir]; ok {
+		f.Close()
+		delete(s.m, dir)
+	}
+}
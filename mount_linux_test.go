@@ -1,6 +1,7 @@
 package fuse
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -35,3 +36,19 @@ func Test_parseFuseFd(t *testing.T) {
 		}
 	})
 }
+
+func Test_findFusermountNotFound(t *testing.T) {
+	t.Setenv("PATH", "")
+
+	_, err := findFusermount()
+	if err == nil || !strings.Contains(err.Error(), "fusermount3") {
+		t.Errorf("expected an error naming fusermount3, got %v", err)
+	}
+}
+
+func Test_autoUnmountOption(t *testing.T) {
+	cfg := &MountConfig{AutoUnmount: true}
+	if _, ok := cfg.toMap()["auto_unmount"]; !ok {
+		t.Errorf("expected auto_unmount in %q", cfg.toOptionsString())
+	}
+}
@@ -17,12 +17,17 @@ package fuse
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+
+	"github.com/jacobsa/fuse/fuseops"
 )
 
 // MountedFileSystem represents the status of a mount operation, with a method
 // that waits for unmounting.
 type MountedFileSystem struct {
-	dir string
+	dir  string
+	conn *Connection
 
 	// The result to return from Join. Not valid until the channel is closed.
 	joinStatus          error
@@ -35,6 +40,122 @@ func (mfs *MountedFileSystem) Dir() string {
 	return mfs.dir
 }
 
+// SetWireLogger changes the writer to which wire log records are written,
+// replacing MountConfig.WireLogger. A nil writer turns wire logging off. This
+// may be called at any time while the file system is mounted, for example to
+// capture a trace during an incident without remounting.
+func (mfs *MountedFileSystem) SetWireLogger(w io.Writer) {
+	mfs.conn.SetWireLogger(w)
+}
+
+// InvalidateInode tells the kernel that the attributes, and possibly the
+// contents, of an inode have changed behind its back, so that it drops what it
+// has cached rather than waiting for the cache to expire. This lets a file
+// system whose backing store is changed by others use long cache timeouts
+// without serving stale data.
+//
+// The cached attributes are always invalidated. If offset is non-negative,
+// cached file contents are also invalidated, starting at offset and running
+// for length bytes, or to the end of the file if length is not positive.
+//
+// It returns the error from the kernel, if any: ENOENT means that the kernel
+// has nothing cached for the inode, which is not usually a problem, and ENOSYS
+// that the kernel doesn't support invalidation. It must not be called from
+// within a ForgetInode handler, and may deadlock if called while handling an
+// op that holds the inode's lock in the kernel, such as a write.
+func (mfs *MountedFileSystem) InvalidateInode(
+	inode fuseops.InodeID,
+	offset int64,
+	length int64) error {
+	return serviceInodeInvalidation(mfs.conn, inode, offset, length)
+}
+
+// InvalidateEntry tells the kernel to forget what it has cached for the entry
+// named name within parent, so that the next access to it is looked up
+// afresh. Use it when an entry has been created, removed, or renamed by
+// someone other than the kernel, for example another client of a shared
+// backing store.
+//
+// It returns the error from the kernel, if any, with the same meaning and
+// restrictions as for InvalidateInode.
+func (mfs *MountedFileSystem) InvalidateEntry(parent fuseops.InodeID, name string) error {
+	return serviceEntryInval(mfs.conn, parent, name, false)
+}
+
+// ExpireEntry is like InvalidateEntry, but only marks what the kernel has
+// cached for the entry as expired, rather than evicting it. The kernel looks
+// the entry up again the next time it is used, and keeps it if the answer is
+// unchanged. Unlike InvalidateEntry, this keeps whatever is cached beneath the
+// entry, and doesn't disturb entries in use as working directories or mount
+// points, so invalidating many entries at once doesn't cause a storm of
+// lookups.
+//
+// It returns the error from the kernel, if any, with the same meaning and
+// restrictions as for InvalidateInode. ENOSYS is also returned for kernels
+// older than protocol 7.37 (Linux 6.2), which would evict the entry instead.
+func (mfs *MountedFileSystem) ExpireEntry(parent fuseops.InodeID, name string) error {
+	return serviceEntryInval(mfs.conn, parent, name, true)
+}
+
+// NotifyDelete tells the kernel that the entry named name within parent, which
+// refers to child, has been deleted by someone other than the kernel. Unlike
+// InvalidateEntry, this also lets inotify watchers see the deletion, and
+// detaches anything mounted on the entry. If the entry the kernel has cached
+// doesn't refer to child, it is left alone.
+//
+// It returns the error from the kernel, if any, with the same meaning and
+// restrictions as for InvalidateInode.
+func (mfs *MountedFileSystem) NotifyDelete(
+	parent fuseops.InodeID,
+	child fuseops.InodeID,
+	name string) error {
+	return serviceDelete(mfs.conn, parent, child, name)
+}
+
+// NotifyStore pushes data into the kernel's page cache for an inode, starting
+// at offset, as though it had been read from the file system. A file system
+// can use this to warm the cache after prefetching from its backing store, so
+// that later reads are served without a round trip. The inode's size is
+// extended if the data goes past its end.
+//
+// It returns the error from the kernel, if any, with the same meaning and
+// restrictions as for InvalidateInode.
+func (mfs *MountedFileSystem) NotifyStore(
+	inode fuseops.InodeID,
+	offset int64,
+	data []byte) error {
+	return serviceStore(mfs.conn, inode, offset, data)
+}
+
+// NotifyRetrieve asks the kernel for up to size bytes of the contents of its
+// page cache for an inode, starting at offset, and waits for the answer. This
+// is typically used to recover dirty data that hasn't been written back yet.
+// The kernel returns only what it has cached, so the result may be short or
+// empty.
+//
+// It returns the error from the kernel, if any, with the same meaning and
+// restrictions as for InvalidateInode, or ctx.Err() if ctx is cancelled before
+// the kernel answers. The answer arrives through the connection, so it must
+// not be called from the goroutine that reads ops.
+func (mfs *MountedFileSystem) NotifyRetrieve(
+	ctx context.Context,
+	inode fuseops.InodeID,
+	offset int64,
+	size int) ([]byte, error) {
+	return mfs.conn.retrieve(ctx, inode, offset, size)
+}
+
+// OpenBackingFile registers f with the kernel as a backing file for
+// passthrough. See Connection.OpenBackingFile.
+func (mfs *MountedFileSystem) OpenBackingFile(f *os.File) (fuseops.BackingID, error) {
+	return mfs.conn.OpenBackingFile(f)
+}
+
+// CloseBackingFile unregisters a backing file returned by OpenBackingFile.
+func (mfs *MountedFileSystem) CloseBackingFile(id fuseops.BackingID) error {
+	return mfs.conn.CloseBackingFile(id)
+}
+
 // Join blocks until a mounted file system has been unmounted. It does not
 // return successfully until all ops read from the connection have been
 // responded to (i.e. the file system server has finished processing all
@@ -64,3 +185,9 @@ func (mfs *MountedFileSystem) GetFuseContext(ctx context.Context) (uid, gid, pid
 	header := inMsg.Header()
 	return header.Uid, header.Gid, header.Pid, nil
 }
+
+// NotImplementedOps returns the names of the types of ops that the file
+// system has replied ENOSYS to. See Connection.NotImplementedOps.
+func (mfs *MountedFileSystem) NotImplementedOps() []string {
+	return mfs.conn.NotImplementedOps()
+}
@@ -0,0 +1,131 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"sort"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// NotImplementedOps returns the names of the types of ops that the server has
+// replied ENOSYS to, e.g. "FlushFileOp", in order.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) NotImplementedOps() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.notImplemented))
+	for name := range c.notImplemented {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Take note of the server replying ENOSYS to an op, logging a "NotImplemented"
+// event the first time it does for the op's type, and return the error with
+// which to reply instead.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) noteNotImplemented(op interface{}) error {
+	name := opTypeName(op)
+
+	c.mu.Lock()
+	first := !c.notImplemented[name]
+	if first {
+		if c.notImplemented == nil {
+			c.notImplemented = make(map[string]bool)
+		}
+		c.notImplemented[name] = true
+	}
+	c.mu.Unlock()
+
+	reply, replaced := c.cfg.NotImplementedReplies[name]
+	if first {
+		if wlog := c.newEventRecord("NotImplemented"); wlog != nil {
+			wlog.Args["Op"] = name
+			wlog.Args["KernelStops"] = c.kernelStopsOnENOSYS(op)
+			if replaced {
+				wlog.Args["Reply"] = opErrno(reply)
+			}
+			c.writeEventRecord(wlog)
+		}
+	}
+
+	if replaced {
+		return reply
+	}
+
+	return ENOSYS
+}
+
+// Return the error with which to answer the op in place of the server, if
+// the server has replied ENOSYS to an op of its type before, and
+// MountConfig.NotImplementedReplies says how to answer it.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) notImplementedReply(op interface{}) (error, bool) {
+	if len(c.cfg.NotImplementedReplies) == 0 {
+		return nil, false
+	}
+
+	name := opTypeName(op)
+	reply, ok := c.cfg.NotImplementedReplies[name]
+	if !ok {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return reply, c.notImplemented[name]
+}
+
+// Return true if the kernel stops sending ops like this one once it's been
+// replied ENOSYS to.
+func (c *Connection) kernelStopsOnENOSYS(op interface{}) bool {
+	switch o := op.(type) {
+	case *fuseops.FlushFileOp,
+		*fuseops.SyncFileOp,
+		*fuseops.GetXattrOp,
+		*fuseops.ListXattrOp,
+		*fuseops.SetXattrOp,
+		*fuseops.RemoveXattrOp,
+		*fuseops.AccessOp,
+		*fuseops.CreateFileOp,
+		*fuseops.CreateTmpFileOp,
+		*fuseops.FallocateOp,
+		*fuseops.CopyFileRangeOp,
+		*fuseops.SeekFileOp,
+		*fuseops.PollOp,
+		*fuseops.SyncFSOp,
+		*fuseops.StatxOp:
+		return true
+
+	case *fuseops.RenameOp:
+		return o.Flags != 0
+
+	case *fuseops.OpenFileOp:
+		return c.cfg.EnableNoOpenSupport
+
+	case *fuseops.OpenDirOp:
+		return c.cfg.EnableNoOpendirSupport
+	}
+
+	return false
+}
@@ -0,0 +1,85 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse_test
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+// A file system that counts the releases and flushes it's sent, and
+// implements neither.
+type releaseCountingFS struct {
+	fuseutil.NotImplementedFileSystem
+
+	releases atomic.Int32
+	flushes  atomic.Int32
+}
+
+func (fs *releaseCountingFS) ReleaseFileHandle(ctx context.Context, op *fuseops.ReleaseFileHandleOp) error {
+	fs.releases.Add(1)
+	return fs.NotImplementedFileSystem.ReleaseFileHandle(ctx, op)
+}
+
+func (fs *releaseCountingFS) FlushFile(ctx context.Context, op *fuseops.FlushFileOp) error {
+	fs.flushes.Add(1)
+	return fs.NotImplementedFileSystem.FlushFile(ctx, op)
+}
+
+func TestNotImplementedReplies(t *testing.T) {
+	fs := &releaseCountingFS{}
+
+	ctx := context.Background()
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), &fuse.MountConfig{
+		NotImplementedReplies: fuse.DefaultNotImplementedReplies(),
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer k.Close()
+
+	// Releases succeed, and only the first reaches the file system.
+	for i := 0; i < 3; i++ {
+		if err := k.Do(ctx, &fuseops.ReleaseFileHandleOp{Handle: fuseops.HandleID(i)}); err != nil {
+			t.Errorf("ReleaseFileHandle %d: %v", i, err)
+		}
+	}
+	if got := fs.releases.Load(); got != 1 {
+		t.Errorf("file system saw %d releases, want 1", got)
+	}
+
+	// Flushes aren't configured, and so still fail and still reach it.
+	for i := 0; i < 2; i++ {
+		if err := k.Do(ctx, &fuseops.FlushFileOp{Inode: 2}); err != syscall.ENOSYS {
+			t.Errorf("FlushFile %d: %v, want ENOSYS", i, err)
+		}
+	}
+	if got := fs.flushes.Load(); got != 2 {
+		t.Errorf("file system saw %d flushes, want 2", got)
+	}
+
+	got := k.MountedFileSystem().NotImplementedOps()
+	if want := []string{"FlushFileOp", "ReleaseFileHandleOp"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("NotImplementedOps %q, want %q", got, want)
+	}
+}
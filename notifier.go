@@ -1,6 +1,7 @@
 package fuse
 
 import (
+	"context"
 	"unsafe"
 
 	"github.com/jacobsa/fuse/fuseops"
@@ -10,15 +11,22 @@ import (
 // Notifier coordinates low-level notifications from the fuse daemon to the
 // kernel. A Notifier may be used by the ServeOps implementation of a Server. In
 // order to deliver notifications, wrap the server with NewServerWithNotifier.
+//
+// Once the file system is mounted, MountedFileSystem offers the same
+// notifications directly, without the need for a Notifier.
 type Notifier struct {
 	inodeInvalidations  chan invalidateInodeCommand
 	dentryInvalidations chan invalidateEntryCommand
+	pollWakeups         chan pollWakeupCommand
+	deletions           chan deleteCommand
 }
 
 func NewNotifier() *Notifier {
 	return &Notifier{
 		inodeInvalidations:  make(chan invalidateInodeCommand),
 		dentryInvalidations: make(chan invalidateEntryCommand),
+		pollWakeups:         make(chan pollWakeupCommand),
+		deletions:           make(chan deleteCommand),
 	}
 }
 
@@ -30,11 +38,22 @@ type invalidateInodeCommand struct {
 }
 
 type invalidateEntryCommand struct {
+	parent     fuseops.InodeID
+	name       string
+	expireOnly bool
+	done       chan<- error
+}
+
+type deleteCommand struct {
 	parent fuseops.InodeID
+	child  fuseops.InodeID
 	name   string
-	// If fusekernel.NotifyInvalEntryOut is updated to use its padding as flags,
-	// we can support the expire flag in this command as well.
-	done chan<- error
+	done   chan<- error
+}
+
+type pollWakeupCommand struct {
+	pollHandle uint64
+	done       chan<- error
 }
 
 // InvalidateInode notifies the kernel to invalidate an inode cache entry. See
@@ -61,7 +80,46 @@ func (n *Notifier) InvalidateInode(inode fuseops.InodeID, offset, length int64)
 // support dentry invalidations.
 func (n *Notifier) InvalidateEntry(parent fuseops.InodeID, name string) error {
 	done := make(chan error)
-	n.dentryInvalidations <- invalidateEntryCommand{parent, name, done}
+	n.dentryInvalidations <- invalidateEntryCommand{parent, name, false, done}
+	return <-done
+}
+
+// ExpireEntry is like InvalidateEntry, but only marks the dentry as expired,
+// so that the kernel revalidates it with a lookup the next time it is used,
+// rather than evicting it. See MountedFileSystem.ExpireEntry.
+func (n *Notifier) ExpireEntry(parent fuseops.InodeID, name string) error {
+	done := make(chan error)
+	n.dentryInvalidations <- invalidateEntryCommand{parent, name, true, done}
+	return <-done
+}
+
+// NotifyDelete notifies the kernel that the entry for child, named name within
+// parent, has been deleted behind its back. Unlike InvalidateEntry, this also
+// updates inotify watchers and unmounts anything mounted on the entry. See the
+// libfuse documentation for fuse_lowlevel_notify_delete at
+// https://libfuse.github.io/doxygen/fuse__lowlevel_8h.html for more details.
+//
+// NotifyDelete blocks until the kernel write completes, and returns the error
+// from the kernel, if any. ENOSYS indicates that the kernel does not support
+// delete notifications.
+func (n *Notifier) NotifyDelete(parent, child fuseops.InodeID, name string) error {
+	done := make(chan error)
+	n.deletions <- deleteCommand{parent, child, name, done}
+	return <-done
+}
+
+// PollWakeup notifies the kernel that the readiness of a file has changed,
+// waking up whoever is waiting in poll(2) and friends. pollHandle is the
+// PollHandle of a fuseops.PollOp that had ScheduleNotify set. See the libfuse
+// documentation for fuse_lowlevel_notify_poll at
+// https://libfuse.github.io/doxygen/fuse__lowlevel_8h.html for more details.
+//
+// PollWakeup blocks until the kernel write completes, and returns the error
+// from the kernel, if any. ENOENT indicates that the kernel is no longer
+// interested in the handle.
+func (n *Notifier) PollWakeup(pollHandle uint64) error {
+	done := make(chan error)
+	n.pollWakeups <- pollWakeupCommand{pollHandle, done}
 	return <-done
 }
 
@@ -82,12 +140,39 @@ func serviceInodeInvalidation(c *Connection, inode fuseops.InodeID, offset, leng
 	return c.writeOutMessage(outMsg)
 }
 
-func serviceEntryInval(c *Connection, parent fuseops.InodeID, name string) error {
+func serviceEntryInval(c *Connection, parent fuseops.InodeID, name string, expireOnly bool) error {
+	cmd := fusekernel.NotifyInvalEntryOut{
+		Parent:  uint64(parent),
+		Namelen: uint32(len(name)),
+	}
+	if expireOnly {
+		// Older kernels ignore the flags, and would evict the entry.
+		if c.kernelProtocol.LT(fusekernel.Protocol{Major: 7, Minor: 37}) {
+			return ENOSYS
+		}
+		cmd.Flags |= fusekernel.NotifyExpireOnly
+	}
+
 	outMsg := c.getOutMessage()
 	defer c.putOutMessage(outMsg)
+	outMsg.Append(unsafe.Slice((*byte)(unsafe.Pointer(&cmd)), int(unsafe.Sizeof(cmd))))
 
-	cmd := fusekernel.NotifyInvalEntryOut{
+	// The name must be represented as a C string with a null-terminator.
+	outMsg.AppendString(name)
+	outMsg.Append([]byte{0})
+
+	outMsg.OutHeader().Error = fusekernel.NotifyCodeInvalEntry
+	outMsg.OutHeader().Len = uint32(outMsg.Len())
+	return c.writeOutMessage(outMsg)
+}
+
+func serviceDelete(c *Connection, parent, child fuseops.InodeID, name string) error {
+	outMsg := c.getOutMessage()
+	defer c.putOutMessage(outMsg)
+
+	cmd := fusekernel.NotifyDeleteOut{
 		Parent:  uint64(parent),
+		Child:   uint64(child),
 		Namelen: uint32(len(name)),
 	}
 	outMsg.Append(unsafe.Slice((*byte)(unsafe.Pointer(&cmd)), int(unsafe.Sizeof(cmd))))
@@ -96,7 +181,99 @@ func serviceEntryInval(c *Connection, parent fuseops.InodeID, name string) error
 	outMsg.AppendString(name)
 	outMsg.Append([]byte{0})
 
-	outMsg.OutHeader().Error = fusekernel.NotifyCodeInvalEntry
+	outMsg.OutHeader().Error = fusekernel.NotifyCodeDelete
+	outMsg.OutHeader().Len = uint32(outMsg.Len())
+	return c.writeOutMessage(outMsg)
+}
+
+func serviceStore(c *Connection, inode fuseops.InodeID, offset int64, data []byte) error {
+	outMsg := c.getOutMessage()
+	defer c.putOutMessage(outMsg)
+
+	cmd := fusekernel.NotifyStoreOut{
+		Nodeid: uint64(inode),
+		Offset: uint64(offset),
+		Size:   uint32(len(data)),
+	}
+	outMsg.Append(unsafe.Slice((*byte)(unsafe.Pointer(&cmd)), int(unsafe.Sizeof(cmd))))
+	outMsg.Append(data)
+
+	outMsg.OutHeader().Error = fusekernel.NotifyCodeStore
+	outMsg.OutHeader().Len = uint32(outMsg.Len())
+	return c.writeOutMessage(outMsg)
+}
+
+// Ask the kernel for the contents of its page cache for an inode, and wait
+// for it to answer.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) retrieve(
+	ctx context.Context,
+	inode fuseops.InodeID,
+	offset int64,
+	size int) ([]byte, error) {
+	replies := make(chan []byte, 1)
+
+	c.mu.Lock()
+	c.nextRetrieveID++
+	id := c.nextRetrieveID
+	c.retrievals[id] = replies
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.retrievals, id)
+		c.mu.Unlock()
+	}()
+
+	outMsg := c.getOutMessage()
+	cmd := fusekernel.NotifyRetrieveOut{
+		NotifyUnique: id,
+		Nodeid:       uint64(inode),
+		Offset:       uint64(offset),
+		Size:         uint32(size),
+	}
+	outMsg.Append(unsafe.Slice((*byte)(unsafe.Pointer(&cmd)), int(unsafe.Sizeof(cmd))))
+
+	outMsg.OutHeader().Error = fusekernel.NotifyCodeRetrieve
+	outMsg.OutHeader().Len = uint32(outMsg.Len())
+	err := c.writeOutMessage(outMsg)
+	c.putOutMessage(outMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case data := <-replies:
+		return data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Deliver the kernel's answer to a retrieve notification to whoever is
+// waiting for it, if anyone still is.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) handleNotifyReply(op *notifyReplyOp) {
+	c.mu.Lock()
+	replies, ok := c.retrievals[op.NotifyUnique]
+	c.mu.Unlock()
+
+	if ok {
+		// The data belongs to the InMessage, which is about to be reused.
+		replies <- append([]byte(nil), op.Data...)
+	}
+}
+
+func servicePollWakeup(c *Connection, pollHandle uint64) error {
+	outMsg := c.getOutMessage()
+	defer c.putOutMessage(outMsg)
+
+	cmd := fusekernel.NotifyPollWakeupOut{Kh: pollHandle}
+	outMsg.Append(unsafe.Slice((*byte)(unsafe.Pointer(&cmd)), int(unsafe.Sizeof(cmd))))
+
+	outMsg.OutHeader().Error = fusekernel.NotifyCodePoll
 	outMsg.OutHeader().Len = uint32(outMsg.Len())
 	return c.writeOutMessage(outMsg)
 }
@@ -107,7 +284,11 @@ func (n *Notifier) notify(c *Connection, terminate <-chan struct{}) {
 		case i := <-n.inodeInvalidations:
 			i.done <- serviceInodeInvalidation(c, i.inode, i.offset, i.length)
 		case e := <-n.dentryInvalidations:
-			e.done <- serviceEntryInval(c, e.parent, e.name)
+			e.done <- serviceEntryInval(c, e.parent, e.name, e.expireOnly)
+		case d := <-n.deletions:
+			d.done <- serviceDelete(c, d.parent, d.child, d.name)
+		case p := <-n.pollWakeups:
+			p.done <- servicePollWakeup(c, p.pollHandle)
 		case <-terminate:
 			return
 		}
@@ -0,0 +1,88 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"sync"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// Pools of the op structs that the kernel sends most often, so that with
+// MountConfig.RecycleOps they don't cost an allocation per request.
+var (
+	lookUpInodeOps        opPool[fuseops.LookUpInodeOp]
+	getInodeAttributesOps opPool[fuseops.GetInodeAttributesOp]
+	forgetInodeOps        opPool[fuseops.ForgetInodeOp]
+	openFileOps           opPool[fuseops.OpenFileOp]
+	readFileOps           opPool[fuseops.ReadFileOp]
+	writeFileOps          opPool[fuseops.WriteFileOp]
+	flushFileOps          opPool[fuseops.FlushFileOp]
+	releaseFileHandleOps  opPool[fuseops.ReleaseFileHandleOp]
+	openDirOps            opPool[fuseops.OpenDirOp]
+	readDirOps            opPool[fuseops.ReadDirOp]
+	releaseDirHandleOps   opPool[fuseops.ReleaseDirHandleOp]
+)
+
+type opPool[T any] struct {
+	pool sync.Pool
+}
+
+// Return an op initialized to v, reusing a recycled one if there is one.
+func (p *opPool[T]) get(v T) *T {
+	op, _ := p.pool.Get().(*T)
+	if op == nil {
+		op = new(T)
+	}
+
+	*op = v
+	return op
+}
+
+// Zero the op, so that it doesn't keep what it refers to alive, and return it
+// to the pool.
+func (p *opPool[T]) put(op *T) {
+	var zero T
+	*op = zero
+	p.pool.Put(op)
+}
+
+// Return an op that has been replied to to its pool, if it has one.
+func recycleOp(op any) {
+	switch o := op.(type) {
+	case *fuseops.LookUpInodeOp:
+		lookUpInodeOps.put(o)
+	case *fuseops.GetInodeAttributesOp:
+		getInodeAttributesOps.put(o)
+	case *fuseops.ForgetInodeOp:
+		forgetInodeOps.put(o)
+	case *fuseops.OpenFileOp:
+		openFileOps.put(o)
+	case *fuseops.ReadFileOp:
+		readFileOps.put(o)
+	case *fuseops.WriteFileOp:
+		writeFileOps.put(o)
+	case *fuseops.FlushFileOp:
+		flushFileOps.put(o)
+	case *fuseops.ReleaseFileHandleOp:
+		releaseFileHandleOps.put(o)
+	case *fuseops.OpenDirOp:
+		openDirOps.put(o)
+	case *fuseops.ReadDirOp:
+		readDirOps.put(o)
+	case *fuseops.ReleaseDirHandleOp:
+		releaseDirHandleOps.put(o)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"sync"
+	"time"
+)
+
+// An opTimer replies to an op on the server's behalf if the server takes too
+// long to. See MountConfig.OpTimeout.
+type opTimer struct {
+	c      *Connection
+	opCode uint32
+	fuseID uint64
+	op     any
+	timer  *time.Timer
+
+	// Held while the op is being timed out, so that the server's own reply
+	// waits until it is known whether to send it.
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	replied bool
+	expired bool
+}
+
+func (c *Connection) startOpTimer(
+	opCode uint32,
+	fuseID uint64,
+	op any,
+	d time.Duration) *opTimer {
+	t := &opTimer{
+		c:      c,
+		opCode: opCode,
+		fuseID: fuseID,
+		op:     op,
+	}
+	t.timer = time.AfterFunc(d, func() { t.expire(d) })
+	return t
+}
+
+// Cancel the op's context, and reply to the kernel with the timeout error,
+// unless the server has replied already.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *opTimer) expire(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.replied {
+		return
+	}
+	t.expired = true
+
+	// Clean up state for the op now, rather than when the server replies, since
+	// the kernel may reuse its ID once it has been replied to.
+	c := t.c
+	c.finishOp(t.opCode, t.fuseID)
+
+	errno := c.cfg.opTimeoutErrno()
+	if c.errorLogger != nil {
+		c.errorLogger.Printf("Op 0x%08x %T] -> Timed out after %v", t.fuseID, t.op, d)
+	}
+
+	// The server may still be using the op's own messages, so send the reply
+	// from another.
+	outMsg := c.getOutMessage()
+	defer c.putOutMessage(outMsg)
+
+	c.kernelResponse(outMsg, t.fuseID, t.op, errno)
+	if err := c.writeOutMessage(outMsg); err != nil && c.errorLogger != nil {
+		c.errorLogger.Printf("writeMessage: %v %v", err, outMsg.OutHeaderBytes())
+	}
+}
+
+// Stop the timer because the server is replying, returning true if the op has
+// already timed out, in which case the reply must not be sent.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *opTimer) stop() (expired bool) {
+	t.timer.Stop()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.replied = true
+	return t.expired
+}
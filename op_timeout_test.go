@@ -0,0 +1,91 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/fuse/internal/fakekernel"
+)
+
+// A file system whose reads hang until their context is cancelled, and then
+// until released, and whose StatFS is merely slow.
+type hangFS struct {
+	fuseutil.NotImplementedFileSystem
+	cancelled chan struct{}
+	release   chan struct{}
+}
+
+func (fs *hangFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
+	<-ctx.Done()
+	fs.cancelled <- struct{}{}
+	<-fs.release
+	return nil
+}
+
+func (fs *hangFS) StatFS(ctx context.Context, op *fuseops.StatFSOp) error {
+	time.Sleep(50 * time.Millisecond)
+	return nil
+}
+
+func TestOpTimeout(t *testing.T) {
+	var errorLog bytes.Buffer
+	fs := &hangFS{
+		cancelled: make(chan struct{}, 1),
+		release:   make(chan struct{}),
+	}
+	k, err := fakekernel.Start(fuseutil.NewFileSystemServer(fs), &fuse.MountConfig{
+		OpTimeout:      10 * time.Millisecond,
+		OpTimeouts:     map[string]time.Duration{"StatFSOp": -1},
+		OpTimeoutErrno: syscall.EIO,
+		ErrorLogger:    log.New(&errorLog, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := k.Do(ctx, &fuseops.ReadFileOp{Inode: 17, Handle: 3, Size: 4096}); err != syscall.EIO {
+		t.Errorf("ReadFile: expected EIO, got %v", err)
+	}
+
+	select {
+	case <-fs.cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("expected the read's context to be cancelled")
+	}
+
+	if err := k.Do(ctx, &fuseops.StatFSOp{}); err != nil {
+		t.Errorf("StatFS: %v", err)
+	}
+
+	close(fs.release)
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if !strings.Contains(errorLog.String(), "Timed out") {
+		t.Errorf("expected the timeout to be logged, got %q", errorLog.String())
+	}
+}
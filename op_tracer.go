@@ -0,0 +1,35 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import "context"
+
+// An OpTracer is notified when each op read from the kernel begins and ends.
+// It may be used to integrate with distributed tracing systems; see the
+// fuseotel package for an OpenTelemetry implementation.
+//
+// Methods may be called concurrently for different ops.
+type OpTracer interface {
+	// StartOp is called by Connection.ReadOp before the op is returned. The
+	// context it returns is the one handed to the file system for the op, so it
+	// may carry e.g. a span that work done on behalf of the op will be parented
+	// to. It must be derived from the supplied context.
+	StartOp(ctx context.Context, op interface{}) context.Context
+
+	// FinishOp is called by Connection.Reply after the reply has been sent to
+	// the kernel, with the context returned by StartOp and the op's finished
+	// wire log record. The record must not be retained after FinishOp returns.
+	FinishOp(ctx context.Context, wlog *WireLogRecord)
+}
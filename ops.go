@@ -31,18 +31,33 @@ type interruptOp struct {
 	FuseID uint64
 }
 
+// The kernel's answer to a retrieve notification, which is handled inline
+// rather than being returned from ReadOp.
+type notifyReplyOp struct {
+	// The unique ID of the retrieve notification.
+	NotifyUnique uint64
+
+	// The file offset and contents of the data retrieved. Data aliases the
+	// InMessage.
+	Offset uint64
+	Data   []byte
+}
+
 // Required in order to mount on Linux and OS X.
 type initOp struct {
 	// In
 	Kernel fusekernel.Protocol
 
 	// In/out
-	Flags fusekernel.InitFlags
+	Flags  fusekernel.InitFlags
+	Flags2 fusekernel.InitFlags2
 
 	// Out
-	Library       fusekernel.Protocol
-	MaxReadahead  uint32
-	MaxBackground uint16
-	MaxWrite      uint32
-	MaxPages      uint16
+	Library             fusekernel.Protocol
+	MaxReadahead        uint32
+	MaxBackground       uint16
+	CongestionThreshold uint16
+	MaxWrite            uint32
+	MaxPages            uint16
+	MaxStackDepth       uint32
 }
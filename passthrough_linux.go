@@ -0,0 +1,64 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"os"
+	"runtime"
+	"unsafe"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/fusekernel"
+	"golang.org/x/sys/unix"
+)
+
+// OpenBackingFile registers f with the kernel as a backing file for
+// passthrough, returning an ID to put in OpenFileOp.BackingID or
+// CreateFileOp.BackingID. See MountConfig.EnablePassthrough.
+//
+// The kernel keeps its own reference to the file, so f may be closed once
+// this returns. The ID remains valid until passed to CloseBackingFile, which
+// may be done once the handles that use it have been released.
+func (c *Connection) OpenBackingFile(f *os.File) (fuseops.BackingID, error) {
+	m := fusekernel.BackingMap{Fd: int32(f.Fd())}
+	id, _, errno := unix.Syscall(
+		unix.SYS_IOCTL,
+		c.dev.Fd(),
+		fusekernel.DevIocBackingOpen,
+		uintptr(unsafe.Pointer(&m)))
+
+	// Keep f's finalizer from closing the descriptor during the ioctl.
+	runtime.KeepAlive(f)
+	if errno != 0 {
+		return 0, errno
+	}
+
+	return fuseops.BackingID(id), nil
+}
+
+// CloseBackingFile unregisters a backing file returned by OpenBackingFile.
+func (c *Connection) CloseBackingFile(id fuseops.BackingID) error {
+	arg := uint32(id)
+	_, _, errno := unix.Syscall(
+		unix.SYS_IOCTL,
+		c.dev.Fd(),
+		fusekernel.DevIocBackingClose,
+		uintptr(unsafe.Pointer(&arg)))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
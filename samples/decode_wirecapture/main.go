@@ -0,0 +1,69 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// A tool for printing a wire capture recorded with MountConfig.WireCapture.
+// Reads the capture from the file named on the command line, or from stdin.
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/jacobsa/fuse"
+)
+
+var fHex = flag.Bool("hex", false, "Also dump the captured bytes of each message.")
+
+func main() {
+	flag.Parse()
+
+	var r io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatalf("Open: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	cr, err := fuse.NewWireCaptureReader(bufio.NewReader(r))
+	if err != nil {
+		log.Fatalf("NewWireCaptureReader: %v", err)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	for {
+		p, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.Flush()
+			log.Fatalf("Next: %v", err)
+		}
+
+		fmt.Fprintln(w, p)
+		if *fHex {
+			fmt.Fprint(w, hex.Dump(p.Data))
+		}
+	}
+}
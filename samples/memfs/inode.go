@@ -19,9 +19,9 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"syscall"
 	"time"
 
-	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/fuseutil"
 )
@@ -411,15 +411,35 @@ func (in *inode) SetAttributes(
 	}
 }
 
-func (in *inode) Fallocate(mode uint32, offset uint64, length uint64) error {
-	if mode != 0 {
-		return fuse.ENOSYS
+func (in *inode) Fallocate(mode fuseops.FallocateMode, offset uint64, length uint64) error {
+	keepSize := mode&fuseops.FallocateKeepSize != 0
+	switch mode &^ fuseops.FallocateKeepSize {
+	case 0:
+		// There is no space to allocate in memory.
+
+	case fuseops.FallocatePunchHole, fuseops.FallocateZeroRange:
+		end := min(offset+length, uint64(len(in.contents)))
+		if offset < end {
+			clear(in.contents[offset:end])
+		}
+
+	default:
+		return syscall.EOPNOTSUPP
 	}
+
 	newSize := int(offset + length)
-	if newSize > len(in.contents) {
+	if !keepSize && newSize > len(in.contents) {
 		padding := make([]byte, newSize-len(in.contents))
 		in.contents = append(in.contents, padding...)
 		in.attrs.Size = offset + length
 	}
 	return nil
 }
+
+// Store the security contexts supplied for a newly created inode as extended
+// attributes, as a file system that labels its own inodes would.
+func (in *inode) SetSecurityContexts(ctxs []fuseops.SecurityContext) {
+	for _, c := range ctxs {
+		in.xattrs[c.Name] = c.Value
+	}
+}
@@ -260,6 +260,21 @@ func (fs *memFS) GetInodeAttributes(
 	return nil
 }
 
+func (fs *memFS) Statx(
+	ctx context.Context,
+	op *fuseops.StatxOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// Grab the inode. Its attributes include its creation time, which is
+	// returned as the birth time.
+	inode := fs.getInodeOrDie(op.Inode)
+	op.Attributes = inode.attrs
+	op.AttributesExpiration = time.Now().Add(365 * 24 * time.Hour)
+
+	return nil
+}
+
 func (fs *memFS) SetInodeAttributes(
 	ctx context.Context,
 	op *fuseops.SetInodeAttributesOp) error {
@@ -305,16 +320,19 @@ func (fs *memFS) MkDir(
 		return fuse.EEXIST
 	}
 
-	// Set up attributes from the child.
+	// Set up attributes from the child. The kernel has already applied the
+	// umask unless MountConfig.EnableDontMask is set, so applying it again
+	// does no harm.
 	childAttrs := fuseops.InodeAttributes{
 		Nlink: 1,
-		Mode:  op.Mode,
+		Mode:  op.Mode &^ op.Umask,
 		Uid:   fs.uid,
 		Gid:   fs.gid,
 	}
 
 	// Allocate a child.
 	childID, child := fs.allocateInode(childAttrs, op.Name)
+	child.SetSecurityContexts(op.SecurityContexts)
 
 	// Add an entry in the parent.
 	parent.AddChild(childID, op.Name, fuseutil.DT_Directory)
@@ -338,7 +356,7 @@ func (fs *memFS) MkNode(
 	defer fs.mu.Unlock()
 
 	var err error
-	op.Entry, err = fs.createFile(op.Parent, op.Name, op.Mode)
+	op.Entry, err = fs.createFile(op.Parent, op.Name, op.Mode&^op.Umask, op.SecurityContexts)
 	return err
 }
 
@@ -346,7 +364,8 @@ func (fs *memFS) MkNode(
 func (fs *memFS) createFile(
 	parentID fuseops.InodeID,
 	name string,
-	mode os.FileMode) (fuseops.ChildInodeEntry, error) {
+	mode os.FileMode,
+	secctx []fuseops.SecurityContext) (fuseops.ChildInodeEntry, error) {
 	// Grab the parent, which we will update shortly.
 	parent := fs.getInodeOrDie(parentID)
 
@@ -372,6 +391,7 @@ func (fs *memFS) createFile(
 
 	// Allocate a child.
 	childID, child := fs.allocateInode(childAttrs, name)
+	child.SetSecurityContexts(secctx)
 
 	// Add an entry in the parent.
 	parent.AddChild(childID, name, fuseutil.DT_File)
@@ -395,10 +415,42 @@ func (fs *memFS) CreateFile(
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
-	op.Entry, err = fs.createFile(op.Parent, op.Name, op.Mode)
+	op.Entry, err = fs.createFile(op.Parent, op.Name, op.Mode&^op.Umask, op.SecurityContexts)
 	return err
 }
 
+func (fs *memFS) CreateTmpFile(
+	ctx context.Context,
+	op *fuseops.CreateTmpFileOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// The child has no name until it is linked into a directory.
+	now := time.Now()
+	childAttrs := fuseops.InodeAttributes{
+		Mode:   op.Mode &^ op.Umask,
+		Atime:  now,
+		Mtime:  now,
+		Ctime:  now,
+		Crtime: now,
+		Uid:    fs.uid,
+		Gid:    fs.gid,
+	}
+
+	childID, child := fs.allocateInode(childAttrs, "")
+	child.SetSecurityContexts(op.SecurityContexts)
+
+	// Fill in the response entry.
+	op.Entry.Child = childID
+	op.Entry.Attributes = child.attrs
+
+	// We don't spontaneously mutate, so the kernel can cache as long as it wants
+	// (since it also handles invalidation).
+	op.Entry.AttributesExpiration = time.Now().Add(365 * 24 * time.Hour)
+
+	return nil
+}
+
 func (fs *memFS) CreateSymlink(
 	ctx context.Context,
 	op *fuseops.CreateSymlinkOp) error {
@@ -433,6 +485,7 @@ func (fs *memFS) CreateSymlink(
 
 	// Set up its target.
 	child.target = op.Target
+	child.SetSecurityContexts(op.SecurityContexts)
 
 	// Add an entry in the parent.
 	parent.AddChild(childID, op.Name, fuseutil.DT_Link)
@@ -494,6 +547,13 @@ func (fs *memFS) Rename(
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
+	// We don't do whiteouts, and exchanging can't be combined with anything.
+	switch op.Flags {
+	case 0, fuseops.RenameNoReplace, fuseops.RenameExchange:
+	default:
+		return fuse.EINVAL
+	}
+
 	// Ask the old parent for the child's inode ID and type.
 	oldParent := fs.getInodeOrDie(op.OldParent)
 	childID, childType, ok := oldParent.LookUpChild(op.OldName)
@@ -503,9 +563,26 @@ func (fs *memFS) Rename(
 	}
 
 	// If the new name exists already in the new parent, make sure it's not a
-	// non-empty directory, then delete it.
+	// non-empty directory, then delete it, unless asked not to touch it.
 	newParent := fs.getInodeOrDie(op.NewParent)
-	existingID, _, ok := newParent.LookUpChild(op.NewName)
+	existingID, existingType, ok := newParent.LookUpChild(op.NewName)
+
+	if op.Flags == fuseops.RenameExchange {
+		if !ok {
+			return fuse.ENOENT
+		}
+
+		oldParent.RemoveChild(op.OldName)
+		newParent.RemoveChild(op.NewName)
+		newParent.AddChild(childID, op.NewName, childType)
+		oldParent.AddChild(existingID, op.OldName, existingType)
+		return nil
+	}
+
+	if ok && op.Flags == fuseops.RenameNoReplace {
+		return fuse.EEXIST
+	}
+
 	if ok {
 		existing := fs.getInodeOrDie(existingID)
 
@@ -651,6 +728,12 @@ func (fs *memFS) OpenFile(
 		}
 	}
 
+	// With MountConfig.EnableAtomicTrunc, truncation is up to us.
+	if op.OpenFlags.IsTruncate() {
+		var size uint64
+		inode.SetAttributes(&size, nil, nil)
+	}
+
 	return nil
 }
 
@@ -701,6 +784,60 @@ func (fs *memFS) WriteFile(
 	return err
 }
 
+func (fs *memFS) CopyFileRange(
+	ctx context.Context,
+	op *fuseops.CopyFileRangeOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// Find the inodes in question.
+	src := fs.getInodeOrDie(op.SrcInode)
+	dst := fs.getInodeOrDie(op.DstInode)
+
+	// Copy what the source has; a short copy indicates its end. Reading into a
+	// temporary buffer makes this correct when the ranges overlap.
+	var buf []byte
+	if op.SrcOffset < uint64(len(src.contents)) {
+		n := min(op.Length, uint64(len(src.contents))-op.SrcOffset)
+		buf = make([]byte, n)
+		copy(buf, src.contents[op.SrcOffset:])
+	}
+
+	if _, err := dst.WriteAt(buf, int64(op.DstOffset)); err != nil {
+		return err
+	}
+
+	op.BytesCopied = uint64(len(buf))
+	return nil
+}
+
+// memfs files have no holes, except for the one at the end.
+func (fs *memFS) SeekFile(
+	ctx context.Context,
+	op *fuseops.SeekFileOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// Find the inode in question.
+	inode := fs.getInodeOrDie(op.Inode)
+
+	size := int64(len(inode.contents))
+	if op.Offset < 0 || op.Offset >= size {
+		return syscall.ENXIO
+	}
+
+	switch op.Whence {
+	case unix.SEEK_DATA:
+		op.ResultOffset = op.Offset
+	case unix.SEEK_HOLE:
+		op.ResultOffset = size
+	default:
+		return fuse.EINVAL
+	}
+
+	return nil
+}
+
 func (fs *memFS) FlushFile(
 	ctx context.Context,
 	op *fuseops.FlushFileOp) (err error) {
@@ -793,11 +930,11 @@ func (fs *memFS) setXattrHelper(inode *inode, op *fuseops.SetXattrOp) error {
 	_, ok := inode.xattrs[op.Name]
 
 	switch op.Flags {
-	case unix.XATTR_CREATE:
+	case xattrCreate:
 		if ok {
 			return fuse.EEXIST
 		}
-	case unix.XATTR_REPLACE:
+	case xattrReplace:
 		if !ok {
 			return fuse.ENOATTR
 		}
@@ -814,6 +951,5 @@ func (fs *memFS) Fallocate(ctx context.Context,
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 	inode := fs.getInodeOrDie(op.Inode)
-	inode.Fallocate(op.Mode, op.Offset, op.Length)
-	return nil
+	return inode.Fallocate(op.Mode, op.Offset, op.Length)
 }
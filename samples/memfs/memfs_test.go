@@ -2109,6 +2109,11 @@ func (t *atomicOTruncTest) OpenFileWithOTrunc() {
 	} else {
 		t.checkOpenFlagsNotContainsFlag(fileName, fusekernel.OpenTruncate)
 	}
+
+	// Either way, the file should have been truncated.
+	fi, err := f.Stat()
+	AssertEq(nil, err)
+	ExpectEq(0, fi.Size())
 }
 
 type AtmoicOTruncEnabledTest struct {
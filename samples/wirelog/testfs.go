@@ -48,7 +48,7 @@ func (fs *testFS) LookUpInode(
 	ctx context.Context,
 	op *fuseops.LookUpInodeOp) error {
 	if wlog := fuse.GetWirelog(ctx); wlog != nil {
-		wlog.Extra["lookup"] = "yes"
+		wlog.SetExtra("lookup", "yes")
 	}
 	if op.Parent == rootInode && op.Name == fileName {
 		op.Entry.Child = fileInode
@@ -0,0 +1,94 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"errors"
+	"io"
+	"syscall"
+	"unsafe"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/buffer"
+)
+
+// Reply to a ReadFileOp whose data is to come from op.SpliceFile. If splicing
+// was negotiated, try to splice the data to the kernel, returning true if the
+// reply was sent, or if sending it failed part way, in which case the error
+// is for the connection rather than the op.
+//
+// Otherwise read the data into op.Dst so that the caller can reply as usual,
+// returning false and the op's error.
+func (c *Connection) replyFromFile(
+	m *buffer.OutMessage,
+	fuseID uint64,
+	op *fuseops.ReadFileOp) (bool, error) {
+	size := max(min(op.BytesRead, int(op.Size)), 0)
+
+	if c.splice {
+		n, sent, err := c.spliceReply(m, fuseID, op.SpliceFile, op.SpliceOffset, size)
+		if sent {
+			op.BytesRead = n
+			return true, err
+		}
+	}
+
+	if len(op.Dst) < size {
+		op.Dst = make([]byte, size)
+	}
+
+	n, err := op.SpliceFile.ReadAt(op.Dst[:size], op.SpliceOffset)
+	op.Data = nil
+	op.BytesRead = n
+	if err == nil || err == io.EOF {
+		return false, nil
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return false, errno
+	}
+
+	return false, EIO
+}
+
+// Reply to a ReadFileOp whose data is to come from op.Reader, by reading it
+// straight into a buffer appended to the message, returning the op's error.
+func replyFromReader(m *buffer.OutMessage, op *fuseops.ReadFileOp) error {
+	op.Dst = nil
+	op.Data = nil
+	op.BytesRead = 0
+
+	size := int(max(op.Size, 0))
+	if size == 0 {
+		return nil
+	}
+
+	dst := unsafe.Slice((*byte)(m.Grow(size)), size)
+	n, err := io.ReadFull(op.Reader, dst)
+	m.ShrinkTo(buffer.OutMessageHeaderSize + n)
+	op.Dst = dst[:n]
+	op.BytesRead = n
+	if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno
+	}
+
+	return EIO
+}
@@ -0,0 +1,185 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jacobsa/fuse/internal/buffer"
+	"golang.org/x/sys/unix"
+)
+
+const spliceSupported = true
+
+// A pair of pipes through which to splice a reply to the kernel. The data is
+// spliced from the file into the first, and then moved after the header in
+// the second, since the header records the length of the data.
+type splicePipe struct {
+	data [2]int
+	msg  [2]int
+
+	// The capacity of each pipe.
+	size int
+}
+
+func newSplicePipe(size int) (*splicePipe, error) {
+	p := &splicePipe{
+		data: [2]int{-1, -1},
+		msg:  [2]int{-1, -1},
+	}
+
+	for _, fds := range []*[2]int{&p.data, &p.msg} {
+		if err := unix.Pipe2(fds[:], unix.O_CLOEXEC); err != nil {
+			p.close()
+			return nil, err
+		}
+
+		// Unprivileged processes can't grow pipes beyond
+		// /proc/sys/fs/pipe-max-size, so settle for the largest size allowed.
+		got, err := unix.FcntlInt(uintptr(fds[0]), unix.F_GETPIPE_SZ, 0)
+		for want := size; err == nil && want > got; want /= 2 {
+			if n, err := unix.FcntlInt(uintptr(fds[0]), unix.F_SETPIPE_SZ, want); err == nil {
+				got = n
+			}
+		}
+
+		if err != nil {
+			p.close()
+			return nil, err
+		}
+
+		if p.size == 0 || got < p.size {
+			p.size = got
+		}
+	}
+
+	return p, nil
+}
+
+func (p *splicePipe) close() {
+	for _, fd := range []int{p.data[0], p.data[1], p.msg[0], p.msg[1]} {
+		if fd >= 0 {
+			unix.Close(fd)
+		}
+	}
+}
+
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) getSplicePipe() (*splicePipe, error) {
+	c.mu.Lock()
+	if n := len(c.splicePipes); n > 0 {
+		p := c.splicePipes[n-1]
+		c.splicePipes = c.splicePipes[:n-1]
+		c.mu.Unlock()
+		return p, nil
+	}
+
+	maxPayload := c.maxPayload
+	c.mu.Unlock()
+
+	return newSplicePipe(maxPayload + 2*buffer.GetPageSize())
+}
+
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) putSplicePipe(p *splicePipe) {
+	c.mu.Lock()
+	c.splicePipes = append(c.splicePipes, p)
+	c.mu.Unlock()
+}
+
+// Splice a reply carrying up to size bytes from f at off to the kernel,
+// returning the number of bytes of data sent. If false is returned, nothing
+// was sent and the caller should fall back to copying the data, which also
+// reports any error reading it.
+func (c *Connection) spliceReply(
+	m *buffer.OutMessage,
+	fuseID uint64,
+	f *os.File,
+	off int64,
+	size int) (int, bool, error) {
+	p, err := c.getSplicePipe()
+	if err != nil {
+		return 0, false, nil
+	}
+
+	// Pipes hold a fixed number of buffers of up to a page each. Data that
+	// isn't page aligned spans an extra one, and the header takes another.
+	if size+2*buffer.GetPageSize() > p.size {
+		c.putSplicePipe(p)
+		return 0, false, nil
+	}
+
+	// Fill the data pipe, stopping early at the end of the file. The pipes
+	// may hold partial messages after a failure, so they aren't reused.
+	var n int
+	for n < size {
+		k, err := unix.Splice(int(f.Fd()), &off, p.data[1], nil, size-n, unix.SPLICE_F_MOVE)
+		if err != nil {
+			p.close()
+			return 0, false, nil
+		}
+
+		if k == 0 {
+			break
+		}
+
+		n += int(k)
+	}
+
+	h := m.OutHeader()
+	h.Unique = fuseID
+	h.Error = 0
+	h.Len = uint32(buffer.OutMessageHeaderSize + n)
+
+	if _, err := unix.Write(p.msg[1], m.OutHeaderBytes()); err != nil {
+		p.close()
+		return 0, false, nil
+	}
+
+	for moved := 0; moved < n; {
+		k, err := unix.Splice(p.data[0], nil, p.msg[1], nil, n-moved, unix.SPLICE_F_MOVE)
+		if err != nil {
+			p.close()
+			return 0, false, nil
+		}
+
+		moved += int(k)
+	}
+
+	// The kernel requires the whole message in a single call.
+	flags := 0
+	if c.spliceMove {
+		flags = unix.SPLICE_F_MOVE
+	}
+
+	k, err := unix.Splice(p.msg[0], nil, int(c.dev.Fd()), nil, int(h.Len), flags)
+	if err == nil && k != int64(h.Len) {
+		err = fmt.Errorf("Spliced %d bytes; expected %d", k, h.Len)
+	}
+
+	if err != nil {
+		p.close()
+		return n, true, err
+	}
+
+	c.putSplicePipe(p)
+
+	if c.capture != nil {
+		c.capture.recordPrefix(WireCaptureOut, int(h.Len), m.OutHeaderBytes())
+	}
+
+	return n, true, nil
+}
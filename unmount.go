@@ -14,7 +14,12 @@
 
 package fuse
 
-import "errors"
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"time"
+)
 
 var ErrExternallyManagedMountPoint = errors.New("externally managed mount point, skipping unmount")
 
@@ -23,5 +28,44 @@ var ErrExternallyManagedMountPoint = errors.New("externally managed mount point,
 // For external mountpoints (like /dev/fd/N), it returns ErrExternallyManagedMountPoint
 // for unsuccessful unmount attempt.
 func Unmount(dir string) error {
-	return unmount(dir)
+	return unmount(dir, UnmountOptions{})
+}
+
+// UnmountOptions changes how UnmountWithOptions unmounts a file system.
+type UnmountOptions struct {
+	// Detach the file system from the directory hierarchy immediately, and
+	// finish unmounting it once it is no longer busy (MNT_DETACH, or
+	// fusermount -z). Linux only.
+	Lazy bool
+
+	// Unmount the file system even if it is busy (MNT_FORCE). On Linux this
+	// aborts the connection, failing outstanding and future ops on it, and
+	// needs root or CAP_SYS_ADMIN, since fusermount can't do it.
+	Force bool
+
+	// If non-zero, try again when the file system is busy, with increasing
+	// delays, until this much time has passed.
+	RetryTimeout time.Duration
+}
+
+// UnmountWithOptions is like Unmount, but lets the caller ask for a lazy or
+// forced unmount, or for retrying while the file system is busy.
+func UnmountWithOptions(dir string, opts UnmountOptions) error {
+	deadline := time.Now().Add(opts.RetryTimeout)
+	delay := 10 * time.Millisecond
+	for {
+		err := unmount(dir, opts)
+		if err == nil || !isBusy(err) || time.Now().Add(delay).After(deadline) {
+			return err
+		}
+
+		time.Sleep(delay)
+		delay = min(time.Duration(1.3*float64(delay)), time.Second)
+	}
+}
+
+// Is the supplied unmount error due to the file system being busy? Errors
+// from fusermount only carry its output.
+func isBusy(err error) bool {
+	return errors.Is(err, syscall.EBUSY) || strings.Contains(err.Error(), "resource busy")
 }
@@ -3,27 +3,55 @@ package fuse
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
+
+	"golang.org/x/sys/unix"
 )
 
-func unmount(dir string) error {
-	if err := fuserunmount(dir); err != nil {
+func unmount(dir string, opts UnmountOptions) error {
+	var err error
+	if opts.Force {
+		err = forceUnmount(dir, opts.Lazy)
+	} else {
+		err = fuserunmount(dir, opts.Lazy)
+	}
+	if err != nil {
 		// Return custom error for fusermount unmount error for /dev/fd/N mountpoints
 		if strings.HasPrefix(dir, "/dev/fd/") {
 			return fmt.Errorf("%w: %s", ErrExternallyManagedMountPoint, err)
 		}
 		return err
 	}
+
+	// Let an auto_unmount helper exit, now that there's nothing to clean up.
+	autoUnmountSockets.close(dir)
+	return nil
+}
+
+// Unmount with umount2(2), which fusermount can't do when forcing.
+func forceUnmount(dir string, lazy bool) error {
+	flags := unix.MNT_FORCE
+	if lazy {
+		flags |= unix.MNT_DETACH
+	}
+	if err := unix.Unmount(dir, flags); err != nil {
+		return &os.PathError{Op: "unmount", Path: dir, Err: err}
+	}
 	return nil
 }
 
-func fuserunmount(dir string) error {
+func fuserunmount(dir string, lazy bool) error {
 	fusermount, err := findFusermount()
 	if err != nil {
 		return err
 	}
-	cmd := exec.Command(fusermount, "-u", dir)
+	args := []string{"-u"}
+	if lazy {
+		args = append(args, "-z")
+	}
+	cmd := exec.Command(fusermount, append(args, dir)...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		if len(output) > 0 {
@@ -2,13 +2,16 @@ package fuse
 
 import (
 	"errors"
+	"os"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func Test_umountExpectCustomError(t *testing.T) {
 	t.Setenv("PATH", "") // Clear PATH to fail unmount with fusermount is not found
 
-	err := unmount("/dev/fd/42")
+	err := unmount("/dev/fd/42", UnmountOptions{})
 	if err == nil || !errors.Is(err, ErrExternallyManagedMountPoint) {
 		t.Errorf("Expected: %v, but got: %v", ErrExternallyManagedMountPoint, err)
 	}
@@ -17,7 +20,7 @@ func Test_umountExpectCustomError(t *testing.T) {
 func Test_umountNoCustomError(t *testing.T) {
 	t.Setenv("PATH", "") // Clear PATH to fail unmount with fusermount is not found
 
-	err := unmount("/dev")
+	err := unmount("/dev", UnmountOptions{})
 	if err == nil {
 		t.Fatal("Expected error but got none.")
 	}
@@ -25,3 +28,31 @@ func Test_umountNoCustomError(t *testing.T) {
 		t.Error("Custom error was not expected.")
 	}
 }
+
+func Test_unmountWithOptionsGivesUpWhenNotBusy(t *testing.T) {
+	t.Setenv("PATH", "")
+
+	start := time.Now()
+	err := UnmountWithOptions("/dev", UnmountOptions{Lazy: true, RetryTimeout: time.Minute})
+	if err == nil {
+		t.Fatal("Expected error but got none.")
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("Retried for %v on an error other than EBUSY", d)
+	}
+}
+
+func Test_isBusy(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&os.PathError{Op: "unmount", Path: "/mnt", Err: syscall.EBUSY}, true},
+		{errors.New("exit status 1: fusermount3: failed to unmount /mnt: Device or resource busy"), true},
+		{&os.PathError{Op: "unmount", Path: "/mnt", Err: syscall.EINVAL}, false},
+	} {
+		if got := isBusy(tc.err); got != tc.want {
+			t.Errorf("isBusy(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
@@ -4,12 +4,22 @@
 package fuse
 
 import (
+	"errors"
 	"os"
-	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
-func unmount(dir string) error {
-	if err := syscall.Unmount(dir, 0); err != nil {
+func unmount(dir string, opts UnmountOptions) error {
+	if opts.Lazy {
+		return errors.New("lazy unmounting is only supported on Linux")
+	}
+
+	var flags int
+	if opts.Force {
+		flags |= unix.MNT_FORCE
+	}
+	if err := unix.Unmount(dir, flags); err != nil {
 		return &os.PathError{Op: "unmount", Path: dir, Err: err}
 	}
 
@@ -0,0 +1,305 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse/internal/fusekernel"
+	"golang.org/x/sys/unix"
+)
+
+// A wire capture, enabled with MountConfig.WireCapture, records the raw
+// messages exchanged with the kernel, unlike the wire log, which records
+// decoded ops. The format is:
+//
+//   - An 8-byte magic string, "fusecap1".
+//
+//   - For each message, a 17-byte little-endian header consisting of the
+//     direction (one byte), the capture time in nanoseconds since the Unix
+//     epoch (int64), the length of the message (uint32), and the number of
+//     bytes of it that were captured (uint32), followed by the captured bytes.
+//
+// Use WireCaptureReader to decode a capture.
+const wireCaptureMagic = "fusecap1"
+
+const wireCapturePacketHeaderSize = 1 + 8 + 4 + 4
+
+// WireCaptureDirection says which way a captured message was travelling.
+type WireCaptureDirection uint8
+
+const (
+	// A request from the kernel.
+	WireCaptureIn WireCaptureDirection = 1
+
+	// A reply or notification to the kernel.
+	WireCaptureOut WireCaptureDirection = 2
+)
+
+// A WireCapturePacket is a single message from a wire capture.
+type WireCapturePacket struct {
+	Time      time.Time
+	Direction WireCaptureDirection
+
+	// The length of the message, and its leading bytes. Data is shorter than
+	// Len if the capture was made with a positive WireCaptureSnapLen.
+	Len  int
+	Data []byte
+}
+
+// Unique returns the request ID from the packet's header, or zero if too
+// little of the header was captured. Replies have the same ID as the request
+// they answer, and notifications have ID zero.
+func (p *WireCapturePacket) Unique() uint64 {
+	if len(p.Data) < 16 {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint64(p.Data[8:16])
+}
+
+// String returns a one-line summary of the packet's header.
+func (p *WireCapturePacket) String() string {
+	ts := p.Time.Format("15:04:05.000000")
+
+	switch {
+	case p.Direction == WireCaptureIn && len(p.Data) >= fusekernel.InHeaderSize:
+		le := binary.LittleEndian
+		return fmt.Sprintf(
+			"%s -> unique=%d %s nodeid=%d uid=%d gid=%d pid=%d len=%d",
+			ts,
+			p.Unique(),
+			opcodeName(le.Uint32(p.Data[4:8])),
+			le.Uint64(p.Data[16:24]),
+			le.Uint32(p.Data[24:28]),
+			le.Uint32(p.Data[28:32]),
+			le.Uint32(p.Data[32:36]),
+			p.Len)
+
+	case p.Direction == WireCaptureOut && len(p.Data) >= 16:
+		errno := int32(binary.LittleEndian.Uint32(p.Data[4:8]))
+		if p.Unique() == 0 {
+			return fmt.Sprintf("%s <- %s len=%d", ts, notifyCodeName(errno), p.Len)
+		}
+
+		status := "ok"
+		if errno != 0 {
+			status = unix.ErrnoName(syscall.Errno(-errno))
+			if status == "" {
+				status = fmt.Sprintf("error=%d", errno)
+			}
+		}
+
+		return fmt.Sprintf("%s <- unique=%d %s len=%d", ts, p.Unique(), status, p.Len)
+	}
+
+	return fmt.Sprintf("%s ?? direction=%d len=%d (truncated)", ts, p.Direction, p.Len)
+}
+
+// ErrNotWireCapture is returned by NewWireCaptureReader when its input does
+// not begin with a wire capture header.
+var ErrNotWireCapture = errors.New("not a fuse wire capture")
+
+// WireCaptureReader decodes a wire capture written by a connection whose
+// MountConfig.WireCapture was set.
+type WireCaptureReader struct {
+	r io.Reader
+}
+
+// NewWireCaptureReader checks that r begins with a wire capture header and
+// returns a reader for the packets that follow.
+func NewWireCaptureReader(r io.Reader) (*WireCaptureReader, error) {
+	magic := make([]byte, len(wireCaptureMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	if string(magic) != wireCaptureMagic {
+		return nil, ErrNotWireCapture
+	}
+
+	return &WireCaptureReader{r: r}, nil
+}
+
+// Next returns the next packet in the capture, or io.EOF at its end. A
+// capture that ends partway through a packet yields io.ErrUnexpectedEOF.
+func (cr *WireCaptureReader) Next() (*WireCapturePacket, error) {
+	var hdr [wireCapturePacketHeaderSize]byte
+	if _, err := io.ReadFull(cr.r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	p := &WireCapturePacket{
+		Direction: WireCaptureDirection(hdr[0]),
+		Time:      time.Unix(0, int64(binary.LittleEndian.Uint64(hdr[1:9]))),
+		Len:       int(binary.LittleEndian.Uint32(hdr[9:13])),
+		Data:      make([]byte, binary.LittleEndian.Uint32(hdr[13:17])),
+	}
+
+	if _, err := io.ReadFull(cr.r, p.Data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Writes raw messages to MountConfig.WireCapture.
+type wireCapture struct {
+	w       io.Writer
+	snapLen int
+
+	mu sync.Mutex
+
+	// Whether the magic string has been written.
+	//
+	// GUARDED_BY(mu)
+	started bool
+}
+
+// Record a message made up of the concatenation of bufs. Errors from the
+// underlying writer are ignored, as they are for the wire log.
+//
+// LOCKS_EXCLUDED(wc.mu)
+func (wc *wireCapture) record(dir WireCaptureDirection, bufs ...[]byte) {
+	var n int
+	for _, b := range bufs {
+		n += len(b)
+	}
+
+	wc.recordPrefix(dir, n, bufs...)
+}
+
+// Like record, but for a message of length n of which bufs hold only a
+// prefix, such as a reply whose data was spliced to the kernel.
+//
+// LOCKS_EXCLUDED(wc.mu)
+func (wc *wireCapture) recordPrefix(dir WireCaptureDirection, n int, bufs ...[]byte) {
+	now := time.Now()
+
+	var captured int
+	for _, b := range bufs {
+		captured += len(b)
+	}
+
+	if wc.snapLen > 0 {
+		captured = min(captured, wc.snapLen)
+	}
+
+	out := make([]byte, wireCapturePacketHeaderSize, wireCapturePacketHeaderSize+captured)
+	out[0] = byte(dir)
+	binary.LittleEndian.PutUint64(out[1:9], uint64(now.UnixNano()))
+	binary.LittleEndian.PutUint32(out[9:13], uint32(n))
+	binary.LittleEndian.PutUint32(out[13:17], uint32(captured))
+	for _, b := range bufs {
+		room := cap(out) - len(out)
+		out = append(out, b[:min(len(b), room)]...)
+	}
+
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	if !wc.started {
+		wc.started = true
+		wc.w.Write([]byte(wireCaptureMagic))
+	}
+
+	wc.w.Write(out)
+}
+
+var opcodeNames = map[uint32]string{
+	fusekernel.OpLookup:        "LOOKUP",
+	fusekernel.OpForget:        "FORGET",
+	fusekernel.OpGetattr:       "GETATTR",
+	fusekernel.OpSetattr:       "SETATTR",
+	fusekernel.OpReadlink:      "READLINK",
+	fusekernel.OpSymlink:       "SYMLINK",
+	fusekernel.OpMknod:         "MKNOD",
+	fusekernel.OpMkdir:         "MKDIR",
+	fusekernel.OpUnlink:        "UNLINK",
+	fusekernel.OpRmdir:         "RMDIR",
+	fusekernel.OpRename:        "RENAME",
+	fusekernel.OpLink:          "LINK",
+	fusekernel.OpOpen:          "OPEN",
+	fusekernel.OpRead:          "READ",
+	fusekernel.OpWrite:         "WRITE",
+	fusekernel.OpStatfs:        "STATFS",
+	fusekernel.OpRelease:       "RELEASE",
+	fusekernel.OpFsync:         "FSYNC",
+	fusekernel.OpSetxattr:      "SETXATTR",
+	fusekernel.OpGetxattr:      "GETXATTR",
+	fusekernel.OpListxattr:     "LISTXATTR",
+	fusekernel.OpRemovexattr:   "REMOVEXATTR",
+	fusekernel.OpFlush:         "FLUSH",
+	fusekernel.OpInit:          "INIT",
+	fusekernel.OpOpendir:       "OPENDIR",
+	fusekernel.OpReaddir:       "READDIR",
+	fusekernel.OpReleasedir:    "RELEASEDIR",
+	fusekernel.OpFsyncdir:      "FSYNCDIR",
+	fusekernel.OpGetlk:         "GETLK",
+	fusekernel.OpSetlk:         "SETLK",
+	fusekernel.OpSetlkw:        "SETLKW",
+	fusekernel.OpAccess:        "ACCESS",
+	fusekernel.OpCreate:        "CREATE",
+	fusekernel.OpInterrupt:     "INTERRUPT",
+	fusekernel.OpBmap:          "BMAP",
+	fusekernel.OpDestroy:       "DESTROY",
+	fusekernel.OpIoctl:         "IOCTL",
+	fusekernel.OpPoll:          "POLL",
+	fusekernel.OpNotifyReply:   "NOTIFY_REPLY",
+	fusekernel.OpBatchForget:   "BATCH_FORGET",
+	fusekernel.OpFallocate:     "FALLOCATE",
+	fusekernel.OpReaddirplus:   "READDIRPLUS",
+	fusekernel.OpRename2:       "RENAME2",
+	fusekernel.OpLseek:         "LSEEK",
+	fusekernel.OpCopyFileRange: "COPY_FILE_RANGE",
+	fusekernel.OpSetupMapping:  "SETUPMAPPING",
+	fusekernel.OpRemoveMapping: "REMOVEMAPPING",
+	fusekernel.OpSyncFS:        "SYNCFS",
+	fusekernel.OpTmpfile:       "TMPFILE",
+	fusekernel.OpStatx:         "STATX",
+	fusekernel.OpSetvolname:    "SETVOLNAME",
+	fusekernel.OpGetxtimes:     "GETXTIMES",
+	fusekernel.OpExchange:      "EXCHANGE",
+}
+
+func opcodeName(opcode uint32) string {
+	if name, ok := opcodeNames[opcode]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("OPCODE_%d", opcode)
+}
+
+func notifyCodeName(code int32) string {
+	switch code {
+	case fusekernel.NotifyCodePoll:
+		return "NOTIFY_POLL"
+	case fusekernel.NotifyCodeInvalInode:
+		return "NOTIFY_INVAL_INODE"
+	case fusekernel.NotifyCodeInvalEntry:
+		return "NOTIFY_INVAL_ENTRY"
+	}
+
+	return fmt.Sprintf("NOTIFY_%d", code)
+}
@@ -0,0 +1,65 @@
+package fuse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse/internal/fusekernel"
+)
+
+func Test_wireCapture(t *testing.T) {
+	le := binary.LittleEndian
+
+	in := make([]byte, fusekernel.InHeaderSize+5)
+	le.PutUint32(in[0:4], uint32(len(in)))
+	le.PutUint32(in[4:8], fusekernel.OpLookup)
+	le.PutUint64(in[8:16], 7)
+	le.PutUint64(in[16:24], 1)
+	copy(in[fusekernel.InHeaderSize:], "taco\x00")
+
+	out := make([]byte, 16)
+	le.PutUint32(out[0:4], 16)
+	errno := -int32(syscall.ENOENT)
+	le.PutUint32(out[4:8], uint32(errno))
+	le.PutUint64(out[8:16], 7)
+
+	var buf bytes.Buffer
+	wc := &wireCapture{w: &buf, snapLen: fusekernel.InHeaderSize}
+	wc.record(WireCaptureIn, in)
+	wc.record(WireCaptureOut, out[:8], out[8:])
+
+	cr, err := NewWireCaptureReader(&buf)
+	if err != nil {
+		t.Fatalf("NewWireCaptureReader: %v", err)
+	}
+
+	p, err := cr.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if p.Direction != WireCaptureIn || p.Len != len(in) || len(p.Data) != fusekernel.InHeaderSize {
+		t.Errorf("unexpected request packet: %+v", p)
+	}
+	if s := p.String(); !strings.Contains(s, "-> unique=7 LOOKUP nodeid=1") {
+		t.Errorf("unexpected request summary: %s", s)
+	}
+
+	p, err = cr.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if !bytes.Equal(p.Data, out) {
+		t.Errorf("expected %x, got %x", out, p.Data)
+	}
+	if s := p.String(); !strings.Contains(s, "<- unique=7 ENOENT len=16") {
+		t.Errorf("unexpected reply summary: %s", s)
+	}
+
+	if _, err := cr.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
@@ -15,94 +15,671 @@
 package fuse
 
 import (
-	"encoding/json"
-	"errors"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
 	"reflect"
+	"runtime"
 	"slices"
-	"syscall"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/buffer"
+	"golang.org/x/sys/unix"
 )
 
+// WireLogVersion is the version of the WireLogRecord schema written by this
+// package, recorded in each record's Version field. It is incremented when
+// fields are renamed or change meaning, but not when fields are added.
+const WireLogVersion = 1
+
 // NewWireLogRecord creates a new empty WireLogRecord.
 func NewWireLogRecord() *WireLogRecord {
 	return &WireLogRecord{
+		Version:   WireLogVersion,
 		StartTime: time.Now(),
 		Args:      make(map[string]any),
 		Extra:     make(map[string]any),
+		state:     &wireLogRecordState{},
+	}
+}
+
+// Records used by connections, which are recycled once their op has been
+// replied to so that wire logging allocates little per op.
+var wireLogRecordPool = sync.Pool{
+	New: func() any { return NewWireLogRecord() },
+}
+
+// Return an empty record from the pool, with its start time set to now.
+func getWireLogRecord() *WireLogRecord {
+	wlog := wireLogRecordPool.Get().(*WireLogRecord)
+	wlog.Version = WireLogVersion
+	wlog.StartTime = time.Now()
+	return wlog
+}
+
+// Reset a record and return it to the pool. Its maps are kept, emptied, for
+// reuse. Records that have been handed out by GetWirelog are left alone.
+func putWireLogRecord(wlog *WireLogRecord) {
+	if wlog.state.escaped.Load() {
+		return
 	}
+
+	args, extra, state := wlog.Args, wlog.Extra, wlog.state
+	clear(args)
+	clear(extra)
+	state.sealed = false
+
+	*wlog = WireLogRecord{Args: args, Extra: extra, state: state}
+	wireLogRecordPool.Put(wlog)
 }
 
-// A WireLogRecord is created for each FUSE operation when WireLogger is
-// non-nil. Fields are filled in by jacobsa/fuse; file system implementations
-// can add their own fields by writing to the Extra map.
+// A WireLogRecord is created for each FUSE operation when WireLogger or
+// OpTracer is non-nil. Fields are filled in by jacobsa/fuse; file system implementations
+// can add their own fields with SetExtra and AddDuration.
+//
+// Extra is snapshotted when the op is replied to, before the record is
+// written. Writing to the Extra map directly is safe only from the goroutine
+// that replies to the op, before it does so.
+//
+// StartTime is the time at which the op was read from the kernel, and Duration
+// the time until it was replied to. If the server reports when its handler
+// started with MarkHandlerStart, Duration is further split into QueueDelay,
+// the time the op waited to be dispatched, and HandlerDuration.
+//
+// If the kernel asked to interrupt the op before it was replied to,
+// Interrupted is set and CancelLatency is the time from the first interrupt
+// request to the reply. The interrupt request itself is logged as an op named
+// "InterruptOp", whose FuseID argument identifies the interrupted op.
+//
+// Records named "Mount" and "Unmount" mark the start and end of each mount
+// session. The Args of a Mount record give the protocol version and init flags
+// offered by the kernel and those negotiated; those of an Unmount record give
+// the Uptime of the mount. For a connection handed over between processes
+// (see MountedFileSystem.Detach), the Mount record of the new process has
+// Resumed set and the Unmount record of the old one has Detached set.
+//
+// If MountConfig.WireLogHandleSessions is set, a record named "HandleSummary"
+// follows the record for each op that releases a file or directory handle.
+// Its Args give the Handle, the Inode it was opened on, the number of Ops on
+// it, the BytesRead and BytesWritten through it, and its Lifetime.
+//
+// The first time the server replies ENOSYS to an op of a given type, a record
+// named "NotImplemented" follows. Its Args give the Op type, whether the kernel
+// stops sending ops of that type (KernelStops), and, if
+// MountConfig.NotImplementedReplies replaces the reply, the Reply sent instead.
+//
+// The wirelogfmt package decodes records written with the default formatter.
+//
+// Records are recycled once their op has been replied to, so neither file
+// systems nor OpTracers may retain them beyond that point.
 type WireLogRecord struct {
-	Operation string
-	StartTime time.Time
-	Duration  time.Duration
-	Status    int
-	Context   *fuseops.OpContext
-	Args      map[string]any // Serialized representation of the fuseops.*Op struct
-	Extra     map[string]any // Custom fields added by file system implementation
+	Version         int // WireLogVersion; zero in logs that predate it
+	Operation       string
+	StartTime       time.Time
+	Duration        time.Duration
+	QueueDelay      time.Duration
+	HandlerDuration time.Duration
+	Status          int
+	StatusName      string        // Symbolic name of Status, e.g. "ENOENT"; empty on success
+	Interrupted     bool          `json:",omitempty"`
+	CancelLatency   time.Duration `json:",omitempty"`
+	Worker          int           `json:",omitempty"` // Set by MarkWorker
+	Goroutine       uint64        `json:",omitempty"` // Set by MarkHandlerStart
+	TraceParent     string        `json:",omitempty"` // W3C traceparent; see SetTraceParent
+	HandleSession   uint64        `json:",omitempty"` // See MountConfig.WireLogHandleSessions
+	Context         *fuseops.OpContext
+	Args            map[string]any // Serialized representation of the fuseops.*Op struct
+	Extra           map[string]any // Custom fields added by file system implementation
+
+	// Set by MarkHandlerStart.
+	handlerStart time.Time
+
+	// Storage for Context, to save an allocation.
+	opContext fuseops.OpContext
+
+	// The time at which the kernel asked to interrupt the op, if it did.
+	interruptTime time.Time
+
+	// The path of the file the op refers to, resolved before the op's reply
+	// updated the paths of the connection. See MountConfig.WireLogResolvePaths.
+	path string
+
+	// Nil for records not created by NewWireLogRecord, e.g. those decoded
+	// from a log.
+	state *wireLogRecordState
 }
 
-var ignoredParams = []string{"OpContext", "Dst", "Data"}
+// Synchronization for a WireLogRecord, kept apart from it so that records
+// remain copyable values.
+type wireLogRecordState struct {
+	// Set once the record has been returned by GetWirelog.
+	escaped atomic.Bool
 
-func formatWireLogEntry(op any, opErr error, wlog *WireLogRecord) ([]byte, error) {
-	v := reflect.ValueOf(op).Elem()
-	t := v.Type()
+	mu sync.Mutex
+
+	// Set when Extra is snapshotted, after which SetExtra and AddDuration do
+	// nothing.
+	//
+	// GUARDED_BY(mu)
+	sealed bool
+}
+
+// MarkHandlerStart records that the server has begun handling the op
+// associated with the supplied context, which must have been returned by
+// Connection.ReadOp, for the purposes of the wire log's QueueDelay and
+// HandlerDuration fields. It does nothing if the op has no wire log record.
+//
+// The ID of the calling goroutine is recorded too, in the Goroutine field.
+//
+// Servers that dispatch ops to a pool of goroutines should call this when the
+// op is picked up; the server returned by fuseutil.NewFileSystemServer does
+// so.
+func MarkHandlerStart(ctx context.Context) {
+	if wlog := wireLogRecord(ctx); wlog != nil {
+		wlog.handlerStart = time.Now()
+		wlog.Goroutine = goroutineID()
+	}
+}
+
+// MarkWorker records the index of the worker handling the op associated with
+// the supplied context in the wire log's Worker field, for servers that
+// dispatch ops to a fixed pool of workers. Workers should be numbered from
+// one, since zero means that the worker is unknown. It does nothing if the op
+// has no wire log record.
+func MarkWorker(ctx context.Context, worker int) {
+	if wlog := wireLogRecord(ctx); wlog != nil {
+		wlog.Worker = worker
+	}
+}
 
+// SetExtra sets a custom field of the record. It may be called concurrently
+// from multiple goroutines. Calls made after the op has been replied to are
+// ignored.
+//
+// LOCKS_EXCLUDED(wlog.state.mu)
+func (wlog *WireLogRecord) SetExtra(key string, value any) {
+	if wlog.state != nil {
+		wlog.state.mu.Lock()
+		defer wlog.state.mu.Unlock()
+
+		if wlog.state.sealed {
+			return
+		}
+	}
+
+	if wlog.Extra == nil {
+		wlog.Extra = make(map[string]any)
+	}
+	wlog.Extra[key] = value
+}
+
+// AddDuration adds d to a custom field of the record holding a
+// time.Duration, such as the total time spent waiting on a backend, starting
+// from zero if the field is unset. It may be called concurrently from
+// multiple goroutines. Calls made after the op has been replied to are
+// ignored.
+//
+// LOCKS_EXCLUDED(wlog.state.mu)
+func (wlog *WireLogRecord) AddDuration(key string, d time.Duration) {
+	if wlog.state != nil {
+		wlog.state.mu.Lock()
+		defer wlog.state.mu.Unlock()
+
+		if wlog.state.sealed {
+			return
+		}
+	}
+
+	if wlog.Extra == nil {
+		wlog.Extra = make(map[string]any)
+	}
+	prev, _ := wlog.Extra[key].(time.Duration)
+	wlog.Extra[key] = prev + d
+}
+
+// Stop SetExtra and AddDuration from changing the record, so that it can be
+// serialized.
+//
+// LOCKS_EXCLUDED(wlog.state.mu)
+func (wlog *WireLogRecord) seal() {
+	if wlog.state == nil {
+		return
+	}
+
+	wlog.state.mu.Lock()
+	defer wlog.state.mu.Unlock()
+
+	wlog.state.sealed = true
+}
+
+// SetTraceParent attaches a W3C trace context, in the form of a traceparent
+// header value such as "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+// to the wire log record of the op associated with the supplied context, so
+// that the record can be joined with application traces. It does nothing if
+// the op has no wire log record.
+//
+// See also MountConfig.WireLogTraceParent, which supplies an initial value.
+func SetTraceParent(ctx context.Context, traceparent string) {
+	if wlog := wireLogRecord(ctx); wlog != nil {
+		wlog.TraceParent = traceparent
+	}
+}
+
+// TraceParent returns the trace context attached to the op associated with
+// the supplied context by SetTraceParent or MountConfig.WireLogTraceParent,
+// or the empty string if there is none.
+func TraceParent(ctx context.Context) string {
+	if wlog := wireLogRecord(ctx); wlog != nil {
+		return wlog.TraceParent
+	}
+
+	return ""
+}
+
+// Return the ID of the calling goroutine, parsed from the first line of its
+// stack trace, e.g. "goroutine 18 [running]:". Return zero if it can't be
+// parsed.
+func goroutineID() uint64 {
+	var buf [32]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b, ok := bytes.CutPrefix(b, []byte("goroutine "))
+	if !ok {
+		return 0
+	}
+
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+var ignoredParams = []string{"OpContext", "Dst", "Data", "SpliceFile"}
+
+// Fill in the fields of the record that are known once the op has been
+// replied to: its name, duration, and result.
+func finishWireLogRecord(op any, opErr error, wlog *WireLogRecord) {
 	// Operation name and duration
-	wlog.Operation = t.Name()
-	wlog.Duration = time.Since(wlog.StartTime)
+	now := time.Now()
+	wlog.Operation = opTypeName(op)
+	wlog.Duration = now.Sub(wlog.StartTime)
+	if !wlog.handlerStart.IsZero() {
+		wlog.QueueDelay = wlog.handlerStart.Sub(wlog.StartTime)
+		wlog.HandlerDuration = wlog.Duration - wlog.QueueDelay
+	}
+
+	if !wlog.interruptTime.IsZero() {
+		wlog.Interrupted = true
+		wlog.CancelLatency = now.Sub(wlog.interruptTime)
+	}
 
 	// Result of the operation
-	var errno syscall.Errno
-	if opErr == nil {
-		wlog.Status = 0
-	} else if errors.As(opErr, &errno) {
-		wlog.Status = int(errno)
+	errno := opErrno(opErr)
+	wlog.Status = int(errno)
+	wlog.StatusName = ""
+	if errno != 0 {
+		wlog.StatusName = unix.ErrnoName(errno)
+	}
+}
+
+// Decide whether a finished record should be written, according to the
+// WireLogErrorsOnly and WireLogSlowThreshold fields of the supplied config.
+// If neither is set, every record is written. Otherwise a record is written
+// if it matches at least one of the filters that are set.
+func shouldWriteWireLog(cfg *MountConfig, wlog *WireLogRecord) bool {
+	if !cfg.WireLogErrorsOnly && cfg.WireLogSlowThreshold <= 0 {
+		return true
+	}
+
+	if cfg.WireLogErrorsOnly && wlog.Status != 0 {
+		return true
+	}
+
+	if cfg.WireLogSlowThreshold > 0 && wlog.Duration >= cfg.WireLogSlowThreshold {
+		return true
 	}
 
+	return false
+}
+
+// Fill in the Context and Args sections of the record from the op's fields,
+// and from its results where the fields alone say little, according to the
+// wire log options in cfg.
+func fillWireLogArgs(op any, cfg *MountConfig, wlog *WireLogRecord) {
+	v := reflect.ValueOf(op).Elem()
+	fields := wireLogFieldsFor(v.Type())
+
 	// Separate section for the operation context
-	if f := v.FieldByName("OpContext"); f.IsValid() {
-		if ctx, ok := f.Interface().(fuseops.OpContext); ok {
-			wlog.Context = &ctx
-		}
+	if fields.opContext != nil {
+		wlog.opContext = v.FieldByIndex(fields.opContext).Interface().(fuseops.OpContext)
+		wlog.Context = &wlog.opContext
 	}
 
 	// Copy the the rest of the fields to the "Args" section
-	args := map[string]any{}
-	for i := 0; i < v.NumField(); i++ {
-		f := v.Field(i)
-		if f.Kind() == reflect.Ptr && f.IsNil() {
-			continue
-		}
-		if f.Kind() == reflect.Func {
-			continue
-		}
-		fieldName := t.Field(i).Name
-		if slices.Contains(ignoredParams, fieldName) {
+	if wlog.Args == nil {
+		wlog.Args = make(map[string]any, len(fields.args))
+	}
+	args := wlog.Args
+	for _, af := range fields.args {
+		f := v.FieldByIndex(af.index)
+		if af.ptr && f.IsNil() {
 			continue
 		}
-		args[fieldName] = f.Interface()
+		args[af.name] = f.Interface()
 	}
 
+	payloadBytes := cfg.WireLogPayloadBytes
 	switch typed := op.(type) {
 	case *fuseops.ReadFileOp:
 		args["BytesRead"] = typed.BytesRead
+		if payloadBytes > 0 {
+			args["Payload"] = readPayload(typed, payloadBytes)
+		}
 
 	case *fuseops.WriteFileOp:
 		args["Size"] = len(typed.Data)
+		if payloadBytes > 0 {
+			args["Payload"] = hex.EncodeToString(typed.Data[:min(len(typed.Data), payloadBytes)])
+		}
+
+	case *fuseops.ReadDirOp:
+		addDirentArgs(args, typed.Dst[:typed.BytesRead], false, cfg.WireLogDirentNames)
+
+	case *fuseops.ReadDirPlusOp:
+		addDirentArgs(args, typed.Dst[:typed.BytesRead], true, cfg.WireLogDirentNames)
+	}
+}
+
+// Sizes of the kernel's fuse_dirent and fuse_direntplus headers, as written
+// by fuseutil.WriteDirent and fuseutil.WriteDirentPlus.
+const (
+	direntHeaderSize     = 8 + 8 + 4 + 4
+	direntPlusHeaderSize = 40 + 88 + direntHeaderSize
+)
+
+// Decode the packed directory entries returned by a ReadDir or ReadDirPlus op,
+// recording their count in Args["Entries"] and, if names is set, their names
+// in Args["Names"].
+func addDirentArgs(args map[string]any, buf []byte, plus bool, names bool) {
+	var count int
+	var entryNames []string
+	walkDirents(buf, plus, func(entry []byte, name string) {
+		count++
+		if names {
+			entryNames = append(entryNames, name)
+		}
+	})
+
+	args["Entries"] = count
+	if names {
+		args["Names"] = entryNames
+	}
+}
+
+// Call f with each of the packed directory entries in buf, as returned by a
+// ReadDir or ReadDirPlus op, and its name. A truncated final entry is
+// ignored.
+func walkDirents(buf []byte, plus bool, f func(entry []byte, name string)) {
+	headerSize := direntHeaderSize
+	if plus {
+		headerSize = direntPlusHeaderSize
+	}
+
+	for len(buf) >= headerSize {
+		// The name length is the third field of the fuse_dirent at the end of
+		// the header.
+		nameLen := int(binary.NativeEndian.Uint32(buf[headerSize-8:]))
+		if headerSize+nameLen > len(buf) {
+			break
+		}
+
+		f(buf[:headerSize+nameLen], string(buf[headerSize:headerSize+nameLen]))
+
+		// Entries are padded to a multiple of eight bytes.
+		buf = buf[min(len(buf), (headerSize+nameLen+7)&^7):]
+	}
+}
+
+// The fields of an op struct type that fillWireLogArgs copies, worked out
+// once per type. Embedded structs, as in ReadDirPlusOp, are flattened.
+type wireLogFields struct {
+	// The index of the OpContext field, or nil if there is none.
+	opContext []int
+	args      []wireLogArgField
+}
+
+type wireLogArgField struct {
+	index []int
+	name  string
+	ptr   bool
+}
+
+// A cache of *wireLogFields, keyed by reflect.Type.
+var wireLogFieldCache sync.Map
+
+func wireLogFieldsFor(t reflect.Type) *wireLogFields {
+	if cached, ok := wireLogFieldCache.Load(t); ok {
+		return cached.(*wireLogFields)
+	}
+
+	fields := &wireLogFields{}
+	for _, sf := range reflect.VisibleFields(t) {
+		switch {
+		case sf.Anonymous || !sf.IsExported():
+		case sf.Name == "OpContext" && sf.Type == reflect.TypeOf(fuseops.OpContext{}):
+			fields.opContext = sf.Index
+		case sf.Type.Kind() == reflect.Func:
+		case slices.Contains(ignoredParams, sf.Name):
+		default:
+			fields.args = append(fields.args, wireLogArgField{
+				index: sf.Index,
+				name:  sf.Name,
+				ptr:   sf.Type.Kind() == reflect.Ptr,
+			})
+		}
 	}
 
-	wlog.Args = args
+	cached, _ := wireLogFieldCache.LoadOrStore(t, fields)
+	return cached.(*wireLogFields)
+}
+
+// Return the hex-encoded first n bytes of the data returned by a read,
+// whether it was placed in Dst or in the vectored Data slices.
+func readPayload(op *fuseops.ReadFileOp, n int) string {
+	n = min(n, op.BytesRead)
+	if op.Data == nil {
+		return hex.EncodeToString(op.Dst[:min(n, len(op.Dst))])
+	}
 
-	// Serialize as pretty-printed JSON
-	buf, err := json.MarshalIndent(wlog, "", "  ")
-	if err == nil {
-		buf = append(buf, '\n')
+	var buf []byte
+	for _, d := range op.Data {
+		if len(buf) >= n {
+			break
+		}
+		buf = append(buf, d[:min(len(d), n-len(buf))]...)
 	}
-	return buf, err
+
+	return hex.EncodeToString(buf)
+}
+
+// Finish the wire log record for an op that has just been replied to, write
+// it to WireLogger and WireLogHandler if the config says it should be
+// written, and hand it to the OpTracer if there is one.
+func (c *Connection) finishWireLog(
+	ctx context.Context,
+	op any,
+	opErr error,
+	wlog *WireLogRecord) {
+	wlog.seal()
+	finishWireLogRecord(op, opErr, wlog)
+
+	// Sessions are tracked whether or not this record is written, so that
+	// the summary covers every op on the handle.
+	var ended *handleSession
+	if c.handles != nil {
+		wlog.HandleSession, ended = c.handles.update(op, opErr)
+	}
+	if ended != nil {
+		defer c.logHandleSummary(ended)
+	}
+
+	wireLogger := c.getWireLogger()
+	write := wireLogger != nil && shouldWriteWireLog(&c.cfg, wlog)
+
+	handler := c.cfg.WireLogHandler
+	handle := handler != nil &&
+		shouldWriteWireLog(&c.cfg, wlog) &&
+		handler.Enabled(ctx, wireLogLevel(wlog))
+
+	if !write && !handle && c.cfg.OpTracer == nil {
+		return
+	}
+
+	fillWireLogArgs(op, &c.cfg, wlog)
+	if c.paths != nil {
+		p := wlog.path
+		if p == "" {
+			p = c.paths.resolve(op)
+		}
+		if p != "" {
+			wlog.Args["Path"] = p
+		}
+	}
+
+	if !write {
+		wireLogger = nil
+	}
+	c.writeWireLog(ctx, wlog, wireLogger, handle)
+
+	if c.cfg.OpTracer != nil {
+		c.cfg.OpTracer.FinishOp(ctx, wlog)
+	}
+}
+
+// Redact a finished record and write it to wireLogger, if non-nil, and to
+// WireLogHandler if handle is set.
+func (c *Connection) writeWireLog(
+	ctx context.Context,
+	wlog *WireLogRecord,
+	wireLogger io.Writer,
+	handle bool) {
+	if c.cfg.WireLogRedactor != nil {
+		c.cfg.WireLogRedactor(wlog.Operation, wlog.Args)
+	}
+
+	if wireLogger != nil {
+		formatter := c.cfg.WireLogFormatter
+		if formatter == nil {
+			formatter = JSONWireLogFormatter{Compact: c.cfg.WireLogCompactJSON}
+		}
+
+		entry, err := formatter.Format(wlog)
+		if err == nil {
+			wireLogger.Write(entry)
+		}
+	}
+
+	if handle {
+		c.cfg.WireLogHandler.Handle(ctx, wireLogSlogRecord(wlog))
+	}
+}
+
+// Write a record for an interrupt request, which is handled inline rather
+// than being returned from ReadOp. pending says whether the interrupted op was
+// still in flight.
+func (c *Connection) logInterrupt(
+	inMsg *buffer.InMessage,
+	op *interruptOp,
+	pending bool) {
+	wlog := c.newEventRecord("InterruptOp")
+	if wlog == nil {
+		return
+	}
+
+	wlog.opContext = fuseops.OpContext{
+		FuseID: inMsg.Header().Unique,
+		Pid:    inMsg.Header().Pid,
+		Uid:    inMsg.Header().Uid,
+		Gid:    inMsg.Header().Gid,
+	}
+	wlog.Context = &wlog.opContext
+	wlog.Args["FuseID"] = op.FuseID
+	wlog.Args["Pending"] = pending
+
+	c.writeEventRecord(wlog)
+}
+
+// Write a "HandleSummary" record for a handle session that has ended.
+func (c *Connection) logHandleSummary(hs *handleSession) {
+	wlog := c.newEventRecord("HandleSummary")
+	if wlog == nil {
+		return
+	}
+
+	wlog.HandleSession = hs.id
+	hs.fillArgs(wlog.Args)
+	c.writeEventRecord(wlog)
+}
+
+// Return a record for an event that isn't an op returned by ReadOp, such as
+// an interrupt request or the mount being established, or nil if there is
+// nowhere to write it. The caller fills in Args and passes the record to
+// writeEventRecord.
+func (c *Connection) newEventRecord(operation string) *WireLogRecord {
+	if c.getWireLogger() == nil && c.cfg.WireLogHandler == nil {
+		return nil
+	}
+
+	wlog := getWireLogRecord()
+	wlog.Operation = operation
+	return wlog
+}
+
+// Write and recycle a record returned by newEventRecord. Events are logged
+// regardless of WireLogErrorsOnly and WireLogSlowThreshold, which are about
+// ops, so that a log can always be segmented by them.
+func (c *Connection) writeEventRecord(wlog *WireLogRecord) {
+	defer putWireLogRecord(wlog)
+
+	ctx := c.cfg.OpContext
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	handler := c.cfg.WireLogHandler
+	handle := handler != nil && handler.Enabled(ctx, wireLogLevel(wlog))
+	c.writeWireLog(ctx, wlog, c.getWireLogger(), handle)
+}
+
+// Holds the connection's wire logger, so that it can be swapped atomically.
+type wireLogWriter struct {
+	w io.Writer
+}
+
+// SetWireLogger changes the writer to which wire log records are written,
+// taking effect for ops read after it returns. A nil writer disables writing
+// records. This may be called at any time, including while ops are in flight.
+func (c *Connection) SetWireLogger(w io.Writer) {
+	if w == nil {
+		c.wireLogger.Store(nil)
+		return
+	}
+
+	c.wireLogger.Store(&wireLogWriter{w})
+}
+
+// Return the current wire logger, or nil if there is none.
+func (c *Connection) getWireLogger() io.Writer {
+	if wl := c.wireLogger.Load(); wl != nil {
+		return wl.w
+	}
+
+	return nil
 }
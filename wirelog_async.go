@@ -0,0 +1,168 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// WireLogOverflowPolicy controls what an AsyncWireLogWriter does with a record
+// when its queue is full.
+type WireLogOverflowPolicy int
+
+const (
+	// Block the op until there is room in the queue. No records are lost, but a
+	// slow underlying writer will eventually slow down the file system.
+	WireLogBlockWhenFull WireLogOverflowPolicy = iota
+
+	// Discard the record. The number of discarded records is available from
+	// AsyncWireLogWriter.Dropped.
+	WireLogDropWhenFull
+)
+
+// ErrWireLogWriterClosed is returned by AsyncWireLogWriter.Write after Close
+// has been called.
+var ErrWireLogWriterClosed = errors.New("wire log writer is closed")
+
+// AsyncWireLogWriter is an io.Writer suitable for use as
+// MountConfig.WireLogger that moves the cost of writing records off of the op
+// path. Each call to Write copies the record into a bounded in-memory queue,
+// and a background goroutine drains the queue into the underlying writer.
+//
+// Records are still serialized synchronously when the op is replied to, since
+// they may refer to memory that is reused afterward; only the write itself is
+// deferred.
+//
+// Close must be called to flush queued records and stop the background
+// goroutine, typically after MountedFileSystem.Join has returned.
+type AsyncWireLogWriter struct {
+	w      io.Writer
+	policy WireLogOverflowPolicy
+	queue  chan []byte
+	done   chan struct{}
+
+	dropped atomic.Uint64
+
+	// GUARDED_BY(mu)
+	closed bool
+	mu     sync.RWMutex
+
+	// The first error returned by the underlying writer, if any. Not valid
+	// until done is closed.
+	err error
+}
+
+// NewAsyncWireLogWriter creates an AsyncWireLogWriter that writes to w,
+// holding at most queueSize records in memory. If queueSize is not positive, a
+// default of 1024 is used.
+func NewAsyncWireLogWriter(
+	w io.Writer,
+	queueSize int,
+	policy WireLogOverflowPolicy) *AsyncWireLogWriter {
+	if queueSize <= 0 {
+		queueSize = 1024
+	}
+
+	a := &AsyncWireLogWriter{
+		w:      w,
+		policy: policy,
+		queue:  make(chan []byte, queueSize),
+		done:   make(chan struct{}),
+	}
+
+	go a.flush()
+	return a
+}
+
+// Write enqueues a copy of p to be written to the underlying writer. Errors
+// from the underlying writer are not returned here; see Close.
+//
+// LOCKS_EXCLUDED(a.mu)
+func (a *AsyncWireLogWriter) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return 0, ErrWireLogWriterClosed
+	}
+
+	buf := make([]byte, len(p))
+	copy(buf, p)
+
+	switch a.policy {
+	case WireLogDropWhenFull:
+		select {
+		case a.queue <- buf:
+		default:
+			a.dropped.Add(1)
+		}
+
+	default:
+		a.queue <- buf
+	}
+
+	return len(p), nil
+}
+
+// Dropped returns the number of records that have been discarded because the
+// queue was full. It is always zero for WireLogBlockWhenFull.
+func (a *AsyncWireLogWriter) Dropped() uint64 {
+	return a.dropped.Load()
+}
+
+// Close stops accepting new records, waits for all queued records to be
+// written, and returns the first error returned by the underlying writer, if
+// any. It does not close the underlying writer. May be called multiple times.
+//
+// LOCKS_EXCLUDED(a.mu)
+func (a *AsyncWireLogWriter) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	<-a.done
+	return a.err
+}
+
+// Drain the queue into the underlying writer until it is closed. Records are
+// buffered so that bursts turn into few large writes, and the buffer is
+// flushed whenever the queue runs dry.
+func (a *AsyncWireLogWriter) flush() {
+	defer close(a.done)
+
+	bw := bufio.NewWriter(a.w)
+	for buf := range a.queue {
+		if _, err := bw.Write(buf); err != nil && a.err == nil {
+			a.err = err
+		}
+
+		if len(a.queue) == 0 {
+			if err := bw.Flush(); err != nil && a.err == nil {
+				a.err = err
+			}
+		}
+	}
+
+	if err := bw.Flush(); err != nil && a.err == nil {
+		a.err = err
+	}
+}
@@ -0,0 +1,66 @@
+package fuse
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// An io.Writer that blocks until released.
+type blockingWriter struct {
+	release chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.buf.Write(p)
+}
+
+func Test_asyncWireLogWriterFlushesOnClose(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewAsyncWireLogWriter(&buf, 4, WireLogBlockWhenFull)
+
+	for _, s := range []string{"taco\n", "burrito\n", "enchilada\n"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if got, want := buf.String(), "taco\nburrito\nenchilada\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	if _, err := w.Write([]byte("late\n")); !errors.Is(err, ErrWireLogWriterClosed) {
+		t.Errorf("expected ErrWireLogWriterClosed, got %v", err)
+	}
+}
+
+func Test_asyncWireLogWriterDropsWhenFull(t *testing.T) {
+	bw := &blockingWriter{release: make(chan struct{})}
+	w := NewAsyncWireLogWriter(bw, 1, WireLogDropWhenFull)
+
+	// The flusher may or may not have dequeued the first record and be blocked
+	// writing it, so at most two of these fit. The rest must be dropped rather
+	// than block.
+	for i := 0; i < 10; i++ {
+		w.Write([]byte("x"))
+	}
+
+	if got := w.Dropped(); got < 8 {
+		t.Errorf("expected at least 8 dropped records, got %d", got)
+	}
+
+	close(bw.release)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if got := uint64(bw.buf.Len()) + w.Dropped(); got != 10 {
+		t.Errorf("expected written + dropped to be 10, got %d", got)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A WireLogFormatter turns a finished WireLogRecord into the bytes that are
+// written to MountConfig.WireLogger. Each call to Format produces exactly one
+// call to Write.
+//
+// Format may be called concurrently for different records. The record must
+// not be retained after Format returns.
+type WireLogFormatter interface {
+	Format(*WireLogRecord) ([]byte, error)
+}
+
+// JSONWireLogFormatter formats each record as a JSON object followed by a
+// newline. This is the default format.
+type JSONWireLogFormatter struct {
+	// If set, each record is written on a single line (NDJSON), for
+	// consumption by line-oriented tools such as jq, grep, and log shippers.
+	// Otherwise records are pretty-printed across multiple lines.
+	Compact bool
+}
+
+func (f JSONWireLogFormatter) Format(wlog *WireLogRecord) ([]byte, error) {
+	var buf []byte
+	var err error
+	if f.Compact {
+		buf, err = json.Marshal(wlog)
+	} else {
+		buf, err = json.MarshalIndent(wlog, "", "  ")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(buf, '\n'), nil
+}
+
+// LogfmtWireLogFormatter formats each record as a single line of
+// space-separated key=value pairs, for human consumption. For example:
+//
+//	time=2025-01-02T03:04:05.000000006Z op=LookUpInodeOp duration=1.2ms status=0 fuse_id=42 pid=1234 uid=1000 Name=foo Parent=1 extra.lookup=yes
+//
+// Args and Extra fields follow the fixed fields, sorted by key. Extra keys are
+// prefixed with "extra.". Values are formatted with fmt's %v verb and quoted
+// if necessary.
+type LogfmtWireLogFormatter struct{}
+
+func (LogfmtWireLogFormatter) Format(wlog *WireLogRecord) ([]byte, error) {
+	var b strings.Builder
+
+	addPair := func(key string, value any) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(value))
+	}
+
+	addPair("time", wlog.StartTime.Format(time.RFC3339Nano))
+	addPair("op", wlog.Operation)
+	addPair("duration", wlog.Duration)
+	if !wlog.handlerStart.IsZero() {
+		addPair("queue_delay", wlog.QueueDelay)
+		addPair("handler_duration", wlog.HandlerDuration)
+	}
+	addPair("status", wlog.Status)
+	if wlog.StatusName != "" {
+		addPair("status_name", wlog.StatusName)
+	}
+	if wlog.TraceParent != "" {
+		addPair("traceparent", wlog.TraceParent)
+	}
+	if wlog.Worker != 0 {
+		addPair("worker", wlog.Worker)
+	}
+	if wlog.Goroutine != 0 {
+		addPair("goroutine", wlog.Goroutine)
+	}
+	if wlog.HandleSession != 0 {
+		addPair("handle_session", wlog.HandleSession)
+	}
+	if wlog.Interrupted {
+		addPair("interrupted", true)
+		addPair("cancel_latency", wlog.CancelLatency)
+	}
+
+	if wlog.Context != nil {
+		addPair("fuse_id", wlog.Context.FuseID)
+		addPair("pid", wlog.Context.Pid)
+		addPair("uid", wlog.Context.Uid)
+	}
+
+	for _, k := range sortedKeys(wlog.Args) {
+		addPair(k, wlog.Args[k])
+	}
+
+	for _, k := range sortedKeys(wlog.Extra) {
+		addPair("extra."+k, wlog.Extra[k])
+	}
+
+	b.WriteByte('\n')
+	return []byte(b.String()), nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Format a value for logfmt, quoting it if it is empty or contains
+// characters that would make the line ambiguous.
+func logfmtValue(v any) string {
+	s := fmt.Sprintf("%v", v)
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
@@ -0,0 +1,170 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// handleSessions tracks each file and directory handle from the op that opened
+// it to the op that released it, so that wire log records for ops on the
+// handle can be tagged with an identifier for that session, and so that a
+// summary of the session can be logged when it ends.
+//
+// Handle IDs are chosen by the file system and may be reused once released;
+// session IDs are never reused within a connection.
+type handleSessions struct {
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	nextID   uint64
+	sessions map[handleSessionKey]*handleSession
+}
+
+// File and directory handles are tracked separately, since file systems may
+// draw them from different spaces.
+type handleSessionKey struct {
+	handle fuseops.HandleID
+	dir    bool
+}
+
+type handleSession struct {
+	handleSessionKey
+	id     uint64
+	inode  fuseops.InodeID
+	opened time.Time
+
+	// The number of ops on the handle, including those that opened and
+	// released it, and the number of bytes successfully read and written.
+	ops          int
+	bytesRead    int64
+	bytesWritten int64
+}
+
+func newHandleSessions() *handleSessions {
+	return &handleSessions{
+		nextID:   1,
+		sessions: make(map[handleSessionKey]*handleSession),
+	}
+}
+
+// Account for an op that has been replied to, returning the ID of the handle
+// session it belongs to, or zero if none. If the op ended the session, the
+// session is also returned, for summarizing.
+//
+// LOCKS_EXCLUDED(s.mu)
+func (s *handleSessions) update(op any, opErr error) (uint64, *handleSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var inode fuseops.InodeID
+	var key handleSessionKey
+	var opened, released bool
+
+	switch o := op.(type) {
+	case *fuseops.OpenFileOp:
+		inode, key, opened = o.Inode, handleSessionKey{handle: o.Handle}, true
+	case *fuseops.CreateFileOp:
+		inode, key, opened = o.Entry.Child, handleSessionKey{handle: o.Handle}, true
+	case *fuseops.CreateTmpFileOp:
+		inode, key, opened = o.Entry.Child, handleSessionKey{handle: o.Handle}, true
+	case *fuseops.OpenDirOp:
+		inode, key, opened = o.Inode, handleSessionKey{handle: o.Handle, dir: true}, true
+	case *fuseops.ReleaseFileHandleOp:
+		key, released = handleSessionKey{handle: o.Handle}, true
+	case *fuseops.ReleaseDirHandleOp:
+		key, released = handleSessionKey{handle: o.Handle, dir: true}, true
+	case *fuseops.ReadDirOp:
+		key = handleSessionKey{handle: o.Handle, dir: true}
+	case *fuseops.ReadDirPlusOp:
+		key = handleSessionKey{handle: o.Handle, dir: true}
+	case *fuseops.GetInodeAttributesOp:
+		if o.Handle == nil {
+			return 0, nil
+		}
+		key = handleSessionKey{handle: *o.Handle}
+	case *fuseops.StatxOp:
+		if o.Handle == nil {
+			return 0, nil
+		}
+		key = handleSessionKey{handle: *o.Handle}
+	case *fuseops.SetInodeAttributesOp:
+		if o.Handle == nil {
+			return 0, nil
+		}
+		key = handleSessionKey{handle: *o.Handle}
+
+	default:
+		// Other ops on open files have a Handle field.
+		handle, ok := fieldValue[fuseops.HandleID](op, "Handle")
+		if !ok {
+			return 0, nil
+		}
+		key = handleSessionKey{handle: handle}
+	}
+
+	if opened {
+		if opErr != nil {
+			return 0, nil
+		}
+
+		hs := &handleSession{
+			handleSessionKey: key,
+			id:               s.nextID,
+			inode:            inode,
+			opened:           time.Now(),
+			ops:              1,
+		}
+		s.nextID++
+		s.sessions[key] = hs
+		return hs.id, nil
+	}
+
+	hs, ok := s.sessions[key]
+	if !ok {
+		return 0, nil
+	}
+
+	hs.ops++
+	if opErr == nil {
+		switch o := op.(type) {
+		case *fuseops.ReadFileOp:
+			hs.bytesRead += int64(o.BytesRead)
+		case *fuseops.WriteFileOp:
+			hs.bytesWritten += int64(len(o.Data))
+		}
+	}
+
+	if released {
+		delete(s.sessions, key)
+		return hs.id, hs
+	}
+
+	return hs.id, nil
+}
+
+// Fill in the Args of a "HandleSummary" record for a session that has ended.
+func (hs *handleSession) fillArgs(args map[string]any) {
+	args["Handle"] = hs.handle
+	args["Dir"] = hs.dir
+	args["Inode"] = hs.inode
+	args["Ops"] = hs.ops
+	args["BytesRead"] = hs.bytesRead
+	args["BytesWritten"] = hs.bytesWritten
+	args["Lifetime"] = time.Since(hs.opened)
+}
@@ -0,0 +1,158 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	netWireLogDialTimeout  = time.Second
+	netWireLogWriteTimeout = 5 * time.Second
+	netWireLogMinBackoff   = 100 * time.Millisecond
+	netWireLogMaxBackoff   = 30 * time.Second
+)
+
+// NetWireLogWriter is an io.Writer suitable for use as MountConfig.WireLogger
+// that streams records to a collector listening on a Unix or TCP socket.
+//
+// The connection is made on the first write. If it fails or is lost, records
+// are discarded until a reconnection attempt succeeds; attempts are made on
+// subsequent writes, backing off exponentially from 100ms to 30s between
+// them. Discarded records are counted by Dropped rather than reported as
+// errors.
+//
+// Dialing and writing happen synchronously within Write. Wrap the writer with
+// NewAsyncWireLogWriter to keep that off of the op path.
+type NetWireLogWriter struct {
+	network string
+	addr    string
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	dropped atomic.Uint64
+
+	mu sync.Mutex
+
+	// The current connection, or nil if there is none.
+	//
+	// GUARDED_BY(mu)
+	conn net.Conn
+
+	// The earliest time at which to try to connect again, and the delay to use
+	// after the next failure.
+	//
+	// GUARDED_BY(mu)
+	nextDial time.Time
+	backoff  time.Duration
+
+	// GUARDED_BY(mu)
+	closed bool
+}
+
+// NewNetWireLogWriter creates a NetWireLogWriter that connects to addr on the
+// supplied network, which is as for net.Dial, e.g. "unix" or "tcp".
+func NewNetWireLogWriter(network, addr string) *NetWireLogWriter {
+	return &NetWireLogWriter{
+		network:    network,
+		addr:       addr,
+		minBackoff: netWireLogMinBackoff,
+		maxBackoff: netWireLogMaxBackoff,
+		backoff:    netWireLogMinBackoff,
+	}
+}
+
+// Write sends p to the collector, or discards it if there is no connection.
+// It returns an error only if the writer has been closed.
+//
+// LOCKS_EXCLUDED(w.mu)
+func (w *NetWireLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrWireLogWriterClosed
+	}
+
+	if w.conn == nil && !w.dial() {
+		w.dropped.Add(1)
+		return len(p), nil
+	}
+
+	w.conn.SetWriteDeadline(time.Now().Add(netWireLogWriteTimeout))
+	if _, err := w.conn.Write(p); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		w.fail()
+		w.dropped.Add(1)
+	}
+
+	return len(p), nil
+}
+
+// Dropped returns the number of records that have been discarded because
+// there was no connection to the collector.
+func (w *NetWireLogWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Close closes the connection, if any. Subsequent writes fail.
+//
+// LOCKS_EXCLUDED(w.mu)
+func (w *NetWireLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// Try to connect, unless we're still backing off from a failure. Return true
+// if w.conn is now set.
+//
+// EXCLUSIVE_LOCKS_REQUIRED(w.mu)
+func (w *NetWireLogWriter) dial() bool {
+	if time.Now().Before(w.nextDial) {
+		return false
+	}
+
+	conn, err := net.DialTimeout(w.network, w.addr, netWireLogDialTimeout)
+	if err != nil {
+		w.fail()
+		return false
+	}
+
+	w.conn = conn
+	w.backoff = w.minBackoff
+	return true
+}
+
+// Schedule the next connection attempt after a failure.
+//
+// EXCLUSIVE_LOCKS_REQUIRED(w.mu)
+func (w *NetWireLogWriter) fail() {
+	w.nextDial = time.Now().Add(w.backoff)
+	w.backoff = min(2*w.backoff, w.maxBackoff)
+}
@@ -0,0 +1,76 @@
+package fuse
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_netWireLogWriter(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "sock")
+
+	w := NewNetWireLogWriter("unix", addr)
+	w.minBackoff = time.Millisecond
+	w.backoff = time.Millisecond
+	defer w.Close()
+
+	// Nobody is listening yet.
+	w.Write([]byte("lost\n"))
+	if got := w.Dropped(); got != 1 {
+		t.Fatalf("expected 1 dropped record, got %d", got)
+	}
+
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer l.Close()
+
+	// Keep writing until the writer has reconnected and a record has arrived.
+	received := make(chan string)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			// Hang up only once the line has been received, so that the next
+			// record can't go to this connection.
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err == nil {
+				received <- line
+			}
+			conn.Close()
+		}
+	}()
+
+	for _, want := range []string{"taco\n", "burrito\n"} {
+		deadline := time.After(5 * time.Second)
+		ticker := time.NewTicker(time.Millisecond)
+	loop:
+		for {
+			select {
+			case got := <-received:
+				if got != want {
+					t.Errorf("expected %q, got %q", want, got)
+				}
+				break loop
+
+			case <-ticker.C:
+				w.Write([]byte(want))
+
+			case <-deadline:
+				t.Fatalf("timed out waiting for %q", want)
+			}
+		}
+		ticker.Stop()
+	}
+
+	w.Close()
+	if _, err := w.Write([]byte("late\n")); err != ErrWireLogWriterClosed {
+		t.Errorf("expected ErrWireLogWriterClosed, got %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"encoding/binary"
+	"path"
+	"reflect"
+	"sync"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// The deepest path that inodePaths will construct, as protection against
+// cycles resulting from ops it doesn't understand.
+const maxResolvedPathDepth = 256
+
+// inodePaths tracks the name under which the kernel last learned of each
+// inode, by watching the replies to ops that return directory entries, so
+// that wire log records can name the file an op refers to. Entries are
+// dropped when the kernel forgets the inode.
+//
+// An inode with several hard links is known by the name it was most recently
+// returned under. An inode that has been unlinked keeps its last path until
+// it is forgotten, but one displaced by a rename has none.
+type inodePaths struct {
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	inodes   map[fuseops.InodeID]*inodePathEntry
+	children map[inodePathKey]fuseops.InodeID
+}
+
+type inodePathKey struct {
+	parent fuseops.InodeID
+	name   string
+}
+
+type inodePathEntry struct {
+	inodePathKey
+
+	// The kernel's lookup count for the inode, as far as we know.
+	lookups uint64
+}
+
+func newInodePaths() *inodePaths {
+	return &inodePaths{
+		inodes:   make(map[fuseops.InodeID]*inodePathEntry),
+		children: make(map[inodePathKey]fuseops.InodeID),
+	}
+}
+
+// Return the path of the file that an op refers to, or the empty string if
+// it isn't known. For ops that name a child of a directory, this is the
+// path of the child.
+//
+// LOCKS_EXCLUDED(p.mu)
+func (p *inodePaths) resolve(op any) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch o := op.(type) {
+	case *fuseops.LookUpInodeOp:
+		return p.childPath(o.Parent, o.Name)
+	case *fuseops.MkDirOp:
+		return p.childPath(o.Parent, o.Name)
+	case *fuseops.MkNodeOp:
+		return p.childPath(o.Parent, o.Name)
+	case *fuseops.CreateFileOp:
+		return p.childPath(o.Parent, o.Name)
+	case *fuseops.CreateSymlinkOp:
+		return p.childPath(o.Parent, o.Name)
+	case *fuseops.CreateLinkOp:
+		return p.childPath(o.Parent, o.Name)
+	case *fuseops.RenameOp:
+		return p.childPath(o.OldParent, o.OldName)
+	case *fuseops.UnlinkOp:
+		return p.childPath(o.Parent, o.Name)
+	case *fuseops.RmDirOp:
+		return p.childPath(o.Parent, o.Name)
+	}
+
+	// Most other ops have an Inode field.
+	if inode, ok := fieldValue[fuseops.InodeID](op, "Inode"); ok {
+		return p.inodePath(inode)
+	}
+
+	return ""
+}
+
+// Update the tracked paths to reflect an op that succeeded.
+//
+// LOCKS_EXCLUDED(p.mu)
+func (p *inodePaths) update(op any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch o := op.(type) {
+	case *fuseops.LookUpInodeOp:
+		p.learn(o.Entry.Child, o.Parent, o.Name)
+	case *fuseops.MkDirOp:
+		p.learn(o.Entry.Child, o.Parent, o.Name)
+	case *fuseops.MkNodeOp:
+		p.learn(o.Entry.Child, o.Parent, o.Name)
+	case *fuseops.CreateFileOp:
+		p.learn(o.Entry.Child, o.Parent, o.Name)
+	case *fuseops.CreateSymlinkOp:
+		p.learn(o.Entry.Child, o.Parent, o.Name)
+	case *fuseops.CreateLinkOp:
+		p.learn(o.Entry.Child, o.Parent, o.Name)
+
+	case *fuseops.ReadDirPlusOp:
+		// Each entry counts as a lookup, except for "." and "..". The entry's
+		// inode ID is the first field of its fuse_entry_out.
+		walkDirents(o.Dst[:o.BytesRead], true, func(entry []byte, name string) {
+			if name != "." && name != ".." {
+				p.learn(fuseops.InodeID(binary.NativeEndian.Uint64(entry)), o.Inode, name)
+			}
+		})
+
+	case *fuseops.RenameOp:
+		oldKey := inodePathKey{o.OldParent, o.OldName}
+		newKey := inodePathKey{o.NewParent, o.NewName}
+		oldID, oldOK := p.children[oldKey]
+		newID, newOK := p.children[newKey]
+		delete(p.children, oldKey)
+		delete(p.children, newKey)
+
+		if oldOK {
+			p.children[newKey] = oldID
+			p.inodes[oldID].inodePathKey = newKey
+		}
+
+		// The target either takes the source's place, or is displaced and so no
+		// longer has a path.
+		if newOK && newID != oldID {
+			if o.Flags&fuseops.RenameExchange != 0 {
+				p.children[oldKey] = newID
+				p.inodes[newID].inodePathKey = oldKey
+			} else {
+				p.inodes[newID].inodePathKey = inodePathKey{}
+			}
+		}
+
+	case *fuseops.UnlinkOp:
+		delete(p.children, inodePathKey{o.Parent, o.Name})
+	case *fuseops.RmDirOp:
+		delete(p.children, inodePathKey{o.Parent, o.Name})
+
+	case *fuseops.ForgetInodeOp:
+		p.forget(o.Inode, o.N)
+	case *fuseops.BatchForgetOp:
+		for _, e := range o.Entries {
+			p.forget(e.Inode, e.N)
+		}
+	}
+}
+
+// EXCLUSIVE_LOCKS_REQUIRED(p.mu)
+func (p *inodePaths) learn(child, parent fuseops.InodeID, name string) {
+	if child == 0 {
+		// A negative entry.
+		return
+	}
+
+	key := inodePathKey{parent, name}
+	e, ok := p.inodes[child]
+	if !ok {
+		e = &inodePathEntry{}
+		p.inodes[child] = e
+	}
+
+	e.inodePathKey = key
+	e.lookups++
+	p.children[key] = child
+}
+
+// EXCLUSIVE_LOCKS_REQUIRED(p.mu)
+func (p *inodePaths) forget(inode fuseops.InodeID, n uint64) {
+	e, ok := p.inodes[inode]
+	if !ok {
+		return
+	}
+
+	if e.lookups > n {
+		e.lookups -= n
+		return
+	}
+
+	delete(p.inodes, inode)
+	if p.children[e.inodePathKey] == inode {
+		delete(p.children, e.inodePathKey)
+	}
+}
+
+// EXCLUSIVE_LOCKS_REQUIRED(p.mu)
+func (p *inodePaths) inodePath(inode fuseops.InodeID) string {
+	var names []string
+	for depth := 0; inode != fuseops.RootInodeID; depth++ {
+		e, ok := p.inodes[inode]
+		if !ok || depth == maxResolvedPathDepth {
+			return ""
+		}
+
+		names = append(names, e.name)
+		inode = e.parent
+	}
+
+	// The names were collected leaf first.
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+
+	return "/" + path.Join(names...)
+}
+
+// EXCLUSIVE_LOCKS_REQUIRED(p.mu)
+func (p *inodePaths) childPath(parent fuseops.InodeID, name string) string {
+	dir := p.inodePath(parent)
+	if dir == "" {
+		return ""
+	}
+
+	return path.Join(dir, name)
+}
+
+// Return the value of the named field of an op struct, if it has such a field
+// of type T.
+func fieldValue[T any](op any, name string) (T, bool) {
+	var zero T
+	f := reflect.ValueOf(op).Elem().FieldByName(name)
+	if !f.IsValid() {
+		return zero, false
+	}
+
+	v, ok := f.Interface().(T)
+	return v, ok
+}
@@ -0,0 +1,120 @@
+package fuse
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+func Test_inodePaths(t *testing.T) {
+	p := newInodePaths()
+
+	p.update(&fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "dir", Entry: fuseops.ChildInodeEntry{Child: 2}})
+	p.update(&fuseops.CreateFileOp{Parent: 2, Name: "foo", Entry: fuseops.ChildInodeEntry{Child: 3}})
+
+	check := func(op any, want string) {
+		t.Helper()
+		if got := p.resolve(op); got != want {
+			t.Errorf("%T: expected %q, got %q", op, want, got)
+		}
+	}
+
+	check(&fuseops.ReadFileOp{Inode: 3}, "/dir/foo")
+	check(&fuseops.ReadDirPlusOp{ReadDirOp: fuseops.ReadDirOp{Inode: 2}}, "/dir")
+	check(&fuseops.LookUpInodeOp{Parent: 2, Name: "bar"}, "/dir/bar")
+	check(&fuseops.GetInodeAttributesOp{Inode: fuseops.RootInodeID}, "/")
+	check(&fuseops.GetInodeAttributesOp{Inode: 17}, "")
+
+	p.update(&fuseops.RenameOp{OldParent: 2, OldName: "foo", NewParent: fuseops.RootInodeID, NewName: "baz"})
+	check(&fuseops.ReadFileOp{Inode: 3}, "/baz")
+
+	// Looked up twice, so it takes two forgets to drop it.
+	p.update(&fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "baz", Entry: fuseops.ChildInodeEntry{Child: 3}})
+	p.update(&fuseops.ForgetInodeOp{Inode: 3, N: 1})
+	check(&fuseops.ReadFileOp{Inode: 3}, "/baz")
+
+	p.update(&fuseops.BatchForgetOp{Entries: []fuseops.BatchForgetEntry{{Inode: 3, N: 1}}})
+	check(&fuseops.ReadFileOp{Inode: 3}, "")
+}
+
+func Test_inodePathsReadDirPlus(t *testing.T) {
+	p := newInodePaths()
+
+	// Pack entries in the format written by fuseutil.WriteDirentPlus, with
+	// only the inode IDs and names filled in.
+	var dst []byte
+	for i, name := range []string{".", "..", "taco", "burrito"} {
+		entry := binary.NativeEndian.AppendUint64(nil, uint64(i+10))
+		entry = append(entry, make([]byte, direntPlusHeaderSize-direntHeaderSize-8)...)
+		entry = binary.NativeEndian.AppendUint64(entry, uint64(i+10))
+		entry = binary.NativeEndian.AppendUint64(entry, uint64(i+1))
+		entry = binary.NativeEndian.AppendUint32(entry, uint32(len(name)))
+		entry = binary.NativeEndian.AppendUint32(entry, 0)
+		entry = append(entry, name...)
+		for len(entry)%8 != 0 {
+			entry = append(entry, 0)
+		}
+		dst = append(dst, entry...)
+	}
+
+	p.update(&fuseops.ReadDirPlusOp{ReadDirOp: fuseops.ReadDirOp{Inode: fuseops.RootInodeID, Dst: dst, BytesRead: len(dst)}})
+
+	check := func(inode fuseops.InodeID, want string) {
+		t.Helper()
+		if got := p.resolve(&fuseops.ReadFileOp{Inode: inode}); got != want {
+			t.Errorf("inode %d: expected %q, got %q", inode, want, got)
+		}
+	}
+
+	check(10, "")
+	check(11, "")
+	check(12, "/taco")
+	check(13, "/burrito")
+
+	// The entry counts as a lookup, so a lookup's count isn't cut short by
+	// the kernel forgetting the entry.
+	p.update(&fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "taco", Entry: fuseops.ChildInodeEntry{Child: 12}})
+	p.update(&fuseops.ForgetInodeOp{Inode: 12, N: 1})
+	check(12, "/taco")
+
+	p.update(&fuseops.ForgetInodeOp{Inode: 12, N: 1})
+	check(12, "")
+}
+
+func Test_inodePathsRename(t *testing.T) {
+	p := newInodePaths()
+
+	p.update(&fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "taco", Entry: fuseops.ChildInodeEntry{Child: 2}})
+	p.update(&fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "burrito", Entry: fuseops.ChildInodeEntry{Child: 3}})
+	p.update(&fuseops.CreateFileOp{Parent: fuseops.RootInodeID, Name: "enchilada", Entry: fuseops.ChildInodeEntry{Child: 4}})
+
+	check := func(inode fuseops.InodeID, want string) {
+		t.Helper()
+		if got := p.resolve(&fuseops.ReadFileOp{Inode: inode}); got != want {
+			t.Errorf("inode %d: expected %q, got %q", inode, want, got)
+		}
+	}
+
+	// Exchanging swaps the paths.
+	p.update(&fuseops.RenameOp{
+		OldParent: fuseops.RootInodeID,
+		OldName:   "taco",
+		NewParent: fuseops.RootInodeID,
+		NewName:   "burrito",
+		Flags:     fuseops.RenameExchange,
+	})
+	check(2, "/burrito")
+	check(3, "/taco")
+
+	// Renaming over a file leaves it without a path.
+	p.update(&fuseops.RenameOp{
+		OldParent: fuseops.RootInodeID,
+		OldName:   "enchilada",
+		NewParent: fuseops.RootInodeID,
+		NewName:   "taco",
+	})
+	check(4, "/taco")
+	check(3, "")
+	check(2, "/burrito")
+}
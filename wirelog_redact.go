@@ -0,0 +1,83 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// A WireLogRedactor is called with the operation name (e.g. "LookUpInodeOp")
+// and Args of each wire log record before the record is written anywhere. It
+// may modify or delete entries of args in place, for example to remove file
+// names before logs are shipped off of the machine.
+//
+// The Extra map is not passed to the redactor, since its contents are under
+// the control of the file system.
+type WireLogRedactor func(op string, args map[string]any)
+
+// SensitiveWireLogArgs lists the Args keys that may contain user file names,
+// paths, symlink targets, or extended attribute values.
+var SensitiveWireLogArgs = []string{
+	"Name",
+	"OldName",
+	"NewName",
+	"Target",
+	"Value",
+	"Path",
+	"Names",
+}
+
+// RedactWireLogArgs returns a WireLogRedactor that replaces the values of the
+// given Args keys, for every op, with the string "<redacted>".
+func RedactWireLogArgs(keys ...string) WireLogRedactor {
+	return func(op string, args map[string]any) {
+		for _, k := range keys {
+			if _, ok := args[k]; ok {
+				args[k] = "<redacted>"
+			}
+		}
+	}
+}
+
+// HashWireLogArgs returns a WireLogRedactor that replaces string and []byte
+// values of the given Args keys with a hex-encoded SHA-256 hash, truncated to
+// 16 characters, and hashes each element of []string values such as the Names
+// of directory entries. This hides the values while still allowing records
+// that refer to the same name to be correlated. Values of other types, such as
+// LinkOp's inode ID Target, are left alone.
+func HashWireLogArgs(keys ...string) WireLogRedactor {
+	return func(op string, args map[string]any) {
+		for _, k := range keys {
+			switch v := args[k].(type) {
+			case string:
+				args[k] = hashWireLogValue([]byte(v))
+			case []byte:
+				args[k] = hashWireLogValue(v)
+			case []string:
+				hashed := make([]string, len(v))
+				for i, s := range v {
+					hashed[i] = hashWireLogValue([]byte(s))
+				}
+				args[k] = hashed
+			}
+		}
+	}
+}
+
+func hashWireLogValue(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:16]
+}
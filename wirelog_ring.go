@@ -0,0 +1,135 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// RingWireLogWriter is an io.Writer suitable for use as MountConfig.WireLogger
+// that keeps only the most recent records in memory, as a flight recorder.
+// Nothing is written anywhere until the records are asked for with Records,
+// WriteTo, or by serving HTTP requests.
+//
+// Each call to Write is assumed to contain exactly one record, which is true
+// of the records written by the fuse package.
+type RingWireLogWriter struct {
+	mu sync.Mutex
+
+	// A circular buffer of records. next is the index at which the next record
+	// will be stored, and full is set once the buffer has wrapped.
+	//
+	// GUARDED_BY(mu)
+	records [][]byte
+	next    int
+	full    bool
+}
+
+// NewRingWireLogWriter creates a RingWireLogWriter that keeps the last size
+// records. size must be positive.
+func NewRingWireLogWriter(size int) *RingWireLogWriter {
+	if size <= 0 {
+		panic("NewRingWireLogWriter: size must be positive")
+	}
+
+	return &RingWireLogWriter{
+		records: make([][]byte, size),
+	}
+}
+
+// Write stores a copy of p, evicting the oldest record if the buffer is full.
+//
+// LOCKS_EXCLUDED(w.mu)
+func (w *RingWireLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Reuse the evicted record's memory where possible.
+	buf := append(w.records[w.next][:0], p...)
+	w.records[w.next] = buf
+
+	w.next++
+	if w.next == len(w.records) {
+		w.next = 0
+		w.full = true
+	}
+
+	return len(p), nil
+}
+
+// Records returns copies of the last n records, oldest first. If n is not
+// positive or exceeds the number of records held, all records are returned.
+//
+// LOCKS_EXCLUDED(w.mu)
+func (w *RingWireLogWriter) Records(n int) [][]byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	count := w.next
+	if w.full {
+		count = len(w.records)
+	}
+
+	if n <= 0 || n > count {
+		n = count
+	}
+
+	out := make([][]byte, 0, n)
+	for i := count - n; i < count; i++ {
+		idx := (w.next - count + i + len(w.records)) % len(w.records)
+		out = append(out, append([]byte(nil), w.records[idx]...))
+	}
+
+	return out
+}
+
+// WriteTo writes all records held to dst, oldest first.
+func (w *RingWireLogWriter) WriteTo(dst io.Writer) (int64, error) {
+	var total int64
+	for _, r := range w.Records(0) {
+		n, err := dst.Write(r)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// ServeHTTP dumps the records held, oldest first. The optional query
+// parameter n limits the dump to the last n records. For example:
+//
+//	http.Handle("/debug/fuse/wirelog", ring)
+func (w *RingWireLogWriter) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	var n int
+	if s := req.URL.Query().Get("n"); s != "" {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil {
+			http.Error(rw, "invalid n: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, r := range w.Records(n) {
+		if _, err := rw.Write(r); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package fuse
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_ringWireLogWriter(t *testing.T) {
+	w := NewRingWireLogWriter(3)
+	if got := w.Records(0); len(got) != 0 {
+		t.Fatalf("expected no records, got %q", got)
+	}
+
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(w, "record %d\n", i)
+	}
+
+	var sb strings.Builder
+	if _, err := w.WriteTo(&sb); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	if got, want := sb.String(), "record 2\nrecord 3\nrecord 4\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest("GET", "/?n=2", nil))
+	body, _ := io.ReadAll(rec.Result().Body)
+	if got, want := string(body), "record 3\nrecord 4\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// RotatingWireLogWriter is an io.Writer suitable for use as
+// MountConfig.WireLogger that caps the amount of disk space used by a wire
+// log. Records are appended to a file at a fixed path. When the next record
+// would take the file past its maximum size, the file is renamed to path.1
+// (shifting older files to path.2, path.3, and so on), and a fresh file is
+// started. Files beyond the configured count are deleted.
+//
+// Each call to Write is assumed to contain whole records, which are never
+// split across files.
+//
+// Rotation, and compression if enabled, happens synchronously within Write.
+// Wrap the writer with NewAsyncWireLogWriter to keep that off of the op path.
+// If rotation fails, Write still appends the record to the active file, and
+// returns the error; rotation is tried again on the next Write.
+type RotatingWireLogWriter struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	compress bool
+
+	mu sync.Mutex
+
+	// The active file and the number of bytes in it.
+	//
+	// GUARDED_BY(mu)
+	f    *os.File
+	size int64
+}
+
+// NewRotatingWireLogWriter opens (creating if necessary) the wire log at path
+// for appending.
+//
+// maxSize is the size in bytes at which the active file is rotated; if it is
+// not positive, the file is never rotated. maxFiles is the number of rotated
+// files to keep in addition to the active one. If compress is set, rotated
+// files are gzipped and given a .gz suffix.
+func NewRotatingWireLogWriter(
+	path string,
+	maxSize int64,
+	maxFiles int,
+	compress bool) (*RotatingWireLogWriter, error) {
+	w := &RotatingWireLogWriter{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		compress: compress,
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// LOCKS_EXCLUDED(w.mu)
+func (w *RotatingWireLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	var rotateErr error
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		rotateErr = w.rotate()
+		if w.f == nil {
+			return 0, fmt.Errorf("rotate: %w", rotateErr)
+		}
+	}
+
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	if err == nil && rotateErr != nil {
+		err = fmt.Errorf("rotate: %w", rotateErr)
+	}
+
+	return n, err
+}
+
+// Close closes the active file.
+//
+// LOCKS_EXCLUDED(w.mu)
+func (w *RotatingWireLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
+
+// Open the file at w.path for appending and record its current size.
+//
+// EXCLUSIVE_LOCKS_REQUIRED(w.mu)
+func (w *RotatingWireLogWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.f = f
+	w.size = fi.Size()
+	return nil
+}
+
+// The name of the i'th most recent rotated file, starting at one.
+func (w *RotatingWireLogWriter) rotatedName(i int) string {
+	name := fmt.Sprintf("%s.%d", w.path, i)
+	if w.compress {
+		name += ".gz"
+	}
+
+	return name
+}
+
+// Rotate the active file and open a fresh one. If rotation fails, the active
+// file is reopened instead, so that writing can continue.
+//
+// EXCLUSIVE_LOCKS_REQUIRED(w.mu)
+func (w *RotatingWireLogWriter) rotate() error {
+	err := w.f.Close()
+	w.f = nil
+
+	if err == nil {
+		err = w.rotateFiles()
+	}
+
+	if openErr := w.open(); err == nil {
+		err = openErr
+	}
+
+	return err
+}
+
+// Move the closed active file out of the way, shifting older files along.
+//
+// EXCLUSIVE_LOCKS_REQUIRED(w.mu)
+func (w *RotatingWireLogWriter) rotateFiles() error {
+	if w.maxFiles <= 0 {
+		return os.Remove(w.path)
+	}
+
+	if !w.compress {
+		if err := w.shiftRotatedFiles(); err != nil {
+			return err
+		}
+
+		return os.Rename(w.path, w.rotatedName(1))
+	}
+
+	// Compress first, so that a failure to do so (e.g. for lack of space)
+	// leaves the rotated files as they were.
+	tmp := w.path + ".gz.tmp"
+	if err := gzipFile(w.path, tmp); err != nil {
+		return err
+	}
+
+	err := w.shiftRotatedFiles()
+	if err == nil {
+		err = os.Rename(tmp, w.rotatedName(1))
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Remove(w.path)
+}
+
+// Make room for the newest rotated file, discarding the oldest.
+func (w *RotatingWireLogWriter) shiftRotatedFiles() error {
+	if err := os.Remove(w.rotatedName(w.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := w.maxFiles - 1; i >= 1; i-- {
+		err := os.Rename(w.rotatedName(i), w.rotatedName(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Write a gzipped copy of src to dst.
+func gzipFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err == nil {
+		err = zw.Close()
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(dst)
+	}
+
+	return err
+}
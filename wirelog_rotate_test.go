@@ -0,0 +1,133 @@
+package fuse
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("gzip.NewReader: %v", err)
+		}
+		r = zr
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+
+	return string(b)
+}
+
+func Test_rotatingWireLogWriter(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		name := "plain"
+		if compress {
+			name = "compressed"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "wire.log")
+
+			// Each record is 4 bytes, so two fit in each file.
+			w, err := NewRotatingWireLogWriter(path, 8, 2, compress)
+			if err != nil {
+				t.Fatalf("NewRotatingWireLogWriter: %v", err)
+			}
+
+			for _, s := range []string{"aaa\n", "bbb\n", "ccc\n", "ddd\n", "eee\n", "fff\n", "ggg\n"} {
+				if _, err := w.Write([]byte(s)); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+			}
+
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			if got, want := readFile(t, path), "ggg\n"; got != want {
+				t.Errorf("active file: expected %q, got %q", want, got)
+			}
+
+			if got, want := readFile(t, w.rotatedName(1)), "eee\nfff\n"; got != want {
+				t.Errorf("first rotated file: expected %q, got %q", want, got)
+			}
+
+			if got, want := readFile(t, w.rotatedName(2)), "ccc\nddd\n"; got != want {
+				t.Errorf("second rotated file: expected %q, got %q", want, got)
+			}
+
+			if _, err := os.Stat(w.rotatedName(3)); !os.IsNotExist(err) {
+				t.Errorf("expected the oldest file to be deleted, got %v", err)
+			}
+		})
+	}
+}
+
+func Test_rotatingWireLogWriterRotateFailure(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		name := "plain"
+		if compress {
+			name = "compressed"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "wire.log")
+			w, err := NewRotatingWireLogWriter(path, 8, 1, compress)
+			if err != nil {
+				t.Fatalf("NewRotatingWireLogWriter: %v", err)
+			}
+			defer w.Close()
+
+			// Make the oldest rotated file impossible to remove.
+			blocker := w.rotatedName(1)
+			if err := os.MkdirAll(filepath.Join(blocker, "dir"), 0755); err != nil {
+				t.Fatalf("MkdirAll: %v", err)
+			}
+
+			for _, s := range []string{"aaa\n", "bbb\n"} {
+				if _, err := w.Write([]byte(s)); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+			}
+
+			// Rotation fails, but the record is still written.
+			if n, err := w.Write([]byte("ccc\n")); n != 4 || err == nil {
+				t.Errorf("expected a rotation error after a full write, got %d, %v", n, err)
+			}
+
+			if err := os.RemoveAll(blocker); err != nil {
+				t.Fatalf("RemoveAll: %v", err)
+			}
+
+			// Rotation is tried again, and succeeds.
+			if _, err := w.Write([]byte("ddd\n")); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+
+			if got, want := readFile(t, path), "ddd\n"; got != want {
+				t.Errorf("active file: expected %q, got %q", want, got)
+			}
+
+			if got, want := readFile(t, blocker), "aaa\nbbb\nccc\n"; got != want {
+				t.Errorf("rotated file: expected %q, got %q", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"log/slog"
+	"syscall"
+)
+
+// The level at which a wire log record is sent to MountConfig.WireLogHandler:
+// failed ops are logged at LevelWarn, and everything else at LevelInfo.
+func wireLogLevel(wlog *WireLogRecord) slog.Level {
+	if wlog.Status != 0 {
+		return slog.LevelWarn
+	}
+
+	return slog.LevelInfo
+}
+
+// Convert a finished wire log record to a slog record. The message is the
+// operation name, and Context, Args, and Extra become attribute groups.
+func wireLogSlogRecord(wlog *WireLogRecord) slog.Record {
+	r := slog.NewRecord(wlog.StartTime, wireLogLevel(wlog), wlog.Operation, 0)
+	r.AddAttrs(
+		slog.Duration("duration", wlog.Duration),
+		slog.Int("status", wlog.Status))
+
+	if !wlog.handlerStart.IsZero() {
+		r.AddAttrs(
+			slog.Duration("queue_delay", wlog.QueueDelay),
+			slog.Duration("handler_duration", wlog.HandlerDuration))
+	}
+
+	if wlog.Status != 0 {
+		r.AddAttrs(
+			slog.String("status_name", wlog.StatusName),
+			slog.String("error", syscall.Errno(wlog.Status).Error()))
+	}
+
+	if wlog.TraceParent != "" {
+		r.AddAttrs(slog.String("traceparent", wlog.TraceParent))
+	}
+	if wlog.Worker != 0 {
+		r.AddAttrs(slog.Int("worker", wlog.Worker))
+	}
+	if wlog.Goroutine != 0 {
+		r.AddAttrs(slog.Uint64("goroutine", wlog.Goroutine))
+	}
+	if wlog.HandleSession != 0 {
+		r.AddAttrs(slog.Uint64("handle_session", wlog.HandleSession))
+	}
+
+	if wlog.Interrupted {
+		r.AddAttrs(
+			slog.Bool("interrupted", true),
+			slog.Duration("cancel_latency", wlog.CancelLatency))
+	}
+
+	if wlog.Context != nil {
+		r.AddAttrs(slog.Group(
+			"context",
+			slog.Uint64("fuse_id", wlog.Context.FuseID),
+			slog.Uint64("pid", uint64(wlog.Context.Pid)),
+			slog.Uint64("uid", uint64(wlog.Context.Uid))))
+	}
+
+	if attrs := mapAttrs(wlog.Args); len(attrs) > 0 {
+		r.AddAttrs(slog.Attr{Key: "args", Value: slog.GroupValue(attrs...)})
+	}
+
+	if attrs := mapAttrs(wlog.Extra); len(attrs) > 0 {
+		r.AddAttrs(slog.Attr{Key: "extra", Value: slog.GroupValue(attrs...)})
+	}
+
+	return r
+}
+
+// Convert a map to attributes, sorted by key so that output is stable.
+func mapAttrs(m map[string]any) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		attrs = append(attrs, slog.Any(k, m[k]))
+	}
+
+	return attrs
+}
@@ -0,0 +1,224 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"encoding/json"
+	"io"
+	"math/bits"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// The number of latency buckets in an OpSummary histogram.
+const summaryBuckets = 26
+
+// A WireLogSummary describes the ops handled during an interval. It is what
+// WireLogSummarizer writes, as a single line of JSON, in place of individual
+// wire log records.
+type WireLogSummary struct {
+	StartTime time.Time
+	EndTime   time.Time
+	Ops       map[string]*OpSummary // Keyed by operation name
+}
+
+// An OpSummary describes the ops of a single type handled during an interval.
+type OpSummary struct {
+	Count  uint64
+	Errors map[string]uint64 // Failed ops by errno name, e.g. "ENOENT"
+
+	MeanLatency time.Duration
+	MaxLatency  time.Duration
+
+	// Estimated from Histogram, so accurate to within a factor of two.
+	P50Latency time.Duration
+	P90Latency time.Duration
+	P99Latency time.Duration
+
+	// Histogram[0] counts ops that took less than a microsecond, and
+	// Histogram[i] for i > 0 counts ops that took at least 2^(i-1) and less
+	// than 2^i microseconds. The last bucket also counts anything slower.
+	Histogram [summaryBuckets]uint64
+
+	totalLatency time.Duration
+}
+
+// WireLogSummarizer is a MetricsSink that aggregates ops into per-operation
+// latency histograms and error counts, and periodically writes a
+// WireLogSummary to an io.Writer. It is useful for long captures where the
+// distribution of latencies matters more than individual ops. For example:
+//
+//	s := fuse.NewWireLogSummarizer(f, time.Minute)
+//	defer s.Close()
+//	cfg := &fuse.MountConfig{MetricsSink: s}
+type WireLogSummarizer struct {
+	w        io.Writer
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+
+	// Serializes Flush, so that summaries are written whole and in order.
+	// Acquired before mu.
+	writeMu sync.Mutex
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	current *WireLogSummary
+}
+
+// NewWireLogSummarizer creates a WireLogSummarizer that writes a summary to w
+// every interval. If interval is not positive, summaries are written only by
+// Flush and Close.
+func NewWireLogSummarizer(w io.Writer, interval time.Duration) *WireLogSummarizer {
+	s := &WireLogSummarizer{
+		w:       w,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		current: newWireLogSummary(time.Now()),
+	}
+
+	if interval > 0 {
+		go s.flushPeriodically(interval)
+	} else {
+		close(s.stopped)
+	}
+
+	return s
+}
+
+func newWireLogSummary(start time.Time) *WireLogSummary {
+	return &WireLogSummary{
+		StartTime: start,
+		Ops:       make(map[string]*OpSummary),
+	}
+}
+
+// OpStarted does nothing; only finished ops are summarized.
+func (s *WireLogSummarizer) OpStarted(op string) {}
+
+// LOCKS_EXCLUDED(s.mu)
+func (s *WireLogSummarizer) OpFinished(
+	op string,
+	errno syscall.Errno,
+	latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.current.Ops[op]
+	if !ok {
+		o = &OpSummary{}
+		s.current.Ops[op] = o
+	}
+
+	o.Count++
+	o.totalLatency += latency
+	o.MaxLatency = max(o.MaxLatency, latency)
+	o.Histogram[latencyBucket(latency)]++
+
+	if errno != 0 {
+		if o.Errors == nil {
+			o.Errors = make(map[string]uint64)
+		}
+
+		name := unix.ErrnoName(errno)
+		if name == "" {
+			name = errno.Error()
+		}
+		o.Errors[name]++
+	}
+}
+
+// Flush writes a summary of the ops finished since the previous summary, and
+// starts a new interval.
+//
+// LOCKS_EXCLUDED(s.writeMu, s.mu)
+func (s *WireLogSummarizer) Flush() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	now := time.Now()
+	summary := s.current
+	summary.EndTime = now
+	s.current = newWireLogSummary(now)
+	s.mu.Unlock()
+
+	for _, o := range summary.Ops {
+		o.MeanLatency = o.totalLatency / time.Duration(o.Count)
+		o.P50Latency = o.percentile(0.50)
+		o.P90Latency = o.percentile(0.90)
+		o.P99Latency = o.percentile(0.99)
+	}
+
+	buf, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.w.Write(append(buf, '\n'))
+	return err
+}
+
+// Close stops periodic summaries and writes a final one. It does not close
+// the underlying writer.
+func (s *WireLogSummarizer) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.stopped
+	return s.Flush()
+}
+
+func (s *WireLogSummarizer) flushPeriodically(interval time.Duration) {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Return the histogram bucket for a latency.
+func latencyBucket(latency time.Duration) int {
+	us := uint64(latency / time.Microsecond)
+	return min(bits.Len64(us), summaryBuckets-1)
+}
+
+// Estimate the latency below which the fraction p of ops fall, as the upper
+// bound of the bucket containing that op.
+func (o *OpSummary) percentile(p float64) time.Duration {
+	rank := uint64(p*float64(o.Count-1)) + 1
+	var seen uint64
+	for i, n := range o.Histogram {
+		seen += n
+		if seen >= rank {
+			if i == summaryBuckets-1 {
+				return o.MaxLatency
+			}
+			return min(time.Duration(1<<i)*time.Microsecond, o.MaxLatency)
+		}
+	}
+
+	return o.MaxLatency
+}
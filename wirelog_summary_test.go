@@ -0,0 +1,99 @@
+package fuse
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_wireLogSummarizer(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewWireLogSummarizer(&buf, 0)
+
+	for i := 0; i < 98; i++ {
+		s.OpFinished("LookUpInodeOp", 0, 100*time.Microsecond)
+	}
+	s.OpFinished("LookUpInodeOp", syscall.ENOENT, 100*time.Microsecond)
+	s.OpFinished("LookUpInodeOp", 0, time.Second)
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	var summary WireLogSummary
+	if err := json.Unmarshal(buf.Bytes(), &summary); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	o := summary.Ops["LookUpInodeOp"]
+	if o == nil {
+		t.Fatalf("no summary for LookUpInodeOp in %s", buf.String())
+	}
+
+	if o.Count != 100 {
+		t.Errorf("expected 100 ops, got %d", o.Count)
+	}
+	if o.Errors["ENOENT"] != 1 {
+		t.Errorf("expected 1 ENOENT, got %v", o.Errors)
+	}
+	if o.MaxLatency != time.Second {
+		t.Errorf("expected max latency 1s, got %v", o.MaxLatency)
+	}
+
+	// 100µs lands in the [64µs, 128µs) bucket.
+	if o.P50Latency != 128*time.Microsecond || o.P90Latency != 128*time.Microsecond {
+		t.Errorf("unexpected percentiles: p50 %v, p90 %v", o.P50Latency, o.P90Latency)
+	}
+	if o.Histogram[latencyBucket(100*time.Microsecond)] != 99 {
+		t.Errorf("unexpected histogram: %v", o.Histogram)
+	}
+}
+
+func Test_wireLogSummarizerConcurrentFlush(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewWireLogSummarizer(&buf, time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				s.OpFinished("LookUpInodeOp", 0, time.Microsecond)
+				s.Flush()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Each summary is whole, and starts when the previous one ended.
+	var count uint64
+	var prevEnd time.Time
+	d := json.NewDecoder(&buf)
+	for d.More() {
+		var summary WireLogSummary
+		if err := d.Decode(&summary); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+
+		if !prevEnd.IsZero() && !summary.StartTime.Equal(prevEnd) {
+			t.Errorf("summary starts at %v, previous ended at %v", summary.StartTime, prevEnd)
+		}
+		prevEnd = summary.EndTime
+
+		if o := summary.Ops["LookUpInodeOp"]; o != nil {
+			count += o.Count
+		}
+	}
+
+	if count != 200 {
+		t.Errorf("expected 200 ops, got %d", count)
+	}
+}
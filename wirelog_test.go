@@ -0,0 +1,459 @@
+package fuse
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+func Test_finishWireLogRecord(t *testing.T) {
+	wlog := NewWireLogRecord()
+	finishWireLogRecord(&fuseops.LookUpInodeOp{}, syscall.ENOENT, wlog)
+
+	if wlog.Operation != "LookUpInodeOp" {
+		t.Errorf("expected LookUpInodeOp, got %q", wlog.Operation)
+	}
+	if wlog.Status != int(syscall.ENOENT) {
+		t.Errorf("expected status %d, got %d", syscall.ENOENT, wlog.Status)
+	}
+	if wlog.StatusName != "ENOENT" {
+		t.Errorf("expected status name ENOENT, got %q", wlog.StatusName)
+	}
+	if wlog.Duration <= 0 {
+		t.Errorf("expected a positive duration, got %v", wlog.Duration)
+	}
+}
+
+func Test_shouldWriteWireLog(t *testing.T) {
+	const threshold = 10 * time.Millisecond
+
+	testCases := []struct {
+		name     string
+		cfg      MountConfig
+		status   int
+		duration time.Duration
+		want     bool
+	}{
+		{"no filters", MountConfig{}, 0, 0, true},
+		{"errors only, success", MountConfig{WireLogErrorsOnly: true}, 0, time.Second, false},
+		{"errors only, failure", MountConfig{WireLogErrorsOnly: true}, int(syscall.EIO), 0, true},
+		{"slow only, fast", MountConfig{WireLogSlowThreshold: threshold}, int(syscall.EIO), time.Millisecond, false},
+		{"slow only, slow", MountConfig{WireLogSlowThreshold: threshold}, 0, threshold, true},
+		{"both, fast success", MountConfig{WireLogErrorsOnly: true, WireLogSlowThreshold: threshold}, 0, time.Millisecond, false},
+		{"both, fast failure", MountConfig{WireLogErrorsOnly: true, WireLogSlowThreshold: threshold}, int(syscall.EIO), time.Millisecond, true},
+		{"both, slow success", MountConfig{WireLogErrorsOnly: true, WireLogSlowThreshold: threshold}, 0, time.Second, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wlog := &WireLogRecord{Status: tc.status, Duration: tc.duration}
+			if got := shouldWriteWireLog(&tc.cfg, wlog); got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_finishWireLogRecordNonErrno(t *testing.T) {
+	wlog := NewWireLogRecord()
+	finishWireLogRecord(&fuseops.StatFSOp{}, errors.New("taco"), wlog)
+
+	if wlog.Status != int(syscall.EIO) || wlog.StatusName != "EIO" {
+		t.Errorf("expected EIO for a non-errno error, got %d (%q)", wlog.Status, wlog.StatusName)
+	}
+
+	// Wrapped errnos are reported to the kernel as EIO too.
+	finishWireLogRecord(&fuseops.StatFSOp{}, fmt.Errorf("taco: %w", syscall.ENOENT), wlog)
+	if wlog.Status != int(syscall.EIO) {
+		t.Errorf("expected EIO for a wrapped errno, got %d", wlog.Status)
+	}
+}
+
+func Test_logfmtWireLogFormatter(t *testing.T) {
+	wlog := &WireLogRecord{
+		Operation:  "LookUpInodeOp",
+		StartTime:  time.Date(2025, 1, 2, 3, 4, 5, 6, time.UTC),
+		Duration:   1500 * time.Microsecond,
+		Status:     int(syscall.ENOENT),
+		StatusName: "ENOENT",
+		Context:    &fuseops.OpContext{FuseID: 42, Pid: 1234, Uid: 1000},
+		Args: map[string]any{
+			"Parent": fuseops.InodeID(1),
+			"Name":   "taco burrito",
+		},
+		Extra: map[string]any{
+			"lookup": "yes",
+		},
+	}
+
+	buf, err := LogfmtWireLogFormatter{}.Format(wlog)
+	if err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+
+	want := `time=2025-01-02T03:04:05.000000006Z op=LookUpInodeOp duration=1.5ms status=2 status_name=ENOENT fuse_id=42 pid=1234 uid=1000 Name="taco burrito" Parent=1 extra.lookup=yes` + "\n"
+	if got := string(buf); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func Test_wireLogSlogRecord(t *testing.T) {
+	wlog := &WireLogRecord{
+		Operation:  "LookUpInodeOp",
+		StartTime:  time.Date(2025, 1, 2, 3, 4, 5, 6, time.UTC),
+		Duration:   1500 * time.Microsecond,
+		Status:     int(syscall.ENOENT),
+		StatusName: "ENOENT",
+		Context:    &fuseops.OpContext{FuseID: 42, Pid: 1234, Uid: 1000},
+		Args: map[string]any{
+			"Parent": fuseops.InodeID(1),
+			"Name":   "taco",
+		},
+		Extra: map[string]any{
+			"lookup": "yes",
+		},
+	}
+
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, nil)
+	if err := handler.Handle(context.Background(), wireLogSlogRecord(wlog)); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+
+	want := `time=2025-01-02T03:04:05.000Z level=WARN msg=LookUpInodeOp duration=1.5ms status=2 status_name=ENOENT error="no such file or directory" context.fuse_id=42 context.pid=1234 context.uid=1000 args.Name=taco args.Parent=1 extra.lookup=yes` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func Test_wireLogLevel(t *testing.T) {
+	testCases := []struct {
+		name  string
+		err   error
+		level slog.Level
+	}{
+		{"success", nil, slog.LevelInfo},
+		{"errno", syscall.ENOENT, slog.LevelWarn},
+		{"non-errno", errors.New("taco"), slog.LevelWarn},
+	}
+
+	for _, tc := range testCases {
+		wlog := NewWireLogRecord()
+		finishWireLogRecord(&fuseops.StatFSOp{}, tc.err, wlog)
+		if got := wireLogLevel(wlog); got != tc.level {
+			t.Errorf("%s: expected level %v, got %v", tc.name, tc.level, got)
+		}
+	}
+}
+
+func Test_wireLogRedactors(t *testing.T) {
+	args := map[string]any{
+		"Parent": fuseops.InodeID(1),
+		"Name":   "secret.txt",
+		"Value":  []byte("hunter2"),
+	}
+
+	HashWireLogArgs("Name", "Value", "Parent")("LookUpInodeOp", args)
+	if got := args["Name"].(string); got == "secret.txt" || len(got) != 16 {
+		t.Errorf("expected Name to be hashed, got %v", got)
+	}
+	if _, ok := args["Value"].(string); !ok {
+		t.Errorf("expected Value to be hashed, got %v", args["Value"])
+	}
+	if got := args["Parent"]; got != fuseops.InodeID(1) {
+		t.Errorf("expected Parent to be untouched, got %v", got)
+	}
+
+	RedactWireLogArgs(SensitiveWireLogArgs...)("LookUpInodeOp", args)
+	if got := args["Name"]; got != "<redacted>" {
+		t.Errorf("expected Name to be redacted, got %v", got)
+	}
+	if _, ok := args["Target"]; ok {
+		t.Errorf("expected absent Target to stay absent")
+	}
+}
+
+func Test_jsonWireLogFormatterCompact(t *testing.T) {
+	wlog := &WireLogRecord{
+		Version:   WireLogVersion,
+		Operation: "StatFSOp",
+		StartTime: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Args:      map[string]any{"BlockSize": 4096},
+	}
+
+	buf, err := JSONWireLogFormatter{Compact: true}.Format(wlog)
+	if err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+
+	want := `{"Version":1,"Operation":"StatFSOp","StartTime":"2025-01-02T03:04:05Z","Duration":0,"QueueDelay":0,"HandlerDuration":0,"Status":0,"StatusName":"","Context":null,"Args":{"BlockSize":4096},"Extra":null}` + "\n"
+	if got := string(buf); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func Test_fillWireLogArgsPayload(t *testing.T) {
+	testCases := []struct {
+		name string
+		op   any
+		want any
+	}{
+		{
+			"read into Dst",
+			&fuseops.ReadFileOp{Dst: []byte("tacoburrito"), BytesRead: 3},
+			"746163",
+		},
+		{
+			"vectored read",
+			&fuseops.ReadFileOp{Data: [][]byte{[]byte("ta"), []byte("coburrito")}, BytesRead: 11},
+			"7461636f",
+		},
+		{
+			"write",
+			&fuseops.WriteFileOp{Data: []byte("enchilada")},
+			"656e6368",
+		},
+		{
+			"short write",
+			&fuseops.WriteFileOp{Data: []byte("e")},
+			"65",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wlog := NewWireLogRecord()
+			fillWireLogArgs(tc.op, &MountConfig{WireLogPayloadBytes: 4}, wlog)
+			if got := wlog.Args["Payload"]; got != tc.want {
+				t.Errorf("expected payload %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	wlog := NewWireLogRecord()
+	fillWireLogArgs(&fuseops.WriteFileOp{Data: []byte("taco")}, &MountConfig{}, wlog)
+	if _, ok := wlog.Args["Payload"]; ok {
+		t.Errorf("expected no payload when capture is disabled")
+	}
+}
+
+func Test_finishWireLogRecordQueueDelay(t *testing.T) {
+	wlog := NewWireLogRecord()
+	wlog.StartTime = time.Now().Add(-30 * time.Millisecond)
+	wlog.handlerStart = wlog.StartTime.Add(10 * time.Millisecond)
+	finishWireLogRecord(&fuseops.StatFSOp{}, nil, wlog)
+
+	if wlog.QueueDelay != 10*time.Millisecond {
+		t.Errorf("expected 10ms queue delay, got %v", wlog.QueueDelay)
+	}
+	if wlog.QueueDelay+wlog.HandlerDuration != wlog.Duration {
+		t.Errorf("expected %v + %v == %v", wlog.QueueDelay, wlog.HandlerDuration, wlog.Duration)
+	}
+}
+
+func Test_setWireLogger(t *testing.T) {
+	c := &Connection{}
+	if c.getWireLogger() != nil {
+		t.Fatalf("expected no wire logger")
+	}
+
+	var buf bytes.Buffer
+	c.SetWireLogger(&buf)
+	c.finishWireLog(context.Background(), &fuseops.StatFSOp{}, nil, NewWireLogRecord())
+	if buf.Len() == 0 {
+		t.Errorf("expected a record to be written")
+	}
+
+	buf.Reset()
+	c.SetWireLogger(nil)
+	c.finishWireLog(context.Background(), &fuseops.StatFSOp{}, nil, NewWireLogRecord())
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing to be written, got %q", buf.String())
+	}
+}
+
+func Test_interruptedWireLogRecord(t *testing.T) {
+	c := &Connection{
+		cfg:         MountConfig{OpContext: context.Background()},
+		cancelFuncs: make(map[uint64]func()),
+		interrupts:  make(map[uint64]time.Time),
+	}
+
+	const fuseID = 17
+	wlog := NewWireLogRecord()
+	ctx := c.beginOp(0, fuseID, nil)
+	if !c.handleInterrupt(fuseID) {
+		t.Fatalf("expected the op to be pending")
+	}
+	if ctx.Err() == nil {
+		t.Errorf("expected the op's context to be cancelled")
+	}
+
+	wlog.interruptTime = c.finishOp(0, fuseID)
+	finishWireLogRecord(&fuseops.StatFSOp{}, syscall.EINTR, wlog)
+
+	if !wlog.Interrupted {
+		t.Errorf("expected the record to be marked interrupted")
+	}
+	if wlog.CancelLatency < 0 || wlog.CancelLatency > wlog.Duration {
+		t.Errorf("unexpected cancel latency %v for duration %v", wlog.CancelLatency, wlog.Duration)
+	}
+
+	if c.handleInterrupt(fuseID) {
+		t.Errorf("expected the finished op not to be pending")
+	}
+	if len(c.interrupts) != 0 {
+		t.Errorf("expected no leftover interrupts, got %v", c.interrupts)
+	}
+}
+
+func Test_markWorkerAndGoroutine(t *testing.T) {
+	wlog := NewWireLogRecord()
+	ctx := context.WithValue(context.Background(), contextKey, opState{wlog: wlog})
+
+	MarkWorker(ctx, 3)
+	done := make(chan struct{})
+	go func() {
+		MarkHandlerStart(ctx)
+		close(done)
+	}()
+	<-done
+
+	if wlog.Worker != 3 {
+		t.Errorf("expected worker 3, got %d", wlog.Worker)
+	}
+	if wlog.Goroutine == 0 || wlog.Goroutine == goroutineID() {
+		t.Errorf("expected the handler's goroutine, got %d (test is on %d)", wlog.Goroutine, goroutineID())
+	}
+}
+
+func Test_wireLogRecordPool(t *testing.T) {
+	op := &fuseops.LookUpInodeOp{
+		Parent:    fuseops.RootInodeID,
+		Name:      "taco",
+		OpContext: fuseops.OpContext{FuseID: 7},
+	}
+
+	wlog := getWireLogRecord()
+	fillWireLogArgs(op, &MountConfig{}, wlog)
+	wlog.Extra["burrito"] = true
+	putWireLogRecord(wlog)
+
+	if len(wlog.Args) != 0 || len(wlog.Extra) != 0 || wlog.Context != nil {
+		t.Errorf("expected a reset record, got %+v", wlog)
+	}
+
+	fillWireLogArgs(&fuseops.StatFSOp{}, &MountConfig{}, wlog)
+	if _, ok := wlog.Args["Name"]; ok {
+		t.Errorf("unexpected leftover Name arg: %v", wlog.Args)
+	}
+}
+
+func Benchmark_fillWireLogArgs(b *testing.B) {
+	op := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "taco"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		wlog := getWireLogRecord()
+		fillWireLogArgs(op, &MountConfig{}, wlog)
+		putWireLogRecord(wlog)
+	}
+}
+
+func Test_wireLogRecordExtraSetters(t *testing.T) {
+	wlog := getWireLogRecord()
+	ctx := context.WithValue(context.Background(), contextKey, opState{wlog: wlog})
+	if GetWirelog(ctx) != wlog {
+		t.Fatalf("expected GetWirelog to return the op's record")
+	}
+
+	done := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		go func() {
+			wlog.AddDuration("backend", time.Millisecond)
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+
+	wlog.SetExtra("cache", "miss")
+	wlog.seal()
+	wlog.SetExtra("late", true)
+	wlog.AddDuration("backend", time.Second)
+
+	if got := wlog.Extra["backend"]; got != 10*time.Millisecond {
+		t.Errorf("expected 10ms backend time, got %v", got)
+	}
+	if got := wlog.Extra["cache"]; got != "miss" {
+		t.Errorf("expected cache miss, got %v", got)
+	}
+	if _, ok := wlog.Extra["late"]; ok {
+		t.Errorf("expected writes after sealing to be ignored")
+	}
+
+	// A record handed out by GetWirelog must not be recycled.
+	putWireLogRecord(wlog)
+	if len(wlog.Extra) == 0 {
+		t.Errorf("expected an escaped record to be left alone")
+	}
+}
+
+func Test_fillWireLogArgsDirents(t *testing.T) {
+	// Pack entries in the format written by fuseutil.WriteDirent, preceded by
+	// a zeroed fuse_entry_out for ReadDirPlus.
+	pack := func(plus bool, names ...string) []byte {
+		var buf []byte
+		for i, name := range names {
+			if plus {
+				buf = append(buf, make([]byte, direntPlusHeaderSize-direntHeaderSize)...)
+			}
+			buf = binary.NativeEndian.AppendUint64(buf, uint64(i+2))
+			buf = binary.NativeEndian.AppendUint64(buf, uint64(i+1))
+			buf = binary.NativeEndian.AppendUint32(buf, uint32(len(name)))
+			buf = binary.NativeEndian.AppendUint32(buf, 0)
+			buf = append(buf, name...)
+			for len(buf)%8 != 0 {
+				buf = append(buf, 0)
+			}
+		}
+		return buf
+	}
+
+	names := []string{"taco", "burrito", "enchiladas"}
+
+	dst := pack(false, names...)
+	wlog := NewWireLogRecord()
+	fillWireLogArgs(&fuseops.ReadDirOp{Dst: dst, BytesRead: len(dst)}, &MountConfig{}, wlog)
+	if got := wlog.Args["Entries"]; got != 3 {
+		t.Errorf("expected 3 entries, got %v", got)
+	}
+	if _, ok := wlog.Args["Names"]; ok {
+		t.Errorf("expected no names without WireLogDirentNames")
+	}
+
+	dst = pack(true, names...)
+	wlog = NewWireLogRecord()
+	op := &fuseops.ReadDirPlusOp{ReadDirOp: fuseops.ReadDirOp{Inode: 1, Dst: dst, BytesRead: len(dst)}}
+	fillWireLogArgs(op, &MountConfig{WireLogDirentNames: true}, wlog)
+	if got, ok := wlog.Args["Names"].([]string); !ok || !slices.Equal(got, names) {
+		t.Errorf("expected names %v, got %v", names, wlog.Args["Names"])
+	}
+
+	// Embedded ops are flattened.
+	if got := wlog.Args["Inode"]; got != fuseops.InodeID(1) {
+		t.Errorf("expected Inode arg 1, got %v", got)
+	}
+	if _, ok := wlog.Args["ReadDirOp"]; ok {
+		t.Errorf("unexpected ReadDirOp arg")
+	}
+}
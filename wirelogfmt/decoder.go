@@ -0,0 +1,120 @@
+// Copyright 2025 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wirelogfmt decodes wire logs written by fuse.MountConfig.WireLogger
+// with the default fuse.JSONWireLogFormatter, pretty-printed or compact, for
+// use by tools that analyze them.
+//
+// Each record is a JSON object with the fields of fuse.WireLogRecord. Version
+// identifies the schema (see fuse.WireLogVersion); records written before it
+// was introduced lack it and decode with Version zero. New fields may be added
+// without changing the version, and are ignored by older decoders.
+// Durations are integers in nanoseconds, and Args holds the op's fields keyed
+// by their Go names, with numbers decoded as json.Number so that large IDs
+// keep their precision. Use the Arg helpers to read them.
+//
+// Besides ops, a log contains records for events, whose Operation is one of
+// "Mount", "Unmount", "InterruptOp", "HandleSummary", or "NotImplemented".
+package wirelogfmt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/jacobsa/fuse"
+)
+
+// A Decoder reads wire log records from a stream.
+type Decoder struct {
+	dec *json.Decoder
+	n   int
+}
+
+// NewDecoder returns a Decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	return &Decoder{dec: dec}
+}
+
+// Decode returns the next record, or io.EOF at the end of the stream. Records
+// written with a newer schema version than this package knows about are
+// decoded as far as possible rather than rejected.
+func (d *Decoder) Decode() (*fuse.WireLogRecord, error) {
+	wlog := new(fuse.WireLogRecord)
+	if err := d.dec.Decode(wlog); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+
+		// A log cut off partway through a record, e.g. by a crash, shows up as
+		// an unexpected EOF.
+		return nil, fmt.Errorf("record %d: %w", d.n, err)
+	}
+
+	d.n++
+	return wlog, nil
+}
+
+// ReadAll reads all of the records in r.
+func ReadAll(r io.Reader) ([]*fuse.WireLogRecord, error) {
+	d := NewDecoder(r)
+
+	var records []*fuse.WireLogRecord
+	for {
+		wlog, err := d.Decode()
+		if err == io.EOF {
+			return records, nil
+		}
+
+		if err != nil {
+			return records, err
+		}
+
+		records = append(records, wlog)
+	}
+}
+
+// StringArg returns the string value of an Args key of a decoded record.
+func StringArg(wlog *fuse.WireLogRecord, key string) (string, bool) {
+	s, ok := wlog.Args[key].(string)
+	return s, ok
+}
+
+// Int64Arg returns the integer value of an Args key of a decoded record, such
+// as an offset or size.
+func Int64Arg(wlog *fuse.WireLogRecord, key string) (int64, bool) {
+	n, ok := wlog.Args[key].(json.Number)
+	if !ok {
+		return 0, false
+	}
+
+	i, err := n.Int64()
+	return i, err == nil
+}
+
+// Uint64Arg returns the unsigned integer value of an Args key of a decoded
+// record, such as an inode or handle ID, which may not fit in an int64.
+func Uint64Arg(wlog *fuse.WireLogRecord, key string) (uint64, bool) {
+	n, ok := wlog.Args[key].(json.Number)
+	if !ok {
+		return 0, false
+	}
+
+	u, err := strconv.ParseUint(n.String(), 10, 64)
+	return u, err == nil
+}
@@ -0,0 +1,73 @@
+package wirelogfmt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+func TestDecode(t *testing.T) {
+	var buf bytes.Buffer
+	for _, compact := range []bool{false, true} {
+		wlog := fuse.NewWireLogRecord()
+		wlog.Operation = "ReadFileOp"
+		wlog.Args["Inode"] = fuseops.InodeID(math.MaxUint64)
+		wlog.Args["Offset"] = int64(-1)
+		wlog.Args["Name"] = "taco"
+
+		entry, err := fuse.JSONWireLogFormatter{Compact: compact}.Format(wlog)
+		if err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		buf.Write(entry)
+	}
+
+	// A record from a newer version with a field we don't know about.
+	buf.WriteString(`{"Version":99,"Operation":"StatFSOp","Frobnication":true}`)
+
+	records, err := ReadAll(&buf)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+
+	for _, wlog := range records[:2] {
+		if wlog.Version != fuse.WireLogVersion {
+			t.Errorf("expected version %d, got %d", fuse.WireLogVersion, wlog.Version)
+		}
+		if got, ok := Uint64Arg(wlog, "Inode"); !ok || got != math.MaxUint64 {
+			t.Errorf("Inode: got %v, %v", got, ok)
+		}
+		if got, ok := Int64Arg(wlog, "Offset"); !ok || got != -1 {
+			t.Errorf("Offset: got %v, %v", got, ok)
+		}
+		if got, ok := StringArg(wlog, "Name"); !ok || got != "taco" {
+			t.Errorf("Name: got %q, %v", got, ok)
+		}
+	}
+
+	if got := records[2]; got.Version != 99 || got.Operation != "StatFSOp" {
+		t.Errorf("unexpected newer record: %+v", got)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`{"Operation":"StatFSOp"}` + "\n" + `{"Operation":"Loo`))
+
+	if _, err := d.Decode(); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	if _, err := d.Decode(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}